@@ -35,10 +35,24 @@ const (
 )
 
 type CacheHTTP struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Body          []byte                 `protobuf:"bytes,1,opt,name=body,proto3" json:"body,omitempty"`
-	Code          int64                  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
-	Headers       []*CacheHTTP_Header    `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Body    []byte                 `protobuf:"bytes,1,opt,name=body,proto3" json:"body,omitempty"`
+	Code    int64                  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
+	Headers []*CacheHTTP_Header    `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty"`
+	// SurrogateKeys are the generations of the surrogate keys tagging the entry
+	// at the time it was cached. The entry is stale once any of the surrogate
+	// keys is purged and its generation changes.
+	SurrogateKeys []*CacheHTTP_SurrogateKey `protobuf:"bytes,4,rep,name=surrogateKeys,proto3" json:"surrogateKeys,omitempty"`
+	// FreshUntil is the time in Unix milliseconds until which the entry is
+	// fresh. It is only set if serving stale entries is enabled. Otherwise, the
+	// entry is fresh until it expires.
+	FreshUntil int64 `protobuf:"varint,5,opt,name=freshUntil,proto3" json:"freshUntil,omitempty"`
+	// StaleWhileRevalidate is the duration in seconds after FreshUntil during
+	// which the entry is served while being revalidated in the background.
+	StaleWhileRevalidate uint32 `protobuf:"varint,6,opt,name=staleWhileRevalidate,proto3" json:"staleWhileRevalidate,omitempty"`
+	// StaleIfError is the duration in seconds after FreshUntil during which the
+	// entry is served if the upstream fails.
+	StaleIfError  uint32 `protobuf:"varint,7,opt,name=staleIfError,proto3" json:"staleIfError,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -94,6 +108,34 @@ func (x *CacheHTTP) GetHeaders() []*CacheHTTP_Header {
 	return nil
 }
 
+func (x *CacheHTTP) GetSurrogateKeys() []*CacheHTTP_SurrogateKey {
+	if x != nil {
+		return x.SurrogateKeys
+	}
+	return nil
+}
+
+func (x *CacheHTTP) GetFreshUntil() int64 {
+	if x != nil {
+		return x.FreshUntil
+	}
+	return 0
+}
+
+func (x *CacheHTTP) GetStaleWhileRevalidate() uint32 {
+	if x != nil {
+		return x.StaleWhileRevalidate
+	}
+	return 0
+}
+
+func (x *CacheHTTP) GetStaleIfError() uint32 {
+	if x != nil {
+		return x.StaleIfError
+	}
+	return 0
+}
+
 type CacheHTTP_Header struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
@@ -146,13 +188,65 @@ func (x *CacheHTTP_Header) GetValues() []string {
 	return nil
 }
 
+type CacheHTTP_SurrogateKey struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Generation    string                 `protobuf:"bytes,2,opt,name=generation,proto3" json:"generation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CacheHTTP_SurrogateKey) Reset() {
+	*x = CacheHTTP_SurrogateKey{}
+	mi := &file_cvigilv1_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CacheHTTP_SurrogateKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CacheHTTP_SurrogateKey) ProtoMessage() {}
+
+func (x *CacheHTTP_SurrogateKey) ProtoReflect() protoreflect.Message {
+	mi := &file_cvigilv1_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CacheHTTP_SurrogateKey.ProtoReflect.Descriptor instead.
+func (*CacheHTTP_SurrogateKey) Descriptor() ([]byte, []int) {
+	return file_cvigilv1_proto_rawDescGZIP(), []int{0, 1}
+}
+
+func (x *CacheHTTP_SurrogateKey) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *CacheHTTP_SurrogateKey) GetGeneration() string {
+	if x != nil {
+		return x.Generation
+	}
+	return ""
+}
+
 var File_cvigilv1_proto protoreflect.FileDescriptor
 
 var file_cvigilv1_proto_rawDesc = []byte{
 	0x0a, 0x0e, 0x63, 0x76, 0x69, 0x67, 0x69, 0x6c, 0x76, 0x31, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
 	0x12, 0x1d, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x63,
 	0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x2e, 0x76, 0x69, 0x67, 0x69, 0x6c, 0x2e, 0x76, 0x31, 0x22,
-	0xb2, 0x01, 0x0a, 0x09, 0x43, 0x61, 0x63, 0x68, 0x65, 0x48, 0x54, 0x54, 0x50, 0x12, 0x12, 0x0a,
+	0xc9, 0x03, 0x0a, 0x09, 0x43, 0x61, 0x63, 0x68, 0x65, 0x48, 0x54, 0x54, 0x50, 0x12, 0x12, 0x0a,
 	0x04, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x62, 0x6f, 0x64,
 	0x79, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
 	0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x49, 0x0a, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73,
@@ -160,14 +254,31 @@ var file_cvigilv1_proto_rawDesc = []byte{
 	0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x63, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x2e, 0x76, 0x69,
 	0x67, 0x69, 0x6c, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x61, 0x63, 0x68, 0x65, 0x48, 0x54, 0x54, 0x50,
 	0x2e, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x52, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73,
-	0x1a, 0x32, 0x0a, 0x06, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65,
-	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x16, 0x0a, 0x06,
-	0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x76, 0x61,
-	0x6c, 0x75, 0x65, 0x73, 0x42, 0x34, 0x5a, 0x32, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63,
-	0x6f, 0x6d, 0x2f, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2f, 0x6f, 0x63, 0x74, 0x65,
-	0x6c, 0x69, 0x75, 0x6d, 0x2f, 0x61, 0x70, 0x69, 0x73, 0x2f, 0x63, 0x6c, 0x75, 0x73, 0x74, 0x65,
-	0x72, 0x2f, 0x63, 0x76, 0x69, 0x67, 0x69, 0x6c, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x33,
+	0x12, 0x5b, 0x0a, 0x0d, 0x73, 0x75, 0x72, 0x72, 0x6f, 0x67, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79,
+	0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x35, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69,
+	0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x63, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x2e, 0x76,
+	0x69, 0x67, 0x69, 0x6c, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x61, 0x63, 0x68, 0x65, 0x48, 0x54, 0x54,
+	0x50, 0x2e, 0x53, 0x75, 0x72, 0x72, 0x6f, 0x67, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x52, 0x0d,
+	0x73, 0x75, 0x72, 0x72, 0x6f, 0x67, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x73, 0x12, 0x1e, 0x0a,
+	0x0a, 0x66, 0x72, 0x65, 0x73, 0x68, 0x55, 0x6e, 0x74, 0x69, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x0a, 0x66, 0x72, 0x65, 0x73, 0x68, 0x55, 0x6e, 0x74, 0x69, 0x6c, 0x12, 0x32, 0x0a,
+	0x14, 0x73, 0x74, 0x61, 0x6c, 0x65, 0x57, 0x68, 0x69, 0x6c, 0x65, 0x52, 0x65, 0x76, 0x61, 0x6c,
+	0x69, 0x64, 0x61, 0x74, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x14, 0x73, 0x74, 0x61,
+	0x6c, 0x65, 0x57, 0x68, 0x69, 0x6c, 0x65, 0x52, 0x65, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74,
+	0x65, 0x12, 0x22, 0x0a, 0x0c, 0x73, 0x74, 0x61, 0x6c, 0x65, 0x49, 0x66, 0x45, 0x72, 0x72, 0x6f,
+	0x72, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x73, 0x74, 0x61, 0x6c, 0x65, 0x49, 0x66,
+	0x45, 0x72, 0x72, 0x6f, 0x72, 0x1a, 0x32, 0x0a, 0x06, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12,
+	0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65,
+	0x79, 0x12, 0x16, 0x0a, 0x06, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x06, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x1a, 0x40, 0x0a, 0x0c, 0x53, 0x75, 0x72,
+	0x72, 0x6f, 0x67, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x1e, 0x0a, 0x0a, 0x67,
+	0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0a, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x42, 0x34, 0x5a, 0x32, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69,
+	0x75, 0x6d, 0x2f, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2f, 0x61, 0x70, 0x69, 0x73,
+	0x2f, 0x63, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x2f, 0x63, 0x76, 0x69, 0x67, 0x69, 0x6c, 0x76,
+	0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -182,18 +293,20 @@ func file_cvigilv1_proto_rawDescGZIP() []byte {
 	return file_cvigilv1_proto_rawDescData
 }
 
-var file_cvigilv1_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_cvigilv1_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_cvigilv1_proto_goTypes = []any{
-	(*CacheHTTP)(nil),        // 0: octelium.api.cluster.vigil.v1.CacheHTTP
-	(*CacheHTTP_Header)(nil), // 1: octelium.api.cluster.vigil.v1.CacheHTTP.Header
+	(*CacheHTTP)(nil),              // 0: octelium.api.cluster.vigil.v1.CacheHTTP
+	(*CacheHTTP_Header)(nil),       // 1: octelium.api.cluster.vigil.v1.CacheHTTP.Header
+	(*CacheHTTP_SurrogateKey)(nil), // 2: octelium.api.cluster.vigil.v1.CacheHTTP.SurrogateKey
 }
 var file_cvigilv1_proto_depIdxs = []int32{
 	1, // 0: octelium.api.cluster.vigil.v1.CacheHTTP.headers:type_name -> octelium.api.cluster.vigil.v1.CacheHTTP.Header
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	2, // 1: octelium.api.cluster.vigil.v1.CacheHTTP.surrogateKeys:type_name -> octelium.api.cluster.vigil.v1.CacheHTTP.SurrogateKey
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_cvigilv1_proto_init() }
@@ -207,7 +320,7 @@ func file_cvigilv1_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_cvigilv1_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
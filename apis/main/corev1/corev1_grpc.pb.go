@@ -98,6 +98,7 @@ const (
 	MainService_UpdateConfig_FullMethodName            = "/octelium.api.main.core.v1.MainService/UpdateConfig"
 	MainService_DeleteConfig_FullMethodName            = "/octelium.api.main.core.v1.MainService/DeleteConfig"
 	MainService_GetConfig_FullMethodName               = "/octelium.api.main.core.v1.MainService/GetConfig"
+	MainService_Watch_FullMethodName                   = "/octelium.api.main.core.v1.MainService/Watch"
 )
 
 // MainServiceClient is the client API for MainService service.
@@ -232,6 +233,9 @@ type MainServiceClient interface {
 	DeleteConfig(ctx context.Context, in *metav1.DeleteOptions, opts ...grpc.CallOption) (*metav1.OperationResult, error)
 	// GetConfig retrieves a specific Config
 	GetConfig(ctx context.Context, in *metav1.GetOptions, opts ...grpc.CallOption) (*Config, error)
+	// Watch streams the creation, update and deletion events of the resources
+	// of a specific kind
+	Watch(ctx context.Context, in *WatchOptions, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
 }
 
 type mainServiceClient struct {
@@ -882,6 +886,25 @@ func (c *mainServiceClient) GetConfig(ctx context.Context, in *metav1.GetOptions
 	return out, nil
 }
 
+func (c *mainServiceClient) Watch(ctx context.Context, in *WatchOptions, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MainService_ServiceDesc.Streams[0], MainService_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchOptions, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MainService_WatchClient = grpc.ServerStreamingClient[WatchEvent]
+
 // MainServiceServer is the server API for MainService service.
 // All implementations must embed UnimplementedMainServiceServer
 // for forward compatibility.
@@ -1014,6 +1037,9 @@ type MainServiceServer interface {
 	DeleteConfig(context.Context, *metav1.DeleteOptions) (*metav1.OperationResult, error)
 	// GetConfig retrieves a specific Config
 	GetConfig(context.Context, *metav1.GetOptions) (*Config, error)
+	// Watch streams the creation, update and deletion events of the resources
+	// of a specific kind
+	Watch(*WatchOptions, grpc.ServerStreamingServer[WatchEvent]) error
 	mustEmbedUnimplementedMainServiceServer()
 }
 
@@ -1216,6 +1242,9 @@ func (UnimplementedMainServiceServer) DeleteConfig(context.Context, *metav1.Dele
 func (UnimplementedMainServiceServer) GetConfig(context.Context, *metav1.GetOptions) (*Config, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
 }
+func (UnimplementedMainServiceServer) Watch(*WatchOptions, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedMainServiceServer) mustEmbedUnimplementedMainServiceServer() {}
 func (UnimplementedMainServiceServer) testEmbeddedByValue()                     {}
 
@@ -2389,6 +2418,17 @@ func _MainService_GetConfig_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MainService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchOptions)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MainServiceServer).Watch(m, &grpc.GenericServerStream[WatchOptions, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MainService_WatchServer = grpc.ServerStreamingServer[WatchEvent]
+
 // MainService_ServiceDesc is the grpc.ServiceDesc for MainService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -2653,6 +2693,12 @@ var MainService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _MainService_GetConfig_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _MainService_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "corev1.proto",
 }
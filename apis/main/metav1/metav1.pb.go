@@ -35,6 +35,63 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type DeleteOptions_Cascade int32
+
+const (
+	DeleteOptions_CASCADE_UNSET DeleteOptions_Cascade = 0
+	// FOREGROUND deletes the children before deleting the object and only
+	// returns once they are all deleted.
+	DeleteOptions_FOREGROUND DeleteOptions_Cascade = 1
+	// BACKGROUND deletes the object and returns immediately while the
+	// children are deleted afterwards.
+	DeleteOptions_BACKGROUND DeleteOptions_Cascade = 2
+	// ORPHAN deletes the object and leaves its children.
+	DeleteOptions_ORPHAN DeleteOptions_Cascade = 3
+)
+
+// Enum value maps for DeleteOptions_Cascade.
+var (
+	DeleteOptions_Cascade_name = map[int32]string{
+		0: "CASCADE_UNSET",
+		1: "FOREGROUND",
+		2: "BACKGROUND",
+		3: "ORPHAN",
+	}
+	DeleteOptions_Cascade_value = map[string]int32{
+		"CASCADE_UNSET": 0,
+		"FOREGROUND":    1,
+		"BACKGROUND":    2,
+		"ORPHAN":        3,
+	}
+)
+
+func (x DeleteOptions_Cascade) Enum() *DeleteOptions_Cascade {
+	p := new(DeleteOptions_Cascade)
+	*p = x
+	return p
+}
+
+func (x DeleteOptions_Cascade) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DeleteOptions_Cascade) Descriptor() protoreflect.EnumDescriptor {
+	return file_metav1_proto_enumTypes[0].Descriptor()
+}
+
+func (DeleteOptions_Cascade) Type() protoreflect.EnumType {
+	return &file_metav1_proto_enumTypes[0]
+}
+
+func (x DeleteOptions_Cascade) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DeleteOptions_Cascade.Descriptor instead.
+func (DeleteOptions_Cascade) EnumDescriptor() ([]byte, []int) {
+	return file_metav1_proto_rawDescGZIP(), []int{4, 0}
+}
+
 type CommonListOptions_OrderBy_Type int32
 
 const (
@@ -68,11 +125,11 @@ func (x CommonListOptions_OrderBy_Type) String() string {
 }
 
 func (CommonListOptions_OrderBy_Type) Descriptor() protoreflect.EnumDescriptor {
-	return file_metav1_proto_enumTypes[0].Descriptor()
+	return file_metav1_proto_enumTypes[1].Descriptor()
 }
 
 func (CommonListOptions_OrderBy_Type) Type() protoreflect.EnumType {
-	return &file_metav1_proto_enumTypes[0]
+	return &file_metav1_proto_enumTypes[1]
 }
 
 func (x CommonListOptions_OrderBy_Type) Number() protoreflect.EnumNumber {
@@ -81,7 +138,7 @@ func (x CommonListOptions_OrderBy_Type) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use CommonListOptions_OrderBy_Type.Descriptor instead.
 func (CommonListOptions_OrderBy_Type) EnumDescriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{10, 0, 0}
+	return file_metav1_proto_rawDescGZIP(), []int{11, 0, 0}
 }
 
 type CommonListOptions_OrderBy_Mode int32
@@ -117,11 +174,11 @@ func (x CommonListOptions_OrderBy_Mode) String() string {
 }
 
 func (CommonListOptions_OrderBy_Mode) Descriptor() protoreflect.EnumDescriptor {
-	return file_metav1_proto_enumTypes[1].Descriptor()
+	return file_metav1_proto_enumTypes[2].Descriptor()
 }
 
 func (CommonListOptions_OrderBy_Mode) Type() protoreflect.EnumType {
-	return &file_metav1_proto_enumTypes[1]
+	return &file_metav1_proto_enumTypes[2]
 }
 
 func (x CommonListOptions_OrderBy_Mode) Number() protoreflect.EnumNumber {
@@ -130,7 +187,7 @@ func (x CommonListOptions_OrderBy_Mode) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use CommonListOptions_OrderBy_Mode.Descriptor instead.
 func (CommonListOptions_OrderBy_Mode) EnumDescriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{10, 0, 1}
+	return file_metav1_proto_rawDescGZIP(), []int{11, 0, 1}
 }
 
 type Metadata struct {
@@ -187,7 +244,10 @@ type Metadata struct {
 	// should not be exposed via the APIs.
 	IsSystemHidden bool `protobuf:"varint,18,opt,name=isSystemHidden,proto3" json:"isSystemHidden,omitempty"`
 	// SystemLabels is a similar map to specLabels. Used only by the Cluster.
-	SystemLabels  map[string]string `protobuf:"bytes,19,rep,name=systemLabels,proto3" json:"systemLabels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	SystemLabels map[string]string `protobuf:"bytes,19,rep,name=systemLabels,proto3" json:"systemLabels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// ManagedFields tracks the ownership of the fields of the resource by the
+	// field managers that used server-side apply to update it. Read-only.
+	ManagedFields []*ManagedField `protobuf:"bytes,20,rep,name=managedFields,proto3" json:"managedFields,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -355,6 +415,78 @@ func (x *Metadata) GetSystemLabels() map[string]string {
 	return nil
 }
 
+func (x *Metadata) GetManagedFields() []*ManagedField {
+	if x != nil {
+		return x.ManagedFields
+	}
+	return nil
+}
+
+type ManagedField struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Manager is the identity of the field manager (e.g. "octeliumctl").
+	Manager string `protobuf:"bytes,1,opt,name=manager,proto3" json:"manager,omitempty"`
+	// Fields is the list of field paths owned by the manager. Paths use the JSON
+	// field names separated by dots (e.g. "spec.config.upstream.url") whereas
+	// map entries are addressed by their keys (e.g. "metadata.labels[app]").
+	Fields []string `protobuf:"bytes,2,rep,name=fields,proto3" json:"fields,omitempty"`
+	// UpdatedAt is the timestamp of the last apply by the manager.
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=updatedAt,proto3" json:"updatedAt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ManagedField) Reset() {
+	*x = ManagedField{}
+	mi := &file_metav1_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ManagedField) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ManagedField) ProtoMessage() {}
+
+func (x *ManagedField) ProtoReflect() protoreflect.Message {
+	mi := &file_metav1_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ManagedField.ProtoReflect.Descriptor instead.
+func (*ManagedField) Descriptor() ([]byte, []int) {
+	return file_metav1_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ManagedField) GetManager() string {
+	if x != nil {
+		return x.Manager
+	}
+	return ""
+}
+
+func (x *ManagedField) GetFields() []string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *ManagedField) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
 type ObjectReference struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// APIVersion is the API version of the reference resource
@@ -373,7 +505,7 @@ type ObjectReference struct {
 
 func (x *ObjectReference) Reset() {
 	*x = ObjectReference{}
-	mi := &file_metav1_proto_msgTypes[1]
+	mi := &file_metav1_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -385,7 +517,7 @@ func (x *ObjectReference) String() string {
 func (*ObjectReference) ProtoMessage() {}
 
 func (x *ObjectReference) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[1]
+	mi := &file_metav1_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -398,7 +530,7 @@ func (x *ObjectReference) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ObjectReference.ProtoReflect.Descriptor instead.
 func (*ObjectReference) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{1}
+	return file_metav1_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *ObjectReference) GetApiVersion() string {
@@ -454,7 +586,7 @@ type Duration struct {
 
 func (x *Duration) Reset() {
 	*x = Duration{}
-	mi := &file_metav1_proto_msgTypes[2]
+	mi := &file_metav1_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -466,7 +598,7 @@ func (x *Duration) String() string {
 func (*Duration) ProtoMessage() {}
 
 func (x *Duration) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[2]
+	mi := &file_metav1_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -479,7 +611,7 @@ func (x *Duration) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Duration.ProtoReflect.Descriptor instead.
 func (*Duration) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{2}
+	return file_metav1_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *Duration) GetType() isDuration_Type {
@@ -611,14 +743,19 @@ type DeleteOptions struct {
 	Uid string `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
 	// Name is the object name that needs to be deleted. Either the name or the
 	// UID must be used.
-	Name          string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Cascade sets how the child resources of the object are handled. It is
+	// currently only used by DeleteNamespace where the child resources are the
+	// Namespace's Services. Unset defaults to FOREGROUND. ORPHAN must be set
+	// explicitly to keep the children.
+	Cascade       DeleteOptions_Cascade `protobuf:"varint,3,opt,name=cascade,proto3,enum=octelium.api.main.meta.v1.DeleteOptions_Cascade" json:"cascade,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *DeleteOptions) Reset() {
 	*x = DeleteOptions{}
-	mi := &file_metav1_proto_msgTypes[3]
+	mi := &file_metav1_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -630,7 +767,7 @@ func (x *DeleteOptions) String() string {
 func (*DeleteOptions) ProtoMessage() {}
 
 func (x *DeleteOptions) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[3]
+	mi := &file_metav1_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -643,7 +780,7 @@ func (x *DeleteOptions) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeleteOptions.ProtoReflect.Descriptor instead.
 func (*DeleteOptions) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{3}
+	return file_metav1_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *DeleteOptions) GetUid() string {
@@ -660,6 +797,13 @@ func (x *DeleteOptions) GetName() string {
 	return ""
 }
 
+func (x *DeleteOptions) GetCascade() DeleteOptions_Cascade {
+	if x != nil {
+		return x.Cascade
+	}
+	return DeleteOptions_CASCADE_UNSET
+}
+
 type GetOptions struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// UID is the object's UID
@@ -672,7 +816,7 @@ type GetOptions struct {
 
 func (x *GetOptions) Reset() {
 	*x = GetOptions{}
-	mi := &file_metav1_proto_msgTypes[4]
+	mi := &file_metav1_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -684,7 +828,7 @@ func (x *GetOptions) String() string {
 func (*GetOptions) ProtoMessage() {}
 
 func (x *GetOptions) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[4]
+	mi := &file_metav1_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -697,7 +841,7 @@ func (x *GetOptions) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetOptions.ProtoReflect.Descriptor instead.
 func (*GetOptions) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{4}
+	return file_metav1_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *GetOptions) GetUid() string {
@@ -715,14 +859,17 @@ func (x *GetOptions) GetName() string {
 }
 
 type OperationResult struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// CountAffected is the number of child resources affected by the
+	// operation, e.g. the Services deleted or orphaned by DeleteNamespace.
+	CountAffected uint32 `protobuf:"varint,1,opt,name=countAffected,proto3" json:"countAffected,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *OperationResult) Reset() {
 	*x = OperationResult{}
-	mi := &file_metav1_proto_msgTypes[5]
+	mi := &file_metav1_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -734,7 +881,7 @@ func (x *OperationResult) String() string {
 func (*OperationResult) ProtoMessage() {}
 
 func (x *OperationResult) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[5]
+	mi := &file_metav1_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -747,7 +894,14 @@ func (x *OperationResult) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use OperationResult.ProtoReflect.Descriptor instead.
 func (*OperationResult) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{5}
+	return file_metav1_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *OperationResult) GetCountAffected() uint32 {
+	if x != nil {
+		return x.CountAffected
+	}
+	return 0
 }
 
 type DualStackIP struct {
@@ -762,7 +916,7 @@ type DualStackIP struct {
 
 func (x *DualStackIP) Reset() {
 	*x = DualStackIP{}
-	mi := &file_metav1_proto_msgTypes[6]
+	mi := &file_metav1_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -774,7 +928,7 @@ func (x *DualStackIP) String() string {
 func (*DualStackIP) ProtoMessage() {}
 
 func (x *DualStackIP) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[6]
+	mi := &file_metav1_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -787,7 +941,7 @@ func (x *DualStackIP) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DualStackIP.ProtoReflect.Descriptor instead.
 func (*DualStackIP) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{6}
+	return file_metav1_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *DualStackIP) GetIpv4() string {
@@ -818,7 +972,7 @@ type DualStackNetwork struct {
 
 func (x *DualStackNetwork) Reset() {
 	*x = DualStackNetwork{}
-	mi := &file_metav1_proto_msgTypes[7]
+	mi := &file_metav1_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -830,7 +984,7 @@ func (x *DualStackNetwork) String() string {
 func (*DualStackNetwork) ProtoMessage() {}
 
 func (x *DualStackNetwork) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[7]
+	mi := &file_metav1_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -843,7 +997,7 @@ func (x *DualStackNetwork) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DualStackNetwork.ProtoReflect.Descriptor instead.
 func (*DualStackNetwork) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{7}
+	return file_metav1_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *DualStackNetwork) GetV4() string {
@@ -876,7 +1030,7 @@ type ListResponseMeta struct {
 
 func (x *ListResponseMeta) Reset() {
 	*x = ListResponseMeta{}
-	mi := &file_metav1_proto_msgTypes[8]
+	mi := &file_metav1_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -888,7 +1042,7 @@ func (x *ListResponseMeta) String() string {
 func (*ListResponseMeta) ProtoMessage() {}
 
 func (x *ListResponseMeta) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[8]
+	mi := &file_metav1_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -901,7 +1055,7 @@ func (x *ListResponseMeta) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListResponseMeta.ProtoReflect.Descriptor instead.
 func (*ListResponseMeta) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{8}
+	return file_metav1_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *ListResponseMeta) GetPage() uint32 {
@@ -950,7 +1104,7 @@ type LogMetadata struct {
 
 func (x *LogMetadata) Reset() {
 	*x = LogMetadata{}
-	mi := &file_metav1_proto_msgTypes[9]
+	mi := &file_metav1_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -962,7 +1116,7 @@ func (x *LogMetadata) String() string {
 func (*LogMetadata) ProtoMessage() {}
 
 func (x *LogMetadata) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[9]
+	mi := &file_metav1_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -975,7 +1129,7 @@ func (x *LogMetadata) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use LogMetadata.ProtoReflect.Descriptor instead.
 func (*LogMetadata) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{9}
+	return file_metav1_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *LogMetadata) GetId() string {
@@ -1020,7 +1174,7 @@ type CommonListOptions struct {
 
 func (x *CommonListOptions) Reset() {
 	*x = CommonListOptions{}
-	mi := &file_metav1_proto_msgTypes[10]
+	mi := &file_metav1_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1032,7 +1186,7 @@ func (x *CommonListOptions) String() string {
 func (*CommonListOptions) ProtoMessage() {}
 
 func (x *CommonListOptions) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[10]
+	mi := &file_metav1_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1045,7 +1199,7 @@ func (x *CommonListOptions) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommonListOptions.ProtoReflect.Descriptor instead.
 func (*CommonListOptions) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{10}
+	return file_metav1_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *CommonListOptions) GetPage() uint32 {
@@ -1079,7 +1233,7 @@ type CommonListOptions_OrderBy struct {
 
 func (x *CommonListOptions_OrderBy) Reset() {
 	*x = CommonListOptions_OrderBy{}
-	mi := &file_metav1_proto_msgTypes[15]
+	mi := &file_metav1_proto_msgTypes[16]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1091,7 +1245,7 @@ func (x *CommonListOptions_OrderBy) String() string {
 func (*CommonListOptions_OrderBy) ProtoMessage() {}
 
 func (x *CommonListOptions_OrderBy) ProtoReflect() protoreflect.Message {
-	mi := &file_metav1_proto_msgTypes[15]
+	mi := &file_metav1_proto_msgTypes[16]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1104,7 +1258,7 @@ func (x *CommonListOptions_OrderBy) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommonListOptions_OrderBy.ProtoReflect.Descriptor instead.
 func (*CommonListOptions_OrderBy) Descriptor() ([]byte, []int) {
-	return file_metav1_proto_rawDescGZIP(), []int{10, 0}
+	return file_metav1_proto_rawDescGZIP(), []int{11, 0}
 }
 
 func (x *CommonListOptions_OrderBy) GetType() CommonListOptions_OrderBy_Type {
@@ -1128,7 +1282,7 @@ var file_metav1_proto_rawDesc = []byte{
 	0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x6d, 0x61, 0x69,
 	0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
 	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73,
-	0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x94, 0x09, 0x0a, 0x08, 0x4d,
+	0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xe3, 0x09, 0x0a, 0x08, 0x4d,
 	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x69, 0x64, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
 	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x38, 0x0a,
@@ -1186,113 +1340,137 @@ var file_metav1_proto_rawDesc = []byte{
 	0x2e, 0x6d, 0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x65,
 	0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x53, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x4c, 0x61, 0x62,
 	0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0c, 0x73, 0x79, 0x73, 0x74, 0x65, 0x6d,
-	0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x1a, 0x39, 0x0a, 0x0b, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73,
-	0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38,
-	0x01, 0x1a, 0x3e, 0x0a, 0x10, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73,
-	0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38,
-	0x01, 0x1a, 0x3d, 0x0a, 0x0f, 0x53, 0x70, 0x65, 0x63, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45,
+	0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x12, 0x4d, 0x0a, 0x0d, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65,
+	0x64, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x18, 0x14, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x27, 0x2e,
+	0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x6d, 0x61, 0x69,
+	0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65,
+	0x64, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x0d, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x64, 0x46,
+	0x69, 0x65, 0x6c, 0x64, 0x73, 0x1a, 0x39, 0x0a, 0x0b, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01,
+	0x1a, 0x3e, 0x0a, 0x10, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x45,
 	0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18,
 	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01,
-	0x1a, 0x3f, 0x0a, 0x11, 0x53, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73,
-	0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38,
-	0x01, 0x22, 0x95, 0x01, 0x0a, 0x0f, 0x4f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x52, 0x65, 0x66, 0x65,
-	0x72, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x61, 0x70, 0x69, 0x56, 0x65, 0x72, 0x73,
-	0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x61, 0x70, 0x69, 0x56, 0x65,
-	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x69, 0x64,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e,
-	0x61, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12,
-	0x28, 0x0a, 0x0f, 0x72, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69,
-	0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x72, 0x65, 0x73, 0x6f, 0x75, 0x72,
-	0x63, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0xd0, 0x01, 0x0a, 0x08, 0x44, 0x75,
-	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x24, 0x0a, 0x0c, 0x6d, 0x69, 0x6c, 0x6c, 0x69, 0x73,
-	0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x0c,
-	0x6d, 0x69, 0x6c, 0x6c, 0x69, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12, 0x1a, 0x0a, 0x07,
-	0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52,
-	0x07, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12, 0x1a, 0x0a, 0x07, 0x6d, 0x69, 0x6e, 0x75,
-	0x74, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x07, 0x6d, 0x69, 0x6e,
-	0x75, 0x74, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x05, 0x68, 0x6f, 0x75, 0x72, 0x73, 0x18, 0x04, 0x20,
-	0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x05, 0x68, 0x6f, 0x75, 0x72, 0x73, 0x12, 0x14, 0x0a, 0x04,
-	0x64, 0x61, 0x79, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x04, 0x64, 0x61,
-	0x79, 0x73, 0x12, 0x16, 0x0a, 0x05, 0x77, 0x65, 0x65, 0x6b, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28,
-	0x0d, 0x48, 0x00, 0x52, 0x05, 0x77, 0x65, 0x65, 0x6b, 0x73, 0x12, 0x18, 0x0a, 0x06, 0x6d, 0x6f,
-	0x6e, 0x74, 0x68, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x06, 0x6d, 0x6f,
-	0x6e, 0x74, 0x68, 0x73, 0x42, 0x06, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x22, 0x35, 0x0a, 0x0d,
-	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x10, 0x0a,
-	0x03, 0x75, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x69, 0x64, 0x12,
-	0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e,
-	0x61, 0x6d, 0x65, 0x22, 0x32, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
-	0x73, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
-	0x75, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x11, 0x0a, 0x0f, 0x4f, 0x70, 0x65, 0x72, 0x61,
-	0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x35, 0x0a, 0x0b, 0x44, 0x75,
-	0x61, 0x6c, 0x53, 0x74, 0x61, 0x63, 0x6b, 0x49, 0x50, 0x12, 0x12, 0x0a, 0x04, 0x69, 0x70, 0x76,
-	0x34, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x69, 0x70, 0x76, 0x34, 0x12, 0x12, 0x0a,
-	0x04, 0x69, 0x70, 0x76, 0x36, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x69, 0x70, 0x76,
-	0x36, 0x22, 0x32, 0x0a, 0x10, 0x44, 0x75, 0x61, 0x6c, 0x53, 0x74, 0x61, 0x63, 0x6b, 0x4e, 0x65,
-	0x74, 0x77, 0x6f, 0x72, 0x6b, 0x12, 0x0e, 0x0a, 0x02, 0x76, 0x34, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x02, 0x76, 0x34, 0x12, 0x0e, 0x0a, 0x02, 0x76, 0x36, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x02, 0x76, 0x36, 0x22, 0x84, 0x01, 0x0a, 0x10, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61,
-	0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x70, 0x61, 0x67, 0x65, 0x12, 0x22,
-	0x0a, 0x0c, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x50, 0x65, 0x72, 0x50, 0x61, 0x67, 0x65, 0x18, 0x02,
-	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x50, 0x65, 0x72, 0x50, 0x61,
-	0x67, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x43, 0x6f, 0x75, 0x6e, 0x74,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x43, 0x6f, 0x75,
-	0x6e, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x68, 0x61, 0x73, 0x4d, 0x6f, 0x72, 0x65, 0x18, 0x04, 0x20,
-	0x01, 0x28, 0x08, 0x52, 0x07, 0x68, 0x61, 0x73, 0x4d, 0x6f, 0x72, 0x65, 0x22, 0xe9, 0x01, 0x0a,
-	0x0b, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x0e, 0x0a, 0x02,
-	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x38, 0x0a, 0x09,
-	0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
-	0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x63, 0x72, 0x65,
-	0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x46, 0x0a, 0x08, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x52,
-	0x65, 0x66, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x2a, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c,
+	0x1a, 0x3d, 0x0a, 0x0f, 0x53, 0x70, 0x65, 0x63, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a,
+	0x3f, 0x0a, 0x11, 0x53, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01,
+	0x22, 0x7a, 0x0a, 0x0c, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x64, 0x46, 0x69, 0x65, 0x6c, 0x64,
+	0x12, 0x18, 0x0a, 0x07, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x69,
+	0x65, 0x6c, 0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x66, 0x69, 0x65, 0x6c,
+	0x64, 0x73, 0x12, 0x38, 0x0a, 0x09, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x52, 0x09, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x22, 0x95, 0x01, 0x0a,
+	0x0f, 0x4f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x52, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65,
+	0x12, 0x1e, 0x0a, 0x0a, 0x61, 0x70, 0x69, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x61, 0x70, 0x69, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
+	0x12, 0x12, 0x0a, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x6b, 0x69, 0x6e, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x03, 0x75, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x28, 0x0a, 0x0f, 0x72, 0x65,
+	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0f, 0x72, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x56, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x22, 0xd0, 0x01, 0x0a, 0x08, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x24, 0x0a, 0x0c, 0x6d, 0x69, 0x6c, 0x6c, 0x69, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64,
+	0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x0c, 0x6d, 0x69, 0x6c, 0x6c, 0x69,
+	0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12, 0x1a, 0x0a, 0x07, 0x73, 0x65, 0x63, 0x6f, 0x6e,
+	0x64, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x07, 0x73, 0x65, 0x63, 0x6f,
+	0x6e, 0x64, 0x73, 0x12, 0x1a, 0x0a, 0x07, 0x6d, 0x69, 0x6e, 0x75, 0x74, 0x65, 0x73, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x07, 0x6d, 0x69, 0x6e, 0x75, 0x74, 0x65, 0x73, 0x12,
+	0x16, 0x0a, 0x05, 0x68, 0x6f, 0x75, 0x72, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00,
+	0x52, 0x05, 0x68, 0x6f, 0x75, 0x72, 0x73, 0x12, 0x14, 0x0a, 0x04, 0x64, 0x61, 0x79, 0x73, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x04, 0x64, 0x61, 0x79, 0x73, 0x12, 0x16, 0x0a,
+	0x05, 0x77, 0x65, 0x65, 0x6b, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x05,
+	0x77, 0x65, 0x65, 0x6b, 0x73, 0x12, 0x18, 0x0a, 0x06, 0x6d, 0x6f, 0x6e, 0x74, 0x68, 0x73, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x06, 0x6d, 0x6f, 0x6e, 0x74, 0x68, 0x73, 0x42,
+	0x06, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x22, 0xcb, 0x01, 0x0a, 0x0d, 0x44, 0x65, 0x6c, 0x65,
+	0x74, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12,
+	0x4a, 0x0a, 0x07, 0x63, 0x61, 0x73, 0x63, 0x61, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x30, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e,
+	0x6d, 0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x44, 0x65, 0x6c,
+	0x65, 0x74, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x43, 0x61, 0x73, 0x63, 0x61,
+	0x64, 0x65, 0x52, 0x07, 0x63, 0x61, 0x73, 0x63, 0x61, 0x64, 0x65, 0x22, 0x48, 0x0a, 0x07, 0x43,
+	0x61, 0x73, 0x63, 0x61, 0x64, 0x65, 0x12, 0x11, 0x0a, 0x0d, 0x43, 0x41, 0x53, 0x43, 0x41, 0x44,
+	0x45, 0x5f, 0x55, 0x4e, 0x53, 0x45, 0x54, 0x10, 0x00, 0x12, 0x0e, 0x0a, 0x0a, 0x46, 0x4f, 0x52,
+	0x45, 0x47, 0x52, 0x4f, 0x55, 0x4e, 0x44, 0x10, 0x01, 0x12, 0x0e, 0x0a, 0x0a, 0x42, 0x41, 0x43,
+	0x4b, 0x47, 0x52, 0x4f, 0x55, 0x4e, 0x44, 0x10, 0x02, 0x12, 0x0a, 0x0a, 0x06, 0x4f, 0x52, 0x50,
+	0x48, 0x41, 0x4e, 0x10, 0x03, 0x22, 0x32, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x4f, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x75, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x37, 0x0a, 0x0f, 0x4f, 0x70, 0x65,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x24, 0x0a, 0x0d,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x41, 0x66, 0x66, 0x65, 0x63, 0x74, 0x65, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x0d, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x41, 0x66, 0x66, 0x65, 0x63, 0x74,
+	0x65, 0x64, 0x22, 0x35, 0x0a, 0x0b, 0x44, 0x75, 0x61, 0x6c, 0x53, 0x74, 0x61, 0x63, 0x6b, 0x49,
+	0x50, 0x12, 0x12, 0x0a, 0x04, 0x69, 0x70, 0x76, 0x34, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x69, 0x70, 0x76, 0x34, 0x12, 0x12, 0x0a, 0x04, 0x69, 0x70, 0x76, 0x36, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x69, 0x70, 0x76, 0x36, 0x22, 0x32, 0x0a, 0x10, 0x44, 0x75, 0x61,
+	0x6c, 0x53, 0x74, 0x61, 0x63, 0x6b, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x12, 0x0e, 0x0a,
+	0x02, 0x76, 0x34, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x76, 0x34, 0x12, 0x0e, 0x0a,
+	0x02, 0x76, 0x36, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x76, 0x36, 0x22, 0x84, 0x01,
+	0x0a, 0x10, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x4d, 0x65,
+	0x74, 0x61, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x04, 0x70, 0x61, 0x67, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x50,
+	0x65, 0x72, 0x50, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x69, 0x74,
+	0x65, 0x6d, 0x73, 0x50, 0x65, 0x72, 0x50, 0x61, 0x67, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x74, 0x6f,
+	0x74, 0x61, 0x6c, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a,
+	0x74, 0x6f, 0x74, 0x61, 0x6c, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x68, 0x61,
+	0x73, 0x4d, 0x6f, 0x72, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x68, 0x61, 0x73,
+	0x4d, 0x6f, 0x72, 0x65, 0x22, 0xe9, 0x01, 0x0a, 0x0b, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x74, 0x61,
+	0x64, 0x61, 0x74, 0x61, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x02, 0x69, 0x64, 0x12, 0x38, 0x0a, 0x09, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x52, 0x09, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x46,
+	0x0a, 0x08, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x52, 0x65, 0x66, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x2a, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e,
+	0x6d, 0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x4f, 0x62, 0x6a,
+	0x65, 0x63, 0x74, 0x52, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x52, 0x08, 0x61, 0x63,
+	0x74, 0x6f, 0x72, 0x52, 0x65, 0x66, 0x12, 0x48, 0x0a, 0x09, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74,
+	0x52, 0x65, 0x66, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x2a, 0x2e, 0x6f, 0x63, 0x74, 0x65,
+	0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x6d, 0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65,
+	0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x4f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x52, 0x65, 0x66, 0x65,
+	0x72, 0x65, 0x6e, 0x63, 0x65, 0x52, 0x09, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x66,
+	0x22, 0xa2, 0x03, 0x0a, 0x11, 0x43, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x4f,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x67, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x70, 0x61, 0x67, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x69, 0x74,
+	0x65, 0x6d, 0x73, 0x50, 0x65, 0x72, 0x50, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x0c, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x50, 0x65, 0x72, 0x50, 0x61, 0x67, 0x65, 0x12, 0x4e,
+	0x0a, 0x07, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x42, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x34, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x6d,
+	0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x6d,
+	0x6f, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x4f, 0x72,
+	0x64, 0x65, 0x72, 0x42, 0x79, 0x52, 0x07, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x42, 0x79, 0x1a, 0x84,
+	0x02, 0x0a, 0x07, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x42, 0x79, 0x12, 0x4d, 0x0a, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x39, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c,
 	0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x6d, 0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74,
-	0x61, 0x2e, 0x76, 0x31, 0x2e, 0x4f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x52, 0x65, 0x66, 0x65, 0x72,
-	0x65, 0x6e, 0x63, 0x65, 0x52, 0x08, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x52, 0x65, 0x66, 0x12, 0x48,
-	0x0a, 0x09, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x66, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x2a, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69,
-	0x2e, 0x6d, 0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x4f, 0x62,
-	0x6a, 0x65, 0x63, 0x74, 0x52, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x52, 0x09, 0x74,
-	0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x66, 0x22, 0xa2, 0x03, 0x0a, 0x11, 0x43, 0x6f, 0x6d,
-	0x6d, 0x6f, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x12,
-	0x0a, 0x04, 0x70, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x70, 0x61,
-	0x67, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x50, 0x65, 0x72, 0x50, 0x61,
-	0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x50,
-	0x65, 0x72, 0x50, 0x61, 0x67, 0x65, 0x12, 0x4e, 0x0a, 0x07, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x42,
-	0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x34, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69,
+	0x61, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x4f,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x42, 0x79, 0x2e, 0x54,
+	0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x4d, 0x0a, 0x04, 0x6d, 0x6f, 0x64,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x39, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69,
 	0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x6d, 0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61,
 	0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x70,
-	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x42, 0x79, 0x52, 0x07, 0x6f,
-	0x72, 0x64, 0x65, 0x72, 0x42, 0x79, 0x1a, 0x84, 0x02, 0x0a, 0x07, 0x4f, 0x72, 0x64, 0x65, 0x72,
-	0x42, 0x79, 0x12, 0x4d, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e,
-	0x32, 0x39, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e,
-	0x6d, 0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d,
-	0x6d, 0x6f, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x4f,
-	0x72, 0x64, 0x65, 0x72, 0x42, 0x79, 0x2e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70,
-	0x65, 0x12, 0x4d, 0x0a, 0x04, 0x6d, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32,
-	0x39, 0x2e, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x6d,
-	0x61, 0x69, 0x6e, 0x2e, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x6d,
-	0x6f, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x4f, 0x72,
-	0x64, 0x65, 0x72, 0x42, 0x79, 0x2e, 0x4d, 0x6f, 0x64, 0x65, 0x52, 0x04, 0x6d, 0x6f, 0x64, 0x65,
-	0x22, 0x30, 0x0a, 0x04, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0e, 0x0a, 0x0a, 0x54, 0x59, 0x50, 0x45,
-	0x5f, 0x55, 0x4e, 0x53, 0x45, 0x54, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x4e, 0x41, 0x4d, 0x45,
-	0x10, 0x01, 0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x52, 0x45, 0x41, 0x54, 0x45, 0x44, 0x5f, 0x41, 0x54,
-	0x10, 0x02, 0x22, 0x29, 0x0a, 0x04, 0x4d, 0x6f, 0x64, 0x65, 0x12, 0x0e, 0x0a, 0x0a, 0x4d, 0x4f,
-	0x44, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x45, 0x54, 0x10, 0x00, 0x12, 0x07, 0x0a, 0x03, 0x41, 0x53,
-	0x43, 0x10, 0x01, 0x12, 0x08, 0x0a, 0x04, 0x44, 0x45, 0x53, 0x43, 0x10, 0x02, 0x42, 0x2f, 0x5a,
-	0x2d, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6f, 0x63, 0x74, 0x65,
-	0x6c, 0x69, 0x75, 0x6d, 0x2f, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2f, 0x61, 0x70,
-	0x69, 0x73, 0x2f, 0x6d, 0x61, 0x69, 0x6e, 0x2f, 0x6d, 0x65, 0x74, 0x61, 0x76, 0x31, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x42, 0x79, 0x2e, 0x4d, 0x6f,
+	0x64, 0x65, 0x52, 0x04, 0x6d, 0x6f, 0x64, 0x65, 0x22, 0x30, 0x0a, 0x04, 0x54, 0x79, 0x70, 0x65,
+	0x12, 0x0e, 0x0a, 0x0a, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x45, 0x54, 0x10, 0x00,
+	0x12, 0x08, 0x0a, 0x04, 0x4e, 0x41, 0x4d, 0x45, 0x10, 0x01, 0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x52,
+	0x45, 0x41, 0x54, 0x45, 0x44, 0x5f, 0x41, 0x54, 0x10, 0x02, 0x22, 0x29, 0x0a, 0x04, 0x4d, 0x6f,
+	0x64, 0x65, 0x12, 0x0e, 0x0a, 0x0a, 0x4d, 0x4f, 0x44, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x45, 0x54,
+	0x10, 0x00, 0x12, 0x07, 0x0a, 0x03, 0x41, 0x53, 0x43, 0x10, 0x01, 0x12, 0x08, 0x0a, 0x04, 0x44,
+	0x45, 0x53, 0x43, 0x10, 0x02, 0x42, 0x2f, 0x5a, 0x2d, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x6f, 0x63, 0x74, 0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2f, 0x6f, 0x63, 0x74,
+	0x65, 0x6c, 0x69, 0x75, 0x6d, 0x2f, 0x61, 0x70, 0x69, 0x73, 0x2f, 0x6d, 0x61, 0x69, 0x6e, 0x2f,
+	0x6d, 0x65, 0x74, 0x61, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -1307,48 +1485,53 @@ func file_metav1_proto_rawDescGZIP() []byte {
 	return file_metav1_proto_rawDescData
 }
 
-var file_metav1_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_metav1_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_metav1_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_metav1_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
 var file_metav1_proto_goTypes = []any{
-	(CommonListOptions_OrderBy_Type)(0), // 0: octelium.api.main.meta.v1.CommonListOptions.OrderBy.Type
-	(CommonListOptions_OrderBy_Mode)(0), // 1: octelium.api.main.meta.v1.CommonListOptions.OrderBy.Mode
-	(*Metadata)(nil),                    // 2: octelium.api.main.meta.v1.Metadata
-	(*ObjectReference)(nil),             // 3: octelium.api.main.meta.v1.ObjectReference
-	(*Duration)(nil),                    // 4: octelium.api.main.meta.v1.Duration
-	(*DeleteOptions)(nil),               // 5: octelium.api.main.meta.v1.DeleteOptions
-	(*GetOptions)(nil),                  // 6: octelium.api.main.meta.v1.GetOptions
-	(*OperationResult)(nil),             // 7: octelium.api.main.meta.v1.OperationResult
-	(*DualStackIP)(nil),                 // 8: octelium.api.main.meta.v1.DualStackIP
-	(*DualStackNetwork)(nil),            // 9: octelium.api.main.meta.v1.DualStackNetwork
-	(*ListResponseMeta)(nil),            // 10: octelium.api.main.meta.v1.ListResponseMeta
-	(*LogMetadata)(nil),                 // 11: octelium.api.main.meta.v1.LogMetadata
-	(*CommonListOptions)(nil),           // 12: octelium.api.main.meta.v1.CommonListOptions
-	nil,                                 // 13: octelium.api.main.meta.v1.Metadata.LabelsEntry
-	nil,                                 // 14: octelium.api.main.meta.v1.Metadata.AnnotationsEntry
-	nil,                                 // 15: octelium.api.main.meta.v1.Metadata.SpecLabelsEntry
-	nil,                                 // 16: octelium.api.main.meta.v1.Metadata.SystemLabelsEntry
-	(*CommonListOptions_OrderBy)(nil),   // 17: octelium.api.main.meta.v1.CommonListOptions.OrderBy
-	(*timestamppb.Timestamp)(nil),       // 18: google.protobuf.Timestamp
+	(DeleteOptions_Cascade)(0),          // 0: octelium.api.main.meta.v1.DeleteOptions.Cascade
+	(CommonListOptions_OrderBy_Type)(0), // 1: octelium.api.main.meta.v1.CommonListOptions.OrderBy.Type
+	(CommonListOptions_OrderBy_Mode)(0), // 2: octelium.api.main.meta.v1.CommonListOptions.OrderBy.Mode
+	(*Metadata)(nil),                    // 3: octelium.api.main.meta.v1.Metadata
+	(*ManagedField)(nil),                // 4: octelium.api.main.meta.v1.ManagedField
+	(*ObjectReference)(nil),             // 5: octelium.api.main.meta.v1.ObjectReference
+	(*Duration)(nil),                    // 6: octelium.api.main.meta.v1.Duration
+	(*DeleteOptions)(nil),               // 7: octelium.api.main.meta.v1.DeleteOptions
+	(*GetOptions)(nil),                  // 8: octelium.api.main.meta.v1.GetOptions
+	(*OperationResult)(nil),             // 9: octelium.api.main.meta.v1.OperationResult
+	(*DualStackIP)(nil),                 // 10: octelium.api.main.meta.v1.DualStackIP
+	(*DualStackNetwork)(nil),            // 11: octelium.api.main.meta.v1.DualStackNetwork
+	(*ListResponseMeta)(nil),            // 12: octelium.api.main.meta.v1.ListResponseMeta
+	(*LogMetadata)(nil),                 // 13: octelium.api.main.meta.v1.LogMetadata
+	(*CommonListOptions)(nil),           // 14: octelium.api.main.meta.v1.CommonListOptions
+	nil,                                 // 15: octelium.api.main.meta.v1.Metadata.LabelsEntry
+	nil,                                 // 16: octelium.api.main.meta.v1.Metadata.AnnotationsEntry
+	nil,                                 // 17: octelium.api.main.meta.v1.Metadata.SpecLabelsEntry
+	nil,                                 // 18: octelium.api.main.meta.v1.Metadata.SystemLabelsEntry
+	(*CommonListOptions_OrderBy)(nil),   // 19: octelium.api.main.meta.v1.CommonListOptions.OrderBy
+	(*timestamppb.Timestamp)(nil),       // 20: google.protobuf.Timestamp
 }
 var file_metav1_proto_depIdxs = []int32{
-	18, // 0: octelium.api.main.meta.v1.Metadata.createdAt:type_name -> google.protobuf.Timestamp
-	18, // 1: octelium.api.main.meta.v1.Metadata.updatedAt:type_name -> google.protobuf.Timestamp
-	13, // 2: octelium.api.main.meta.v1.Metadata.labels:type_name -> octelium.api.main.meta.v1.Metadata.LabelsEntry
-	14, // 3: octelium.api.main.meta.v1.Metadata.annotations:type_name -> octelium.api.main.meta.v1.Metadata.AnnotationsEntry
-	3,  // 4: octelium.api.main.meta.v1.Metadata.actorRef:type_name -> octelium.api.main.meta.v1.ObjectReference
-	15, // 5: octelium.api.main.meta.v1.Metadata.specLabels:type_name -> octelium.api.main.meta.v1.Metadata.SpecLabelsEntry
-	16, // 6: octelium.api.main.meta.v1.Metadata.systemLabels:type_name -> octelium.api.main.meta.v1.Metadata.SystemLabelsEntry
-	18, // 7: octelium.api.main.meta.v1.LogMetadata.createdAt:type_name -> google.protobuf.Timestamp
-	3,  // 8: octelium.api.main.meta.v1.LogMetadata.actorRef:type_name -> octelium.api.main.meta.v1.ObjectReference
-	3,  // 9: octelium.api.main.meta.v1.LogMetadata.targetRef:type_name -> octelium.api.main.meta.v1.ObjectReference
-	17, // 10: octelium.api.main.meta.v1.CommonListOptions.orderBy:type_name -> octelium.api.main.meta.v1.CommonListOptions.OrderBy
-	0,  // 11: octelium.api.main.meta.v1.CommonListOptions.OrderBy.type:type_name -> octelium.api.main.meta.v1.CommonListOptions.OrderBy.Type
-	1,  // 12: octelium.api.main.meta.v1.CommonListOptions.OrderBy.mode:type_name -> octelium.api.main.meta.v1.CommonListOptions.OrderBy.Mode
-	13, // [13:13] is the sub-list for method output_type
-	13, // [13:13] is the sub-list for method input_type
-	13, // [13:13] is the sub-list for extension type_name
-	13, // [13:13] is the sub-list for extension extendee
-	0,  // [0:13] is the sub-list for field type_name
+	20, // 0: octelium.api.main.meta.v1.Metadata.createdAt:type_name -> google.protobuf.Timestamp
+	20, // 1: octelium.api.main.meta.v1.Metadata.updatedAt:type_name -> google.protobuf.Timestamp
+	15, // 2: octelium.api.main.meta.v1.Metadata.labels:type_name -> octelium.api.main.meta.v1.Metadata.LabelsEntry
+	16, // 3: octelium.api.main.meta.v1.Metadata.annotations:type_name -> octelium.api.main.meta.v1.Metadata.AnnotationsEntry
+	5,  // 4: octelium.api.main.meta.v1.Metadata.actorRef:type_name -> octelium.api.main.meta.v1.ObjectReference
+	17, // 5: octelium.api.main.meta.v1.Metadata.specLabels:type_name -> octelium.api.main.meta.v1.Metadata.SpecLabelsEntry
+	18, // 6: octelium.api.main.meta.v1.Metadata.systemLabels:type_name -> octelium.api.main.meta.v1.Metadata.SystemLabelsEntry
+	4,  // 7: octelium.api.main.meta.v1.Metadata.managedFields:type_name -> octelium.api.main.meta.v1.ManagedField
+	20, // 8: octelium.api.main.meta.v1.ManagedField.updatedAt:type_name -> google.protobuf.Timestamp
+	0,  // 9: octelium.api.main.meta.v1.DeleteOptions.cascade:type_name -> octelium.api.main.meta.v1.DeleteOptions.Cascade
+	20, // 10: octelium.api.main.meta.v1.LogMetadata.createdAt:type_name -> google.protobuf.Timestamp
+	5,  // 11: octelium.api.main.meta.v1.LogMetadata.actorRef:type_name -> octelium.api.main.meta.v1.ObjectReference
+	5,  // 12: octelium.api.main.meta.v1.LogMetadata.targetRef:type_name -> octelium.api.main.meta.v1.ObjectReference
+	19, // 13: octelium.api.main.meta.v1.CommonListOptions.orderBy:type_name -> octelium.api.main.meta.v1.CommonListOptions.OrderBy
+	1,  // 14: octelium.api.main.meta.v1.CommonListOptions.OrderBy.type:type_name -> octelium.api.main.meta.v1.CommonListOptions.OrderBy.Type
+	2,  // 15: octelium.api.main.meta.v1.CommonListOptions.OrderBy.mode:type_name -> octelium.api.main.meta.v1.CommonListOptions.OrderBy.Mode
+	16, // [16:16] is the sub-list for method output_type
+	16, // [16:16] is the sub-list for method input_type
+	16, // [16:16] is the sub-list for extension type_name
+	16, // [16:16] is the sub-list for extension extendee
+	0,  // [0:16] is the sub-list for field type_name
 }
 
 func init() { file_metav1_proto_init() }
@@ -1356,7 +1539,7 @@ func file_metav1_proto_init() {
 	if File_metav1_proto != nil {
 		return
 	}
-	file_metav1_proto_msgTypes[2].OneofWrappers = []any{
+	file_metav1_proto_msgTypes[3].OneofWrappers = []any{
 		(*Duration_Milliseconds)(nil),
 		(*Duration_Seconds)(nil),
 		(*Duration_Minutes)(nil),
@@ -1370,8 +1553,8 @@ func file_metav1_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_metav1_proto_rawDesc,
-			NumEnums:      2,
-			NumMessages:   16,
+			NumEnums:      3,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -132,6 +132,65 @@ func GetAccessToken(ctx context.Context, domain string) (string, error) {
 	return authC.doGetAccessToken(ctx)
 }
 
+// IsSessionAuthenticated reports whether the CLI authenticates via the
+// Session tokens that it stores and therefore can refresh or reauthenticate.
+func IsSessionAuthenticated() bool {
+	return !isAuthProxyMode() && !isStaticAccessToken()
+}
+
+// CanReauthenticateInteractively reports whether the web authentication flow
+// can be started without being explicitly chosen by the user.
+func CanReauthenticateInteractively() bool {
+	return IsSessionAuthenticated() && !cliutils.IsNonInteractive() && !isWorkloadHost()
+}
+
+// RefreshSession obtains a new access token using the stored refresh token.
+// It returns false if there is no valid refresh token or if the Cluster no
+// longer accepts it.
+func RefreshSession(ctx context.Context, domain string) (bool, error) {
+	if !IsSessionAuthenticated() {
+		return false, nil
+	}
+
+	authC, err := newAuthenticator(ctx, &AuthenticateOpts{
+		Domain: domain,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if !authC.isRefresh {
+		return false, nil
+	}
+
+	sessTkn, err := authC.c.C().AuthenticateWithRefreshToken(ctx, &authv1.AuthenticateWithRefreshTokenRequest{})
+	if err != nil {
+		if grpcerr.IsUnauthenticated(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := cliutils.GetDB().SetSessionToken(domain, sessTkn); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Reauthenticate discards the stored Session tokens and starts the web
+// authentication flow.
+func Reauthenticate(ctx context.Context, domain string) error {
+	if err := cliutils.GetDB().Delete(domain); err != nil && !cliutils.GetDB().ErrorIsNotFound(err) {
+		return err
+	}
+
+	return Authenticate(ctx, &AuthenticateOpts{
+		Domain: domain,
+		IsWeb:  true,
+	})
+}
+
 type authenticator struct {
 	domain    string
 	skipStore bool
@@ -226,7 +285,9 @@ func (a *authenticator) doGetAccessToken(ctx context.Context) (string, error) {
 			return a.at.SessionToken.AccessToken, nil
 		}
 
-		if resp, err := a.c.C().GetAvailableAuthenticator(ctx,
+		if cliutils.IsNonInteractive() {
+			zap.L().Debug("Non-interactive mode. Skipping the main Authenticator")
+		} else if resp, err := a.c.C().GetAvailableAuthenticator(ctx,
 			&authv1.GetAvailableAuthenticatorRequest{}); err == nil {
 			if resp.MainAuthenticator != nil {
 				if err := authn.DoAuthenticate(ctx,
@@ -306,9 +367,15 @@ func (a *authenticator) doGetAccessToken(ctx context.Context) (string, error) {
 
 			return sessTkn.AccessToken, nil
 		default:
-			if !isWorkloadHost() {
+			switch {
+			case cliutils.IsNonInteractive():
+				return "",
+					errors.Errorf(
+						`
+No credentials were found while running in non-interactive mode. Set an access token via the OCTELIUM_ACCESS_TOKEN environment variable or the --access-token-file flag, or an authentication token via the OCTELIUM_AUTH_TOKEN environment variable or the --auth-token-file flag`)
+			case !isWorkloadHost():
 				return a.doWebAuthentication(ctx)
-			} else {
+			default:
 				return "",
 					errors.Errorf(
 						`
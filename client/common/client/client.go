@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/octelium/octelium/apis/main/authv1"
@@ -37,6 +38,7 @@ import (
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 )
 
 func GetDefaultKubeConfig() (string, error) {
@@ -100,6 +102,8 @@ func doGetGRPCClientConn(domain string, s *authv1.SessionToken) (*grpc.ClientCon
 			grpc_retry.WithCodes(retryCodes...)),
 	}
 
+	unaryMiddlewares = append(unaryMiddlewares, msgSizeUnaryClientInterceptor())
+
 	streamMiddlewares := []grpc.StreamClientInterceptor{}
 
 	unaryMiddlewares = append(unaryMiddlewares,
@@ -121,6 +125,14 @@ func doGetGRPCClientConn(domain string, s *authv1.SessionToken) (*grpc.ClientCon
 		grpc.WithUserAgent(fmt.Sprintf("octelium-cli/%s", ldflags.SemVer)),
 	}
 
+	maxRecvMsgSize, err := cliutils.GetGRPCMaxRecvMsgSize()
+	if err != nil {
+		return nil, err
+	}
+	if maxRecvMsgSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxRecvMsgSize)))
+	}
+
 	isAuthProxy := os.Getenv("OCTELIUM_AUTH_PROXY_SOCKET") != ""
 
 	var target string
@@ -141,6 +153,24 @@ func doGetGRPCClientConn(domain string, s *authv1.SessionToken) (*grpc.ClientCon
 	return grpc.Dial(target, opts...)
 }
 
+// msgSizeUnaryClientInterceptor explains how to get around the messages that
+// are too large to be received. The error code is also changed so that such
+// errors are not retried as they would just fail again.
+func msgSizeUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any,
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if st, ok := status.FromError(err); ok && st.Code() == codes.ResourceExhausted &&
+			strings.Contains(st.Message(), "received message larger than max") {
+			return status.Errorf(codes.OutOfRange,
+				"%s. Use the --grpc-max-recv-msg-size flag to increase the max size or --items-per-page to list fewer items",
+				st.Message())
+		}
+
+		return err
+	}
+}
+
 func GetGRPCClientConn(ctx context.Context, clusterDomain string) (*grpc.ClientConn, error) {
 
 	i, err := getClientInfo(clusterDomain)
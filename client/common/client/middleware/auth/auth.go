@@ -27,19 +27,32 @@ func UnaryClientInterceptor(domain string, opts ...grpc.CallOption) grpc.UnaryCl
 
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 
-		token, err := getToken(ctx, domain)
-		if err != nil {
+		doInvoke := func() error {
+			token, err := getToken(ctx, domain)
+			if err != nil {
+				return err
+			}
+
+			ctx := metadata.AppendToOutgoingContext(ctx, "x-octelium-auth", token)
+			// ctx = metadata.AppendToOutgoingContext(ctx, "user-agent", fmt.Sprintf("octelium-cli/%s", ldflags.GetVersion()))
+
+			err = invoker(ctx, method, req, reply, cc, opts...)
+			if err != nil {
+				zap.S().Debugf("invoker error: %+v", err)
+			}
 			return err
 		}
 
-		ctx = metadata.AppendToOutgoingContext(ctx, "x-octelium-auth", token)
-		// ctx = metadata.AppendToOutgoingContext(ctx, "user-agent", fmt.Sprintf("octelium-cli/%s", ldflags.GetVersion()))
+		err := doInvoke()
+		if err == nil {
+			return nil
+		}
 
-		err = invoker(ctx, method, req, reply, cc, opts...)
-		if err != nil {
-			zap.S().Debugf("invoker error: %+v", err)
+		if retry, err := defaultReauthenticator.handle(ctx, domain, err); !retry {
+			return err
 		}
-		return err
+
+		return doInvoke()
 	}
 }
 
@@ -47,16 +60,28 @@ func StreamClientInterceptor(domain string, opts ...grpc.CallOption) grpc.Stream
 
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
 
-		token, err := getToken(ctx, domain)
-		if err != nil {
-			return nil, err
+		doStream := func() (grpc.ClientStream, error) {
+			token, err := getToken(ctx, domain)
+			if err != nil {
+				return nil, err
+			}
+
+			ctx := metadata.AppendToOutgoingContext(ctx, "x-octelium-auth", token)
+			// ctx = metadata.AppendToOutgoingContext(ctx, "user-agent", fmt.Sprintf("octelium-cli/%s", ldflags.GetVersion()))
+
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		clientStream, err := doStream()
+		if err == nil {
+			return clientStream, nil
 		}
 
-		ctx = metadata.AppendToOutgoingContext(ctx, "x-octelium-auth", token)
-		// ctx = metadata.AppendToOutgoingContext(ctx, "user-agent", fmt.Sprintf("octelium-cli/%s", ldflags.GetVersion()))
+		if retry, err := defaultReauthenticator.handle(ctx, domain, err); !retry {
+			return nil, err
+		}
 
-		clientStream, err := streamer(ctx, desc, cc, method, opts...)
-		return clientStream, err
+		return doStream()
 	}
 }
 
@@ -0,0 +1,110 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/octelium/octelium/client/common/authenticator"
+	"github.com/octelium/octelium/client/common/cliutils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type reauthenticator struct {
+	mu        sync.Mutex
+	attempted bool
+
+	refreshFn      func(ctx context.Context, domain string) (bool, error)
+	canPromptFn    func() bool
+	promptFn       func(domain string) error
+	reauthFn       func(ctx context.Context, domain string) error
+	isSessionAuthn func() bool
+}
+
+var defaultReauthenticator = &reauthenticator{
+	refreshFn: authenticator.RefreshSession,
+	canPromptFn: func() bool {
+		return cliutils.IsReauthPromptEnabled() && authenticator.CanReauthenticateInteractively()
+	},
+	promptFn: func(domain string) error {
+		return cliutils.RunPromptConfirm(
+			fmt.Sprintf("Your Session at %s is no longer valid. Do you want to log in again", domain))
+	},
+	reauthFn:       authenticator.Reauthenticate,
+	isSessionAuthn: authenticator.IsSessionAuthenticated,
+}
+
+// handle is called once an RPC fails. It returns true if the Session has been
+// renewed and the RPC should be retried. The renewal is only attempted once
+// per process so that a Cluster that keeps rejecting the Session never ends up
+// prompting the user in a loop.
+func (r *reauthenticator) handle(ctx context.Context, domain string, err error) (bool, error) {
+	if status.Code(err) != codes.Unauthenticated || !r.isSessionAuthn() {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.attempted {
+		return false, withLoginHint(err, domain)
+	}
+	r.attempted = true
+
+	if refreshed, rErr := r.refreshFn(ctx, domain); rErr != nil {
+		zap.L().Debug("Could not refresh the Session", zap.Error(rErr))
+	} else if refreshed {
+		zap.L().Debug("Session refreshed after an Unauthenticated error. Retrying")
+		return true, nil
+	}
+
+	if !r.canPromptFn() {
+		return false, withLoginHint(err, domain)
+	}
+
+	if pErr := r.promptFn(domain); pErr != nil {
+		return false, withLoginHint(err, domain)
+	}
+
+	if aErr := r.reauthFn(ctx, domain); aErr != nil {
+		zap.L().Debug("Could not reauthenticate", zap.Error(aErr))
+		return false, withLoginHint(err, domain)
+	}
+
+	return true, nil
+}
+
+func withLoginHint(err error, domain string) error {
+	st := status.Convert(err)
+	return status.Errorf(codes.Unauthenticated,
+		"%s. Your Session is no longer valid. Run `%s login --domain %s` to log in again",
+		st.Message(), getCLIName(), domain)
+}
+
+func getCLIName() string {
+	if len(os.Args) > 0 {
+		if ret := filepath.Base(os.Args[0]); ret == "octeliumctl" || ret == "octelium" {
+			return ret
+		}
+	}
+
+	return "octelium"
+}
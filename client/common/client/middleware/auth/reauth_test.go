@@ -0,0 +1,125 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type tstReauthCounts struct {
+	refresh int
+	prompt  int
+	reauth  int
+}
+
+func newTstReauthenticator(refreshed, canPrompt, accept bool) (*reauthenticator, *tstReauthCounts) {
+	counts := &tstReauthCounts{}
+	return &reauthenticator{
+		refreshFn: func(ctx context.Context, domain string) (bool, error) {
+			counts.refresh++
+			return refreshed, nil
+		},
+		canPromptFn: func() bool {
+			return canPrompt
+		},
+		promptFn: func(domain string) error {
+			counts.prompt++
+			if !accept {
+				return errors.New("declined")
+			}
+			return nil
+		},
+		reauthFn: func(ctx context.Context, domain string) error {
+			counts.reauth++
+			return nil
+		},
+		isSessionAuthn: func() bool {
+			return true
+		},
+	}, counts
+}
+
+func TestReauthenticator(t *testing.T) {
+	ctx := context.Background()
+	unauthErr := status.Error(codes.Unauthenticated, "invalid token")
+
+	{
+		r, counts := newTstReauthenticator(false, true, true)
+		permErr := status.Error(codes.PermissionDenied, "denied")
+		retry, err := r.handle(ctx, "example.com", permErr)
+		assert.False(t, retry)
+		assert.Equal(t, permErr, err)
+		assert.Equal(t, 0, counts.refresh)
+	}
+
+	{
+		r, counts := newTstReauthenticator(true, true, true)
+		retry, err := r.handle(ctx, "example.com", unauthErr)
+		assert.True(t, retry)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, counts.refresh)
+		assert.Equal(t, 0, counts.prompt)
+
+		retry, err = r.handle(ctx, "example.com", unauthErr)
+		assert.False(t, retry)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, 1, counts.refresh)
+	}
+
+	{
+		r, counts := newTstReauthenticator(false, true, true)
+		retry, err := r.handle(ctx, "example.com", unauthErr)
+		assert.True(t, retry)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, counts.prompt)
+		assert.Equal(t, 1, counts.reauth)
+	}
+
+	{
+		r, counts := newTstReauthenticator(false, true, false)
+		retry, err := r.handle(ctx, "example.com", unauthErr)
+		assert.False(t, retry)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, 1, counts.prompt)
+		assert.Equal(t, 0, counts.reauth)
+	}
+
+	{
+		r, counts := newTstReauthenticator(false, false, true)
+		retry, err := r.handle(ctx, "example.com", unauthErr)
+		assert.False(t, retry)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Contains(t, err.Error(), "invalid token")
+		assert.Contains(t, err.Error(), "login --domain example.com")
+		assert.Equal(t, 0, counts.prompt)
+	}
+
+	{
+		r, counts := newTstReauthenticator(true, true, true)
+		r.isSessionAuthn = func() bool {
+			return false
+		}
+		retry, err := r.handle(ctx, "example.com", unauthErr)
+		assert.False(t, retry)
+		assert.Equal(t, unauthErr, err)
+		assert.Equal(t, 0, counts.refresh)
+	}
+}
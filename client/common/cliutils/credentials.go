@@ -0,0 +1,113 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type tokenSource struct {
+	flag    string
+	env     string
+	fileEnv string
+}
+
+// The tokens can be set non-interactively, e.g. in CI pipelines, where each
+// token is resolved in the following order of precedence: the file set by
+// the flag, the value of the environment variable and then the file set by
+// the environment variable suffixed with _FILE. The resolved token is then
+// set to the environment variable that is used by the authenticator.
+var tokenSources = []tokenSource{
+	{
+		flag:    "access-token-file",
+		env:     "OCTELIUM_ACCESS_TOKEN",
+		fileEnv: "OCTELIUM_ACCESS_TOKEN_FILE",
+	},
+	{
+		flag:    "auth-token-file",
+		env:     "OCTELIUM_AUTH_TOKEN",
+		fileEnv: "OCTELIUM_AUTH_TOKEN_FILE",
+	},
+}
+
+func setTokensFromFiles(cmd *cobra.Command) error {
+	for _, src := range tokenSources {
+		fPath := getFlagStr(cmd, src.flag)
+		if fPath == "" {
+			if os.Getenv(src.env) != "" {
+				continue
+			}
+			fPath = os.Getenv(src.fileEnv)
+		}
+		if fPath == "" {
+			continue
+		}
+
+		tkn, err := readTokenFile(fPath)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Setenv(src.env, tkn); err != nil {
+			return err
+		}
+	}
+
+	if getFlagBoolean(cmd, "non-interactive") {
+		if err := os.Setenv("OCTELIUM_NON_INTERACTIVE", "true"); err != nil {
+			return err
+		}
+	}
+
+	if getFlagBoolean(cmd, "no-reauth-prompt") {
+		if err := os.Setenv("OCTELIUM_NO_REAUTH_PROMPT", "true"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readTokenFile(fPath string) (string, error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return "", errors.Errorf("Could not read the token file %s: %s", fPath, err)
+	}
+
+	ret := strings.TrimSpace(string(content))
+	if ret == "" {
+		return "", errors.Errorf("The token file %s is empty", fPath)
+	}
+
+	return ret, nil
+}
+
+// IsNonInteractive reports whether the CLI must not start any interactive
+// flow such as opening the browser to authenticate via the web Portal.
+func IsNonInteractive() bool {
+	return os.Getenv("OCTELIUM_NON_INTERACTIVE") == "true"
+}
+
+// IsReauthPromptEnabled reports whether the user can be prompted to log in
+// again once the Cluster no longer accepts the current Session.
+func IsReauthPromptEnabled() bool {
+	return !IsNonInteractive() && os.Getenv("OCTELIUM_NO_REAUTH_PROMPT") != "true" &&
+		isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+}
@@ -0,0 +1,82 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTokensFromFiles(t *testing.T) {
+	writeFile := func(content string) string {
+		fPath := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(fPath, []byte(content), 0600))
+		return fPath
+	}
+
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("access-token-file", "", "")
+		cmd.Flags().String("auth-token-file", "", "")
+		cmd.Flags().Bool("non-interactive", false, "")
+		require.NoError(t, cmd.Flags().Parse(args))
+		return cmd
+	}
+
+	t.Run("flag", func(t *testing.T) {
+		t.Setenv("OCTELIUM_ACCESS_TOKEN", "from-env")
+		t.Setenv("OCTELIUM_ACCESS_TOKEN_FILE", writeFile("from-env-file"))
+		t.Setenv("OCTELIUM_NON_INTERACTIVE", "")
+
+		require.NoError(t, setTokensFromFiles(
+			newCmd("--access-token-file", writeFile("from-flag\n"), "--non-interactive")))
+		assert.Equal(t, "from-flag", os.Getenv("OCTELIUM_ACCESS_TOKEN"))
+		assert.True(t, IsNonInteractive())
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("OCTELIUM_AUTH_TOKEN", "from-env")
+		t.Setenv("OCTELIUM_AUTH_TOKEN_FILE", writeFile("from-env-file"))
+
+		require.NoError(t, setTokensFromFiles(newCmd()))
+		assert.Equal(t, "from-env", os.Getenv("OCTELIUM_AUTH_TOKEN"))
+	})
+
+	t.Run("env-file", func(t *testing.T) {
+		t.Setenv("OCTELIUM_AUTH_TOKEN", "")
+		t.Setenv("OCTELIUM_AUTH_TOKEN_FILE", writeFile("  from-env-file\n"))
+
+		require.NoError(t, setTokensFromFiles(newCmd()))
+		assert.Equal(t, "from-env-file", os.Getenv("OCTELIUM_AUTH_TOKEN"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("OCTELIUM_ACCESS_TOKEN", "")
+		t.Setenv("OCTELIUM_AUTH_TOKEN", "")
+
+		t.Setenv("OCTELIUM_ACCESS_TOKEN_FILE", writeFile("\n"))
+		err := setTokensFromFiles(newCmd())
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "from")
+
+		t.Setenv("OCTELIUM_ACCESS_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+		assert.Error(t, setTokensFromFiles(newCmd()))
+	})
+}
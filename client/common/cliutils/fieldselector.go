@@ -0,0 +1,185 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var rgxFieldSelectorKey = regexp.MustCompile(`^[a-zA-Z0-9_]+(\.[a-zA-Z0-9_]+)*$`)
+
+type fieldRequirement struct {
+	path   []string
+	value  string
+	negate bool
+}
+
+// parseFieldSelector parses a kubectl-like field selector, which is a
+// comma-separated list of requirements in the form of "key=value",
+// "key==value" or "key!=value" and whose keys are the dot-separated JSON
+// field names of the resources such as "metadata.name" or "spec.type".
+func parseFieldSelector(arg string) ([]*fieldRequirement, error) {
+	var ret []*fieldRequirement
+
+	for _, itm := range strings.Split(arg, ",") {
+		itm = strings.TrimSpace(itm)
+		if itm == "" {
+			continue
+		}
+
+		req := &fieldRequirement{}
+		var key string
+
+		switch {
+		case strings.Contains(itm, "!="):
+			key, req.value, _ = strings.Cut(itm, "!=")
+			req.negate = true
+		case strings.Contains(itm, "=="):
+			key, req.value, _ = strings.Cut(itm, "==")
+		case strings.Contains(itm, "="):
+			key, req.value, _ = strings.Cut(itm, "=")
+		default:
+			return nil, errors.Errorf("invalid field selector %q: missing operator", itm)
+		}
+
+		key = strings.TrimSpace(key)
+		req.value = strings.TrimSpace(req.value)
+		if !rgxFieldSelectorKey.MatchString(key) {
+			return nil, errors.Errorf("invalid field selector %q: invalid key %q", itm, key)
+		}
+
+		req.path = strings.Split(key, ".")
+		ret = append(ret, req)
+	}
+
+	if len(ret) == 0 {
+		return nil, errors.Errorf("invalid field selector %q: no requirements", arg)
+	}
+
+	return ret, nil
+}
+
+func (r *fieldRequirement) matches(m map[string]any) bool {
+	var val any = m
+	for _, key := range r.path {
+		cur, ok := val.(map[string]any)
+		if !ok {
+			val = nil
+			break
+		}
+		val = cur[key]
+	}
+
+	var valStr string
+	switch v := val.(type) {
+	case string:
+		valStr = v
+	case bool:
+		valStr = strconv.FormatBool(v)
+	case float64:
+		valStr = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return (valStr == r.value) != r.negate
+}
+
+type FieldSelector struct {
+	reqs []*fieldRequirement
+}
+
+func ParseFieldSelector(arg string) (*FieldSelector, error) {
+	reqs, err := parseFieldSelector(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FieldSelector{
+		reqs: reqs,
+	}, nil
+}
+
+func (s *FieldSelector) Matches(msg proto.Message) (bool, error) {
+	m, err := pbutils.ConvertToMap(msg)
+	if err != nil {
+		return false, err
+	}
+
+	return matchesFieldRequirements(m, s.reqs), nil
+}
+
+// FilterList removes the items of the list that do not match the
+// "field-selector" flag, if set. The filtering is done by the client after the
+// list is fetched and therefore only applies to the current page.
+func FilterList(cmd *cobra.Command, list proto.Message) error {
+	selector := getFlagStr(cmd, "field-selector")
+	if selector == "" {
+		return nil
+	}
+
+	reqs, err := parseFieldSelector(selector)
+	if err != nil {
+		return err
+	}
+
+	return filterList(list, reqs)
+}
+
+func filterList(list proto.Message, reqs []*fieldRequirement) error {
+	msg := list.ProtoReflect()
+	fd := msg.Descriptor().Fields().ByName("items")
+	if fd == nil || !fd.IsList() || fd.Message() == nil {
+		return errors.Errorf("Field selectors are not supported by %s", msg.Descriptor().Name())
+	}
+
+	items := msg.Mutable(fd).List()
+
+	var matched []protoreflect.Value
+	for i := 0; i < items.Len(); i++ {
+		itm := items.Get(i)
+		m, err := pbutils.ConvertToMap(itm.Message().Interface())
+		if err != nil {
+			return err
+		}
+
+		if matchesFieldRequirements(m, reqs) {
+			matched = append(matched, itm)
+		}
+	}
+
+	items.Truncate(0)
+	for _, itm := range matched {
+		items.Append(itm)
+	}
+
+	return nil
+}
+
+func matchesFieldRequirements(m map[string]any, reqs []*fieldRequirement) bool {
+	for _, req := range reqs {
+		if !req.matches(m) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,86 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func setGRPCOpts(cmd *cobra.Command) error {
+	if arg := getFlagStr(cmd, "grpc-max-recv-msg-size"); arg != "" {
+		if err := os.Setenv("OCTELIUM_GRPC_MAX_RECV_MSG_SIZE", arg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetGRPCMaxRecvMsgSize returns the max size of the messages received by the
+// gRPC client as set by the --grpc-max-recv-msg-size flag or the
+// OCTELIUM_GRPC_MAX_RECV_MSG_SIZE environment variable. Zero means that the
+// gRPC default of 4MiB is used.
+func GetGRPCMaxRecvMsgSize() (int, error) {
+	arg := os.Getenv("OCTELIUM_GRPC_MAX_RECV_MSG_SIZE")
+	if arg == "" {
+		return 0, nil
+	}
+
+	ret, err := parseByteSize(arg)
+	if err != nil {
+		return 0, errors.Errorf("Invalid gRPC max receive message size %s: %s", arg, err)
+	}
+
+	return ret, nil
+}
+
+func parseByteSize(arg string) (int, error) {
+	arg = strings.TrimSpace(arg)
+
+	multiplier := uint64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier uint64
+	}{
+		{"GiB", 1 << 30},
+		{"MiB", 1 << 20},
+		{"KiB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(arg, unit.suffix) {
+			arg = strings.TrimSuffix(arg, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	val, err := strconv.ParseUint(strings.TrimSpace(arg), 10, 32)
+	if err != nil {
+		return 0, errors.Errorf("the size must be a number of bytes with an optional KiB, MiB or GiB unit")
+	}
+
+	ret := val * multiplier
+	if ret < 1<<20 || ret > math.MaxInt32 {
+		return 0, errors.Errorf("the size must be between 1MiB and 2GiB")
+	}
+
+	return int(ret), nil
+}
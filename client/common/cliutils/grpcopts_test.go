@@ -0,0 +1,48 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetGRPCMaxRecvMsgSize(t *testing.T) {
+	t.Setenv("OCTELIUM_GRPC_MAX_RECV_MSG_SIZE", "")
+	res, err := GetGRPCMaxRecvMsgSize()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res)
+
+	valid := map[string]int{
+		"1048576": 1 << 20,
+		"16MiB":   16 << 20,
+		"4096KiB": 4 << 20,
+		"1GiB":    1 << 30,
+		" 32 MiB": 32 << 20,
+	}
+	for arg, size := range valid {
+		t.Setenv("OCTELIUM_GRPC_MAX_RECV_MSG_SIZE", arg)
+		res, err := GetGRPCMaxRecvMsgSize()
+		assert.Nil(t, err, arg)
+		assert.Equal(t, size, res, arg)
+	}
+
+	for _, arg := range []string{"abc", "16MB", "-1", "1024", "2GiB", "99999999GiB"} {
+		t.Setenv("OCTELIUM_GRPC_MAX_RECV_MSG_SIZE", arg)
+		_, err := GetGRPCMaxRecvMsgSize()
+		assert.NotNil(t, err, arg)
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// jsonPath is a kubectl-like JSONPath template. Besides the plain text, it
+// supports the following expressions between braces: paths such as
+// {.metadata.name}, {.items[*].metadata.name}, {.items[0]} and
+// {.spec['type']}, the quoted literals such as {"\n"} and the
+// {range <path>}...{end} blocks whose paths are relative to the current item.
+type jsonPath struct {
+	nodes []jpNode
+}
+
+type jpNode interface{}
+
+type jpText string
+
+type jpRange struct {
+	path  jpPath
+	nodes []jpNode
+}
+
+type jpPath []jpStep
+
+type jpStepType int
+
+const (
+	jpStepField jpStepType = iota
+	jpStepWildcard
+	jpStepIndex
+)
+
+type jpStep struct {
+	typ   jpStepType
+	name  string
+	index int
+}
+
+func parseJSONPath(tmpl string) (*jsonPath, error) {
+	root := &jpRange{}
+	stack := []*jpRange{root}
+
+	appendNode := func(n jpNode) {
+		cur := stack[len(stack)-1]
+		cur.nodes = append(cur.nodes, n)
+	}
+
+	for len(tmpl) > 0 {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			appendNode(jpText(tmpl))
+			break
+		}
+		if start > 0 {
+			appendNode(jpText(tmpl[:start]))
+		}
+
+		end, err := getExprEnd(tmpl, start)
+		if err != nil {
+			return nil, err
+		}
+
+		expr := strings.TrimSpace(tmpl[start+1 : end])
+		tmpl = tmpl[end+1:]
+
+		switch {
+		case expr == "":
+			return nil, errors.Errorf("invalid jsonpath template: empty expression")
+		case expr == "end":
+			if len(stack) == 1 {
+				return nil, errors.Errorf("invalid jsonpath template: {end} without {range}")
+			}
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(expr, "range "):
+			path, err := parseJSONPathExpr(strings.TrimSpace(strings.TrimPrefix(expr, "range ")))
+			if err != nil {
+				return nil, err
+			}
+			n := &jpRange{
+				path: path,
+			}
+			appendNode(n)
+			stack = append(stack, n)
+		case expr[0] == '"':
+			val, err := strconv.Unquote(expr)
+			if err != nil {
+				return nil, errors.Errorf("invalid jsonpath template: invalid literal %s", expr)
+			}
+			appendNode(jpText(val))
+		default:
+			path, err := parseJSONPathExpr(expr)
+			if err != nil {
+				return nil, err
+			}
+			appendNode(path)
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil, errors.Errorf("invalid jsonpath template: {range} without {end}")
+	}
+
+	return &jsonPath{
+		nodes: root.nodes,
+	}, nil
+}
+
+// getExprEnd returns the index of the brace closing the expression that
+// starts at the given index, skipping the braces inside quoted literals.
+func getExprEnd(tmpl string, start int) (int, error) {
+	inQuote := false
+	for i := start + 1; i < len(tmpl); i++ {
+		switch tmpl[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case '{':
+			if !inQuote {
+				return 0, errors.Errorf("invalid jsonpath template: unexpected { at position %d", i)
+			}
+		case '}':
+			if !inQuote {
+				return i, nil
+			}
+		}
+	}
+
+	return 0, errors.Errorf("invalid jsonpath template: unclosed { at position %d", start)
+}
+
+func parseJSONPathExpr(expr string) (jpPath, error) {
+	var ret jpPath
+
+	invalidErr := func(reason string) error {
+		return errors.Errorf("invalid jsonpath expression %q: %s", expr, reason)
+	}
+
+	s := expr
+	if len(s) > 0 && (s[0] == '$' || s[0] == '@') {
+		s = s[1:]
+	}
+
+	if s == "" || s == "." {
+		return ret, nil
+	}
+
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if strings.HasPrefix(s, "*") {
+				ret = append(ret, jpStep{typ: jpStepWildcard})
+				s = s[1:]
+				continue
+			}
+
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			if name == "" {
+				return nil, invalidErr("empty field name")
+			}
+			if strings.ContainsAny(name, " ]'\"") {
+				return nil, invalidErr(fmt.Sprintf("invalid field name %q", name))
+			}
+			ret = append(ret, jpStep{typ: jpStepField, name: name})
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, invalidErr("unclosed [")
+			}
+			arg := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+
+			switch {
+			case arg == "*":
+				ret = append(ret, jpStep{typ: jpStepWildcard})
+			case len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0]:
+				ret = append(ret, jpStep{typ: jpStepField, name: arg[1 : len(arg)-1]})
+			default:
+				idx, err := strconv.Atoi(arg)
+				if err != nil {
+					return nil, invalidErr(fmt.Sprintf("invalid index %q", arg))
+				}
+				ret = append(ret, jpStep{typ: jpStepIndex, index: idx})
+			}
+		default:
+			return nil, invalidErr(fmt.Sprintf("unexpected character %q", s[0]))
+		}
+	}
+
+	return ret, nil
+}
+
+func (p jpPath) eval(cur any) []any {
+	vals := []any{cur}
+
+	for _, step := range p {
+		var next []any
+		for _, val := range vals {
+			switch step.typ {
+			case jpStepField:
+				if m, ok := val.(map[string]any); ok {
+					if v, ok := m[step.name]; ok {
+						next = append(next, v)
+					}
+				}
+			case jpStepWildcard:
+				switch v := val.(type) {
+				case []any:
+					next = append(next, v...)
+				case map[string]any:
+					keys := make([]string, 0, len(v))
+					for k := range v {
+						keys = append(keys, k)
+					}
+					slices.Sort(keys)
+					for _, k := range keys {
+						next = append(next, v[k])
+					}
+				}
+			case jpStepIndex:
+				if v, ok := val.([]any); ok {
+					idx := step.index
+					if idx < 0 {
+						idx += len(v)
+					}
+					if idx >= 0 && idx < len(v) {
+						next = append(next, v[idx])
+					}
+				}
+			}
+		}
+		vals = next
+	}
+
+	return vals
+}
+
+func (t *jsonPath) execute(dat any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := executeJSONPathNodes(&buf, t.nodes, dat); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func executeJSONPathNodes(buf *bytes.Buffer, nodes []jpNode, cur any) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case jpText:
+			buf.WriteString(string(n))
+		case jpPath:
+			for i, val := range n.eval(cur) {
+				if i > 0 {
+					buf.WriteByte(' ')
+				}
+				if err := writeJSONPathValue(buf, val); err != nil {
+					return err
+				}
+			}
+		case *jpRange:
+			items := n.path.eval(cur)
+			if len(items) == 1 {
+				if lst, ok := items[0].([]any); ok {
+					items = lst
+				}
+			}
+			for _, itm := range items {
+				if err := executeJSONPathNodes(buf, n.nodes, itm); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeJSONPathValue(buf *bytes.Buffer, val any) error {
+	switch v := val.(type) {
+	case string:
+		buf.WriteString(v)
+	case nil:
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		out, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(out)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+)
+
+type listResponse interface {
+	proto.Message
+	GetListResponseMeta() *metav1.ListResponseMeta
+}
+
+// The Cluster never returns more than 1000 items per page
+const maxListPages = 10000
+
+// ListPages lists the resources via listFn using the list options set via the
+// command flags. All the pages are fetched and merged into the first page when
+// the --all-pages flag is set, otherwise a notice is shown if the list has
+// more pages.
+func ListPages[T listResponse](cmd *cobra.Command, listFn func(common *metav1.CommonListOptions) (T, error)) (T, error) {
+	common := GetCommonListOptions(cmd)
+
+	if !getFlagBoolean(cmd, "all-pages") {
+		ret, err := listFn(common)
+		if err != nil {
+			return ret, err
+		}
+
+		if meta := ret.GetListResponseMeta(); meta.GetHasMore() && getFlagStr(cmd, "out") == "" {
+			color.New(color.FgYellow).Fprintf(os.Stderr,
+				"Showing page %d with %d of %d items. Use --page to get other pages or --all-pages to get all of them\n",
+				meta.Page+1, listItemsLen(ret), meta.TotalCount)
+		}
+
+		return ret, nil
+	}
+
+	if common == nil {
+		common = &metav1.CommonListOptions{}
+	}
+	common.Page = 0
+
+	var ret T
+	for {
+		res, err := listFn(common)
+		if err != nil {
+			return ret, err
+		}
+
+		if common.Page == 0 {
+			ret = res
+		} else if err := appendListItems(ret, res); err != nil {
+			return ret, err
+		}
+
+		if !res.GetListResponseMeta().GetHasMore() {
+			break
+		}
+
+		common.Page++
+		if common.Page >= maxListPages {
+			return ret, errors.Errorf("Too many list pages")
+		}
+	}
+
+	if meta := ret.GetListResponseMeta(); meta != nil {
+		meta.HasMore = false
+		meta.ItemsPerPage = uint32(listItemsLen(ret))
+	}
+
+	return ret, nil
+}
+
+func listItemsLen(lst proto.Message) int {
+	fd := lst.ProtoReflect().Descriptor().Fields().ByName("items")
+	if fd == nil || !fd.IsList() {
+		return 0
+	}
+
+	return lst.ProtoReflect().Get(fd).List().Len()
+}
+
+func appendListItems(dst, src proto.Message) error {
+	fd := dst.ProtoReflect().Descriptor().Fields().ByName("items")
+	if fd == nil || !fd.IsList() {
+		return errors.Errorf("Could not find the list items")
+	}
+
+	srcItems := src.ProtoReflect().Get(fd).List()
+	dstItems := dst.ProtoReflect().Mutable(fd).List()
+	for i := range srcItems.Len() {
+		dstItems.Append(srcItems.Get(i))
+	}
+
+	return nil
+}
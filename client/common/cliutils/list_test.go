@@ -0,0 +1,91 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPages(t *testing.T) {
+	const total = 5
+	const perPage = 2
+
+	listFn := func(common *metav1.CommonListOptions) (*corev1.UserList, error) {
+		ret := &corev1.UserList{
+			ListResponseMeta: &metav1.ListResponseMeta{
+				Page:         common.Page,
+				ItemsPerPage: perPage,
+				TotalCount:   total,
+			},
+		}
+
+		for i := common.Page * perPage; i < min((common.Page+1)*perPage, total); i++ {
+			ret.Items = append(ret.Items, &corev1.User{
+				Metadata: &metav1.Metadata{
+					Name: fmt.Sprintf("usr-%d", i),
+				},
+			})
+		}
+		ret.ListResponseMeta.HasMore = (common.Page+1)*perPage < total
+
+		return ret, nil
+	}
+
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().Uint32("page", 1, "")
+		cmd.Flags().Uint32("items-per-page", 0, "")
+		cmd.Flags().Bool("all-pages", false, "")
+		cmd.Flags().String("out", "", "")
+		require.NoError(t, cmd.Flags().Parse(args))
+		return cmd
+	}
+
+	{
+		res, err := ListPages(newCmd("--page", "2", "--out", "json"), listFn)
+		assert.Nil(t, err)
+		assert.Len(t, res.Items, 2)
+		assert.Equal(t, "usr-2", res.Items[0].Metadata.Name)
+		assert.True(t, res.ListResponseMeta.HasMore)
+	}
+
+	{
+		res, err := ListPages(newCmd("--all-pages", "--page", "2"), listFn)
+		assert.Nil(t, err)
+		assert.Len(t, res.Items, total)
+		for i, itm := range res.Items {
+			assert.Equal(t, fmt.Sprintf("usr-%d", i), itm.Metadata.Name)
+		}
+		assert.False(t, res.ListResponseMeta.HasMore)
+		assert.Equal(t, uint32(total), res.ListResponseMeta.ItemsPerPage)
+	}
+
+	{
+		_, err := ListPages(newCmd("--all-pages"), func(common *metav1.CommonListOptions) (*corev1.UserList, error) {
+			if common.Page > 0 {
+				return nil, fmt.Errorf("page-err")
+			}
+			return listFn(common)
+		})
+		assert.ErrorContains(t, err, "page-err")
+	}
+}
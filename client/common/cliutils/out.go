@@ -15,6 +15,11 @@
 package cliutils
 
 import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+
 	"github.com/octelium/octelium/pkg/common/pbutils"
 	"google.golang.org/protobuf/proto"
 
@@ -23,12 +28,76 @@ import (
 
 func OutFormatPrint(outType string, dat proto.Message) ([]byte, error) {
 
-	switch outType {
+	format, arg, _ := strings.Cut(outType, "=")
+
+	switch format {
 	case "json":
 		return pbutils.MarshalJSON(dat, true)
 	case "yaml", "yml", "":
 		return pbutils.MarshalYAML(dat)
+	case "jsonpath", "jsonpath-file":
+		tmpl, err := getOutTemplate(format, arg)
+		if err != nil {
+			return nil, err
+		}
+		return printJSONPath(tmpl, dat)
+	case "go-template", "go-template-file":
+		tmpl, err := getOutTemplate(format, arg)
+		if err != nil {
+			return nil, err
+		}
+		return printGoTemplate(tmpl, dat)
 	default:
 		return nil, errors.Errorf("invalid output format: %s", outType)
 	}
 }
+
+func getOutTemplate(format, arg string) (string, error) {
+	if arg == "" {
+		return "", errors.Errorf("the %s output format requires a template, e.g. -o %s=...", format, format)
+	}
+
+	if !strings.HasSuffix(format, "-file") {
+		return arg, nil
+	}
+
+	ret, err := os.ReadFile(arg)
+	if err != nil {
+		return "", errors.Errorf("Could not read the template file: %s", err)
+	}
+
+	return string(ret), nil
+}
+
+func printJSONPath(tmpl string, dat proto.Message) ([]byte, error) {
+	jp, err := parseJSONPath(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := pbutils.ConvertToMap(dat)
+	if err != nil {
+		return nil, err
+	}
+
+	return jp.execute(m)
+}
+
+func printGoTemplate(tmpl string, dat proto.Message) ([]byte, error) {
+	t, err := template.New("out").Parse(tmpl)
+	if err != nil {
+		return nil, errors.Errorf("invalid go-template: %s", err)
+	}
+
+	m, err := pbutils.ConvertToMap(dat)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, m); err != nil {
+		return nil, errors.Errorf("Could not execute the go-template: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,172 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestUserList() *corev1.UserList {
+	return &corev1.UserList{
+		Items: []*corev1.User{
+			{
+				Metadata: &metav1.Metadata{
+					Name: "usr1",
+				},
+				Spec: &corev1.User_Spec{
+					Type:   corev1.User_Spec_HUMAN,
+					Groups: []string{"g1", "g2"},
+				},
+			},
+			{
+				Metadata: &metav1.Metadata{
+					Name: "usr2",
+				},
+				Spec: &corev1.User_Spec{
+					Type:       corev1.User_Spec_WORKLOAD,
+					IsDisabled: true,
+				},
+			},
+		},
+	}
+}
+
+func TestOutFormatPrint(t *testing.T) {
+
+	usrList := getTestUserList()
+
+	type tstCase struct {
+		out      string
+		expected string
+	}
+
+	tstCases := []tstCase{
+		{out: "jsonpath={.items[0].metadata.name}", expected: "usr1"},
+		{out: "jsonpath={.items[-1].metadata.name}", expected: "usr2"},
+		{out: "jsonpath={.items[*].metadata.name}", expected: "usr1 usr2"},
+		{out: "jsonpath={$.items[*].spec.isDisabled}", expected: "true"},
+		{out: "jsonpath={.items[0].spec['type']}", expected: "HUMAN"},
+		{out: "jsonpath={.items[0].spec.groups}", expected: `["g1","g2"]`},
+		{out: "jsonpath={.items[0].spec.groups[*]}", expected: "g1 g2"},
+		{out: "jsonpath={.items[5].metadata.name}", expected: ""},
+		{out: "jsonpath={.items[0].metadata.unknown}", expected: ""},
+		{out: "jsonpath=name: {.items[0].metadata.name}", expected: "name: usr1"},
+		{
+			out:      `jsonpath={range .items[*]}{.metadata.name}{"\t"}{.spec.type}{"\n"}{end}`,
+			expected: "usr1\tHUMAN\nusr2\tWORKLOAD\n",
+		},
+		{
+			out:      `jsonpath={range .items}{.metadata.name}{","}{end}`,
+			expected: "usr1,usr2,",
+		},
+		{
+			out:      `jsonpath={"{}"}`,
+			expected: "{}",
+		},
+		{
+			out:      `go-template={{range .items}}{{.metadata.name}} {{end}}`,
+			expected: "usr1 usr2 ",
+		},
+	}
+
+	for _, tc := range tstCases {
+		out, err := OutFormatPrint(tc.out, usrList)
+		assert.Nil(t, err, "%s: %+v", tc.out, err)
+		assert.Equal(t, tc.expected, string(out), "%s", tc.out)
+	}
+
+	invalids := []string{
+		"table",
+		"jsonpath",
+		"jsonpath=",
+		"jsonpath={.items[0]",
+		"jsonpath={}",
+		"jsonpath={.items[a]}",
+		"jsonpath={.items..name}",
+		"jsonpath={items}",
+		"jsonpath={range .items[*]}{.metadata.name}",
+		"jsonpath={.metadata.name}{end}",
+		`jsonpath={"unclosed}`,
+		"go-template={{.items",
+		"go-template-file=/nonexistent/tmpl",
+	}
+
+	for _, out := range invalids {
+		_, err := OutFormatPrint(out, usrList)
+		assert.NotNil(t, err, "%s", out)
+	}
+}
+
+func TestFieldSelector(t *testing.T) {
+
+	getNames := func(lst *corev1.UserList) []string {
+		var ret []string
+		for _, itm := range lst.Items {
+			ret = append(ret, itm.Metadata.Name)
+		}
+		return ret
+	}
+
+	type tstCase struct {
+		selector string
+		expected []string
+	}
+
+	tstCases := []tstCase{
+		{selector: "metadata.name=usr1", expected: []string{"usr1"}},
+		{selector: "metadata.name==usr2", expected: []string{"usr2"}},
+		{selector: "metadata.name!=usr1", expected: []string{"usr2"}},
+		{selector: "spec.type=WORKLOAD,spec.isDisabled=true", expected: []string{"usr2"}},
+		{selector: "spec.type=HUMAN, spec.isDisabled=true", expected: nil},
+		{selector: "spec.isDisabled!=true", expected: []string{"usr1"}},
+		{selector: "spec.email=", expected: []string{"usr1", "usr2"}},
+		{selector: "metadata.name.unknown=", expected: []string{"usr1", "usr2"}},
+	}
+
+	for _, tc := range tstCases {
+		reqs, err := parseFieldSelector(tc.selector)
+		assert.Nil(t, err, "%s", tc.selector)
+
+		usrList := getTestUserList()
+		err = filterList(usrList, reqs)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, getNames(usrList), "%s", tc.selector)
+	}
+
+	invalids := []string{
+		"",
+		",",
+		"metadata.name",
+		"=usr1",
+		"metadata..name=usr1",
+		"metadata.name[0]=usr1",
+	}
+
+	for _, selector := range invalids {
+		_, err := parseFieldSelector(selector)
+		assert.NotNil(t, err, "%s", selector)
+	}
+
+	{
+		reqs, err := parseFieldSelector("metadata.name=usr1")
+		assert.Nil(t, err)
+		err = filterList(&corev1.User{}, reqs)
+		assert.NotNil(t, err)
+	}
+}
@@ -55,6 +55,14 @@ func PreRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := setTokensFromFiles(cmd); err != nil {
+		return err
+	}
+
+	if err := setGRPCOpts(cmd); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,293 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/octelium/octelium/pkg/grpcerr"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	watchMinBackoff = 1 * time.Second
+	watchMaxBackoff = 30 * time.Second
+)
+
+func IsWatch(cmd *cobra.Command) bool {
+	return getFlagBoolean(cmd, "watch")
+}
+
+type WatchListOpts struct {
+	// Kind is the kind of the watched resources
+	Kind string
+	// List is the already fetched list whose items are printed as the
+	// initial CREATED events
+	List proto.Message
+	// Out is the output format
+	Out string
+	// Filters are additional field selector requirements that the watched
+	// resources must match, typically to emulate the filters of the list
+	// options such as the owner Namespace or User
+	Filters []string
+}
+
+// WatchList prints the items of the list and then the changes of the
+// resources of its kind until the command is interrupted. Each event is
+// printed in one of the following formats:
+//   - By default, a line of the event type, the resource name and its
+//     resource version (e.g. "UPDATED  ns1  (1729000352540)").
+//   - For -o json, the event object, i.e. its "type" and "item", as a single
+//     JSON line.
+//   - For -o yaml, the event object as a YAML document preceded by "---".
+//   - For the template formats, the template output with the event object as
+//     the root.
+//
+// Transient disconnects are retried with a backoff. The events that happen
+// while disconnected are recovered, as CREATED or UPDATED events, except for
+// the deletions.
+func WatchList(ctx context.Context, cmd *cobra.Command, c corev1.MainServiceClient, o *WatchListOpts) error {
+	reqs, err := getWatchFieldRequirements(cmd, o.Filters)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	w := &watcher{
+		c:    c,
+		o:    o,
+		reqs: reqs,
+		seen: make(map[string]string),
+		out:  os.Stdout,
+	}
+
+	if o.List != nil {
+		items, err := getListItems(o.List)
+		if err != nil {
+			return err
+		}
+
+		for _, itm := range items {
+			if err := w.handle(&corev1.WatchEvent{
+				Type: corev1.WatchEvent_CREATED,
+			}, itm); err != nil {
+				return err
+			}
+		}
+	}
+
+	return w.run(ctx)
+}
+
+func getWatchFieldRequirements(cmd *cobra.Command, filters []string) ([]*fieldRequirement, error) {
+	selectors := filters
+	if selector := getFlagStr(cmd, "field-selector"); selector != "" {
+		selectors = append(selectors, selector)
+	}
+
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+
+	return parseFieldSelector(strings.Join(selectors, ","))
+}
+
+func getListItems(list proto.Message) ([]umetav1.ResourceObjectI, error) {
+	msg := list.ProtoReflect()
+	fd := msg.Descriptor().Fields().ByName("items")
+	if fd == nil || !fd.IsList() || fd.Message() == nil {
+		return nil, errors.Errorf("Could not get the items of %s", msg.Descriptor().Name())
+	}
+
+	var ret []umetav1.ResourceObjectI
+	items := msg.Get(fd).List()
+	for i := 0; i < items.Len(); i++ {
+		itm, ok := items.Get(i).Message().Interface().(umetav1.ResourceObjectI)
+		if !ok {
+			return nil, errors.Errorf("Invalid list item of %s", msg.Descriptor().Name())
+		}
+		ret = append(ret, itm)
+	}
+
+	return ret, nil
+}
+
+type watcher struct {
+	c    corev1.MainServiceClient
+	o    *WatchListOpts
+	reqs []*fieldRequirement
+	// seen is the resource version of the currently existing resources by UID
+	seen map[string]string
+	out  io.Writer
+}
+
+func (w *watcher) run(ctx context.Context) error {
+	backoff := watchMinBackoff
+	isReconnect := false
+
+	for {
+		stream, err := w.c.Watch(ctx, &corev1.WatchOptions{
+			Kind: w.o.Kind,
+			// The initial events are only needed to recover the changes that
+			// happened while disconnected
+			SkipInitial: !isReconnect,
+		})
+
+		for err == nil {
+			var event *corev1.WatchEvent
+			event, err = stream.Recv()
+			if err != nil {
+				break
+			}
+			backoff = watchMinBackoff
+
+			if err := w.handleEvent(event); err != nil {
+				return err
+			}
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if !isWatchErrTransient(err) {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Watch disconnected: %s. Reconnecting in %s...\n", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		backoff = min(2*backoff, watchMaxBackoff)
+		isReconnect = true
+	}
+}
+
+func isWatchErrTransient(err error) bool {
+	return errors.Is(err, io.EOF) || grpcerr.IsUnavailable(err) || grpcerr.IsInternal(err) ||
+		grpcerr.IsUnknown(err) || grpcerr.IsDeadlineExceeded(err)
+}
+
+func (w *watcher) handleEvent(event *corev1.WatchEvent) error {
+	if event.Item == nil {
+		return nil
+	}
+
+	msg, err := anypb.UnmarshalNew(event.Item, proto.UnmarshalOptions{})
+	if err != nil {
+		return err
+	}
+
+	itm, ok := msg.(umetav1.ResourceObjectI)
+	if !ok || itm.GetMetadata() == nil {
+		return nil
+	}
+
+	return w.handle(event, itm)
+}
+
+func (w *watcher) handle(event *corev1.WatchEvent, itm umetav1.ResourceObjectI) error {
+	md := itm.GetMetadata()
+
+	switch event.Type {
+	case corev1.WatchEvent_CREATED:
+		if rv, ok := w.seen[md.Uid]; ok {
+			if rv == md.ResourceVersion {
+				return nil
+			}
+			event.Type = corev1.WatchEvent_UPDATED
+		}
+		w.seen[md.Uid] = md.ResourceVersion
+	case corev1.WatchEvent_UPDATED:
+		w.seen[md.Uid] = md.ResourceVersion
+	case corev1.WatchEvent_DELETED:
+		delete(w.seen, md.Uid)
+	}
+
+	if len(w.reqs) > 0 {
+		m, err := pbutils.ConvertToMap(itm)
+		if err != nil {
+			return err
+		}
+		if !matchesFieldRequirements(m, w.reqs) {
+			return nil
+		}
+	}
+
+	return w.print(event, itm)
+}
+
+func (w *watcher) print(event *corev1.WatchEvent, itm umetav1.ResourceObjectI) error {
+	format, _, _ := strings.Cut(w.o.Out, "=")
+
+	if format == "" {
+		fmt.Fprintf(w.out, "%-8s %s  (%s)\n", event.Type.String(), itm.GetMetadata().Name, itm.GetMetadata().ResourceVersion)
+		return nil
+	}
+
+	out := &corev1.WatchEvent{
+		Type: event.Type,
+		Item: event.Item,
+	}
+	if out.Item == nil {
+		var err error
+		out.Item, err = pbutils.MessageToAny(itm)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case "json":
+		res, err := pbutils.MarshalJSON(out, false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w.out, "%s\n", string(res))
+	case "yaml", "yml":
+		res, err := pbutils.MarshalYAML(out)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w.out, "---\n%s", string(res))
+	default:
+		res, err := OutFormatPrint(w.o.Out, out)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w.out, "%s\n", string(res))
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cliutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type tstWatchStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	events []*corev1.WatchEvent
+	err    error
+}
+
+func (s *tstWatchStream) Recv() (*corev1.WatchEvent, error) {
+	if len(s.events) > 0 {
+		ret := s.events[0]
+		s.events = s.events[1:]
+		return ret, nil
+	}
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	<-s.ctx.Done()
+	return nil, status.Error(codes.Canceled, "canceled")
+}
+
+type tstWatchClient struct {
+	corev1.MainServiceClient
+	streams []*tstWatchStream
+	reqs    []*corev1.WatchOptions
+	cancel  context.CancelFunc
+}
+
+func (c *tstWatchClient) Watch(ctx context.Context,
+	in *corev1.WatchOptions, opts ...grpc.CallOption) (grpc.ServerStreamingClient[corev1.WatchEvent], error) {
+	c.reqs = append(c.reqs, in)
+	if len(c.streams) == 0 {
+		c.cancel()
+		return nil, status.Error(codes.Canceled, "canceled")
+	}
+
+	ret := c.streams[0]
+	c.streams = c.streams[1:]
+	ret.ctx = ctx
+	return ret, nil
+}
+
+func getTstWatchNamespace(name, uid, rv string) *corev1.Namespace {
+	return &corev1.Namespace{
+		Metadata: &metav1.Metadata{
+			Name:            name,
+			Uid:             uid,
+			ResourceVersion: rv,
+		},
+	}
+}
+
+func getTstWatchEvent(typ corev1.WatchEvent_Type, ns *corev1.Namespace) *corev1.WatchEvent {
+	return &corev1.WatchEvent{
+		Type: typ,
+		Item: pbutils.MessageToAnyMust(ns),
+	}
+}
+
+func TestWatcher(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &tstWatchClient{
+		cancel: cancel,
+		streams: []*tstWatchStream{
+			{
+				events: []*corev1.WatchEvent{
+					getTstWatchEvent(corev1.WatchEvent_CREATED, getTstWatchNamespace("ns2", "2", "1")),
+					getTstWatchEvent(corev1.WatchEvent_UPDATED, getTstWatchNamespace("ns1", "1", "2")),
+				},
+				err: status.Error(codes.Unavailable, "disconnected"),
+			},
+			{
+				// The replay of the existing resources after reconnecting
+				events: []*corev1.WatchEvent{
+					getTstWatchEvent(corev1.WatchEvent_CREATED, getTstWatchNamespace("ns1", "1", "2")),
+					getTstWatchEvent(corev1.WatchEvent_CREATED, getTstWatchNamespace("ns2", "2", "3")),
+					getTstWatchEvent(corev1.WatchEvent_CREATED, getTstWatchNamespace("ns3", "3", "1")),
+					getTstWatchEvent(corev1.WatchEvent_DELETED, getTstWatchNamespace("ns3", "3", "1")),
+				},
+				err: io.EOF,
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	w := &watcher{
+		c: c,
+		o: &WatchListOpts{
+			Kind: "Namespace",
+		},
+		seen: make(map[string]string),
+		out:  &out,
+	}
+
+	err := w.handle(&corev1.WatchEvent{Type: corev1.WatchEvent_CREATED}, getTstWatchNamespace("ns1", "1", "1"))
+	assert.Nil(t, err)
+
+	err = w.run(ctx)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"CREATED  ns1  (1)",
+		"CREATED  ns2  (1)",
+		"UPDATED  ns1  (2)",
+		"UPDATED  ns2  (3)",
+		"CREATED  ns3  (1)",
+		"DELETED  ns3  (1)",
+	}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+
+	assert.Equal(t, 3, len(c.reqs))
+	assert.True(t, c.reqs[0].SkipInitial)
+	assert.False(t, c.reqs[1].SkipInitial)
+	assert.Equal(t, "Namespace", c.reqs[0].Kind)
+}
+
+func TestWatcherFormats(t *testing.T) {
+
+	{
+		c := &tstWatchClient{
+			streams: []*tstWatchStream{
+				{
+					err: status.Error(codes.PermissionDenied, "denied"),
+				},
+			},
+		}
+
+		w := &watcher{
+			c:    c,
+			o:    &WatchListOpts{},
+			seen: make(map[string]string),
+			out:  io.Discard,
+		}
+
+		err := w.run(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+
+	reqs, err := parseFieldSelector("metadata.name!=ns2")
+	assert.Nil(t, err)
+
+	for _, format := range []string{"json", "yaml", "jsonpath={.type} {.item.metadata.name}"} {
+		var out bytes.Buffer
+		w := &watcher{
+			o: &WatchListOpts{
+				Out: format,
+			},
+			reqs: reqs,
+			seen: make(map[string]string),
+			out:  &out,
+		}
+
+		err := w.handleEvent(getTstWatchEvent(corev1.WatchEvent_CREATED, getTstWatchNamespace("ns1", "1", "1")))
+		assert.Nil(t, err)
+		err = w.handleEvent(getTstWatchEvent(corev1.WatchEvent_CREATED, getTstWatchNamespace("ns2", "2", "1")))
+		assert.Nil(t, err)
+
+		switch format {
+		case "json":
+			assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+			res := make(map[string]any)
+			assert.Nil(t, json.Unmarshal(out.Bytes(), &res))
+			assert.Equal(t, "CREATED", res["type"])
+			assert.Equal(t, "ns1", res["item"].(map[string]any)["metadata"].(map[string]any)["name"])
+		case "yaml":
+			assert.True(t, strings.HasPrefix(out.String(), "---\n"))
+			assert.Contains(t, out.String(), "name: ns1")
+		default:
+			assert.Equal(t, "CREATED ns1\n", out.String())
+		}
+		assert.NotContains(t, out.String(), "ns2")
+	}
+}
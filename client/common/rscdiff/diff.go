@@ -81,6 +81,26 @@ func DiffCoreResource(ctx context.Context,
 	return ctl.Run(ctx)
 }
 
+// ListCoreResources lists all the resources of a kind except for the system
+// resources which cannot be applied.
+func ListCoreResources(ctx context.Context, kind string, conn *grpc.ClientConn) ([]umetav1.ResourceObjectI, error) {
+	ctl, err := NewDiffCtl("core", kind, corev1.NewMainServiceClient(conn),
+		func() (umetav1.ResourceObjectI, error) {
+			return ucorev1.NewObject(kind)
+		}, func() (protoreflect.ProtoMessage, error) {
+			return ucorev1.NewObjectListOptions(kind)
+		}, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctl.setCurrentItems(ctx); err != nil {
+		return nil, err
+	}
+
+	return ctl.currentItems, nil
+}
+
 type diffCtl struct {
 	api          string
 	kind         string
@@ -152,6 +172,12 @@ func (c *diffCtl) Run(ctx context.Context) (*DiffCtlResponse, error) {
 
 	for _, itm := range c.updateItems {
 		if err := c.doUpdateItem(ctx, itm); err != nil {
+			if grpcerr.IsConflict(err) {
+				cliutils.LineWarn("Could not apply %s %s due to field ownership conflicts. %s\n",
+					c.kind, itm.GetMetadata().Name, cliutils.GrpcErr(err))
+				cliutils.LineInfo(" Use --force to take the ownership of the conflicting fields\n")
+				continue
+			}
 			if isUserError(err) {
 				cliutils.LineWarn("Could not update %s %s. %s\n",
 					c.kind, itm.GetMetadata().Name, cliutils.GrpcErr(err))
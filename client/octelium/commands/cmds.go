@@ -61,4 +61,14 @@ func init() {
 	Cmd.PersistentFlags().String("domain", "", "The Cluster Domain")
 	Cmd.PersistentFlags().String("homedir", "", "Override Octelium home directory")
 	Cmd.PersistentFlags().Bool("logout", false, `Log out after executing the command. This is useful when using commands such as "octelium connect" inside ephemeral environments such as containers`)
+	Cmd.PersistentFlags().String("access-token-file", "",
+		"Read the access token from this file. This takes precedence over the OCTELIUM_ACCESS_TOKEN and OCTELIUM_ACCESS_TOKEN_FILE environment variables")
+	Cmd.PersistentFlags().String("auth-token-file", "",
+		"Read the authentication token from this file. This takes precedence over the OCTELIUM_AUTH_TOKEN and OCTELIUM_AUTH_TOKEN_FILE environment variables")
+	Cmd.PersistentFlags().String("grpc-max-recv-msg-size", "",
+		"The max size of the gRPC messages received from the Cluster, e.g. 16MiB. This can also be set via the OCTELIUM_GRPC_MAX_RECV_MSG_SIZE environment variable")
+	Cmd.PersistentFlags().Bool("no-reauth-prompt", false,
+		"Do not prompt to log in again and retry once the Cluster no longer accepts the current Session. This can also be set via the OCTELIUM_NO_REAUTH_PROMPT=true environment variable")
+	Cmd.PersistentFlags().Bool("non-interactive", false,
+		"Fail instead of starting any interactive authentication flow such as opening the browser. This can also be set via the OCTELIUM_NON_INTERACTIVE=true environment variable")
 }
@@ -32,6 +32,8 @@ func AddSubcommands() {
 func init() {
 	Cmd.PersistentFlags().Uint32("page", 1, "List page")
 	Cmd.PersistentFlags().Uint32("items-per-page", 0, "Items per page")
+	Cmd.PersistentFlags().Bool("all-pages", false, "Fetch all the list pages, one page at a time, instead of only a single page")
 	Cmd.PersistentFlags().Bool("order-by-name", false, "Order the list by name")
 	Cmd.PersistentFlags().Bool("order-reverse", false, "Reverse the order of the list")
+	Cmd.PersistentFlags().String("field-selector", "", "Filter the list by field, e.g. metadata.name=example,spec.type!=WORKLOAD")
 }
@@ -17,6 +17,7 @@ package namespace
 import (
 	"fmt"
 
+	"github.com/octelium/octelium/apis/main/metav1"
 	"github.com/octelium/octelium/apis/main/userv1"
 	"github.com/octelium/octelium/client/common/client"
 	"github.com/octelium/octelium/client/common/cliutils"
@@ -63,13 +64,19 @@ func doCmd(cmd *cobra.Command, args []string) error {
 
 	c := userv1.NewMainServiceClient(conn)
 
-	netList, err := c.ListNamespace(cmd.Context(), &userv1.ListNamespaceOptions{
-		Common: cliutils.GetCommonListOptions(cmd),
+	netList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*userv1.NamespaceList, error) {
+		return c.ListNamespace(cmd.Context(), &userv1.ListNamespaceOptions{
+			Common: common,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, netList); err != nil {
+		return err
+	}
+
 	if cmdArgs.Out != "" {
 		out, err := cliutils.OutFormatPrint(cmdArgs.Out, netList)
 		if err != nil {
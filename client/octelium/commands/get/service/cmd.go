@@ -84,15 +84,20 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	svcList, err := c.ListService(ctx,
-		&userv1.ListServiceOptions{
+	svcList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*userv1.ServiceList, error) {
+		return c.ListService(ctx, &userv1.ListServiceOptions{
 			Namespace: cmdArgs.Namespace,
-			Common:    cliutils.GetCommonListOptions(cmd),
+			Common:    common,
 		})
+	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, svcList); err != nil {
+		return err
+	}
+
 	if cmdArgs.Out != "" {
 		out, err := cliutils.OutFormatPrint(cmdArgs.Out, svcList)
 		if err != nil {
@@ -22,8 +22,10 @@ import (
 	"github.com/octelium/octelium/client/common/rscdiff"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
 	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
 )
 
 type args struct {
@@ -31,6 +33,9 @@ type args struct {
 	ResourceIncludes []string
 	ResourceExcludes []string
 	IncludeSecret    bool
+	ServerSideApply  bool
+	FieldManager     string
+	Force            bool
 }
 
 var examples = `
@@ -48,6 +53,12 @@ octeliumctl apply --include User --include Group /path/to/file.yaml
 
 # Exclude changes in Services
 octeliumctl apply --exclude Service /path/to/file.yaml
+
+# Apply changes using server-side apply with a custom field manager
+octeliumctl apply --server-side-apply --field-manager ci /path/to/file.yaml
+
+# Take ownership of the fields owned by other field managers
+octeliumctl apply --server-side-apply --force /path/to/file.yaml
 `
 
 var Cmd = &cobra.Command{
@@ -78,6 +89,12 @@ Only include this resource kind. This overrides the default list of included Res
 		"Exclude this resource kind from the default list of included Resources")
 	Cmd.PersistentFlags().BoolVar(&cmdArgs.IncludeSecret, "include-secret", false,
 		"Include Secret resources. This by default is disabled in order to not encourage defining your Secrets inside configs that are meant to be stored in git repos for example")
+	Cmd.PersistentFlags().BoolVar(&cmdArgs.ServerSideApply, "server-side-apply", false,
+		"Use server-side apply where the Cluster tracks the ownership of the fields set by each field manager and only updates the fields owned by the current field manager. Changing fields owned by other field managers fails with a conflict unless --force is used")
+	Cmd.PersistentFlags().StringVar(&cmdArgs.FieldManager, "field-manager", "octeliumctl",
+		"The name of the field manager used by server-side apply")
+	Cmd.PersistentFlags().BoolVar(&cmdArgs.Force, "force", false,
+		"Take the ownership of the fields owned by other field managers in case of server-side apply conflicts")
 }
 
 func doCmd(cmd *cobra.Command, args []string) error {
@@ -88,6 +105,20 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if cmdArgs.Force && !cmdArgs.ServerSideApply {
+		return errors.Errorf("--force can only be used with --server-side-apply")
+	}
+
+	if cmdArgs.ServerSideApply {
+		if cmdArgs.FieldManager == "" {
+			return errors.Errorf("--field-manager must be set for server-side apply")
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-octelium-field-manager", cmdArgs.FieldManager)
+		if cmdArgs.Force {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-octelium-force-apply", "true")
+		}
+	}
+
 	conn, err := client.GetGRPCClientConn(ctx, i.Domain)
 	if err != nil {
 		return err
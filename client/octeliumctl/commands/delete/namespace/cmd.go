@@ -16,16 +16,25 @@ package namespace
 
 import (
 	"context"
+	"time"
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/apis/main/metav1"
 	"github.com/octelium/octelium/client/common/client"
 	"github.com/octelium/octelium/client/common/cliutils"
+	"github.com/octelium/octelium/client/common/rscdiff"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/grpcerr"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
 )
 
 type args struct {
-	Name string
+	Name    string
+	Cascade string
+	Wait    bool
+	Timeout time.Duration
 }
 
 var Cmd = &cobra.Command{
@@ -34,6 +43,10 @@ var Cmd = &cobra.Command{
 	Example: `
 octeliumctl delete namespace ns1
 octeliumctl del ns ns2
+# Delete the Namespace and keep its Services
+octeliumctl delete namespace ns1 --cascade orphan
+# Delete the Namespace Services in the background and wait until they are deleted
+octeliumctl delete namespace ns1 --cascade background --wait
 	`,
 
 	Aliases: []string{"ns"},
@@ -46,6 +59,12 @@ octeliumctl del ns ns2
 var cmdArgs args
 
 func init() {
+	Cmd.PersistentFlags().StringVar(&cmdArgs.Cascade, "cascade", "foreground",
+		`How the Services of the Namespace are handled. "foreground" deletes the Services before deleting the Namespace, "background" deletes the Namespace and then the Services asynchronously and "orphan" keeps the Services`)
+	Cmd.PersistentFlags().BoolVar(&cmdArgs.Wait, "wait", false,
+		"Wait until the Namespace and, unless orphaned, its Services are deleted")
+	Cmd.PersistentFlags().DurationVar(&cmdArgs.Timeout, "timeout", 2*time.Minute,
+		"The maximum duration to wait for when --wait is used")
 }
 
 func doCmd(cmd *cobra.Command, args []string) error {
@@ -54,6 +73,11 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	cascade, err := getCascade(cmdArgs.Cascade)
+	if err != nil {
+		return err
+	}
+
 	conn, err := client.GetGRPCClientConn(context.Background(), i.Domain)
 	if err != nil {
 		return err
@@ -64,11 +88,107 @@ func doCmd(cmd *cobra.Command, args []string) error {
 
 	ctx := context.Background()
 
-	if _, err := c.DeleteNamespace(ctx, &metav1.DeleteOptions{Name: i.FirstArg()}); err != nil {
+	ns, err := c.GetNamespace(ctx, &metav1.GetOptions{Name: i.FirstArg()})
+	if err != nil {
 		return err
 	}
 
+	res, err := c.DeleteNamespace(ctx, &metav1.DeleteOptions{
+		Uid:     ns.Metadata.Uid,
+		Cascade: cascade,
+	})
+	if err != nil {
+		return err
+	}
+
+	if cmdArgs.Wait {
+		if err := waitDeleted(ctx, conn, ns, cascade); err != nil {
+			return err
+		}
+	}
+
 	cliutils.LineInfo("Namespace `%s` successfully deleted\n", i.FirstArg())
 
+	if res.CountAffected > 0 {
+		switch cascade {
+		case metav1.DeleteOptions_FOREGROUND:
+			cliutils.LineInfo(" %d Services deleted\n", res.CountAffected)
+		case metav1.DeleteOptions_BACKGROUND:
+			if cmdArgs.Wait {
+				cliutils.LineInfo(" %d Services deleted\n", res.CountAffected)
+			} else {
+				cliutils.LineInfo(" %d Services are being deleted in the background\n", res.CountAffected)
+			}
+		default:
+			cliutils.LineWarn(" %d Services orphaned\n", res.CountAffected)
+		}
+	}
+
 	return nil
 }
+
+func getCascade(arg string) (metav1.DeleteOptions_Cascade, error) {
+	switch arg {
+	case "foreground", "":
+		return metav1.DeleteOptions_FOREGROUND, nil
+	case "background":
+		return metav1.DeleteOptions_BACKGROUND, nil
+	case "orphan":
+		return metav1.DeleteOptions_ORPHAN, nil
+	default:
+		return metav1.DeleteOptions_CASCADE_UNSET,
+			errors.Errorf("invalid cascade: %s. It must be either foreground, background or orphan", arg)
+	}
+}
+
+func waitDeleted(ctx context.Context, conn *grpc.ClientConn,
+	ns *corev1.Namespace, cascade metav1.DeleteOptions_Cascade) error {
+	c := corev1.NewMainServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(ctx, cmdArgs.Timeout)
+	defer cancel()
+
+	isDeleted := func() (bool, error) {
+		if _, err := c.GetNamespace(ctx, &metav1.GetOptions{Uid: ns.Metadata.Uid}); err == nil {
+			return false, nil
+		} else if !grpcerr.IsNotFound(err) {
+			return false, err
+		}
+
+		if cascade == metav1.DeleteOptions_ORPHAN {
+			return true, nil
+		}
+
+		svcs, err := rscdiff.ListCoreResources(ctx, ucorev1.KindService, conn)
+		if err != nil {
+			return false, err
+		}
+
+		for _, svc := range svcs {
+			if svc.(*corev1.Service).Status.GetNamespaceRef().GetUid() == ns.Metadata.Uid {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	}
+
+	for {
+		deleted, err := isDeleted()
+		if err != nil {
+			if ctx.Err() != nil {
+				return errors.Errorf("Timeout waiting for the Namespace %s to be deleted", ns.Metadata.Name)
+			}
+			return err
+		}
+		if deleted {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("Timeout waiting for the Namespace %s to be deleted", ns.Metadata.Name)
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/client/common/client"
+	"github.com/octelium/octelium/client/common/cliutils"
+	"github.com/octelium/octelium/client/common/rscdiff"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+)
+
+type args struct {
+	ResourceIncludes []string
+	ResourceExcludes []string
+	IncludeSecret    bool
+	Namespace        string
+	FieldSelector    string
+	Out              string
+}
+
+var examples = `
+# Export all the resources to a file
+octeliumctl export > backup.yaml
+
+# Import the exported resources into a Cluster
+octeliumctl apply backup.yaml
+
+# Only export the Services of a Namespace alongside the Namespace itself
+octeliumctl export --include Namespace --include Service --namespace default
+
+# Only export the resources matching a field selector
+octeliumctl export --field-selector metadata.labels.team=backend
+
+# Export in JSON
+octeliumctl export -o json > backup.json
+`
+
+var Cmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the Cluster resources",
+	Long: `
+Export the Cluster resources to a single YAML or JSON stream that can be applied again via "octeliumctl apply"
+in order to back up the Cluster or to migrate its resources to another Cluster. The server-managed fields such as
+the UIDs, resource versions, timestamps and status are stripped and the resources are ordered so that each resource
+is applied after the resources it depends on.
+`,
+
+	Example: examples,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return doCmd(cmd, args)
+	},
+}
+
+var cmdArgs args
+
+func init() {
+	Cmd.PersistentFlags().StringSliceVar(&cmdArgs.ResourceIncludes, "include", nil,
+		`
+Only include this resource kind. This overrides the default list of included Resources:
+["User", "Group", "Policy", "Service", "Namespace", "Credential", "IdentityProvider"]`)
+	Cmd.PersistentFlags().StringSliceVar(&cmdArgs.ResourceExcludes, "exclude", nil,
+		"Exclude this resource kind from the default list of included Resources")
+	Cmd.PersistentFlags().BoolVar(&cmdArgs.IncludeSecret, "include-secret", false,
+		"Include Secret resources. The Secret values are never returned by the Cluster and therefore must be set in the exported Secrets before applying them")
+	Cmd.PersistentFlags().StringVarP(&cmdArgs.Namespace, "namespace", "n", "",
+		"Only export the Services of this Namespace as well as the Namespace itself")
+	Cmd.PersistentFlags().StringVar(&cmdArgs.FieldSelector, "field-selector", "",
+		"Only export the resources matching the field selector, e.g. metadata.labels.team=backend")
+	Cmd.PersistentFlags().StringVarP(&cmdArgs.Out, "out", "o", "yaml",
+		"The output format. Supported formats are yaml and json")
+}
+
+func doCmd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	i, err := cliutils.GetCLIInfo(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	switch cmdArgs.Out {
+	case "yaml", "yml", "json":
+	default:
+		return errors.Errorf("invalid output format: %s", cmdArgs.Out)
+	}
+
+	var selector *cliutils.FieldSelector
+	if cmdArgs.FieldSelector != "" {
+		selector, err = cliutils.ParseFieldSelector(cmdArgs.FieldSelector)
+		if err != nil {
+			return err
+		}
+	}
+
+	conn, err := client.GetGRPCClientConn(ctx, i.Domain)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	allKinds := getResourceNames(getIncludes(), getExcludes())
+	if cmdArgs.IncludeSecret {
+		allKinds = append(allKinds, ucorev1.KindSecret)
+	}
+
+	var items []umetav1.ResourceObjectI
+	for _, kind := range allKinds {
+		kindItems, err := rscdiff.ListCoreResources(ctx, kind, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, itm := range kindItems {
+			if !isInNamespace(itm, cmdArgs.Namespace) {
+				continue
+			}
+
+			if selector != nil {
+				matches, err := selector.Matches(itm)
+				if err != nil {
+					return err
+				}
+				if !matches {
+					continue
+				}
+			}
+
+			items = append(items, getExportItem(itm))
+		}
+	}
+
+	sortItems(items)
+
+	if err := writeItems(os.Stdout, items, cmdArgs.Out); err != nil {
+		return err
+	}
+
+	if cmdArgs.IncludeSecret && slices.ContainsFunc(items, func(itm umetav1.ResourceObjectI) bool {
+		return itm.GetKind() == ucorev1.KindSecret
+	}) {
+		cliutils.LineWarn(
+			"The Secret values are never returned by the Cluster. You must set them in the exported Secrets before applying them\n")
+	}
+
+	return nil
+}
+
+// kindOrder is the order in which the resources are applied where every kind
+// comes after the kinds that it might depend on.
+var kindOrder = []string{
+	ucorev1.KindSecret,
+	ucorev1.KindPolicy,
+	ucorev1.KindIdentityProvider,
+	ucorev1.KindNamespace,
+	ucorev1.KindGroup,
+	ucorev1.KindUser,
+	ucorev1.KindService,
+	ucorev1.KindCredential,
+}
+
+func sortItems(items []umetav1.ResourceObjectI) {
+	sort.SliceStable(items, func(i, j int) bool {
+		ki := slices.Index(kindOrder, items[i].GetKind())
+		kj := slices.Index(kindOrder, items[j].GetKind())
+		if ki != kj {
+			return ki < kj
+		}
+
+		return items[i].GetMetadata().Name < items[j].GetMetadata().Name
+	})
+}
+
+func isInNamespace(itm umetav1.ResourceObjectI, namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+
+	switch obj := itm.(type) {
+	case *corev1.Namespace:
+		return obj.Metadata.Name == namespace
+	case *corev1.Service:
+		return obj.Status.GetNamespaceRef().GetName() == namespace
+	default:
+		return true
+	}
+}
+
+// getExportItem returns a copy of the resource without the fields that are
+// managed by the Cluster so that it can be applied as is to any Cluster.
+func getExportItem(itm umetav1.ResourceObjectI) umetav1.ResourceObjectI {
+	ret := proto.Clone(itm).(umetav1.ResourceObjectI)
+	md := itm.GetMetadata()
+
+	*ret.GetMetadata() = metav1.Metadata{
+		Name:        md.Name,
+		DisplayName: md.DisplayName,
+		Description: md.Description,
+		Labels:      md.Labels,
+		Annotations: md.Annotations,
+		PicURL:      md.PicURL,
+	}
+
+	msg := ret.ProtoReflect()
+	if fd := msg.Descriptor().Fields().ByName("status"); fd != nil {
+		msg.Clear(fd)
+	}
+
+	if secret, ok := ret.(*corev1.Secret); ok {
+		secret.Data = nil
+	}
+
+	return ret
+}
+
+func writeItems(w io.Writer, items []umetav1.ResourceObjectI, format string) error {
+	for _, itm := range items {
+		var out []byte
+		var err error
+		switch format {
+		case "json":
+			out, err = pbutils.MarshalJSON(itm, true)
+		default:
+			out, err = pbutils.MarshalYAML(itm)
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "---\n%s\n", out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getIncludes() []string {
+	if len(deduplicateItems(cmdArgs.ResourceIncludes)) > 0 {
+		return deduplicateItems(cmdArgs.ResourceIncludes)
+	}
+	return allResourceNames
+}
+
+func getExcludes() []string {
+	return deduplicateItems(cmdArgs.ResourceExcludes)
+}
+
+var allResourceNames = []string{
+	ucorev1.KindPolicy,
+	ucorev1.KindIdentityProvider,
+	ucorev1.KindNamespace,
+	ucorev1.KindGroup,
+	ucorev1.KindUser,
+	ucorev1.KindService,
+	ucorev1.KindCredential,
+}
+
+func getResourceNames(includes []string, excludes []string) []string {
+	var ret []string
+	for _, itm := range includes {
+		if slices.Contains(allResourceNames, itm) && !slices.Contains(excludes, itm) {
+			ret = append(ret, itm)
+		}
+	}
+
+	return ret
+}
+
+func deduplicateItems(lst []string) []string {
+	var ret []string
+	for _, itm := range lst {
+		if !slices.Contains(ret, itm) {
+			ret = append(ret, itm)
+		}
+	}
+	return ret
+}
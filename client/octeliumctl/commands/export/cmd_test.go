@@ -0,0 +1,138 @@
+// Copyright Octelium Labs, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/client/common/resources"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestExport(t *testing.T) {
+	svc := &corev1.Service{
+		ApiVersion: ucorev1.APIVersion,
+		Kind:       ucorev1.KindService,
+		Metadata: &metav1.Metadata{
+			Uid:             "svc-uid",
+			Name:            "svc.default",
+			Description:     "desc",
+			Labels:          map[string]string{"team": "backend"},
+			ResourceVersion: "rv",
+			CreatedAt:       timestamppb.Now(),
+		},
+		Spec: &corev1.Service_Spec{
+			Port: 8080,
+		},
+		Status: &corev1.Service_Status{
+			NamespaceRef: &metav1.ObjectReference{
+				Name: "default",
+			},
+		},
+	}
+
+	ns := &corev1.Namespace{
+		ApiVersion: ucorev1.APIVersion,
+		Kind:       ucorev1.KindNamespace,
+		Metadata: &metav1.Metadata{
+			Uid:  "ns-uid",
+			Name: "default",
+		},
+		Spec:   &corev1.Namespace_Spec{},
+		Status: &corev1.Namespace_Status{},
+	}
+
+	secret := &corev1.Secret{
+		ApiVersion: ucorev1.APIVersion,
+		Kind:       ucorev1.KindSecret,
+		Metadata: &metav1.Metadata{
+			Name: "sec",
+		},
+		Spec:   &corev1.Secret_Spec{},
+		Status: &corev1.Secret_Status{},
+		Data: &corev1.Secret_Data{
+			Type: &corev1.Secret_Data_Value{
+				Value: "value",
+			},
+		},
+	}
+
+	assert.True(t, isInNamespace(svc, "default"))
+	assert.False(t, isInNamespace(svc, "other"))
+	assert.True(t, isInNamespace(ns, "default"))
+	assert.False(t, isInNamespace(ns, "other"))
+	assert.True(t, isInNamespace(secret, "other"))
+
+	items := []umetav1.ResourceObjectI{
+		getExportItem(svc),
+		getExportItem(ns),
+		getExportItem(secret),
+	}
+
+	assert.Equal(t, "svc-uid", svc.Metadata.Uid)
+	assert.NotNil(t, svc.Status)
+	assert.NotNil(t, secret.Data)
+
+	sortItems(items)
+	assert.Equal(t, ucorev1.KindSecret, items[0].GetKind())
+	assert.Equal(t, ucorev1.KindNamespace, items[1].GetKind())
+	assert.Equal(t, ucorev1.KindService, items[2].GetKind())
+
+	for _, format := range []string{"yaml", "json"} {
+		var buf bytes.Buffer
+		require.NoError(t, writeItems(&buf, items, format))
+
+		fPath := filepath.Join(t.TempDir(), "export")
+		require.NoError(t, os.WriteFile(fPath, buf.Bytes(), 0600))
+
+		loaded, err := resources.LoadCoreResources(fPath)
+		require.NoError(t, err)
+		require.Len(t, loaded, 3)
+
+		for i := range items {
+			assert.True(t, pbutils.IsEqual(items[i], loaded[i]))
+		}
+
+		loadedSvc := loaded[2].(*corev1.Service)
+		assert.Equal(t, "svc.default", loadedSvc.Metadata.Name)
+		assert.Equal(t, "desc", loadedSvc.Metadata.Description)
+		assert.Equal(t, "backend", loadedSvc.Metadata.Labels["team"])
+		assert.Empty(t, loadedSvc.Metadata.Uid)
+		assert.Empty(t, loadedSvc.Metadata.ResourceVersion)
+		assert.Nil(t, loadedSvc.Metadata.CreatedAt)
+		assert.Nil(t, loadedSvc.Status)
+		assert.Equal(t, uint32(8080), loadedSvc.Spec.Port)
+
+		assert.Nil(t, loaded[0].(*corev1.Secret).Data)
+	}
+}
+
+func TestGetResourceNames(t *testing.T) {
+	assert.Equal(t, allResourceNames, getResourceNames(allResourceNames, nil))
+	assert.Equal(t, []string{ucorev1.KindUser},
+		getResourceNames([]string{ucorev1.KindUser, "Unknown"}, nil))
+	assert.Equal(t, []string{ucorev1.KindPolicy},
+		getResourceNames([]string{ucorev1.KindPolicy, ucorev1.KindUser}, []string{ucorev1.KindUser}))
+}
@@ -82,13 +82,27 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	itmList, err := c.ListConfig(cmd.Context(), &corev1.ListConfigOptions{
-		Common: cliutils.GetCommonListOptions(cmd),
+	itmList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*corev1.ConfigList, error) {
+		return c.ListConfig(cmd.Context(), &corev1.ListConfigOptions{
+			Common: common,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, itmList); err != nil {
+		return err
+	}
+
+	if cliutils.IsWatch(cmd) {
+		return cliutils.WatchList(cmd.Context(), cmd, c, &cliutils.WatchListOpts{
+			Kind: "Config",
+			List: itmList,
+			Out:  cmdArgs.Out,
+		})
+	}
+
 	if len(itmList.Items) == 0 {
 		cliutils.LineInfo("No Configs found\n")
 		return nil
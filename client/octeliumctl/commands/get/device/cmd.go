@@ -93,14 +93,34 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	itmList, err := c.ListDevice(cmd.Context(), &corev1.ListDeviceOptions{
-		Common:  cliutils.GetCommonListOptions(cmd),
-		UserRef: usrRef,
+	itmList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*corev1.DeviceList, error) {
+		return c.ListDevice(cmd.Context(), &corev1.ListDeviceOptions{
+			Common:  common,
+			UserRef: usrRef,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, itmList); err != nil {
+		return err
+	}
+
+	if cliutils.IsWatch(cmd) {
+		var filters []string
+		if cmdArgs.User != "" {
+			filters = append(filters, fmt.Sprintf("status.userRef.name=%s", cmdArgs.User))
+		}
+
+		return cliutils.WatchList(cmd.Context(), cmd, c, &cliutils.WatchListOpts{
+			Kind:    "Device",
+			List:    itmList,
+			Out:     cmdArgs.Out,
+			Filters: filters,
+		})
+	}
+
 	if len(itmList.Items) == 0 {
 		cliutils.LineInfo("No Devices found\n")
 		return nil
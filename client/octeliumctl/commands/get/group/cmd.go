@@ -83,13 +83,27 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	itmList, err := c.ListGroup(cmd.Context(), &corev1.ListGroupOptions{
-		Common: cliutils.GetCommonListOptions(cmd),
+	itmList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*corev1.GroupList, error) {
+		return c.ListGroup(cmd.Context(), &corev1.ListGroupOptions{
+			Common: common,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, itmList); err != nil {
+		return err
+	}
+
+	if cliutils.IsWatch(cmd) {
+		return cliutils.WatchList(cmd.Context(), cmd, c, &cliutils.WatchListOpts{
+			Kind: "Group",
+			List: itmList,
+			Out:  cmdArgs.Out,
+		})
+	}
+
 	if len(itmList.Items) == 0 {
 		cliutils.LineInfo("No Groups found\n")
 		return nil
@@ -81,13 +81,27 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	itmList, err := c.ListIdentityProvider(cmd.Context(), &corev1.ListIdentityProviderOptions{
-		Common: cliutils.GetCommonListOptions(cmd),
+	itmList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*corev1.IdentityProviderList, error) {
+		return c.ListIdentityProvider(cmd.Context(), &corev1.ListIdentityProviderOptions{
+			Common: common,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, itmList); err != nil {
+		return err
+	}
+
+	if cliutils.IsWatch(cmd) {
+		return cliutils.WatchList(cmd.Context(), cmd, c, &cliutils.WatchListOpts{
+			Kind: "IdentityProvider",
+			List: itmList,
+			Out:  cmdArgs.Out,
+		})
+	}
+
 	if len(itmList.Items) == 0 {
 		cliutils.LineInfo("No IdentityProviders found\n")
 		return nil
@@ -87,13 +87,27 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	itmList, err := c.ListNamespace(ctx, &corev1.ListNamespaceOptions{
-		Common: cliutils.GetCommonListOptions(cmd),
+	itmList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*corev1.NamespaceList, error) {
+		return c.ListNamespace(ctx, &corev1.ListNamespaceOptions{
+			Common: common,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, itmList); err != nil {
+		return err
+	}
+
+	if cliutils.IsWatch(cmd) {
+		return cliutils.WatchList(cmd.Context(), cmd, c, &cliutils.WatchListOpts{
+			Kind: "Namespace",
+			List: itmList,
+			Out:  cmdArgs.Out,
+		})
+	}
+
 	if len(itmList.Items) == 0 {
 		cliutils.LineInfo("No Namespaces found\n")
 		return nil
@@ -94,14 +94,34 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	svcList, err := c.ListService(cmd.Context(), &corev1.ListServiceOptions{
-		NamespaceRef: nsRef,
-		Common:       cliutils.GetCommonListOptions(cmd),
+	svcList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*corev1.ServiceList, error) {
+		return c.ListService(cmd.Context(), &corev1.ListServiceOptions{
+			NamespaceRef: nsRef,
+			Common:       common,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, svcList); err != nil {
+		return err
+	}
+
+	if cliutils.IsWatch(cmd) {
+		var filters []string
+		if cmdArgs.Namespace != "" {
+			filters = append(filters, fmt.Sprintf("status.namespaceRef.name=%s", cmdArgs.Namespace))
+		}
+
+		return cliutils.WatchList(cmd.Context(), cmd, c, &cliutils.WatchListOpts{
+			Kind:    "Service",
+			List:    svcList,
+			Out:     cmdArgs.Out,
+			Filters: filters,
+		})
+	}
+
 	if len(svcList.Items) == 0 {
 		cliutils.LineInfo("No Services found\n")
 		return nil
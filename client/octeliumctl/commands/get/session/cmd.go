@@ -95,14 +95,34 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	itmList, err := c.ListSession(ctx, &corev1.ListSessionOptions{
-		Common:  cliutils.GetCommonListOptions(cmd),
-		UserRef: usrRef,
+	itmList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*corev1.SessionList, error) {
+		return c.ListSession(ctx, &corev1.ListSessionOptions{
+			Common:  common,
+			UserRef: usrRef,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, itmList); err != nil {
+		return err
+	}
+
+	if cliutils.IsWatch(cmd) {
+		var filters []string
+		if cmdArgs.User != "" {
+			filters = append(filters, fmt.Sprintf("status.userRef.name=%s", cmdArgs.User))
+		}
+
+		return cliutils.WatchList(cmd.Context(), cmd, c, &cliutils.WatchListOpts{
+			Kind:    "Session",
+			List:    itmList,
+			Out:     cmdArgs.Out,
+			Filters: filters,
+		})
+	}
+
 	if len(itmList.Items) == 0 {
 		cliutils.LineInfo("No Sessions found\n")
 		return nil
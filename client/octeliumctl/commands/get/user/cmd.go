@@ -82,13 +82,27 @@ func doCmd(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	usrList, err := c.ListUser(cmd.Context(), &corev1.ListUserOptions{
-		Common: cliutils.GetCommonListOptions(cmd),
+	usrList, err := cliutils.ListPages(cmd, func(common *metav1.CommonListOptions) (*corev1.UserList, error) {
+		return c.ListUser(cmd.Context(), &corev1.ListUserOptions{
+			Common: common,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
+	if err := cliutils.FilterList(cmd, usrList); err != nil {
+		return err
+	}
+
+	if cliutils.IsWatch(cmd) {
+		return cliutils.WatchList(cmd.Context(), cmd, c, &cliutils.WatchListOpts{
+			Kind: "User",
+			List: usrList,
+			Out:  cmdArgs.Out,
+		})
+	}
+
 	if len(usrList.Items) == 0 {
 		cliutils.LineInfo("No Users found\n")
 		return nil
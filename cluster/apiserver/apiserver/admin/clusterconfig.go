@@ -18,6 +18,8 @@ package admin
 
 import (
 	"context"
+	"net/url"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/octelium/octelium/apis/main/corev1"
@@ -25,6 +27,9 @@ import (
 	"github.com/octelium/octelium/cluster/apiserver/apiserver/serr"
 	"github.com/octelium/octelium/cluster/common/apivalidation"
 	"github.com/octelium/octelium/cluster/common/grpcutils"
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/octelium/octelium/pkg/common/rgx"
 )
 
 func (s *Server) GetClusterConfig(ctx context.Context, req *corev1.GetClusterConfigRequest) (*corev1.ClusterConfig, error) {
@@ -91,6 +96,24 @@ func (s *Server) validateClusterConfigSpec(ctx context.Context, c *corev1.Cluste
 		return err
 	}
 
+	if err := validateIngress(c); err != nil {
+		return err
+	}
+
+	if c.Spec.Http != nil {
+		if err := validateHTTPFlush(c.Spec.Http.Flush); err != nil {
+			return err
+		}
+	}
+
+	if err := validateSecretProviders(c); err != nil {
+		return err
+	}
+
+	if err := otelutils.ValidateAccessLogConfig(c.Spec.AccessLog); err != nil {
+		return grpcutils.InvalidArg("Invalid accessLog: %s", err)
+	}
+
 	if err := s.validateCCAuthorization(ctx, c); err != nil {
 		return err
 	}
@@ -155,6 +178,85 @@ func validateGateway(c *corev1.ClusterConfig) error {
 	return nil
 }
 
+func validateIngress(c *corev1.ClusterConfig) error {
+	if defaultSvc := c.Spec.Ingress.GetDefaultService(); defaultSvc != "" {
+		if err := apivalidation.ValidateName(defaultSvc, 1, 0); err != nil {
+			return grpcutils.InvalidArg("Invalid defaultService: %s", defaultSvc)
+		}
+	}
+
+	unmatchedCfg := c.Spec.Ingress.GetUnmatchedHost()
+	if unmatchedCfg == nil {
+		return nil
+	}
+
+	if directCfg := unmatchedCfg.GetDirectResponse(); directCfg != nil {
+		if directCfg.StatusCode != 0 && (directCfg.StatusCode < 200 || directCfg.StatusCode > 599) {
+			return grpcutils.InvalidArg("Invalid unmatchedHost statusCode: %d", directCfg.StatusCode)
+		}
+		if len(directCfg.Body) > 50000 {
+			return grpcutils.InvalidArg("unmatchedHost body is too large")
+		}
+		if len(directCfg.ContentType) > 128 {
+			return grpcutils.InvalidArg("unmatchedHost contentType is too long")
+		}
+	}
+
+	if redirectCfg := unmatchedCfg.GetRedirect(); redirectCfg != nil {
+		u, err := url.Parse(redirectCfg.Url)
+		if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return grpcutils.InvalidArg("unmatchedHost redirect url must be an absolute HTTP(s) URL")
+		}
+		switch redirectCfg.StatusCode {
+		case 0, 301, 302, 303, 307, 308:
+		default:
+			return grpcutils.InvalidArg("Invalid unmatchedHost redirect statusCode: %d", redirectCfg.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+func validateHTTPFlush(cfg *corev1.Service_Spec_Config_HTTP_Flush) error {
+	if cfg == nil {
+		return nil
+	}
+
+	switch cfg.Type.(type) {
+	case *corev1.Service_Spec_Config_HTTP_Flush_Interval:
+		if err := apivalidation.ValidateDuration(cfg.GetInterval()); err != nil {
+			return err
+		}
+		if umetav1.ToDuration(cfg.GetInterval()).ToGo() > 10*time.Second {
+			return grpcutils.InvalidArg("Flush interval must not exceed 10s")
+		}
+	}
+
+	return nil
+}
+
+func validateSecretProviders(c *corev1.ClusterConfig) error {
+	vaultC := c.Spec.GetSecretProviders().GetVault()
+	if vaultC == nil {
+		return nil
+	}
+
+	if u, err := url.Parse(vaultC.Address); err != nil || u.Host == "" ||
+		(u.Scheme != "https" && u.Scheme != "http") {
+		return grpcutils.InvalidArg("Invalid Vault address: %s", vaultC.Address)
+	}
+
+	if len(vaultC.Namespace) > 256 {
+		return grpcutils.InvalidArg("Invalid Vault namespace")
+	}
+
+	if !rgx.NameMain.MatchString(vaultC.Token.GetFromSecret()) {
+		return grpcutils.InvalidArg("Invalid Vault token Secret name: %s", vaultC.Token.GetFromSecret())
+	}
+
+	return nil
+}
+
 func (s *Server) validateCCAuthorization(ctx context.Context, c *corev1.ClusterConfig) error {
 	if c.Spec.Authorization == nil {
 		return nil
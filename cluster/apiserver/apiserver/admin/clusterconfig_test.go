@@ -73,3 +73,47 @@ func TestClusterConfig(t *testing.T) {
 		}
 	*/
 }
+
+func TestValidateSecretProviders(t *testing.T) {
+	newCC := func(vaultC *corev1.ClusterConfig_Spec_SecretProviders_Vault) *corev1.ClusterConfig {
+		return &corev1.ClusterConfig{
+			Spec: &corev1.ClusterConfig_Spec{
+				SecretProviders: &corev1.ClusterConfig_Spec_SecretProviders{
+					Vault: vaultC,
+				},
+			},
+		}
+	}
+
+	newToken := func(name string) *corev1.ClusterConfig_Spec_SecretProviders_Vault_Token {
+		return &corev1.ClusterConfig_Spec_SecretProviders_Vault_Token{
+			Type: &corev1.ClusterConfig_Spec_SecretProviders_Vault_Token_FromSecret{
+				FromSecret: name,
+			},
+		}
+	}
+
+	assert.Nil(t, validateSecretProviders(&corev1.ClusterConfig{Spec: &corev1.ClusterConfig_Spec{}}))
+	assert.Nil(t, validateSecretProviders(newCC(nil)))
+
+	assert.Nil(t, validateSecretProviders(newCC(&corev1.ClusterConfig_Spec_SecretProviders_Vault{
+		Address: "https://vault.example.com:8200",
+		Token:   newToken("vault-token"),
+	})))
+
+	assert.NotNil(t, validateSecretProviders(newCC(&corev1.ClusterConfig_Spec_SecretProviders_Vault{
+		Address: "https://vault.example.com:8200",
+	})))
+	assert.NotNil(t, validateSecretProviders(newCC(&corev1.ClusterConfig_Spec_SecretProviders_Vault{
+		Address: "https://vault.example.com:8200",
+		Token:   newToken("Invalid_Name"),
+	})))
+	assert.NotNil(t, validateSecretProviders(newCC(&corev1.ClusterConfig_Spec_SecretProviders_Vault{
+		Address: "vault.example.com",
+		Token:   newToken("vault-token"),
+	})))
+	assert.NotNil(t, validateSecretProviders(newCC(&corev1.ClusterConfig_Spec_SecretProviders_Vault{
+		Address: "ftp://vault.example.com",
+		Token:   newToken("vault-token"),
+	})))
+}
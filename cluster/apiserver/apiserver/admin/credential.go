@@ -62,6 +62,10 @@ func (s *Server) CreateCredential(ctx context.Context, req *corev1.Credential) (
 		},
 	}
 
+	if err := common.InitManagedFields(ctx, item); err != nil {
+		return nil, err
+	}
+
 	item, err = s.octeliumC.CoreC().CreateCredential(ctx, item)
 	if err != nil {
 		return nil, serr.InternalWithErr(err)
@@ -374,8 +378,9 @@ func (s *Server) UpdateCredential(ctx context.Context, req *corev1.Credential) (
 		return nil, err
 	}
 
-	common.MetadataUpdate(item.Metadata, req.Metadata)
-	item.Spec = req.Spec
+	if err := common.ApplyUpdate(ctx, item, req); err != nil {
+		return nil, err
+	}
 	item.Status.UserRef = req.Status.UserRef
 
 	item, err = s.octeliumC.CoreC().UpdateCredential(ctx, item)
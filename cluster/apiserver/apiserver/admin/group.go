@@ -51,6 +51,10 @@ func (s *Server) CreateGroup(ctx context.Context, req *corev1.Group) (*corev1.Gr
 		Status:   &corev1.Group_Status{},
 	}
 
+	if err := common.InitManagedFields(ctx, item); err != nil {
+		return nil, err
+	}
+
 	item, err = s.octeliumC.CoreC().CreateGroup(ctx, item)
 	if err != nil {
 		return nil, serr.InternalWithErr(err)
@@ -74,8 +78,9 @@ func (s *Server) UpdateGroup(ctx context.Context, req *corev1.Group) (*corev1.Gr
 		return nil, err
 	}
 
-	common.MetadataUpdate(item.Metadata, req.Metadata)
-	item.Spec = req.Spec
+	if err := common.ApplyUpdate(ctx, item, req); err != nil {
+		return nil, err
+	}
 
 	item, err = s.octeliumC.CoreC().UpdateGroup(ctx, item)
 	if err != nil {
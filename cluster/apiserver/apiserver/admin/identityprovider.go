@@ -67,6 +67,10 @@ func (s *Server) CreateIdentityProvider(ctx context.Context, req *corev1.Identit
 		},
 	}
 
+	if err := apisrvcommon.InitManagedFields(ctx, item); err != nil {
+		return nil, err
+	}
+
 	item, err := s.octeliumC.CoreC().CreateIdentityProvider(ctx, item)
 	if err != nil {
 		return nil, serr.InternalWithErr(err)
@@ -147,8 +151,9 @@ func (s *Server) UpdateIdentityProvider(ctx context.Context, req *corev1.Identit
 		return nil, err
 	}
 
-	apisrvcommon.MetadataUpdate(item.Metadata, req.Metadata)
-	item.Spec = req.Spec
+	if err := apisrvcommon.ApplyUpdate(ctx, item, req); err != nil {
+		return nil, err
+	}
 	item.Status.Type = req.Status.Type
 
 	item, err = s.octeliumC.CoreC().UpdateIdentityProvider(ctx, item)
@@ -18,8 +18,10 @@ package admin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/apis/main/metav1"
@@ -30,6 +32,7 @@ import (
 	"github.com/octelium/octelium/cluster/common/grpcutils"
 	"github.com/octelium/octelium/cluster/common/urscsrv"
 	"github.com/octelium/octelium/pkg/grpcerr"
+	"go.uber.org/zap"
 )
 
 func (s *Server) UpdateNamespace(ctx context.Context, req *corev1.Namespace) (*corev1.Namespace, error) {
@@ -46,8 +49,9 @@ func (s *Server) UpdateNamespace(ctx context.Context, req *corev1.Namespace) (*c
 		return nil, err
 	}
 
-	common.MetadataUpdate(item.Metadata, req.Metadata)
-	item.Spec = req.Spec
+	if err := common.ApplyUpdate(ctx, item, req); err != nil {
+		return nil, err
+	}
 
 	item, err = s.octeliumC.CoreC().UpdateNamespace(ctx, item)
 	if err != nil {
@@ -89,6 +93,10 @@ func (s *Server) CreateNamespace(ctx context.Context, req *corev1.Namespace) (*c
 		Status:   &corev1.Namespace_Status{},
 	}
 
+	if err := common.InitManagedFields(ctx, item); err != nil {
+		return nil, err
+	}
+
 	item, err = s.octeliumC.CoreC().CreateNamespace(ctx, item)
 	if err != nil {
 		return nil, serr.InternalWithErr(err)
@@ -111,11 +119,66 @@ func (s *Server) DeleteNamespace(ctx context.Context, req *metav1.DeleteOptions)
 		return nil, err
 	}
 
+	svcList, err := s.octeliumC.CoreC().ListService(ctx, &rmetav1.ListOptions{
+		Filters: []*rmetav1.ListOptions_Filter{
+			urscsrv.FilterFieldEQValStr("status.namespaceRef.uid", ns.Metadata.Uid),
+		},
+	})
+	if err != nil {
+		return nil, serr.InternalWithErr(err)
+	}
+
+	ret := &metav1.OperationResult{
+		CountAffected: uint32(len(svcList.Items)),
+	}
+
+	switch req.Cascade {
+	case metav1.DeleteOptions_ORPHAN:
+		if len(svcList.Items) > 0 {
+			zap.L().Debug("Orphaning the Services of the deleted Namespace",
+				zap.String("namespace", ns.Metadata.Name), zap.Int("count", len(svcList.Items)))
+		}
+	case metav1.DeleteOptions_BACKGROUND:
+	default:
+		if err := s.deleteNamespaceServices(ctx, ns, svcList.Items); err != nil {
+			return nil, serr.InternalWithErr(err)
+		}
+	}
+
 	if _, err := s.octeliumC.CoreC().DeleteNamespace(ctx, &rmetav1.DeleteOptions{Uid: ns.Metadata.Uid}); err != nil {
 		return nil, serr.InternalWithErr(err)
 	}
 
-	return &metav1.OperationResult{}, nil
+	if req.Cascade == metav1.DeleteOptions_BACKGROUND && len(svcList.Items) > 0 {
+		go func(ctx context.Context, svcs []*corev1.Service) {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			defer cancel()
+
+			if err := s.deleteNamespaceServices(ctx, ns, svcs); err != nil {
+				zap.L().Warn("Could not delete all the Services of the deleted Namespace",
+					zap.String("namespace", ns.Metadata.Name), zap.Error(err))
+			}
+		}(context.WithoutCancel(ctx), svcList.Items)
+	}
+
+	return ret, nil
+}
+
+// deleteNamespaceServices deletes all the Services even if some of them cannot be
+// deleted and returns the errors of the latter.
+func (s *Server) deleteNamespaceServices(ctx context.Context, ns *corev1.Namespace, svcs []*corev1.Service) error {
+	var errs []error
+	for _, svc := range svcs {
+		if _, err := s.octeliumC.CoreC().DeleteService(ctx,
+			&rmetav1.DeleteOptions{Uid: svc.Metadata.Uid}); err != nil && !grpcerr.IsNotFound(err) {
+			zap.L().Warn("Could not delete the Service of the deleted Namespace",
+				zap.String("namespace", ns.Metadata.Name),
+				zap.String("service", svc.Metadata.Name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("Could not delete Service %s: %w", svc.Metadata.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func (s *Server) ListNamespace(ctx context.Context, req *corev1.ListNamespaceOptions) (*corev1.NamespaceList, error) {
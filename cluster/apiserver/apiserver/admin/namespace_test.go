@@ -18,11 +18,15 @@ package admin
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/apis/main/metav1"
 	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/pkg/grpcerr"
+	"github.com/octelium/octelium/pkg/utils/utilrand"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -77,3 +81,127 @@ func TestNamespace(t *testing.T) {
 	}
 
 }
+
+func TestDeleteNamespaceCascade(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+	srv := newFakeServer(tst.C)
+
+	createNamespace := func(count int) (*corev1.Namespace, []*corev1.Service) {
+		ns, err := srv.CreateNamespace(ctx, tests.GenNamespace())
+		assert.Nil(t, err)
+
+		var svcs []*corev1.Service
+		for range count {
+			svc, err := srv.CreateService(ctx, &corev1.Service{
+				Metadata: &metav1.Metadata{
+					Name: fmt.Sprintf("svc-%s.%s", utilrand.GetRandomStringLowercase(5), ns.Metadata.Name),
+				},
+				Spec: &corev1.Service_Spec{
+					Port: 80,
+					Mode: corev1.Service_Spec_HTTP,
+					Config: &corev1.Service_Spec_Config{
+						Upstream: &corev1.Service_Spec_Config_Upstream{
+							Type: &corev1.Service_Spec_Config_Upstream_Url{
+								Url: "https://example.com",
+							},
+						},
+					},
+				},
+			})
+			assert.Nil(t, err, "%+v", err)
+			svcs = append(svcs, svc)
+		}
+
+		return ns, svcs
+	}
+
+	{
+		ns, svcs := createNamespace(2)
+		res, err := srv.DeleteNamespace(ctx, &metav1.DeleteOptions{
+			Name:    ns.Metadata.Name,
+			Cascade: metav1.DeleteOptions_FOREGROUND,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(2), res.CountAffected)
+
+		for _, svc := range svcs {
+			_, err = srv.GetService(ctx, &metav1.GetOptions{Uid: svc.Metadata.Uid})
+			assert.True(t, grpcerr.IsNotFound(err))
+		}
+	}
+
+	{
+		ns, svcs := createNamespace(1)
+		res, err := srv.DeleteNamespace(ctx, &metav1.DeleteOptions{
+			Name:    ns.Metadata.Name,
+			Cascade: metav1.DeleteOptions_BACKGROUND,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(1), res.CountAffected)
+
+		assert.Eventually(t, func() bool {
+			_, err := srv.GetService(ctx, &metav1.GetOptions{Uid: svcs[0].Metadata.Uid})
+			return grpcerr.IsNotFound(err)
+		}, 5*time.Second, 100*time.Millisecond)
+	}
+
+	{
+		// Unset defaults to FOREGROUND
+		ns, svcs := createNamespace(1)
+		res, err := srv.DeleteNamespace(ctx, &metav1.DeleteOptions{
+			Name: ns.Metadata.Name,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(1), res.CountAffected)
+
+		_, err = srv.GetNamespace(ctx, &metav1.GetOptions{Name: ns.Metadata.Name})
+		assert.True(t, grpcerr.IsNotFound(err))
+
+		_, err = srv.GetService(ctx, &metav1.GetOptions{Uid: svcs[0].Metadata.Uid})
+		assert.True(t, grpcerr.IsNotFound(err))
+	}
+
+	{
+		ns, svcs := createNamespace(1)
+		res, err := srv.DeleteNamespace(ctx, &metav1.DeleteOptions{
+			Name:    ns.Metadata.Name,
+			Cascade: metav1.DeleteOptions_ORPHAN,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(1), res.CountAffected)
+
+		_, err = srv.GetNamespace(ctx, &metav1.GetOptions{Name: ns.Metadata.Name})
+		assert.True(t, grpcerr.IsNotFound(err))
+
+		_, err = srv.GetService(ctx, &metav1.GetOptions{Uid: svcs[0].Metadata.Uid})
+		assert.Nil(t, err)
+	}
+
+	{
+		// A Service that cannot be deleted does not prevent deleting the others
+		ns, svcs := createNamespace(2)
+		err := srv.deleteNamespaceServices(ctx, ns, []*corev1.Service{
+			svcs[0],
+			{
+				Metadata: &metav1.Metadata{
+					Name: "invalid",
+				},
+			},
+			svcs[1],
+		})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "invalid")
+
+		for _, svc := range svcs {
+			_, err = srv.GetService(ctx, &metav1.GetOptions{Uid: svc.Metadata.Uid})
+			assert.True(t, grpcerr.IsNotFound(err))
+		}
+	}
+}
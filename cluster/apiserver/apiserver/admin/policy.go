@@ -60,6 +60,10 @@ func (s *Server) CreatePolicy(ctx context.Context, req *corev1.Policy) (*corev1.
 		Status:   &corev1.Policy_Status{},
 	}
 
+	if err := common.InitManagedFields(ctx, item); err != nil {
+		return nil, err
+	}
+
 	if len(policyNames) > 1 {
 		parentPolicy, err := s.octeliumC.CoreC().GetPolicy(ctx, &rmetav1.GetOptions{Name: policyNames[1]})
 		if err != nil {
@@ -98,8 +102,9 @@ func (s *Server) UpdatePolicy(ctx context.Context, req *corev1.Policy) (*corev1.
 		return nil, err
 	}
 
-	common.MetadataUpdate(item.Metadata, req.Metadata)
-	item.Spec = req.Spec
+	if err := common.ApplyUpdate(ctx, item, req); err != nil {
+		return nil, err
+	}
 
 	if err := s.validatePolicySpec(ctx, item.Spec); err != nil {
 		return nil, grpcutils.InvalidArg("%s", err)
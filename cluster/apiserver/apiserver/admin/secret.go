@@ -18,6 +18,7 @@ package admin
 
 import (
 	"context"
+	"strings"
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/apis/main/metav1"
@@ -27,6 +28,7 @@ import (
 	"github.com/octelium/octelium/cluster/common/apivalidation"
 	"github.com/octelium/octelium/cluster/common/grpcutils"
 	"github.com/octelium/octelium/cluster/common/urscsrv"
+	"github.com/octelium/octelium/pkg/common/rgx"
 	"github.com/octelium/octelium/pkg/grpcerr"
 )
 
@@ -161,6 +163,31 @@ func (s *Server) validateSecret(ctx context.Context, itm *corev1.Secret) error {
 		return grpcutils.InvalidArg("Nil spec")
 	}
 
+	if ext := itm.Spec.External; ext != nil {
+		if itm.Data != nil || itm.Spec.Data != nil {
+			return grpcutils.InvalidArg("An external Secret cannot set its data")
+		}
+		if ext.Provider != "" && !rgx.NameMain.MatchString(ext.Provider) {
+			return grpcutils.InvalidArg("Invalid external Secret provider: %s", ext.Provider)
+		}
+		if ext.Path == "" || len(ext.Path) > 1024 {
+			return grpcutils.InvalidArg("Invalid external Secret path")
+		}
+		for _, segment := range strings.Split(ext.Path, "/") {
+			if segment == "." || segment == ".." {
+				return grpcutils.InvalidArg("Invalid external Secret path: %s", ext.Path)
+			}
+		}
+		if len(ext.Key) > 256 {
+			return grpcutils.InvalidArg("Invalid external Secret key")
+		}
+		if err := apivalidation.ValidateDuration(ext.RefreshInterval); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
 	if itm.Data == nil || itm.Data.Type == nil {
 		return grpcutils.InvalidArg("Empty Secret data")
 	}
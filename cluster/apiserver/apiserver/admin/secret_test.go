@@ -77,4 +77,63 @@ func TestSecret(t *testing.T) {
 		assert.Nil(t, err)
 	}
 
+	{
+		secretName := fmt.Sprintf("secret-%s", utilrand.GetRandomStringLowercase(4))
+		_, err := srv.CreateSecret(ctx, &corev1.Secret{
+			Metadata: &metav1.Metadata{
+				Name: secretName,
+			},
+			Spec: &corev1.Secret_Spec{
+				External: &corev1.Secret_Spec_External{
+					Provider: "vault",
+					Path:     "secret/my-app/db",
+					Key:      "password",
+				},
+			},
+		})
+		assert.Nil(t, err, "%+v", err)
+
+		_, err = srv.CreateSecret(ctx, &corev1.Secret{
+			Metadata: &metav1.Metadata{
+				Name: fmt.Sprintf("secret-%s", utilrand.GetRandomStringLowercase(4)),
+			},
+			Spec: &corev1.Secret_Spec{
+				External: &corev1.Secret_Spec_External{
+					Path: "secret/my-app/db",
+				},
+			},
+			Data: &corev1.Secret_Data{
+				Type: &corev1.Secret_Data_Value{
+					Value: "topsecret",
+				},
+			},
+		})
+		assert.NotNil(t, err)
+
+		_, err = srv.CreateSecret(ctx, &corev1.Secret{
+			Metadata: &metav1.Metadata{
+				Name: fmt.Sprintf("secret-%s", utilrand.GetRandomStringLowercase(4)),
+			},
+			Spec: &corev1.Secret_Spec{
+				External: &corev1.Secret_Spec_External{},
+			},
+		})
+		assert.NotNil(t, err)
+
+		_, err = srv.CreateSecret(ctx, &corev1.Secret{
+			Metadata: &metav1.Metadata{
+				Name: fmt.Sprintf("secret-%s", utilrand.GetRandomStringLowercase(4)),
+			},
+			Spec: &corev1.Secret_Spec{
+				External: &corev1.Secret_Spec_External{
+					Path: "secret/my-app/../../sys/policy",
+				},
+			},
+		})
+		assert.NotNil(t, err)
+
+		_, err = srv.DeleteSecret(ctx, &metav1.DeleteOptions{Name: secretName})
+		assert.Nil(t, err)
+	}
+
 }
@@ -18,11 +18,16 @@ package admin
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"mime"
+	"net"
 	"net/url"
+	"regexp"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/asaskevich/govalidator"
@@ -111,8 +116,9 @@ func (s *Server) UpdateService(ctx context.Context, req *corev1.Service) (*corev
 		return nil, err
 	}
 
-	common.MetadataUpdate(item.Metadata, req.Metadata)
-	item.Spec = req.Spec
+	if err := common.ApplyUpdate(ctx, item, req); err != nil {
+		return nil, err
+	}
 
 	if err := s.validateService(ctx, item); err != nil {
 		return nil, err
@@ -176,6 +182,10 @@ func (s *Server) DoCreateService(ctx context.Context, req *corev1.Service, isSys
 		},
 	}
 
+	if err := common.InitManagedFields(ctx, item); err != nil {
+		return nil, err
+	}
+
 	if isSystemService && req.Status != nil {
 		item.Status.ManagedService = req.Status.ManagedService
 	}
@@ -269,6 +279,79 @@ func (s *Server) DeleteService(ctx context.Context, req *metav1.DeleteOptions) (
 	return ret, nil
 }
 
+func validateOrigin(arg string) error {
+	if arg == "null" {
+		return nil
+	}
+
+	if len(arg) > 512 {
+		return grpcutils.InvalidArg("Origin is too long")
+	}
+
+	u, err := url.Parse(arg)
+	if err != nil {
+		return grpcutils.InvalidArg("Invalid Origin: %s", arg)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return grpcutils.InvalidArg("Invalid Origin scheme: %s", arg)
+	}
+
+	if u.Host == "" || u.User != nil || u.Path != "" ||
+		u.RawQuery != "" || u.Fragment != "" {
+		return grpcutils.InvalidArg("Invalid Origin: %s", arg)
+	}
+
+	return nil
+}
+
+func validateHostTemplate(tmpl *corev1.Service_Spec_Config_HTTP_Header_Host_Template) error {
+	if tmpl.Value == "" {
+		return grpcutils.InvalidArg("Host template value must be set")
+	}
+	if len(tmpl.Value) > 512 {
+		return grpcutils.InvalidArg("Host template is too long")
+	}
+
+	val := tmpl.Value
+	for {
+		start := strings.IndexByte(val, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(val[start:], '}')
+		if end < 0 {
+			return grpcutils.InvalidArg("Unterminated Host template variable: %s", tmpl.Value)
+		}
+
+		name := val[start+1 : start+end]
+		typ, arg, _ := strings.Cut(name, ".")
+		switch {
+		case name == "service", name == "namespace":
+		case typ == "path" && govalidator.IsNumeric(arg):
+		case (typ == "header" || typ == "query") && arg != "":
+		default:
+			return grpcutils.InvalidArg("Invalid Host template variable: %s", name)
+		}
+
+		val = val[start+end+1:]
+	}
+
+	if tmpl.Fallback != "" {
+		host := tmpl.Fallback
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !govalidator.IsDNSName(host) && !govalidator.IsIP(host) {
+			return grpcutils.InvalidArg("Invalid Host template fallback: %s", tmpl.Fallback)
+		}
+	}
+
+	return nil
+}
+
 func (s *Server) validateService(ctx context.Context,
 	svc *corev1.Service) error {
 
@@ -312,6 +395,15 @@ func (s *Server) validateService(ctx context.Context,
 		}
 	}
 
+	if sampling := spec.GetLogging().GetSampling(); sampling != nil {
+		if sampling.Initial > 100000 {
+			return grpcutils.InvalidArg("logging sampling initial is too large")
+		}
+		if sampling.Thereafter > 100000 {
+			return grpcutils.InvalidArg("logging sampling thereafter is too large")
+		}
+	}
+
 	if svc.Spec.Authorization != nil {
 		if err := s.validatePolicyOwner(ctx, svc.Spec.Authorization); err != nil {
 			return err
@@ -390,6 +482,26 @@ func (s *Server) validateService(ctx context.Context,
 		return serr.InvalidArg("The Service: %s is not an HTTP-based Service to be exposed publicly.", svc.Metadata.Name)
 	}
 
+	if len(svc.Spec.Hosts) > 0 {
+		if !svc.Spec.IsPublic {
+			return grpcutils.InvalidArg("Hosts require isPublic to be enabled")
+		}
+		if len(svc.Spec.Hosts) > 32 {
+			return grpcutils.InvalidArg("Too many hosts")
+		}
+
+		cc, err := s.octeliumC.CoreV1Utils().GetClusterConfig(ctx)
+		if err != nil {
+			return serr.InternalWithErr(err)
+		}
+
+		for _, host := range svc.Spec.Hosts {
+			if err := validateServiceHost(host, cc.Status.Domain); err != nil {
+				return err
+			}
+		}
+	}
+
 	if !ldflags.IsTest() {
 		reservedPorts := []uint32{
 			uint32(vutils.HealthCheckPortVigil),
@@ -442,6 +554,51 @@ func (s *Server) validateService(ctx context.Context,
 	return nil
 }
 
+// validateServiceHost validates the host of a Service. The exact and wildcard
+// hosts cannot overlap with the Cluster domain since its subdomains are
+// reserved to the Services' own FQDNs which always take precedence.
+func validateServiceHost(host *corev1.Service_Spec_Host, clusterDomain string) error {
+	switch host.Type.(type) {
+	case *corev1.Service_Spec_Host_Exact:
+		if !govalidator.IsDNSName(host.GetExact()) || strings.Contains(host.GetExact(), "*") {
+			return grpcutils.InvalidArg("Invalid exact host: %s", host.GetExact())
+		}
+		if isUnderDomain(host.GetExact(), clusterDomain) {
+			return grpcutils.InvalidArg("The exact host: %s is under the Cluster domain", host.GetExact())
+		}
+	case *corev1.Service_Spec_Host_Wildcard:
+		domain, ok := strings.CutPrefix(host.GetWildcard(), "*.")
+		if !ok || !govalidator.IsDNSName(domain) || strings.Contains(domain, "*") {
+			return grpcutils.InvalidArg("Invalid wildcard host: %s", host.GetWildcard())
+		}
+		if isUnderDomain(domain, clusterDomain) || isUnderDomain(clusterDomain, domain) {
+			return grpcutils.InvalidArg("The wildcard host: %s overlaps with the Cluster domain", host.GetWildcard())
+		}
+	case *corev1.Service_Spec_Host_Regex:
+		if len(host.GetRegex()) == 0 || len(host.GetRegex()) > 1024 {
+			return grpcutils.InvalidArg("Invalid regex host length")
+		}
+		if _, err := regexp.Compile(host.GetRegex()); err != nil {
+			return grpcutils.InvalidArg("Invalid regex host: %s", host.GetRegex())
+		}
+	default:
+		return grpcutils.InvalidArg("You must set either an exact, a wildcard or a regex host")
+	}
+
+	return nil
+}
+
+// isUnderDomain returns whether the host is the domain or one of its subdomains.
+func isUnderDomain(host, domain string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain == "" {
+		return false
+	}
+
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
 func (s *Server) ValidateServiceConfig(ctx context.Context,
 	cfg *corev1.Service_Spec_Config, svc *corev1.Service, skipRscCheck bool) error {
 	return s.validateServiceConfig(ctx, cfg, svc, skipRscCheck)
@@ -504,6 +661,17 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 				return err
 			}
 		}
+
+		if len(cfg.Tls.PinnedFingerprints) > 16 {
+			return grpcutils.InvalidArg("Too many pinned fingerprints")
+		}
+
+		for _, fp := range cfg.Tls.PinnedFingerprints {
+			b, err := hex.DecodeString(strings.ReplaceAll(fp, ":", ""))
+			if err != nil || len(b) != sha256.Size {
+				return grpcutils.InvalidArg("Invalid SHA-256 pinned fingerprint: %s", fp)
+			}
+		}
 	}
 
 	if cfg.ClientCertificate != nil {
@@ -585,6 +753,12 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 			if err := checkURL(cfg.Upstream.GetUrl()); err != nil {
 				return err
 			}
+			if cfg.GetHttp().IsUpstreamHTTP2 {
+				if u, err := url.Parse(cfg.Upstream.GetUrl()); err == nil && (u.Scheme == "ws" || u.Scheme == "wss") {
+					return grpcutils.InvalidArg("isUpstreamHTTP2 cannot be used with the WebSocket upstream: %s",
+						cfg.Upstream.GetUrl())
+				}
+			}
 		case *corev1.Service_Spec_Config_Upstream_Loadbalance_:
 
 			eps := cfg.Upstream.GetLoadbalance().Endpoints
@@ -831,6 +1005,29 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 		if cfg.GetHttp().Header != nil {
 			hdrSpec := cfg.GetHttp().Header
 
+			if tmpl := hdrSpec.Host.GetTemplate(); tmpl != nil {
+				if err := validateHostTemplate(tmpl); err != nil {
+					return err
+				}
+			}
+
+			if origin := hdrSpec.Origin; origin != nil &&
+				origin.Mode == corev1.Service_Spec_Config_HTTP_Header_Origin_FIXED {
+				if err := validateOrigin(origin.Value); err != nil {
+					return err
+				}
+			}
+
+			if server := hdrSpec.Server; server != nil &&
+				server.Mode == corev1.Service_Spec_Config_HTTP_Header_Server_CUSTOM {
+				if len(server.Value) > 256 {
+					return grpcutils.InvalidArg("Server header value is too long")
+				}
+				if strings.ContainsAny(server.Value, "\r\n") {
+					return grpcutils.InvalidArg("Invalid Server header value: %s", server.Value)
+				}
+			}
+
 			if len(hdrSpec.AddRequestHeaders) > 256 {
 				return grpcutils.InvalidArg("Too many addRequestHeaders")
 			}
@@ -897,6 +1094,26 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 					return err
 				}
 			}
+
+			if len(hdrSpec.DuplicateRequestHeaders) > 64 || len(hdrSpec.DuplicateResponseHeaders) > 64 {
+				return grpcutils.InvalidArg("Too many duplicate header policies")
+			}
+
+			for _, dup := range hdrSpec.DuplicateRequestHeaders {
+				if err := s.validateGenStr(dup.Name, true, "name"); err != nil {
+					return err
+				}
+			}
+
+			for _, dup := range hdrSpec.DuplicateResponseHeaders {
+				if err := s.validateGenStr(dup.Name, true, "name"); err != nil {
+					return err
+				}
+				if strings.EqualFold(dup.Name, "Set-Cookie") &&
+					dup.Policy == corev1.Service_Spec_Config_HTTP_Header_Duplicate_MERGE {
+					return grpcutils.InvalidArg("The Set-Cookie header cannot be merged")
+				}
+			}
 		}
 
 		if cfg.GetHttp().Auth != nil {
@@ -963,6 +1180,50 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 				}
 			}
 
+			if authSpec.GetHmac() != nil {
+				hmacC := authSpec.GetHmac()
+				if err := s.validateGenStr(hmacC.Header, false, "header"); err != nil {
+					return err
+				}
+				if err := s.validateGenStr(hmacC.TimestampHeader, false, "timestampHeader"); err != nil {
+					return err
+				}
+				if hmacC.TimestampHeader == "" &&
+					hmacC.Canonicalization != corev1.Service_Spec_Config_HTTP_Auth_HMAC_CANONICALIZATION_UNSET &&
+					hmacC.Canonicalization != corev1.Service_Spec_Config_HTTP_Auth_HMAC_BODY {
+					return serr.InvalidArg("HMAC timestampHeader must be set to sign the timestamp")
+				}
+				if len(hmacC.Prefix) > 32 || len(hmacC.Separator) > 8 {
+					return serr.InvalidArg("HMAC prefix or separator is too long")
+				}
+				if err := s.validateSecretOwner(ctx, hmacC.GetKey()); err != nil {
+					return err
+				}
+			}
+
+			if authSpec.GetNtlm() != nil {
+				ntlmC := authSpec.GetNtlm()
+				if ntlmC.Username == "" {
+					return serr.InvalidArg("NTLM username must be set")
+				} else {
+					if err := apivalidation.ValidateGenASCII(ntlmC.Username); err != nil {
+						return err
+					}
+				}
+				if err := s.validateGenStr(ntlmC.Domain, false, "domain"); err != nil {
+					return err
+				}
+				if ntlmC.MaxIdleConnections > 1024 {
+					return serr.InvalidArg("NTLM maxIdleConnections is too high")
+				}
+				if cfg.GetHttp().IsUpstreamHTTP2 {
+					return serr.InvalidArg("NTLM cannot be used with HTTP/2 upstreams")
+				}
+				if err := s.validateSecretOwner(ctx, ntlmC.GetPassword()); err != nil {
+					return err
+				}
+			}
+
 			if authSpec.GetOauth2ClientCredentials() != nil {
 				oauth2C := authSpec.GetOauth2ClientCredentials()
 				if oauth2C.ClientID == "" {
@@ -1006,6 +1267,44 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 			}
 		}
 
+		if cfg.GetHttp().FollowRedirects != nil {
+			followRedirects := cfg.GetHttp().FollowRedirects
+			if followRedirects.MaxRedirects > 10 {
+				return grpcutils.InvalidArg("maxRedirects cannot exceed 10")
+			}
+			if len(followRedirects.AllowedHosts) > 32 {
+				return grpcutils.InvalidArg("Too many followRedirects allowedHosts")
+			}
+			for _, host := range followRedirects.AllowedHosts {
+				if !govalidator.IsDNSName(strings.TrimPrefix(host, "*.")) &&
+					!govalidator.IsIP(host) {
+					return grpcutils.InvalidArg("Invalid followRedirects allowed host: %s", host)
+				}
+			}
+		}
+
+		if jsonFormat := cfg.GetHttp().JsonFormat; jsonFormat != nil {
+			if err := s.validateGenStr(jsonFormat.Header, false, "header"); err != nil {
+				return err
+			}
+			if jsonFormat.MaxSize > 64*1024*1024 {
+				return grpcutils.InvalidArg("JSONFormat maxSize must not exceed 64MiB")
+			}
+		}
+
+		if cfg.GetHttp().RequestCompression != nil {
+			requestCompression := cfg.GetHttp().RequestCompression
+			if len(requestCompression.ContentTypes) > 32 {
+				return grpcutils.InvalidArg("Too many requestCompression contentTypes")
+			}
+			for _, contentType := range requestCompression.ContentTypes {
+				typ, subtype, ok := strings.Cut(contentType, "/")
+				if !ok || typ == "" || subtype == "" || len(contentType) > 128 {
+					return grpcutils.InvalidArg("Invalid requestCompression content type: %s", contentType)
+				}
+			}
+		}
+
 		if cfg.GetHttp().Path != nil {
 			pth := cfg.GetHttp().Path
 			if pth.AddPrefix != "" {
@@ -1031,6 +1330,12 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 			resp := cfg.GetHttp().Response
 			switch resp.Type.(type) {
 			case *corev1.Service_Spec_Config_HTTP_Response_Direct_:
+				if cfg.Upstream != nil {
+					return grpcutils.InvalidArg("Direct response conflicts with the upstream which would never be used")
+				}
+				if cfg.GetHttp().FanOut.GetIsEnabled() {
+					return grpcutils.InvalidArg("Direct response conflicts with FanOut since no request reaches the upstream")
+				}
 				if resp.GetDirect().StatusCode != 0 {
 					if resp.GetDirect().StatusCode < 200 || resp.GetDirect().StatusCode > 599 {
 						return grpcutils.InvalidArg("Invalid statusCode: %d", resp.GetDirect().StatusCode)
@@ -1091,6 +1396,15 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 					if len(plugin.GetLua().GetInline()) > 20000 {
 						return serr.InvalidArg("Lua script is too large")
 					}
+
+					if plugin.GetLua().Timeout != nil {
+						if err := apivalidation.ValidateDuration(plugin.GetLua().Timeout); err != nil {
+							return err
+						}
+						if umetav1.ToDuration(plugin.GetLua().Timeout).ToGo() > 30*time.Second {
+							return serr.InvalidArg("Lua script timeout is too long")
+						}
+					}
 				case *corev1.Service_Spec_Config_HTTP_Plugin_Direct_:
 					if plugin.GetDirect().StatusCode != 0 {
 						if err := apivalidation.ValidateHTTPStatusCode(
@@ -1171,6 +1485,59 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 						return grpcutils.InvalidArg("Invalid maxSize value: %d", conf.MaxSize)
 					}
 
+					if conf.Disk != nil {
+						if conf.Disk.MaxEntrySize > 4_000_000_000 {
+							return grpcutils.InvalidArg("Invalid disk maxEntrySize value: %d", conf.Disk.MaxEntrySize)
+						}
+						if conf.Disk.MaxTotalSize > 0 && conf.Disk.MaxEntrySize > conf.Disk.MaxTotalSize {
+							return grpcutils.InvalidArg("Disk maxEntrySize must not exceed maxTotalSize")
+						}
+						if conf.Disk.MaxEntrySize > 0 && conf.Disk.Threshold >= conf.Disk.MaxEntrySize {
+							return grpcutils.InvalidArg("Disk threshold must be less than maxEntrySize")
+						}
+					}
+
+					if conf.Stale != nil {
+						if conf.Stale.StaleWhileRevalidate != nil {
+							if err := apivalidation.ValidateDuration(conf.Stale.StaleWhileRevalidate); err != nil {
+								return err
+							}
+						}
+						if conf.Stale.StaleIfError != nil {
+							if err := apivalidation.ValidateDuration(conf.Stale.StaleIfError); err != nil {
+								return err
+							}
+						}
+					}
+
+					if len(conf.Rules) > 128 {
+						return grpcutils.InvalidArg("Too many cache rules")
+					}
+
+					for _, rule := range conf.Rules {
+						if !strings.HasPrefix(rule.PathPrefix, "/") {
+							return grpcutils.InvalidArg("Invalid cache rule pathPrefix: %s", rule.PathPrefix)
+						}
+						if rule.Ttl != nil {
+							if err := apivalidation.ValidateDuration(rule.Ttl); err != nil {
+								return err
+							}
+						}
+						if rule.Key != nil {
+							switch rule.Key.Type.(type) {
+							case *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Key_Eval:
+								if err := checkCELExpression(ctx, rule.Key.GetEval()); err != nil {
+									return err
+								}
+							default:
+								return grpcutils.InvalidArg("Invalid key type")
+							}
+						}
+						if len(rule.PurgeVersion) > 128 {
+							return grpcutils.InvalidArg("Invalid cache rule purgeVersion")
+						}
+					}
+
 				case *corev1.Service_Spec_Config_HTTP_Plugin_JsonSchema:
 					conf := plugin.GetJsonSchema()
 					switch conf.Type.(type) {
@@ -1309,83 +1676,900 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 					return err
 				}
 			}
-		}
-
-	case *corev1.Service_Spec_Config_Kubernetes_:
-		if spec.Mode != corev1.Service_Spec_KUBERNETES {
-			return grpcutils.InvalidArg("KUBERNETES mode must be set for KUBERNETES config to be used")
-		}
 
-		k8s := cfg.GetKubernetes()
-
-		switch k8s.Type.(type) {
-		case *corev1.Service_Spec_Config_Kubernetes_Kubeconfig_:
-			if k8s.GetKubeconfig().GetFromSecret() == "" {
-				return serr.InvalidArg("Kubeconfig secret name must be set")
+			if len(visibility.RedactRequestBodyFields) > maxHeaders {
+				return grpcutils.InvalidArg("Too many redactRequestBodyFields")
 			}
-			sec, err := octeliumC.CoreC().GetSecret(ctx, &rmetav1.GetOptions{Name: k8s.GetKubeconfig().GetFromSecret()})
-			if err != nil {
-				if grpcerr.IsNotFound(err) {
-					return serr.InvalidArg("The Secret %s does not exist", k8s.GetKubeconfig().GetFromSecret())
+
+			for _, field := range visibility.RedactRequestBodyFields {
+				if err := s.validateGenStr(field, true, "redactRequestBodyField"); err != nil {
+					return err
 				}
-				return serr.InternalWithErr(err)
 			}
 
-			kubeconfig, err := k8sutils.UnmarshalKubeConfigFromYAML(ucorev1.ToSecret(sec).GetValueBytes())
-			if err != nil {
-				return serr.InvalidArg("Could not parse Kubeconfig form the Secret: %s", k8s.GetKubeconfig().GetFromSecret())
+			if len(visibility.RedactResponseBodyFields) > maxHeaders {
+				return grpcutils.InvalidArg("Too many redactResponseBodyFields")
 			}
 
-			if clstr := kubeconfig.GetCluster(k8s.GetKubeconfig().Context); clstr == nil {
-				return serr.InvalidArg("No Cluster found in the Kubeconfig")
+			for _, field := range visibility.RedactResponseBodyFields {
+				if err := s.validateGenStr(field, true, "redactResponseBodyField"); err != nil {
+					return err
+				}
 			}
+		}
 
-			if usr := kubeconfig.GetUser(k8s.GetKubeconfig().Context); usr == nil {
-				return serr.InvalidArg("No User found in the Kubeconfig")
+		if cfg.GetHttp().WebSocket != nil && cfg.GetHttp().WebSocket.Keepalive != nil {
+			keepalive := cfg.GetHttp().WebSocket.Keepalive
+			for _, d := range []*metav1.Duration{keepalive.Interval, keepalive.Timeout} {
+				if d == nil {
+					continue
+				}
+				if err := apivalidation.ValidateDuration(d); err != nil {
+					return err
+				}
+				if umetav1.ToDuration(d).ToGo() < time.Second {
+					return grpcutils.InvalidArg("WebSocket keepalive durations must be at least 1s")
+				}
 			}
+		}
 
-		case *corev1.Service_Spec_Config_Kubernetes_ClientCertificate:
-			if err := s.validateSecretOwner(ctx, k8s.GetClientCertificate()); err != nil {
-				return err
+		if cfg.GetHttp().ForwardProxy != nil {
+			proxyCfg := cfg.GetHttp().ForwardProxy
+			if proxyCfg.IsEnabled && len(proxyCfg.AllowedHosts) == 0 {
+				return grpcutils.InvalidArg("ForwardProxy requires at least one allowed host")
 			}
-		case *corev1.Service_Spec_Config_Kubernetes_BearerToken_:
-
-			if err := s.validateSecretOwner(ctx, k8s.GetBearerToken()); err != nil {
-				return err
+			if len(proxyCfg.AllowedHosts) > 64 {
+				return grpcutils.InvalidArg("Too many ForwardProxy allowed hosts")
 			}
-
-		default:
-			return serr.InvalidArg("Unsupported kubernetes config type")
-		}
-
-	case *corev1.Service_Spec_Config_Ssh:
-		if spec.Mode != corev1.Service_Spec_SSH {
-			return grpcutils.InvalidArg("SSH mode must be set for SSH config to be used")
-		}
-		inSSH := cfg.GetSsh()
-
-		if inSSH.Auth != nil {
-			switch inSSH.Auth.Type.(type) {
-			case *corev1.Service_Spec_Config_SSH_Auth_Password_:
-				if err := s.validateSecretOwner(ctx, inSSH.Auth.GetPassword()); err != nil {
+			for _, host := range proxyCfg.AllowedHosts {
+				if err := s.validateGenStr(host, true, "allowedHost"); err != nil {
 					return err
 				}
-			case *corev1.Service_Spec_Config_SSH_Auth_PrivateKey_:
-				if err := s.validateSecretOwner(ctx, inSSH.Auth.GetPrivateKey()); err != nil {
+				if strings.ContainsAny(host, " \t/") {
+					return grpcutils.InvalidArg("Invalid ForwardProxy allowed host: %s", host)
+				}
+			}
+			if len(proxyCfg.AllowedCIDRs) > 64 {
+				return grpcutils.InvalidArg("Too many ForwardProxy allowed CIDRs")
+			}
+			for _, cidr := range proxyCfg.AllowedCIDRs {
+				if _, _, err := net.ParseCIDR(cidr); err != nil {
+					return grpcutils.InvalidArg("Invalid ForwardProxy allowed CIDR: %s", cidr)
+				}
+			}
+			if proxyCfg.MaxConnections > 65536 {
+				return grpcutils.InvalidArg("ForwardProxy maxConnections must not exceed 65536")
+			}
+			for _, d := range []*metav1.Duration{proxyCfg.IdleTimeout, proxyCfg.MaxDuration} {
+				if d == nil {
+					continue
+				}
+				if err := apivalidation.ValidateDuration(d); err != nil {
 					return err
 				}
+				if umetav1.ToDuration(d).ToGo() < time.Second {
+					return grpcutils.InvalidArg("ForwardProxy durations must be at least 1s")
+				}
 			}
 		}
 
-	case *corev1.Service_Spec_Config_Postgres_:
-		if spec.Mode != corev1.Service_Spec_POSTGRES {
-			return grpcutils.InvalidArg("POSTGRES mode must be set for PostgreSQL config to be used")
+		if cfg.GetHttp().Cookie != nil {
+			if len(cfg.GetHttp().Cookie.Rewrites) > 32 {
+				return grpcutils.InvalidArg("Too many cookie rewrites")
+			}
+			for _, rewrite := range cfg.GetHttp().Cookie.Rewrites {
+				for _, name := range []string{rewrite.Name, rewrite.Rename} {
+					if err := s.validateGenStr(name, false, "cookie name"); err != nil {
+						return err
+					}
+					if strings.ContainsAny(name, " \t;,=\"") {
+						return grpcutils.InvalidArg("Invalid cookie name: %s", name)
+					}
+				}
+				if err := s.validateGenStr(rewrite.Domain, false, "cookie domain"); err != nil {
+					return err
+				}
+				if rewrite.Domain != "" && rewrite.RemoveDomain {
+					return grpcutils.InvalidArg("Cookie domain cannot be both set and removed")
+				}
+				if err := s.validateGenStr(rewrite.Path, false, "cookie path"); err != nil {
+					return err
+				}
+				if strings.ContainsAny(rewrite.Domain+rewrite.Path, ";\r\n") {
+					return grpcutils.InvalidArg("Invalid cookie domain or path")
+				}
+			}
 		}
 
-		pg := cfg.GetPostgres()
-
-		if pg.User != "" {
-			if err := apivalidation.ValidateGenASCII(pg.User); err != nil {
+		if cfg.GetHttp().ExpectContinue != nil && cfg.GetHttp().ExpectContinue.Timeout != nil {
+			if err := apivalidation.ValidateDuration(cfg.GetHttp().ExpectContinue.Timeout); err != nil {
+				return err
+			}
+			if umetav1.ToDuration(cfg.GetHttp().ExpectContinue.Timeout).ToGo() > time.Minute {
+				return grpcutils.InvalidArg("ExpectContinue timeout must not exceed 1m")
+			}
+		}
+
+		if cfg.GetHttp().Resolver != nil {
+			resolverCfg := cfg.GetHttp().Resolver
+			if len(resolverCfg.Nameservers) > 8 {
+				return grpcutils.InvalidArg("Too many resolver nameservers")
+			}
+			for _, ns := range resolverCfg.Nameservers {
+				host := ns
+				if h, _, err := net.SplitHostPort(ns); err == nil {
+					host = h
+				}
+				if net.ParseIP(host) == nil {
+					return grpcutils.InvalidArg("Invalid resolver nameserver: %s", ns)
+				}
+			}
+
+			if len(resolverCfg.SearchDomains) > 8 {
+				return grpcutils.InvalidArg("Too many resolver searchDomains")
+			}
+			for _, domain := range resolverCfg.SearchDomains {
+				if err := s.validateGenStr(domain, true, "searchDomain"); err != nil {
+					return err
+				}
+			}
+
+			if len(resolverCfg.StaticHosts) > 64 {
+				return grpcutils.InvalidArg("Too many resolver staticHosts")
+			}
+			for _, staticHost := range resolverCfg.StaticHosts {
+				if err := s.validateGenStr(staticHost.Host, true, "staticHost.host"); err != nil {
+					return err
+				}
+				if len(staticHost.Addresses) == 0 || len(staticHost.Addresses) > 16 {
+					return grpcutils.InvalidArg("Invalid number of addresses of staticHost: %s", staticHost.Host)
+				}
+				for _, addr := range staticHost.Addresses {
+					if net.ParseIP(addr) == nil {
+						return grpcutils.InvalidArg("Invalid staticHost address: %s", addr)
+					}
+				}
+			}
+
+			if resolverCfg.CacheTTL != nil {
+				if err := apivalidation.ValidateDuration(resolverCfg.CacheTTL); err != nil {
+					return err
+				}
+			}
+		}
+
+		if cfg.GetHttp().Capture != nil {
+			captureCfg := cfg.GetHttp().Capture
+			if captureCfg.SampleRate < 0 || captureCfg.SampleRate > 1 {
+				return grpcutils.InvalidArg("Capture sampleRate must be between 0 and 1")
+			}
+			if captureCfg.MaxBodySize > 1024*1024 {
+				return grpcutils.InvalidArg("Capture maxBodySize must not exceed 1MiB")
+			}
+			if captureCfg.MaxEntries > 1000 {
+				return grpcutils.InvalidArg("Capture maxEntries must not exceed 1000")
+			}
+		}
+
+		if cfg.GetHttp().FaultInjection != nil {
+			faultCfg := cfg.GetHttp().FaultInjection
+			if faultCfg.Delay != nil {
+				if faultCfg.Delay.Duration == nil {
+					return grpcutils.InvalidArg("FaultInjection delay duration must be set")
+				}
+				if err := apivalidation.ValidateDuration(faultCfg.Delay.Duration); err != nil {
+					return err
+				}
+				if umetav1.ToDuration(faultCfg.Delay.Duration).ToGo() > 5*time.Minute {
+					return grpcutils.InvalidArg("FaultInjection delay duration must not exceed 5 minutes")
+				}
+				if faultCfg.Delay.SampleRate < 0 || faultCfg.Delay.SampleRate > 1 {
+					return grpcutils.InvalidArg("FaultInjection delay sampleRate must be between 0 and 1")
+				}
+			}
+			if faultCfg.Abort != nil {
+				if faultCfg.Abort.StatusCode != 0 &&
+					(faultCfg.Abort.StatusCode < 200 || faultCfg.Abort.StatusCode > 599) {
+					return grpcutils.InvalidArg("FaultInjection abort statusCode must be between 200 and 599")
+				}
+				if faultCfg.Abort.GrpcCode > 16 {
+					return grpcutils.InvalidArg("FaultInjection abort grpcCode is invalid")
+				}
+				if faultCfg.Abort.SampleRate < 0 || faultCfg.Abort.SampleRate > 1 {
+					return grpcutils.InvalidArg("FaultInjection abort sampleRate must be between 0 and 1")
+				}
+			}
+		}
+
+		if cfg.GetHttp().Socket != nil {
+			socketCfg := cfg.GetHttp().Socket
+			for _, size := range []uint32{socketCfg.SendBufferSize, socketCfg.ReceiveBufferSize} {
+				if size != 0 && (size < 4*1024 || size > 64*1024*1024) {
+					return grpcutils.InvalidArg("Socket buffer sizes must be between 4KiB and 64MiB")
+				}
+			}
+
+			if keepalive := socketCfg.Keepalive; keepalive != nil {
+				for _, d := range []*metav1.Duration{keepalive.Idle, keepalive.Interval} {
+					if d == nil {
+						continue
+					}
+					if err := apivalidation.ValidateDuration(d); err != nil {
+						return err
+					}
+					if umetav1.ToDuration(d).ToGo() < time.Second ||
+						umetav1.ToDuration(d).ToGo() > 32767*time.Second {
+						return grpcutils.InvalidArg("Socket keepalive durations must be between 1s and 32767s")
+					}
+				}
+				if keepalive.Count > 127 {
+					return grpcutils.InvalidArg("Socket keepalive count must not exceed 127")
+				}
+			}
+		}
+
+		if cfg.GetHttp().Grpc != nil {
+			grpcCfg := cfg.GetHttp().Grpc
+			if spec.Mode != corev1.Service_Spec_GRPC {
+				return grpcutils.InvalidArg("gRPC config can only be used in GRPC mode")
+			}
+
+			if len(grpcCfg.AllowedEncodings) > 8 {
+				return grpcutils.InvalidArg("Too many gRPC allowedEncodings")
+			}
+			for _, enc := range grpcCfg.AllowedEncodings {
+				if err := s.validateGenStr(enc, true, "allowedEncoding"); err != nil {
+					return err
+				}
+			}
+		}
+
+		if cfg.GetHttp().ProtocolDetection != nil && cfg.GetHttp().ProtocolDetection.Ttl != nil {
+			if err := apivalidation.ValidateDuration(cfg.GetHttp().ProtocolDetection.Ttl); err != nil {
+				return err
+			}
+		}
+
+		if cfg.GetHttp().UpstreamUnavailable != nil {
+			unavailableCfg := cfg.GetHttp().UpstreamUnavailable
+			if unavailableCfg.StatusCode != 0 && (unavailableCfg.StatusCode < 400 || unavailableCfg.StatusCode > 599) {
+				return grpcutils.InvalidArg("Invalid UpstreamUnavailable statusCode: %d", unavailableCfg.StatusCode)
+			}
+			if unavailableCfg.RetryAfter != nil {
+				if err := apivalidation.ValidateDuration(unavailableCfg.RetryAfter); err != nil {
+					return err
+				}
+				if umetav1.ToDuration(unavailableCfg.RetryAfter).ToGo() > time.Hour {
+					return grpcutils.InvalidArg("UpstreamUnavailable retryAfter must not exceed 1h")
+				}
+			}
+		}
+
+		if limitResp := cfg.GetHttp().GetLimitResponse().GetRateLimited(); limitResp != nil {
+			if len(limitResp.Body) > 50000 {
+				return grpcutils.InvalidArg("LimitResponse body is too large")
+			}
+			if err := s.validateGenStr(limitResp.ContentType, false, "contentType"); err != nil {
+				return err
+			}
+			for k, v := range limitResp.Headers {
+				if err := s.validateGenStr(k, true, "key"); err != nil {
+					return err
+				}
+				if err := s.validateGenStr(v, true, "value"); err != nil {
+					return err
+				}
+			}
+			if limitResp.RetryAfter != nil {
+				if err := apivalidation.ValidateDuration(limitResp.RetryAfter); err != nil {
+					return err
+				}
+				if umetav1.ToDuration(limitResp.RetryAfter).ToGo() > time.Hour {
+					return grpcutils.InvalidArg("LimitResponse retryAfter must not exceed 1h")
+				}
+			}
+		}
+
+		if resumptionCfg := cfg.GetHttp().GetListenerTLS().GetSessionResumption(); resumptionCfg != nil {
+			if resumptionCfg.CacheSize > 1000000 {
+				return grpcutils.InvalidArg("SessionResumption cacheSize is too high")
+			}
+			if resumptionCfg.TicketKey != nil {
+				if resumptionCfg.DisableTickets || resumptionCfg.CacheSize > 0 {
+					return grpcutils.InvalidArg("SessionResumption ticketKey cannot be used with disableTickets or cacheSize")
+				}
+				if err := s.validateSecretOwner(ctx, resumptionCfg.TicketKey); err != nil {
+					return err
+				}
+				if resumptionCfg.TicketKey.RotationInterval != nil {
+					if err := apivalidation.ValidateDuration(resumptionCfg.TicketKey.RotationInterval); err != nil {
+						return err
+					}
+					interval := umetav1.ToDuration(resumptionCfg.TicketKey.RotationInterval).ToGo()
+					if interval != 0 && (interval < time.Minute || interval > 7*24*time.Hour) {
+						return grpcutils.InvalidArg("SessionResumption rotationInterval must be between 1m and 7d")
+					}
+				}
+			}
+		}
+
+		if cfg.GetHttp().ClientLimit != nil {
+			limitCfg := cfg.GetHttp().ClientLimit
+			if limitCfg.StatusCode != 0 && (limitCfg.StatusCode < 400 || limitCfg.StatusCode > 599) {
+				return grpcutils.InvalidArg("Invalid ClientLimit statusCode: %d", limitCfg.StatusCode)
+			}
+		}
+
+		if buffering := cfg.GetHttp().ResponseBuffering; buffering != nil && buffering.MaxSize > 64*1024*1024 {
+			return grpcutils.InvalidArg("ResponseBuffering maxSize must not exceed 64MiB")
+		}
+
+		if readTimeout := cfg.GetHttp().ReadTimeout; readTimeout != nil {
+			if readTimeout.Header != nil {
+				if err := apivalidation.ValidateDuration(readTimeout.Header); err != nil {
+					return err
+				}
+			}
+			if readTimeout.BodyIdle != nil {
+				if err := apivalidation.ValidateDuration(readTimeout.BodyIdle); err != nil {
+					return err
+				}
+			}
+		}
+
+		if contentTypeCfg := cfg.GetHttp().ResponseContentType; contentTypeCfg != nil {
+			if len(contentTypeCfg.Allowed) > 64 {
+				return grpcutils.InvalidArg("Too many responseContentType allowed types")
+			}
+			for _, contentType := range contentTypeCfg.Allowed {
+				typ, subtype, ok := strings.Cut(contentType, "/")
+				if !ok || typ == "" || subtype == "" || len(contentType) > 128 {
+					return grpcutils.InvalidArg("Invalid responseContentType allowed type: %s", contentType)
+				}
+			}
+			if contentTypeCfg.Override != "" {
+				if _, _, err := mime.ParseMediaType(contentTypeCfg.Override); err != nil || len(contentTypeCfg.Override) > 128 {
+					return grpcutils.InvalidArg("Invalid responseContentType override: %s", contentTypeCfg.Override)
+				}
+			}
+			if contentTypeCfg.StatusCode != 0 && (contentTypeCfg.StatusCode < 400 || contentTypeCfg.StatusCode > 599) {
+				return grpcutils.InvalidArg("Invalid responseContentType statusCode: %d", contentTypeCfg.StatusCode)
+			}
+		}
+
+		if etag := cfg.GetHttp().Etag; etag != nil && etag.MaxSize > 64*1024*1024 {
+			return grpcutils.InvalidArg("ETag maxSize must not exceed 64MiB")
+		}
+
+		if uriCfg := cfg.GetHttp().Uri; uriCfg != nil {
+			if uriCfg.MaxLength > 1024*1024 || uriCfg.MaxQueryLength > 1024*1024 {
+				return grpcutils.InvalidArg("URI maxLength and maxQueryLength must not exceed 1MiB")
+			}
+		}
+
+		if byteQuota := cfg.GetHttp().ByteQuota; byteQuota != nil && byteQuota.Window != nil {
+			if err := apivalidation.ValidateDuration(byteQuota.Window); err != nil {
+				return err
+			}
+		}
+
+		if limitCfg := cfg.GetHttp().HandshakeLimit; limitCfg != nil {
+			if limitCfg.MaxRate > 1000000 || limitCfg.Burst > 1000000 {
+				return grpcutils.InvalidArg("HandshakeLimit maxRate and burst must not exceed 1000000")
+			}
+			if limitCfg.Burst > 0 && limitCfg.MaxRate == 0 {
+				return grpcutils.InvalidArg("HandshakeLimit maxRate must be set with burst")
+			}
+		}
+
+		if err := validateHTTPFlush(cfg.GetHttp().Flush); err != nil {
+			return err
+		}
+
+		if cfg.GetHttp().Retry != nil && cfg.GetHttp().Retry.Budget != nil {
+			budgetC := cfg.GetHttp().Retry.Budget
+			if budgetC.Percent > 100 {
+				return grpcutils.InvalidArg("Retry budget percent must not exceed 100")
+			}
+			if budgetC.Window != nil {
+				if err := apivalidation.ValidateDuration(budgetC.Window); err != nil {
+					return err
+				}
+			}
+		}
+
+		if cfg.GetHttp().ClientKeepAlive != nil {
+			keepAliveC := cfg.GetHttp().ClientKeepAlive
+			if keepAliveC.IdleTimeout != nil {
+				if err := apivalidation.ValidateDuration(keepAliveC.IdleTimeout); err != nil {
+					return err
+				}
+			}
+			for _, code := range keepAliveC.CloseOnStatusCodes {
+				if code < 200 || code > 599 {
+					return grpcutils.InvalidArg("Invalid closeOnStatusCodes status code: %d", code)
+				}
+			}
+		}
+
+		if cfg.GetHttp().Alpn != nil &&
+			cfg.GetHttp().Alpn.Mode == corev1.Service_Spec_Config_HTTP_ALPN_HTTP1_ONLY &&
+			spec.Mode == corev1.Service_Spec_GRPC {
+			return grpcutils.InvalidArg("HTTP1_ONLY ALPN mode cannot be used in GRPC mode")
+		}
+
+		if cfg.GetHttp().UserAgent != nil {
+			uaC := cfg.GetHttp().UserAgent
+			switch uaC.Mode {
+			case corev1.Service_Spec_Config_HTTP_UserAgent_SET,
+				corev1.Service_Spec_Config_HTTP_UserAgent_APPEND:
+				if err := s.validateGenStr(uaC.Value, true, "userAgent.value"); err != nil {
+					return err
+				}
+			default:
+				if uaC.Value != "" {
+					return grpcutils.InvalidArg("userAgent value is only used by the SET and APPEND modes")
+				}
+			}
+		}
+
+		if cfg.GetHttp().DebugEcho != nil {
+			echoC := cfg.GetHttp().DebugEcho
+			if echoC.IsEnabled && echoC.Condition == nil {
+				return grpcutils.InvalidArg("DebugEcho condition must be set")
+			}
+			if echoC.Condition != nil {
+				if err := s.validateCondition(ctx, echoC.Condition); err != nil {
+					return err
+				}
+			}
+			if err := s.validateGenStr(echoC.Header, false, "header"); err != nil {
+				return err
+			}
+			if err := s.validateGenStr(echoC.QueryParam, false, "queryParam"); err != nil {
+				return err
+			}
+			if len(echoC.Headers) > 32 {
+				return grpcutils.InvalidArg("Too many DebugEcho headers")
+			}
+			for _, hdr := range echoC.Headers {
+				if err := s.validateGenStr(hdr, true, "header"); err != nil {
+					return err
+				}
+			}
+		}
+
+		if cfg.GetHttp().FairQueue != nil {
+			queueC := cfg.GetHttp().FairQueue
+			if queueC.MaxQueueSize > 10000 {
+				return grpcutils.InvalidArg("FairQueue maxQueueSize must not exceed 10000")
+			}
+			if queueC.MaxConcurrentRequests == 0 && (queueC.MaxQueueSize > 0 || queueC.MaxWait != nil) {
+				return grpcutils.InvalidArg("FairQueue maxConcurrentRequests must be set for the fair queue to be enabled")
+			}
+			if queueC.MaxWait != nil {
+				if err := apivalidation.ValidateDuration(queueC.MaxWait); err != nil {
+					return err
+				}
+			}
+
+			if priority := queueC.Priority; priority != nil {
+				if priority.Key == nil {
+					return grpcutils.InvalidArg("FairQueue priority key must be set")
+				}
+				switch priority.Key.Type.(type) {
+				case *corev1.Service_Spec_Config_HTTP_FairQueue_Priority_Key_Header:
+					if err := s.validateGenStr(priority.Key.GetHeader(), true, "header"); err != nil {
+						return err
+					}
+				case *corev1.Service_Spec_Config_HTTP_FairQueue_Priority_Key_Eval:
+					if err := checkCELExpression(ctx, priority.Key.GetEval()); err != nil {
+						return err
+					}
+				default:
+					return grpcutils.InvalidArg("Invalid FairQueue priority key type")
+				}
+
+				if len(priority.Bands) == 0 || len(priority.Bands) > 8 {
+					return grpcutils.InvalidArg("Invalid number of FairQueue priority bands")
+				}
+
+				var names []string
+				var values []string
+				for _, band := range priority.Bands {
+					if err := s.validateGenStr(band.Name, true, "name"); err != nil {
+						return err
+					}
+					if slices.Contains(names, band.Name) {
+						return grpcutils.InvalidArg("Duplicate FairQueue priority band: %s", band.Name)
+					}
+					names = append(names, band.Name)
+
+					if len(band.Values) > 256 {
+						return grpcutils.InvalidArg("Too many FairQueue priority band values")
+					}
+					for _, val := range band.Values {
+						if err := s.validateGenStr(val, true, "value"); err != nil {
+							return err
+						}
+						if slices.Contains(values, val) {
+							return grpcutils.InvalidArg("Duplicate FairQueue priority value: %s", val)
+						}
+						values = append(values, val)
+					}
+				}
+
+				if priority.DefaultBand != "" && !slices.Contains(names, priority.DefaultBand) {
+					return grpcutils.InvalidArg("FairQueue priority band %s does not exist", priority.DefaultBand)
+				}
+			}
+		}
+
+		if cfg.GetHttp().CertificateMonitoring != nil &&
+			cfg.GetHttp().CertificateMonitoring.ExpiryWarning != nil {
+			if err := apivalidation.ValidateDuration(cfg.GetHttp().CertificateMonitoring.ExpiryWarning); err != nil {
+				return err
+			}
+		}
+
+		if cfg.GetHttp().FanOut != nil {
+			fanOutCfg := cfg.GetHttp().FanOut
+			if fanOutCfg.MaxParallel > 8 {
+				return grpcutils.InvalidArg("FanOut maxParallel must not exceed 8")
+			}
+			if len(fanOutCfg.Regions) > 7 {
+				return grpcutils.InvalidArg("Too many FanOut regions")
+			}
+			if fanOutCfg.IsEnabled && len(fanOutCfg.Regions) == 0 {
+				return grpcutils.InvalidArg("FanOut requires at least one region once enabled")
+			}
+			for _, region := range fanOutCfg.Regions {
+				if err := s.validateGenStr(region.Name, true, "name"); err != nil {
+					return err
+				}
+				u, err := url.Parse(region.Url)
+				if err != nil || u.Hostname() == "" {
+					return grpcutils.InvalidArg("Invalid FanOut region URL: %s", region.Url)
+				}
+				switch u.Scheme {
+				case "http", "https":
+				default:
+					return grpcutils.InvalidArg("FanOut region URL scheme must be http or https: %s", region.Url)
+				}
+			}
+		}
+
+		if cfg.GetHttp().StreamTransform != nil {
+			transformCfg := cfg.GetHttp().StreamTransform
+			if len(transformCfg.Rules) > 16 {
+				return grpcutils.InvalidArg("Too many StreamTransform rules")
+			}
+			if transformCfg.MaxLineSize > 16*1024*1024 {
+				return grpcutils.InvalidArg("StreamTransform maxLineSize must not exceed 16MiB")
+			}
+			for _, rule := range transformCfg.Rules {
+				for _, contentType := range rule.ContentTypes {
+					if err := s.validateGenStr(contentType, true, "contentType"); err != nil {
+						return err
+					}
+				}
+
+				switch rule.Type.(type) {
+				case *corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_LineFilter_:
+					filter := rule.GetLineFilter()
+					for _, pattern := range append(slices.Clone(filter.Include), filter.Exclude...) {
+						if _, err := regexp.Compile(pattern); err != nil {
+							return grpcutils.InvalidArg("Invalid StreamTransform lineFilter regexp: %s", pattern)
+						}
+					}
+				case *corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_NdjsonRedact:
+					if len(rule.GetNdjsonRedact().Fields) == 0 {
+						return grpcutils.InvalidArg("StreamTransform ndjsonRedact fields must be set")
+					}
+					for _, field := range rule.GetNdjsonRedact().Fields {
+						if err := s.validateGenStr(field, true, "field"); err != nil {
+							return err
+						}
+					}
+				default:
+					return grpcutils.InvalidArg("StreamTransform rule type must be set")
+				}
+			}
+		}
+
+		if filterCfg := cfg.GetHttp().RequestFilter; filterCfg != nil {
+			if len(filterCfg.Rules) > 64 {
+				return grpcutils.InvalidArg("Too many requestFilter rules")
+			}
+			for _, rule := range filterCfg.Rules {
+				if err := s.validateGenStr(rule.Name, true, "name"); err != nil {
+					return err
+				}
+				if rule.Target == corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_TARGET_UNSET {
+					return grpcutils.InvalidArg("requestFilter rule %s target must be set", rule.Name)
+				}
+				if err := s.validateGenStr(rule.Header, false, "header"); err != nil {
+					return err
+				}
+				if len(rule.Pattern) == 0 || len(rule.Pattern) > 1024 {
+					return grpcutils.InvalidArg("Invalid requestFilter rule %s pattern", rule.Name)
+				}
+				if _, err := regexp.Compile(rule.Pattern); err != nil {
+					return grpcutils.InvalidArg("Invalid requestFilter rule regexp: %s", rule.Pattern)
+				}
+			}
+		}
+
+		if optionsCfg := cfg.GetHttp().Options; optionsCfg != nil {
+			if len(optionsCfg.Methods) > 32 {
+				return grpcutils.InvalidArg("Too many options methods")
+			}
+			for _, method := range optionsCfg.Methods {
+				if err := s.validateGenStr(method, true, "method"); err != nil {
+					return err
+				}
+			}
+			if len(optionsCfg.Routes) > 64 {
+				return grpcutils.InvalidArg("Too many options routes")
+			}
+			for _, route := range optionsCfg.Routes {
+				if err := s.validateGenStr(route.PathPrefix, true, "pathPrefix"); err != nil {
+					return err
+				}
+				if len(route.Methods) > 32 {
+					return grpcutils.InvalidArg("Too many options route methods")
+				}
+				for _, method := range route.Methods {
+					if err := s.validateGenStr(method, true, "method"); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if cfg.GetHttp().HeaderRouting != nil {
+			routing := cfg.GetHttp().HeaderRouting
+			if routing.Key == nil {
+				return grpcutils.InvalidArg("HeaderRouting key must be set")
+			}
+			switch routing.Key.Type.(type) {
+			case *corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_Header:
+				if err := s.validateGenStr(routing.Key.GetHeader(), true, "header"); err != nil {
+					return err
+				}
+			case *corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_JwtClaim:
+				jwtClaim := routing.Key.GetJwtClaim()
+				if err := s.validateGenStr(jwtClaim.Header, false, "header"); err != nil {
+					return err
+				}
+				if err := s.validateGenStr(jwtClaim.Claim, true, "claim"); err != nil {
+					return err
+				}
+			case *corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_Eval:
+				if err := checkCELExpression(ctx, routing.Key.GetEval()); err != nil {
+					return err
+				}
+			default:
+				return grpcutils.InvalidArg("Invalid HeaderRouting key type")
+			}
+
+			if len(routing.Routes) > 256 {
+				return grpcutils.InvalidArg("Too many HeaderRouting routes")
+			}
+
+			checkCfgName := func(name string) error {
+				switch name {
+				case "default", "":
+				default:
+					if !slices.Contains(cfgNames, name) {
+						return grpcutils.InvalidArg("HeaderRouting config %s does not exist", name)
+					}
+				}
+				return nil
+			}
+
+			var values []string
+			for _, route := range routing.Routes {
+				if len(route.Values) == 0 || len(route.Values) > 256 {
+					return grpcutils.InvalidArg("Invalid number of HeaderRouting route values")
+				}
+				for _, val := range route.Values {
+					if err := s.validateGenStr(val, true, "value"); err != nil {
+						return err
+					}
+					if slices.Contains(values, val) {
+						return grpcutils.InvalidArg("Duplicate HeaderRouting route value: %s", val)
+					}
+					values = append(values, val)
+				}
+				if err := checkCfgName(route.ConfigName); err != nil {
+					return err
+				}
+			}
+
+			if err := checkCfgName(routing.DefaultConfigName); err != nil {
+				return err
+			}
+
+			if routing.StatusCode != 0 && (routing.StatusCode < 400 || routing.StatusCode > 599) {
+				return grpcutils.InvalidArg("Invalid HeaderRouting statusCode: %d", routing.StatusCode)
+			}
+		}
+
+		if cfg.GetHttp().Split != nil {
+			split := cfg.GetHttp().Split
+			if len(split.Variants) == 0 {
+				return grpcutils.InvalidArg("Split variants must be set")
+			}
+			if len(split.Variants) > 32 {
+				return grpcutils.InvalidArg("Too many split variants")
+			}
+
+			var totalWeight uint64
+			var variantNames []string
+			for _, variant := range split.Variants {
+				if err := apivalidation.ValidateName(variant.Name, 0, 0); err != nil {
+					return err
+				}
+				if slices.Contains(variantNames, variant.Name) {
+					return grpcutils.InvalidArg("Duplicate split variant name: %s", variant.Name)
+				}
+				variantNames = append(variantNames, variant.Name)
+
+				if variant.Weight > 10000 {
+					return grpcutils.InvalidArg("Invalid split variant weight: %d", variant.Weight)
+				}
+				totalWeight += uint64(variant.Weight)
+
+				switch variant.ConfigName {
+				case "default", "":
+				default:
+					if !slices.Contains(cfgNames, variant.ConfigName) {
+						return grpcutils.InvalidArg("Split variant config %s does not exist", variant.ConfigName)
+					}
+				}
+			}
+
+			if totalWeight == 0 {
+				return grpcutils.InvalidArg("Split variant weights must not all be zero")
+			}
+
+			if split.Cookie != nil {
+				if err := s.validateGenStr(split.Cookie.Name, false, "name"); err != nil {
+					return err
+				}
+				if err := s.validateGenStr(split.Cookie.Domain, false, "domain"); err != nil {
+					return err
+				}
+				if err := s.validateGenStr(split.Cookie.Path, false, "path"); err != nil {
+					return err
+				}
+				if split.Cookie.MaxAge != nil {
+					if err := apivalidation.ValidateDuration(split.Cookie.MaxAge); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := s.validateGenStr(split.Header, false, "header"); err != nil {
+				return err
+			}
+		}
+
+		if cfg.GetHttp().MethodOverride != nil {
+			methodOverride := cfg.GetHttp().MethodOverride
+			if len(methodOverride.AllowedMethods) > 8 {
+				return grpcutils.InvalidArg("Too many methodOverride allowedMethods")
+			}
+
+			for _, method := range methodOverride.AllowedMethods {
+				switch strings.ToUpper(method) {
+				// Overriding to a safe method would let a POST request be
+				// treated as one, e.g. by the policies and the cache.
+				case "PUT", "PATCH", "DELETE":
+				default:
+					return grpcutils.InvalidArg("Invalid methodOverride allowed method: %s", method)
+				}
+			}
+		}
+
+		if cfg.GetHttp().Timeout != nil {
+			timeout := cfg.GetHttp().Timeout
+			if umetav1.ToDuration(timeout.Max).ToGo() < 0 {
+				return grpcutils.InvalidArg("Invalid timeout max duration")
+			}
+
+			for _, d := range []*metav1.Duration{timeout.Connect, timeout.TlsHandshake} {
+				if d == nil {
+					continue
+				}
+				if err := apivalidation.ValidateDuration(d); err != nil {
+					return err
+				}
+			}
+
+			if timeout.ClientTimeout != nil && timeout.ClientTimeout.Header != "" {
+				if err := s.validateGenStr(timeout.ClientTimeout.Header, true, "header"); err != nil {
+					return err
+				}
+			}
+		}
+
+	case *corev1.Service_Spec_Config_Kubernetes_:
+		if spec.Mode != corev1.Service_Spec_KUBERNETES {
+			return grpcutils.InvalidArg("KUBERNETES mode must be set for KUBERNETES config to be used")
+		}
+
+		k8s := cfg.GetKubernetes()
+
+		switch k8s.Type.(type) {
+		case *corev1.Service_Spec_Config_Kubernetes_Kubeconfig_:
+			if k8s.GetKubeconfig().GetFromSecret() == "" {
+				return serr.InvalidArg("Kubeconfig secret name must be set")
+			}
+			sec, err := octeliumC.CoreC().GetSecret(ctx, &rmetav1.GetOptions{Name: k8s.GetKubeconfig().GetFromSecret()})
+			if err != nil {
+				if grpcerr.IsNotFound(err) {
+					return serr.InvalidArg("The Secret %s does not exist", k8s.GetKubeconfig().GetFromSecret())
+				}
+				return serr.InternalWithErr(err)
+			}
+
+			kubeconfig, err := k8sutils.UnmarshalKubeConfigFromYAML(ucorev1.ToSecret(sec).GetValueBytes())
+			if err != nil {
+				return serr.InvalidArg("Could not parse Kubeconfig form the Secret: %s", k8s.GetKubeconfig().GetFromSecret())
+			}
+
+			if clstr := kubeconfig.GetCluster(k8s.GetKubeconfig().Context); clstr == nil {
+				return serr.InvalidArg("No Cluster found in the Kubeconfig")
+			}
+
+			if usr := kubeconfig.GetUser(k8s.GetKubeconfig().Context); usr == nil {
+				return serr.InvalidArg("No User found in the Kubeconfig")
+			}
+
+		case *corev1.Service_Spec_Config_Kubernetes_ClientCertificate:
+			if err := s.validateSecretOwner(ctx, k8s.GetClientCertificate()); err != nil {
+				return err
+			}
+		case *corev1.Service_Spec_Config_Kubernetes_BearerToken_:
+
+			if err := s.validateSecretOwner(ctx, k8s.GetBearerToken()); err != nil {
+				return err
+			}
+
+		default:
+			return serr.InvalidArg("Unsupported kubernetes config type")
+		}
+
+	case *corev1.Service_Spec_Config_Ssh:
+		if spec.Mode != corev1.Service_Spec_SSH {
+			return grpcutils.InvalidArg("SSH mode must be set for SSH config to be used")
+		}
+		inSSH := cfg.GetSsh()
+
+		if inSSH.Auth != nil {
+			switch inSSH.Auth.Type.(type) {
+			case *corev1.Service_Spec_Config_SSH_Auth_Password_:
+				if err := s.validateSecretOwner(ctx, inSSH.Auth.GetPassword()); err != nil {
+					return err
+				}
+			case *corev1.Service_Spec_Config_SSH_Auth_PrivateKey_:
+				if err := s.validateSecretOwner(ctx, inSSH.Auth.GetPrivateKey()); err != nil {
+					return err
+				}
+			}
+		}
+
+	case *corev1.Service_Spec_Config_Postgres_:
+		if spec.Mode != corev1.Service_Spec_POSTGRES {
+			return grpcutils.InvalidArg("POSTGRES mode must be set for PostgreSQL config to be used")
+		}
+
+		pg := cfg.GetPostgres()
+
+		if pg.User != "" {
+			if err := apivalidation.ValidateGenASCII(pg.User); err != nil {
 				return err
 			}
 		}
@@ -1423,6 +2607,18 @@ func (s *Server) validateServiceConfig(ctx context.Context,
 				return err
 			}
 		}
+	case *corev1.Service_Spec_Config_Tcp:
+		if spec.Mode != corev1.Service_Spec_TCP {
+			return grpcutils.InvalidArg("TCP mode must be set for TCP config to be used")
+		}
+
+		tcp := cfg.GetTcp()
+		if d := umetav1.ToDuration(tcp.IdleTimeout).ToGo(); d != 0 && d < time.Second {
+			return grpcutils.InvalidArg("TCP idleTimeout must be at least 1 second")
+		}
+		if d := umetav1.ToDuration(tcp.MaxDuration).ToGo(); d != 0 && d < time.Second {
+			return grpcutils.InvalidArg("TCP maxDuration must be at least 1 second")
+		}
 	}
 
 	return nil
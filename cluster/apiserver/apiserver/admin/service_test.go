@@ -933,6 +933,134 @@ func TestValidateService(t *testing.T) {
 	}
 }
 
+func TestValidateServiceConfigConflicts(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+	srv := newFakeServer(tst.C)
+
+	getSvc := func(upstreamURL string, httpCfg *corev1.Service_Spec_Config_HTTP) *corev1.Service {
+		ret := &corev1.Service{
+			Metadata: &metav1.Metadata{Name: "svc.ns1"},
+			Spec: &corev1.Service_Spec{
+				Mode: corev1.Service_Spec_HTTP,
+				Config: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: httpCfg,
+					},
+				},
+			},
+			Status: &corev1.Service_Status{},
+		}
+		if upstreamURL != "" {
+			ret.Spec.Config.Upstream = &corev1.Service_Spec_Config_Upstream{
+				Type: &corev1.Service_Spec_Config_Upstream_Url{
+					Url: upstreamURL,
+				},
+			}
+		}
+		return ret
+	}
+
+	directResponse := &corev1.Service_Spec_Config_HTTP_Response{
+		Type: &corev1.Service_Spec_Config_HTTP_Response_Direct_{
+			Direct: &corev1.Service_Spec_Config_HTTP_Response_Direct{
+				Type: &corev1.Service_Spec_Config_HTTP_Response_Direct_Inline{
+					Inline: "hello",
+				},
+			},
+		},
+	}
+
+	invalidSvcs := []*corev1.Service{
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			Response: directResponse,
+		}),
+		getSvc("", &corev1.Service_Spec_Config_HTTP{
+			Response: directResponse,
+			FanOut: &corev1.Service_Spec_Config_HTTP_FanOut{
+				IsEnabled: true,
+				Regions: []*corev1.Service_Spec_Config_HTTP_FanOut_Region{
+					{
+						Name: "region-1",
+						Url:  "https://region-1.example.com",
+					},
+				},
+			},
+		}),
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			FanOut: &corev1.Service_Spec_Config_HTTP_FanOut{
+				IsEnabled: true,
+			},
+		}),
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			FairQueue: &corev1.Service_Spec_Config_HTTP_FairQueue{
+				MaxQueueSize: 10,
+			},
+		}),
+		getSvc("wss://example.com", &corev1.Service_Spec_Config_HTTP{
+			IsUpstreamHTTP2: true,
+		}),
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			MethodOverride: &corev1.Service_Spec_Config_HTTP_MethodOverride{
+				IsEnabled:      true,
+				AllowedMethods: []string{"PUT", "GET"},
+			},
+		}),
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			ForwardProxy: &corev1.Service_Spec_Config_HTTP_ForwardProxy{
+				IsEnabled:    true,
+				AllowedHosts: []string{"*.example.com"},
+				AllowedCIDRs: []string{"10.0.0.1"},
+			},
+		}),
+	}
+
+	for _, svc := range invalidSvcs {
+		err := srv.validateService(ctx, svc)
+		assert.NotNil(t, err, "%+v", svc)
+		assert.True(t, grpcerr.IsInvalidArg(err), "%+v", err)
+	}
+
+	validSvcs := []*corev1.Service{
+		getSvc("", &corev1.Service_Spec_Config_HTTP{
+			Response: directResponse,
+		}),
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			FairQueue: &corev1.Service_Spec_Config_HTTP_FairQueue{
+				MaxConcurrentRequests: 10,
+				MaxQueueSize:          10,
+			},
+		}),
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			IsUpstreamHTTP2: true,
+		}),
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			MethodOverride: &corev1.Service_Spec_Config_HTTP_MethodOverride{
+				IsEnabled:      true,
+				AllowedMethods: []string{"PUT", "delete"},
+			},
+		}),
+		getSvc("https://example.com", &corev1.Service_Spec_Config_HTTP{
+			ForwardProxy: &corev1.Service_Spec_Config_HTTP_ForwardProxy{
+				IsEnabled:    true,
+				AllowedHosts: []string{"*.example.com"},
+				AllowedCIDRs: []string{"10.0.0.0/24", "fd00::/64"},
+			},
+		}),
+	}
+
+	for _, svc := range validSvcs {
+		err := srv.validateService(ctx, svc)
+		assert.Nil(t, err, "%+v", err)
+	}
+}
+
 func TestEmbedded(t *testing.T) {
 
 	ctx := context.Background()
@@ -1522,3 +1650,42 @@ func TestServiceHostUser(t *testing.T) {
 		usr.Metadata.Uid,
 		svc.Metadata.SpecLabels[fmt.Sprintf("host-user-%s", usr.Metadata.Name)])
 }
+
+func TestValidateServiceHost(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	valid := []*corev1.Service_Spec_Host{
+		{Type: &corev1.Service_Spec_Host_Exact{Exact: "www.example.com"}},
+		{Type: &corev1.Service_Spec_Host_Wildcard{Wildcard: "*.example.com"}},
+		{Type: &corev1.Service_Spec_Host_Regex{Regex: `api-[0-9]+\.example\.com`}},
+	}
+	for _, host := range valid {
+		assert.Nil(t, validateServiceHost(host, "octelium.example.org"), "%+v", host)
+	}
+
+	invalid := []*corev1.Service_Spec_Host{
+		{},
+		{Type: &corev1.Service_Spec_Host_Exact{Exact: ""}},
+		{Type: &corev1.Service_Spec_Host_Exact{Exact: "*.example.com"}},
+		{Type: &corev1.Service_Spec_Host_Exact{Exact: "www example.com"}},
+		{Type: &corev1.Service_Spec_Host_Wildcard{Wildcard: "example.com"}},
+		{Type: &corev1.Service_Spec_Host_Wildcard{Wildcard: "*.*.example.com"}},
+		{Type: &corev1.Service_Spec_Host_Wildcard{Wildcard: "www.*.example.com"}},
+		{Type: &corev1.Service_Spec_Host_Regex{Regex: ""}},
+		{Type: &corev1.Service_Spec_Host_Regex{Regex: "("}},
+		{Type: &corev1.Service_Spec_Host_Exact{Exact: "octelium.example.org"}},
+		{Type: &corev1.Service_Spec_Host_Exact{Exact: "svc1.octelium.example.org"}},
+		{Type: &corev1.Service_Spec_Host_Exact{Exact: "SVC1.Octelium.Example.org"}},
+		{Type: &corev1.Service_Spec_Host_Wildcard{Wildcard: "*.octelium.example.org"}},
+		{Type: &corev1.Service_Spec_Host_Wildcard{Wildcard: "*.ns1.octelium.example.org"}},
+		{Type: &corev1.Service_Spec_Host_Wildcard{Wildcard: "*.example.org"}},
+	}
+	for _, host := range invalid {
+		assert.NotNil(t, validateServiceHost(host, "octelium.example.org"), "%+v", host)
+	}
+}
@@ -56,6 +56,10 @@ func (s *Server) CreateUser(ctx context.Context, req *corev1.User) (*corev1.User
 		Status:   &corev1.User_Status{},
 	}
 
+	if err := common.InitManagedFields(ctx, item); err != nil {
+		return nil, err
+	}
+
 	if err := s.CheckAndSetUser(ctx, s.octeliumC, item, false); err != nil {
 		return nil, err
 	}
@@ -82,8 +86,9 @@ func (s *Server) UpdateUser(ctx context.Context, req *corev1.User) (*corev1.User
 		return nil, err
 	}
 
-	common.MetadataUpdate(item.Metadata, req.Metadata)
-	item.Spec = req.Spec
+	if err := common.ApplyUpdate(ctx, item, req); err != nil {
+		return nil, err
+	}
 
 	if err := s.CheckAndSetUser(ctx, s.octeliumC, item, false); err != nil {
 		return nil, err
@@ -0,0 +1,184 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package admin
+
+import (
+	"context"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/rsc/rcorev1"
+	"github.com/octelium/octelium/apis/rsc/rmetav1"
+	"github.com/octelium/octelium/cluster/apiserver/apiserver/serr"
+	"github.com/octelium/octelium/cluster/common/grpcutils"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+type watchFn func(c rcorev1.ResourceServiceClient,
+	ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error)
+
+// watchKinds are the kinds that can be watched via the public API. Their
+// events pass through the same rules as their List methods.
+var watchKinds = map[string]watchFn{
+	ucorev1.KindUser: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchUser(ctx, req)
+	},
+	ucorev1.KindGroup: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchGroup(ctx, req)
+	},
+	ucorev1.KindNamespace: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchNamespace(ctx, req)
+	},
+	ucorev1.KindService: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchService(ctx, req)
+	},
+	ucorev1.KindSession: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchSession(ctx, req)
+	},
+	ucorev1.KindSecret: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchSecret(ctx, req)
+	},
+	ucorev1.KindCredential: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchCredential(ctx, req)
+	},
+	ucorev1.KindDevice: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchDevice(ctx, req)
+	},
+	ucorev1.KindConfig: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchConfig(ctx, req)
+	},
+	ucorev1.KindPolicy: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchPolicy(ctx, req)
+	},
+	ucorev1.KindAuthenticator: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchAuthenticator(ctx, req)
+	},
+	ucorev1.KindIdentityProvider: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchIdentityProvider(ctx, req)
+	},
+	ucorev1.KindRegion: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchRegion(ctx, req)
+	},
+	ucorev1.KindGateway: func(c rcorev1.ResourceServiceClient, ctx context.Context, req *rmetav1.WatchOptions) (grpc.ServerStreamingClient[rmetav1.WatchEvent], error) {
+		return c.WatchGateway(ctx, req)
+	},
+}
+
+func getWatchKind(arg string) (string, error) {
+	for kind := range watchKinds {
+		if strings.EqualFold(kind, arg) {
+			return kind, nil
+		}
+	}
+
+	return "", grpcutils.InvalidArg("Cannot watch the kind: %s", arg)
+}
+
+func (s *Server) Watch(req *corev1.WatchOptions, stream grpc.ServerStreamingServer[corev1.WatchEvent]) error {
+	kind, err := getWatchKind(req.Kind)
+	if err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+
+	rscStream, err := watchKinds[kind](s.octeliumC.CoreC(), ctx, &rmetav1.WatchOptions{
+		SkipInitial: req.SkipInitial,
+	})
+	if err != nil {
+		return serr.InternalWithErr(err)
+	}
+
+	for {
+		rscEvent, err := rscStream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return serr.InternalWithErr(err)
+		}
+
+		event, err := getWatchEvent(rscEvent)
+		if err != nil {
+			return serr.InternalWithErr(err)
+		}
+		if event == nil {
+			continue
+		}
+
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+}
+
+// getWatchEvent converts an internal watch event to a public one. It returns
+// nil for the events of the system hidden resources.
+func getWatchEvent(in *rmetav1.WatchEvent) (*corev1.WatchEvent, error) {
+	if in.Event == nil {
+		return nil, nil
+	}
+
+	ret := &corev1.WatchEvent{}
+	var item *anypb.Any
+
+	switch in.Event.Type.(type) {
+	case *rmetav1.WatchEvent_Event_Create_:
+		ret.Type = corev1.WatchEvent_CREATED
+		item = in.Event.GetCreate().Item
+	case *rmetav1.WatchEvent_Event_Update_:
+		ret.Type = corev1.WatchEvent_UPDATED
+		item = in.Event.GetUpdate().NewItem
+	case *rmetav1.WatchEvent_Event_Delete_:
+		ret.Type = corev1.WatchEvent_DELETED
+		item = in.Event.GetDelete().Item
+	default:
+		return nil, nil
+	}
+
+	if item == nil {
+		return nil, nil
+	}
+
+	msg, err := item.UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := msg.(umetav1.ResourceObjectI)
+	if !ok || obj.GetMetadata() == nil || obj.GetMetadata().IsSystemHidden {
+		return nil, nil
+	}
+
+	switch obj := obj.(type) {
+	case *corev1.Secret:
+		obj.Data = nil
+	case *corev1.Config:
+		obj.Data = nil
+	}
+
+	ret.Item, err = pbutils.MessageToAny(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package admin
+
+import (
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/apis/rsc/rmetav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetWatchEvent(t *testing.T) {
+
+	{
+		kind, err := getWatchKind("namespace")
+		assert.Nil(t, err)
+		assert.Equal(t, "Namespace", kind)
+
+		_, err = getWatchKind("PolicyTrigger")
+		assert.NotNil(t, err)
+		_, err = getWatchKind("ClusterConfig")
+		assert.NotNil(t, err)
+	}
+
+	{
+		ns := &corev1.Namespace{
+			Metadata: &metav1.Metadata{
+				Name: "ns1",
+			},
+		}
+
+		res, err := getWatchEvent(&rmetav1.WatchEvent{
+			Event: &rmetav1.WatchEvent_Event{
+				Type: &rmetav1.WatchEvent_Event_Update_{
+					Update: &rmetav1.WatchEvent_Event_Update{
+						NewItem: pbutils.MessageToAnyMust(ns),
+						OldItem: pbutils.MessageToAnyMust(&corev1.Namespace{
+							Metadata: &metav1.Metadata{
+								Name: "old",
+							},
+						}),
+					},
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, corev1.WatchEvent_UPDATED, res.Type)
+
+		item := &corev1.Namespace{}
+		assert.Nil(t, res.Item.UnmarshalTo(item))
+		assert.True(t, pbutils.IsEqual(ns, item))
+	}
+
+	{
+		res, err := getWatchEvent(&rmetav1.WatchEvent{
+			Event: &rmetav1.WatchEvent_Event{
+				Type: &rmetav1.WatchEvent_Event_Create_{
+					Create: &rmetav1.WatchEvent_Event_Create{
+						Item: pbutils.MessageToAnyMust(&corev1.Secret{
+							Metadata: &metav1.Metadata{
+								Name: "sec1",
+							},
+							Data: &corev1.Secret_Data{
+								Type: &corev1.Secret_Data_Value{
+									Value: "secret",
+								},
+							},
+						}),
+					},
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, corev1.WatchEvent_CREATED, res.Type)
+
+		item := &corev1.Secret{}
+		assert.Nil(t, res.Item.UnmarshalTo(item))
+		assert.Equal(t, "sec1", item.Metadata.Name)
+		assert.Nil(t, item.Data)
+	}
+
+	{
+		res, err := getWatchEvent(&rmetav1.WatchEvent{
+			Event: &rmetav1.WatchEvent_Event{
+				Type: &rmetav1.WatchEvent_Event_Delete_{
+					Delete: &rmetav1.WatchEvent_Event_Delete{
+						Item: pbutils.MessageToAnyMust(&corev1.User{
+							Metadata: &metav1.Metadata{
+								Name:           "usr1",
+								IsSystemHidden: true,
+							},
+						}),
+					},
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, res)
+	}
+}
@@ -0,0 +1,466 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/apiserver/apiserver/serr"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type ApplyOptions struct {
+	FieldManager string
+	Force        bool
+}
+
+var rgxFieldManager = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:-]{0,127}$`)
+
+// GetApplyOptions returns the server-side apply options set by the client via
+// the "x-octelium-field-manager" and "x-octelium-force-apply" headers. It
+// returns nil if the request is not a server-side apply.
+func GetApplyOptions(ctx context.Context) (*ApplyOptions, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	managers := md.Get("x-octelium-field-manager")
+	if len(managers) == 0 {
+		return nil, nil
+	}
+
+	if len(managers) != 1 || !rgxFieldManager.MatchString(managers[0]) {
+		return nil, serr.InvalidArg("Invalid field manager")
+	}
+
+	ret := &ApplyOptions{
+		FieldManager: managers[0],
+	}
+
+	if vals := md.Get("x-octelium-force-apply"); len(vals) > 0 {
+		ret.Force = vals[0] == "true"
+	}
+
+	return ret, nil
+}
+
+// InitManagedFields sets the field manager of a server-side apply request as
+// the owner of all the fields of a newly created resource.
+func InitManagedFields(ctx context.Context, item umetav1.ResourceObjectI) error {
+	opts, err := GetApplyOptions(ctx)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		return nil
+	}
+
+	item.GetMetadata().ManagedFields = []*metav1.ManagedField{
+		{
+			Manager:   opts.FieldManager,
+			Fields:    getSortedFieldPaths(getFieldPaths(item)),
+			UpdatedAt: pbutils.Now(),
+		},
+	}
+
+	return nil
+}
+
+// ApplyUpdate updates the Metadata and the Spec of the current item from the
+// request. Ordinary updates replace them as a whole while server-side apply
+// updates only set the fields owned by the field manager and leave the fields
+// owned by other managers intact.
+func ApplyUpdate(ctx context.Context, item, req umetav1.ResourceObjectI) error {
+	opts, err := GetApplyOptions(ctx)
+	if err != nil {
+		return err
+	}
+	if opts != nil {
+		return ServerSideApply(opts, item, req)
+	}
+
+	MetadataUpdate(item.GetMetadata(), req.GetMetadata())
+
+	specFd := item.ProtoReflect().Descriptor().Fields().ByName("spec")
+	if specFd == nil {
+		return serr.Internal("Could not find spec field")
+	}
+	if req.ProtoReflect().Has(specFd) {
+		item.ProtoReflect().Set(specFd, req.ProtoReflect().Get(specFd))
+	} else {
+		item.ProtoReflect().Clear(specFd)
+	}
+
+	pruneManagedFields(item)
+
+	return nil
+}
+
+// ServerSideApply merges the fields set in the request into the current item.
+// Fields previously owned by the field manager and no longer set in the
+// request are removed unless they are also owned by other managers. Changing
+// the value of a field owned by another manager is a conflict that fails the
+// apply unless it is forced, in which case the ownership is transferred.
+func ServerSideApply(opts *ApplyOptions, item, req umetav1.ResourceObjectI) error {
+	applied := getFieldPaths(req)
+
+	owners := make(map[string][]string)
+	prevOwned := make(map[string]struct{})
+	for _, mf := range item.GetMetadata().ManagedFields {
+		for _, f := range mf.Fields {
+			if mf.Manager == opts.FieldManager {
+				prevOwned[f] = struct{}{}
+			} else {
+				owners[f] = append(owners[f], mf.Manager)
+			}
+		}
+	}
+
+	conflicts := make(map[string]struct{})
+	var conflictMsgs []string
+	for _, p := range getSortedFieldPaths(applied) {
+		if len(owners[p]) == 0 {
+			continue
+		}
+
+		curVal, ok := getFieldValue(item.ProtoReflect(), p)
+		if ok {
+			newVal, _ := getFieldValue(req.ProtoReflect(), p)
+			if isValueEqual(curVal, newVal) {
+				continue
+			}
+		}
+
+		conflicts[p] = struct{}{}
+		conflictMsgs = append(conflictMsgs,
+			fmt.Sprintf("%s (owned by %s)", p, strings.Join(owners[p], ", ")))
+	}
+
+	if len(conflicts) > 0 && !opts.Force {
+		return serr.Conflict("Apply conflicts with other field managers: %s. Force the apply to take ownership of these fields",
+			strings.Join(conflictMsgs, "; "))
+	}
+
+	for p := range prevOwned {
+		if _, ok := applied[p]; !ok && len(owners[p]) == 0 {
+			clearFieldValue(item.ProtoReflect(), p)
+		}
+	}
+
+	for p := range applied {
+		setFieldValue(item.ProtoReflect(), req.ProtoReflect(), p)
+	}
+
+	var managedFields []*metav1.ManagedField
+	for _, mf := range item.GetMetadata().ManagedFields {
+		if mf.Manager == opts.FieldManager {
+			continue
+		}
+
+		mf.Fields = slices.DeleteFunc(mf.Fields, func(f string) bool {
+			_, ok := conflicts[f]
+			return ok
+		})
+		if len(mf.Fields) > 0 {
+			managedFields = append(managedFields, mf)
+		}
+	}
+
+	managedFields = append(managedFields, &metav1.ManagedField{
+		Manager:   opts.FieldManager,
+		Fields:    getSortedFieldPaths(applied),
+		UpdatedAt: pbutils.Now(),
+	})
+	item.GetMetadata().ManagedFields = managedFields
+
+	pruneManagedFields(item)
+
+	return nil
+}
+
+// pruneManagedFields removes the ownership of the fields that no longer exist.
+func pruneManagedFields(item umetav1.ResourceObjectI) {
+	md := item.GetMetadata()
+	if len(md.ManagedFields) == 0 {
+		return
+	}
+
+	current := getFieldPaths(item)
+
+	var managedFields []*metav1.ManagedField
+	for _, mf := range md.ManagedFields {
+		mf.Fields = slices.DeleteFunc(mf.Fields, func(f string) bool {
+			_, ok := current[f]
+			return !ok
+		})
+		if len(mf.Fields) > 0 {
+			managedFields = append(managedFields, mf)
+		}
+	}
+
+	md.ManagedFields = managedFields
+}
+
+func getFieldPaths(item umetav1.ResourceObjectI) map[string]struct{} {
+	ret := make(map[string]struct{})
+
+	if md := item.GetMetadata(); md != nil {
+		collectFieldPaths("metadata", (&metav1.Metadata{
+			DisplayName: md.DisplayName,
+			Description: md.Description,
+			Labels:      md.Labels,
+			Annotations: md.Annotations,
+			Tags:        md.Tags,
+			PicURL:      md.PicURL,
+		}).ProtoReflect(), ret)
+	}
+
+	rt := item.ProtoReflect()
+	if specFd := rt.Descriptor().Fields().ByName("spec"); specFd != nil && rt.Has(specFd) {
+		n := len(ret)
+		collectFieldPaths("spec", rt.Get(specFd).Message(), ret)
+		if len(ret) == n {
+			ret["spec"] = struct{}{}
+		}
+	}
+
+	return ret
+}
+
+func getSortedFieldPaths(paths map[string]struct{}) []string {
+	ret := make([]string, 0, len(paths))
+	for p := range paths {
+		ret = append(ret, p)
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// collectFieldPaths adds the paths of all the set leaf fields of the message.
+// Lists and non-string keyed maps are owned atomically whereas entries of
+// string keyed maps are owned individually.
+func collectFieldPaths(prefix string, m protoreflect.Message, ret map[string]struct{}) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		path := fmt.Sprintf("%s.%s", prefix, fd.JSONName())
+
+		switch {
+		case fd.IsMap():
+			if fd.MapKey().Kind() != protoreflect.StringKind {
+				ret[path] = struct{}{}
+				return true
+			}
+			v.Map().Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+				ret[fmt.Sprintf("%s[%s]", path, k.String())] = struct{}{}
+				return true
+			})
+		case fd.IsList():
+			ret[path] = struct{}{}
+		case isMessageField(fd):
+			n := len(ret)
+			collectFieldPaths(path, v.Message(), ret)
+			if len(ret) == n {
+				ret[path] = struct{}{}
+			}
+		default:
+			ret[path] = struct{}{}
+		}
+
+		return true
+	})
+}
+
+type fieldPath struct {
+	fields []string
+	key    string
+	hasKey bool
+}
+
+func parseFieldPath(arg string) fieldPath {
+	var ret fieldPath
+	if idx := strings.Index(arg, "["); idx > 0 && strings.HasSuffix(arg, "]") {
+		ret.key = arg[idx+1 : len(arg)-1]
+		ret.hasKey = true
+		arg = arg[:idx]
+	}
+
+	ret.fields = strings.Split(arg, ".")
+	return ret
+}
+
+func getFieldValue(root protoreflect.Message, arg string) (protoreflect.Value, bool) {
+	p := parseFieldPath(arg)
+	m := root
+
+	for i, name := range p.fields {
+		fd := m.Descriptor().Fields().ByJSONName(name)
+		if fd == nil || !m.Has(fd) {
+			return protoreflect.Value{}, false
+		}
+
+		if i == len(p.fields)-1 {
+			if !p.hasKey {
+				return m.Get(fd), true
+			}
+			if !fd.IsMap() {
+				return protoreflect.Value{}, false
+			}
+			val := m.Get(fd).Map().Get(protoreflect.ValueOfString(p.key).MapKey())
+			return val, val.IsValid()
+		}
+
+		if !isMessageField(fd) {
+			return protoreflect.Value{}, false
+		}
+		m = m.Get(fd).Message()
+	}
+
+	return protoreflect.Value{}, false
+}
+
+func setFieldValue(dst, src protoreflect.Message, arg string) {
+	p := parseFieldPath(arg)
+
+	for i, name := range p.fields {
+		fd := src.Descriptor().Fields().ByJSONName(name)
+		if fd == nil || !src.Has(fd) {
+			return
+		}
+
+		if i == len(p.fields)-1 {
+			if !p.hasKey {
+				if isMessageField(fd) {
+					// Message leaf paths are empty messages whose presence is
+					// set without overwriting the fields owned by others.
+					dst.Mutable(fd)
+				} else {
+					dst.Set(fd, src.Get(fd))
+				}
+				return
+			}
+			if !fd.IsMap() {
+				return
+			}
+			mk := protoreflect.ValueOfString(p.key).MapKey()
+			if val := src.Get(fd).Map().Get(mk); val.IsValid() {
+				dst.Mutable(fd).Map().Set(mk, val)
+			}
+			return
+		}
+
+		if !isMessageField(fd) {
+			return
+		}
+		dst = dst.Mutable(fd).Message()
+		src = src.Get(fd).Message()
+	}
+}
+
+func clearFieldValue(root protoreflect.Message, arg string) {
+	p := parseFieldPath(arg)
+	m := root
+
+	for i, name := range p.fields {
+		fd := m.Descriptor().Fields().ByJSONName(name)
+		if fd == nil || !m.Has(fd) {
+			return
+		}
+
+		if i == len(p.fields)-1 {
+			if !p.hasKey {
+				if !isMessageField(fd) || isEmptyMessage(m.Get(fd).Message()) {
+					m.Clear(fd)
+				}
+				return
+			}
+			if fd.IsMap() {
+				m.Mutable(fd).Map().Clear(protoreflect.ValueOfString(p.key).MapKey())
+			}
+			return
+		}
+
+		if !isMessageField(fd) {
+			return
+		}
+		m = m.Mutable(fd).Message()
+	}
+}
+
+func isMessageField(fd protoreflect.FieldDescriptor) bool {
+	return fd.Message() != nil && !fd.IsList() && !fd.IsMap()
+}
+
+func isEmptyMessage(m protoreflect.Message) bool {
+	ret := true
+	m.Range(func(protoreflect.FieldDescriptor, protoreflect.Value) bool {
+		ret = false
+		return false
+	})
+	return ret
+}
+
+func isValueEqual(a, b protoreflect.Value) bool {
+	if a.IsValid() != b.IsValid() {
+		return false
+	}
+	if !a.IsValid() {
+		return true
+	}
+
+	switch av := a.Interface().(type) {
+	case protoreflect.Message:
+		bv, ok := b.Interface().(protoreflect.Message)
+		return ok && proto.Equal(av.Interface(), bv.Interface())
+	case protoreflect.List:
+		bv, ok := b.Interface().(protoreflect.List)
+		if !ok || av.Len() != bv.Len() {
+			return false
+		}
+		for i := 0; i < av.Len(); i++ {
+			if !isValueEqual(av.Get(i), bv.Get(i)) {
+				return false
+			}
+		}
+		return true
+	case protoreflect.Map:
+		bv, ok := b.Interface().(protoreflect.Map)
+		if !ok || av.Len() != bv.Len() {
+			return false
+		}
+		ret := true
+		av.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			ret = isValueEqual(v, bv.Get(k))
+			return ret
+		})
+		return ret
+	case []byte:
+		bv, ok := b.Interface().([]byte)
+		return ok && bytes.Equal(av, bv)
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
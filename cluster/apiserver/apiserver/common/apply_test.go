@@ -0,0 +1,155 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/pkg/grpcerr"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestServerSideApply(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getCtx := func(manager string, force bool) context.Context {
+		md := metadata.Pairs("x-octelium-field-manager", manager)
+		if force {
+			md.Set("x-octelium-force-apply", "true")
+		}
+		return metadata.NewIncomingContext(context.Background(), md)
+	}
+
+	{
+		opts, err := GetApplyOptions(context.Background())
+		assert.Nil(t, err)
+		assert.Nil(t, opts)
+
+		_, err = GetApplyOptions(getCtx("invalid manager", false))
+		assert.NotNil(t, err)
+	}
+
+	item := &corev1.Group{
+		Metadata: &metav1.Metadata{
+			Name: "grp",
+			Labels: map[string]string{
+				"a": "1",
+			},
+		},
+		Spec: &corev1.Group_Spec{
+			Authorization: &corev1.Group_Spec_Authorization{
+				Policies: []string{"p1"},
+			},
+		},
+	}
+
+	err = InitManagedFields(getCtx("m1", false), item)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(item.Metadata.ManagedFields))
+	assert.Equal(t, "m1", item.Metadata.ManagedFields[0].Manager)
+	assert.Equal(t, []string{"metadata.labels[a]", "spec.authorization.policies"},
+		item.Metadata.ManagedFields[0].Fields)
+
+	{
+		// A different manager sets its own fields without touching the fields of m1.
+		err = ApplyUpdate(getCtx("m2", false), item, &corev1.Group{
+			Metadata: &metav1.Metadata{
+				Name:        "grp",
+				Description: "desc",
+				Labels: map[string]string{
+					"a": "1",
+					"b": "2",
+				},
+			},
+			Spec: &corev1.Group_Spec{},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "desc", item.Metadata.Description)
+		assert.Equal(t, map[string]string{"a": "1", "b": "2"}, item.Metadata.Labels)
+		assert.Equal(t, []string{"p1"}, item.Spec.Authorization.Policies)
+	}
+
+	{
+		// Changing a field owned by m1 is a conflict.
+		err = ApplyUpdate(getCtx("m2", false), item, &corev1.Group{
+			Metadata: &metav1.Metadata{
+				Name: "grp",
+			},
+			Spec: &corev1.Group_Spec{
+				Authorization: &corev1.Group_Spec_Authorization{
+					Policies: []string{"p2"},
+				},
+			},
+		})
+		assert.NotNil(t, err)
+		assert.True(t, grpcerr.IsConflict(err))
+		assert.Contains(t, err.Error(), "spec.authorization.policies (owned by m1)")
+		assert.Equal(t, []string{"p1"}, item.Spec.Authorization.Policies)
+	}
+
+	{
+		// Forcing the apply transfers the ownership and removes the fields
+		// that are no longer applied by m2 unless also owned by m1.
+		err = ApplyUpdate(getCtx("m2", true), item, &corev1.Group{
+			Metadata: &metav1.Metadata{
+				Name: "grp",
+			},
+			Spec: &corev1.Group_Spec{
+				Authorization: &corev1.Group_Spec_Authorization{
+					Policies: []string{"p2"},
+				},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"p2"}, item.Spec.Authorization.Policies)
+		assert.Equal(t, "", item.Metadata.Description)
+		assert.Equal(t, map[string]string{"a": "1"}, item.Metadata.Labels)
+
+		for _, mf := range item.Metadata.ManagedFields {
+			switch mf.Manager {
+			case "m1":
+				assert.Equal(t, []string{"metadata.labels[a]"}, mf.Fields)
+			case "m2":
+				assert.Equal(t, []string{"spec.authorization.policies"}, mf.Fields)
+			}
+		}
+	}
+
+	{
+		// Ordinary updates replace the resource and prune the managed fields.
+		err = ApplyUpdate(context.Background(), item, &corev1.Group{
+			Metadata: &metav1.Metadata{
+				Name: "grp",
+			},
+			Spec: &corev1.Group_Spec{},
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, item.Spec.Authorization)
+		assert.Nil(t, item.Metadata.Labels)
+		assert.Equal(t, 0, len(item.Metadata.ManagedFields))
+	}
+}
@@ -83,3 +83,8 @@ func UnauthenticatedWithErr(err error) error {
 	zap.L().Debug("Unauthenticated error", zap.Error(err))
 	return status.Errorf(codes.Unauthenticated, "Unauthenticated User")
 }
+
+func Conflict(format string, a ...any) error {
+	zap.L().Debug("Conflict error", zap.Error(errors.Errorf(format, a...)))
+	return status.Errorf(codes.Aborted, format, a...)
+}
@@ -37,6 +37,14 @@ func init() {
 type initComponentOpts struct {
 }
 
+var logLevel = zap.NewAtomicLevel()
+
+// LogLevel returns the level of the component's global logger which can be
+// changed at runtime.
+func LogLevel() zap.AtomicLevel {
+	return logLevel
+}
+
 func initComponent(ctx context.Context, opts *initComponentOpts) error {
 
 	if myComponentNS == "" {
@@ -50,8 +58,10 @@ func initComponent(ctx context.Context, opts *initComponentOpts) error {
 		return zap.InfoLevel
 	}()
 
+	logLevel.SetLevel(level)
+
 	zapCfg := zap.Config{
-		Level:       zap.NewAtomicLevelAt(level),
+		Level:       logLevel,
 		Development: ldflags.IsDev(),
 		Encoding: func() string {
 			if ldflags.IsDev() {
@@ -20,12 +20,25 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync/atomic"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
+// ServiceReadiness is the health service name checked by the readiness
+// probes. Unlike the default service checked by the liveness probes, it
+// reports NOT_SERVING once the component has been set as not ready.
+const ServiceReadiness = "readiness"
+
+var isNotReady atomic.Bool
+
+// SetReady sets the readiness reported for the ServiceReadiness service.
+func SetReady(ready bool) {
+	isNotReady.Store(!ready)
+}
+
 type Server struct {
 	grpc_health_v1.UnimplementedHealthServer
 }
@@ -36,6 +49,12 @@ func NewServer() *Server {
 
 func (s *Server) Check(ctx context.Context, in *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
 	// zap.L().Debug("Responding to health check request")
+	if in.Service == ServiceReadiness && isNotReady.Load() {
+		return &grpc_health_v1.HealthCheckResponse{
+			Status: grpc_health_v1.HealthCheckResponse_NOT_SERVING,
+		}, nil
+	}
+
 	return &grpc_health_v1.HealthCheckResponse{
 		Status: grpc_health_v1.HealthCheckResponse_SERVING,
 	}, nil
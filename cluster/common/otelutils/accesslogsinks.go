@@ -0,0 +1,561 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package otelutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	defaultAccessLogSinkBufferSize = 4096
+	maxAccessLogSinkBufferSize     = 1000000
+	maxAccessLogSinkBatch          = 256
+	maxAccessLogSinks              = 16
+
+	defaultAccessLogFileMaxSizeMB  = 100
+	defaultAccessLogFileMaxBackups = 5
+	maxAccessLogFileMaxSizeMB      = 10240
+	maxAccessLogFileMaxBackups     = 100
+)
+
+// AccessLogDir is the directory of the file sinks. It is a dedicated volume
+// since the root filesystem of the Services is read-only.
+const AccessLogDir = "/var/log/octelium"
+
+// accessLogSinks holds the additional sinks to which the access logs are
+// emitted alongside the Cluster collector.
+var accessLogSinks atomic.Pointer[[]*accessLogSinkWorker]
+
+type accessLogSink interface {
+	write(ctx context.Context, entries []*corev1.AccessLog) error
+	close() error
+}
+
+type accessLogSinkConfig struct {
+	sinks      []*url.URL
+	bufferSize int
+}
+
+func getAccessLogSinkConfig(cfg *corev1.ClusterConfig_Spec_AccessLog) (*accessLogSinkConfig, error) {
+	ret := &accessLogSinkConfig{
+		bufferSize: defaultAccessLogSinkBufferSize,
+	}
+
+	if cfg == nil {
+		return ret, nil
+	}
+
+	if cfg.BufferSize > maxAccessLogSinkBufferSize {
+		return nil, errors.Errorf("Invalid access log sink buffer size: %d", cfg.BufferSize)
+	}
+	if cfg.BufferSize > 0 {
+		ret.bufferSize = int(cfg.BufferSize)
+	}
+
+	if len(cfg.Sinks) > maxAccessLogSinks {
+		return nil, errors.Errorf("Too many access log sinks")
+	}
+
+	for _, arg := range cfg.Sinks {
+		arg = strings.TrimSpace(arg)
+		switch arg {
+		case "":
+			return nil, errors.Errorf("The access log sink is empty")
+		case "stdout", "syslog":
+			ret.sinks = append(ret.sinks, &url.URL{Scheme: arg})
+			continue
+		}
+
+		u, err := url.Parse(arg)
+		if err != nil {
+			return nil, errors.Errorf("Invalid access log sink: %s", arg)
+		}
+
+		switch u.Scheme {
+		case "file":
+			if u.Host != "" || path.Clean(u.Path) != u.Path || path.Dir(u.Path) != AccessLogDir {
+				return nil, errors.Errorf("The access log sink file must be in %s: %s", AccessLogDir, arg)
+			}
+			if _, _, err := getAccessLogFileLimits(u); err != nil {
+				return nil, err
+			}
+		case "syslog", "syslog+udp", "syslog+tcp", "http", "https", "otlp":
+			if u.Host == "" {
+				return nil, errors.Errorf("The access log sink host is empty: %s", arg)
+			}
+		default:
+			return nil, errors.Errorf("Unsupported access log sink: %s", arg)
+		}
+
+		ret.sinks = append(ret.sinks, u)
+	}
+
+	return ret, nil
+}
+
+// ValidateAccessLogConfig validates the access log sinks of the ClusterConfig.
+func ValidateAccessLogConfig(cfg *corev1.ClusterConfig_Spec_AccessLog) error {
+	_, err := getAccessLogSinkConfig(cfg)
+	return err
+}
+
+// GetAccessLogFilesMaxSize returns the maximum total size in bytes of the file
+// sinks including their rotated backups, or zero if there are no valid file
+// sinks.
+func GetAccessLogFilesMaxSize(cfg *corev1.ClusterConfig_Spec_AccessLog) int64 {
+	sinkCfg, err := getAccessLogSinkConfig(cfg)
+	if err != nil {
+		return 0
+	}
+
+	var ret int64
+	for _, u := range sinkCfg.sinks {
+		if u.Scheme != "file" {
+			continue
+		}
+		maxSizeMB, maxBackups, _ := getAccessLogFileLimits(u)
+		ret += int64(maxBackups+1) * int64(maxSizeMB) * 1024 * 1024
+	}
+
+	return ret
+}
+
+func getAccessLogFileLimits(u *url.URL) (int, int, error) {
+	maxSizeMB, err := getQueryInt(u, "maxSizeMB", defaultAccessLogFileMaxSizeMB)
+	if err != nil {
+		return 0, 0, err
+	}
+	if maxSizeMB < 1 || maxSizeMB > maxAccessLogFileMaxSizeMB {
+		return 0, 0, errors.Errorf("Invalid maxSizeMB: %d", maxSizeMB)
+	}
+
+	maxBackups, err := getQueryInt(u, "maxBackups", defaultAccessLogFileMaxBackups)
+	if err != nil {
+		return 0, 0, err
+	}
+	if maxBackups > maxAccessLogFileMaxBackups {
+		return 0, 0, errors.Errorf("Invalid maxBackups: %d", maxBackups)
+	}
+
+	return maxSizeMB, maxBackups, nil
+}
+
+// RunAccessLogSinks starts the access log sinks set by the ClusterConfig.
+func RunAccessLogSinks(ctx context.Context, cfg *corev1.ClusterConfig_Spec_AccessLog) error {
+	sinkCfg, err := getAccessLogSinkConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	if len(sinkCfg.sinks) == 0 {
+		return nil
+	}
+
+	dropped, err := GetMeter().Int64Counter("accesslog.sink.dropped",
+		metric.WithDescription("Access log entries dropped by the sinks"))
+	if err != nil {
+		return err
+	}
+
+	var workers []*accessLogSinkWorker
+	for _, u := range sinkCfg.sinks {
+		sink, err := newAccessLogSink(ctx, u)
+		if err != nil {
+			for _, w := range workers {
+				w.sink.close()
+			}
+			return errors.Errorf("Could not create the access log sink %s: %+v", u.Scheme, err)
+		}
+
+		workers = append(workers, newAccessLogSinkWorker(u.Scheme, sink, sinkCfg.bufferSize, dropped))
+	}
+
+	for _, w := range workers {
+		go w.run(ctx)
+	}
+
+	accessLogSinks.Store(&workers)
+
+	return nil
+}
+
+func newAccessLogSink(ctx context.Context, u *url.URL) (accessLogSink, error) {
+	switch u.Scheme {
+	case "stdout":
+		return &writerSink{w: os.Stdout}, nil
+	case "file":
+		maxSizeMB, maxBackups, err := getAccessLogFileLimits(u)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := openRotatingFile(u.Path, int64(maxSizeMB)*1024*1024, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		return &writerSink{w: f}, nil
+	case "syslog", "syslog+udp", "syslog+tcp":
+		network := ""
+		if u.Host != "" {
+			network = "udp"
+			if u.Scheme == "syslog+tcp" {
+				network = "tcp"
+			}
+		}
+
+		w, err := syslog.Dial(network, u.Host, syslog.LOG_INFO|syslog.LOG_LOCAL0, "octelium")
+		if err != nil {
+			return nil, err
+		}
+		return &syslogSink{w: w}, nil
+	case "http", "https":
+		return &httpSink{
+			url: u.String(),
+			client: &http.Client{
+				Timeout: 10 * time.Second,
+			},
+		}, nil
+	case "otlp":
+		return newOTLPSink(ctx, u)
+	default:
+		return nil, errors.Errorf("Unsupported access log sink: %s", u.Scheme)
+	}
+}
+
+func getQueryInt(u *url.URL, key string, def int) (int, error) {
+	val := u.Query().Get(key)
+	if val == "" {
+		return def, nil
+	}
+
+	ret, err := strconv.Atoi(val)
+	if err != nil || ret < 0 {
+		return 0, errors.Errorf("Invalid %s: %s", key, val)
+	}
+
+	return ret, nil
+}
+
+// accessLogSinkWorker buffers the entries of a sink so that a slow or
+// unavailable sink never blocks the request path. The entries are dropped
+// and counted once the buffer is full.
+type accessLogSinkWorker struct {
+	typ     string
+	sink    accessLogSink
+	ch      chan *corev1.AccessLog
+	dropped metric.Int64Counter
+}
+
+func newAccessLogSinkWorker(typ string, sink accessLogSink, bufferSize int, dropped metric.Int64Counter) *accessLogSinkWorker {
+	return &accessLogSinkWorker{
+		typ:     typ,
+		sink:    sink,
+		ch:      make(chan *corev1.AccessLog, bufferSize),
+		dropped: dropped,
+	}
+}
+
+func (w *accessLogSinkWorker) emit(in *corev1.AccessLog) {
+	select {
+	case w.ch <- in:
+	default:
+		w.addDropped(1, "bufferFull")
+	}
+}
+
+func (w *accessLogSinkWorker) addDropped(n int, reason string) {
+	w.dropped.Add(context.Background(), int64(n), metric.WithAttributes(
+		attribute.String("sink", w.typ),
+		attribute.String("reason", reason),
+	))
+}
+
+func (w *accessLogSinkWorker) run(ctx context.Context) {
+	defer w.sink.close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case in := <-w.ch:
+			batch := []*corev1.AccessLog{in}
+		loop:
+			for len(batch) < maxAccessLogSinkBatch {
+				select {
+				case in := <-w.ch:
+					batch = append(batch, in)
+				default:
+					break loop
+				}
+			}
+
+			if err := w.sink.write(ctx, batch); err != nil {
+				zap.L().Debug("Could not write access logs to sink", zap.String("sink", w.typ), zap.Error(err))
+				w.addDropped(len(batch), "error")
+			}
+		}
+	}
+}
+
+func marshalAccessLogs(entries []*corev1.AccessLog) ([]byte, error) {
+	var ret bytes.Buffer
+	for _, in := range entries {
+		b, err := pbutils.MarshalJSON(in, false)
+		if err != nil {
+			return nil, err
+		}
+		ret.Write(b)
+		ret.WriteByte('\n')
+	}
+
+	return ret.Bytes(), nil
+}
+
+// writerSink writes the entries as newline-delimited JSON.
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) write(ctx context.Context, entries []*corev1.AccessLog) error {
+	b, err := marshalAccessLogs(entries)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.w.Write(b)
+	return err
+}
+
+func (s *writerSink) close() error {
+	if c, ok := s.w.(io.Closer); ok && s.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func (s *syslogSink) write(ctx context.Context, entries []*corev1.AccessLog) error {
+	for _, in := range entries {
+		b, err := pbutils.MarshalJSON(in, false)
+		if err != nil {
+			return err
+		}
+		if err := s.w.Info(string(b)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
+
+// httpSink POSTs every batch as newline-delimited JSON.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) write(ctx context.Context, entries []*corev1.AccessLog) error {
+	b, err := marshalAccessLogs(entries)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("Unexpected access log sink response status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (s *httpSink) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// otlpSink exports the entries to an additional OTLP gRPC endpoint.
+type otlpSink struct {
+	provider *sdklog.LoggerProvider
+}
+
+func newOTLPSink(ctx context.Context, u *url.URL) (*otlpSink, error) {
+	opts := []otlploggrpc.Option{
+		otlploggrpc.WithEndpoint(u.Host),
+	}
+	if u.Query().Get("insecure") == "true" {
+		opts = append(opts, otlploggrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlploggrpc.WithTLSCredentials(credentials.NewTLS(&tls.Config{
+			MinVersion: tls.VersionTLS12,
+		})))
+	}
+
+	exporter, err := otlploggrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := getResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otlpSink{
+		provider: sdklog.NewLoggerProvider(
+			sdklog.WithResource(resource),
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		),
+	}, nil
+}
+
+func (s *otlpSink) write(ctx context.Context, entries []*corev1.AccessLog) error {
+	logger := s.provider.Logger("default")
+	for _, in := range entries {
+		logger.Emit(ctx, getAccessLogRecord(in))
+	}
+
+	return nil
+}
+
+func (s *otlpSink) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.provider.Shutdown(ctx)
+}
+
+// rotatingFile is a file that is rotated to "<path>.1" once it exceeds its
+// maximum size, keeping at most maxBackups rotated files.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	ret := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := ret.open(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(b []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(b)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package otelutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestGetAccessLogSinkConfig(t *testing.T) {
+	{
+		cfg, err := getAccessLogSinkConfig(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(cfg.sinks))
+		assert.Equal(t, defaultAccessLogSinkBufferSize, cfg.bufferSize)
+	}
+
+	{
+		cfg, err := getAccessLogSinkConfig(&corev1.ClusterConfig_Spec_AccessLog{
+			Sinks: []string{
+				"stdout",
+				" file:///var/log/octelium/access.log?maxSizeMB=10",
+				"syslog",
+				"syslog+tcp://syslog:514",
+				"https://logs.example.com/ingest",
+				"otlp://otlp:4317",
+			},
+			BufferSize: 100,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 100, cfg.bufferSize)
+
+		var schemes []string
+		for _, u := range cfg.sinks {
+			schemes = append(schemes, u.Scheme)
+		}
+		assert.Equal(t, []string{"stdout", "file", "syslog", "syslog+tcp", "https", "otlp"}, schemes)
+		assert.Equal(t, "/var/log/octelium/access.log", cfg.sinks[1].Path)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"stderr",
+		"ftp://host",
+		"file://",
+		"file:///var/log/access.log",
+		"file:///var/log/octelium/../access.log",
+		"file:///var/log/octelium/logs/access.log",
+		"file://host/var/log/octelium/access.log",
+		"file:///var/log/octelium/access.log?maxSizeMB=0",
+		"file:///var/log/octelium/access.log?maxBackups=1000",
+		"https:///path",
+		"syslog+udp://",
+	} {
+		err := ValidateAccessLogConfig(&corev1.ClusterConfig_Spec_AccessLog{
+			Sinks: []string{invalid},
+		})
+		assert.NotNil(t, err, invalid)
+	}
+
+	{
+		err := ValidateAccessLogConfig(&corev1.ClusterConfig_Spec_AccessLog{
+			BufferSize: maxAccessLogSinkBufferSize + 1,
+		})
+		assert.NotNil(t, err)
+	}
+}
+
+func TestGetAccessLogFilesMaxSize(t *testing.T) {
+	assert.Equal(t, int64(0), GetAccessLogFilesMaxSize(nil))
+	assert.Equal(t, int64(0), GetAccessLogFilesMaxSize(&corev1.ClusterConfig_Spec_AccessLog{
+		Sinks: []string{"stdout"},
+	}))
+	assert.Equal(t, int64(0), GetAccessLogFilesMaxSize(&corev1.ClusterConfig_Spec_AccessLog{
+		Sinks: []string{"file:///var/log/access.log"},
+	}))
+
+	assert.Equal(t, int64(6*100*1024*1024+3*10*1024*1024),
+		GetAccessLogFilesMaxSize(&corev1.ClusterConfig_Spec_AccessLog{
+			Sinks: []string{
+				"stdout",
+				"file:///var/log/octelium/a.log",
+				"file:///var/log/octelium/b.log?maxSizeMB=10&maxBackups=2",
+			},
+		}))
+}
+
+type tstBlockingSink struct {
+	release chan struct{}
+	written chan int
+}
+
+func (s *tstBlockingSink) write(ctx context.Context, entries []*corev1.AccessLog) error {
+	<-s.release
+	s.written <- len(entries)
+	return nil
+}
+
+func (s *tstBlockingSink) close() error {
+	return nil
+}
+
+func getTstAccessLog(id string) *corev1.AccessLog {
+	return &corev1.AccessLog{
+		Metadata: &metav1.LogMetadata{
+			Id: id,
+		},
+	}
+}
+
+func TestAccessLogSinkWorker(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	dropped, err := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).
+		Meter("test").Int64Counter("accesslog.sink.dropped")
+	assert.Nil(t, err)
+
+	getDropped := func() int64 {
+		rm := &metricdata.ResourceMetrics{}
+		assert.Nil(t, reader.Collect(context.Background(), rm))
+		var ret int64
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					ret += dp.Value
+				}
+			}
+		}
+		return ret
+	}
+
+	sink := &tstBlockingSink{
+		release: make(chan struct{}),
+		written: make(chan int, 16),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := newAccessLogSinkWorker("test", sink, 4, dropped)
+	go w.run(ctx)
+
+	// The first entry is taken by the blocked sink while the remaining ones
+	// fill the buffer. Emitting never blocks.
+	w.emit(getTstAccessLog("first"))
+	assert.Eventually(t, func() bool {
+		return len(w.ch) == 0
+	}, 2*time.Second, 5*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			w.emit(getTstAccessLog(fmt.Sprintf("%d", i)))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("emit blocked")
+	}
+
+	assert.Equal(t, int64(6), getDropped())
+
+	close(sink.release)
+	assert.Equal(t, 1, <-sink.written)
+	assert.Equal(t, 4, <-sink.written)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+
+	f, err := openRotatingFile(path, 10, 2)
+	assert.Nil(t, err)
+
+	for i := 0; i < 4; i++ {
+		_, err := f.Write([]byte(fmt.Sprintf("line-%d-\n", i)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, f.Close())
+
+	read := func(path string) string {
+		b, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		return string(b)
+	}
+
+	assert.Equal(t, "line-3-\n", read(path))
+	assert.Equal(t, "line-2-\n", read(path+".1"))
+	assert.Equal(t, "line-1-\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	// Reopening appends to the current file
+	f, err = openRotatingFile(path, 100, 2)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("line-4-\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+	assert.Equal(t, "line-3-\nline-4-\n", read(path))
+}
+
+func TestAccessLogSinks(t *testing.T) {
+	entries := []*corev1.AccessLog{getTstAccessLog("a"), getTstAccessLog("b")}
+
+	{
+		buf := &bytes.Buffer{}
+		sink := &writerSink{w: buf}
+		assert.Nil(t, sink.write(context.Background(), entries))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Equal(t, 2, len(lines))
+		assert.True(t, strings.Contains(lines[0], `"a"`))
+		assert.True(t, strings.Contains(lines[1], `"b"`))
+	}
+
+	{
+		var body string
+		status := http.StatusOK
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(status)
+		}))
+		defer srv.Close()
+
+		sink, err := newAccessLogSink(context.Background(), mustParseURL(t, srv.URL+"/ingest"))
+		assert.Nil(t, err)
+		defer sink.close()
+
+		assert.Nil(t, sink.write(context.Background(), entries))
+		assert.Equal(t, 2, strings.Count(body, "\n"))
+
+		status = http.StatusServiceUnavailable
+		assert.NotNil(t, sink.write(context.Background(), entries))
+	}
+
+	{
+		_, err := newAccessLogSink(context.Background(),
+			mustParseURL(t, "file://"+filepath.Join(t.TempDir(), "access.log")+"?maxBackups=invalid"))
+		assert.NotNil(t, err)
+	}
+}
+
+func mustParseURL(t *testing.T, arg string) *url.URL {
+	ret, err := url.Parse(arg)
+	assert.Nil(t, err)
+	return ret
+}
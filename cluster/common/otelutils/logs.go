@@ -18,6 +18,8 @@ package otelutils
 
 import (
 	"context"
+	"os"
+	"strings"
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/cluster/common/components"
@@ -25,6 +27,7 @@ import (
 	"github.com/octelium/octelium/cluster/common/vutils"
 	"github.com/octelium/octelium/pkg/common/pbutils"
 	"github.com/octelium/octelium/pkg/utils/ldflags"
+	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
 	"go.opentelemetry.io/otel/log"
@@ -51,6 +54,45 @@ func getResource(ctx context.Context) (*resource.Resource, error) {
 		attribute.String("octelium.region.name", vutils.GetMyRegionName()),
 	)
 
+	if val := os.Getenv("OCTELIUM_OTEL_RESOURCE_ATTRIBUTES"); val != "" {
+		attrs, err := parseResourceAttributes(val)
+		if err != nil {
+			return nil, err
+		}
+
+		ret, err = resource.Merge(ret, resource.NewSchemaless(attrs...))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// parseResourceAttributes parses additional resource attributes in the
+// comma-separated "key1=value1,key2=value2" form. The octelium.* keys are
+// reserved for the attributes set by the component itself.
+func parseResourceAttributes(arg string) ([]attribute.KeyValue, error) {
+	var ret []attribute.KeyValue
+
+	for _, pair := range strings.Split(arg, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, errors.Errorf("Invalid resource attribute: %s", pair)
+		}
+		if strings.HasPrefix(key, "octelium.") {
+			return nil, errors.Errorf("Reserved resource attribute key: %s", key)
+		}
+
+		ret = append(ret, attribute.String(key, strings.TrimSpace(value)))
+	}
+
 	return ret, nil
 }
 
@@ -100,6 +142,16 @@ func GetLogger() log.Logger {
 }
 
 func EmitAccessLog(in *corev1.AccessLog) {
+	GetLogger().Emit(context.Background(), getAccessLogRecord(in))
+
+	if workers := accessLogSinks.Load(); workers != nil {
+		for _, w := range *workers {
+			w.emit(in)
+		}
+	}
+}
+
+func getAccessLogRecord(in *corev1.AccessLog) log.Record {
 	inMap := pbutils.MustConvertToMap(in)
 
 	ret := log.Record{}
@@ -109,5 +161,5 @@ func EmitAccessLog(in *corev1.AccessLog) {
 
 	ret.SetBody(convertValue(inMap))
 
-	GetLogger().Emit(context.Background(), ret)
+	return ret
 }
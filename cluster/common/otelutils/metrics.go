@@ -18,46 +18,110 @@ package otelutils
 
 import (
 	"context"
+	"crypto/tls"
+	"os"
 	"runtime"
 	"time"
 
 	"github.com/octelium/octelium/cluster/common/components"
+	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/metric"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc/credentials"
 )
 
 var defaultAddr = "octelium-collector.octelium.svc:8080"
 
+const defaultMetricsInterval = 10 * time.Second
+
+type metricsConfig struct {
+	// collectorDisabled stops exporting metrics to the Cluster collector
+	collectorDisabled bool
+	// endpoint is an additional OTLP gRPC endpoint that exports the same
+	// instruments alongside the Cluster collector
+	endpoint string
+	insecure bool
+	interval time.Duration
+}
+
+func getMetricsConfig() (*metricsConfig, error) {
+	ret := &metricsConfig{
+		collectorDisabled: os.Getenv("OCTELIUM_OTEL_METRICS_COLLECTOR_DISABLED") == "true",
+		endpoint:          os.Getenv("OCTELIUM_OTEL_METRICS_ENDPOINT"),
+		insecure:          os.Getenv("OCTELIUM_OTEL_METRICS_INSECURE") == "true",
+		interval:          defaultMetricsInterval,
+	}
+
+	if val := os.Getenv("OCTELIUM_OTEL_METRICS_INTERVAL"); val != "" {
+		interval, err := time.ParseDuration(val)
+		if err != nil {
+			return nil, errors.Errorf("Invalid metrics export interval: %s", val)
+		}
+		if interval < time.Second {
+			return nil, errors.Errorf("The metrics export interval must be at least 1s")
+		}
+		ret.interval = interval
+	}
+
+	return ret, nil
+}
+
 func CreateMetricsProvider(ctx context.Context, addr string) (*sdkmetric.MeterProvider, error) {
 
-	resource, err := getResource(ctx)
+	cfg, err := getMetricsConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := getGRPCConn(ctx, addr)
+	resource, err := getResource(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
-	if err != nil {
-		return nil, err
+	opts := []sdkmetric.Option{
+		sdkmetric.WithResource(resource),
 	}
 
-	var interval time.Duration
-	if interval == 0 {
-		interval = 10 * time.Second
+	if !cfg.collectorDisabled {
+		conn, err := getGRPCConn(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts,
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.interval))))
 	}
 
-	reader := sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))
+	if cfg.endpoint != "" {
+		exporterOpts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(cfg.endpoint),
+		}
+		if cfg.insecure {
+			exporterOpts = append(exporterOpts, otlpmetricgrpc.WithInsecure())
+		} else {
+			exporterOpts = append(exporterOpts,
+				otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(&tls.Config{
+					MinVersion: tls.VersionTLS12,
+				})))
+		}
+
+		exporter, err := otlpmetricgrpc.New(ctx, exporterOpts...)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts,
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.interval))))
+	}
 
-	meterProvider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithResource(resource),
-		sdkmetric.WithReader(reader),
-	)
+	meterProvider := sdkmetric.NewMeterProvider(opts...)
 
 	otel.SetMeterProvider(meterProvider)
 
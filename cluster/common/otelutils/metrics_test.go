@@ -0,0 +1,91 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package otelutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestGetMetricsConfig(t *testing.T) {
+	{
+		cfg, err := getMetricsConfig()
+		assert.Nil(t, err)
+		assert.False(t, cfg.collectorDisabled)
+		assert.Equal(t, "", cfg.endpoint)
+		assert.Equal(t, defaultMetricsInterval, cfg.interval)
+	}
+
+	{
+		t.Setenv("OCTELIUM_OTEL_METRICS_COLLECTOR_DISABLED", "true")
+		t.Setenv("OCTELIUM_OTEL_METRICS_ENDPOINT", "otlp.example.com:4317")
+		t.Setenv("OCTELIUM_OTEL_METRICS_INTERVAL", "30s")
+
+		cfg, err := getMetricsConfig()
+		assert.Nil(t, err)
+		assert.True(t, cfg.collectorDisabled)
+		assert.Equal(t, "otlp.example.com:4317", cfg.endpoint)
+		assert.False(t, cfg.insecure)
+		assert.Equal(t, 30*time.Second, cfg.interval)
+	}
+
+	{
+		t.Setenv("OCTELIUM_OTEL_METRICS_INTERVAL", "100ms")
+		_, err := getMetricsConfig()
+		assert.NotNil(t, err)
+
+		t.Setenv("OCTELIUM_OTEL_METRICS_INTERVAL", "invalid")
+		_, err = getMetricsConfig()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestParseResourceAttributes(t *testing.T) {
+	{
+		attrs, err := parseResourceAttributes("deployment.environment=prod, team = infra,,")
+		assert.Nil(t, err)
+		assert.Equal(t, []attribute.KeyValue{
+			attribute.String("deployment.environment", "prod"),
+			attribute.String("team", "infra"),
+		}, attrs)
+	}
+
+	invalids := []string{
+		"deployment.environment",
+		"=prod",
+		"octelium.component.type=other",
+	}
+	for _, arg := range invalids {
+		_, err := parseResourceAttributes(arg)
+		assert.NotNil(t, err, "%s", arg)
+	}
+
+	{
+		t.Setenv("OCTELIUM_OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=prod")
+		res, err := getResource(context.Background())
+		assert.Nil(t, err)
+		val, ok := res.Set().Value("deployment.environment")
+		assert.True(t, ok)
+		assert.Equal(t, "prod", val.AsString())
+		_, ok = res.Set().Value("octelium.component.type")
+		assert.True(t, ok)
+	}
+}
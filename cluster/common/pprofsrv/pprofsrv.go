@@ -24,6 +24,7 @@ import (
 
 type PprofServer struct {
 	srv *http.Server
+	mux *http.ServeMux
 }
 
 func New() *PprofServer {
@@ -35,6 +36,7 @@ func New() *PprofServer {
 	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 	return &PprofServer{
+		mux: mux,
 		srv: &http.Server{
 			Addr:    "localhost:49998",
 			Handler: mux,
@@ -47,6 +49,11 @@ func (p *PprofServer) Run(ctx context.Context) error {
 	return nil
 }
 
+// Handle registers an additional local debug handler.
+func (p *PprofServer) Handle(pattern string, handler http.Handler) {
+	p.mux.Handle(pattern, handler)
+}
+
 func (p *PprofServer) Close() error {
 	return p.srv.Close()
 }
@@ -0,0 +1,207 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package resources
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"go.uber.org/zap"
+)
+
+// serviceHosts are the hosts of the public Services resolved from their Hosts.
+type serviceHosts struct {
+	// domains are the exact and wildcard hosts of every Service, keyed by the
+	// Service name, that are added to the Service's virtual host. Envoy then
+	// matches the exact hosts before the wildcard ones.
+	domains map[string][]string
+	// regexes are the regex hosts matched in order once neither an exact nor
+	// a wildcard host matches.
+	regexes []*regexHost
+	// defaultService serves the requests whose host matches no Service.
+	defaultService *corev1.Service
+}
+
+type regexHost struct {
+	svc   *corev1.Service
+	regex string
+}
+
+// getSortedServices returns the public Services sorted by name, excluding the
+// API Server Services, so that the overlapping hosts are always resolved the
+// same way regardless of the order in which the Services are listed.
+func getSortedServices(svcList []*corev1.Service) []*corev1.Service {
+	var ret []*corev1.Service
+	for _, svc := range svcList {
+		if !isAPIServer(svc) {
+			ret = append(ret, svc)
+		}
+	}
+
+	slices.SortFunc(ret, func(a, b *corev1.Service) int {
+		return strings.Compare(a.Metadata.Name, b.Metadata.Name)
+	})
+
+	return ret
+}
+
+// getServiceHosts resolves the Hosts of the public Services. The Services'
+// own FQDNs always take precedence over the Hosts. An exact or wildcard host
+// set by more than one Service, that Envoy would reject, and a regex host
+// set by more than one Service are only kept for the first Service by name.
+// The ignored Hosts are logged.
+func getServiceHosts(r *GetListenersReq) *serviceHosts {
+	ret := &serviceHosts{
+		domains: make(map[string][]string),
+	}
+
+	svcList := getSortedServices(r.ServiceList)
+
+	owners := map[string]string{
+		fmt.Sprintf("octelium-api.%s", r.Domain):     "octelium-api",
+		fmt.Sprintf("octelium-api.%s:443", r.Domain): "octelium-api",
+	}
+	for _, svc := range svcList {
+		for _, fqdn := range getSvcFQDNs(svc, r.Domain) {
+			owners[fqdn] = svc.Metadata.Name
+		}
+	}
+
+	regexOwners := make(map[string]string)
+
+	for _, svc := range svcList {
+		for _, host := range svc.Spec.Hosts {
+			switch host.Type.(type) {
+			case *corev1.Service_Spec_Host_Exact, *corev1.Service_Spec_Host_Wildcard:
+				domain := strings.ToLower(host.GetExact() + host.GetWildcard())
+				if owner, ok := owners[domain]; ok {
+					if owner != svc.Metadata.Name {
+						zap.L().Warn("Ignoring the Service host since it is already matched by another Service",
+							zap.String("service", svc.Metadata.Name),
+							zap.String("host", domain),
+							zap.String("matchedService", owner))
+					}
+					continue
+				}
+
+				// The :authority header might include the default HTTPS port.
+				for _, dmn := range []string{domain, fmt.Sprintf("%s:443", domain)} {
+					owners[dmn] = svc.Metadata.Name
+					ret.domains[svc.Metadata.Name] = append(ret.domains[svc.Metadata.Name], dmn)
+				}
+			case *corev1.Service_Spec_Host_Regex:
+				regex := host.GetRegex()
+				if owner, ok := regexOwners[regex]; ok {
+					if owner != svc.Metadata.Name {
+						zap.L().Warn("Ignoring the Service regex host since it is already set by another Service",
+							zap.String("service", svc.Metadata.Name),
+							zap.String("regex", regex),
+							zap.String("matchedService", owner))
+					}
+					continue
+				}
+
+				if _, err := regexp.Compile(regex); err != nil {
+					zap.L().Warn("Ignoring invalid Service regex host",
+						zap.String("service", svc.Metadata.Name), zap.String("regex", regex), zap.Error(err))
+					continue
+				}
+
+				regexOwners[regex] = svc.Metadata.Name
+				ret.regexes = append(ret.regexes, &regexHost{
+					svc:   svc,
+					regex: regex,
+				})
+			}
+		}
+	}
+
+	for _, host := range ret.regexes {
+		rgx := regexp.MustCompile(getHostRegex(host.regex))
+		for domain, owner := range owners {
+			if owner != host.svc.Metadata.Name && !strings.HasPrefix(domain, "*.") && rgx.MatchString(domain) {
+				zap.L().Info("The Service regex host overlaps with the host of another Service which takes precedence",
+					zap.String("service", host.svc.Metadata.Name),
+					zap.String("regex", host.regex),
+					zap.String("host", domain),
+					zap.String("matchedService", owner))
+			}
+		}
+	}
+
+	if name := r.ClusterConfig.GetSpec().GetIngress().GetDefaultService(); name != "" {
+		idx := slices.IndexFunc(svcList, func(svc *corev1.Service) bool {
+			return svc.Metadata.Name == name
+		})
+		if idx < 0 {
+			zap.L().Warn("The Ingress default Service is not a public Service. Using unmatchedHost instead",
+				zap.String("service", name))
+		} else {
+			ret.defaultService = svcList[idx]
+		}
+	}
+
+	return ret
+}
+
+// getHostRegex returns the regex matched by Envoy against the whole
+// :authority header, which might include the port, of the regex host.
+func getHostRegex(regex string) string {
+	return fmt.Sprintf("(?i)(?:%s)(?::[0-9]+)?", regex)
+}
+
+// getServerNames returns the SNIs matched by the main filter chain, i.e. the
+// Cluster domain and the exact and wildcard hosts of the Services.
+func getServerNames(r *GetListenersReq) []string {
+	ret := []string{r.Domain, fmt.Sprintf("*.%s", r.Domain)}
+
+	for _, svc := range getSortedServices(r.ServiceList) {
+		for _, host := range svc.Spec.Hosts {
+			switch host.Type.(type) {
+			case *corev1.Service_Spec_Host_Exact, *corev1.Service_Spec_Host_Wildcard:
+				serverName := strings.ToLower(host.GetExact() + host.GetWildcard())
+				if !slices.Contains(ret, serverName) {
+					ret = append(ret, serverName)
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+// hasCatchAllServerNames returns whether any SNI needs to be accepted since a
+// Service has a regex host or the Ingress has a default Service, both of
+// which might match any host.
+func hasCatchAllServerNames(r *GetListenersReq) bool {
+	if r.ClusterConfig.GetSpec().GetIngress().GetDefaultService() != "" {
+		return true
+	}
+
+	for _, svc := range getSortedServices(r.ServiceList) {
+		for _, host := range svc.Spec.Hosts {
+			if host.GetRegex() != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
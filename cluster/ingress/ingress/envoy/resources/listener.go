@@ -18,7 +18,6 @@ package resources
 
 import (
 	"context"
-	"fmt"
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
@@ -112,6 +111,19 @@ func getListener(ctx context.Context, r *GetListenersReq) (*listenerv3.Listener,
 	}
 	ret.FilterChains = append(ret.FilterChains, filterChain)
 
+	if !r.HasFrontProxy && hasCatchAllServerNames(r) {
+		// The SNIs that match no Service domain are served by a separate
+		// filter chain so that the main filter chain remains restricted to
+		// the known SNIs.
+		filterChain, err := getFilterChainsMain(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		filterChain.Name = "catch-all"
+		filterChain.FilterChainMatch = &listenerv3.FilterChainMatch{}
+		ret.FilterChains = append(ret.FilterChains, filterChain)
+	}
+
 	return ret, nil
 }
 
@@ -149,13 +161,11 @@ func getHTTPInspector() (*listenerv3.ListenerFilter, error) {
 
 func getFilterChainsMain(ctx context.Context, r *GetListenersReq) (*listenerv3.FilterChain, error) {
 
-	domain := r.Domain
-
 	ret := &listenerv3.FilterChain{
 		FilterChainMatch: &listenerv3.FilterChainMatch{
 			ServerNames: func() []string {
 				if !r.HasFrontProxy {
-					return []string{domain, fmt.Sprintf("*.%s", domain)}
+					return getServerNames(r)
 				}
 
 				return nil
@@ -19,6 +19,8 @@ package resources
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -30,6 +32,7 @@ import (
 	"github.com/octelium/octelium/cluster/common/k8sutils"
 	"github.com/octelium/octelium/cluster/common/vutils"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/pkg/errors"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
@@ -49,13 +52,18 @@ func getRouteConfigMain(ctx context.Context, r *GetListenersReq) (*routev3.Route
 		}
 	}
 
-	svcList := r.ServiceList
+	hosts := getServiceHosts(r)
 
-	for _, svc := range svcList {
-		if isAPIServer(svc) {
-			continue
+	for _, svc := range getSortedServices(r.ServiceList) {
+		vh, err := getVirtualHostService(svc, r, hosts.domains[svc.Metadata.Name])
+		if err != nil {
+			return nil, err
 		}
-		vh, err := getVirtualHostService(svc, r)
+		routeConfig.VirtualHosts = append(routeConfig.VirtualHosts, vh)
+	}
+
+	{
+		vh, err := getVirtualHostUnmatched(r, hosts)
 		if err != nil {
 			return nil, err
 		}
@@ -216,7 +224,7 @@ func getRouteMain(domain string, prefix string, isGRPC bool, cluster string) (*r
 	return route, nil
 }
 
-func getVirtualHostService(svc *corev1.Service, r *GetListenersReq) (*routev3.VirtualHost, error) {
+func getVirtualHostService(svc *corev1.Service, r *GetListenersReq, hosts []string) (*routev3.VirtualHost, error) {
 
 	domain := r.Domain
 
@@ -227,7 +235,7 @@ func getVirtualHostService(svc *corev1.Service, r *GetListenersReq) (*routev3.Vi
 
 	vh := &routev3.VirtualHost{
 		Name:    fmt.Sprintf("vh-%s", k8sutils.GetSvcHostname(svc)),
-		Domains: getSvcFQDNs(svc, domain),
+		Domains: append(getSvcFQDNs(svc, domain), hosts...),
 		Routes:  routes,
 		RequireTls: func() routev3.VirtualHost_TlsRequirementType {
 			if r.HasFrontProxy {
@@ -295,3 +303,192 @@ func getRoutesService(svc *corev1.Service, domain string) ([]*routev3.Route, err
 
 	return []*routev3.Route{route}, nil
 }
+
+const unmatchedHostName = "unmatched-host"
+
+// getVirtualHostUnmatched returns the catch-all virtual host of the requests
+// whose host matches neither the FQDNs nor the exact and wildcard hosts of any
+// Service. The regex hosts are matched first, then the requests are served by
+// the default Service, if set, or by the unmatched host route.
+func getVirtualHostUnmatched(r *GetListenersReq, hosts *serviceHosts) (*routev3.VirtualHost, error) {
+	var routes []*routev3.Route
+
+	for _, host := range hosts.regexes {
+		svcRoutes, err := getRoutesService(host.svc, r.Domain)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, route := range svcRoutes {
+			route.Match.Headers = append(route.Match.Headers, &routev3.HeaderMatcher{
+				Name: ":authority",
+				HeaderMatchSpecifier: &routev3.HeaderMatcher_StringMatch{
+					StringMatch: &envoy_type_matcher.StringMatcher{
+						MatchPattern: &envoy_type_matcher.StringMatcher_SafeRegex{
+							SafeRegex: &envoy_type_matcher.RegexMatcher{
+								Regex: getHostRegex(host.regex),
+							},
+						},
+					},
+				},
+			})
+		}
+
+		routes = append(routes, svcRoutes...)
+	}
+
+	if hosts.defaultService != nil {
+		svcRoutes, err := getRoutesService(hosts.defaultService, r.Domain)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, svcRoutes...)
+	} else {
+		route, err := getRouteUnmatched(r)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
+	return &routev3.VirtualHost{
+		Name:    fmt.Sprintf("vh-%s", unmatchedHostName),
+		Domains: []string{"*"},
+		Routes:  routes,
+		RequireTls: func() routev3.VirtualHost_TlsRequirementType {
+			if r.HasFrontProxy {
+				return routev3.VirtualHost_NONE
+			}
+
+			return routev3.VirtualHost_ALL
+		}(),
+	}, nil
+}
+
+// getRouteUnmatched returns the route of the requests whose host matches no
+// Service. It has its own stat prefix so that these requests are
+// distinguishable in the Ingress stats.
+func getRouteUnmatched(r *GetListenersReq) (*routev3.Route, error) {
+	route := &routev3.Route{
+		Name:       unmatchedHostName,
+		StatPrefix: unmatchedHostName,
+		Match: &routev3.RouteMatch{
+			PathSpecifier: &routev3.RouteMatch_Prefix{
+				Prefix: "/",
+			},
+		},
+	}
+
+	cfg := r.ClusterConfig.GetSpec().GetIngress().GetUnmatchedHost()
+
+	switch {
+	case cfg.GetDirectResponse() != nil:
+		directCfg := cfg.GetDirectResponse()
+		action := &routev3.DirectResponseAction{
+			Status: func() uint32 {
+				if directCfg.StatusCode != 0 {
+					return directCfg.StatusCode
+				}
+				return 404
+			}(),
+		}
+
+		if directCfg.Body != "" {
+			action.Body = &corev3.DataSource{
+				Specifier: &corev3.DataSource_InlineString{
+					InlineString: directCfg.Body,
+				},
+			}
+
+			contentType := directCfg.ContentType
+			if contentType == "" {
+				contentType = "text/plain"
+			}
+			route.ResponseHeadersToAdd = append(route.ResponseHeadersToAdd, &corev3.HeaderValueOption{
+				Header: &corev3.HeaderValue{
+					Key:   "content-type",
+					Value: contentType,
+				},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			})
+		}
+
+		route.Action = &routev3.Route_DirectResponse{
+			DirectResponse: action,
+		}
+	case cfg.GetRedirect() != nil:
+		action, err := getUnmatchedHostRedirect(cfg.GetRedirect())
+		if err != nil {
+			return nil, err
+		}
+
+		route.Action = &routev3.Route_Redirect{
+			Redirect: action,
+		}
+	default:
+		route.Action = &routev3.Route_DirectResponse{
+			DirectResponse: &routev3.DirectResponseAction{
+				Status: 404,
+			},
+		}
+
+		if cfg.GetClose() {
+			route.ResponseHeadersToAdd = append(route.ResponseHeadersToAdd, &corev3.HeaderValueOption{
+				Header: &corev3.HeaderValue{
+					Key:   "connection",
+					Value: "close",
+				},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			})
+		}
+	}
+
+	return route, nil
+}
+
+func getUnmatchedHostRedirect(cfg *corev1.ClusterConfig_Spec_Ingress_UnmatchedHost_Redirect) (*routev3.RedirectAction, error) {
+	u, err := url.Parse(cfg.Url)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.Errorf("Invalid unmatched host redirect URL: %s", cfg.Url)
+	}
+
+	ret := &routev3.RedirectAction{
+		SchemeRewriteSpecifier: &routev3.RedirectAction_SchemeRedirect{
+			SchemeRedirect: u.Scheme,
+		},
+		HostRedirect: u.Hostname(),
+		PathRewriteSpecifier: &routev3.RedirectAction_PathRedirect{
+			PathRedirect: func() string {
+				if u.RequestURI() == "" {
+					return "/"
+				}
+				return u.RequestURI()
+			}(),
+		},
+	}
+
+	if port := u.Port(); port != "" {
+		portNum, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, errors.Errorf("Invalid unmatched host redirect URL port: %s", port)
+		}
+		ret.PortRedirect = uint32(portNum)
+	}
+
+	switch cfg.StatusCode {
+	case 0, 302:
+		ret.ResponseCode = routev3.RedirectAction_FOUND
+	case 301:
+		ret.ResponseCode = routev3.RedirectAction_MOVED_PERMANENTLY
+	case 303:
+		ret.ResponseCode = routev3.RedirectAction_SEE_OTHER
+	case 307:
+		ret.ResponseCode = routev3.RedirectAction_TEMPORARY_REDIRECT
+	case 308:
+		ret.ResponseCode = routev3.RedirectAction_PERMANENT_REDIRECT
+	default:
+		return nil, errors.Errorf("Invalid unmatched host redirect statusCode: %d", cfg.StatusCode)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,359 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package resources
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmatchedHost(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	svc := &corev1.Service{
+		Metadata: &metav1.Metadata{
+			Name: "svc1.default",
+		},
+		Spec: &corev1.Service_Spec{
+			IsPublic: true,
+			Mode:     corev1.Service_Spec_HTTP,
+		},
+		Status: &corev1.Service_Status{
+			NamespaceRef: &metav1.ObjectReference{
+				Name: "default",
+			},
+		},
+	}
+
+	// getRoute returns the route of the virtual host matching the host the
+	// same way Envoy does for the exact and catch-all domains.
+	getRoute := func(cc *corev1.ClusterConfig, host string) *routev3.Route {
+		routeConfig, err := getRouteConfigMain(ctx, &GetListenersReq{
+			Domain:        "example.com",
+			ClusterConfig: cc,
+			ServiceList:   []*corev1.Service{svc},
+		})
+		assert.Nil(t, err)
+
+		var catchAll *routev3.VirtualHost
+		for _, vh := range routeConfig.VirtualHosts {
+			if slices.Contains(vh.Domains, host) {
+				return vh.Routes[0]
+			}
+			if slices.Contains(vh.Domains, "*") {
+				catchAll = vh
+			}
+		}
+
+		assert.NotNil(t, catchAll)
+		return catchAll.Routes[0]
+	}
+
+	cc := &corev1.ClusterConfig{
+		Spec: &corev1.ClusterConfig_Spec{},
+	}
+
+	{
+		route := getRoute(cc, "svc1.example.com")
+		assert.NotEqual(t, unmatchedHostName, route.StatPrefix)
+		assert.NotNil(t, route.GetRoute())
+	}
+
+	{
+		route := getRoute(cc, "unknown.example.com")
+		assert.Equal(t, unmatchedHostName, route.StatPrefix)
+		assert.Equal(t, uint32(404), route.GetDirectResponse().Status)
+		assert.Nil(t, route.GetDirectResponse().Body)
+		assert.Equal(t, 0, len(route.ResponseHeadersToAdd))
+	}
+
+	{
+		cc.Spec.Ingress = &corev1.ClusterConfig_Spec_Ingress{
+			UnmatchedHost: &corev1.ClusterConfig_Spec_Ingress_UnmatchedHost{
+				Type: &corev1.ClusterConfig_Spec_Ingress_UnmatchedHost_DirectResponse_{
+					DirectResponse: &corev1.ClusterConfig_Spec_Ingress_UnmatchedHost_DirectResponse{
+						StatusCode:  421,
+						Body:        "<h1>Not found</h1>",
+						ContentType: "text/html",
+					},
+				},
+			},
+		}
+
+		route := getRoute(cc, "10.0.0.1")
+		assert.Equal(t, uint32(421), route.GetDirectResponse().Status)
+		assert.Equal(t, "<h1>Not found</h1>", route.GetDirectResponse().Body.GetInlineString())
+		assert.Equal(t, "content-type", route.ResponseHeadersToAdd[0].Header.Key)
+		assert.Equal(t, "text/html", route.ResponseHeadersToAdd[0].Header.Value)
+		assert.NotNil(t, getRoute(cc, "svc1.example.com").GetRoute())
+	}
+
+	{
+		cc.Spec.Ingress.UnmatchedHost.Type = &corev1.ClusterConfig_Spec_Ingress_UnmatchedHost_Redirect_{
+			Redirect: &corev1.ClusterConfig_Spec_Ingress_UnmatchedHost_Redirect{
+				Url:        "https://portal.example.com:8443/welcome?from=unmatched",
+				StatusCode: 308,
+			},
+		}
+
+		redirect := getRoute(cc, "unknown.example.com").GetRedirect()
+		assert.Equal(t, "https", redirect.GetSchemeRedirect())
+		assert.Equal(t, "portal.example.com", redirect.HostRedirect)
+		assert.Equal(t, uint32(8443), redirect.PortRedirect)
+		assert.Equal(t, "/welcome?from=unmatched", redirect.GetPathRedirect())
+		assert.Equal(t, routev3.RedirectAction_PERMANENT_REDIRECT, redirect.ResponseCode)
+
+		cc.Spec.Ingress.UnmatchedHost.GetRedirect().StatusCode = 200
+		_, err := getRouteConfigMain(ctx, &GetListenersReq{
+			Domain:        "example.com",
+			ClusterConfig: cc,
+		})
+		assert.NotNil(t, err)
+
+		cc.Spec.Ingress.UnmatchedHost.GetRedirect().StatusCode = 0
+		cc.Spec.Ingress.UnmatchedHost.GetRedirect().Url = "/relative"
+		_, err = getRouteConfigMain(ctx, &GetListenersReq{
+			Domain:        "example.com",
+			ClusterConfig: cc,
+		})
+		assert.NotNil(t, err)
+	}
+
+	{
+		cc.Spec.Ingress.UnmatchedHost.Type = &corev1.ClusterConfig_Spec_Ingress_UnmatchedHost_Close{
+			Close: true,
+		}
+
+		route := getRoute(cc, "unknown.example.com")
+		assert.Equal(t, uint32(404), route.GetDirectResponse().Status)
+		assert.Equal(t, "connection", route.ResponseHeadersToAdd[0].Header.Key)
+		assert.Equal(t, "close", route.ResponseHeadersToAdd[0].Header.Value)
+	}
+}
+
+func TestServiceHosts(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	genSvc := func(name string, hosts ...*corev1.Service_Spec_Host) *corev1.Service {
+		return &corev1.Service{
+			Metadata: &metav1.Metadata{
+				Name: name + ".default",
+			},
+			Spec: &corev1.Service_Spec{
+				IsPublic: true,
+				Mode:     corev1.Service_Spec_HTTP,
+				Hosts:    hosts,
+			},
+			Status: &corev1.Service_Status{
+				NamespaceRef: &metav1.ObjectReference{
+					Name: "default",
+				},
+			},
+		}
+	}
+
+	exact := func(arg string) *corev1.Service_Spec_Host {
+		return &corev1.Service_Spec_Host{
+			Type: &corev1.Service_Spec_Host_Exact{Exact: arg},
+		}
+	}
+	wildcard := func(arg string) *corev1.Service_Spec_Host {
+		return &corev1.Service_Spec_Host{
+			Type: &corev1.Service_Spec_Host_Wildcard{Wildcard: arg},
+		}
+	}
+	regex := func(arg string) *corev1.Service_Spec_Host {
+		return &corev1.Service_Spec_Host{
+			Type: &corev1.Service_Spec_Host_Regex{Regex: arg},
+		}
+	}
+
+	svcExact := genSvc("exact", exact("www.acme.com"), exact("svc2.example.com"))
+	svcWildcard := genSvc("wildcard", wildcard("*.acme.com"), exact("www.acme.com"))
+	svcWildcardLong := genSvc("wildcard-long", wildcard("*.eu.acme.com"))
+	svcRegex := genSvc("regex1", regex(`api-[0-9]+\.acme\.(com|org)`), regex(`.*\.acme\.com`))
+	svcRegexDup := genSvc("regex2", regex(`api-[0-9]+\.acme\.(com|org)`), regex(`.*\.acme\.net`))
+	svc2 := genSvc("svc2")
+	svcDefault := genSvc("fallback")
+
+	cc := &corev1.ClusterConfig{
+		Spec: &corev1.ClusterConfig_Spec{},
+	}
+
+	// Listed in reverse order to check that the result does not depend on
+	// the listing order.
+	svcList := []*corev1.Service{
+		svcDefault, svc2, svcRegexDup, svcRegex, svcWildcardLong, svcWildcard, svcExact,
+	}
+
+	// getCluster returns the cluster serving the host the same way Envoy
+	// selects the virtual host and then the first matching route.
+	getCluster := func(host string) string {
+		routeConfig, err := getRouteConfigMain(ctx, &GetListenersReq{
+			Domain:        "example.com",
+			ClusterConfig: cc,
+			ServiceList:   svcList,
+		})
+		assert.Nil(t, err)
+
+		var vhMatched, vhWildcard, vhCatchAll *routev3.VirtualHost
+		wildcardLen := 0
+		for _, vh := range routeConfig.VirtualHosts {
+			for _, domain := range vh.Domains {
+				switch {
+				case domain == host:
+					vhMatched = vh
+				case domain == "*":
+					vhCatchAll = vh
+				case strings.HasPrefix(domain, "*.") && strings.HasSuffix(host, domain[1:]) &&
+					len(domain) > wildcardLen:
+					vhWildcard, wildcardLen = vh, len(domain)
+				}
+			}
+		}
+
+		vh := vhMatched
+		if vh == nil {
+			vh = vhWildcard
+		}
+		if vh == nil {
+			vh = vhCatchAll
+		}
+
+		for _, route := range vh.Routes {
+			if len(route.Match.Headers) > 0 {
+				rgx := regexp.MustCompile("^(?:" +
+					route.Match.Headers[0].GetStringMatch().GetSafeRegex().Regex + ")$")
+				if !rgx.MatchString(host) {
+					continue
+				}
+			}
+
+			return route.GetRoute().GetCluster()
+		}
+
+		return ""
+	}
+
+	{
+		assert.Equal(t, getClusterNameFromService(svcExact), getCluster("www.acme.com"))
+		assert.Equal(t, getClusterNameFromService(svcExact), getCluster("www.acme.com:443"))
+		assert.Equal(t, getClusterNameFromService(svc2), getCluster("svc2.example.com"))
+		assert.Equal(t, getClusterNameFromService(svcWildcard), getCluster("shop.acme.com"))
+		assert.Equal(t, getClusterNameFromService(svcWildcard), getCluster("shop.acme.com:443"))
+		assert.Equal(t, getClusterNameFromService(svcWildcard), getCluster("api-1.acme.com"))
+		assert.Equal(t, getClusterNameFromService(svcWildcardLong), getCluster("shop.eu.acme.com"))
+		assert.Equal(t, getClusterNameFromService(svcWildcardLong), getCluster("shop.eu.acme.com:443"))
+		assert.Equal(t, getClusterNameFromService(svcRegex), getCluster("api-1.acme.org"))
+		assert.Equal(t, getClusterNameFromService(svcRegex), getCluster("api-1.acme.org:443"))
+		assert.Equal(t, getClusterNameFromService(svcRegexDup), getCluster("shop.acme.net"))
+		assert.Equal(t, "", getCluster("unknown.example.org"))
+	}
+
+	{
+		hosts := getServiceHosts(&GetListenersReq{
+			Domain:        "example.com",
+			ClusterConfig: cc,
+			ServiceList:   svcList,
+		})
+		assert.Equal(t, []string{"www.acme.com", "www.acme.com:443"}, hosts.domains[svcExact.Metadata.Name])
+		assert.Equal(t, []string{"*.acme.com", "*.acme.com:443"}, hosts.domains[svcWildcard.Metadata.Name])
+		assert.Equal(t, 3, len(hosts.regexes))
+		assert.Equal(t, svcRegex.Metadata.Name, hosts.regexes[0].svc.Metadata.Name)
+		assert.Equal(t, svcRegexDup.Metadata.Name, hosts.regexes[2].svc.Metadata.Name)
+		assert.Nil(t, hosts.defaultService)
+	}
+
+	{
+		cc.Spec.Ingress = &corev1.ClusterConfig_Spec_Ingress{
+			DefaultService: svcDefault.Metadata.Name,
+		}
+		assert.Equal(t, getClusterNameFromService(svcDefault), getCluster("unknown.example.org"))
+		assert.Equal(t, getClusterNameFromService(svcExact), getCluster("www.acme.com"))
+
+		cc.Spec.Ingress.DefaultService = "unknown.default"
+		assert.Equal(t, "", getCluster("unknown.example.org"))
+		cc.Spec.Ingress = nil
+	}
+
+	{
+		r := &GetListenersReq{
+			Domain:        "example.com",
+			ClusterConfig: cc,
+			ServiceList:   []*corev1.Service{svcWildcard, svcExact, svc2},
+		}
+		assert.Equal(t, []string{"example.com", "*.example.com", "www.acme.com", "svc2.example.com", "*.acme.com"},
+			getServerNames(r))
+		assert.False(t, hasCatchAllServerNames(r))
+
+		lis, err := getListener(ctx, r)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(lis.FilterChains))
+		assert.Equal(t, getServerNames(r), lis.FilterChains[0].FilterChainMatch.ServerNames)
+
+		r.ServiceList = svcList
+		assert.Equal(t, []string{"example.com", "*.example.com", "www.acme.com", "svc2.example.com",
+			"*.eu.acme.com", "*.acme.com"}, getServerNames(r))
+		assert.True(t, hasCatchAllServerNames(r))
+
+		lis, err = getListener(ctx, r)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(lis.FilterChains))
+		assert.Equal(t, getServerNames(r), lis.FilterChains[0].FilterChainMatch.ServerNames)
+		assert.Equal(t, 0, len(lis.FilterChains[1].FilterChainMatch.ServerNames))
+
+		r.ServiceList = []*corev1.Service{svc2}
+		r.ClusterConfig = &corev1.ClusterConfig{
+			Spec: &corev1.ClusterConfig_Spec{
+				Ingress: &corev1.ClusterConfig_Spec_Ingress{
+					DefaultService: svc2.Metadata.Name,
+				},
+			},
+		}
+		assert.Equal(t, []string{"example.com", "*.example.com"}, getServerNames(r))
+		assert.True(t, hasCatchAllServerNames(r))
+
+		r.HasFrontProxy = true
+		lis, err = getListener(ctx, r)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(lis.FilterChains))
+		assert.Nil(t, lis.FilterChains[0].FilterChainMatch.ServerNames)
+	}
+}
@@ -24,8 +24,10 @@ import (
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/cluster/common/components"
+	"github.com/octelium/octelium/cluster/common/healthcheck"
 	"github.com/octelium/octelium/cluster/common/k8sutils"
 	"github.com/octelium/octelium/cluster/common/octeliumc"
+	"github.com/octelium/octelium/cluster/common/otelutils"
 	"github.com/octelium/octelium/cluster/common/vutils"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
 	utils_types "github.com/octelium/octelium/pkg/utils/types"
@@ -68,8 +70,13 @@ func (c *Controller) deployK8sResources(ctx context.Context, svc *corev1.Service
 		return err
 	}
 
+	cc, err := c.octeliumC.CoreV1Utils().GetClusterConfig(ctx)
+	if err != nil {
+		return err
+	}
+
 	if _, err := k8sutils.CreateOrUpdateDeployment(ctx, c.k8sC,
-		c.newDeployment(svc, ownerCM)); err != nil {
+		c.newDeployment(svc, cc, ownerCM)); err != nil {
 		return err
 	}
 
@@ -129,11 +136,11 @@ func (c *Controller) OnUpdate(ctx context.Context, newSvc, oldSvc *corev1.Servic
 	return nil
 }
 
-func (c *Controller) newPodSpec(svc *corev1.Service) k8scorev1.PodSpec {
-	return c.newPodSpecVigil(svc)
+func (c *Controller) newPodSpec(svc *corev1.Service, cc *corev1.ClusterConfig) k8scorev1.PodSpec {
+	return c.newPodSpecVigil(svc, cc)
 }
 
-func (c *Controller) newPodSpecVigil(svc *corev1.Service) k8scorev1.PodSpec {
+func (c *Controller) newPodSpecVigil(svc *corev1.Service, cc *corev1.ClusterConfig) k8scorev1.PodSpec {
 	ret := k8scorev1.PodSpec{
 		NodeSelector: func() map[string]string {
 			return map[string]string{
@@ -183,6 +190,18 @@ func (c *Controller) newPodSpecVigil(svc *corev1.Service) k8scorev1.PodSpec {
 					},
 				},
 
+				ReadinessProbe: &k8scorev1.Probe{
+					TimeoutSeconds:   4,
+					PeriodSeconds:    5,
+					FailureThreshold: 1,
+					ProbeHandler: k8scorev1.ProbeHandler{
+						GRPC: &k8scorev1.GRPCAction{
+							Port:    int32(vutils.HealthCheckPortVigil),
+							Service: utils_types.StrToPtr(healthcheck.ServiceReadiness),
+						},
+					},
+				},
+
 				SecurityContext: &k8scorev1.SecurityContext{
 					Privileged:               utils_types.BoolToPtr(false),
 					AllowPrivilegeEscalation: utils_types.BoolToPtr(false),
@@ -241,6 +260,43 @@ func (c *Controller) newPodSpecVigil(svc *corev1.Service) k8scorev1.PodSpec {
 		},
 	}
 
+	if sizeLimit := getCacheDiskSizeLimit(svc); sizeLimit > 0 {
+		ret.Volumes = append(ret.Volumes, k8scorev1.Volume{
+			Name: cacheDiskVolumeName,
+			VolumeSource: k8scorev1.VolumeSource{
+				EmptyDir: &k8scorev1.EmptyDirVolumeSource{
+					SizeLimit: resource.NewQuantity(sizeLimit, resource.BinarySI),
+				},
+			},
+		})
+
+		ret.Containers[0].VolumeMounts = append(ret.Containers[0].VolumeMounts, k8scorev1.VolumeMount{
+			Name:      cacheDiskVolumeName,
+			MountPath: cacheDiskMountPath,
+		})
+
+		ret.Containers[0].Env = append(ret.Containers[0].Env, k8scorev1.EnvVar{
+			Name:  "OCTELIUM_CACHE_DISK_DIR",
+			Value: cacheDiskMountPath,
+		})
+	}
+
+	if sizeLimit := otelutils.GetAccessLogFilesMaxSize(cc.Spec.AccessLog); sizeLimit > 0 {
+		ret.Volumes = append(ret.Volumes, k8scorev1.Volume{
+			Name: accessLogVolumeName,
+			VolumeSource: k8scorev1.VolumeSource{
+				EmptyDir: &k8scorev1.EmptyDirVolumeSource{
+					SizeLimit: resource.NewQuantity(sizeLimit+accessLogVolumeHeadroom, resource.BinarySI),
+				},
+			},
+		})
+
+		ret.Containers[0].VolumeMounts = append(ret.Containers[0].VolumeMounts, k8scorev1.VolumeMount{
+			Name:      accessLogVolumeName,
+			MountPath: otelutils.AccessLogDir,
+		})
+	}
+
 	if ucorev1.ToService(svc).IsManagedService() && svc.Status.ManagedService != nil {
 
 		if svc.Status.ManagedService.ImagePullSecret != "" {
@@ -416,7 +472,8 @@ func (c *Controller) getPodAnnotations(svc *corev1.Service) map[string]string {
 	return ret
 }
 
-func (c *Controller) newDeployment(svc *corev1.Service, ownerCM *k8scorev1.ConfigMap) *appsv1.Deployment {
+func (c *Controller) newDeployment(svc *corev1.Service,
+	cc *corev1.ClusterConfig, ownerCM *k8scorev1.ConfigMap) *appsv1.Deployment {
 
 	labels := c.getPodLabels(svc)
 	podAnnotations := c.getPodAnnotations(svc)
@@ -445,7 +502,7 @@ func (c *Controller) newDeployment(svc *corev1.Service, ownerCM *k8scorev1.Confi
 					Labels:      labels,
 					Annotations: podAnnotations,
 				},
-				Spec: c.newPodSpec(svc),
+				Spec: c.newPodSpec(svc, cc),
 			},
 		},
 	}
@@ -554,3 +611,58 @@ func getDefaultLimits() k8scorev1.ResourceList {
 		k8scorev1.ResourceCPU:    resource.MustParse("1200m"),
 	}
 }
+
+const (
+	cacheDiskVolumeName = "cache-disk"
+	cacheDiskMountPath  = "/var/cache/octelium"
+
+	accessLogVolumeName = "access-log"
+	// accessLogVolumeHeadroom covers a batch that alone exceeds the maximum
+	// size of a file since it is written before the file is rotated.
+	accessLogVolumeHeadroom = 16 << 20
+
+	defaultCacheDiskMaxTotalSize = 1 << 30
+	defaultCacheDiskMaxEntrySize = 128 << 20
+)
+
+// getCacheDiskSizeLimit returns the size limit of the volume used by the
+// on-disk store of the cache plugins, or zero if no cache plugin of any config
+// enables it. Since all the plugins share the same store, the limit is the
+// largest total size budget plus the largest entry size as a headroom for the
+// entry being written before the least recently used entries are evicted.
+func getCacheDiskSizeLimit(svc *corev1.Service) int64 {
+	var maxTotalSize, maxEntrySize uint64
+	isEnabled := false
+
+	setConfig := func(cfg *corev1.Service_Spec_Config) {
+		for _, plugin := range cfg.GetHttp().GetPlugins() {
+			diskC := plugin.GetCache().GetDisk()
+			if plugin.IsDisabled || !diskC.GetIsEnabled() {
+				continue
+			}
+			isEnabled = true
+			maxTotalSize = max(maxTotalSize, getOrDefault(diskC.MaxTotalSize, defaultCacheDiskMaxTotalSize))
+			maxEntrySize = max(maxEntrySize, getOrDefault(diskC.MaxEntrySize, defaultCacheDiskMaxEntrySize))
+		}
+	}
+
+	setConfig(svc.Spec.Config)
+	if svc.Spec.DynamicConfig != nil {
+		for _, cfg := range svc.Spec.DynamicConfig.Configs {
+			setConfig(cfg)
+		}
+	}
+
+	if !isEnabled {
+		return 0
+	}
+
+	return int64(maxTotalSize + maxEntrySize)
+}
+
+func getOrDefault(val, def uint64) uint64 {
+	if val == 0 {
+		return def
+	}
+	return val
+}
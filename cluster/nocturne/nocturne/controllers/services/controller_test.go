@@ -21,10 +21,14 @@ import (
 	"os"
 	"testing"
 
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
 	"github.com/octelium/octelium/apis/rsc/rmetav1"
 	"github.com/octelium/octelium/cluster/apiserver/apiserver/admin"
+	"github.com/octelium/octelium/cluster/common/otelutils"
 	"github.com/octelium/octelium/cluster/common/tests"
 	"github.com/stretchr/testify/assert"
+	k8scorev1 "k8s.io/api/core/v1"
 )
 
 func TestController(t *testing.T) {
@@ -63,3 +67,117 @@ func TestController(t *testing.T) {
 	err = c.OnDelete(ctx, svcV)
 	assert.Nil(t, err)
 }
+
+func TestGetCacheDiskSizeLimit(t *testing.T) {
+
+	newPlugin := func(disk *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Disk) *corev1.Service_Spec_Config_HTTP_Plugin {
+		return &corev1.Service_Spec_Config_HTTP_Plugin{
+			Name: "cache",
+			Type: &corev1.Service_Spec_Config_HTTP_Plugin_Cache_{
+				Cache: &corev1.Service_Spec_Config_HTTP_Plugin_Cache{
+					Disk: disk,
+				},
+			},
+		}
+	}
+
+	newSvc := func(plugins ...*corev1.Service_Spec_Config_HTTP_Plugin) *corev1.Service {
+		return &corev1.Service{
+			Spec: &corev1.Service_Spec{
+				Config: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							Plugins: plugins,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	assert.Equal(t, int64(0), getCacheDiskSizeLimit(&corev1.Service{Spec: &corev1.Service_Spec{}}))
+	assert.Equal(t, int64(0), getCacheDiskSizeLimit(newSvc(newPlugin(nil))))
+	assert.Equal(t, int64(0), getCacheDiskSizeLimit(newSvc(newPlugin(
+		&corev1.Service_Spec_Config_HTTP_Plugin_Cache_Disk{}))))
+
+	assert.Equal(t, int64(defaultCacheDiskMaxTotalSize+defaultCacheDiskMaxEntrySize),
+		getCacheDiskSizeLimit(newSvc(newPlugin(&corev1.Service_Spec_Config_HTTP_Plugin_Cache_Disk{
+			IsEnabled: true,
+		}))))
+
+	{
+		svc := newSvc(newPlugin(&corev1.Service_Spec_Config_HTTP_Plugin_Cache_Disk{
+			IsEnabled:    true,
+			MaxTotalSize: 1000,
+			MaxEntrySize: 100,
+		}))
+		assert.Equal(t, int64(1100), getCacheDiskSizeLimit(svc))
+
+		svc.Spec.DynamicConfig = &corev1.Service_Spec_DynamicConfig{
+			Configs: []*corev1.Service_Spec_Config{
+				newSvc(newPlugin(&corev1.Service_Spec_Config_HTTP_Plugin_Cache_Disk{
+					IsEnabled:    true,
+					MaxTotalSize: 2000,
+					MaxEntrySize: 50,
+				})).Spec.Config,
+			},
+		}
+		assert.Equal(t, int64(2100), getCacheDiskSizeLimit(svc))
+
+		svc.Spec.Config.GetHttp().Plugins[0].IsDisabled = true
+		assert.Equal(t, int64(2050), getCacheDiskSizeLimit(svc))
+	}
+}
+
+func TestNewPodSpecVolumes(t *testing.T) {
+	c := &Controller{}
+
+	svc := &corev1.Service{
+		Metadata: &metav1.Metadata{
+			Name: "svc.default",
+			Uid:  "uid",
+		},
+		Spec: &corev1.Service_Spec{
+			Config: &corev1.Service_Spec_Config{},
+		},
+		Status: &corev1.Service_Status{},
+	}
+	cc := &corev1.ClusterConfig{
+		Spec: &corev1.ClusterConfig_Spec{},
+	}
+
+	getVolume := func(spec k8scorev1.PodSpec, name string) (*k8scorev1.Volume, *k8scorev1.VolumeMount) {
+		var vol *k8scorev1.Volume
+		var mount *k8scorev1.VolumeMount
+		for i := range spec.Volumes {
+			if spec.Volumes[i].Name == name {
+				vol = &spec.Volumes[i]
+			}
+		}
+		for i := range spec.Containers[0].VolumeMounts {
+			if spec.Containers[0].VolumeMounts[i].Name == name {
+				mount = &spec.Containers[0].VolumeMounts[i]
+			}
+		}
+		return vol, mount
+	}
+
+	{
+		spec := c.newPodSpec(svc, cc)
+		vol, mount := getVolume(spec, accessLogVolumeName)
+		assert.Nil(t, vol)
+		assert.Nil(t, mount)
+	}
+
+	{
+		cc.Spec.AccessLog = &corev1.ClusterConfig_Spec_AccessLog{
+			Sinks: []string{"stdout", "file:///var/log/octelium/access.log?maxSizeMB=10&maxBackups=1"},
+		}
+
+		spec := c.newPodSpec(svc, cc)
+		vol, mount := getVolume(spec, accessLogVolumeName)
+		assert.NotNil(t, vol)
+		assert.Equal(t, int64(2*10*1024*1024+accessLogVolumeHeadroom), vol.EmptyDir.SizeLimit.Value())
+		assert.Equal(t, otelutils.AccessLogDir, mount.MountPath)
+	}
+}
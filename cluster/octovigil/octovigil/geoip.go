@@ -0,0 +1,73 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package octovigil
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"go.uber.org/zap"
+)
+
+func (s *Server) setGeoIPCtl(ctx context.Context, cc *corev1.ClusterConfig) {
+	if cc.Spec.Authentication == nil || cc.Spec.Authentication.Geolocation == nil ||
+		cc.Spec.Authentication.Geolocation.GetMmdb() == nil {
+		s.geoipCtl.Unset()
+		return
+	}
+
+	if err := s.geoipCtl.Set(ctx, cc.Spec.Authentication.Geolocation.GetMmdb()); err != nil {
+		zap.L().Warn("Could not set geoipCtl", zap.Error(err))
+	}
+}
+
+func (s *Server) onClusterConfigUpdate(ctx context.Context, new, old *corev1.ClusterConfig) error {
+	if !pbutils.IsEqual(new.Spec.Authentication, old.Spec.Authentication) {
+		s.setGeoIPCtl(ctx, new)
+	}
+
+	return nil
+}
+
+// getGeoIP resolves the geolocation of the public IP address of the
+// downstream request. Requests coming from the clients through the Cluster
+// network have no public address and hence are not resolved. It returns nil
+// if no MMDB is loaded.
+func (s *Server) getGeoIP(req *coctovigilv1.DownstreamRequest) *corev1.GeoIP {
+	if req == nil || req.Source == nil || req.Source.Address == "" {
+		return nil
+	}
+
+	if s.isAddressFromClient(req.Source.Address) {
+		return nil
+	}
+
+	addrStr := req.Source.Address
+	if hdr := s.getHTTPHeadersFromReq(req); hdr != nil && hdr["x-envoy-external-address"] != "" {
+		addrStr = hdr["x-envoy-external-address"]
+	}
+
+	addr, err := netip.ParseAddr(addrStr)
+	if err != nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return nil
+	}
+
+	return s.geoipCtl.Resolve(addr)
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/octelium/octelium/cluster/common/ccctl"
 	"github.com/octelium/octelium/cluster/common/celengine"
 	"github.com/octelium/octelium/cluster/common/commoninit"
+	"github.com/octelium/octelium/cluster/common/geoipctl"
 	"github.com/octelium/octelium/cluster/common/healthcheck"
 	"github.com/octelium/octelium/cluster/common/jwkctl"
 	"github.com/octelium/octelium/cluster/common/octeliumc"
@@ -79,6 +80,8 @@ type Server struct {
 	commonMetrics    *commonMetrics
 
 	coreSrv *admin.Server
+
+	geoipCtl *geoipctl.Controller
 }
 
 type policyTriggerCtl struct {
@@ -153,10 +156,20 @@ func New(ctx context.Context, octeliumC octeliumc.ClientInterface) (*Server, err
 		return nil, err
 	}
 
-	ret.ccCtl, err = ccctl.New(ctx, octeliumC, &ccctl.Opts{})
+	ret.ccCtl, err = ccctl.New(ctx, octeliumC, &ccctl.Opts{
+		OnUpdate: ret.onClusterConfigUpdate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret.geoipCtl, err = geoipctl.New(ctx, &geoipctl.Opts{
+		OcteliumC: octeliumC,
+	})
 	if err != nil {
 		return nil, err
 	}
+	ret.setGeoIPCtl(ctx, cc)
 
 	ret.commonMetrics, err = newCommonMetrics(ctx)
 	if err != nil {
@@ -410,6 +423,7 @@ func (s *Server) AuthenticateAndAuthorize(ctx context.Context, req *coctovigilv1
 
 	ret.IsAuthenticated = true
 	ret.RequestContext = s.getReqCtx(downstreamInfo, req.Request.Request, req.Service)
+	ret.RequestContext.Geoip = s.getGeoIP(req.Request)
 
 	isAuthorized, reason, err := s.isAuthorizedWithMetrics(ctx, ret.RequestContext)
 	if err != nil {
@@ -730,6 +744,10 @@ func (s *Server) run(ctx context.Context) error {
 		return err
 	}
 
+	if err := s.geoipCtl.Run(ctx); err != nil {
+		return err
+	}
+
 	if err := s.jwkCtl.Run(ctx); err != nil {
 		return err
 	}
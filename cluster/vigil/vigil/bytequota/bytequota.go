@@ -0,0 +1,182 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bytequota
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Usage is the number of bytes exchanged by an identity within the window
+// starting at WindowStart.
+type Usage struct {
+	Key         string    `json:"key"`
+	WindowStart time.Time `json:"windowStart"`
+	BytesIn     int64     `json:"bytesIn"`
+	BytesOut    int64     `json:"bytesOut"`
+}
+
+func (u *Usage) Total() int64 {
+	return u.BytesIn + u.BytesOut
+}
+
+// Store accumulates the Usage of the identities. The in-memory store is
+// local to the Vigil instance, a shared backend can implement the interface
+// to enforce the quotas across instances.
+type Store interface {
+	// Add adds the bytes to the Usage of the key within the window and
+	// returns the updated Usage. The Usage of a previous window is reset.
+	Add(ctx context.Context, key string, windowStart time.Time, bytesIn, bytesOut int64) (*Usage, error)
+
+	// Get returns the Usage of the key within the window.
+	Get(ctx context.Context, key string, windowStart time.Time) (*Usage, error)
+
+	// List returns the Usage of all the keys within their latest window.
+	List(ctx context.Context) ([]*Usage, error)
+}
+
+type MemoryStore struct {
+	mu     sync.Mutex
+	usages map[string]*Usage
+	latest time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		usages: make(map[string]*Usage),
+	}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, key string,
+	windowStart time.Time, bytesIn, bytesOut int64) (*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(windowStart)
+
+	usage, ok := s.usages[key]
+	if !ok || usage.WindowStart.Before(windowStart) {
+		usage = &Usage{
+			Key:         key,
+			WindowStart: windowStart,
+		}
+		s.usages[key] = usage
+	}
+
+	usage.BytesIn += bytesIn
+	usage.BytesOut += bytesOut
+
+	ret := *usage
+	return &ret, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string, windowStart time.Time) (*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage, ok := s.usages[key]
+	if !ok || usage.WindowStart.Before(windowStart) {
+		return &Usage{
+			Key:         key,
+			WindowStart: windowStart,
+		}, nil
+	}
+
+	ret := *usage
+	return &ret, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*Usage, error) {
+	s.mu.Lock()
+	ret := make([]*Usage, 0, len(s.usages))
+	for _, usage := range s.usages {
+		itm := *usage
+		ret = append(ret, &itm)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(ret, func(a, b *Usage) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return ret, nil
+}
+
+// pruneLocked removes the Usage of the previous windows once a new window
+// starts so that the identities that are gone do not accumulate.
+func (s *MemoryStore) pruneLocked(windowStart time.Time) {
+	if !windowStart.After(s.latest) {
+		return
+	}
+	s.latest = windowStart
+
+	for key, usage := range s.usages {
+		if usage.WindowStart.Before(windowStart) {
+			delete(s.usages, key)
+		}
+	}
+}
+
+type usageState struct {
+	*Usage
+	MaxBytes   uint64 `json:"maxBytes,omitempty"`
+	IsExceeded bool   `json:"isExceeded"`
+}
+
+// NewHandler returns a handler serving the Usage of the store as JSON as well
+// as whether the quota returned by getMaxBytes is exceeded.
+func NewHandler(store Store, getMaxBytes func() uint64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		usages, err := store.List(req.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		maxBytes := getMaxBytes()
+		ret := make([]*usageState, 0, len(usages))
+		for _, usage := range usages {
+			ret = append(ret, &usageState{
+				Usage:      usage,
+				MaxBytes:   maxBytes,
+				IsExceeded: IsExceeded(usage, maxBytes),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"usages": ret,
+		})
+	})
+}
+
+// IsExceeded returns whether the Usage has reached the quota. A zero quota is
+// never exceeded.
+func IsExceeded(usage *Usage, maxBytes uint64) bool {
+	return maxBytes > 0 && usage.Total() >= 0 && uint64(usage.Total()) >= maxBytes
+}
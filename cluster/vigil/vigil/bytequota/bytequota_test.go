@@ -0,0 +1,123 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bytequota
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	w0 := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	w1 := w0.Add(time.Hour)
+
+	usage, err := store.Get(ctx, "k1", w0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), usage.Total())
+
+	usage, err = store.Add(ctx, "k1", w0, 10, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), usage.Total())
+
+	usage, err = store.Add(ctx, "k1", w0, 5, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), usage.BytesIn)
+	assert.Equal(t, int64(25), usage.BytesOut)
+
+	_, err = store.Add(ctx, "k2", w0, 1, 1)
+	assert.Nil(t, err)
+
+	usages, err := store.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(usages))
+	assert.Equal(t, "k1", usages[0].Key)
+	assert.Equal(t, "k2", usages[1].Key)
+
+	assert.False(t, IsExceeded(usages[0], 0))
+	assert.False(t, IsExceeded(usages[0], 41))
+	assert.True(t, IsExceeded(usages[0], 40))
+
+	// The Usage of the previous window is not returned for the new window.
+	usage, err = store.Get(ctx, "k1", w1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), usage.Total())
+	assert.Equal(t, w1, usage.WindowStart)
+
+	// Starting a new window resets the usage and prunes the stale keys.
+	usage, err = store.Add(ctx, "k1", w1, 1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), usage.Total())
+
+	usages, err = store.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(usages))
+	assert.Equal(t, "k1", usages[0].Key)
+	assert.Equal(t, w1, usages[0].WindowStart)
+
+	// A late report for the previous window is added to the current one.
+	usage, err = store.Add(ctx, "k1", w0, 100, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(101), usage.Total())
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	windowStart := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	_, err := store.Add(ctx, "k1", windowStart, 60, 60)
+	assert.Nil(t, err)
+	_, err = store.Add(ctx, "k2", windowStart, 10, 0)
+	assert.Nil(t, err)
+
+	handler := NewHandler(store, func() uint64 {
+		return 100
+	})
+
+	{
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/debug/quotas", nil))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var res struct {
+			Usages []*usageState `json:"usages"`
+		}
+		err = json.Unmarshal(rw.Body.Bytes(), &res)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(res.Usages))
+		assert.Equal(t, "k1", res.Usages[0].Key)
+		assert.True(t, res.Usages[0].IsExceeded)
+		assert.Equal(t, uint64(100), res.Usages[0].MaxBytes)
+		assert.Equal(t, "k2", res.Usages[1].Key)
+		assert.False(t, res.Usages[1].IsExceeded)
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/debug/quotas", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	}
+}
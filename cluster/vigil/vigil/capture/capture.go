@@ -0,0 +1,139 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package capture
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const maxStoreSize = 64 * 1024 * 1024
+
+type Entry struct {
+	ID          string        `json:"id"`
+	ServiceName string        `json:"serviceName,omitempty"`
+	Timestamp   time.Time     `json:"timestamp"`
+	Duration    time.Duration `json:"duration"`
+	Request     *Request      `json:"request"`
+	Response    *Response     `json:"response"`
+}
+
+type Request struct {
+	Method        string      `json:"method"`
+	URI           string      `json:"uri"`
+	Host          string      `json:"host"`
+	Proto         string      `json:"proto"`
+	Headers       http.Header `json:"headers,omitempty"`
+	Body          []byte      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+}
+
+type Response struct {
+	StatusCode    int         `json:"statusCode"`
+	Headers       http.Header `json:"headers,omitempty"`
+	Body          []byte      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+}
+
+func (e *Entry) size() int {
+	ret := 0
+	if e.Request != nil {
+		ret += len(e.Request.Body) + len(e.Request.URI) + headerSize(e.Request.Headers)
+	}
+	if e.Response != nil {
+		ret += len(e.Response.Body) + headerSize(e.Response.Headers)
+	}
+	return ret
+}
+
+func headerSize(hdr http.Header) int {
+	ret := 0
+	for k, vals := range hdr {
+		for _, v := range vals {
+			ret += len(k) + len(v)
+		}
+	}
+	return ret
+}
+
+// Store is an in-memory ring buffer of the captured request/response pairs.
+// It is bounded by both the number of entries and their total size, evicting
+// the oldest entries first.
+type Store struct {
+	mu      sync.Mutex
+	entries []*Entry
+	size    int
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+func (s *Store) Add(e *Entry, maxEntries int) {
+	if e == nil || maxEntries <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, e)
+	s.size += e.size()
+
+	for len(s.entries) > 0 && (len(s.entries) > maxEntries || s.size > maxStoreSize) {
+		s.size -= s.entries[0].size()
+		s.entries[0] = nil
+		s.entries = s.entries[1:]
+	}
+}
+
+// List returns the retained entries from the oldest to the newest.
+func (s *Store) List() []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := make([]*Entry, len(s.entries))
+	copy(ret, s.entries)
+	return ret
+}
+
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = nil
+	s.size = 0
+}
+
+// ServeHTTP serves the captures as JSON. A DELETE request clears them.
+func (s *Store) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"entries": s.List(),
+		})
+	case http.MethodDelete:
+		s.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package vigil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/cluster/common/healthcheck"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	maxDrainTimeout     = 30 * time.Minute
+)
+
+// drainer drains the Server on demand so that the instance can be removed
+// safely. The readiness is first set to not ready so that the load balancers
+// stop routing new connections to the instance.
+type drainer struct {
+	mu        sync.Mutex
+	getServer func() modes.Server
+
+	startedAt time.Time
+	timeout   time.Duration
+	doneAt    time.Time
+	err       error
+}
+
+type drainStatus struct {
+	State             string     `json:"state"`
+	StartedAt         *time.Time `json:"startedAt,omitempty"`
+	DoneAt            *time.Time `json:"doneAt,omitempty"`
+	Timeout           string     `json:"timeout,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	IsSupported       bool       `json:"isSupported"`
+	Connections       int        `json:"connections"`
+	ActiveConnections int        `json:"activeConnections"`
+}
+
+func newDrainer(getServer func() modes.Server) *drainer {
+	return &drainer{
+		getServer: getServer,
+	}
+}
+
+// start starts draining unless it has already been started.
+func (d *drainer) start(timeout time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.startedAt.IsZero() {
+		return false
+	}
+
+	d.startedAt = time.Now()
+	d.timeout = timeout
+	healthcheck.SetReady(false)
+
+	zap.L().Info("Starting draining", zap.Duration("timeout", timeout))
+
+	go func() {
+		var err error
+		if srv, ok := d.getServer().(modes.Drainer); ok {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err = srv.Drain(ctx)
+			cancel()
+		}
+
+		if err != nil {
+			zap.L().Warn("Draining did not complete before the timeout", zap.Error(err))
+		} else {
+			zap.L().Info("Draining completed")
+		}
+
+		d.mu.Lock()
+		d.doneAt = time.Now()
+		d.err = err
+		d.mu.Unlock()
+	}()
+
+	return true
+}
+
+func (d *drainer) isStarted() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return !d.startedAt.IsZero()
+}
+
+func (d *drainer) status() *drainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ret := &drainStatus{
+		State: "serving",
+	}
+
+	if srv, ok := d.getServer().(modes.Drainer); ok {
+		ret.IsSupported = true
+		ret.Connections, ret.ActiveConnections = srv.Connections()
+	}
+
+	if d.startedAt.IsZero() {
+		return ret
+	}
+
+	startedAt := d.startedAt
+	ret.State = "draining"
+	ret.StartedAt = &startedAt
+	ret.Timeout = d.timeout.String()
+
+	if !d.doneAt.IsZero() {
+		doneAt := d.doneAt
+		ret.State = "drained"
+		ret.DoneAt = &doneAt
+		if d.err != nil {
+			ret.Error = d.err.Error()
+		}
+	}
+
+	return ret
+}
+
+// ServeHTTP serves the drain status as JSON. A POST request starts draining
+// with an optional timeout query parameter (e.g. "?timeout=2m") after which
+// the remaining connections are closed.
+func (d *drainer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		timeout := defaultDrainTimeout
+		if val := req.URL.Query().Get("timeout"); val != "" {
+			var err error
+			timeout, err = time.ParseDuration(val)
+			if err != nil || timeout <= 0 || timeout > maxDrainTimeout {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if !d.start(timeout) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.status())
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package loadbalancer
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/utils/utilrand"
+	"github.com/pkg/errors"
+)
+
+const (
+	// latencyDecay is the time constant of the latency EWMA. A sample that is
+	// latencyDecay old weighs 1/e of a fresh one.
+	latencyDecay = 10 * time.Second
+	// latencyMinSamples is the number of samples below which an endpoint is
+	// scored as the average endpoint.
+	latencyMinSamples = 5
+	// latencyStaleAfter is the duration after which the EWMA of an endpoint
+	// that has not been picked is no longer trusted. This lets endpoints with
+	// a bad score get picked again and recover.
+	latencyStaleAfter = 3 * latencyDecay
+	// latencyErrorPenalty is the minimum latency recorded for a request that
+	// failed before the upstream responded. It prevents an endpoint that
+	// refuses connections from looking fast.
+	latencyErrorPenalty = 5 * time.Second
+)
+
+type latencyStats struct {
+	inFlight atomic.Int64
+
+	mu         sync.Mutex
+	ewma       float64
+	samples    int
+	lastUpdate time.Time
+}
+
+type latencyScorer struct {
+	mu    sync.RWMutex
+	stats map[string]*latencyStats
+	now   func() time.Time
+}
+
+func newLatencyScorer() *latencyScorer {
+	return &latencyScorer{
+		stats: make(map[string]*latencyStats),
+		now:   time.Now,
+	}
+}
+
+func getEndpointKey(ep *corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint) string {
+	if ep.User != "" {
+		return ep.Url + "#" + ep.User
+	}
+	return ep.Url
+}
+
+func (s *latencyScorer) get(key string) *latencyStats {
+	s.mu.RLock()
+	ret, ok := s.stats[key]
+	s.mu.RUnlock()
+	if ok {
+		return ret
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ret, ok := s.stats[key]; ok {
+		return ret
+	}
+	ret = &latencyStats{}
+	s.stats[key] = ret
+	return ret
+}
+
+func (s *latencyScorer) observe(st *latencyStats, latency time.Duration, err error) {
+	if err != nil && latency < latencyErrorPenalty {
+		latency = latencyErrorPenalty
+	}
+
+	now := s.now()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.samples == 0 || now.Sub(st.lastUpdate) > latencyStaleAfter {
+		st.ewma = float64(latency)
+		st.samples = 1
+	} else {
+		w := math.Exp(-float64(now.Sub(st.lastUpdate)) / float64(latencyDecay))
+		st.ewma = st.ewma*w + float64(latency)*(1-w)
+		st.samples++
+	}
+	st.lastUpdate = now
+}
+
+// latency returns the EWMA of the endpoint and whether it has enough recent
+// samples to be trusted.
+func (s *latencyStats) latency(now time.Time) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.samples < latencyMinSamples || now.Sub(s.lastUpdate) > latencyStaleAfter {
+		return s.ewma, false
+	}
+	return s.ewma, true
+}
+
+// pick returns the index of the chosen endpoint using the power of two
+// choices. Always picking the best scored endpoint would send every request
+// to the same endpoint until its score catches up.
+func (s *latencyScorer) pick(eps []*corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint,
+	leastRequest bool) int {
+	if len(eps) < 2 {
+		return 0
+	}
+
+	now := s.now()
+	stats := make([]*latencyStats, len(eps))
+	latencies := make([]float64, len(eps))
+	known := make([]bool, len(eps))
+
+	var sum float64
+	var count int
+	for i, ep := range eps {
+		stats[i] = s.get(getEndpointKey(ep))
+		latencies[i], known[i] = stats[i].latency(now)
+		if known[i] {
+			sum += latencies[i]
+			count++
+		}
+	}
+
+	var avg float64
+	if count > 0 {
+		avg = sum / float64(count)
+	}
+
+	score := func(i int) float64 {
+		ret := avg
+		if known[i] {
+			ret = latencies[i]
+		}
+		if leastRequest {
+			ret = ret * float64(stats[i].inFlight.Load()+1)
+		}
+		return ret
+	}
+
+	a := utilrand.GetRandomRangeMath(0, len(eps)-1)
+	b := utilrand.GetRandomRangeMath(0, len(eps)-2)
+	if b >= a {
+		b++
+	}
+
+	if score(b) < score(a) {
+		return b
+	}
+	return a
+}
+
+type latencyScore struct {
+	Endpoint  string  `json:"endpoint"`
+	LatencyMS float64 `json:"latencyMS"`
+	Samples   int     `json:"samples"`
+	InFlight  int64   `json:"inFlight"`
+	IsKnown   bool    `json:"isKnown"`
+}
+
+func (s *latencyScorer) scores() []*latencyScore {
+	now := s.now()
+
+	s.mu.RLock()
+	ret := make([]*latencyScore, 0, len(s.stats))
+	for key, st := range s.stats {
+		latency, known := st.latency(now)
+		st.mu.Lock()
+		samples := st.samples
+		st.mu.Unlock()
+		ret = append(ret, &latencyScore{
+			Endpoint:  key,
+			LatencyMS: latency / float64(time.Millisecond),
+			Samples:   samples,
+			InFlight:  st.inFlight.Load(),
+			IsKnown:   known,
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Endpoint < ret[j].Endpoint
+	})
+
+	return ret
+}
+
+// Track records a request that is sent to the Upstream. The returned function
+// must be called once the upstream has responded, or failed to, in order to
+// update the latency score of its endpoint.
+func (u *Upstream) Track() func(err error) {
+	if u.scorer == nil || u.stats == nil {
+		return func(err error) {}
+	}
+
+	u.stats.inFlight.Add(1)
+	startedAt := u.scorer.now()
+	var once sync.Once
+
+	return func(err error) {
+		once.Do(func() {
+			u.stats.inFlight.Add(-1)
+			if errors.Is(err, context.Canceled) {
+				// The request was canceled by the downstream, or by a
+				// hedged request that completed first, and says nothing
+				// about the endpoint.
+				return
+			}
+			u.scorer.observe(u.stats, u.scorer.now().Sub(startedAt), err)
+		})
+	}
+}
+
+// ServeHTTP serves the latency scores of the upstream endpoints.
+func (l *LBManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"endpoints": l.scorer.scores(),
+	})
+}
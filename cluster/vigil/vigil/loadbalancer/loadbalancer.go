@@ -43,6 +43,7 @@ type LBManager struct {
 
 	cache  *cache
 	vCache *vcache.Cache
+	scorer *latencyScorer
 }
 
 func NewLbManager(octeliumC octeliumc.ClientInterface, vCache *vcache.Cache) *LBManager {
@@ -50,6 +51,7 @@ func NewLbManager(octeliumC octeliumc.ClientInterface, vCache *vcache.Cache) *LB
 		octeliumC: octeliumC,
 		cache:     newCache(),
 		vCache:    vCache,
+		scorer:    newLatencyScorer(),
 	}
 }
 
@@ -64,6 +66,9 @@ type Upstream struct {
 	IsESSH           bool
 	Ed25519PublicKey []byte
 	SessionRef       *metav1.ObjectReference
+
+	scorer *latencyScorer
+	stats  *latencyStats
 }
 
 var ErrNoUpstream = errors.Errorf("No upstreams found")
@@ -76,7 +81,17 @@ func (l *LBManager) getUpstreamFromSvc(ctx context.Context,
 		return nil, ErrNoUpstream
 	}
 
-	u := upstrs[utilrand.GetRandomRangeMath(0, len(upstrs)-1)]
+	var u *corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint
+	var stats *latencyStats
+	switch policy := cfg.GetUpstream().GetLoadbalance().GetPolicy(); policy {
+	case corev1.Service_Spec_Config_Upstream_Loadbalance_LATENCY,
+		corev1.Service_Spec_Config_Upstream_Loadbalance_LATENCY_LEAST_REQUEST:
+		u = upstrs[l.scorer.pick(upstrs,
+			policy == corev1.Service_Spec_Config_Upstream_Loadbalance_LATENCY_LEAST_REQUEST)]
+		stats = l.scorer.get(getEndpointKey(u))
+	default:
+		u = upstrs[utilrand.GetRandomRangeMath(0, len(upstrs)-1)]
+	}
 
 	murl, err := url.Parse(u.Url)
 	if err != nil {
@@ -94,6 +109,8 @@ func (l *LBManager) getUpstreamFromSvc(ctx context.Context,
 			Port:     ucorev1.EndpointRealPort(u),
 			SNIHost:  getSNIHost(url.Hostname()),
 			URL:      url,
+			scorer:   l.scorer,
+			stats:    stats,
 		}, nil
 	}
 
@@ -136,6 +153,8 @@ func (l *LBManager) getUpstreamFromSvc(ctx context.Context,
 		Ed25519PublicKey: conn.Ed25519PublicKey,
 		SessionRef:       umetav1.GetObjectReference(sess),
 		URL:              url,
+		scorer:           l.scorer,
+		stats:            stats,
 	}
 
 	return ret, nil
@@ -150,6 +169,34 @@ func (l *LBManager) GetUpstream(ctx context.Context, authResp *coctovigilv1.Auth
 	return l.getUpstreamFromSvc(ctx, authResp.RequestContext.Service, vigilutils.GetServiceConfig(ctx, authResp))
 }
 
+// NewURLUpstream returns the Upstream of a URL that is not served by a User,
+// e.g. the upstream of another region.
+func NewURLUpstream(arg string) (*Upstream, error) {
+	murl, err := url.Parse(arg)
+	if err != nil {
+		return nil, err
+	}
+	if murl.Scheme == "" || murl.Hostname() == "" {
+		return nil, errors.Errorf("Invalid upstream URL: %s", arg)
+	}
+
+	url := &url.URL{
+		Scheme: murl.Scheme,
+		Host:   murl.Host,
+	}
+	port := ucorev1.EndpointRealPort(&corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint{
+		Url: arg,
+	})
+
+	return &Upstream{
+		HostPort: net.JoinHostPort(url.Hostname(), fmt.Sprintf("%d", port)),
+		Host:     url.Hostname(),
+		Port:     port,
+		SNIHost:  getSNIHost(url.Hostname()),
+		URL:      url,
+	}, nil
+}
+
 func getSNIHost(arg string) string {
 	if govalidator.IsIP(arg) {
 		return ""
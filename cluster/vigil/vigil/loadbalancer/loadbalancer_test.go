@@ -18,7 +18,14 @@ package loadbalancer
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
 	"github.com/octelium/octelium/apis/main/corev1"
@@ -28,6 +35,7 @@ import (
 	"github.com/octelium/octelium/cluster/common/tests/tstuser"
 	"github.com/octelium/octelium/cluster/vigil/vigil/vcache"
 	"github.com/octelium/octelium/pkg/utils/utilrand"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -363,3 +371,206 @@ func TestSetUpstreamSession(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, ErrNoUpstream, err)
 }
+
+func TestLatencyScorer(t *testing.T) {
+	now := time.Now()
+	scorer := newLatencyScorer()
+	scorer.now = func() time.Time {
+		return now
+	}
+
+	eps := []*corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint{
+		{Url: "http://fast"},
+		{Url: "http://slow"},
+	}
+
+	{
+		// No samples at all, every endpoint is average.
+		for range 20 {
+			idx := scorer.pick(eps, false)
+			assert.True(t, idx == 0 || idx == 1)
+		}
+	}
+
+	observe := func(key string, latency time.Duration, err error) {
+		scorer.observe(scorer.get(key), latency, err)
+	}
+
+	for range latencyMinSamples {
+		now = now.Add(100 * time.Millisecond)
+		observe("http://fast", 10*time.Millisecond, nil)
+		observe("http://slow", 500*time.Millisecond, nil)
+	}
+
+	for range 20 {
+		assert.Equal(t, 0, scorer.pick(eps, false))
+	}
+
+	{
+		// A new endpoint is scored as the average endpoint which is better
+		// than the slow one but worse than the fast one.
+		eps := []*corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint{
+			{Url: "http://fast"},
+			{Url: "http://slow"},
+			{Url: "http://new"},
+		}
+		picked := make(map[int]int)
+		for range 100 {
+			picked[scorer.pick(eps, false)]++
+		}
+		assert.Zero(t, picked[1])
+		assert.Greater(t, picked[0], picked[2])
+		assert.NotZero(t, picked[2])
+	}
+
+	{
+		// Users serving the same URL are scored separately.
+		assert.NotEqual(t, scorer.get(getEndpointKey(&corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint{
+			Url:  "http://fast",
+			User: "usr",
+		})), scorer.get("http://fast"))
+	}
+
+	{
+		// Failures are penalized even when they are fast.
+		st := scorer.get("http://refused")
+		scorer.observe(st, time.Millisecond, errors.New("refused"))
+		latency, _ := st.latency(now)
+		assert.Equal(t, float64(latencyErrorPenalty), latency)
+	}
+
+	{
+		// Stale endpoints are no longer trusted so that they can recover.
+		now = now.Add(latencyStaleAfter + time.Second)
+		_, known := scorer.get("http://slow").latency(now)
+		assert.False(t, known)
+		scorer.observe(scorer.get("http://slow"), time.Millisecond, nil)
+		latency, _ := scorer.get("http://slow").latency(now)
+		assert.Equal(t, float64(time.Millisecond), latency)
+	}
+
+	{
+		scorer := newLatencyScorer()
+		for range latencyMinSamples {
+			scorer.observe(scorer.get("http://a"), 10*time.Millisecond, nil)
+			scorer.observe(scorer.get("http://b"), 12*time.Millisecond, nil)
+		}
+		eps := []*corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint{
+			{Url: "http://a"},
+			{Url: "http://b"},
+		}
+		assert.Equal(t, 0, scorer.pick(eps, true))
+		scorer.get("http://a").inFlight.Add(3)
+		assert.Equal(t, 1, scorer.pick(eps, true))
+		assert.Equal(t, 0, scorer.pick(eps, false))
+	}
+
+	{
+		lb := &LBManager{
+			scorer: scorer,
+		}
+		u := &Upstream{
+			scorer: scorer,
+			stats:  scorer.get("http://fast"),
+		}
+		done := u.Track()
+		assert.Equal(t, int64(1), scorer.get("http://fast").inFlight.Load())
+		done(context.Canceled)
+		done(nil)
+		assert.Equal(t, int64(0), scorer.get("http://fast").inFlight.Load())
+
+		done = u.Track()
+		now = now.Add(10 * time.Millisecond)
+		done(nil)
+
+		rw := httptest.NewRecorder()
+		lb.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/debug/upstreams", nil))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var resp struct {
+			Endpoints []*latencyScore `json:"endpoints"`
+		}
+		err := json.Unmarshal(rw.Body.Bytes(), &resp)
+		assert.Nil(t, err)
+		assert.Equal(t, "http://fast", resp.Endpoints[0].Endpoint)
+		assert.False(t, resp.Endpoints[0].IsKnown)
+		assert.Equal(t, 1, resp.Endpoints[0].Samples)
+		assert.InDelta(t, 10, resp.Endpoints[0].LatencyMS, 0.01)
+	}
+}
+
+// simulateLatencyPolicy sends sequential requests to endpoints whose
+// latencies are exponentially distributed around their given means and
+// returns the p99 latency.
+func simulateLatencyPolicy(policy corev1.Service_Spec_Config_Upstream_Loadbalance_Policy,
+	means []time.Duration, requests int) time.Duration {
+	rnd := mrand.New(mrand.NewSource(1))
+	now := time.Unix(0, 0)
+	scorer := newLatencyScorer()
+	scorer.now = func() time.Time {
+		return now
+	}
+
+	var eps []*corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint
+	for i := range means {
+		eps = append(eps, &corev1.Service_Spec_Config_Upstream_Loadbalance_Endpoint{
+			Url: fmt.Sprintf("http://ep-%d", i),
+		})
+	}
+
+	latencies := make([]time.Duration, 0, requests)
+	for range requests {
+		var idx int
+		switch policy {
+		case corev1.Service_Spec_Config_Upstream_Loadbalance_LATENCY:
+			idx = scorer.pick(eps, false)
+		default:
+			idx = rnd.Intn(len(eps))
+		}
+
+		latency := time.Duration(rnd.ExpFloat64() * float64(means[idx]))
+		scorer.observe(scorer.get(getEndpointKey(eps[idx])), latency, nil)
+		latencies = append(latencies, latency)
+		now = now.Add(5 * time.Millisecond)
+	}
+
+	slices.Sort(latencies)
+	return latencies[len(latencies)*99/100]
+}
+
+func TestLatencyPolicySimulation(t *testing.T) {
+	means := []time.Duration{
+		10 * time.Millisecond,
+		15 * time.Millisecond,
+		20 * time.Millisecond,
+		250 * time.Millisecond,
+	}
+
+	random := simulateLatencyPolicy(corev1.Service_Spec_Config_Upstream_Loadbalance_RANDOM, means, 20000)
+	latency := simulateLatencyPolicy(corev1.Service_Spec_Config_Upstream_Loadbalance_LATENCY, means, 20000)
+	t.Logf("p99 random: %s, latency: %s", random, latency)
+
+	assert.Less(t, latency, random/2)
+}
+
+func BenchmarkLatencyPolicy(b *testing.B) {
+	means := []time.Duration{
+		10 * time.Millisecond,
+		15 * time.Millisecond,
+		20 * time.Millisecond,
+		250 * time.Millisecond,
+	}
+
+	for _, policy := range []corev1.Service_Spec_Config_Upstream_Loadbalance_Policy{
+		corev1.Service_Spec_Config_Upstream_Loadbalance_RANDOM,
+		corev1.Service_Spec_Config_Upstream_Loadbalance_LATENCY,
+	} {
+		b.Run(policy.String(), func(b *testing.B) {
+			var p99 time.Duration
+			for b.Loop() {
+				p99 = simulateLatencyPolicy(policy, means, 5000)
+			}
+			b.ReportMetric(float64(p99)/float64(time.Millisecond), "p99-ms")
+		})
+	}
+}
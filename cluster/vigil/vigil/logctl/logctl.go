@@ -0,0 +1,185 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package logctl
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/components"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultSamplingInitial    = 100
+	defaultSamplingThereafter = 100
+)
+
+// Controller derives the Service logger from the global logger according to
+// the Service logging configuration and installs it as the global logger.
+// Since a Vigil serves a single Service, all the log entries hence carry the
+// Service name and follow its level and sampling. The level can additionally
+// be overridden at runtime via ServeHTTP.
+type Controller struct {
+	mu sync.Mutex
+
+	base         *zap.Logger
+	level        zap.AtomicLevel
+	defaultLevel zapcore.Level
+	override     *zapcore.Level
+
+	svcName string
+	cfg     *corev1.Service_Spec_Logging
+	logger  *zap.Logger
+}
+
+type Opts struct {
+	// Logger is the base logger. By default, the current global logger is used.
+	Logger *zap.Logger
+	// Level is the level of the base logger. By default, the component's
+	// global log level is used.
+	Level *zap.AtomicLevel
+}
+
+func New(o *Opts) *Controller {
+	if o == nil {
+		o = &Opts{}
+	}
+
+	ret := &Controller{
+		base:  o.Logger,
+		level: components.LogLevel(),
+	}
+	if ret.base == nil {
+		ret.base = zap.L()
+	}
+	if o.Level != nil {
+		ret.level = *o.Level
+	}
+	ret.defaultLevel = ret.level.Level()
+
+	return ret
+}
+
+// Apply sets the logger according to the Service logging configuration.
+func (c *Controller) Apply(svc *corev1.Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cfg := svc.Spec.GetLogging()
+	c.level.SetLevel(c.getLevel(cfg))
+
+	isUnchanged := c.logger != nil && c.svcName == svc.Metadata.Name &&
+		proto.Equal(c.cfg.GetSampling(), cfg.GetSampling())
+	c.cfg = cfg
+	if isUnchanged {
+		return
+	}
+
+	c.svcName = svc.Metadata.Name
+	c.logger = c.base.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		sampling := cfg.GetSampling()
+		if sampling == nil || !sampling.IsEnabled {
+			return core
+		}
+
+		initial := defaultSamplingInitial
+		if sampling.Initial > 0 {
+			initial = int(sampling.Initial)
+		}
+		thereafter := defaultSamplingThereafter
+		if sampling.Thereafter > 0 {
+			thereafter = int(sampling.Thereafter)
+		}
+
+		return zapcore.NewSamplerWithOptions(core, time.Second, initial, thereafter)
+	})).With(zap.String("service", svc.Metadata.Name))
+
+	zap.ReplaceGlobals(c.logger)
+}
+
+func (c *Controller) getLevel(cfg *corev1.Service_Spec_Logging) zapcore.Level {
+	if c.override != nil {
+		return *c.override
+	}
+
+	switch cfg.GetLevel() {
+	case corev1.Service_Spec_Logging_ERROR:
+		return zap.ErrorLevel
+	case corev1.Service_Spec_Logging_WARN:
+		return zap.WarnLevel
+	case corev1.Service_Spec_Logging_INFO:
+		return zap.InfoLevel
+	case corev1.Service_Spec_Logging_DEBUG:
+		return zap.DebugLevel
+	default:
+		return c.defaultLevel
+	}
+}
+
+// Level returns the current effective log level.
+func (c *Controller) Level() zapcore.Level {
+	return c.level.Level()
+}
+
+// SetOverride overrides the configured log level until it is reset with a
+// nil level.
+func (c *Controller) SetOverride(level *zapcore.Level) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.override = level
+	c.level.SetLevel(c.getLevel(c.cfg))
+}
+
+// ServeHTTP serves the current log level as JSON. A PUT request with a level
+// query parameter (e.g. "?level=debug") overrides the configured level and a
+// DELETE request removes the override.
+func (c *Controller) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(req.URL.Query().Get("level"))); err != nil ||
+			level < zap.DebugLevel || level > zap.ErrorLevel {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.SetOverride(&level)
+	case http.MethodDelete:
+		c.SetOverride(nil)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.mu.Lock()
+	isOverridden := c.override != nil
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"level":        c.Level().String(),
+		"isOverridden": isOverridden,
+	})
+}
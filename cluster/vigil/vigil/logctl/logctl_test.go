@@ -0,0 +1,132 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package logctl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestController(t *testing.T) {
+	globalLogger := zap.L()
+	t.Cleanup(func() {
+		zap.ReplaceGlobals(globalLogger)
+	})
+
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	core, logs := observer.New(level)
+
+	ctl := New(&Opts{
+		Logger: zap.New(core),
+		Level:  &level,
+	})
+
+	svc := &corev1.Service{
+		Metadata: &metav1.Metadata{
+			Name: "svc1.default",
+		},
+		Spec: &corev1.Service_Spec{},
+	}
+
+	ctl.Apply(svc)
+	assert.Equal(t, zap.InfoLevel, ctl.Level())
+
+	zap.L().Debug("debug")
+	zap.L().Info("info")
+	assert.Equal(t, 1, logs.Len())
+	entry := logs.TakeAll()[0]
+	assert.Equal(t, "info", entry.Message)
+	assert.Equal(t, "svc1.default", entry.ContextMap()["service"])
+
+	svc.Spec.Logging = &corev1.Service_Spec_Logging{
+		Level: corev1.Service_Spec_Logging_DEBUG,
+	}
+	ctl.Apply(svc)
+	assert.Equal(t, zap.DebugLevel, ctl.Level())
+	zap.L().Debug("debug")
+	assert.Equal(t, 1, logs.Len())
+	logs.TakeAll()
+
+	svc.Spec.Logging = &corev1.Service_Spec_Logging{
+		Level: corev1.Service_Spec_Logging_WARN,
+		Sampling: &corev1.Service_Spec_Logging_Sampling{
+			IsEnabled:  true,
+			Initial:    2,
+			Thereafter: 5,
+		},
+	}
+	ctl.Apply(svc)
+	assert.Equal(t, zap.WarnLevel, ctl.Level())
+	for range 12 {
+		zap.L().Warn("noisy")
+	}
+	zap.L().Info("info")
+	// 2 initial entries followed by every 5th entry, i.e. the 7th and the 12th
+	assert.Equal(t, 4, logs.Len())
+	logs.TakeAll()
+
+	doReq := func(method, target string) (int, map[string]any) {
+		rw := httptest.NewRecorder()
+		ctl.ServeHTTP(rw, httptest.NewRequest(method, target, nil))
+		ret := map[string]any{}
+		if rw.Code == http.StatusOK {
+			assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &ret))
+		}
+		return rw.Code, ret
+	}
+
+	code, resp := doReq(http.MethodGet, "/debug/logging")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "warn", resp["level"])
+	assert.Equal(t, false, resp["isOverridden"])
+
+	code, resp = doReq(http.MethodPut, "/debug/logging?level=debug")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "debug", resp["level"])
+	assert.Equal(t, true, resp["isOverridden"])
+	zap.L().Debug("debug")
+	assert.Equal(t, 1, logs.Len())
+
+	// The override survives Service updates
+	ctl.Apply(svc)
+	assert.Equal(t, zap.DebugLevel, ctl.Level())
+
+	code, _ = doReq(http.MethodPut, "/debug/logging?level=invalid")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doReq(http.MethodPut, "/debug/logging?level=fatal")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doReq(http.MethodPost, "/debug/logging")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+	code, resp = doReq(http.MethodDelete, "/debug/logging")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "warn", resp["level"])
+	assert.Equal(t, false, resp["isOverridden"])
+
+	svc.Spec.Logging = nil
+	ctl.Apply(svc)
+	assert.Equal(t, zapcore.InfoLevel, ctl.Level())
+}
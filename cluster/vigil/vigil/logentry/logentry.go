@@ -28,6 +28,8 @@ import (
 )
 
 type InitializeLogEntryOpts struct {
+	// ID is the ID of the log. A new one is generated if it is not set.
+	ID              string
 	StartTime       time.Time
 	ReqCtx          *corev1.RequestContext
 	IsAuthenticated bool
@@ -46,6 +48,10 @@ func InitializeLogEntry(opts *InitializeLogEntryOpts) *corev1.AccessLog {
 		return nil
 	}
 
+	if opts.ID != "" {
+		logE.Metadata.Id = opts.ID
+	}
+
 	logE.Metadata.ActorRef = umetav1.GetObjectReference(i.Session)
 	logE.Metadata.TargetRef = umetav1.GetObjectReference(i.Service)
 
@@ -43,10 +43,13 @@ func GetServiceAttributes(svc *corev1.Service) attribute.Set {
 }
 
 type CommonMetrics struct {
-	TotalRequests      metric.Int64Counter
-	ActiveRequests     metric.Int64UpDownCounter
-	RequestDuration    metric.Float64Histogram
-	CommonAttributeSet attribute.Set
+	TotalRequests       metric.Int64Counter
+	ActiveRequests      metric.Int64UpDownCounter
+	RequestDuration     metric.Float64Histogram
+	ConfigReloads       metric.Int64Counter
+	ClientDisconnects   metric.Int64Counter
+	UpstreamUnavailable metric.Int64Counter
+	CommonAttributeSet  attribute.Set
 }
 
 func NewCommonMetrics(ctx context.Context, svc *corev1.Service) (*CommonMetrics, error) {
@@ -73,6 +76,24 @@ func NewCommonMetrics(ctx context.Context, svc *corev1.Service) (*CommonMetrics,
 		return nil, err
 	}
 
+	ret.ConfigReloads, err = meter.Int64Counter("config.reloads",
+		metric.WithDescription("Total number of Service config reloads"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret.ClientDisconnects, err = meter.Int64Counter("req.client.disconnects",
+		metric.WithDescription("Total number of requests canceled by the client before completion"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret.UpstreamUnavailable, err = meter.Int64Counter("upstream.unavailable",
+		metric.WithDescription("Total number of requests that could not be served by an upstream"))
+	if err != nil {
+		return nil, err
+	}
+
 	ret.CommonAttributeSet = GetServiceAttributes(svc)
 
 	return ret, nil
@@ -95,3 +116,22 @@ func (m *CommonMetrics) AtRequestEnd(startTime time.Time, additionalAttrSet metr
 	m.TotalRequests.Add(ctx, 1,
 		metric.WithAttributeSet(m.CommonAttributeSet))
 }
+
+func (m *CommonMetrics) AtConfigReload() {
+	m.ConfigReloads.Add(context.Background(), 1,
+		metric.WithAttributeSet(m.CommonAttributeSet))
+}
+
+func (m *CommonMetrics) AtClientDisconnect() {
+	m.ClientDisconnects.Add(context.Background(), 1,
+		metric.WithAttributeSet(m.CommonAttributeSet))
+}
+
+// AtUpstreamUnavailable records a request that could not be served by an
+// upstream. The reason distinguishes between having no upstream available at
+// all and failing to connect to the available ones.
+func (m *CommonMetrics) AtUpstreamUnavailable(reason string) {
+	m.UpstreamUnavailable.Add(context.Background(), 1,
+		metric.WithAttributeSet(m.CommonAttributeSet),
+		metric.WithAttributes(attribute.String("reason", reason)))
+}
@@ -18,10 +18,13 @@ package modes
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/cluster/common/octeliumc"
+	"github.com/octelium/octelium/cluster/vigil/vigil/bytequota"
+	"github.com/octelium/octelium/cluster/vigil/vigil/capture"
 	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
 	"github.com/octelium/octelium/cluster/vigil/vigil/octovigilc"
 	"github.com/octelium/octelium/cluster/vigil/vigil/secretman"
@@ -34,6 +37,24 @@ type Server interface {
 	SetClusterCertificate(crt *corev1.Secret) error
 }
 
+// Drainer is implemented by the Servers that can drain their connections
+// without being closed.
+type Drainer interface {
+	// Drain stops accepting new connections and waits for the open ones to
+	// finish until ctx is done, in which case the remaining ones are closed.
+	Drain(ctx context.Context) error
+
+	// Connections returns the number of the open connections and of those
+	// that are currently serving requests.
+	Connections() (int, int)
+}
+
+// RequestEvaluator is implemented by the Servers that can evaluate a
+// described request, without any traffic, for debugging.
+type RequestEvaluator interface {
+	ServeEvaluate(w http.ResponseWriter, req *http.Request)
+}
+
 type Opts struct {
 	OcteliumC  octeliumc.ClientInterface
 	OctovigilC *octovigilc.Client
@@ -41,6 +62,13 @@ type Opts struct {
 	SecretMan  *secretman.SecretManager
 	LBManager  *loadbalancer.LBManager
 
+	// CaptureStore stores the sampled debug captures of the HTTP-based modes
+	CaptureStore *capture.Store
+
+	// ByteQuotaStore accumulates the per identity byte usage of the
+	// HTTP-based modes
+	ByteQuotaStore bytequota.Store
+
 	PostAuthorize func(ctx context.Context, req *PostAuthorizeRequest) (*PostAuthorizeResponse, error)
 	GetUpstream   func(ctx context.Context, opts *Opts, reqCtx *corev1.RequestContext) (*loadbalancer.Upstream, error)
 }
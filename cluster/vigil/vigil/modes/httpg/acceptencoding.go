@@ -0,0 +1,74 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+)
+
+// setUpstreamAcceptEncoding rewrites the Accept-Encoding of the request sent
+// to the upstream according to the Service's AcceptEncoding mode.
+// The header is set to identity instead of being removed since the Go
+// Transport would otherwise add its own gzip Accept-Encoding and transparently
+// decompress the response.
+func setUpstreamAcceptEncoding(outReq *http.Request, httpCfg *corev1.Service_Spec_Config_HTTP) {
+	switch httpCfg.GetAcceptEncoding().GetMode() {
+	case corev1.Service_Spec_Config_HTTP_AcceptEncoding_PRESERVE:
+		return
+	case corev1.Service_Spec_Config_HTTP_AcceptEncoding_IDENTITY:
+	default:
+		if !needsIdentityResponse(httpCfg) &&
+			getJSONFormatMode(outReq.Header, httpCfg.GetJsonFormat()) ==
+				corev1.Service_Spec_Config_HTTP_JSONFormat_MODE_UNSET {
+			return
+		}
+	}
+
+	outReq.Header.Set("Accept-Encoding", "identity")
+}
+
+// needsIdentityResponse returns whether one of the enabled features processes
+// the upstream response body and therefore cannot handle encoded bodies.
+func needsIdentityResponse(httpCfg *corev1.Service_Spec_Config_HTTP) bool {
+	if httpCfg == nil {
+		return false
+	}
+
+	if len(httpCfg.GetStreamTransform().GetRules()) > 0 {
+		return true
+	}
+
+	if httpCfg.GetVisibility().GetEnableResponseBody() ||
+		httpCfg.GetVisibility().GetEnableResponseBodyMap() {
+		return true
+	}
+
+	for _, plugin := range httpCfg.Plugins {
+		if plugin.IsDisabled || plugin.GetExtProc() == nil {
+			continue
+		}
+
+		if plugin.GetExtProc().GetProcessingMode().GetResponseBodyMode() ==
+			corev1.Service_Spec_Config_HTTP_Plugin_ExtProc_ProcessingMode_BUFFERED {
+			return true
+		}
+	}
+
+	return false
+}
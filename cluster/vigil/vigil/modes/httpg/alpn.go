@@ -0,0 +1,60 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+)
+
+// getListenerNextProtos returns the protocols advertised by the TLS listener
+// via ALPN in the order of preference.
+func getListenerNextProtos(svc *corev1.Service) []string {
+	if !ucorev1.ToService(svc).IsListenerHTTP2() {
+		return []string{"http/1.1"}
+	}
+
+	switch svc.Spec.Config.GetHttp().GetAlpn().GetMode() {
+	case corev1.Service_Spec_Config_HTTP_ALPN_H2_ONLY:
+		return []string{"h2"}
+	case corev1.Service_Spec_Config_HTTP_ALPN_PREFER_HTTP1:
+		return []string{"http/1.1", "h2"}
+	default:
+		return []string{"h2", "http/1.1"}
+	}
+}
+
+// withListenerALPN rejects the HTTP/1.x requests if the listener requires
+// HTTP/2, which covers both the TLS clients that do not use ALPN and the
+// cleartext clients that do not use h2c.
+func withListenerALPN(svc *corev1.Service, next http.Handler) http.Handler {
+	if svc.Spec.Config.GetHttp().GetAlpn().GetMode() != corev1.Service_Spec_Config_HTTP_ALPN_H2_ONLY {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 2 {
+			w.Header().Set("Connection", "close")
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
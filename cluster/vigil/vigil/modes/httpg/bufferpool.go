@@ -16,15 +16,41 @@
 
 package httpg
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+)
 
 const bufferPoolSize = 32 * 1024
 
-func newBufferPool() *bufferPool {
+const (
+	bufferPoolSizeSmall = 4 * 1024
+	bufferPoolSizeLarge = 256 * 1024
+)
+
+// bufferPools are shared by all the requests so that the buffers of
+// completed requests are reused instead of being allocated per request.
+var bufferPools = map[corev1.Service_Spec_Config_HTTP_BufferPool_Size]*bufferPool{
+	corev1.Service_Spec_Config_HTTP_BufferPool_SIZE_UNSET: newBufferPool(bufferPoolSize),
+	corev1.Service_Spec_Config_HTTP_BufferPool_SMALL:      newBufferPool(bufferPoolSizeSmall),
+	corev1.Service_Spec_Config_HTTP_BufferPool_LARGE:      newBufferPool(bufferPoolSizeLarge),
+}
+
+// getBufferPool returns the buffer pool of the matched route's config.
+func getBufferPool(httpCfg *corev1.Service_Spec_Config_HTTP) *bufferPool {
+	if ret, ok := bufferPools[httpCfg.GetBufferPool().GetSize()]; ok {
+		return ret
+	}
+
+	return bufferPools[corev1.Service_Spec_Config_HTTP_BufferPool_SIZE_UNSET]
+}
+
+func newBufferPool(size int) *bufferPool {
 	return &bufferPool{
 		pool: sync.Pool{
 			New: func() any {
-				return make([]byte, bufferPoolSize)
+				return make([]byte, size)
 			},
 		},
 	}
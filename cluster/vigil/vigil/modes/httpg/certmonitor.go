@@ -0,0 +1,117 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const defaultCertificateExpiryWarning = 30 * 24 * time.Hour
+
+// withCertificateMonitoring returns a copy of the upstream TLS config that
+// inspects the upstream's leaf certificate on every TLS handshake. Since the
+// transports pool their connections, this only runs on new connections and
+// never per request.
+func withCertificateMonitoring(tlsCfg *tls.Config, upstream *loadbalancer.Upstream,
+	cfg *corev1.Service_Spec_Config_HTTP_CertificateMonitoring,
+	expiry metric.Float64Gauge) *tls.Config {
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	} else {
+		tlsCfg = tlsCfg.Clone()
+	}
+
+	expiryWarning := defaultCertificateExpiryWarning
+	if val := umetav1.ToDuration(cfg.ExpiryWarning).ToGo(); val > 0 {
+		expiryWarning = val
+	}
+
+	verifyConnection := tlsCfg.VerifyConnection
+	tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verifyConnection != nil {
+			if err := verifyConnection(cs); err != nil {
+				return err
+			}
+		}
+
+		checkUpstreamCertificate(cs, upstream, expiryWarning, expiry)
+		return nil
+	}
+
+	return tlsCfg
+}
+
+func checkUpstreamCertificate(cs tls.ConnectionState, upstream *loadbalancer.Upstream,
+	expiryWarning time.Duration, expiry metric.Float64Gauge) {
+	if len(cs.PeerCertificates) == 0 {
+		return
+	}
+
+	crt := cs.PeerCertificates[0]
+	host := upstream.Host
+	if cs.ServerName != "" {
+		host = cs.ServerName
+	}
+
+	remaining := time.Until(crt.NotAfter)
+	daysUntilExpiry := remaining.Hours() / 24
+
+	if expiry != nil {
+		expiry.Record(context.Background(), daysUntilExpiry,
+			metric.WithAttributes(attribute.String("host", host)))
+	}
+
+	fields := []zap.Field{
+		zap.String("host", host),
+		zap.String("subject", crt.Subject.String()),
+		zap.String("issuer", crt.Issuer.String()),
+		zap.String("serialNumber", crt.SerialNumber.String()),
+		zap.Strings("dnsNames", crt.DNSNames),
+		zap.Time("notBefore", crt.NotBefore),
+		zap.Time("notAfter", crt.NotAfter),
+		zap.Float64("daysUntilExpiry", daysUntilExpiry),
+		zap.Bool("didResume", cs.DidResume),
+	}
+
+	if remaining < expiryWarning {
+		zap.L().Warn("Upstream TLS certificate is about to expire", fields...)
+	} else {
+		zap.L().Info("Upstream TLS certificate", fields...)
+	}
+}
+
+func getCertificateMonitoring(svc *corev1.Service,
+	svcCfg *corev1.Service_Spec_Config) *corev1.Service_Spec_Config_HTTP_CertificateMonitoring {
+	if svcCfg == nil {
+		svcCfg = svc.Spec.Config
+	}
+
+	if ret := svcCfg.GetHttp().GetCertificateMonitoring(); ret.GetIsEnabled() {
+		return ret
+	}
+
+	return nil
+}
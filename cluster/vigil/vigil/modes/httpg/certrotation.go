@@ -0,0 +1,149 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// getRotatedClientCertificate returns the name of the Secret of the upstream
+// client certificate whose rotation is watched, if any.
+func getRotatedClientCertificate(svc *corev1.Service, svcCfg *corev1.Service_Spec_Config) string {
+	if svcCfg == nil {
+		svcCfg = svc.Spec.Config
+	}
+
+	if ucorev1.ToService(svc).IsKubernetes() || svcCfg.GetClientCertificate().GetFromSecret() != "" {
+		return ""
+	}
+
+	crtCfg := svcCfg.GetTls().GetClientCertificate()
+	if !crtCfg.GetRotation().GetIsEnabled() {
+		return ""
+	}
+
+	return crtCfg.GetFromSecret()
+}
+
+// certRotator holds the current client certificate of a transport and swaps
+// it once its Secret is rotated. Only the TLS handshakes of the new
+// connections use the new certificate.
+type certRotator struct {
+	secretName string
+	load       func(ctx context.Context) (*tls.Certificate, error)
+	crt        atomic.Pointer[tls.Certificate]
+	rt         http.RoundTripper
+	stopFn     func()
+}
+
+func newCertRotator(secretName string, tlsCfg *tls.Config,
+	load func(ctx context.Context) (*tls.Certificate, error)) (*certRotator, *tls.Config, error) {
+	if tlsCfg == nil || len(tlsCfg.Certificates) == 0 {
+		return nil, nil, errors.Errorf("No client certificate to rotate")
+	}
+
+	ret := &certRotator{
+		secretName: secretName,
+		load:       load,
+	}
+	ret.crt.Store(&tlsCfg.Certificates[0])
+
+	tlsCfg = tlsCfg.Clone()
+	tlsCfg.Certificates = nil
+	tlsCfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return ret.crt.Load(), nil
+	}
+
+	return ret, tlsCfg, nil
+}
+
+func (r *certRotator) onSecretUpdate(name string) {
+	if name != r.secretName {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := r.reload(ctx); err != nil {
+		zap.L().Warn("Could not reload the rotated client certificate. Keeping the current one",
+			zap.String("secret", r.secretName), zap.Error(err))
+	}
+}
+
+// reload swaps the client certificate if it has been rotated and closes the
+// idle connections that were established with the old certificate.
+func (r *certRotator) reload(ctx context.Context) error {
+	crt, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	if isSameCertificate(r.crt.Load(), crt) {
+		return nil
+	}
+
+	r.crt.Store(crt)
+	zap.L().Info("Upstream client certificate rotated", zap.String("secret", r.secretName))
+
+	if r.rt != nil {
+		closeIdleConnections(r.rt)
+	}
+
+	return nil
+}
+
+func isSameCertificate(a, b *tls.Certificate) bool {
+	if len(a.Certificate) != len(b.Certificate) {
+		return false
+	}
+	for i := range a.Certificate {
+		if !bytes.Equal(a.Certificate[i], b.Certificate[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rotatingTransport is the transport whose client certificate is swapped by
+// its certRotator. The rotator stops watching the Secret once the transport
+// is removed from the transport cache.
+type rotatingTransport struct {
+	http.RoundTripper
+	rotator *certRotator
+}
+
+func (t *rotatingTransport) CloseIdleConnections() {
+	closeIdleConnections(t.RoundTripper)
+}
+
+func (t *rotatingTransport) stop() {
+	if t.rotator.stopFn != nil {
+		t.rotator.stopFn()
+	}
+}
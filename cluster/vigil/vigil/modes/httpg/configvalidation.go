@@ -0,0 +1,215 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"go.uber.org/zap"
+)
+
+type configError struct {
+	Path    string
+	Message string
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+type configErrors []*configError
+
+func (e configErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// validateServiceConfigs checks the cross-field consistency of the Service
+// configs. The API Server rejects such configs once they are written, the
+// check here reports the Services that were stored before. The configs are
+// checked as they are set rather than merged with their parents so that
+// every error points to the config that actually causes it.
+func validateServiceConfigs(svc *corev1.Service) error {
+	var errs configErrors
+
+	if svc == nil || svc.Spec == nil {
+		return nil
+	}
+
+	errs = append(errs, validateServiceConfig("spec.config", svc.Spec.Config)...)
+
+	if svc.Spec.DynamicConfig != nil {
+		for _, cfg := range svc.Spec.DynamicConfig.Configs {
+			errs = append(errs,
+				validateServiceConfig(fmt.Sprintf("spec.dynamicConfig.configs[%s]", cfg.Name), cfg)...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func validateServiceConfig(path string, cfg *corev1.Service_Spec_Config) configErrors {
+	httpCfg := cfg.GetHttp()
+	if httpCfg == nil {
+		return nil
+	}
+
+	var errs configErrors
+	addErr := func(field, format string, args ...any) {
+		errs = append(errs, &configError{
+			Path:    fmt.Sprintf("%s.http.%s", path, field),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if auth := httpCfg.Auth; auth != nil {
+		switch auth.Type.(type) {
+		case *corev1.Service_Spec_Config_HTTP_Auth_Bearer_:
+			if auth.GetBearer().GetFromSecret() == "" {
+				addErr("auth.bearer.fromSecret", "a Secret must be set")
+			}
+		case *corev1.Service_Spec_Config_HTTP_Auth_Basic_:
+			if auth.GetBasic().Username == "" {
+				addErr("auth.basic.username", "the username must be set")
+			}
+			if auth.GetBasic().GetPassword().GetFromSecret() == "" {
+				addErr("auth.basic.password.fromSecret", "a Secret must be set")
+			}
+		case *corev1.Service_Spec_Config_HTTP_Auth_Custom_:
+			if auth.GetCustom().Header == "" {
+				addErr("auth.custom.header", "the header must be set")
+			}
+			if auth.GetCustom().GetValue().GetFromSecret() == "" {
+				addErr("auth.custom.value.fromSecret", "a Secret must be set")
+			}
+		case *corev1.Service_Spec_Config_HTTP_Auth_Oauth2ClientCredentials:
+			if auth.GetOauth2ClientCredentials().GetClientSecret().GetFromSecret() == "" {
+				addErr("auth.oauth2ClientCredentials.clientSecret.fromSecret", "a Secret must be set")
+			}
+		case *corev1.Service_Spec_Config_HTTP_Auth_Sigv4_:
+			sigv4 := auth.GetSigv4()
+			if sigv4.GetSecretAccessKey().GetFromSecret() == "" {
+				addErr("auth.sigv4.secretAccessKey.fromSecret", "a Secret must be set")
+			}
+			if sigv4.AccessKeyID == "" {
+				addErr("auth.sigv4.accessKeyID", "the access key ID must be set")
+			}
+			if sigv4.Region == "" || sigv4.Service == "" {
+				addErr("auth.sigv4", "both the region and the service must be set")
+			}
+		case *corev1.Service_Spec_Config_HTTP_Auth_Hmac:
+			hmacCfg := auth.GetHmac()
+			if hmacCfg.GetKey().GetFromSecret() == "" {
+				addErr("auth.hmac.key.fromSecret", "a Secret must be set")
+			}
+			if hmacCfg.TimestampHeader == "" &&
+				(hmacCfg.Canonicalization == corev1.Service_Spec_Config_HTTP_Auth_HMAC_TIMESTAMP_BODY ||
+					hmacCfg.Canonicalization == corev1.Service_Spec_Config_HTTP_Auth_HMAC_TIMESTAMP_METHOD_PATH_BODY) {
+				addErr("auth.hmac.timestampHeader", "the timestamp header must be set to sign the timestamp")
+			}
+		case *corev1.Service_Spec_Config_HTTP_Auth_Ntlm:
+			if auth.GetNtlm().Username == "" {
+				addErr("auth.ntlm.username", "the username must be set")
+			}
+			if auth.GetNtlm().GetPassword().GetFromSecret() == "" {
+				addErr("auth.ntlm.password.fromSecret", "a Secret must be set")
+			}
+			if httpCfg.IsUpstreamHTTP2 {
+				addErr("auth.ntlm", "cannot be used with HTTP/2 upstreams since NTLM authenticates the connection")
+			}
+		}
+	}
+
+	if httpCfg.IsUpstreamHTTP2 {
+		if upstreamURL := cfg.GetUpstream().GetUrl(); upstreamURL != "" {
+			if u, err := url.Parse(upstreamURL); err == nil && (u.Scheme == "ws" || u.Scheme == "wss") {
+				addErr("isUpstreamHTTP2", "cannot be used with the WebSocket upstream %s", upstreamURL)
+			}
+		}
+	}
+
+	if httpCfg.Response.GetDirect() != nil {
+		if cfg.Upstream != nil {
+			addErr("response.direct", "conflicts with the upstream which would never be used")
+		}
+		if httpCfg.FanOut.GetIsEnabled() {
+			addErr("fanOut", "conflicts with response.direct since no request reaches the upstream")
+		}
+	}
+
+	if httpCfg.FanOut.GetIsEnabled() && len(httpCfg.FanOut.Regions) == 0 {
+		addErr("fanOut.regions", "at least one region must be set once enabled")
+	}
+
+	if fq := httpCfg.FairQueue; fq != nil && fq.MaxConcurrentRequests == 0 &&
+		(fq.MaxQueueSize > 0 || fq.MaxWait != nil) {
+		addErr("fairQueue.maxConcurrentRequests", "must be set for the fair queue to be enabled")
+	}
+
+	for i, rule := range httpCfg.RequestFilter.GetRules() {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			addErr(fmt.Sprintf("requestFilter.rules[%d].pattern", i), "invalid regexp: %s", err)
+		}
+	}
+
+	if echo := httpCfg.DebugEcho; echo != nil && echo.IsEnabled && echo.Condition == nil {
+		addErr("debugEcho.condition", "must be set for the debug echo to be enabled")
+	}
+
+	return errs
+}
+
+type configValidation struct {
+	resourceVersion string
+	err             error
+}
+
+// getConfigError returns the validation error of the Service configs. The
+// result is cached per Service resource version so that the configs are only
+// validated and their errors logged once they are updated. The errors do not
+// prevent the requests from being served.
+func (s *Server) getConfigError(svc *corev1.Service) error {
+	resourceVersion := svc.Metadata.ResourceVersion
+	if cur := s.configValidation.Load(); cur != nil && cur.resourceVersion == resourceVersion {
+		return cur.err
+	}
+
+	err := validateServiceConfigs(svc)
+	if err != nil {
+		zap.L().Warn("The Service config is inconsistent",
+			zap.String("resourceVersion", resourceVersion), zap.Error(err))
+	}
+
+	s.configValidation.Store(&configValidation{
+		resourceVersion: resourceVersion,
+		err:             err,
+	})
+
+	return err
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+	"go.uber.org/zap"
+)
+
+var errContentTypeNotAllowed = errors.New("Upstream response content type is not allowed")
+
+const defaultContentTypeOverride = "application/octet-stream"
+
+// checkResponseContentType enforces the allowed content types of the upstream
+// response. The disallowed responses either have their content type
+// overridden or are replaced by an error response via the ErrorHandler.
+func checkResponseContentType(r *http.Response, cfg *corev1.Service_Spec_Config_HTTP_ResponseContentType) error {
+	if cfg == nil || len(cfg.Allowed) == 0 {
+		return nil
+	}
+
+	switch {
+	case r.StatusCode < 200,
+		r.StatusCode == http.StatusNoContent,
+		r.StatusCode == http.StatusNotModified:
+		return nil
+	}
+
+	if strings.TrimSpace(r.Header.Get("Content-Type")) == "" {
+		if r.ContentLength == 0 {
+			return nil
+		}
+		// Prevent the clients as well as the HTTP server from sniffing the
+		// content type of the body.
+		r.Header.Set("Content-Type", defaultContentTypeOverride)
+	}
+
+	mediaType := httputils.GetMediaType(&http.Request{
+		Header:        r.Header,
+		ContentLength: r.ContentLength,
+	})
+	if isMediaTypeAllowed(mediaType, cfg.Allowed) {
+		return nil
+	}
+
+	zap.L().Debug("Upstream response content type is not allowed",
+		zap.String("contentType", r.Header.Get("Content-Type")), zap.String("action", cfg.Action.String()))
+
+	switch cfg.Action {
+	case corev1.Service_Spec_Config_HTTP_ResponseContentType_OVERRIDE:
+		override := defaultContentTypeOverride
+		if cfg.Override != "" {
+			override = cfg.Override
+		}
+		r.Header.Set("Content-Type", override)
+		r.Header.Set("X-Content-Type-Options", "nosniff")
+		return nil
+	default:
+		return errContentTypeNotAllowed
+	}
+}
+
+func isMediaTypeAllowed(mediaType string, allowed []string) bool {
+	if mediaType == "" {
+		return false
+	}
+
+	typ, _, _ := strings.Cut(mediaType, "/")
+	for _, val := range allowed {
+		val = strings.ToLower(strings.TrimSpace(val))
+		switch {
+		case val == mediaType, val == "*/*":
+			return true
+		case strings.HasSuffix(val, "/*") && strings.TrimSuffix(val, "/*") == typ:
+			return true
+		}
+	}
+
+	return false
+}
+
+func getContentTypeBlockedStatusCode(cfg *corev1.Service_Spec_Config_HTTP_ResponseContentType) int {
+	if code := cfg.GetStatusCode(); code >= 400 && code <= 599 {
+		return int(code)
+	}
+
+	return http.StatusBadGateway
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"go.uber.org/zap"
+)
+
+// rewriteSetCookies applies the Cookie rewrite rules to each of the
+// Set-Cookie headers of the upstream response. Cookies that cannot be parsed
+// or that match no rule are kept as sent by the upstream.
+func rewriteSetCookies(hdr http.Header, cfg *corev1.Service_Spec_Config_HTTP_Cookie) {
+	if cfg == nil || len(cfg.Rewrites) == 0 {
+		return
+	}
+
+	vals := hdr.Values("Set-Cookie")
+	if len(vals) == 0 {
+		return
+	}
+
+	ret := make([]string, 0, len(vals))
+	for _, val := range vals {
+		cookie, err := http.ParseSetCookie(val)
+		if err != nil {
+			zap.L().Debug("Could not parse Set-Cookie header", zap.Error(err))
+			ret = append(ret, val)
+			continue
+		}
+
+		rule := getCookieRewrite(cfg, cookie.Name)
+		if rule == nil {
+			ret = append(ret, val)
+			continue
+		}
+
+		rewriteCookie(cookie, rule)
+
+		if rewritten := cookie.String(); rewritten != "" {
+			ret = append(ret, rewritten)
+		} else {
+			ret = append(ret, val)
+		}
+	}
+
+	hdr["Set-Cookie"] = ret
+}
+
+func getCookieRewrite(cfg *corev1.Service_Spec_Config_HTTP_Cookie,
+	name string) *corev1.Service_Spec_Config_HTTP_Cookie_Rewrite {
+	for _, rule := range cfg.Rewrites {
+		if rule.Name == "" || rule.Name == name {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+func rewriteCookie(cookie *http.Cookie, rule *corev1.Service_Spec_Config_HTTP_Cookie_Rewrite) {
+	if rule.Rename != "" {
+		cookie.Name = rule.Rename
+	}
+
+	switch {
+	case rule.RemoveDomain:
+		cookie.Domain = ""
+	case rule.Domain != "":
+		cookie.Domain = rule.Domain
+	}
+
+	if rule.Path != "" {
+		cookie.Path = rule.Path
+	}
+
+	switch rule.Secure {
+	case corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_SET:
+		cookie.Secure = true
+	case corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_CLEAR:
+		cookie.Secure = false
+	}
+
+	switch rule.HttpOnly {
+	case corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_SET:
+		cookie.HttpOnly = true
+	case corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_CLEAR:
+		cookie.HttpOnly = false
+	}
+
+	switch rule.SameSite {
+	case corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_LAX:
+		cookie.SameSite = http.SameSiteLaxMode
+	case corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_STRICT:
+		cookie.SameSite = http.SameSiteStrictMode
+	case corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_NONE:
+		cookie.SameSite = http.SameSiteNoneMode
+	case corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_REMOVE:
+		cookie.SameSite = 0
+	}
+}
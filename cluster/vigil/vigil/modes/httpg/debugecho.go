@@ -0,0 +1,262 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDebugEchoHeader = "X-Octelium-Debug-Echo"
+	debugEchoHeaderPrefix  = "X-Octelium-Debug-"
+)
+
+type debugEchoResponse struct {
+	Service  string            `json:"service,omitempty"`
+	Config   string            `json:"config,omitempty"`
+	Upstream string            `json:"upstream,omitempty"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Trace    *debugEchoTrace   `json:"trace,omitempty"`
+}
+
+type debugEchoTrace struct {
+	DownstreamPath    string   `json:"downstreamPath,omitempty"`
+	SetHeaders        []string `json:"setHeaders,omitempty"`
+	RemovedHeaders    []string `json:"removedHeaders,omitempty"`
+	AuthInjection     string   `json:"authInjection,omitempty"`
+	UpstreamSelection string   `json:"upstreamSelection,omitempty"`
+	ShortCircuit      string   `json:"shortCircuit,omitempty"`
+}
+
+// serveDebugEcho answers the request with its diagnostic echo, without
+// contacting the upstream, and reports whether it did so. The echoed headers
+// are those sent by the client rather than the ones that would be sent to the
+// upstream so that injected upstream credentials are never disclosed.
+func (s *Server) serveDebugEcho(w http.ResponseWriter, r *http.Request) bool {
+	ctx := r.Context()
+	reqCtx := middlewares.GetCtxRequestContext(ctx)
+
+	cfg := reqCtx.ServiceConfig.GetHttp().GetDebugEcho()
+	if cfg == nil || !cfg.IsEnabled || cfg.Condition == nil || !isDebugEchoRequested(r, cfg) {
+		return false
+	}
+
+	if reqCtx.ReqCtxMap == nil {
+		reqCtx.ReqCtxMap = pbutils.MustConvertToMap(reqCtx.DownstreamInfo)
+	}
+
+	isMatched, err := s.celEngine.EvalCondition(ctx, cfg.Condition, map[string]any{
+		"ctx": reqCtx.ReqCtxMap,
+	})
+	if err != nil || !isMatched {
+		return false
+	}
+
+	ret := &debugEchoResponse{
+		Config: getServiceConfigName(reqCtx.AuthResponse),
+		Method: r.Method,
+		Path:   r.URL.Path,
+	}
+
+	if svc := reqCtx.Service; svc != nil && svc.Metadata != nil {
+		ret.Service = svc.Metadata.Name
+	}
+
+	if cfg.IncludeTrace {
+		ret.Trace = getDebugEchoTrace(r, reqCtx)
+	}
+
+	// The upstream is never selected for short-circuited requests.
+	if ret.Trace == nil || ret.Trace.ShortCircuit == "" {
+		if upstream, err := s.lbManager.GetUpstream(ctx, reqCtx.AuthResponse); err == nil {
+			ret.Upstream = upstream.URL.String()
+		} else {
+			ret.Error = err.Error()
+		}
+	}
+
+	if len(cfg.Headers) > 0 {
+		downstreamHdrs := getDownstreamHeaders(reqCtx.DownstreamRequest)
+		ret.Headers = make(map[string]string)
+		for _, hdr := range cfg.Headers {
+			if val, ok := downstreamHdrs[strings.ToLower(hdr)]; ok {
+				ret.Headers[http.CanonicalHeaderKey(hdr)] = val
+			}
+		}
+	}
+
+	zap.L().Debug("Serving debug echo", zap.Any("echo", ret))
+
+	middlewares.SetServerHeader(w.Header(), reqCtx.ServiceConfig.GetHttp())
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch cfg.Format {
+	case corev1.Service_Spec_Config_HTTP_DebugEcho_HEADERS:
+		setDebugEchoHeader(w, "Service", ret.Service)
+		setDebugEchoHeader(w, "Config", ret.Config)
+		setDebugEchoHeader(w, "Upstream", ret.Upstream)
+		setDebugEchoHeader(w, "Error", ret.Error)
+		for k, v := range ret.Headers {
+			setDebugEchoHeader(w, "Header-"+k, v)
+		}
+		if trace := ret.Trace; trace != nil {
+			setDebugEchoHeader(w, "Downstream-Path", trace.DownstreamPath)
+			setDebugEchoHeader(w, "Set-Headers", strings.Join(trace.SetHeaders, ", "))
+			setDebugEchoHeader(w, "Removed-Headers", strings.Join(trace.RemovedHeaders, ", "))
+			setDebugEchoHeader(w, "Auth-Injection", trace.AuthInjection)
+			setDebugEchoHeader(w, "Upstream-Selection", trace.UpstreamSelection)
+			setDebugEchoHeader(w, "Short-Circuit", trace.ShortCircuit)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ret)
+	}
+
+	return true
+}
+
+func isDebugEchoRequested(r *http.Request, cfg *corev1.Service_Spec_Config_HTTP_DebugEcho) bool {
+	header := defaultDebugEchoHeader
+	if cfg.Header != "" {
+		header = cfg.Header
+	}
+
+	if r.Header.Get(header) != "" {
+		return true
+	}
+
+	return cfg.QueryParam != "" && r.URL.Query().Has(cfg.QueryParam)
+}
+
+func setDebugEchoHeader(w http.ResponseWriter, key, val string) {
+	if val != "" {
+		w.Header().Set(debugEchoHeaderPrefix+key, val)
+	}
+}
+
+func getServiceConfigName(authResp *coctovigilv1.AuthenticateAndAuthorizeResponse) string {
+	if authResp == nil || authResp.ServiceConfigName == "" {
+		return "default"
+	}
+
+	return authResp.ServiceConfigName
+}
+
+func getDownstreamHeaders(req *coctovigilv1.DownstreamRequest) map[string]string {
+	return getDownstreamHTTP(req).GetHeaders()
+}
+
+func getDownstreamHTTP(req *coctovigilv1.DownstreamRequest) *corev1.RequestContext_Request_HTTP {
+	if req == nil || req.Request == nil {
+		return nil
+	}
+
+	switch req.Request.Type.(type) {
+	case *corev1.RequestContext_Request_Grpc:
+		return req.Request.GetGrpc().GetHttp()
+	case *corev1.RequestContext_Request_Http:
+		return req.Request.GetHttp()
+	case *corev1.RequestContext_Request_Kubernetes_:
+		return req.Request.GetKubernetes().GetHttp()
+	default:
+		return nil
+	}
+}
+
+// getDebugEchoTrace returns the decisions taken for the request so far by
+// comparing it with the request as sent by the client.
+func getDebugEchoTrace(r *http.Request, reqCtx *middlewares.RequestContext) *debugEchoTrace {
+	ret := &debugEchoTrace{}
+
+	downstream := getDownstreamHTTP(reqCtx.DownstreamRequest)
+	if downstream != nil && downstream.Path != r.URL.Path {
+		ret.DownstreamPath = downstream.Path
+	}
+
+	downstreamHdrs := downstream.GetHeaders()
+	hdrs := httputils.GetHeaders(r.Header)
+	for k, v := range hdrs {
+		if val, ok := downstreamHdrs[k]; !ok || val != v {
+			ret.SetHeaders = append(ret.SetHeaders, http.CanonicalHeaderKey(k))
+		}
+	}
+	for k := range downstreamHdrs {
+		if _, ok := hdrs[k]; !ok {
+			ret.RemovedHeaders = append(ret.RemovedHeaders, http.CanonicalHeaderKey(k))
+		}
+	}
+	sort.Strings(ret.SetHeaders)
+	sort.Strings(ret.RemovedHeaders)
+
+	svcCfg := reqCtx.ServiceConfig
+	ret.AuthInjection = string(getAuthInjectionType(svcCfg.GetHttp().GetAuth()))
+
+	if svcCfg.GetHttp().GetResponse().GetDirect() != nil {
+		ret.ShortCircuit = "directResponse"
+		return ret
+	}
+
+	switch upstream := svcCfg.GetUpstream(); {
+	case upstream == nil:
+	case upstream.GetLoadbalance() != nil:
+		ret.UpstreamSelection = "loadbalance"
+	case upstream.GetContainer() != nil:
+		ret.UpstreamSelection = "container"
+	case upstream.User != "":
+		ret.UpstreamSelection = "user"
+	default:
+		ret.UpstreamSelection = "url"
+	}
+
+	return ret
+}
+
+func getAuthInjectionType(auth *corev1.Service_Spec_Config_HTTP_Auth) middlewares.AuthInjectionType {
+	switch auth.GetType().(type) {
+	case *corev1.Service_Spec_Config_HTTP_Auth_Bearer_:
+		return middlewares.AuthInjectionBearer
+	case *corev1.Service_Spec_Config_HTTP_Auth_Basic_:
+		return middlewares.AuthInjectionBasic
+	case *corev1.Service_Spec_Config_HTTP_Auth_Custom_:
+		return middlewares.AuthInjectionCustom
+	case *corev1.Service_Spec_Config_HTTP_Auth_Oauth2ClientCredentials:
+		return middlewares.AuthInjectionOAuth2ClientCredentials
+	case *corev1.Service_Spec_Config_HTTP_Auth_Sigv4_:
+		return middlewares.AuthInjectionSigv4
+	case *corev1.Service_Spec_Config_HTTP_Auth_Hmac:
+		return middlewares.AuthInjectionHMAC
+	case *corev1.Service_Spec_Config_HTTP_Auth_Ntlm:
+		return middlewares.AuthInjectionNTLM
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/preauth"
+	"github.com/octelium/octelium/cluster/vigil/vigil/octovigilc"
+	"github.com/octelium/octelium/cluster/vigil/vigil/vigilutils"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+)
+
+const maxDebugEvaluateBodySize = 64 * 1024
+
+var (
+	errInvalidPath          = errors.New("the path must start with /")
+	errInvalidSourceAddress = errors.New("invalid source address")
+)
+
+// debugEvaluateRequest describes the request to evaluate. The identity of the
+// request is resolved the same way as for real traffic, i.e. from the
+// credentials in the headers or from the source address.
+type debugEvaluateRequest struct {
+	Method        string            `json:"method"`
+	Path          string            `json:"path"`
+	Host          string            `json:"host,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	SourceAddress string            `json:"sourceAddress,omitempty"`
+}
+
+type debugEvaluateResponse struct {
+	Service         string          `json:"service,omitempty"`
+	IsAuthenticated bool            `json:"isAuthenticated"`
+	IsAuthorized    bool            `json:"isAuthorized"`
+	Reason          json.RawMessage `json:"reason,omitempty"`
+	User            string          `json:"user,omitempty"`
+	Session         string          `json:"session,omitempty"`
+	Config          string          `json:"config,omitempty"`
+	Upstream        string          `json:"upstream,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	Trace           *debugEchoTrace `json:"trace,omitempty"`
+}
+
+// ServeEvaluate evaluates the request described in the JSON body of a POST
+// request against the Service and serves the decision trace as JSON. Neither
+// the middlewares nor the upstream are involved, so nothing is sent and no
+// rate limit, quota or cache is affected.
+func (s *Server) ServeEvaluate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	desc := &debugEvaluateRequest{}
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxDebugEvaluateBodySize)).Decode(desc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ret, err := s.evaluate(req, desc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (s *Server) evaluate(r *http.Request, desc *debugEvaluateRequest) (*debugEvaluateResponse, error) {
+	ctx := r.Context()
+	svc := s.vCache.GetService()
+
+	req, err := getDebugEvaluateRequest(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	downstreamReq, err := preauth.GetDownstreamRequest(req, svc)
+	if err != nil {
+		return nil, err
+	}
+	if desc.SourceAddress != "" {
+		if net.ParseIP(desc.SourceAddress) == nil {
+			return nil, errInvalidSourceAddress
+		}
+		downstreamReq.Source.Address = desc.SourceAddress
+	}
+
+	ret := &debugEvaluateResponse{
+		Service: svc.Metadata.Name,
+	}
+
+	var authResp *coctovigilv1.AuthenticateAndAuthorizeResponse
+	if svc.Spec.IsAnonymous {
+		authResp = &coctovigilv1.AuthenticateAndAuthorizeResponse{
+			IsAuthorized: true,
+			RequestContext: &corev1.RequestContext{
+				Request: downstreamReq.Request,
+				Service: svc,
+			},
+		}
+	} else {
+		authResp, err = s.octovigilC.AuthenticateAndAuthorize(ctx, &octovigilc.AuthenticateAndAuthorizeRequest{
+			Request: downstreamReq,
+		})
+		if err != nil {
+			ret.Error = err.Error()
+			return ret, nil
+		}
+	}
+
+	ret.IsAuthenticated = authResp.IsAuthenticated
+	ret.IsAuthorized = authResp.IsAuthorized
+	if authResp.AuthorizationDecisionReason != nil {
+		if reason, err := pbutils.MarshalJSON(authResp.AuthorizationDecisionReason, false); err == nil {
+			ret.Reason = reason
+		}
+	}
+
+	if reqCtx := authResp.RequestContext; reqCtx != nil {
+		if reqCtx.User != nil {
+			ret.User = reqCtx.User.Metadata.Name
+		}
+		if reqCtx.Session != nil {
+			ret.Session = reqCtx.Session.Metadata.Name
+		}
+	}
+
+	if !authResp.IsAuthorized {
+		return ret, nil
+	}
+
+	ret.Config = getServiceConfigName(authResp)
+
+	reqCtx := &middlewares.RequestContext{
+		Service:           svc,
+		DownstreamRequest: downstreamReq,
+		DownstreamInfo:    authResp.RequestContext,
+		AuthResponse:      authResp,
+		ServiceConfig:     vigilutils.GetServiceConfig(ctx, authResp),
+	}
+	ret.Trace = getDebugEchoTrace(req, reqCtx)
+
+	if ret.Trace.ShortCircuit == "" {
+		if upstream, err := s.lbManager.GetUpstream(ctx, authResp); err == nil {
+			ret.Upstream = upstream.URL.String()
+		} else {
+			ret.Error = err.Error()
+		}
+	}
+
+	return ret, nil
+}
+
+func getDebugEvaluateRequest(desc *debugEvaluateRequest) (*http.Request, error) {
+	method := strings.ToUpper(desc.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	if !strings.HasPrefix(desc.Path, "/") {
+		return nil, errInvalidPath
+	}
+
+	u, err := url.ParseRequestURI(desc.Path)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "https"
+	u.Host = desc.Host
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range desc.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+)
+
+// applyDuplicateHeaders applies the per header name policies of the repeated
+// headers. Some upstreams and clients only read the first or the last value
+// of a repeated header which results in subtle bugs for headers such as
+// Authorization and Cookie.
+func applyDuplicateHeaders(hdr http.Header, policies []*corev1.Service_Spec_Config_HTTP_Header_Duplicate) {
+	for _, policy := range policies {
+		key := http.CanonicalHeaderKey(policy.Name)
+		vals := hdr[key]
+		if len(vals) < 2 {
+			continue
+		}
+
+		switch policy.Policy {
+		case corev1.Service_Spec_Config_HTTP_Header_Duplicate_MERGE:
+			sep := ", "
+			if key == "Cookie" {
+				sep = "; "
+			}
+			hdr[key] = []string{strings.Join(vals, sep)}
+		case corev1.Service_Spec_Config_HTTP_Header_Duplicate_FIRST:
+			hdr[key] = vals[:1]
+		case corev1.Service_Spec_Config_HTTP_Header_Duplicate_LAST:
+			hdr[key] = vals[len(vals)-1:]
+		}
+	}
+}
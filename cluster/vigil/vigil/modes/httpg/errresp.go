@@ -0,0 +1,94 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+func writeErrorResponse(w http.ResponseWriter, req *http.Request,
+	httpCfg *corev1.Service_Spec_Config_HTTP, statusCode int) {
+	var format corev1.Service_Spec_Config_HTTP_ErrorResponse_Format
+	if httpCfg != nil && httpCfg.ErrorResponse != nil {
+		format = httpCfg.ErrorResponse.Format
+	}
+
+	middlewares.SetServerHeader(w.Header(), httpCfg)
+	middlewares.WriteErrorResponse(w, req, format, statusCode)
+}
+
+// writeGRPCStatus writes a trailers-only gRPC response so that the gRPC
+// clients get the status code rather than an HTTP error.
+func writeGRPCStatus(w http.ResponseWriter, code codes.Code, msg string) {
+	hdr := w.Header()
+	hdr.Del("Content-Length")
+	hdr.Set("Content-Type", "application/grpc")
+	hdr.Set("Grpc-Status", strconv.Itoa(int(code)))
+	hdr.Set("Grpc-Message", msg)
+	w.WriteHeader(http.StatusOK)
+}
+
+const (
+	upstreamUnavailableNoUpstream    = "noUpstream"
+	upstreamUnavailableConnectFailed = "connectFailed"
+)
+
+const defaultUpstreamUnavailableRetryAfter = 5 * time.Second
+
+// writeNoUpstreamResponse responds to the requests for which no upstream is
+// available at all, as opposed to failing to connect to the available ones.
+// This is typically a transient condition while the upstreams are being
+// scaled, hence the configurable response with a Retry-After hint.
+func (s *Server) writeNoUpstreamResponse(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+
+	var httpCfg *corev1.Service_Spec_Config_HTTP
+	if reqCtx.ServiceConfig != nil {
+		httpCfg = reqCtx.ServiceConfig.GetHttp()
+	}
+
+	zap.L().Debug("No upstream is available", zap.String("reason", upstreamUnavailableNoUpstream))
+	s.metricsStore.AtUpstreamUnavailable(upstreamUnavailableNoUpstream)
+
+	cfg := httpCfg.GetUpstreamUnavailable()
+	if cfg == nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	statusCode := http.StatusServiceUnavailable
+	if cfg.StatusCode >= 400 && cfg.StatusCode <= 599 {
+		statusCode = int(cfg.StatusCode)
+	}
+
+	retryAfter := defaultUpstreamUnavailableRetryAfter
+	if val := umetav1.ToDuration(cfg.RetryAfter).ToGo(); val > 0 {
+		retryAfter = val
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeErrorResponse(w, req, httpCfg, statusCode)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+)
+
+const defaultETagMaxSize = 1 << 20
+
+// setResponseETag sets the ETag of the upstream responses lacking one from the
+// hash of their body and turns the response into a 304 if it matches the
+// If-None-Match header of the request. Bodies larger than the max size or of
+// unknown length are left intact.
+func setResponseETag(r *http.Response, cfg *corev1.Service_Spec_Config_HTTP_ETag) error {
+	if cfg == nil || !cfg.IsEnabled {
+		return nil
+	}
+
+	if r.Request == nil || r.Request.Method != http.MethodGet ||
+		r.StatusCode != http.StatusOK || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	if r.Header.Get("ETag") != "" || hasNoStore(r.Header) {
+		return nil
+	}
+
+	maxSize := int64(defaultETagMaxSize)
+	if cfg.MaxSize > 0 {
+		maxSize = int64(cfg.MaxSize)
+	}
+
+	// Bodies of unknown length are not buffered since they might be
+	// streamed by the upstream.
+	if r.ContentLength < 0 || r.ContentLength > maxSize {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	etag := computeETag(body, cfg.IsWeak)
+	r.Header.Set("ETag", etag)
+
+	if !matchesIfNoneMatch(r.Request.Header.Get("If-None-Match"), etag) {
+		httputils.SetResponseBody(r, body)
+		return nil
+	}
+
+	r.StatusCode = http.StatusNotModified
+	r.Status = "304 " + http.StatusText(http.StatusNotModified)
+	r.Body = http.NoBody
+	r.ContentLength = 0
+	r.TransferEncoding = nil
+	r.Header.Del("Content-Length")
+	r.Header.Del("Transfer-Encoding")
+
+	return nil
+}
+
+func computeETag(body []byte, isWeak bool) string {
+	sum := sha256.Sum256(body)
+	ret := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if isWeak {
+		return "W/" + ret
+	}
+
+	return ret
+}
+
+// matchesIfNoneMatch uses the weak comparison of the entity tags as required
+// for If-None-Match.
+func matchesIfNoneMatch(inm, etag string) bool {
+	if inm == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, val := range strings.Split(inm, ",") {
+		val = strings.TrimSpace(val)
+		if val == "*" || strings.TrimPrefix(val, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasNoStore(hdr http.Header) bool {
+	for _, val := range hdr.Values("Cache-Control") {
+		for _, directive := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFanOutMaxParallel = 3
+	maxFanOutMaxParallel     = 8
+
+	fanOutResultWin   = "win"
+	fanOutResultLoss  = "loss"
+	fanOutResultError = "error"
+)
+
+type fanOutTarget struct {
+	region   string
+	upstream *loadbalancer.Upstream
+	rt       http.RoundTripper
+}
+
+// fanOutRoundTripper sends the idempotent read requests to all its targets
+// at the same time and returns the first successful response. The remaining
+// requests are canceled and their responses, if any, are closed.
+type fanOutRoundTripper struct {
+	primary *loadbalancer.Upstream
+	targets []*fanOutTarget
+	results metric.Int64Counter
+}
+
+func (s *Server) getFanOutRoundTripper(primary *roundTripper, region string,
+	cfg *corev1.Service_Spec_Config_HTTP_FanOut) http.RoundTripper {
+	maxParallel := defaultFanOutMaxParallel
+	if cfg.MaxParallel > 0 {
+		maxParallel = min(int(cfg.MaxParallel), maxFanOutMaxParallel)
+	}
+
+	ret := &fanOutRoundTripper{
+		primary: primary.upstream,
+		targets: []*fanOutTarget{
+			{
+				region:   region,
+				upstream: primary.upstream,
+				rt:       primary,
+			},
+		},
+		results: s.metricsStore.fanOutResults,
+	}
+
+	for _, regionCfg := range cfg.Regions {
+		if len(ret.targets) >= maxParallel {
+			break
+		}
+
+		upstream, err := loadbalancer.NewURLUpstream(regionCfg.Url)
+		if err != nil {
+			zap.L().Debug("Could not get fanOut region upstream",
+				zap.String("region", regionCfg.Name), zap.Error(err))
+			continue
+		}
+
+		rt, err := s.getRoundTripper(upstream, nil)
+		if err != nil {
+			continue
+		}
+
+		ret.targets = append(ret.targets, &fanOutTarget{
+			region:   regionCfg.Name,
+			upstream: upstream,
+			rt:       rt,
+		})
+	}
+
+	return ret
+}
+
+func isFanOutRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+
+	if req.Header.Get("Upgrade") != "" {
+		return false
+	}
+
+	return req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0
+}
+
+type fanOutResult struct {
+	target *fanOutTarget
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+func (r *fanOutRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(r.targets) < 2 || !isFanOutRequest(req) {
+		return r.targets[0].rt.RoundTrip(req)
+	}
+
+	resultCh := make(chan *fanOutResult, len(r.targets))
+	cancels := make(map[*fanOutTarget]context.CancelFunc, len(r.targets))
+	for _, target := range r.targets {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels[target] = cancel
+		outReq := r.getTargetRequest(req.Clone(ctx), target)
+
+		go func() {
+			resp, err := target.rt.RoundTrip(outReq)
+			resultCh <- &fanOutResult{
+				target: target,
+				resp:   resp,
+				err:    err,
+				cancel: cancel,
+			}
+		}()
+	}
+
+	var winner *fanOutResult
+	var fallback *fanOutResult
+	remaining := len(r.targets)
+
+	for remaining > 0 && winner == nil {
+		res := <-resultCh
+		remaining--
+
+		switch {
+		case res.err == nil && res.resp.StatusCode < 500:
+			winner = res
+		case fallback == nil || (fallback.resp == nil && res.resp != nil):
+			if fallback != nil {
+				r.release(fallback, fanOutResultError)
+			}
+			fallback = res
+		default:
+			r.release(res, fanOutResultError)
+		}
+	}
+
+	if winner == nil {
+		winner = fallback
+	} else if fallback != nil {
+		r.release(fallback, fanOutResultError)
+	}
+
+	if remaining > 0 {
+		for target, cancel := range cancels {
+			if target != winner.target {
+				cancel()
+			}
+		}
+
+		go func() {
+			for i := 0; i < remaining; i++ {
+				r.release(<-resultCh, fanOutResultLoss)
+			}
+		}()
+	}
+
+	if winner.err != nil {
+		winner.cancel()
+		r.record(winner.target, fanOutResultError)
+		return nil, winner.err
+	}
+
+	r.record(winner.target, fanOutResultWin)
+	winner.resp.Body = &cancelOnCloseBody{
+		ReadCloser: winner.resp.Body,
+		cancel:     winner.cancel,
+	}
+
+	return winner.resp, nil
+}
+
+// getTargetRequest points the request to the target upstream. The Host
+// header is only rewritten if it is set to the main upstream host.
+func (r *fanOutRoundTripper) getTargetRequest(req *http.Request, target *fanOutTarget) *http.Request {
+	if target.upstream == r.primary {
+		return req
+	}
+
+	switch target.upstream.URL.Scheme {
+	case "https", "wss", "grpcs":
+		req.URL.Scheme = "https"
+	default:
+		req.URL.Scheme = "http"
+	}
+	req.URL.Host = target.upstream.URL.Host
+
+	if req.Host == r.primary.URL.Host {
+		req.Host = target.upstream.URL.Host
+	}
+
+	return req
+}
+
+// release cancels the request of a result that is not returned and closes
+// its response body, if any, so that its connection is released.
+func (r *fanOutRoundTripper) release(res *fanOutResult, result string) {
+	res.cancel()
+	if res.resp != nil {
+		res.resp.Body.Close()
+	}
+
+	if res.err != nil {
+		result = fanOutResultError
+	}
+	r.record(res.target, result)
+}
+
+func (r *fanOutRoundTripper) record(target *fanOutTarget, result string) {
+	if r.results == nil {
+		return
+	}
+
+	r.results.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("region", target.region),
+		attribute.String("result", result)))
+}
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"net/http"
+	"slices"
+)
+
+// webSocketHeaderNames maps the canonical form of the WebSocket-specific
+// header names to the casing used by the WebSocket spec since some HTTP/1.1
+// WebSocket servers match these names case-sensitively.
+var webSocketHeaderNames = map[string]string{
+	"Sec-Websocket-Key":        "Sec-WebSocket-Key",
+	"Sec-Websocket-Extensions": "Sec-WebSocket-Extensions",
+	"Sec-Websocket-Accept":     "Sec-WebSocket-Accept",
+	"Sec-Websocket-Protocol":   "Sec-WebSocket-Protocol",
+	"Sec-Websocket-Version":    "Sec-WebSocket-Version",
+}
+
+// normalizeHeaderNames merges the header names that differ only in case,
+// which can be introduced by setting the header map directly, under a single
+// name. The names are canonical for HTTP/1.1 upstreams, except for the
+// WebSocket-specific ones, while the HTTP/2 transport lowercases the
+// canonical names by itself.
+func normalizeHeaderNames(hdr http.Header, isHTTP2 bool) {
+	keys := make([]string, 0, len(hdr))
+	for k := range hdr {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		target := http.CanonicalHeaderKey(k)
+		if !isHTTP2 {
+			if name, ok := webSocketHeaderNames[target]; ok {
+				target = name
+			}
+		}
+
+		if target == k {
+			continue
+		}
+
+		hdr[target] = append(hdr[target], hdr[k]...)
+		delete(hdr, k)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+)
+
+// setHeadResponseHeaders removes the Content-Length of the upstream responses
+// to HEAD requests whose GET counterparts would have their bodies transformed
+// since the length of the transformed bodies cannot be known without the body.
+// The compression of the GET responses is reflected by the compress
+// middleware.
+func setHeadResponseHeaders(r *http.Response, httpCfg *corev1.Service_Spec_Config_HTTP) {
+	if r.Request == nil || r.Request.Method != http.MethodHead {
+		return
+	}
+
+	switch httpCfg.GetHeadResponse().GetMode() {
+	case corev1.Service_Spec_Config_HTTP_HeadResponse_PRESERVE:
+		return
+	case corev1.Service_Spec_Config_HTTP_HeadResponse_OMIT:
+		r.Header.Del("Content-Length")
+		return
+	}
+
+	if isGETBodyTransformed(r, httpCfg) {
+		r.Header.Del("Content-Length")
+	}
+}
+
+// isGETBodyTransformed returns whether the body of the GET response having
+// the same headers as the HEAD response would be transformed by
+// streamTransform or jsonFormat.
+func isGETBodyTransformed(r *http.Response, httpCfg *corev1.Service_Spec_Config_HTTP) bool {
+	switch r.StatusCode {
+	case http.StatusNoContent, http.StatusNotModified:
+		return false
+	}
+
+	if httputils.GetContentEncoding(r.Header) != "" {
+		return false
+	}
+
+	mediaType := httputils.GetMediaType(&http.Request{
+		Header:        r.Header,
+		ContentLength: r.ContentLength,
+	})
+
+	if cfg := httpCfg.GetStreamTransform(); len(cfg.GetRules()) > 0 &&
+		len(getStreamTransformers(cfg, mediaType)) > 0 {
+		return true
+	}
+
+	if cfg := httpCfg.GetJsonFormat(); getJSONFormatMode(r.Request.Header, cfg) !=
+		corev1.Service_Spec_Config_HTTP_JSONFormat_MODE_UNSET && isJSONMediaType(mediaType) {
+		maxSize := int64(defaultJSONFormatMaxSize)
+		if cfg.MaxSize > 0 {
+			maxSize = int64(cfg.MaxSize)
+		}
+
+		return r.ContentLength >= 0 && r.ContentLength <= maxSize
+	}
+
+	return false
+}
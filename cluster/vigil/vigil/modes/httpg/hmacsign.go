@@ -0,0 +1,105 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+)
+
+const defaultHMACHeader = "X-Signature"
+
+// signHMAC sets the HMAC signature of the request, and the timestamp if
+// configured, in the request headers. The body is the buffered request body.
+func signHMAC(req *http.Request, cfg *corev1.Service_Spec_Config_HTTP_Auth_HMAC,
+	key []byte, body []byte, now time.Time) {
+
+	var newHash func() hash.Hash
+	switch cfg.Algorithm {
+	case corev1.Service_Spec_Config_HTTP_Auth_HMAC_SHA512:
+		newHash = sha512.New
+	case corev1.Service_Spec_Config_HTTP_Auth_HMAC_SHA1:
+		newHash = sha1.New
+	default:
+		newHash = sha256.New
+	}
+
+	mac := hmac.New(newHash, key)
+	mac.Write(getHMACPayload(req, cfg, body, now))
+	sum := mac.Sum(nil)
+
+	var sig string
+	switch cfg.Encoding {
+	case corev1.Service_Spec_Config_HTTP_Auth_HMAC_BASE64:
+		sig = base64.StdEncoding.EncodeToString(sum)
+	default:
+		sig = hex.EncodeToString(sum)
+	}
+
+	header := defaultHMACHeader
+	if cfg.Header != "" {
+		header = cfg.Header
+	}
+
+	req.Header.Set(header, cfg.Prefix+sig)
+}
+
+func getHMACPayload(req *http.Request, cfg *corev1.Service_Spec_Config_HTTP_Auth_HMAC,
+	body []byte, now time.Time) []byte {
+	canonicalization := cfg.Canonicalization
+	if cfg.TimestampHeader == "" {
+		canonicalization = corev1.Service_Spec_Config_HTTP_Auth_HMAC_BODY
+	} else if canonicalization == corev1.Service_Spec_Config_HTTP_Auth_HMAC_CANONICALIZATION_UNSET {
+		canonicalization = corev1.Service_Spec_Config_HTTP_Auth_HMAC_TIMESTAMP_BODY
+	}
+
+	if canonicalization == corev1.Service_Spec_Config_HTTP_Auth_HMAC_BODY {
+		return body
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set(cfg.TimestampHeader, timestamp)
+
+	separator := "."
+	if cfg.Separator != "" {
+		separator = cfg.Separator
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(timestamp)
+	buf.WriteString(separator)
+	if canonicalization == corev1.Service_Spec_Config_HTTP_Auth_HMAC_TIMESTAMP_METHOD_PATH_BODY {
+		buf.WriteString(req.Method)
+		buf.WriteString(separator)
+		buf.WriteString(req.URL.RequestURI())
+		buf.WriteString(separator)
+	}
+	buf.Write(body)
+
+	return buf.Bytes()
+}
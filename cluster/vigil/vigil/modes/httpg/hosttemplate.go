@@ -0,0 +1,140 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"golang.org/x/net/http/httpguts"
+)
+
+const maxTemplatedHostLen = 253
+
+// getTemplatedHost returns the Host rendered from the template, the template
+// fallback or the upstream host, in that order.
+func getTemplatedHost(tmpl *corev1.Service_Spec_Config_HTTP_Header_Host_Template,
+	outReq *http.Request, reqCtx *middlewares.RequestContext, upstreamHost string) string {
+	if ret, ok := renderHostTemplate(tmpl.Value, outReq, reqCtx); ok {
+		return ret
+	}
+
+	if tmpl.Fallback != "" {
+		return tmpl.Fallback
+	}
+
+	return upstreamHost
+}
+
+// renderHostTemplate renders the template. It returns false if a variable is
+// missing or if the rendered value is not a valid Host.
+func renderHostTemplate(tmpl string, outReq *http.Request, reqCtx *middlewares.RequestContext) (string, bool) {
+	var b strings.Builder
+
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			b.WriteString(tmpl)
+			break
+		}
+
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			return "", false
+		}
+
+		val := getHostTemplateVar(tmpl[start+1:start+end], outReq, reqCtx)
+		if !isValidHostTemplateVar(val) {
+			return "", false
+		}
+
+		b.WriteString(tmpl[:start])
+		b.WriteString(val)
+		tmpl = tmpl[start+end+1:]
+	}
+
+	ret := b.String()
+	if ret == "" || len(ret) > maxTemplatedHostLen ||
+		strings.ContainsAny(ret, "/@?# ") || !httpguts.ValidHostHeader(ret) {
+		return "", false
+	}
+
+	return ret, true
+}
+
+func getHostTemplateVar(name string, outReq *http.Request, reqCtx *middlewares.RequestContext) string {
+	switch name {
+	case "service":
+		return ucorev1.ToService(reqCtx.Service).Name()
+	case "namespace":
+		return ucorev1.ToService(reqCtx.Service).Namespace()
+	}
+
+	typ, arg, ok := strings.Cut(name, ".")
+	if !ok || arg == "" {
+		return ""
+	}
+
+	switch typ {
+	case "path":
+		idx, err := strconv.Atoi(arg)
+		if err != nil || idx < 0 {
+			return ""
+		}
+
+		pth := reqCtx.DownstreamRequest.GetRequest().GetHttp().GetPath()
+		if pth == "" {
+			pth = outReq.URL.Path
+		}
+
+		segments := strings.Split(strings.Trim(pth, "/"), "/")
+		if idx >= len(segments) {
+			return ""
+		}
+		return segments[idx]
+	case "header":
+		return outReq.Header.Get(arg)
+	case "query":
+		return outReq.URL.Query().Get(arg)
+	default:
+		return ""
+	}
+}
+
+// isValidHostTemplateVar reports whether the variable value can be used as a
+// part of a Host. The values are set by the clients and are hence restricted
+// to the DNS label characters and dots.
+func isValidHostTemplateVar(val string) bool {
+	if val == "" || strings.HasPrefix(val, ".") || strings.HasSuffix(val, ".") ||
+		strings.Contains(val, "..") {
+		return false
+	}
+
+	for _, r := range val {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
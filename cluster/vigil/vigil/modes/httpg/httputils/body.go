@@ -0,0 +1,87 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httputils
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// SetRequestBody replaces the request body with a fully buffered body. The
+// Content-Length is recomputed and any Transfer-Encoding is removed so that
+// the framing of the request always matches its new body.
+func SetRequestBody(req *http.Request, body []byte) {
+	req.TransferEncoding = nil
+	req.Header.Del("Transfer-Encoding")
+
+	if len(body) == 0 {
+		// A non-nil body with a zero ContentLength is treated as a body of
+		// unknown length by the Transport which would then send it chunked
+		req.Body = http.NoBody
+		req.ContentLength = 0
+		req.GetBody = func() (io.ReadCloser, error) {
+			return http.NoBody, nil
+		}
+		req.Header.Del("Content-Length")
+		return
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// SetRequestBodyStream replaces the request body with a body whose length is
+// unknown. The Content-Length is removed and the request is hence sent
+// chunked.
+func SetRequestBodyStream(req *http.Request, body io.ReadCloser) {
+	req.Body = body
+	req.ContentLength = -1
+	req.GetBody = nil
+	req.Header.Del("Content-Length")
+}
+
+// SetResponseBody replaces the upstream response body with a fully buffered
+// body and recomputes its Content-Length.
+func SetResponseBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+	resp.Header.Del("Transfer-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// SetResponseBodyStream replaces the upstream response body with a body whose
+// length is unknown. The Content-Length is removed and the response is hence
+// sent chunked to HTTP/1.1 clients.
+func SetResponseBodyStream(resp *http.Response, body io.ReadCloser) {
+	resp.Body = body
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+}
+
+// SetContentLength sets the Content-Length header of a response that is
+// about to be written with a fully buffered body of the given size.
+func SetContentLength(hdr http.Header, size int) {
+	hdr.Del("Transfer-Encoding")
+	hdr.Set("Content-Length", strconv.Itoa(size))
+}
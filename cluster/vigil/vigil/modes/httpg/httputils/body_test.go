@@ -0,0 +1,191 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httputils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRequestBody(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type received struct {
+		contentLength    int64
+		transferEncoding []string
+		body             string
+	}
+
+	receivedCh := make(chan *received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receivedCh <- &received{
+			contentLength:    r.ContentLength,
+			transferEncoding: r.TransferEncoding,
+			body:             string(body),
+		}
+	}))
+	defer srv.Close()
+
+	send := func(req *http.Request) *received {
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return <-receivedCh
+	}
+
+	{
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("original body"))
+		assert.Nil(t, err)
+		req.Header.Set("Content-Length", "13")
+
+		SetRequestBody(req, []byte("hello"))
+		assert.Equal(t, "5", req.Header.Get("Content-Length"))
+
+		res := send(req)
+		assert.Equal(t, int64(5), res.contentLength)
+		assert.Nil(t, res.transferEncoding)
+		assert.Equal(t, "hello", res.body)
+
+		body, err := req.GetBody()
+		assert.Nil(t, err)
+		bb, _ := io.ReadAll(body)
+		assert.Equal(t, "hello", string(bb))
+	}
+
+	{
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("original body"))
+		assert.Nil(t, err)
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+
+		SetRequestBody(req, []byte("hello"))
+
+		res := send(req)
+		assert.Equal(t, int64(5), res.contentLength)
+		assert.Nil(t, res.transferEncoding)
+		assert.Equal(t, "hello", res.body)
+	}
+
+	{
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("original body"))
+		assert.Nil(t, err)
+		req.Header.Set("Content-Length", "13")
+
+		SetRequestBody(req, nil)
+		assert.Equal(t, "", req.Header.Get("Content-Length"))
+
+		res := send(req)
+		assert.Nil(t, res.transferEncoding)
+		assert.Equal(t, "", res.body)
+	}
+
+	{
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("original body"))
+		assert.Nil(t, err)
+		req.Header.Set("Content-Length", "13")
+
+		SetRequestBodyStream(req, io.NopCloser(strings.NewReader("streamed body")))
+		assert.Equal(t, "", req.Header.Get("Content-Length"))
+
+		res := send(req)
+		assert.Equal(t, int64(-1), res.contentLength)
+		assert.Equal(t, []string{"chunked"}, res.transferEncoding)
+		assert.Equal(t, "streamed body", res.body)
+	}
+}
+
+func TestSetResponseBody(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "13")
+		w.Write([]byte("original body"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	assert.Nil(t, err)
+
+	doProxy := func(modify func(resp *http.Response) error) *http.Response {
+		proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+		proxy.ModifyResponse = modify
+		srv := httptest.NewServer(proxy)
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	{
+		resp := doProxy(func(resp *http.Response) error {
+			resp.Body.Close()
+			SetResponseBody(resp, []byte("hello"))
+			return nil
+		})
+
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "hello", string(body))
+		assert.Equal(t, int64(5), resp.ContentLength)
+		assert.Nil(t, resp.TransferEncoding)
+	}
+
+	{
+		resp := doProxy(func(resp *http.Response) error {
+			SetResponseBodyStream(resp, io.NopCloser(io.MultiReader(resp.Body, strings.NewReader(" and more"))))
+			return nil
+		})
+
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "original body and more", string(body))
+		assert.Equal(t, int64(-1), resp.ContentLength)
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		rw.Header().Set("Content-Length", "100")
+		rw.Header().Set("Transfer-Encoding", "chunked")
+
+		SetContentLength(rw.Header(), 5)
+		assert.Equal(t, "5", rw.Header().Get("Content-Length"))
+		assert.Equal(t, "", rw.Header().Get("Transfer-Encoding"))
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httputils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// MaxDecodedBodySize is the default upper bound of decoded bodies that guards
+// against decompression bombs.
+const MaxDecodedBodySize = 32 * 1024 * 1024
+
+var ErrDecodedBodyTooLarge = errors.New("Decoded body is too large")
+
+// GetContentEncoding returns the normalized single Content-Encoding of the
+// header. It returns an empty string for identity bodies.
+func GetContentEncoding(hdr http.Header) string {
+	enc := strings.ToLower(strings.TrimSpace(hdr.Get("Content-Encoding")))
+	switch enc {
+	case "identity":
+		return ""
+	case "x-gzip":
+		return "gzip"
+	default:
+		return enc
+	}
+}
+
+// IsSupportedEncoding reports whether the body encoding can be decoded and
+// re-encoded by DecodeBody and EncodeBody.
+func IsSupportedEncoding(enc string) bool {
+	switch enc {
+	case "gzip", "x-gzip", "deflate", "br", "zstd":
+		return true
+	default:
+		return false
+	}
+}
+
+// DecodeBody decodes the body according to the given content encoding. The
+// decoded body must not exceed maxSize bytes.
+func DecodeBody(body []byte, enc string, maxSize int) ([]byte, error) {
+	if enc == "" || enc == "identity" {
+		return body, nil
+	}
+
+	if maxSize <= 0 {
+		maxSize = MaxDecodedBodySize
+	}
+
+	var r io.Reader
+	switch enc {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case "deflate":
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderMaxMemory(uint64(maxSize)))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, errors.Errorf("Unsupported content encoding: %s", enc)
+	}
+
+	ret, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return nil, ErrDecodedBodyTooLarge
+		}
+		return nil, err
+	}
+	if len(ret) > maxSize {
+		return nil, ErrDecodedBodyTooLarge
+	}
+
+	return ret, nil
+}
+
+// EncodeBody encodes the body with the given content encoding.
+func EncodeBody(body []byte, enc string) ([]byte, error) {
+	if enc == "" || enc == "identity" {
+		return body, nil
+	}
+
+	buf := &bytes.Buffer{}
+
+	var w io.WriteCloser
+	switch enc {
+	case "gzip", "x-gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	case "br":
+		w = brotli.NewWriter(buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		return nil, errors.Errorf("Unsupported content encoding: %s", enc)
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodedResponseBody is a response body that has been transparently
+// decoded for the body-processing features (e.g. Lua and ExtProc plugins)
+// and that is restored to its original encoding once processed.
+type DecodedResponseBody struct {
+	encoding string
+	original []byte
+}
+
+// DecodeResponseBody decodes the buffered response body according to its
+// Content-Encoding header and removes the header. If the body is identity,
+// its encoding is not supported or it cannot be decoded within maxSize, the
+// body and the header are returned as is and the features operate on the
+// raw bytes.
+func DecodeResponseBody(hdr http.Header, body []byte, maxSize int) ([]byte, *DecodedResponseBody) {
+	enc := GetContentEncoding(hdr)
+	if enc == "" || !IsSupportedEncoding(enc) || len(body) == 0 {
+		return body, nil
+	}
+
+	decoded, err := DecodeBody(body, enc, maxSize)
+	if err != nil {
+		return body, nil
+	}
+
+	hdr.Del("Content-Encoding")
+
+	return decoded, &DecodedResponseBody{
+		encoding: enc,
+		original: body,
+	}
+}
+
+// Restore returns the body to be sent to the client. An unmodified body is
+// restored to the original bytes, otherwise it is re-encoded with the
+// original encoding. If the re-encoding fails, the body is sent as identity.
+func (d *DecodedResponseBody) Restore(hdr http.Header, body []byte, isModified bool) []byte {
+	if d == nil {
+		return body
+	}
+
+	if !isModified {
+		hdr.Set("Content-Encoding", d.encoding)
+		return d.original
+	}
+
+	encoded, err := EncodeBody(body, d.encoding)
+	if err != nil {
+		return body
+	}
+
+	hdr.Set("Content-Encoding", d.encoding)
+	return encoded
+}
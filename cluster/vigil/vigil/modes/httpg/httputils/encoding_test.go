@@ -0,0 +1,106 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httputils
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoding(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	body := bytes.Repeat([]byte(`{"hello":"world"}`), 1000)
+
+	for _, enc := range []string{"gzip", "x-gzip", "deflate", "br", "zstd"} {
+		assert.True(t, IsSupportedEncoding(enc))
+
+		encoded, err := EncodeBody(body, enc)
+		assert.Nil(t, err, "%s", enc)
+		assert.True(t, len(encoded) < len(body))
+
+		decoded, err := DecodeBody(encoded, enc, 0)
+		assert.Nil(t, err, "%s", enc)
+		assert.Equal(t, body, decoded)
+
+		_, err = DecodeBody(encoded, enc, len(body)-1)
+		assert.ErrorIs(t, err, ErrDecodedBodyTooLarge, "%s", enc)
+	}
+
+	{
+		res, err := DecodeBody(body, "", 0)
+		assert.Nil(t, err)
+		assert.Equal(t, body, res)
+
+		_, err = DecodeBody(body, "compress", 0)
+		assert.NotNil(t, err)
+
+		_, err = DecodeBody(body, "gzip", 0)
+		assert.NotNil(t, err)
+	}
+
+	{
+		hdr := http.Header{}
+		hdr.Set("Content-Encoding", "identity")
+		assert.Equal(t, "", GetContentEncoding(hdr))
+		hdr.Set("Content-Encoding", " X-Gzip")
+		assert.Equal(t, "gzip", GetContentEncoding(hdr))
+	}
+
+	{
+		encoded, err := EncodeBody(body, "br")
+		assert.Nil(t, err)
+
+		hdr := http.Header{}
+		hdr.Set("Content-Encoding", "br")
+
+		res, decoded := DecodeResponseBody(hdr, encoded, 0)
+		assert.NotNil(t, decoded)
+		assert.Equal(t, body, res)
+		assert.Equal(t, "", hdr.Get("Content-Encoding"))
+
+		assert.Equal(t, encoded, decoded.Restore(hdr, res, false))
+		assert.Equal(t, "br", hdr.Get("Content-Encoding"))
+
+		hdr.Del("Content-Encoding")
+		restored := decoded.Restore(hdr, []byte("modified"), true)
+		assert.Equal(t, "br", hdr.Get("Content-Encoding"))
+		res, err = DecodeBody(restored, "br", 0)
+		assert.Nil(t, err)
+		assert.Equal(t, "modified", string(res))
+	}
+
+	{
+		hdr := http.Header{}
+		hdr.Set("Content-Encoding", "gzip")
+
+		res, decoded := DecodeResponseBody(hdr, body, 0)
+		assert.Nil(t, decoded)
+		assert.Equal(t, body, res)
+		assert.Equal(t, "gzip", hdr.Get("Content-Encoding"))
+		assert.Equal(t, body, decoded.Restore(hdr, body, true))
+	}
+}
@@ -17,7 +17,9 @@
 package httputils
 
 import (
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -52,3 +54,70 @@ func GetGRPCInfo(path string) (*GRPCInfo, error) {
 
 	return ret, nil
 }
+
+// ParseGRPCTimeout parses the value of the grpc-timeout header as defined in
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+func ParseGRPCTimeout(arg string) (time.Duration, error) {
+	if len(arg) < 2 || len(arg) > 9 {
+		return 0, errors.Errorf("Invalid grpc-timeout length")
+	}
+
+	val, err := strconv.ParseInt(arg[:len(arg)-1], 10, 64)
+	if err != nil || val < 0 {
+		return 0, errors.Errorf("Invalid grpc-timeout value")
+	}
+
+	var unit time.Duration
+	switch arg[len(arg)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, errors.Errorf("Invalid grpc-timeout unit")
+	}
+
+	return time.Duration(val) * unit, nil
+}
+
+// EncodeGRPCTimeout encodes the duration as a grpc-timeout header value
+// using the most precise unit that fits within the 8 digits limit.
+func EncodeGRPCTimeout(d time.Duration) string {
+	const maxVal = 99999999
+
+	if d <= 0 {
+		return "0n"
+	}
+
+	units := []struct {
+		d time.Duration
+		c string
+	}{
+		{time.Nanosecond, "n"},
+		{time.Microsecond, "u"},
+		{time.Millisecond, "m"},
+		{time.Second, "S"},
+		{time.Minute, "M"},
+	}
+
+	for _, u := range units {
+		if val := int64((d + u.d - 1) / u.d); val <= maxVal {
+			return strconv.FormatInt(val, 10) + u.c
+		}
+	}
+
+	val := int64(d / time.Hour)
+	if val > maxVal {
+		val = maxVal
+	}
+
+	return strconv.FormatInt(val, 10) + "H"
+}
@@ -18,6 +18,7 @@ package httputils
 
 import (
 	"testing"
+	"time"
 
 	"github.com/octelium/octelium/cluster/common/tests"
 	"github.com/stretchr/testify/assert"
@@ -80,3 +81,61 @@ func TestGetGRPCInfo(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestGRPCTimeout(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		cases := map[string]time.Duration{
+			"1H":        time.Hour,
+			"2M":        2 * time.Minute,
+			"30S":       30 * time.Second,
+			"1500m":     1500 * time.Millisecond,
+			"100u":      100 * time.Microsecond,
+			"99999999n": 99999999 * time.Nanosecond,
+		}
+
+		for arg, expected := range cases {
+			res, err := ParseGRPCTimeout(arg)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, res)
+		}
+	}
+
+	{
+		invalids := []string{
+			"",
+			"1",
+			"S",
+			"10s",
+			"-1S",
+			"123456789S",
+			"1.5S",
+		}
+		for _, invalid := range invalids {
+			_, err := ParseGRPCTimeout(invalid)
+			assert.NotNil(t, err, "%s", invalid)
+		}
+	}
+
+	{
+		durations := []time.Duration{
+			time.Nanosecond,
+			1500 * time.Millisecond,
+			3 * time.Second,
+			10 * time.Minute,
+			24 * 365 * time.Hour,
+		}
+
+		for _, d := range durations {
+			res, err := ParseGRPCTimeout(EncodeGRPCTimeout(d))
+			assert.Nil(t, err)
+			assert.True(t, res >= d)
+		}
+	}
+}
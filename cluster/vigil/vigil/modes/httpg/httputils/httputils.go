@@ -17,6 +17,7 @@
 package httputils
 
 import (
+	"mime"
 	"net/http"
 	"strings"
 )
@@ -40,3 +41,44 @@ func IsHTMLPage(req *http.Request) bool {
 
 	return strings.Contains(req.Header.Get("Accept"), "text/html") && req.Method == "GET"
 }
+
+// IsInformationalStatus reports whether the status code is a non-final 1xx
+// response (e.g. "100 Continue") that can precede the final response.
+func IsInformationalStatus(code int) bool {
+	return code >= 100 && code < 200 && code != http.StatusSwitchingProtocols
+}
+
+// IsExpectContinue reports whether the request expects a "100 Continue"
+// interim response before sending its body.
+func IsExpectContinue(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Expect"), "100-continue")
+}
+
+// GetMediaType returns the lowercase media type of the request Content-Type
+// header without its parameters. Requests with a body but without a
+// Content-Type header default to "application/octet-stream" as per RFC 9110.
+func GetMediaType(req *http.Request) string {
+	val := strings.TrimSpace(req.Header.Get("Content-Type"))
+	if val == "" {
+		if req.ContentLength != 0 {
+			return "application/octet-stream"
+		}
+		return ""
+	}
+
+	ret, _, err := mime.ParseMediaType(val)
+	if err != nil {
+		// Fall back to the media type itself if only the parameters are invalid
+		ret, _, _ = strings.Cut(val, ";")
+		ret = strings.ToLower(strings.TrimSpace(ret))
+		if strings.ContainsAny(ret, " \t\"()<>@,:[]?=\\") {
+			return ""
+		}
+	}
+
+	if typ, subtype, ok := strings.Cut(ret, "/"); !ok || typ == "" || subtype == "" {
+		return ""
+	}
+
+	return ret
+}
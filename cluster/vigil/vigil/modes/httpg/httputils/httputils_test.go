@@ -0,0 +1,98 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMediaType(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type tstCase struct {
+		contentType   string
+		contentLength int64
+		expected      string
+	}
+
+	cases := []tstCase{
+		{
+			contentType: "application/json",
+			expected:    "application/json",
+		},
+		{
+			contentType: "application/json; charset=utf-8",
+			expected:    "application/json",
+		},
+		{
+			contentType: "multipart/form-data; boundary=----abc",
+			expected:    "multipart/form-data",
+		},
+		{
+			contentType: "Application/GRPC+Proto",
+			expected:    "application/grpc+proto",
+		},
+		{
+			contentType: "text/plain; charset",
+			expected:    "text/plain",
+		},
+		{
+			contentLength: 10,
+			expected:      "application/octet-stream",
+		},
+		{
+			contentLength: -1,
+			expected:      "application/octet-stream",
+		},
+		{
+			expected: "",
+		},
+		{
+			contentType: "json",
+			expected:    "",
+		},
+		{
+			contentType: "application/",
+			expected:    "",
+		},
+		{
+			contentType: "a b/c",
+			expected:    "",
+		},
+	}
+
+	for _, tstCase := range cases {
+		req := &http.Request{
+			Header:        http.Header{},
+			ContentLength: tstCase.contentLength,
+		}
+		if tstCase.contentType != "" {
+			req.Header.Set("Content-Type", tstCase.contentType)
+		}
+
+		assert.Equal(t, tstCase.expected, GetMediaType(req), "%s", tstCase.contentType)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MergeVary merges the given request headers into the Vary header. The
+// resulting Vary header is a single value whose entries are canonicalized
+// and deduplicated. A "*" entry, which means that the response varies on
+// more than the request headers, supersedes all the other entries.
+func MergeVary(hdr http.Header, headers ...string) {
+	vals := hdr.Values("Vary")
+	if len(vals) == 0 && len(headers) == 0 {
+		return
+	}
+
+	var ret []string
+	seen := make(map[string]bool)
+	add := func(val string) bool {
+		val = strings.TrimSpace(val)
+		if val == "" {
+			return true
+		}
+		if val == "*" {
+			return false
+		}
+
+		val = http.CanonicalHeaderKey(val)
+		if !seen[val] {
+			seen[val] = true
+			ret = append(ret, val)
+		}
+		return true
+	}
+
+	for _, val := range vals {
+		for _, entry := range strings.Split(val, ",") {
+			if !add(entry) {
+				hdr.Set("Vary", "*")
+				return
+			}
+		}
+	}
+
+	for _, val := range headers {
+		if !add(val) {
+			hdr.Set("Vary", "*")
+			return
+		}
+	}
+
+	if len(ret) == 0 {
+		hdr.Del("Vary")
+		return
+	}
+
+	hdr.Set("Vary", strings.Join(ret, ", "))
+}
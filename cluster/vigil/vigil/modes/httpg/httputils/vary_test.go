@@ -0,0 +1,76 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httputils
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeVary(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type tstCase struct {
+		vals     []string
+		headers  []string
+		expected []string
+	}
+
+	cases := []tstCase{
+		{},
+		{
+			headers:  []string{"accept-encoding"},
+			expected: []string{"Accept-Encoding"},
+		},
+		{
+			vals:     []string{"Accept-Encoding", "accept-encoding, Origin"},
+			headers:  []string{"X-Tenant", "origin"},
+			expected: []string{"Accept-Encoding, Origin, X-Tenant"},
+		},
+		{
+			vals:     []string{"Origin, *"},
+			headers:  []string{"X-Tenant"},
+			expected: []string{"*"},
+		},
+		{
+			vals:     []string{"Origin"},
+			headers:  []string{"*"},
+			expected: []string{"*"},
+		},
+		{
+			vals: []string{" , "},
+		},
+	}
+
+	for _, tstCase := range cases {
+		hdr := http.Header{}
+		for _, val := range tstCase.vals {
+			hdr.Add("Vary", val)
+		}
+
+		MergeVary(hdr, tstCase.headers...)
+		assert.Equal(t, tstCase.expected, hdr.Values("Vary"), "%+v", tstCase)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+)
+
+const defaultJSONFormatMaxSize = 1 << 20
+
+// getJSONFormatMode returns the JSON format of the request, the header
+// overriding the configured mode.
+func getJSONFormatMode(header http.Header,
+	cfg *corev1.Service_Spec_Config_HTTP_JSONFormat) corev1.Service_Spec_Config_HTTP_JSONFormat_Mode {
+	if cfg == nil {
+		return corev1.Service_Spec_Config_HTTP_JSONFormat_MODE_UNSET
+	}
+
+	if cfg.Header != "" && header != nil {
+		switch strings.ToLower(strings.TrimSpace(header.Get(cfg.Header))) {
+		case "minify":
+			return corev1.Service_Spec_Config_HTTP_JSONFormat_MINIFY
+		case "pretty":
+			return corev1.Service_Spec_Config_HTTP_JSONFormat_PRETTY
+		}
+	}
+
+	return cfg.Mode
+}
+
+// formatJSONResponse minifies or pretty-prints the JSON response body. Bodies
+// larger than the max size or of unknown length as well as invalid JSON
+// bodies are left intact.
+func formatJSONResponse(r *http.Response, cfg *corev1.Service_Spec_Config_HTTP_JSONFormat) error {
+	if r.Request == nil || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	mode := getJSONFormatMode(r.Request.Header, cfg)
+	if mode == corev1.Service_Spec_Config_HTTP_JSONFormat_MODE_UNSET {
+		return nil
+	}
+
+	if r.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	switch r.StatusCode {
+	case http.StatusNoContent, http.StatusNotModified:
+		return nil
+	}
+
+	if enc := r.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil
+	}
+
+	if !isJSONMediaType(httputils.GetMediaType(&http.Request{
+		Header:        r.Header,
+		ContentLength: r.ContentLength,
+	})) {
+		return nil
+	}
+
+	maxSize := int64(defaultJSONFormatMaxSize)
+	if cfg.MaxSize > 0 {
+		maxSize = int64(cfg.MaxSize)
+	}
+
+	// Bodies of unknown length are not buffered since they might be
+	// streamed by the upstream.
+	if r.ContentLength < 0 || r.ContentLength > maxSize {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch mode {
+	case corev1.Service_Spec_Config_HTTP_JSONFormat_MINIFY:
+		err = json.Compact(&buf, body)
+	default:
+		err = json.Indent(&buf, body, "", "  ")
+	}
+	if err != nil {
+		httputils.SetResponseBody(r, body)
+		return nil
+	}
+
+	httputils.SetResponseBody(r, buf.Bytes())
+	if etag := r.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		// The representation is no longer byte-for-byte identical.
+		r.Header.Set("ETag", "W/"+etag)
+	}
+
+	return nil
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
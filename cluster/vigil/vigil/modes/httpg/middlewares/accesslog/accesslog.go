@@ -75,13 +75,15 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	var respHeaders map[string]string
 
 	if visibilityCfg != nil {
-		if len(reqCtx.Body) <= maxBodyLen {
+		if len(reqCtx.Body) <= maxBodyLen &&
+			(visibilityCfg.EnableRequestBody || visibilityCfg.EnableRequestBodyMap) {
+			body := RedactBody(reqCtx.Body, visibilityCfg.RedactRequestBodyFields)
 			if visibilityCfg.EnableRequestBody {
-				reqBody = reqCtx.Body
+				reqBody = body
 			}
-			if visibilityCfg.EnableRequestBodyMap {
+			if visibilityCfg.EnableRequestBodyMap && len(body) > 0 {
 				ret := &structpb.Struct{}
-				if err := pbutils.UnmarshalJSON(reqCtx.Body, ret); err != nil {
+				if err := pbutils.UnmarshalJSON(body, ret); err != nil {
 					zap.L().Debug("Could not unmarshalJSON reqBody", zap.Error(err))
 				} else {
 					reqBodyMap = ret
@@ -89,13 +91,15 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			}
 		}
 
-		if crw.body.Len() <= maxBodyLen {
+		if crw.body.Len() <= maxBodyLen &&
+			(visibilityCfg.EnableResponseBody || visibilityCfg.EnableResponseBodyMap) {
+			body := RedactBody(getDecodedBody(crw), visibilityCfg.RedactResponseBodyFields)
 			if visibilityCfg.EnableResponseBody {
-				respBody = crw.body.Bytes()
+				respBody = body
 			}
-			if visibilityCfg.EnableResponseBodyMap && crw.body.Len() > 0 {
+			if visibilityCfg.EnableResponseBodyMap && len(body) > 0 {
 				ret := &structpb.Struct{}
-				if err := pbutils.UnmarshalJSON(crw.body.Bytes(), ret); err != nil {
+				if err := pbutils.UnmarshalJSON(body, ret); err != nil {
 					zap.L().Debug("Could not unmarshalJSON respBody", zap.Error(err))
 				} else {
 					respBodyMap = ret
@@ -108,6 +112,7 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	opts := &logentry.InitializeLogEntryOpts{
+		ID:              reqCtx.ID,
 		StartTime:       reqCtx.CreatedAt,
 		IsAuthenticated: reqCtx.IsAuthenticated,
 		IsAuthorized:    reqCtx.IsAuthorized || httputils.IsAnonymousMode(req),
@@ -213,9 +218,43 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	if tunnel := reqCtx.Tunnel; tunnel != nil {
+		httpC.Request.BodyBytes = tunnel.ReceivedBytes
+		httpC.Response.BodyBytes = tunnel.SentBytes
+	}
+
 	otelutils.EmitAccessLog(logE)
 }
 
+// getDecodedBody returns the response body decoded according to its
+// Content-Encoding so that it is logged and redacted as plaintext.
+func getDecodedBody(crw *responseWriter) []byte {
+	enc := httputils.GetContentEncoding(crw.Header())
+	if enc == "" {
+		return crw.body.Bytes()
+	}
+
+	ret, err := httputils.DecodeBody(crw.body.Bytes(), enc, maxBodyLen)
+	if err != nil {
+		zap.L().Debug("Could not decode response body. Omitting it", zap.Error(err))
+		return nil
+	}
+
+	return ret
+}
+
+// RedactBody returns the body with the values of the given JSON field paths
+// redacted. It returns nil if the body cannot be redacted.
+func RedactBody(body []byte, paths []string) []byte {
+	ret, err := redactJSON(body, paths)
+	if err != nil {
+		zap.L().Debug("Could not redact body. Omitting it", zap.Error(err))
+		return nil
+	}
+
+	return ret
+}
+
 func getRequestHeaderMap(req *http.Request, cfg *corev1.Service_Spec_Config_HTTP_Visibility) map[string]string {
 	if cfg == nil {
 		return nil
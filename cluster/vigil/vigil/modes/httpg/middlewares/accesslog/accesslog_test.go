@@ -166,3 +166,48 @@ func TestMiddleware(t *testing.T) {
 	}
 
 }
+
+func TestRedactJSON(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		body := []byte(`{"user":{"name":"john","password":"secret"},"token":"abc"}`)
+		res, err := redactJSON(body, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, body, res)
+	}
+
+	{
+		res, err := redactJSON([]byte(`{"user":{"name":"john","password":"secret"},"token":"abc"}`),
+			[]string{"user.password", "$.token", "unknown.field"})
+		assert.Nil(t, err)
+		assert.JSONEq(t,
+			`{"user":{"name":"john","password":"[REDACTED]"},"token":"[REDACTED]"}`, string(res))
+	}
+
+	{
+		res, err := redactJSON([]byte(`{"items":[{"key":"k1","secret":"s1"},{"key":"k2","secret":"s2"}]}`),
+			[]string{"items.secret"})
+		assert.Nil(t, err)
+		assert.JSONEq(t,
+			`{"items":[{"key":"k1","secret":"[REDACTED]"},{"key":"k2","secret":"[REDACTED]"}]}`, string(res))
+	}
+
+	{
+		res, err := redactJSON([]byte(`{"a":{"password":"p1"},"b":{"password":"p2","name":"n"}}`),
+			[]string{"*.password"})
+		assert.Nil(t, err)
+		assert.JSONEq(t,
+			`{"a":{"password":"[REDACTED]"},"b":{"password":"[REDACTED]","name":"n"}}`, string(res))
+	}
+
+	{
+		_, err := redactJSON([]byte(`not json`), []string{"password"})
+		assert.NotNil(t, err)
+	}
+}
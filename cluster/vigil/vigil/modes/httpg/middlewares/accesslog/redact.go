@@ -0,0 +1,74 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package accesslog
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const redactedValue = "[REDACTED]"
+
+// redactJSON replaces the values of the given dot-separated field paths
+// with a redacted placeholder. Arrays are traversed transparently and "*"
+// matches any object key.
+func redactJSON(body []byte, paths []string) ([]byte, error) {
+	if len(paths) == 0 || len(body) == 0 {
+		return body, nil
+	}
+
+	var obj any
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return nil, errors.Errorf("Could not unmarshal JSON body for redaction: %+v", err)
+	}
+
+	for _, pth := range paths {
+		if pth = strings.TrimPrefix(strings.TrimSpace(pth), "$."); pth == "" {
+			continue
+		}
+		redactPath(obj, strings.Split(pth, "."))
+	}
+
+	return json.Marshal(obj)
+}
+
+func redactPath(obj any, parts []string) {
+	if len(parts) == 0 {
+		return
+	}
+
+	switch val := obj.(type) {
+	case map[string]any:
+		for k, v := range val {
+			if parts[0] != "*" && parts[0] != k {
+				continue
+			}
+
+			if len(parts) == 1 {
+				val[k] = redactedValue
+			} else {
+				redactPath(v, parts[1:])
+			}
+		}
+	case []any:
+		for _, v := range val {
+			redactPath(v, parts)
+		}
+	}
+}
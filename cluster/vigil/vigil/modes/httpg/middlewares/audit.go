@@ -0,0 +1,113 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"github.com/octelium/octelium/apis/main/corev1"
+	"go.uber.org/zap"
+)
+
+type AuthInjectionType string
+
+const (
+	AuthInjectionBearer                  AuthInjectionType = "bearer"
+	AuthInjectionBasic                   AuthInjectionType = "basic"
+	AuthInjectionCustom                  AuthInjectionType = "custom"
+	AuthInjectionOAuth2ClientCredentials AuthInjectionType = "oauth2ClientCredentials"
+	AuthInjectionSigv4                   AuthInjectionType = "sigv4"
+	AuthInjectionHMAC                    AuthInjectionType = "hmac"
+	AuthInjectionNTLM                    AuthInjectionType = "ntlm"
+	AuthInjectionKubernetes              AuthInjectionType = "kubernetes"
+)
+
+type AuthInjectionEvent struct {
+	Type       AuthInjectionType
+	SecretName string
+	Secret     *corev1.Secret
+	Err        error
+}
+
+// LogAuthInjection emits a structured audit log entry, separate from the
+// access logs, that records the usage of a Secret to inject upstream
+// credentials. Failures are logged at the Warn level while successes, which
+// are as frequent as the requests themselves, are only logged at the Debug
+// level. The Secret value itself is never logged.
+func LogAuthInjection(reqCtx *RequestContext, evt *AuthInjectionEvent) {
+	fields := []zap.Field{
+		zap.String("auditType", "authInjection"),
+		zap.String("authType", string(evt.Type)),
+		zap.String("secretName", evt.SecretName),
+		zap.Bool("success", evt.Err == nil),
+	}
+
+	if evt.Secret != nil && evt.Secret.Metadata != nil {
+		fields = append(fields,
+			zap.String("secretUID", evt.Secret.Metadata.Uid),
+			zap.String("secretResourceVersion", evt.Secret.Metadata.ResourceVersion))
+	}
+
+	fields = append(fields, getAuditRequestFields(reqCtx)...)
+
+	logger := zap.L().Named("audit")
+	if evt.Err != nil {
+		logger.Warn("Could not inject upstream credentials", append(fields, zap.Error(evt.Err))...)
+		return
+	}
+
+	logger.Debug("Injected upstream credentials", fields...)
+}
+
+// LogPinnedFingerprintMismatch emits a structured audit log entry that
+// records an upstream connection rejected since the upstream's certificate
+// does not match the pinned fingerprints.
+func LogPinnedFingerprintMismatch(reqCtx *RequestContext, upstream string) {
+	fields := []zap.Field{
+		zap.String("auditType", "pinnedFingerprintMismatch"),
+		zap.String("upstream", upstream),
+	}
+
+	fields = append(fields, getAuditRequestFields(reqCtx)...)
+
+	zap.L().Named("audit").Warn("Rejected upstream connection due to certificate fingerprint mismatch", fields...)
+}
+
+func getAuditRequestFields(reqCtx *RequestContext) []zap.Field {
+	if reqCtx == nil {
+		return nil
+	}
+
+	var ret []zap.Field
+
+	if svc := reqCtx.Service; svc != nil && svc.Metadata != nil {
+		ret = append(ret,
+			zap.String("serviceName", svc.Metadata.Name),
+			zap.String("serviceUID", svc.Metadata.Uid))
+	}
+
+	if info := reqCtx.DownstreamInfo; info != nil {
+		if info.Session != nil && info.Session.Metadata != nil {
+			ret = append(ret, zap.String("sessionUID", info.Session.Metadata.Uid))
+		}
+		if info.User != nil && info.User.Metadata != nil {
+			ret = append(ret,
+				zap.String("userName", info.User.Metadata.Name),
+				zap.String("userUID", info.User.Metadata.Uid))
+		}
+	}
+
+	return ret
+}
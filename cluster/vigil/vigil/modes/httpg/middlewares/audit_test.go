@@ -0,0 +1,143 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogAuthInjection(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	undo := zap.ReplaceGlobals(zap.New(core))
+	t.Cleanup(undo)
+
+	secretValue := "s3cr3t-value"
+
+	reqCtx := &RequestContext{
+		Service: &corev1.Service{
+			Metadata: &metav1.Metadata{
+				Name: "svc1.default",
+				Uid:  "svc-uid",
+			},
+		},
+		DownstreamInfo: &corev1.RequestContext{
+			Session: &corev1.Session{
+				Metadata: &metav1.Metadata{
+					Uid: "sess-uid",
+				},
+			},
+			User: &corev1.User{
+				Metadata: &metav1.Metadata{
+					Name: "usr1",
+					Uid:  "usr-uid",
+				},
+			},
+		},
+	}
+
+	sec := &corev1.Secret{
+		Metadata: &metav1.Metadata{
+			Name:            "sec1",
+			Uid:             "sec-uid",
+			ResourceVersion: "rv1",
+		},
+		Data: &corev1.Secret_Data{
+			Type: &corev1.Secret_Data_Value{
+				Value: secretValue,
+			},
+		},
+	}
+
+	assertNoSecret := func(entry observer.LoggedEntry) {
+		buf, err := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()).
+			EncodeEntry(entry.Entry, entry.Context)
+		assert.Nil(t, err)
+		assert.NotContains(t, buf.String(), secretValue)
+	}
+
+	{
+		LogAuthInjection(reqCtx, &AuthInjectionEvent{
+			Type:       AuthInjectionBearer,
+			SecretName: "sec1",
+			Secret:     sec,
+		})
+
+		entries := logs.TakeAll()
+		assert.Equal(t, 1, len(entries))
+		entry := entries[0]
+		assert.Equal(t, zap.DebugLevel, entry.Level)
+		assert.Equal(t, "audit", entry.LoggerName)
+
+		fields := entry.ContextMap()
+		assert.Equal(t, "authInjection", fields["auditType"])
+		assert.Equal(t, "bearer", fields["authType"])
+		assert.Equal(t, "sec1", fields["secretName"])
+		assert.Equal(t, true, fields["success"])
+		assert.Equal(t, "sec-uid", fields["secretUID"])
+		assert.Equal(t, "rv1", fields["secretResourceVersion"])
+		assert.Equal(t, "svc1.default", fields["serviceName"])
+		assert.Equal(t, "svc-uid", fields["serviceUID"])
+		assert.Equal(t, "sess-uid", fields["sessionUID"])
+		assert.Equal(t, "usr1", fields["userName"])
+		assert.Equal(t, "usr-uid", fields["userUID"])
+		assert.Nil(t, fields["error"])
+		assertNoSecret(entry)
+	}
+
+	{
+		LogAuthInjection(reqCtx, &AuthInjectionEvent{
+			Type:       AuthInjectionBasic,
+			SecretName: "sec1",
+			Secret:     sec,
+			Err:        errors.Errorf("invalid credentials"),
+		})
+
+		entries := logs.TakeAll()
+		assert.Equal(t, 1, len(entries))
+		entry := entries[0]
+		assert.Equal(t, zap.WarnLevel, entry.Level)
+
+		fields := entry.ContextMap()
+		assert.Equal(t, "basic", fields["authType"])
+		assert.Equal(t, false, fields["success"])
+		assert.Equal(t, "invalid credentials", fields["error"])
+		assertNoSecret(entry)
+	}
+
+	{
+		LogAuthInjection(nil, &AuthInjectionEvent{
+			Type:       AuthInjectionHMAC,
+			SecretName: "sec2",
+			Err:        errors.Errorf("secret not found"),
+		})
+
+		entries := logs.TakeAll()
+		assert.Equal(t, 1, len(entries))
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "sec2", fields["secretName"])
+		assert.Nil(t, fields["secretUID"])
+		assert.Nil(t, fields["serviceName"])
+	}
+}
@@ -20,7 +20,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/octelium/octelium/apis/cluster/cvigilv1"
@@ -32,6 +38,7 @@ import (
 	"github.com/octelium/octelium/cluster/common/vutils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/commonplugin"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
 	"github.com/octelium/octelium/pkg/common/pbutils"
 	"github.com/octelium/octelium/pkg/grpcerr"
 	"go.uber.org/zap"
@@ -43,12 +50,22 @@ type middleware struct {
 	celEngine *celengine.CELEngine
 	octeliumC octeliumc.ClientInterface
 	svcUID    string
+	diskStore *DiskStore
+
+	revalidating sync.Map
 }
 
+const (
+	defaultDiskThreshold    = 1 << 20
+	defaultDiskMaxTotalSize = 1 << 30
+	defaultDiskMaxEntrySize = 128 << 20
+)
+
 func New(ctx context.Context,
 	next http.Handler, celEngine *celengine.CELEngine,
 	octeliumC octeliumc.ClientInterface,
 	svcUID string,
+	diskStore *DiskStore,
 	phase corev1.Service_Spec_Config_HTTP_Plugin_Phase) (http.Handler, error) {
 	return &middleware{
 		next:      next,
@@ -56,6 +73,7 @@ func New(ctx context.Context,
 		celEngine: celEngine,
 		octeliumC: octeliumC,
 		svcUID:    svcUID,
+		diskStore: diskStore,
 	}, nil
 }
 
@@ -84,6 +102,10 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 			cacheC := plugin.GetCache()
 
+			if m.handlePurge(rw, req, cacheC) {
+				return
+			}
+
 			if !cacheC.AllowUnsafeMethods {
 				switch req.Method {
 				case http.MethodGet, http.MethodHead:
@@ -92,11 +114,27 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 				}
 			}
 
-			key := m.getKey(ctx, cacheC, reqCtx, req)
+			rule := getRule(cacheC, req.URL.Path)
+			if rule != nil && rule.IsBypass {
+				continue
+			}
+
+			origReq := req
+			isHead := cacheC.HeadFromGET && req.Method == http.MethodHead
+			if isHead {
+				req = getHeadUpstreamRequest(req)
+			}
+
+			key := m.getKey(ctx, cacheC, rule, reqCtx, req)
 			if len(key) == 0 {
+				req = origReq
 				continue
 			}
 
+			if m.serveFromDisk(rw, origReq, cacheC, key, isHead) {
+				return
+			}
+
 			resp, err := m.octeliumC.CacheC().GetCache(ctx, &rcachev1.GetCacheRequest{
 				Key: key,
 			})
@@ -105,30 +143,72 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 				continue
 			}
 
+			var stale *cvigilv1.CacheHTTP
 			if err == nil {
 				res := &cvigilv1.CacheHTTP{}
 				if err := pbutils.Unmarshal(resp.Data, res); err != nil {
 					continue
 				}
 
-				rwHdr := rw.Header()
-				for _, hdr := range res.Headers {
-					rwHdr[hdr.Key] = hdr.Values
+				if !m.isSurrogateStale(ctx, res.SurrogateKeys) {
+					state := entryFresh
+					if isStaleEnabled(cacheC) {
+						state = getEntryState(res, time.Now())
+					}
+
+					switch state {
+					case entryFresh:
+						writeEntry(rw, origReq, cacheC, res, isHead, "HIT")
+						return
+					case entryStaleWhileRevalidate:
+						writeEntry(rw, origReq, cacheC, res, isHead, "STALE")
+						m.revalidate(req, key, cacheC, rule)
+						return
+					case entryStaleIfError:
+						stale = res
+					}
 				}
+			}
 
-				if cacheC.UseXCacheHeader {
-					rwHdr.Set("X-Cache", "HIT")
-				}
+			var sew *staleErrorWriter
+			var w http.ResponseWriter = rw
+			if stale != nil {
+				sew = newStaleErrorWriter(rw)
+				w = sew
+			}
+
+			var hw *headWriter
+			crw := newResponseWriter(w)
+			if isHead {
+				hw = newHeadWriter(w, origReq)
+				crw = newResponseWriter(hw)
+			}
+			if diskC := cacheC.Disk; diskC != nil && diskC.IsEnabled && m.diskStore != nil {
+				crw.setDiskStore(m.diskStore,
+					getOrDefault(diskC.Threshold, defaultDiskThreshold),
+					getOrDefault(diskC.MaxEntrySize, defaultDiskMaxEntrySize))
+			}
+			if skC := cacheC.SurrogateKey; skC != nil && skC.IsEnabled {
+				crw.setSurrogateKeyHeader(getSurrogateKeyHeader(skC), !skC.KeepHeader)
+			}
+			m.next.ServeHTTP(crw, req)
 
-				rw.WriteHeader(int(res.Code))
-				rw.Write(res.Body)
+			if hw != nil {
+				hw.finish()
+			}
+
+			if sew != nil && sew.isFailed {
+				crw.discard()
+				writeEntry(rw, origReq, cacheC, stale, isHead, "STALE")
 				return
 			}
 
-			crw := newResponseWriter(rw)
-			m.next.ServeHTTP(crw, req)
+			if reqCtx.IsClientDisconnected() {
+				crw.discard()
+				return
+			}
 
-			go m.doCache(crw, key, cacheC)
+			go m.doCache(crw, key, cacheC, rule)
 			return
 		default:
 			continue
@@ -138,21 +218,198 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	m.next.ServeHTTP(rw, req)
 }
 
+func writeEntry(rw http.ResponseWriter, req *http.Request,
+	cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache, res *cvigilv1.CacheHTTP,
+	isHead bool, xCache string) {
+	rwHdr := rw.Header()
+	for _, hdr := range res.Headers {
+		rwHdr[hdr.Key] = hdr.Values
+	}
+
+	if cacheC.UseXCacheHeader {
+		rwHdr.Set("X-Cache", xCache)
+	}
+
+	if isHead {
+		writeHeadResponse(rw, req, int(res.Code), int64(len(res.Body)))
+		return
+	}
+
+	rw.WriteHeader(int(res.Code))
+	rw.Write(res.Body)
+}
+
+// serveFromDisk serves the response if it is found in the on-disk store. The
+// body is streamed from its file instead of being loaded into memory.
+func (m *middleware) serveFromDisk(rw http.ResponseWriter, req *http.Request,
+	cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache, key []byte, isHead bool) bool {
+	if cacheC.Disk == nil || !cacheC.Disk.IsEnabled || m.diskStore == nil {
+		return false
+	}
+
+	e, f, ok := m.diskStore.get(string(key))
+	if !ok {
+		return false
+	}
+	defer f.Close()
+
+	if m.isSurrogateStale(req.Context(), e.surrogateKeys) {
+		return false
+	}
+
+	rwHdr := rw.Header()
+	for k, v := range e.header {
+		rwHdr[k] = v
+	}
+
+	if cacheC.UseXCacheHeader {
+		rwHdr.Set("X-Cache", "HIT")
+	}
+
+	if isHead {
+		writeHeadResponse(rw, req, e.code, e.size)
+		return true
+	}
+
+	rw.WriteHeader(e.code)
+	if _, err := io.Copy(rw, f); err != nil {
+		zap.L().Debug("Could not copy disk cache entry", zap.Error(err))
+	}
+
+	return true
+}
+
+// getHeadUpstreamRequest returns the GET request that is sent to the upstream
+// on behalf of a HEAD request. The conditional headers are removed so that the
+// upstream returns a full, cacheable response, they are instead evaluated
+// locally by writeHeadResponse.
+func getHeadUpstreamRequest(req *http.Request) *http.Request {
+	ret := req.Clone(req.Context())
+	ret.Method = http.MethodGet
+	ret.Header.Del("If-None-Match")
+	ret.Header.Del("If-Modified-Since")
+	return ret
+}
+
+// writeHeadResponse writes the headers of a HEAD response synthesized from a
+// GET response whose body size is known.
+func writeHeadResponse(rw http.ResponseWriter, req *http.Request, code int, size int64) {
+	hdr := rw.Header()
+	if hdr.Get("Content-Length") == "" && hdr.Get("Transfer-Encoding") == "" &&
+		bodyAllowedForStatus(code) {
+		hdr.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	if code == http.StatusOK && isNotModified(req, hdr) {
+		code = http.StatusNotModified
+	}
+
+	rw.WriteHeader(code)
+}
+
+func bodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code < 200:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+func isNotModified(req *http.Request, hdr http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(hdr.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+
+		for _, val := range strings.Split(inm, ",") {
+			val = strings.TrimSpace(val)
+			if val == "*" || strings.TrimPrefix(val, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := req.Header.Get("If-Modified-Since")
+	lastModified := hdr.Get("Last-Modified")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+
+	imsTime, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	lastModifiedTime, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+
+	return !lastModifiedTime.After(imsTime)
+}
+
+func getOrDefault(val uint64, def int64) int64 {
+	if val == 0 {
+		return def
+	}
+	return int64(val)
+}
+
+func getRule(cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache,
+	pth string) *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Rule {
+	var ret *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Rule
+	for _, rule := range cacheC.Rules {
+		if !isUnderPathPrefix(pth, rule.PathPrefix) {
+			continue
+		}
+		if ret == nil || len(rule.PathPrefix) > len(ret.PathPrefix) {
+			ret = rule
+		}
+	}
+
+	return ret
+}
+
+// isUnderPathPrefix reports whether the path is the prefix itself or is under
+// it on a path segment boundary, i.e. "/api" matches "/api" and "/api/v1" but
+// not "/apis".
+func isUnderPathPrefix(pth, prefix string) bool {
+	if !strings.HasPrefix(pth, prefix) {
+		return false
+	}
+
+	return len(pth) == len(prefix) || strings.HasSuffix(prefix, "/") || pth[len(prefix)] == '/'
+}
+
 func (m *middleware) getKey(ctx context.Context,
 	cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache,
+	rule *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Rule,
 	reqCtx *middlewares.RequestContext, req *http.Request) []byte {
 
-	if cacheC.Key != nil {
-		switch cacheC.Key.Type.(type) {
+	keyC := cacheC.Key
+	if rule != nil && rule.Key != nil {
+		keyC = rule.Key
+	}
+
+	key := fmt.Sprintf("%s:%s", req.Method, req.URL.RequestURI())
+	if keyC != nil {
+		switch keyC.Type.(type) {
 		case *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Key_Eval:
-			if key, err := m.celEngine.EvalPolicyString(ctx,
-				cacheC.Key.GetEval(), reqCtx.ReqCtxMap); err == nil && key != "" {
-				return m.doGetKey(key)
+			if val, err := m.celEngine.EvalPolicyString(ctx,
+				keyC.GetEval(), reqCtx.ReqCtxMap); err == nil && val != "" {
+				key = val
 			}
 		}
 	}
 
-	return m.doGetKey(fmt.Sprintf("%s:%s", req.Method, req.URL.RequestURI()))
+	if rule != nil && rule.PurgeVersion != "" {
+		key = fmt.Sprintf("%s:%s", rule.PurgeVersion, key)
+	}
+
+	return m.doGetKey(key)
 }
 
 func (m *middleware) doGetKey(arg string) []byte {
@@ -160,7 +417,54 @@ func (m *middleware) doGetKey(arg string) []byte {
 	return vutils.Sha256Sum([]byte(fmt.Sprintf("%s:%s", m.svcUID, arg)))
 }
 
-func (m *middleware) doCache(rw *responseWriter, key []byte, cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache) {
+func (m *middleware) doCache(rw *responseWriter, key []byte,
+	cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache,
+	rule *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Rule) {
+	if rw.isOverflow {
+		return
+	}
+
+	duration := cacheC.Ttl
+	if rule != nil && rule.Ttl != nil {
+		duration = rule.Ttl
+	}
+
+	if cacheC.HonorCacheControl {
+		isCacheable, maxAge := parseCacheControl(rw.Header().Get("Cache-Control"),
+			rule != nil && rule.ForceCache)
+		if !isCacheable {
+			rw.discard()
+			return
+		}
+
+		if duration == nil && maxAge > 0 {
+			duration = &metav1.Duration{
+				Type: &metav1.Duration_Seconds{
+					Seconds: toSeconds(maxAge),
+				},
+			}
+		}
+	}
+
+	if duration == nil {
+		duration = &metav1.Duration{
+			Type: &metav1.Duration_Minutes{
+				Minutes: 10,
+			},
+		}
+	}
+
+	surrogateKeys, ok := m.getEntrySurrogateKeys(rw)
+	if !ok {
+		rw.discard()
+		return
+	}
+
+	if rw.file != nil {
+		m.doCacheDisk(rw, key, cacheC, duration, surrogateKeys)
+		return
+	}
+
 	maxBody := cacheC.MaxSize
 	if maxBody == 0 {
 		maxBody = 4_000_000
@@ -174,8 +478,26 @@ func (m *middleware) doCache(rw *responseWriter, key []byte, cacheC *corev1.Serv
 	defer cancel()
 
 	entry := &cvigilv1.CacheHTTP{
-		Code: int64(rw.statusCode),
-		Body: rw.body.Bytes(),
+		Code:          int64(rw.statusCode),
+		Body:          rw.body.Bytes(),
+		SurrogateKeys: surrogateKeys,
+	}
+
+	if isStaleEnabled(cacheC) {
+		fresh := umetav1.ToDuration(duration).ToGo()
+		swr, sie := getStaleWindows(cacheC.Stale, rw.Header())
+
+		entry.FreshUntil = time.Now().Add(fresh).UnixMilli()
+		entry.StaleWhileRevalidate = toSeconds(swr)
+		entry.StaleIfError = toSeconds(sie)
+
+		// The entry is kept beyond its freshness lifetime so that it can be
+		// served stale.
+		duration = &metav1.Duration{
+			Type: &metav1.Duration_Seconds{
+				Seconds: toSeconds(fresh + max(swr, sie) + time.Second - 1),
+			},
+		}
 	}
 
 	for k, v := range rw.Header() {
@@ -191,15 +513,6 @@ func (m *middleware) doCache(rw *responseWriter, key []byte, cacheC *corev1.Serv
 		return
 	}
 
-	duration := cacheC.Ttl
-	if duration == nil {
-		duration = &metav1.Duration{
-			Type: &metav1.Duration_Minutes{
-				Minutes: 10,
-			},
-		}
-	}
-
 	_, err = m.octeliumC.CacheC().SetCache(ctx, &rcachev1.SetCacheRequest{
 		Key:      key,
 		Data:     entryBytes,
@@ -210,10 +523,103 @@ func (m *middleware) doCache(rw *responseWriter, key []byte, cacheC *corev1.Serv
 	}
 }
 
+func (m *middleware) doCacheDisk(rw *responseWriter, key []byte,
+	cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache, duration *metav1.Duration,
+	surrogateKeys []*cvigilv1.CacheHTTP_SurrogateKey) {
+	pth := rw.file.Name()
+	if err := rw.file.Close(); err != nil {
+		zap.L().Warn("Could not close disk cache entry", zap.Error(err))
+		os.Remove(pth)
+		return
+	}
+
+	m.diskStore.set(&diskEntry{
+		key:       string(key),
+		path:      pth,
+		size:      rw.size,
+		code:      rw.statusCode,
+		header:    rw.Header().Clone(),
+		expiresAt: time.Now().Add(umetav1.ToDuration(duration).ToGo()),
+
+		surrogateKeys: surrogateKeys,
+	}, getOrDefault(cacheC.Disk.MaxTotalSize, defaultDiskMaxTotalSize))
+}
+
+func parseCacheControl(val string, forceCache bool) (bool, time.Duration) {
+	if strings.TrimSpace(val) == "" {
+		return forceCache, 0
+	}
+
+	var maxAge, sMaxAge time.Duration
+	hasMaxAge := false
+
+	for _, directive := range strings.Split(val, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		name, arg, _ := strings.Cut(directive, "=")
+
+		switch name {
+		case "no-store", "no-cache", "private":
+			return false, 0
+		case "max-age", "s-maxage":
+			val, ok := parseDeltaSeconds(arg)
+			if !ok {
+				return false, 0
+			}
+			hasMaxAge = true
+			if name == "s-maxage" {
+				sMaxAge = val
+			} else {
+				maxAge = val
+			}
+		}
+	}
+
+	if sMaxAge > 0 {
+		return true, sMaxAge
+	}
+
+	if hasMaxAge {
+		return true, maxAge
+	}
+
+	return true, 0
+}
+
+// maxDeltaSeconds is the value to which the larger delta-seconds of the
+// Cache-Control directives are capped as recommended by RFC 9111.
+const maxDeltaSeconds = 1 << 31
+
+func parseDeltaSeconds(arg string) (time.Duration, bool) {
+	secs, err := strconv.ParseInt(strings.Trim(arg, `"`), 10, 64)
+	if err != nil || secs <= 0 {
+		return 0, false
+	}
+
+	return time.Duration(min(secs, maxDeltaSeconds)) * time.Second, true
+}
+
+// toSeconds returns the whole seconds of the duration capped to the max
+// value of the uint32 seconds of the cached entries.
+func toSeconds(d time.Duration) uint32 {
+	return uint32(min(d/time.Second, math.MaxUint32))
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	body       *bytes.Buffer
+
+	diskStore    *DiskStore
+	threshold    int64
+	maxEntrySize int64
+	file         *os.File
+	size         int64
+	isOverflow   bool
+
+	wroteHeader     bool
+	surrogateHeader string
+	stripSurrogate  bool
+	surrogateKeys   []string
 }
 
 func newResponseWriter(w http.ResponseWriter) *responseWriter {
@@ -225,15 +631,144 @@ func newResponseWriter(w http.ResponseWriter) *responseWriter {
 }
 
 func (w *responseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.captureSurrogateKeys()
+	}
 	w.statusCode = statusCode
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
 func (w *responseWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.buffer(b)
 	return w.ResponseWriter.Write(b)
 }
 
+// setSurrogateKeyHeader makes the writer collect the surrogate keys listed by
+// the upstream in the header before the response headers are written.
+func (w *responseWriter) setSurrogateKeyHeader(header string, strip bool) {
+	w.surrogateHeader = header
+	w.stripSurrogate = strip
+}
+
+func (w *responseWriter) captureSurrogateKeys() {
+	if w.surrogateHeader == "" {
+		return
+	}
+
+	hdr := w.Header()
+	w.surrogateKeys = parseSurrogateKeys(strings.Join(hdr.Values(w.surrogateHeader), " "))
+	if w.stripSurrogate {
+		hdr.Del(w.surrogateHeader)
+	}
+}
+
+// setDiskStore makes the writer spill the body to a file in the on-disk store
+// once it grows beyond the threshold.
+func (w *responseWriter) setDiskStore(store *DiskStore, threshold, maxEntrySize int64) {
+	w.diskStore = store
+	w.threshold = threshold
+	w.maxEntrySize = maxEntrySize
+}
+
+func (w *responseWriter) buffer(b []byte) {
+	if w.isOverflow {
+		return
+	}
+
+	w.size += int64(len(b))
+
+	if w.diskStore == nil {
+		w.body.Write(b)
+		return
+	}
+
+	if w.size > w.maxEntrySize {
+		w.discard()
+		w.isOverflow = true
+		return
+	}
+
+	if w.file == nil && w.size > w.threshold {
+		f, err := w.diskStore.createTemp()
+		if err != nil {
+			zap.L().Warn("Could not create disk cache entry", zap.Error(err))
+			w.discard()
+			w.isOverflow = true
+			return
+		}
+		w.file = f
+
+		if _, err := f.Write(w.body.Bytes()); err != nil {
+			w.discard()
+			w.isOverflow = true
+			return
+		}
+		w.body.Reset()
+	}
+
+	if w.file != nil {
+		if _, err := w.file.Write(b); err != nil {
+			w.discard()
+			w.isOverflow = true
+		}
+		return
+	}
+
+	w.body.Write(b)
+}
+
+// discard releases the buffered body including its spilled file, if any.
+func (w *responseWriter) discard() {
+	w.body.Reset()
+	if w.file != nil {
+		w.file.Close()
+		os.Remove(w.file.Name())
+		w.file = nil
+	}
+}
+
+// headWriter turns the upstream response of a GET request into a HEAD
+// response. The body is discarded and only its size is kept so that the
+// Content-Length header can be set once the whole response is received.
+type headWriter struct {
+	http.ResponseWriter
+	req        *http.Request
+	statusCode int
+	size       int64
+}
+
+func newHeadWriter(w http.ResponseWriter, req *http.Request) *headWriter {
+	return &headWriter{
+		ResponseWriter: w,
+		req:            req,
+	}
+}
+
+func (w *headWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.size += int64(len(b))
+	return len(b), nil
+}
+
+func (w *headWriter) finish() {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	writeHeadResponse(w.ResponseWriter, w.req, w.statusCode, w.size)
+}
+
 /*
 func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hj, ok := w.ResponseWriter.(http.Hijacker)
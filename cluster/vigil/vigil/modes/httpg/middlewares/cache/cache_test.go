@@ -18,9 +18,12 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -59,7 +62,7 @@ func TestMiddleware(t *testing.T) {
 	assert.Nil(t, err)
 
 	mdlwr, err := New(ctx, next, celEngine, tst.C.OcteliumC,
-		vutils.UUIDv4(), corev1.Service_Spec_Config_HTTP_Plugin_POST_AUTH)
+		vutils.UUIDv4(), NewDiskStore(""), corev1.Service_Spec_Config_HTTP_Plugin_POST_AUTH)
 	assert.Nil(t, err)
 
 	adminSrv := admin.NewServer(&admin.Opts{
@@ -193,3 +196,332 @@ func TestMiddleware(t *testing.T) {
 	}
 
 }
+
+func TestGetRule(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	cacheC := &corev1.Service_Spec_Config_HTTP_Plugin_Cache{
+		Rules: []*corev1.Service_Spec_Config_HTTP_Plugin_Cache_Rule{
+			{
+				PathPrefix: "/static",
+				ForceCache: true,
+			},
+			{
+				PathPrefix: "/static/private",
+				IsBypass:   true,
+			},
+			{
+				PathPrefix: "/api",
+			},
+			{
+				PathPrefix: "/assets/",
+			},
+		},
+	}
+
+	assert.Nil(t, getRule(cacheC, "/"))
+	assert.Nil(t, getRule(cacheC, "/other/static"))
+	assert.Equal(t, cacheC.Rules[0], getRule(cacheC, "/static/img.png"))
+	assert.Equal(t, cacheC.Rules[1], getRule(cacheC, "/static/private/img.png"))
+	assert.Equal(t, cacheC.Rules[2], getRule(cacheC, "/api/v1"))
+	assert.Equal(t, cacheC.Rules[2], getRule(cacheC, "/api"))
+	assert.Equal(t, cacheC.Rules[3], getRule(cacheC, "/assets/img.png"))
+
+	// The prefixes only match on a path segment boundary.
+	assert.Nil(t, getRule(cacheC, "/apis"))
+	assert.Nil(t, getRule(cacheC, "/assets"))
+	assert.Equal(t, cacheC.Rules[0], getRule(cacheC, "/static/private-img.png"))
+}
+
+func TestParseCacheControl(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type tstCase struct {
+		val         string
+		forceCache  bool
+		isCacheable bool
+		maxAge      time.Duration
+	}
+
+	tstCases := []tstCase{
+		{
+			val: "",
+		},
+		{
+			val:         "",
+			forceCache:  true,
+			isCacheable: true,
+		},
+		{
+			val:         "public",
+			isCacheable: true,
+		},
+		{
+			val:         "public, max-age=60",
+			isCacheable: true,
+			maxAge:      60 * time.Second,
+		},
+		{
+			val:         "max-age=60, s-maxage=120",
+			isCacheable: true,
+			maxAge:      120 * time.Second,
+		},
+		{
+			val: "max-age=0",
+		},
+		{
+			val:        "no-store",
+			forceCache: true,
+		},
+		{
+			val: "private, max-age=60",
+		},
+		{
+			val: "No-Cache",
+		},
+		{
+			val:         "max-age=99999999999999999",
+			isCacheable: true,
+			maxAge:      maxDeltaSeconds * time.Second,
+		},
+	}
+
+	for _, tc := range tstCases {
+		isCacheable, maxAge := parseCacheControl(tc.val, tc.forceCache)
+		assert.Equal(t, tc.isCacheable, isCacheable, "%+v", tc)
+		assert.Equal(t, tc.maxAge, maxAge, "%+v", tc)
+	}
+}
+
+func TestToSeconds(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	assert.Equal(t, uint32(0), toSeconds(0))
+	assert.Equal(t, uint32(60), toSeconds(60*time.Second+time.Millisecond))
+	assert.Equal(t, uint32(math.MaxUint32), toSeconds(maxDeltaSeconds*3*time.Second))
+}
+
+func TestHeadFromGET(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "http://localhost/prefix/v1", nil)
+		req.Header.Set("If-None-Match", `"abc"`)
+		req.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+
+		upstreamReq := getHeadUpstreamRequest(req)
+		assert.Equal(t, http.MethodGet, upstreamReq.Method)
+		assert.Equal(t, "", upstreamReq.Header.Get("If-None-Match"))
+		assert.Equal(t, "", upstreamReq.Header.Get("If-Modified-Since"))
+		assert.Equal(t, http.MethodHead, req.Method)
+		assert.Equal(t, `"abc"`, req.Header.Get("If-None-Match"))
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "http://localhost/prefix/v1", nil)
+		rw := httptest.NewRecorder()
+		hw := newHeadWriter(rw, req)
+
+		hw.Header().Set("Content-Type", "text/plain")
+		hw.Write([]byte("hello "))
+		hw.Write([]byte("world"))
+
+		assert.False(t, rw.Flushed)
+		hw.finish()
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "11", rw.Header().Get("Content-Length"))
+		assert.Equal(t, 0, rw.Body.Len())
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "http://localhost/prefix/v1", nil)
+		rw := httptest.NewRecorder()
+		rw.Header().Set("Content-Length", "100")
+
+		writeHeadResponse(rw, req, http.StatusOK, 10)
+		assert.Equal(t, "100", rw.Header().Get("Content-Length"))
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "http://localhost/prefix/v1", nil)
+		rw := httptest.NewRecorder()
+
+		writeHeadResponse(rw, req, http.StatusNoContent, 0)
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+		assert.Equal(t, "", rw.Header().Get("Content-Length"))
+	}
+
+	{
+		type tstCase struct {
+			ifNoneMatch string
+			etag        string
+			expected    int
+		}
+
+		cases := []tstCase{
+			{ifNoneMatch: `"abc"`, etag: `"abc"`, expected: http.StatusNotModified},
+			{ifNoneMatch: `W/"abc"`, etag: `"abc"`, expected: http.StatusNotModified},
+			{ifNoneMatch: `"xyz", "abc"`, etag: `W/"abc"`, expected: http.StatusNotModified},
+			{ifNoneMatch: `*`, etag: `"abc"`, expected: http.StatusNotModified},
+			{ifNoneMatch: `"xyz"`, etag: `"abc"`, expected: http.StatusOK},
+			{ifNoneMatch: `"abc"`, expected: http.StatusOK},
+			{etag: `"abc"`, expected: http.StatusOK},
+		}
+
+		for _, tstCase := range cases {
+			req := httptest.NewRequest(http.MethodHead, "http://localhost/prefix/v1", nil)
+			if tstCase.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tstCase.ifNoneMatch)
+			}
+			rw := httptest.NewRecorder()
+			if tstCase.etag != "" {
+				rw.Header().Set("ETag", tstCase.etag)
+			}
+
+			writeHeadResponse(rw, req, http.StatusOK, 10)
+			assert.Equal(t, tstCase.expected, rw.Code, "%+v", tstCase)
+		}
+	}
+
+	{
+		lastModified := time.Now().Add(-1 * time.Hour).UTC()
+
+		req := httptest.NewRequest(http.MethodHead, "http://localhost/prefix/v1", nil)
+		req.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+		rw := httptest.NewRecorder()
+		rw.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		writeHeadResponse(rw, req, http.StatusOK, 10)
+		assert.Equal(t, http.StatusNotModified, rw.Code)
+
+		req = httptest.NewRequest(http.MethodHead, "http://localhost/prefix/v1", nil)
+		req.Header.Set("If-Modified-Since", lastModified.Add(-1*time.Hour).Format(http.TimeFormat))
+		rw = httptest.NewRecorder()
+		rw.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		writeHeadResponse(rw, req, http.StatusOK, 10)
+		assert.Equal(t, http.StatusOK, rw.Code)
+	}
+}
+
+func TestClientDisconnect(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var count atomic.Int32
+	var disconnect context.CancelFunc
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Disconnect") != "" {
+			disconnect()
+		}
+		w.Write([]byte(fmt.Sprintf("v%d", count.Add(1))))
+	})
+
+	celEngine, err := celengine.New(ctx, &celengine.Opts{})
+	assert.Nil(t, err)
+
+	mdlwr, err := New(ctx, next, celEngine, tst.C.OcteliumC,
+		vutils.UUIDv4(), NewDiskStore(""), corev1.Service_Spec_Config_HTTP_Plugin_POST_AUTH)
+	assert.Nil(t, err)
+
+	svcCfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				Plugins: []*corev1.Service_Spec_Config_HTTP_Plugin{
+					{
+						Condition: &corev1.Condition{
+							Type: &corev1.Condition_MatchAny{
+								MatchAny: true,
+							},
+						},
+
+						Type: &corev1.Service_Spec_Config_HTTP_Plugin_Cache_{
+							Cache: &corev1.Service_Spec_Config_HTTP_Plugin_Cache{
+								UseXCacheHeader: true,
+								Ttl: &metav1.Duration{
+									Type: &metav1.Duration_Seconds{
+										Seconds: 60,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	doRequest := func(isDisconnect bool) (string, string) {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil)
+		if isDisconnect {
+			req.Header.Set("X-Disconnect", "true")
+		}
+
+		clientCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		disconnect = cancel
+
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt:     time.Now(),
+				ServiceConfig: svcCfg,
+				ClientCtx:     clientCtx,
+			}))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		resp := rw.Result()
+		defer resp.Body.Close()
+
+		bb, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+
+		return string(bb), resp.Header.Get("X-Cache")
+	}
+
+	{
+		// The client goes away while the response is being served, the
+		// possibly truncated response must not be cached.
+		body, xCache := doRequest(true)
+		assert.Equal(t, "v1", body)
+		assert.Equal(t, "", xCache)
+
+		time.Sleep(500 * time.Millisecond)
+		body, xCache = doRequest(false)
+		assert.Equal(t, "v2", body)
+		assert.Equal(t, "", xCache)
+
+		time.Sleep(500 * time.Millisecond)
+		body, xCache = doRequest(false)
+		assert.Equal(t, "v2", body)
+		assert.Equal(t, "HIT", xCache)
+		assert.Equal(t, int32(2), count.Load())
+	}
+}
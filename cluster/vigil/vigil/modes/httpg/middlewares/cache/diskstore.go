@@ -0,0 +1,160 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/cluster/cvigilv1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DiskStore is a local on-disk store of cached responses whose bodies are too
+// large to be kept in memory. Entries are only valid within the process
+// lifetime and are evicted in a least-recently-used order once the total size
+// budget is exceeded.
+type DiskStore struct {
+	mu        sync.Mutex
+	parentDir string
+	dir       string
+	entries   map[string]*list.Element
+	lru       *list.List
+	totalSize int64
+}
+
+type diskEntry struct {
+	key       string
+	path      string
+	size      int64
+	code      int
+	header    http.Header
+	expiresAt time.Time
+
+	surrogateKeys []*cvigilv1.CacheHTTP_SurrogateKey
+}
+
+// NewDiskStore creates a store whose directory is lazily created inside the
+// parentDir, typically a dedicated volume since the root filesystem is
+// read-only. If parentDir is empty, the default temporary directory is used.
+func NewDiskStore(parentDir string) *DiskStore {
+	return &DiskStore{
+		parentDir: parentDir,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// createTemp creates a new file in the store directory to which a response
+// body is written before it is stored.
+func (s *DiskStore) createTemp() (*os.File, error) {
+	s.mu.Lock()
+	if s.dir == "" {
+		dir, err := os.MkdirTemp(s.parentDir, "octelium-vigil-cache-")
+		if err != nil {
+			s.mu.Unlock()
+			return nil, errors.Errorf("Could not create disk cache dir: %+v", err)
+		}
+		s.dir = dir
+	}
+	dir := s.dir
+	s.mu.Unlock()
+
+	return os.CreateTemp(dir, "entry-")
+}
+
+// get returns the entry of the key along with its opened body file. The file
+// remains readable even if the entry is concurrently evicted.
+func (s *DiskStore) get(key string) (*diskEntry, *os.File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+
+	e := elem.Value.(*diskEntry)
+	if time.Now().After(e.expiresAt) {
+		s.removeElem(elem)
+		return nil, nil, false
+	}
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		zap.L().Debug("Could not open disk cache entry", zap.Error(err))
+		s.removeElem(elem)
+		return nil, nil, false
+	}
+
+	s.lru.MoveToFront(elem)
+	return e, f, true
+}
+
+// set stores the entry whose body has already been written to its path and
+// evicts the least recently used entries until the total size is within the
+// budget.
+func (s *DiskStore) set(e *diskEntry, maxTotalSize int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.size > maxTotalSize {
+		os.Remove(e.path)
+		return
+	}
+
+	if elem, ok := s.entries[e.key]; ok {
+		s.removeElem(elem)
+	}
+
+	s.entries[e.key] = s.lru.PushFront(e)
+	s.totalSize += e.size
+
+	for s.totalSize > maxTotalSize {
+		s.removeElem(s.lru.Back())
+	}
+}
+
+func (s *DiskStore) removeElem(elem *list.Element) {
+	e := elem.Value.(*diskEntry)
+	s.lru.Remove(elem)
+	delete(s.entries, e.key)
+	s.totalSize -= e.size
+	if err := os.Remove(e.path); err != nil {
+		zap.L().Debug("Could not remove disk cache entry", zap.Error(err))
+	}
+}
+
+// Close removes all the entries along with the store directory.
+func (s *DiskStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = make(map[string]*list.Element)
+	s.lru.Init()
+	s.totalSize = 0
+
+	if s.dir == "" {
+		return nil
+	}
+
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/pkg/utils/utilrand"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskStore(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	parentDir := t.TempDir()
+	store := NewDiskStore(parentDir)
+	t.Cleanup(func() {
+		store.Close()
+	})
+
+	newEntry := func(key string, size int, ttl time.Duration) *diskEntry {
+		f, err := store.createTemp()
+		assert.Nil(t, err)
+		_, err = f.Write([]byte(strings.Repeat("a", size)))
+		assert.Nil(t, err)
+		assert.Nil(t, f.Close())
+
+		return &diskEntry{
+			key:       key,
+			path:      f.Name(),
+			size:      int64(size),
+			code:      http.StatusOK,
+			expiresAt: time.Now().Add(ttl),
+		}
+	}
+
+	e1 := newEntry("k1", 100, time.Hour)
+	store.set(e1, 250)
+	e2 := newEntry("k2", 100, time.Hour)
+	store.set(e2, 250)
+
+	_, f, ok := store.get("k1")
+	assert.True(t, ok)
+	f.Close()
+
+	// k2 is now the least recently used entry and is evicted.
+	store.set(newEntry("k3", 100, time.Hour), 250)
+	_, _, ok = store.get("k2")
+	assert.False(t, ok)
+	_, err = os.Stat(e2.path)
+	assert.True(t, os.IsNotExist(err))
+
+	_, f, ok = store.get("k1")
+	assert.True(t, ok)
+	f.Close()
+	assert.Equal(t, int64(200), store.totalSize)
+
+	store.set(newEntry("k4", 100, -time.Second), 250)
+	_, _, ok = store.get("k4")
+	assert.False(t, ok)
+
+	tooLarge := newEntry("k5", 300, time.Hour)
+	store.set(tooLarge, 250)
+	_, _, ok = store.get("k5")
+	assert.False(t, ok)
+	_, err = os.Stat(tooLarge.path)
+	assert.True(t, os.IsNotExist(err))
+
+	dir := store.dir
+	assert.Equal(t, parentDir, filepath.Dir(dir))
+	assert.Nil(t, store.Close())
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(parentDir)
+	assert.Nil(t, err)
+}
+
+func TestDiskCache(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	store := NewDiskStore("")
+	t.Cleanup(func() {
+		store.Close()
+	})
+
+	m := &middleware{
+		diskStore: store,
+	}
+
+	cacheC := &corev1.Service_Spec_Config_HTTP_Plugin_Cache{
+		UseXCacheHeader: true,
+		Ttl: &metav1.Duration{
+			Type: &metav1.Duration_Minutes{
+				Minutes: 1,
+			},
+		},
+		Disk: &corev1.Service_Spec_Config_HTTP_Plugin_Cache_Disk{
+			IsEnabled:    true,
+			Threshold:    1024,
+			MaxEntrySize: 8192,
+		},
+	}
+
+	key := []byte(utilrand.GetRandomString(32))
+	getReq := httptest.NewRequest(http.MethodGet, "http://localhost/prefix/v1", nil)
+	assert.False(t, m.serveFromDisk(httptest.NewRecorder(), getReq, cacheC, key, false))
+
+	{
+		body := utilrand.GetRandomString(4096)
+
+		crw := newResponseWriter(httptest.NewRecorder())
+		crw.setDiskStore(store, 1024, 8192)
+		crw.Header().Set("X-Custom", "val")
+		crw.WriteHeader(203)
+		for i := 0; i < 4; i++ {
+			crw.Write([]byte(body[i*1024 : (i+1)*1024]))
+		}
+
+		assert.NotNil(t, crw.file)
+		assert.Equal(t, 0, crw.body.Len())
+
+		m.doCache(crw, key, cacheC, nil)
+
+		rw := httptest.NewRecorder()
+		assert.True(t, m.serveFromDisk(rw, getReq, cacheC, key, false))
+		assert.Equal(t, 203, rw.Code)
+		assert.Equal(t, "val", rw.Header().Get("X-Custom"))
+		assert.Equal(t, "HIT", rw.Header().Get("X-Cache"))
+		assert.Equal(t, body, rw.Body.String())
+
+		headReq := httptest.NewRequest(http.MethodHead, "http://localhost/prefix/v1", nil)
+		rw = httptest.NewRecorder()
+		assert.True(t, m.serveFromDisk(rw, headReq, cacheC, key, true))
+		assert.Equal(t, 203, rw.Code)
+		assert.Equal(t, "4096", rw.Header().Get("Content-Length"))
+		assert.Equal(t, 0, rw.Body.Len())
+	}
+
+	{
+		crw := newResponseWriter(httptest.NewRecorder())
+		crw.setDiskStore(store, 1024, 8192)
+		crw.Write([]byte(utilrand.GetRandomString(512)))
+		assert.Nil(t, crw.file)
+		assert.Equal(t, 512, crw.body.Len())
+	}
+
+	{
+		crw := newResponseWriter(httptest.NewRecorder())
+		crw.setDiskStore(store, 1024, 8192)
+		crw.Write([]byte(utilrand.GetRandomString(4096)))
+		pth := crw.file.Name()
+		crw.Write([]byte(utilrand.GetRandomString(8192)))
+		assert.True(t, crw.isOverflow)
+		assert.Nil(t, crw.file)
+		_, err := os.Stat(pth)
+		assert.True(t, os.IsNotExist(err))
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/octelium/octelium/apis/cluster/cvigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+)
+
+type entryState int
+
+const (
+	entryFresh entryState = iota
+	entryStaleWhileRevalidate
+	entryStaleIfError
+	entryExpired
+)
+
+func isStaleEnabled(cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache) bool {
+	return cacheC.Stale != nil && cacheC.Stale.IsEnabled
+}
+
+// getEntryState returns the state of the entry according to its freshness
+// lifetime and the stale windows following it.
+func getEntryState(res *cvigilv1.CacheHTTP, now time.Time) entryState {
+	if res.FreshUntil == 0 {
+		return entryFresh
+	}
+
+	freshUntil := time.UnixMilli(res.FreshUntil)
+
+	switch {
+	case now.Before(freshUntil):
+		return entryFresh
+	case now.Before(freshUntil.Add(time.Duration(res.StaleWhileRevalidate) * time.Second)):
+		return entryStaleWhileRevalidate
+	case now.Before(freshUntil.Add(time.Duration(res.StaleIfError) * time.Second)):
+		return entryStaleIfError
+	default:
+		return entryExpired
+	}
+}
+
+// getStaleWindows returns the stale-while-revalidate and stale-if-error
+// windows of the response. The windows set by the Service override the
+// directives of the Cache-Control header.
+func getStaleWindows(staleC *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Stale,
+	hdr http.Header) (time.Duration, time.Duration) {
+	swr, sie := parseStaleDirectives(hdr.Get("Cache-Control"))
+
+	if val := umetav1.ToDuration(staleC.StaleWhileRevalidate).ToGo(); val > 0 {
+		swr = val
+	}
+	if val := umetav1.ToDuration(staleC.StaleIfError).ToGo(); val > 0 {
+		sie = val
+	}
+
+	return swr, sie
+}
+
+func parseStaleDirectives(val string) (time.Duration, time.Duration) {
+	var swr, sie time.Duration
+
+	for _, directive := range strings.Split(val, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		name, arg, _ := strings.Cut(directive, "=")
+
+		switch name {
+		case "stale-while-revalidate", "stale-if-error":
+			val, ok := parseDeltaSeconds(arg)
+			if !ok {
+				continue
+			}
+			if name == "stale-while-revalidate" {
+				swr = val
+			} else {
+				sie = val
+			}
+		}
+	}
+
+	return swr, sie
+}
+
+// revalidate refreshes the entry with the upstream in the background while
+// its stale version is served. Only one revalidation per entry is in flight
+// at a time.
+func (m *middleware) revalidate(req *http.Request, key []byte,
+	cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache,
+	rule *corev1.Service_Spec_Config_HTTP_Plugin_Cache_Rule) {
+	if _, loaded := m.revalidating.LoadOrStore(string(key), struct{}{}); loaded {
+		return
+	}
+
+	outReq := req.Clone(context.WithoutCancel(req.Context()))
+
+	go func() {
+		defer m.revalidating.Delete(string(key))
+
+		crw := newResponseWriter(&discardWriter{
+			header: make(http.Header),
+		})
+		if skC := cacheC.SurrogateKey; skC != nil && skC.IsEnabled {
+			crw.setSurrogateKeyHeader(getSurrogateKeyHeader(skC), !skC.KeepHeader)
+		}
+
+		m.next.ServeHTTP(crw, outReq)
+
+		if crw.statusCode >= 500 {
+			crw.discard()
+			return
+		}
+
+		m.doCache(crw, key, cacheC, rule)
+	}()
+}
+
+// discardWriter is the ResponseWriter of the background revalidations whose
+// responses are only cached.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(statusCode int) {}
+
+// staleErrorWriter holds back the 5xx upstream responses so that a stale entry
+// can be served instead. Other responses are written as is.
+type staleErrorWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	wroteHeader bool
+	isFailed    bool
+}
+
+func newStaleErrorWriter(w http.ResponseWriter) *staleErrorWriter {
+	return &staleErrorWriter{
+		ResponseWriter: w,
+		header:         make(http.Header),
+	}
+}
+
+func (w *staleErrorWriter) Header() http.Header {
+	if w.wroteHeader && !w.isFailed {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *staleErrorWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if statusCode >= 500 {
+		w.isFailed = true
+		return
+	}
+
+	hdr := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		hdr[k] = v
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *staleErrorWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.isFailed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/cluster/cvigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/celengine"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStaleDirectives(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type tstCase struct {
+		val string
+		swr time.Duration
+		sie time.Duration
+	}
+
+	tstCases := []tstCase{
+		{
+			val: "",
+		},
+		{
+			val: "max-age=60",
+		},
+		{
+			val: "max-age=60, stale-while-revalidate=30",
+			swr: 30 * time.Second,
+		},
+		{
+			val: "Stale-If-Error=120, stale-while-revalidate=\"30\"",
+			swr: 30 * time.Second,
+			sie: 120 * time.Second,
+		},
+		{
+			val: "stale-while-revalidate=-1, stale-if-error=abc",
+		},
+		{
+			val: "stale-if-error=99999999999999999",
+			sie: maxDeltaSeconds * time.Second,
+		},
+	}
+
+	for _, tc := range tstCases {
+		swr, sie := parseStaleDirectives(tc.val)
+		assert.Equal(t, tc.swr, swr, "%+v", tc)
+		assert.Equal(t, tc.sie, sie, "%+v", tc)
+	}
+
+	{
+		now := time.Now()
+		res := &cvigilv1.CacheHTTP{
+			FreshUntil:           now.UnixMilli(),
+			StaleWhileRevalidate: 10,
+			StaleIfError:         20,
+		}
+
+		assert.Equal(t, entryFresh, getEntryState(&cvigilv1.CacheHTTP{}, now))
+		assert.Equal(t, entryFresh, getEntryState(res, now.Add(-time.Second)))
+		assert.Equal(t, entryStaleWhileRevalidate, getEntryState(res, now.Add(5*time.Second)))
+		assert.Equal(t, entryStaleIfError, getEntryState(res, now.Add(15*time.Second)))
+		assert.Equal(t, entryExpired, getEntryState(res, now.Add(25*time.Second)))
+	}
+}
+
+func TestStale(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var count atomic.Int32
+	var isFailing atomic.Bool
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isFailing.Load() {
+			w.Header().Set("X-Error", "true")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		if r.URL.Path == "/swr" {
+			w.Header().Set("Cache-Control", "stale-while-revalidate=60")
+		}
+		w.Write([]byte(fmt.Sprintf("v%d", count.Add(1))))
+	})
+
+	celEngine, err := celengine.New(ctx, &celengine.Opts{})
+	assert.Nil(t, err)
+
+	mdlwr, err := New(ctx, next, celEngine, tst.C.OcteliumC,
+		vutils.UUIDv4(), NewDiskStore(""), corev1.Service_Spec_Config_HTTP_Plugin_POST_AUTH)
+	assert.Nil(t, err)
+
+	svcCfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				Plugins: []*corev1.Service_Spec_Config_HTTP_Plugin{
+					{
+						Condition: &corev1.Condition{
+							Type: &corev1.Condition_MatchAny{
+								MatchAny: true,
+							},
+						},
+
+						Type: &corev1.Service_Spec_Config_HTTP_Plugin_Cache_{
+							Cache: &corev1.Service_Spec_Config_HTTP_Plugin_Cache{
+								UseXCacheHeader: true,
+								Ttl: &metav1.Duration{
+									Type: &metav1.Duration_Seconds{
+										Seconds: 2,
+									},
+								},
+								Stale: &corev1.Service_Spec_Config_HTTP_Plugin_Cache_Stale{
+									IsEnabled: true,
+									StaleIfError: &metav1.Duration{
+										Type: &metav1.Duration_Seconds{
+											Seconds: 60,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	doRequest := func(pth string) (int, string, string) {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost"+pth, nil)
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt:     time.Now(),
+				ServiceConfig: svcCfg,
+			}))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		resp := rw.Result()
+		defer resp.Body.Close()
+
+		bb, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+
+		return resp.StatusCode, string(bb), resp.Header.Get("X-Cache")
+	}
+
+	{
+		code, body, xCache := doRequest("/swr")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "v1", body)
+		assert.Equal(t, "", xCache)
+
+		time.Sleep(500 * time.Millisecond)
+		_, body, xCache = doRequest("/swr")
+		assert.Equal(t, "v1", body)
+		assert.Equal(t, "HIT", xCache)
+
+		time.Sleep(2 * time.Second)
+
+		code, body, xCache = doRequest("/swr")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "v1", body)
+		assert.Equal(t, "STALE", xCache)
+
+		assert.Eventually(t, func() bool {
+			_, body, xCache := doRequest("/swr")
+			return body == "v2" && xCache == "HIT"
+		}, 2*time.Second, 50*time.Millisecond)
+		assert.Equal(t, int32(2), count.Load())
+	}
+
+	{
+		code, body, _ := doRequest("/sie")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "v3", body)
+
+		time.Sleep(500 * time.Millisecond)
+		_, body, xCache := doRequest("/sie")
+		assert.Equal(t, "v3", body)
+		assert.Equal(t, "HIT", xCache)
+
+		time.Sleep(2 * time.Second)
+		isFailing.Store(true)
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/sie", nil)
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt:     time.Now(),
+				ServiceConfig: svcCfg,
+			}))
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "v3", rw.Body.String())
+		assert.Equal(t, "STALE", rw.Header().Get("X-Cache"))
+		assert.Equal(t, "", rw.Header().Get("X-Error"))
+
+		isFailing.Store(false)
+
+		code, body, xCache = doRequest("/sie")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "v4", body)
+		assert.Equal(t, "", xCache)
+	}
+}
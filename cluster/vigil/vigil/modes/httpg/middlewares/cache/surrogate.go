@@ -0,0 +1,212 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/octelium/octelium/apis/cluster/cvigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/apis/rsc/rcachev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/grpcerr"
+	"github.com/octelium/octelium/pkg/utils/utilrand"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSurrogateKeyHeader = "Surrogate-Key"
+	maxSurrogateKeys          = 32
+	maxSurrogateKeyLen        = 256
+	methodPurge               = "PURGE"
+)
+
+// The generations are only needed to outlive the entries tagged by them. An
+// expired generation is replaced by a new one which makes all its existing
+// entries stale, hence the expiration can only cause extra cache misses.
+var surrogateGenerationTTL = &metav1.Duration{
+	Type: &metav1.Duration_Days{
+		Days: 30,
+	},
+}
+
+func getSurrogateKeyHeader(skC *corev1.Service_Spec_Config_HTTP_Plugin_Cache_SurrogateKey) string {
+	if skC.Header != "" {
+		return skC.Header
+	}
+	return defaultSurrogateKeyHeader
+}
+
+func parseSurrogateKeys(val string) []string {
+	var ret []string
+	for _, key := range strings.Fields(val) {
+		if len(key) > maxSurrogateKeyLen || slices.Contains(ret, key) {
+			continue
+		}
+		ret = append(ret, key)
+		if len(ret) == maxSurrogateKeys {
+			break
+		}
+	}
+
+	return ret
+}
+
+func (m *middleware) getSurrogateGenerationKey(key string) []byte {
+	return m.doGetKey("surrogate-key:" + key)
+}
+
+func (m *middleware) getSurrogateGeneration(ctx context.Context, key string) (string, error) {
+	resp, err := m.octeliumC.CacheC().GetCache(ctx, &rcachev1.GetCacheRequest{
+		Key: m.getSurrogateGenerationKey(key),
+	})
+	if err != nil {
+		if grpcerr.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return string(resp.Data), nil
+}
+
+func (m *middleware) setSurrogateGeneration(ctx context.Context, key string) (string, error) {
+	ret := utilrand.GetRandomStringCanonical(16)
+	if _, err := m.octeliumC.CacheC().SetCache(ctx, &rcachev1.SetCacheRequest{
+		Key:      m.getSurrogateGenerationKey(key),
+		Data:     []byte(ret),
+		Duration: surrogateGenerationTTL,
+	}); err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+// getSurrogateKeys returns the current generations of the keys tagging a new
+// entry. A generation is created for the keys that do not have one yet.
+func (m *middleware) getSurrogateKeys(ctx context.Context, keys []string) ([]*cvigilv1.CacheHTTP_SurrogateKey, error) {
+	var ret []*cvigilv1.CacheHTTP_SurrogateKey
+	for _, key := range keys {
+		gen, err := m.getSurrogateGeneration(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if gen == "" {
+			gen, err = m.setSurrogateGeneration(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ret = append(ret, &cvigilv1.CacheHTTP_SurrogateKey{
+			Key:        key,
+			Generation: gen,
+		})
+	}
+
+	return ret, nil
+}
+
+// isSurrogateStale reports whether any of the keys tagging an entry has been
+// purged since the entry was cached.
+func (m *middleware) isSurrogateStale(ctx context.Context, keys []*cvigilv1.CacheHTTP_SurrogateKey) bool {
+	for _, key := range keys {
+		gen, err := m.getSurrogateGeneration(ctx, key.Key)
+		if err != nil {
+			zap.L().Debug("Could not get surrogate key generation", zap.Error(err))
+			return true
+		}
+		if gen != key.Generation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handlePurge purges the entries tagged with the keys of a PURGE request
+// that is allowed by the purge condition. It returns false if the request is
+// not a purge request and must be handled normally.
+func (m *middleware) handlePurge(rw http.ResponseWriter, req *http.Request,
+	cacheC *corev1.Service_Spec_Config_HTTP_Plugin_Cache) bool {
+	skC := cacheC.SurrogateKey
+	if req.Method != methodPurge || skC == nil || !skC.IsEnabled || skC.PurgeCondition == nil {
+		return false
+	}
+
+	ctx := req.Context()
+	reqCtx := middlewares.GetCtxRequestContext(ctx)
+
+	isMatched, err := m.celEngine.EvalCondition(ctx, skC.PurgeCondition, map[string]any{
+		"ctx": reqCtx.ReqCtxMap,
+	})
+	if err != nil || !isMatched {
+		return false
+	}
+
+	keys := parseSurrogateKeys(req.Header.Get(getSurrogateKeyHeader(skC)))
+	if len(keys) == 0 {
+		http.Error(rw, "No surrogate keys to purge", http.StatusBadRequest)
+		return true
+	}
+
+	for _, key := range keys {
+		if _, err := m.setSurrogateGeneration(ctx, key); err != nil {
+			zap.L().Warn("Could not purge surrogate key", zap.String("key", key), zap.Error(err))
+			http.Error(rw, "Could not purge", http.StatusInternalServerError)
+			return true
+		}
+	}
+
+	zap.L().Debug("Purged surrogate keys", zap.Strings("keys", keys))
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(map[string]any{
+		"purged": keys,
+	})
+
+	return true
+}
+
+// getEntrySurrogateKeys returns the surrogate keys tagging the response. It
+// returns false if the keys could not be obtained, in which case the response
+// must not be cached since it could never be purged.
+func (m *middleware) getEntrySurrogateKeys(rw *responseWriter) ([]*cvigilv1.CacheHTTP_SurrogateKey, bool) {
+	if len(rw.surrogateKeys) == 0 {
+		return nil, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ret, err := m.getSurrogateKeys(ctx, rw.surrogateKeys)
+	if err != nil {
+		zap.L().Warn("Could not get surrogate keys", zap.Error(err))
+		return nil, false
+	}
+
+	return ret, true
+}
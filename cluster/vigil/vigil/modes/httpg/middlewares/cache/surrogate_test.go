@@ -0,0 +1,195 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/celengine"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/utils/utilrand"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSurrogateKeys(t *testing.T) {
+	assert.Nil(t, parseSurrogateKeys(""))
+	assert.Equal(t, []string{"a", "b"}, parseSurrogateKeys(" a  b a "))
+	assert.Equal(t, []string{"b"}, parseSurrogateKeys(strings.Repeat("a", maxSurrogateKeyLen+1)+" b"))
+
+	var keys []string
+	for i := 0; i < maxSurrogateKeys+10; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+	assert.Len(t, parseSurrogateKeys(strings.Join(keys, " ")), maxSurrogateKeys)
+
+	{
+		rec := httptest.NewRecorder()
+		rw := newResponseWriter(rec)
+		rw.setSurrogateKeyHeader(defaultSurrogateKeyHeader, true)
+		rw.Header().Set(defaultSurrogateKeyHeader, "k1 k2")
+		rw.Write([]byte("hello"))
+
+		assert.Equal(t, []string{"k1", "k2"}, rw.surrogateKeys)
+		assert.Equal(t, "", rec.Header().Get(defaultSurrogateKeyHeader))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	{
+		rec := httptest.NewRecorder()
+		rw := newResponseWriter(rec)
+		rw.setSurrogateKeyHeader("X-Keys", false)
+		rw.Header().Set("X-Keys", "k1")
+		rw.WriteHeader(http.StatusCreated)
+
+		assert.Equal(t, []string{"k1"}, rw.surrogateKeys)
+		assert.Equal(t, "k1", rec.Header().Get("X-Keys"))
+	}
+}
+
+func TestSurrogateKey(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	key := utilrand.GetRandomStringCanonical(8)
+	respBody := utilrand.GetRandomString(32)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(defaultSurrogateKeyHeader, key+" other")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(respBody))
+	})
+
+	celEngine, err := celengine.New(ctx, &celengine.Opts{})
+	assert.Nil(t, err)
+
+	mdlwr, err := New(ctx, next, celEngine, tst.C.OcteliumC,
+		vutils.UUIDv4(), NewDiskStore(""), corev1.Service_Spec_Config_HTTP_Plugin_POST_AUTH)
+	assert.Nil(t, err)
+
+	svcCfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				Plugins: []*corev1.Service_Spec_Config_HTTP_Plugin{
+					{
+						Condition: &corev1.Condition{
+							Type: &corev1.Condition_MatchAny{
+								MatchAny: true,
+							},
+						},
+						Type: &corev1.Service_Spec_Config_HTTP_Plugin_Cache_{
+							Cache: &corev1.Service_Spec_Config_HTTP_Plugin_Cache{
+								UseXCacheHeader: true,
+								Ttl: &metav1.Duration{
+									Type: &metav1.Duration_Minutes{
+										Minutes: 5,
+									},
+								},
+								SurrogateKey: &corev1.Service_Spec_Config_HTTP_Plugin_Cache_SurrogateKey{
+									IsEnabled: true,
+									PurgeCondition: &corev1.Condition{
+										Type: &corev1.Condition_MatchAny{
+											MatchAny: true,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	doReq := func(method string, hdrs map[string]string) *http.Response {
+		req := httptest.NewRequest(method, "http://localhost/prefix/v1", nil)
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt:     time.Now(),
+				ServiceConfig: svcCfg,
+			}))
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw.Result()
+	}
+
+	{
+		resp := doReq(http.MethodGet, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "", resp.Header.Get("X-Cache"))
+		assert.Equal(t, "", resp.Header.Get(defaultSurrogateKeyHeader))
+	}
+
+	time.Sleep(1 * time.Second)
+
+	{
+		resp := doReq(http.MethodGet, nil)
+		bb, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, respBody, string(bb))
+		assert.Equal(t, "HIT", resp.Header.Get("X-Cache"))
+	}
+
+	{
+		resp := doReq(methodPurge, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	{
+		resp := doReq(methodPurge, map[string]string{
+			defaultSurrogateKeyHeader: key,
+		})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		res := map[string][]string{}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, []string{key}, res["purged"])
+	}
+
+	{
+		resp := doReq(http.MethodGet, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "", resp.Header.Get("X-Cache"))
+	}
+
+	time.Sleep(1 * time.Second)
+
+	{
+		resp := doReq(http.MethodGet, nil)
+		assert.Equal(t, "HIT", resp.Header.Get("X-Cache"))
+	}
+}
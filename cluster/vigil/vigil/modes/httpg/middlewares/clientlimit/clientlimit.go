@@ -0,0 +1,197 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package clientlimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	limitTypeConnection = "connection"
+	limitTypeRequest    = "request"
+)
+
+type metrics struct {
+	active   metric.Int64UpDownCounter
+	rejected metric.Int64Counter
+}
+
+func newMetrics() (*metrics, error) {
+	ret := &metrics{}
+	meter := otelutils.GetMeter()
+
+	var err error
+	ret.active, err = meter.Int64UpDownCounter(metricutils.GetKey("client.limit.active"),
+		metric.WithDescription("Number of connections and in-flight requests tracked by the per client IP limits"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret.rejected, err = meter.Int64Counter(metricutils.GetKey("client.limit.rejected"),
+		metric.WithDescription("Total number of connections and requests rejected by the per client IP limits"))
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (m *metrics) add(typ string, val int64) {
+	m.active.Add(context.Background(), val, metric.WithAttributes(attribute.String("type", typ)))
+}
+
+func (m *metrics) reject(typ string) {
+	m.rejected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("type", typ)))
+}
+
+// counter tracks the number of simultaneous connections or requests per
+// client IP address.
+type counter struct {
+	mu     sync.Mutex
+	counts map[string]uint32
+}
+
+func newCounter() *counter {
+	return &counter{
+		counts: make(map[string]uint32),
+	}
+}
+
+func (c *counter) acquire(key string, max uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts[key] >= max {
+		return false
+	}
+	c.counts[key]++
+	return true
+}
+
+func (c *counter) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts[key] <= 1 {
+		delete(c.counts, key)
+		return
+	}
+	c.counts[key]--
+}
+
+func (c *counter) get(key string) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[key]
+}
+
+type middleware struct {
+	next    http.Handler
+	counts  *counter
+	metrics *metrics
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	m, err := newMetrics()
+	if err != nil {
+		return nil, err
+	}
+
+	return &middleware{
+		next:    next,
+		counts:  newCounter(),
+		metrics: m,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig
+	if cfg == nil || cfg.GetHttp() == nil || cfg.GetHttp().ClientLimit == nil ||
+		cfg.GetHttp().ClientLimit.MaxRequests == 0 {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	limitC := cfg.GetHttp().ClientLimit
+
+	ip := getClientIP(reqCtx, req)
+	if ip == "" {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	if !m.counts.acquire(ip, limitC.MaxRequests) {
+		zap.L().Debug("Rejecting request since client IP exceeded maxRequests",
+			zap.String("ip", ip), zap.Uint32("maxRequests", limitC.MaxRequests))
+		m.metrics.reject(limitTypeRequest)
+
+		statusCode := http.StatusTooManyRequests
+		if limitC.StatusCode > 0 {
+			statusCode = int(limitC.StatusCode)
+		}
+		middlewares.WriteLimitedResponse(w, req, cfg.GetHttp(),
+			middlewares.LimitedClientLimit, statusCode, nil, nil)
+		return
+	}
+
+	m.metrics.add(limitTypeRequest, 1)
+	defer func() {
+		m.counts.release(ip)
+		m.metrics.add(limitTypeRequest, -1)
+	}()
+
+	m.next.ServeHTTP(w, req)
+}
+
+// getClientIP returns the downstream IP address. Public Services are reached
+// through the Ingress, which sets the client address header after applying
+// the Cluster's trusted hops, while the remaining Services are reached
+// directly by the clients.
+func getClientIP(reqCtx *middlewares.RequestContext, req *http.Request) string {
+	if reqCtx.Service != nil && reqCtx.Service.Spec != nil && reqCtx.Service.Spec.IsPublic {
+		if val := req.Header.Get(vutils.GetDownstreamIPHeaderCanonical()); val != "" {
+			return val
+		}
+	}
+
+	return getConnIP(reqCtx.Conn)
+}
+
+func getConnIP(c net.Conn) string {
+	if c == nil {
+		return ""
+	}
+
+	switch addr := c.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP.String()
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package clientlimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	blockCh := make(chan struct{})
+	startedCh := make(chan struct{}, 8)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startedCh <- struct{}{}
+		<-blockCh
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	svc := &corev1.Service{
+		Spec: &corev1.Service_Spec{},
+	}
+	svcCfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				ClientLimit: &corev1.Service_Spec_Config_HTTP_ClientLimit{
+					MaxRequests: 2,
+				},
+			},
+		},
+	}
+
+	doReq := func(ip string, hdrIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		if hdrIP != "" {
+			req.Header.Set(vutils.GetDownstreamIPHeaderCanonical(), hdrIP)
+		}
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service:   svc,
+				Conn: &fakeConn{
+					addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000},
+				},
+				ServiceConfig: svcCfg,
+			}))
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rw := doReq("10.0.0.1", "")
+			assert.Equal(t, http.StatusOK, rw.Code)
+		}()
+	}
+	<-startedCh
+	<-startedCh
+
+	assert.Equal(t, http.StatusTooManyRequests, doReq("10.0.0.1", "").Code)
+
+	svcCfg.GetHttp().ClientLimit.StatusCode = http.StatusServiceUnavailable
+	assert.Equal(t, http.StatusServiceUnavailable, doReq("10.0.0.1", "").Code)
+
+	// The header is only trusted for public Services
+	assert.Equal(t, http.StatusServiceUnavailable, doReq("10.0.0.1", "1.2.3.4").Code)
+
+	{
+		rw := doReq("10.0.0.1", "")
+		assert.Equal(t, middlewares.LimitedClientLimit, rw.Header().Get(middlewares.HeaderLimited))
+		assert.Equal(t, 0, rw.Body.Len())
+
+		svcCfg.GetHttp().LimitResponse = &corev1.Service_Spec_Config_HTTP_LimitResponse{
+			RateLimited: &corev1.Service_Spec_Config_HTTP_LimitResponse_Response{
+				Format: corev1.Service_Spec_Config_HTTP_ErrorResponse_HTML,
+			},
+		}
+		rw = doReq("10.0.0.1", "")
+		assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rw.Header().Get("Content-Type"))
+		assert.Contains(t, rw.Body.String(), "503 Service Unavailable")
+		svcCfg.GetHttp().LimitResponse = nil
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rw := doReq("10.0.0.2", "")
+		assert.Equal(t, http.StatusOK, rw.Code)
+	}()
+	<-startedCh
+
+	close(blockCh)
+	wg.Wait()
+
+	assert.Equal(t, http.StatusOK, doReq("10.0.0.1", "").Code)
+
+	mw := mdlwr.(*middleware)
+	assert.Equal(t, uint32(0), mw.counts.get("10.0.0.1"))
+	assert.Equal(t, 0, len(mw.counts.counts))
+}
+
+func TestGetClientIP(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	conn := &fakeConn{
+		addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.Header.Set(vutils.GetDownstreamIPHeaderCanonical(), "1.2.3.4")
+
+	assert.Equal(t, "10.0.0.1", getClientIP(&middlewares.RequestContext{
+		Service: &corev1.Service{Spec: &corev1.Service_Spec{}},
+		Conn:    conn,
+	}, req))
+
+	assert.Equal(t, "1.2.3.4", getClientIP(&middlewares.RequestContext{
+		Service: &corev1.Service{Spec: &corev1.Service_Spec{IsPublic: true}},
+		Conn:    conn,
+	}, req))
+
+	assert.Equal(t, "", getClientIP(&middlewares.RequestContext{
+		Service: &corev1.Service{Spec: &corev1.Service_Spec{}},
+	}, req))
+}
+
+func TestListener(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	rawLis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	max := uint32(2)
+	lis, err := NewListener(rawLis, func() uint32 {
+		return max
+	})
+	assert.Nil(t, err)
+	defer lis.Close()
+
+	acceptedCh := make(chan net.Conn, 8)
+	go func() {
+		for {
+			c, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			acceptedCh <- c
+		}
+	}()
+
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", rawLis.Addr().String())
+		assert.Nil(t, err)
+		return c
+	}
+
+	isClosed := func(c net.Conn) bool {
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err := c.Read(make([]byte, 1))
+		return err != nil && !isTimeout(err)
+	}
+
+	c1 := dial()
+	defer c1.Close()
+	c2 := dial()
+	defer c2.Close()
+
+	s1 := <-acceptedCh
+	<-acceptedCh
+
+	c3 := dial()
+	defer c3.Close()
+	assert.True(t, isClosed(c3))
+
+	l := lis.(*listener)
+	assert.Equal(t, uint32(2), l.counts.get("127.0.0.1"))
+
+	s1.Close()
+	s1.Close()
+	assert.Equal(t, uint32(1), l.counts.get("127.0.0.1"))
+
+	c4 := dial()
+	defer c4.Close()
+	s4 := <-acceptedCh
+	defer s4.Close()
+	assert.Equal(t, uint32(2), l.counts.get("127.0.0.1"))
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package clientlimit
+
+import (
+	"net"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type listener struct {
+	net.Listener
+	getMax  func() uint32
+	counts  *counter
+	metrics *metrics
+}
+
+// NewListener wraps the listener so that the connections exceeding the
+// maximum number of simultaneous connections per client IP address returned
+// by getMax are closed at accept time. A zero maximum disables the limit.
+func NewListener(lis net.Listener, getMax func() uint32) (net.Listener, error) {
+	m, err := newMetrics()
+	if err != nil {
+		return nil, err
+	}
+
+	return &listener{
+		Listener: lis,
+		getMax:   getMax,
+		counts:   newCounter(),
+		metrics:  m,
+	}, nil
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		max := l.getMax()
+		if max == 0 {
+			return c, nil
+		}
+
+		ip := getConnIP(c)
+		if ip == "" {
+			return c, nil
+		}
+
+		if !l.counts.acquire(ip, max) {
+			zap.L().Debug("Closing conn since client IP exceeded maxConnections",
+				zap.String("ip", ip), zap.Uint32("maxConnections", max))
+			l.metrics.reject(limitTypeConnection)
+			c.Close()
+			continue
+		}
+
+		l.metrics.add(limitTypeConnection, 1)
+
+		return &conn{
+			Conn: c,
+			release: func() {
+				l.counts.release(ip)
+				l.metrics.add(limitTypeConnection, -1)
+			},
+		}, nil
+	}
+}
+
+type conn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
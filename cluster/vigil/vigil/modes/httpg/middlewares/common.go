@@ -20,6 +20,7 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
@@ -82,6 +83,10 @@ type RequestContext struct {
 	Conn      net.Conn
 	CreatedAt time.Time
 
+	// ID identifies the request. It is also the ID of the request's access
+	// log so that the error responses can be correlated with it.
+	ID string
+
 	IsAuthorized      bool
 	IsAuthenticated   bool
 	DownstreamInfo    *corev1.RequestContext
@@ -94,7 +99,50 @@ type RequestContext struct {
 	Body        []byte
 	BodyJSONMap map[string]any
 
+	// IsBodyBuffered is set once the request body has been entirely read
+	// into Body.
+	IsBodyBuffered bool
+	// IsBodyStreamed is set if the request body exceeded the max buffer size
+	// and is hence streamed to the upstream instead of being buffered.
+	IsBodyStreamed bool
+
 	ReqCtxMap map[string]any
+
+	// ClientCtx is the original context of the downstream request. Unlike the
+	// request context which can be wrapped by timeouts, it is only canceled
+	// once the client goes away.
+	ClientCtx context.Context
+
+	// Tunnel is set once a CONNECT tunnel of the request has been closed
+	Tunnel *TunnelInfo
+
+	// VaryHeaders is the list of the request headers that changed the
+	// response. They are merged into the Vary header of the response.
+	VaryHeaders []string
+}
+
+// AddVary registers request headers that the response varies on.
+func (r *RequestContext) AddVary(headers ...string) {
+	for _, hdr := range headers {
+		hdr = http.CanonicalHeaderKey(hdr)
+		if hdr != "" && !slices.Contains(r.VaryHeaders, hdr) {
+			r.VaryHeaders = append(r.VaryHeaders, hdr)
+		}
+	}
+}
+
+// TunnelInfo is the byte accounting of a CONNECT tunnel. Received bytes are
+// sent by the client and sent bytes are sent to the client.
+type TunnelInfo struct {
+	Destination   string
+	ReceivedBytes uint64
+	SentBytes     uint64
+}
+
+// IsClientDisconnected reports whether the downstream client has closed the
+// connection or reset the stream before the request has been fully served.
+func (r *RequestContext) IsClientDisconnected() bool {
+	return r != nil && r.ClientCtx != nil && r.ClientCtx.Err() != nil
 }
 
 func GetCtxRequestContext(ctx context.Context) *RequestContext {
@@ -0,0 +1,59 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"context"
+	"testing"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsClientDisconnected(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var nilReqCtx *RequestContext
+	assert.False(t, nilReqCtx.IsClientDisconnected())
+	assert.False(t, (&RequestContext{}).IsClientDisconnected())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reqCtx := &RequestContext{
+		ClientCtx: ctx,
+	}
+	assert.False(t, reqCtx.IsClientDisconnected())
+
+	cancel()
+	assert.True(t, reqCtx.IsClientDisconnected())
+
+	{
+		// A timeout wrapping the request context must not be mistaken for
+		// a disconnect of the client.
+		reqCtx := &RequestContext{
+			ClientCtx: context.Background(),
+		}
+		timeoutCtx, cancel := context.WithTimeout(reqCtx.ClientCtx, 0)
+		defer cancel()
+		assert.NotNil(t, timeoutCtx.Err())
+		assert.False(t, reqCtx.IsClientDisconnected())
+	}
+}
@@ -17,11 +17,22 @@
 package compress
 
 import (
+	"bufio"
 	"compress/gzip"
 	"context"
+	"mime"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/klauspost/compress/gzhttp"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -33,7 +44,15 @@ type middleware struct {
 
 func New(ctx context.Context, next http.Handler) (http.Handler, error) {
 
-	excludes := []string{"application/grpc"}
+	excludes := []string{
+		"application/grpc",
+		"application/grpc+proto",
+		"application/grpc+json",
+		"application/grpc-web",
+		"application/grpc-web+proto",
+		"application/grpc-web-text",
+		"application/grpc-web-text+proto",
+	}
 
 	return &middleware{
 		next:     next,
@@ -42,7 +61,144 @@ func New(ctx context.Context, next http.Handler) (http.Handler, error) {
 }
 
 func (c *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	c.gzipHandler().ServeHTTP(rw, req)
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+
+	// gRPC messages are compressed individually according to the
+	// grpc-encoding negotiation between the client and the upstream while
+	// compressing the HTTP body breaks the gRPC framing for the clients.
+	if isGRPC(reqCtx, req) {
+		c.next.ServeHTTP(rw, req)
+		return
+	}
+
+	reqCtx.AddVary("Accept-Encoding")
+	c.gzipHandler().ServeHTTP(&varyResponseWriter{
+		ResponseWriter: rw,
+		isHead:         isHeadEncoding(reqCtx, req),
+		excludes:       c.excludes,
+	}, req)
+}
+
+// isHeadEncoding returns whether the headers of the response to the HEAD
+// request must reflect the compression that a GET request would get, since
+// the compression handler never compresses HEAD responses.
+func isHeadEncoding(reqCtx *middlewares.RequestContext, req *http.Request) bool {
+	if req.Method != http.MethodHead || !acceptsGzip(req.Header.Get("Accept-Encoding")) {
+		return false
+	}
+
+	return reqCtx.ServiceConfig.GetHttp().GetHeadResponse().GetMode() !=
+		corev1.Service_Spec_Config_HTTP_HeadResponse_PRESERVE
+}
+
+// varyResponseWriter merges the Vary header values right before the header is
+// written since the compression handler adds its own Vary value in addition
+// to the one copied from the upstream response. It also sets the encoding
+// headers of HEAD responses at that point.
+type varyResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	isHead      bool
+	excludes    []string
+}
+
+func (w *varyResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader && statusCode >= 200 {
+		w.wroteHeader = true
+		httputils.MergeVary(w.Header())
+		if w.isHead {
+			setHeadEncoding(w.Header(), statusCode, w.excludes)
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *varyResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *varyResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *varyResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.Errorf("ResponseWriter is not a Hijacker")
+	}
+
+	return hj.Hijack()
+}
+
+func (w *varyResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func isGRPC(reqCtx *middlewares.RequestContext, req *http.Request) bool {
+	if reqCtx.Service != nil && ucorev1.ToService(reqCtx.Service).IsGRPC() {
+		return true
+	}
+
+	return strings.HasPrefix(strings.ToLower(req.Header.Get("Content-Type")), "application/grpc")
+}
+
+// setHeadEncoding sets the headers of a HEAD response the same way the
+// compression handler would for the GET response, i.e. if the response is
+// identity-encoded, its length is known to be at least the min size and its
+// content type is not excluded.
+func setHeadEncoding(hdr http.Header, statusCode int, excludes []string) {
+	switch statusCode {
+	case http.StatusNoContent, http.StatusNotModified:
+		return
+	}
+
+	if len(hdr[gzhttp.HeaderNoCompression]) > 0 ||
+		hdr.Get("Content-Encoding") != "" || hdr.Get("Content-Range") != "" {
+		return
+	}
+
+	cl, err := strconv.ParseInt(hdr.Get("Content-Length"), 10, 64)
+	if err != nil || cl < gzhttp.DefaultMinSize {
+		return
+	}
+
+	if ct := hdr.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err == nil && slices.Contains(excludes, mediaType) {
+			return
+		}
+	}
+
+	hdr.Set("Content-Encoding", "gzip")
+	hdr.Del("Content-Length")
+	hdr.Del("Accept-Ranges")
+}
+
+// acceptsGzip reports whether the Accept-Encoding header accepts gzip with a
+// non-zero quality.
+func acceptsGzip(val string) bool {
+	for _, coding := range strings.Split(val, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		qval, err := strconv.ParseFloat(q, 64)
+		return err == nil && qval > 0
+	}
+
+	return false
 }
 
 func (c *middleware) gzipHandler() http.Handler {
@@ -0,0 +1,229 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package compress
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVary(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	body := strings.Repeat("hello world ", 1024)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "accept-encoding, Origin")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	for _, acceptEncoding := range []string{"gzip", ""} {
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+
+		assert.Equal(t, []string{"Accept-Encoding, Origin"}, rw.Header().Values("Vary"))
+		assert.Equal(t, []string{"Accept-Encoding"}, reqCtx.VaryHeaders)
+		assert.Equal(t, acceptEncoding, rw.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestGRPC(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	body := strings.Repeat("hello world ", 1024)
+	grpcBody := append([]byte{0, 0, 0, 0x30, 0}, []byte(body)...)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+			w.Header().Set("Grpc-Encoding", "identity")
+			w.Write(grpcBody)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"msg":"` + body + `"}`))
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	doReq := func(svc *corev1.Service, contentType string) (*httptest.ResponseRecorder, *middlewares.RequestContext) {
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Service:   svc,
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("Content-Type", contentType)
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw, reqCtx
+	}
+
+	httpSvc := &corev1.Service{
+		Spec: &corev1.Service_Spec{
+			Mode: corev1.Service_Spec_HTTP,
+		},
+	}
+	grpcSvc := &corev1.Service{
+		Spec: &corev1.Service_Spec{
+			Mode: corev1.Service_Spec_GRPC,
+		},
+	}
+
+	for _, contentType := range []string{"application/grpc", "application/grpc+proto", "application/grpc-web"} {
+		for _, svc := range []*corev1.Service{httpSvc, grpcSvc} {
+			rw, reqCtx := doReq(svc, contentType)
+			assert.Equal(t, "", rw.Header().Get("Content-Encoding"))
+			assert.Equal(t, "", rw.Header().Get("Vary"))
+			assert.Equal(t, 0, len(reqCtx.VaryHeaders))
+			assert.Equal(t, grpcBody, rw.Body.Bytes())
+		}
+	}
+
+	{
+		rw, _ := doReq(httpSvc, "application/json")
+		assert.Equal(t, "gzip", rw.Header().Get("Content-Encoding"))
+		assert.True(t, rw.Body.Len() < len(body))
+	}
+}
+
+func TestHead(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	largeBody := strings.Repeat("hello world ", 1024)
+	smallBody := "hello world"
+
+	doReq := func(method string, body string, contentType string,
+		acceptEncoding string, httpCfg *corev1.Service_Spec_Config_HTTP) http.Header {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.WriteHeader(http.StatusOK)
+			if r.Method != http.MethodHead {
+				w.Write([]byte(body))
+			}
+		})
+
+		mdlwr, err := New(ctx, next)
+		assert.Nil(t, err)
+
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			ServiceConfig: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: httpCfg,
+				},
+			},
+		}
+
+		req := httptest.NewRequest(method, "http://localhost/", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw.Header()
+	}
+
+	assertSameHeaders := func(body string, contentType string, acceptEncoding string) {
+		get := doReq(http.MethodGet, body, contentType, acceptEncoding, nil)
+		head := doReq(http.MethodHead, body, contentType, acceptEncoding, nil)
+		for _, hdr := range []string{"Content-Encoding", "Content-Length", "Accept-Ranges", "Vary"} {
+			assert.Equal(t, get.Values(hdr), head.Values(hdr), "%s %s %s", hdr, contentType, acceptEncoding)
+		}
+	}
+
+	{
+		head := doReq(http.MethodHead, largeBody, "text/plain", "gzip", nil)
+		assert.Equal(t, "gzip", head.Get("Content-Encoding"))
+		assert.Equal(t, "", head.Get("Content-Length"))
+		assert.Equal(t, "", head.Get("Accept-Ranges"))
+	}
+
+	assertSameHeaders(largeBody, "text/plain", "gzip")
+	assertSameHeaders(largeBody, "text/plain; charset=utf-8", "br, gzip;q=0.5")
+	assertSameHeaders(largeBody, "text/plain", "gzip;q=0")
+	assertSameHeaders(largeBody, "text/plain", "br")
+	assertSameHeaders(largeBody, "text/plain", "")
+	assertSameHeaders(largeBody, "application/grpc-web", "gzip")
+	assertSameHeaders(smallBody, "text/plain", "gzip")
+
+	{
+		head := doReq(http.MethodHead, largeBody, "text/plain", "gzip", &corev1.Service_Spec_Config_HTTP{
+			HeadResponse: &corev1.Service_Spec_Config_HTTP_HeadResponse{
+				Mode: corev1.Service_Spec_Config_HTTP_HeadResponse_PRESERVE,
+			},
+		})
+		assert.Equal(t, "", head.Get("Content-Encoding"))
+		assert.Equal(t, fmt.Sprintf("%d", len(largeBody)), head.Get("Content-Length"))
+	}
+}
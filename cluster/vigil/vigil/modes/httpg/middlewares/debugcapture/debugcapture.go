@@ -0,0 +1,250 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package debugcapture
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/capture"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/accesslog"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxBodySize = 16 * 1024
+	defaultMaxEntries  = 100
+	redactedValue      = "[REDACTED]"
+)
+
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Octelium-Auth",
+}
+
+type middleware struct {
+	next  http.Handler
+	store *capture.Store
+}
+
+func New(ctx context.Context, next http.Handler, store *capture.Store) (http.Handler, error) {
+	return &middleware{
+		next:  next,
+		store: store,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := getCaptureConfig(reqCtx.ServiceConfig)
+	if m.store == nil || cfg == nil || !cfg.IsEnabled || !isSampled(cfg.SampleRate) {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	maxBodySize := defaultMaxBodySize
+	if cfg.MaxBodySize > 0 {
+		maxBodySize = int(cfg.MaxBodySize)
+	}
+	maxEntries := defaultMaxEntries
+	if cfg.MaxEntries > 0 {
+		maxEntries = int(cfg.MaxEntries)
+	}
+
+	startedAt := time.Now()
+	entry := &capture.Entry{
+		ID:        vutils.UUIDv4(),
+		Timestamp: startedAt,
+		Request: &capture.Request{
+			Method:  req.Method,
+			URI:     req.URL.RequestURI(),
+			Host:    req.Host,
+			Proto:   req.Proto,
+			Headers: req.Header.Clone(),
+		},
+	}
+	if svc := reqCtx.Service; svc != nil && svc.Metadata != nil {
+		entry.ServiceName = svc.Metadata.Name
+	}
+
+	reqBody := &bodyRecorder{
+		limit: maxBodySize,
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		reqBody.ReadCloser = req.Body
+		req.Body = reqBody
+	}
+
+	crw := &responseWriter{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+		body: &bodyRecorder{
+			limit: maxBodySize,
+		},
+	}
+
+	m.next.ServeHTTP(crw, req)
+
+	entry.Duration = time.Since(startedAt)
+	entry.Response = &capture.Response{
+		StatusCode: crw.statusCode,
+		Headers:    crw.Header().Clone(),
+	}
+
+	var visibilityCfg *corev1.Service_Spec_Config_HTTP_Visibility
+	if httpCfg := reqCtx.ServiceConfig.GetHttp(); httpCfg != nil {
+		visibilityCfg = httpCfg.Visibility
+	}
+
+	entry.Request.Body, entry.Request.BodyTruncated = reqBody.getBody(visibilityCfg.GetRedactRequestBodyFields())
+	entry.Response.Body, entry.Response.BodyTruncated = crw.body.getBody(visibilityCfg.GetRedactResponseBodyFields())
+
+	redactHeaders(entry.Request.Headers, visibilityCfg.GetExcludeRequestHeaders())
+	redactHeaders(entry.Response.Headers, visibilityCfg.GetExcludeResponseHeaders())
+
+	m.store.Add(entry, maxEntries)
+}
+
+func getCaptureConfig(svcCfg *corev1.Service_Spec_Config) *corev1.Service_Spec_Config_HTTP_Capture {
+	if svcCfg == nil || svcCfg.GetHttp() == nil {
+		return nil
+	}
+
+	return svcCfg.GetHttp().Capture
+}
+
+func isSampled(rate float32) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+
+	return rand.Float32() < rate
+}
+
+func redactHeaders(hdr http.Header, excluded []string) {
+	for _, keys := range [][]string{sensitiveHeaders, excluded} {
+		for _, key := range keys {
+			key = http.CanonicalHeaderKey(key)
+			if _, ok := hdr[key]; ok {
+				hdr[key] = []string{redactedValue}
+			}
+		}
+	}
+}
+
+// bodyRecorder records up to limit bytes of a body as it is read or written
+// by the rest of the chain without altering it.
+type bodyRecorder struct {
+	io.ReadCloser
+	mu        sync.Mutex
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (r *bodyRecorder) record(b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if remaining := r.limit - len(r.buf); remaining < len(b) {
+		r.buf = append(r.buf, b[:max(remaining, 0)]...)
+		r.truncated = true
+	} else {
+		r.buf = append(r.buf, b...)
+	}
+}
+
+func (r *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.record(p[:n])
+	}
+	return n, err
+}
+
+func (r *bodyRecorder) getBody(redactFields []string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.buf) == 0 {
+		return nil, r.truncated
+	}
+
+	if len(redactFields) == 0 {
+		return append([]byte(nil), r.buf...), r.truncated
+	}
+
+	if r.truncated {
+		// A truncated body cannot be reliably redacted. Omit it instead.
+		return nil, true
+	}
+
+	return accesslog.RedactBody(r.buf, redactFields), false
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	body       *bodyRecorder
+	statusCode int
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	if n > 0 {
+		rw.body.record(b[:n])
+	}
+	return n, err
+}
+
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	rw.statusCode = statusCode
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.Errorf("ResponseWriter is not a Hijacker")
+	}
+
+	return hj.Hijack()
+}
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := rw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package debugcapture
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/capture"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	respBody := `{"token":"secret-value","name":"john"}`
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"password":"pass","user":"alice"}`, string(body))
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Header().Set("X-Custom", "value")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(respBody))
+	})
+
+	store := capture.NewStore()
+	mdlwr, err := New(ctx, next, store)
+	assert.Nil(t, err)
+
+	newReq := func(cfg *corev1.Service_Spec_Config_HTTP) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/api/v1?a=b",
+			strings.NewReader(`{"password":"pass","user":"alice"}`))
+		req.Header.Set("Authorization", "Bearer abc")
+		req.Header.Set("X-Request", "value")
+		return req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service: &corev1.Service{
+					Metadata: &metav1.Metadata{
+						Name: "svc.default",
+					},
+				},
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: cfg,
+					},
+				},
+			}))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(&corev1.Service_Spec_Config_HTTP{}))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.Equal(t, 0, len(store.List()))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(&corev1.Service_Spec_Config_HTTP{
+			Capture: &corev1.Service_Spec_Config_HTTP_Capture{
+				IsEnabled: true,
+			},
+			Visibility: &corev1.Service_Spec_Config_HTTP_Visibility{
+				RedactRequestBodyFields: []string{"password"},
+				ExcludeResponseHeaders:  []string{"X-Custom"},
+			},
+		}))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.Equal(t, respBody, rw.Body.String())
+		assert.Equal(t, "session=abc", rw.Header().Get("Set-Cookie"))
+
+		entries := store.List()
+		assert.Equal(t, 1, len(entries))
+		entry := entries[0]
+		assert.Equal(t, "svc.default", entry.ServiceName)
+		assert.Equal(t, http.MethodPost, entry.Request.Method)
+		assert.Equal(t, "/api/v1?a=b", entry.Request.URI)
+		assert.Equal(t, redactedValue, entry.Request.Headers.Get("Authorization"))
+		assert.Equal(t, "value", entry.Request.Headers.Get("X-Request"))
+		assert.Equal(t, `{"password":"[REDACTED]","user":"alice"}`, string(entry.Request.Body))
+		assert.False(t, entry.Request.BodyTruncated)
+
+		assert.Equal(t, http.StatusCreated, entry.Response.StatusCode)
+		assert.Equal(t, redactedValue, entry.Response.Headers.Get("Set-Cookie"))
+		assert.Equal(t, redactedValue, entry.Response.Headers.Get("X-Custom"))
+		assert.Equal(t, respBody, string(entry.Response.Body))
+	}
+
+	{
+		store.Reset()
+		for range 5 {
+			mdlwr.ServeHTTP(httptest.NewRecorder(), newReq(&corev1.Service_Spec_Config_HTTP{
+				Capture: &corev1.Service_Spec_Config_HTTP_Capture{
+					IsEnabled:   true,
+					MaxBodySize: 8,
+					MaxEntries:  3,
+				},
+			}))
+		}
+
+		entries := store.List()
+		assert.Equal(t, 3, len(entries))
+		for _, entry := range entries {
+			assert.Equal(t, `{"passwo`, string(entry.Request.Body))
+			assert.True(t, entry.Request.BodyTruncated)
+			assert.Equal(t, `{"token"`, string(entry.Response.Body))
+			assert.True(t, entry.Response.BodyTruncated)
+		}
+	}
+
+	{
+		store.Reset()
+		for range 200 {
+			mdlwr.ServeHTTP(httptest.NewRecorder(), newReq(&corev1.Service_Spec_Config_HTTP{
+				Capture: &corev1.Service_Spec_Config_HTTP_Capture{
+					IsEnabled:  true,
+					SampleRate: 0.1,
+					MaxEntries: 1000,
+				},
+			}))
+		}
+
+		assert.True(t, len(store.List()) > 0)
+		assert.True(t, len(store.List()) < 100)
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		store.ServeHTTP(rw, httptest.NewRequest(http.MethodDelete, "http://localhost/debug/captures", nil))
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+		assert.Equal(t, 0, len(store.List()))
+	}
+}
@@ -71,7 +71,7 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			for k, v := range direct.Headers {
 				rw.Header().Set(k, v)
 			}
-			rw.Header().Set("Server", "octelium")
+			middlewares.SetServerHeader(rw.Header(), cfg.GetHttp())
 
 			if direct.StatusCode >= 200 && direct.StatusCode < 600 {
 				rw.WriteHeader(int(direct.StatusCode))
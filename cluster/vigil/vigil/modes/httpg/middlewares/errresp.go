@@ -0,0 +1,77 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+)
+
+// ProblemDetails is the RFC 7807 body of the PROBLEM_JSON error responses.
+type ProblemDetails struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// WriteErrorResponse writes the error response with a body generated in the
+// given format.
+func WriteErrorResponse(w http.ResponseWriter, req *http.Request,
+	format corev1.Service_Spec_Config_HTTP_ErrorResponse_Format, statusCode int) {
+	switch format {
+	case corev1.Service_Spec_Config_HTTP_ErrorResponse_PROBLEM_JSON:
+		var requestID string
+		if reqCtx, ok := req.Context().Value(CtxRequestContext).(*RequestContext); ok {
+			requestID = reqCtx.ID
+		}
+		body, err := json.Marshal(&ProblemDetails{
+			Type:      "about:blank",
+			Title:     http.StatusText(statusCode),
+			Status:    statusCode,
+			Instance:  req.URL.Path,
+			RequestID: requestID,
+		})
+		if err != nil {
+			break
+		}
+
+		w.Header().Set("Content-Type", "application/problem+json")
+		if requestID != "" {
+			w.Header().Set("X-Request-Id", requestID)
+		}
+		w.WriteHeader(statusCode)
+		w.Write(body)
+		return
+	case corev1.Service_Spec_Config_HTTP_ErrorResponse_HTML:
+		title := html.EscapeString(fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(statusCode)
+		fmt.Fprintf(w,
+			"<!DOCTYPE html>\n<html><head><title>%s</title></head><body><h1>%s</h1></body></html>\n",
+			title, title)
+		return
+	}
+
+	w.WriteHeader(statusCode)
+	w.Write([]byte(http.StatusText(statusCode)))
+}
@@ -21,7 +21,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"sync"
@@ -31,6 +30,7 @@ import (
 	extprocsvc "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/cluster/common/celengine"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/commonplugin"
 	"github.com/octelium/octelium/pkg/apiutils/umetav1"
@@ -209,12 +209,10 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 					switch mut.Mutation.(type) {
 					case *extprocsvc.BodyMutation_Body:
 						defer req.Body.Close()
-						req.Body = io.NopCloser(bytes.NewReader(mut.GetBody()))
-						req.ContentLength = int64(len(mut.GetBody()))
+						httputils.SetRequestBody(req, mut.GetBody())
 					case *extprocsvc.BodyMutation_ClearBody:
 						defer req.Body.Close()
-						req.Body = io.NopCloser(bytes.NewReader(nil))
-						req.ContentLength = 0
+						httputils.SetRequestBody(req, nil)
 					default:
 					}
 				}
@@ -229,7 +227,7 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 						rw.Header().Del(hdr)
 					}
 				}
-				rw.Header().Set("Server", "octelium")
+				middlewares.SetServerHeader(rw.Header(), cfg.GetHttp())
 				if resp.Status != nil && resp.Status.Code >= 200 && resp.Status.Code < 600 {
 					rw.WriteHeader(int(resp.Status.Code))
 				}
@@ -245,6 +243,15 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	crw := newResponseWriter(rw)
 	m.next.ServeHTTP(crw, req)
 
+	var decoded *httputils.DecodedResponseBody
+	if hasBufferedResponseBody(clientInfos) {
+		if body, d := httputils.DecodeResponseBody(crw.Header(),
+			crw.body.Bytes(), httputils.MaxDecodedBodySize); d != nil {
+			crw.body = bytes.NewBuffer(body)
+			decoded = d
+		}
+	}
+
 	headers = &envoycore.HeaderMap{}
 	for k, v := range crw.Header() {
 		if len(v) < 1 {
@@ -357,13 +364,26 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	*/
 
 	{
-		crw.ResponseWriter.Header().Set("Content-Length", fmt.Sprintf("%d", len(crw.body.Bytes())))
-		crw.ResponseWriter.Write(crw.body.Bytes())
+		body := decoded.Restore(crw.ResponseWriter.Header(), crw.body.Bytes(), crw.isSet)
+		httputils.SetContentLength(crw.ResponseWriter.Header(), len(body))
+		crw.ResponseWriter.Write(body)
 	}
 
 	closeGRPC()
 }
 
+func hasBufferedResponseBody(clientInfos []*clientInfo) bool {
+	for _, c := range clientInfos {
+		if c.plugin.ProcessingMode != nil &&
+			c.plugin.ProcessingMode.ResponseBodyMode ==
+				corev1.Service_Spec_Config_HTTP_Plugin_ExtProc_ProcessingMode_BUFFERED {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (m *middleware) getClient(p *corev1.Service_Spec_Config_HTTP_Plugin_ExtProc) (extprocsvc.ExternalProcessorClient, error) {
 	m.RLock()
 	host, err := m.getHost(p)
@@ -0,0 +1,204 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package fairqueue
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/celengine"
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxQueueSize = 64
+	defaultMaxWait      = 10 * time.Second
+
+	// maxMetricKeys bounds the cardinality of the queue depth metric. The
+	// remaining identities are aggregated into a single "other" identity.
+	maxMetricKeys = 10
+)
+
+type middleware struct {
+	next      http.Handler
+	sched     *scheduler
+	rejected  metric.Int64Counter
+	celEngine *celengine.CELEngine
+}
+
+func New(ctx context.Context, next http.Handler, celEngine *celengine.CELEngine) (http.Handler, error) {
+	ret := &middleware{
+		next:      next,
+		sched:     newScheduler(),
+		celEngine: celEngine,
+	}
+
+	meter := otelutils.GetMeter()
+
+	var err error
+	ret.rejected, err = meter.Int64Counter(metricutils.GetKey("http.fairqueue.rejected"),
+		metric.WithDescription("Total number of requests rejected by the fair queue"))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := meter.Int64ObservableGauge(metricutils.GetKey("http.fairqueue.depth"),
+		metric.WithDescription("Number of requests queued by the fair queue per identity"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			depths, others := ret.sched.getDepths(maxMetricKeys)
+			for _, itm := range depths {
+				o.Observe(int64(itm.depth), metric.WithAttributes(attribute.String("identity", itm.key)))
+			}
+			if others > 0 {
+				o.Observe(int64(others), metric.WithAttributes(attribute.String("identity", "other")))
+			}
+			return nil
+		})); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig
+	if cfg == nil || cfg.GetHttp() == nil || cfg.GetHttp().FairQueue == nil ||
+		cfg.GetHttp().FairQueue.MaxConcurrentRequests == 0 {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	queueC := cfg.GetHttp().FairQueue
+
+	maxQueueSize := defaultMaxQueueSize
+	if queueC.MaxQueueSize > 0 {
+		maxQueueSize = int(queueC.MaxQueueSize)
+	}
+
+	maxWait := defaultMaxWait
+	if val := umetav1.ToDuration(queueC.MaxWait).ToGo(); val > 0 {
+		maxWait = val
+	}
+
+	key := getKey(reqCtx, queueC.Key)
+	band := m.getBand(req, reqCtx, queueC.Priority)
+
+	if err := m.sched.acquireBand(req.Context(), band, key,
+		int(queueC.MaxConcurrentRequests), maxQueueSize, maxWait); err != nil {
+		reason := "timeout"
+		switch {
+		case errors.Is(err, errQueueFull):
+			reason = "queueFull"
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			reason = "canceled"
+		}
+
+		zap.L().Debug("Rejecting request by the fair queue",
+			zap.String("key", key), zap.Int("band", band), zap.String("reason", reason))
+		m.rejected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	defer m.sched.release()
+
+	m.next.ServeHTTP(w, req)
+}
+
+func getKey(reqCtx *middlewares.RequestContext, key corev1.Service_Spec_Config_HTTP_FairQueue_Key) string {
+	info := reqCtx.DownstreamInfo
+	if info == nil {
+		return ""
+	}
+
+	switch key {
+	case corev1.Service_Spec_Config_HTTP_FairQueue_USER:
+		if info.User != nil && info.User.Metadata != nil {
+			return info.User.Metadata.Uid
+		}
+	default:
+		if info.Session != nil && info.Session.Metadata != nil {
+			return info.Session.Metadata.Uid
+		}
+	}
+
+	return ""
+}
+
+// getBand returns the index of the priority band of the request, 0 being the
+// highest priority.
+func (m *middleware) getBand(req *http.Request, reqCtx *middlewares.RequestContext,
+	cfg *corev1.Service_Spec_Config_HTTP_FairQueue_Priority) int {
+	if cfg == nil || len(cfg.Bands) == 0 {
+		return 0
+	}
+
+	bands := cfg.Bands
+	if len(bands) > maxBands {
+		bands = bands[:maxBands]
+	}
+
+	if key := m.getPriorityKey(req, reqCtx, cfg.Key); key != "" {
+		for i, band := range bands {
+			if slices.Contains(band.Values, key) {
+				return i
+			}
+		}
+	}
+
+	if cfg.DefaultBand != "" {
+		for i, band := range bands {
+			if band.Name == cfg.DefaultBand {
+				return i
+			}
+		}
+	}
+
+	return len(bands) - 1
+}
+
+func (m *middleware) getPriorityKey(req *http.Request, reqCtx *middlewares.RequestContext,
+	key *corev1.Service_Spec_Config_HTTP_FairQueue_Priority_Key) string {
+	switch key.GetType().(type) {
+	case *corev1.Service_Spec_Config_HTTP_FairQueue_Priority_Key_Header:
+		return strings.TrimSpace(req.Header.Get(key.GetHeader()))
+	case *corev1.Service_Spec_Config_HTTP_FairQueue_Priority_Key_Eval:
+		if m.celEngine == nil {
+			return ""
+		}
+		val, err := m.celEngine.EvalPolicyString(req.Context(), key.GetEval(), reqCtx.ReqCtxMap)
+		if err != nil {
+			zap.L().Debug("Could not eval priority key", zap.Error(err))
+			return ""
+		}
+		return val
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,406 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package fairqueue
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *scheduler) queued(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := 0
+	for _, b := range s.bands {
+		ret += len(b.queues[key])
+	}
+	return ret
+}
+
+func waitQueued(t *testing.T, s *scheduler, key string, n int) {
+	assert.Eventually(t, func() bool {
+		return s.queued(key) == n
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestScheduler(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		s := newScheduler()
+		assert.Nil(t, s.acquire(ctx, "a", 1, 8, time.Minute))
+
+		admitted := make(chan string, 8)
+		enqueue := func(key string, n int) {
+			go func() {
+				assert.Nil(t, s.acquire(ctx, key, 1, 8, time.Minute))
+				admitted <- key
+			}()
+			waitQueued(t, s, key, n)
+		}
+
+		enqueue("a", 1)
+		enqueue("a", 2)
+		enqueue("a", 3)
+		enqueue("b", 1)
+		enqueue("c", 1)
+
+		var order []string
+		for range 5 {
+			s.release()
+			order = append(order, <-admitted)
+		}
+
+		assert.Equal(t, []string{"a", "b", "c", "a", "a"}, order)
+
+		s.release()
+		assert.Equal(t, 0, s.inflight)
+		assert.Equal(t, 0, len(s.bands[0].order))
+	}
+
+	{
+		s := newScheduler()
+		assert.Nil(t, s.acquire(ctx, "a", 1, 1, time.Minute))
+
+		go s.acquire(ctx, "a", 1, 1, time.Minute)
+		waitQueued(t, s, "a", 1)
+
+		assert.ErrorIs(t, s.acquire(ctx, "a", 1, 1, time.Minute), errQueueFull)
+		assert.ErrorIs(t, s.acquire(ctx, "b", 1, 1, 20*time.Millisecond), errTimeout)
+		assert.Equal(t, 0, s.queued("b"))
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.ErrorIs(t, s.acquire(cctx, "c", 1, 1, time.Minute), context.Canceled)
+		assert.Equal(t, []string{"a"}, s.bands[0].order)
+	}
+
+	{
+		s := newScheduler()
+		assert.Nil(t, s.acquire(ctx, "a", 1, 8, time.Minute))
+
+		done := make(chan error, 1)
+		go func() {
+			done <- s.acquire(ctx, "b", 1, 8, time.Minute)
+		}()
+		waitQueued(t, s, "b", 1)
+
+		// A higher capacity admits the queued requests without waiting for
+		// a release.
+		assert.Nil(t, s.acquire(ctx, "c", 3, 8, time.Minute))
+		assert.Nil(t, <-done)
+		assert.Equal(t, 3, s.inflight)
+	}
+
+	{
+		s := newScheduler()
+		assert.Nil(t, s.acquire(ctx, "a", 1, 8, time.Minute))
+		for i, key := range []string{"a", "a", "b", "c"} {
+			go s.acquire(ctx, key, 1, 8, time.Minute)
+			waitQueued(t, s, key, map[int]int{0: 1, 1: 2, 2: 1, 3: 1}[i])
+		}
+
+		depths, others := s.getDepths(2)
+		assert.Equal(t, 2, len(depths))
+		assert.Equal(t, queueDepth{key: "a", depth: 2}, depths[0])
+		assert.Equal(t, 1, others)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	release := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mdlwr, err := New(ctx, next, nil)
+	assert.Nil(t, err)
+
+	cfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				FairQueue: &corev1.Service_Spec_Config_HTTP_FairQueue{
+					MaxConcurrentRequests: 1,
+					MaxQueueSize:          1,
+					MaxWait: &metav1.Duration{
+						Type: &metav1.Duration_Seconds{
+							Seconds: 5,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	doReq := func(sessionUID string) *httptest.ResponseRecorder {
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt:     time.Now(),
+			ServiceConfig: cfg,
+			DownstreamInfo: &corev1.RequestContext{
+				Session: &corev1.Session{
+					Metadata: &metav1.Metadata{
+						Uid: sessionUID,
+					},
+				},
+			},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw
+	}
+
+	sched := mdlwr.(*middleware).sched
+
+	results := make(chan int, 3)
+	go func() {
+		results <- doReq("s1").Code
+	}()
+	assert.Eventually(t, func() bool {
+		sched.mu.Lock()
+		defer sched.mu.Unlock()
+		return sched.inflight == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	go func() {
+		results <- doReq("s1").Code
+	}()
+	waitQueued(t, sched, "s1", 1)
+
+	go func() {
+		results <- doReq("s2").Code
+	}()
+	waitQueued(t, sched, "s2", 1)
+
+	assert.Equal(t, http.StatusServiceUnavailable, doReq("s1").Code)
+
+	close(release)
+	for range 3 {
+		assert.Equal(t, http.StatusOK, <-results)
+	}
+}
+
+func TestPriority(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		s := newScheduler()
+		assert.Nil(t, s.acquireBand(ctx, 1, "a", 1, 8, time.Minute))
+
+		admitted := make(chan string, 8)
+		enqueue := func(band int, key string, n int) {
+			go func() {
+				assert.Nil(t, s.acquireBand(ctx, band, key, 1, 8, time.Minute))
+				admitted <- key
+			}()
+			waitQueued(t, s, key, n)
+		}
+
+		enqueue(2, "low", 1)
+		enqueue(2, "low", 2)
+		enqueue(1, "mid", 1)
+		enqueue(0, "high1", 1)
+		enqueue(0, "high2", 1)
+		enqueue(0, "high1", 2)
+
+		var order []string
+		for range 6 {
+			s.release()
+			order = append(order, <-admitted)
+		}
+
+		// The bands are served in a strict priority order while the keys
+		// within a band are still served round-robin.
+		assert.Equal(t, []string{"high1", "high2", "high1", "mid", "low", "low"}, order)
+
+		s.release()
+		assert.Equal(t, 0, s.inflight)
+		assert.Equal(t, 0, s.numQueued)
+	}
+
+	{
+		s := newScheduler()
+		assert.Nil(t, s.acquireBand(ctx, 0, "a", 1, 8, time.Minute))
+		assert.ErrorIs(t, s.acquireBand(ctx, 3, "b", 1, 8, 20*time.Millisecond), errTimeout)
+		assert.Equal(t, 0, s.numQueued)
+
+		go s.acquireBand(ctx, 100, "c", 1, 8, time.Minute)
+		waitQueued(t, s, "c", 1)
+		assert.Equal(t, maxBands, len(s.bands))
+	}
+
+	release := make(chan struct{})
+	served := make(chan string, 8)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		served <- r.Header.Get("X-Priority")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mdlwr, err := New(ctx, next, nil)
+	assert.Nil(t, err)
+
+	cfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				FairQueue: &corev1.Service_Spec_Config_HTTP_FairQueue{
+					MaxConcurrentRequests: 1,
+					Priority: &corev1.Service_Spec_Config_HTTP_FairQueue_Priority{
+						Key: &corev1.Service_Spec_Config_HTTP_FairQueue_Priority_Key{
+							Type: &corev1.Service_Spec_Config_HTTP_FairQueue_Priority_Key_Header{
+								Header: "X-Priority",
+							},
+						},
+						Bands: []*corev1.Service_Spec_Config_HTTP_FairQueue_Priority_Band{
+							{
+								Name:   "critical",
+								Values: []string{"critical"},
+							},
+							{
+								Name:   "normal",
+								Values: []string{"normal"},
+							},
+							{
+								Name:   "batch",
+								Values: []string{"batch"},
+							},
+						},
+						DefaultBand: "normal",
+					},
+				},
+			},
+		},
+	}
+
+	m := mdlwr.(*middleware)
+	{
+		for _, tstCase := range []struct {
+			priority string
+			expected int
+		}{
+			{"critical", 0},
+			{"normal", 1},
+			{"batch", 2},
+			{"", 1},
+			{"unknown", 1},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+			req.Header.Set("X-Priority", tstCase.priority)
+			assert.Equal(t, tstCase.expected,
+				m.getBand(req, &middlewares.RequestContext{}, cfg.GetHttp().FairQueue.Priority), "%+v", tstCase)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		assert.Equal(t, 2, m.getBand(req, &middlewares.RequestContext{},
+			&corev1.Service_Spec_Config_HTTP_FairQueue_Priority{
+				Bands: cfg.GetHttp().FairQueue.Priority.Bands,
+			}))
+		assert.Equal(t, 0, m.getBand(req, &middlewares.RequestContext{}, nil))
+	}
+
+	doReq := func(sessionUID, priority string) int {
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt:     time.Now(),
+			ServiceConfig: cfg,
+			DownstreamInfo: &corev1.RequestContext{
+				Session: &corev1.Session{
+					Metadata: &metav1.Metadata{
+						Uid: sessionUID,
+					},
+				},
+			},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.Header.Set("X-Priority", priority)
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	results := make(chan int, 8)
+	go func() {
+		results <- doReq("s0", "first")
+	}()
+	assert.Eventually(t, func() bool {
+		m.sched.mu.Lock()
+		defer m.sched.mu.Unlock()
+		return m.sched.inflight == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// The queue is saturated and the low priority requests are queued before
+	// the high priority ones.
+	for i, priority := range []string{"batch", "batch", "normal", "critical"} {
+		sessionUID := fmt.Sprintf("s%d", i+1)
+		go func() {
+			results <- doReq(sessionUID, priority)
+		}()
+		waitQueued(t, m.sched, sessionUID, 1)
+	}
+
+	var order []string
+	for range 5 {
+		release <- struct{}{}
+		order = append(order, <-served)
+	}
+	for range 5 {
+		assert.Equal(t, http.StatusOK, <-results)
+	}
+
+	assert.Equal(t, []string{"first", "critical", "normal", "batch", "batch"}, order)
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package fairqueue
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errQueueFull = errors.New("Queue is full")
+	errTimeout   = errors.New("Queue wait timeout")
+)
+
+// maxBands is the maximum number of priority bands.
+const maxBands = 8
+
+type waiter struct {
+	ch      chan struct{}
+	granted bool
+}
+
+// band holds the per-key queues of a priority band. The keys are served
+// round-robin so that every key gets its turn regardless of how many requests
+// the other keys have queued.
+type band struct {
+	queues map[string][]*waiter
+	// order is the round-robin ring of the keys that have queued requests.
+	order []string
+	next  int
+}
+
+func newBand() *band {
+	return &band{
+		queues: make(map[string][]*waiter),
+	}
+}
+
+// scheduler admits up to maxConcurrent requests at a time. The excess requests
+// wait in their priority band and the bands are served in a strict priority
+// order, band 0 being the highest priority.
+type scheduler struct {
+	mu            sync.Mutex
+	maxConcurrent int
+	inflight      int
+	bands         []*band
+	numQueued     int
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		bands: []*band{newBand()},
+	}
+}
+
+func (s *scheduler) acquire(ctx context.Context, key string,
+	maxConcurrent, maxQueueSize int, maxWait time.Duration) error {
+	return s.acquireBand(ctx, 0, key, maxConcurrent, maxQueueSize, maxWait)
+}
+
+func (s *scheduler) acquireBand(ctx context.Context, bandIdx int, key string,
+	maxConcurrent, maxQueueSize int, maxWait time.Duration) error {
+	bandIdx = max(0, min(bandIdx, maxBands-1))
+
+	s.mu.Lock()
+
+	s.maxConcurrent = maxConcurrent
+	if s.inflight < s.maxConcurrent && s.numQueued == 0 {
+		s.inflight++
+		s.mu.Unlock()
+		return nil
+	}
+
+	for len(s.bands) <= bandIdx {
+		s.bands = append(s.bands, newBand())
+	}
+	b := s.bands[bandIdx]
+
+	queue, ok := b.queues[key]
+	if len(queue) >= maxQueueSize {
+		s.mu.Unlock()
+		return errQueueFull
+	}
+
+	w := &waiter{
+		ch: make(chan struct{}),
+	}
+	b.queues[key] = append(queue, w)
+	if !ok {
+		b.order = append(b.order, key)
+	}
+	s.numQueued++
+	// Admit the queued requests right away in case the capacity has been
+	// increased by a config update.
+	s.dispatchLocked()
+	s.mu.Unlock()
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ch:
+		return nil
+	case <-timer.C:
+		err = errTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if w.granted {
+		s.releaseLocked()
+	} else {
+		s.removeLocked(b, key, w)
+	}
+
+	return err
+}
+
+func (s *scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+func (s *scheduler) releaseLocked() {
+	s.inflight--
+	s.dispatchLocked()
+}
+
+func (s *scheduler) dispatchLocked() {
+	for s.inflight < s.maxConcurrent && s.numQueued > 0 {
+		idx := slices.IndexFunc(s.bands, func(b *band) bool {
+			return len(b.order) > 0
+		})
+		if idx < 0 {
+			return
+		}
+
+		s.bands[idx].pop().grant()
+		s.numQueued--
+		s.inflight++
+	}
+}
+
+func (w *waiter) grant() {
+	w.granted = true
+	close(w.ch)
+}
+
+// pop removes the next waiter of the band in the round-robin order.
+func (b *band) pop() *waiter {
+	if b.next >= len(b.order) {
+		b.next = 0
+	}
+
+	key := b.order[b.next]
+	queue := b.queues[key]
+
+	w := queue[0]
+	queue[0] = nil
+	if len(queue) == 1 {
+		b.deleteKey(key)
+	} else {
+		b.queues[key] = queue[1:]
+		b.next++
+	}
+
+	return w
+}
+
+func (s *scheduler) removeLocked(b *band, key string, w *waiter) {
+	queue := b.queues[key]
+	idx := slices.Index(queue, w)
+	if idx < 0 {
+		return
+	}
+
+	s.numQueued--
+
+	if len(queue) == 1 {
+		b.deleteKey(key)
+		return
+	}
+
+	b.queues[key] = slices.Delete(queue, idx, idx+1)
+}
+
+func (b *band) deleteKey(key string) {
+	delete(b.queues, key)
+
+	idx := slices.Index(b.order, key)
+	if idx < 0 {
+		return
+	}
+
+	b.order = slices.Delete(b.order, idx, idx+1)
+	if idx < b.next {
+		b.next--
+	}
+}
+
+type queueDepth struct {
+	key   string
+	depth int
+}
+
+// getDepths returns the depths of the deepest maxKeys queues as well as the
+// total depth of the remaining ones.
+func (s *scheduler) getDepths(maxKeys int) ([]queueDepth, int) {
+	s.mu.Lock()
+	depths := make(map[string]int)
+	for _, b := range s.bands {
+		for key, queue := range b.queues {
+			depths[key] += len(queue)
+		}
+	}
+	s.mu.Unlock()
+
+	ret := make([]queueDepth, 0, len(depths))
+	for key, depth := range depths {
+		ret = append(ret, queueDepth{
+			key:   key,
+			depth: depth,
+		})
+	}
+
+	slices.SortFunc(ret, func(a, b queueDepth) int {
+		return b.depth - a.depth
+	})
+
+	if len(ret) <= maxKeys {
+		return ret, 0
+	}
+
+	others := 0
+	for _, itm := range ret[maxKeys:] {
+		others += itm.depth
+	}
+
+	return ret[:maxKeys], others
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package faultinjection
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	headerFault = "X-Octelium-Fault"
+
+	defaultStatusCode = http.StatusServiceUnavailable
+	defaultGRPCCode   = 14
+)
+
+type middleware struct {
+	next     http.Handler
+	injected metric.Int64Counter
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	ret := &middleware{
+		next: next,
+	}
+
+	var err error
+	ret.injected, err = otelutils.GetMeter().Int64Counter(metricutils.GetKey("http.faults.injected"),
+		metric.WithDescription("Total number of faults injected into the requests"))
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig.GetHttp().GetFaultInjection()
+	if cfg == nil || !cfg.IsEnabled {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	doDelay, doAbort := getFaults(cfg, req.Header)
+	req.Header.Del(headerFault)
+
+	if doDelay {
+		m.injected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("type", "delay")))
+
+		timer := time.NewTimer(umetav1.ToDuration(cfg.Delay.Duration).ToGo())
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return
+		}
+	}
+
+	if doAbort {
+		m.injected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("type", "abort")))
+		zap.L().Debug("Aborting request by fault injection", zap.String("path", req.URL.Path))
+
+		if ucorev1.ToService(reqCtx.Service).IsGRPC() {
+			writeGRPCStatus(w, getGRPCCode(cfg.Abort))
+		} else {
+			w.WriteHeader(getStatusCode(cfg.Abort))
+		}
+		return
+	}
+
+	m.next.ServeHTTP(w, req)
+}
+
+// getFaults returns whether the request is delayed and whether it is aborted.
+// The header override, if allowed, takes precedence over the sampling so that
+// the faults can be targeted at specific requests.
+func getFaults(cfg *corev1.Service_Spec_Config_HTTP_FaultInjection, hdr http.Header) (bool, bool) {
+	hasDelay := cfg.Delay != nil && umetav1.ToDuration(cfg.Delay.Duration).ToGo() > 0
+	hasAbort := cfg.Abort != nil
+
+	if cfg.AllowHeaderOverride {
+		if val := hdr.Get(headerFault); val != "" {
+			var doDelay, doAbort bool
+			for _, itm := range strings.Split(val, ",") {
+				switch strings.ToLower(strings.TrimSpace(itm)) {
+				case "delay":
+					doDelay = hasDelay
+				case "abort":
+					doAbort = hasAbort
+				}
+			}
+			return doDelay, doAbort
+		}
+	}
+
+	return hasDelay && isSampled(cfg.Delay.SampleRate),
+		hasAbort && isSampled(cfg.Abort.SampleRate)
+}
+
+func isSampled(rate float32) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+
+	return rand.Float32() < rate
+}
+
+func getStatusCode(cfg *corev1.Service_Spec_Config_HTTP_FaultInjection_Abort) int {
+	if cfg.StatusCode >= 200 && cfg.StatusCode < 600 {
+		return int(cfg.StatusCode)
+	}
+
+	return defaultStatusCode
+}
+
+func getGRPCCode(cfg *corev1.Service_Spec_Config_HTTP_FaultInjection_Abort) int {
+	if cfg.GrpcCode > 0 && cfg.GrpcCode <= 16 {
+		return int(cfg.GrpcCode)
+	}
+
+	return defaultGRPCCode
+}
+
+// writeGRPCStatus writes a trailers-only gRPC response.
+func writeGRPCStatus(w http.ResponseWriter, code int) {
+	hdr := w.Header()
+	hdr.Set("Content-Type", "application/grpc")
+	hdr.Set("Grpc-Status", strconv.Itoa(code))
+	hdr.Set("Grpc-Message", "fault injected")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package faultinjection
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var reachedHdr http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reachedHdr = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	doReq := func(mode corev1.Service_Spec_Mode,
+		cfg *corev1.Service_Spec_Config_HTTP_FaultInjection, fault string) (*httptest.ResponseRecorder, time.Duration) {
+		reachedHdr = nil
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		if fault != "" {
+			req.Header.Set(headerFault, fault)
+		}
+
+		svcCfg := &corev1.Service_Spec_Config{
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					FaultInjection: cfg,
+				},
+			},
+		}
+
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service: &corev1.Service{
+					Spec: &corev1.Service_Spec{
+						Mode:   mode,
+						Config: svcCfg,
+					},
+				},
+				ServiceConfig: svcCfg,
+			}))
+
+		rw := httptest.NewRecorder()
+		startedAt := time.Now()
+		mdlwr.ServeHTTP(rw, req)
+		return rw, time.Since(startedAt)
+	}
+
+	{
+		rw, _ := doReq(corev1.Service_Spec_HTTP, nil, "abort")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "abort", reachedHdr.Get(headerFault))
+	}
+
+	{
+		rw, _ := doReq(corev1.Service_Spec_HTTP, &corev1.Service_Spec_Config_HTTP_FaultInjection{
+			IsEnabled: false,
+			Abort:     &corev1.Service_Spec_Config_HTTP_FaultInjection_Abort{},
+		}, "")
+		assert.Equal(t, http.StatusOK, rw.Code)
+	}
+
+	{
+		rw, _ := doReq(corev1.Service_Spec_HTTP, &corev1.Service_Spec_Config_HTTP_FaultInjection{
+			IsEnabled: true,
+			Abort: &corev1.Service_Spec_Config_HTTP_FaultInjection_Abort{
+				StatusCode: 429,
+			},
+		}, "")
+		assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+		assert.Nil(t, reachedHdr)
+	}
+
+	{
+		rw, _ := doReq(corev1.Service_Spec_GRPC, &corev1.Service_Spec_Config_HTTP_FaultInjection{
+			IsEnabled: true,
+			Abort: &corev1.Service_Spec_Config_HTTP_FaultInjection_Abort{
+				GrpcCode: 4,
+			},
+		}, "")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "4", rw.Header().Get("Grpc-Status"))
+		assert.Equal(t, "application/grpc", rw.Header().Get("Content-Type"))
+		assert.Nil(t, reachedHdr)
+	}
+
+	{
+		rw, elapsed := doReq(corev1.Service_Spec_HTTP, &corev1.Service_Spec_Config_HTTP_FaultInjection{
+			IsEnabled: true,
+			Delay: &corev1.Service_Spec_Config_HTTP_FaultInjection_Delay{
+				Duration: &metav1.Duration{
+					Type: &metav1.Duration_Milliseconds{
+						Milliseconds: 200,
+					},
+				},
+			},
+		}, "")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, elapsed >= 200*time.Millisecond)
+	}
+
+	overrideCfg := &corev1.Service_Spec_Config_HTTP_FaultInjection{
+		IsEnabled:           true,
+		AllowHeaderOverride: true,
+		Delay: &corev1.Service_Spec_Config_HTTP_FaultInjection_Delay{
+			Duration: &metav1.Duration{
+				Type: &metav1.Duration_Milliseconds{
+					Milliseconds: 200,
+				},
+			},
+		},
+		Abort: &corev1.Service_Spec_Config_HTTP_FaultInjection_Abort{},
+	}
+
+	{
+		rw, elapsed := doReq(corev1.Service_Spec_HTTP, overrideCfg, "none")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, elapsed < 200*time.Millisecond)
+		assert.NotNil(t, reachedHdr)
+		assert.Equal(t, "", reachedHdr.Get(headerFault))
+	}
+
+	{
+		rw, elapsed := doReq(corev1.Service_Spec_HTTP, overrideCfg, "Delay, abort")
+		assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+		assert.True(t, elapsed >= 200*time.Millisecond)
+		assert.Nil(t, reachedHdr)
+	}
+
+	{
+		rw, elapsed := doReq(corev1.Service_Spec_HTTP, overrideCfg, "abort")
+		assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+		assert.True(t, elapsed < 200*time.Millisecond)
+	}
+
+	{
+		cfg := &corev1.Service_Spec_Config_HTTP_FaultInjection{
+			IsEnabled: true,
+			Abort: &corev1.Service_Spec_Config_HTTP_FaultInjection_Abort{
+				SampleRate: 0.5,
+			},
+		}
+
+		var aborted int
+		for range 1000 {
+			rw, _ := doReq(corev1.Service_Spec_HTTP, cfg, "abort")
+			if rw.Code == http.StatusServiceUnavailable {
+				aborted++
+			}
+		}
+		assert.True(t, aborted > 350 && aborted < 650, "%d", aborted)
+	}
+}
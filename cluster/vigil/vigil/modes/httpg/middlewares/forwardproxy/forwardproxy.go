@@ -0,0 +1,433 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package forwardproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxConnections = 1024
+	defaultIdleTimeout    = 5 * time.Minute
+	defaultMaxDuration    = 1 * time.Hour
+	defaultDialTimeout    = 10 * time.Second
+)
+
+var errDestinationNotAllowed = errors.New("destination address is not allowed")
+
+// nonPublicPrefixes are the ranges, besides the loopback, link-local,
+// private, multicast and unspecified addresses, that the destinations cannot
+// be connected to unless explicitly allowed.
+var nonPublicPrefixes = []netip.Prefix{
+	// The shared address space, which includes the default Cluster network.
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+type middleware struct {
+	next   http.Handler
+	active atomic.Int64
+
+	activeTunnels metric.Int64UpDownCounter
+	tunnelBytes   metric.Int64Counter
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	ret := &middleware{
+		next: next,
+	}
+
+	meter := otelutils.GetMeter()
+
+	var err error
+	ret.activeTunnels, err = meter.Int64UpDownCounter(metricutils.GetKey("http.connect.active"),
+		metric.WithDescription("Number of active CONNECT tunnels"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret.tunnelBytes, err = meter.Int64Counter(metricutils.GetKey("http.connect.bytes"),
+		metric.WithUnit("By"), metric.WithDescription("Total number of bytes transferred by CONNECT tunnels"))
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodConnect {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	svcCfg := reqCtx.ServiceConfig
+	if svcCfg == nil || svcCfg.GetHttp() == nil || svcCfg.GetHttp().ForwardProxy == nil ||
+		!svcCfg.GetHttp().ForwardProxy.IsEnabled {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	cfg := svcCfg.GetHttp().ForwardProxy
+
+	dest, ok := getDestination(req)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !isAllowedDestination(cfg.AllowedHosts, dest) {
+		zap.L().Debug("CONNECT destination is not allowed", zap.String("destination", dest))
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	maxConnections := int64(defaultMaxConnections)
+	if cfg.MaxConnections > 0 {
+		maxConnections = int64(cfg.MaxConnections)
+	}
+	if m.active.Add(1) > maxConnections {
+		m.active.Add(-1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	defer m.active.Add(-1)
+
+	dialTimeout := defaultDialTimeout
+	if timeoutCfg := svcCfg.GetHttp().Timeout; timeoutCfg != nil {
+		if val := umetav1.ToDuration(timeoutCfg.Connect).ToGo(); val > 0 {
+			dialTimeout = val
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+		Control: getDialControl(cfg.AllowedCIDRs),
+	}
+	upstreamConn, err := dialer.DialContext(req.Context(), "tcp", dest)
+	if err != nil {
+		zap.L().Debug("Could not dial CONNECT destination", zap.String("destination", dest), zap.Error(err))
+		if errors.Is(err, errDestinationNotAllowed) {
+			w.WriteHeader(http.StatusForbidden)
+		} else {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		return
+	}
+	defer upstreamConn.Close()
+
+	clientConn, err := m.getClientConn(w, req)
+	if err != nil {
+		zap.L().Debug("Could not get CONNECT client conn", zap.Error(err))
+		return
+	}
+	defer clientConn.Close()
+
+	var attrs attribute.Set
+	if svc := reqCtx.Service; svc != nil && svc.Metadata != nil && svc.Status != nil &&
+		svc.Status.NamespaceRef != nil && svc.Status.RegionRef != nil {
+		attrs = metricutils.GetServiceAttributes(reqCtx.Service)
+	}
+
+	m.activeTunnels.Add(context.Background(), 1, metric.WithAttributeSet(attrs))
+	defer m.activeTunnels.Add(context.Background(), -1, metric.WithAttributeSet(attrs))
+
+	t := &tunnel{
+		idleTimeout: defaultIdleTimeout,
+		maxDuration: defaultMaxDuration,
+	}
+	if val := umetav1.ToDuration(cfg.IdleTimeout).ToGo(); val > 0 {
+		t.idleTimeout = val
+	}
+	if val := umetav1.ToDuration(cfg.MaxDuration).ToGo(); val > 0 {
+		t.maxDuration = val
+	}
+
+	t.run(clientConn, upstreamConn)
+
+	reqCtx.Tunnel = &middlewares.TunnelInfo{
+		Destination:   dest,
+		ReceivedBytes: uint64(t.recvBytes.Load()),
+		SentBytes:     uint64(t.sentBytes.Load()),
+	}
+
+	m.tunnelBytes.Add(context.Background(), t.recvBytes.Load(),
+		metric.WithAttributeSet(attrs), metric.WithAttributes(attribute.String("direction", "received")))
+	m.tunnelBytes.Add(context.Background(), t.sentBytes.Load(),
+		metric.WithAttributeSet(attrs), metric.WithAttributes(attribute.String("direction", "sent")))
+
+	zap.L().Debug("CONNECT tunnel closed",
+		zap.String("destination", dest),
+		zap.Int64("received", t.recvBytes.Load()),
+		zap.Int64("sent", t.sentBytes.Load()))
+}
+
+// getClientConn returns the client side of the tunnel after responding with
+// 200 to the CONNECT request. HTTP/1.x connections are hijacked whereas
+// HTTP/2 streams are used in full-duplex.
+func (m *middleware) getClientConn(w http.ResponseWriter, req *http.Request) (tunnelConn, error) {
+	if req.ProtoMajor == 1 {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return &hijackedConn{
+			Conn: conn,
+			r:    brw.Reader,
+		}, nil
+	}
+
+	rc := http.NewResponseController(w)
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+
+	return &streamConn{
+		body: req.Body,
+		w:    w,
+		rc:   rc,
+	}, nil
+}
+
+func getDestination(req *http.Request) (string, bool) {
+	dest := req.Host
+	if dest == "" && req.URL != nil {
+		dest = req.URL.Host
+	}
+
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil || host == "" || port == "" {
+		return "", false
+	}
+
+	return net.JoinHostPort(strings.ToLower(host), port), true
+}
+
+func isAllowedDestination(allowedHosts []string, dest string) bool {
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+
+		allowedHost, allowedPort := allowed, "443"
+		if h, p, err := net.SplitHostPort(allowed); err == nil {
+			allowedHost, allowedPort = h, p
+		}
+
+		if allowedPort != "*" && allowedPort != port {
+			continue
+		}
+
+		if suffix, ok := strings.CutPrefix(allowedHost, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+
+		if allowedHost == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getDialControl returns the dialer Control that checks the address that
+// the destination actually resolves to since the allowed hosts only restrict
+// the names. Otherwise, an allowed name resolving to e.g. a loopback or a
+// Cluster address would tunnel the clients into the Cluster.
+func getDialControl(allowedCIDRs []string) func(network, address string, c syscall.RawConn) error {
+	var allowed []netip.Prefix
+	for _, cidr := range allowedCIDRs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			continue
+		}
+		allowed = append(allowed, prefix.Masked())
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return errDestinationNotAllowed
+		}
+
+		if !isAllowedAddr(addrPort.Addr().Unmap(), allowed) {
+			zap.L().Debug("CONNECT destination address is not allowed", zap.String("address", address))
+			return errDestinationNotAllowed
+		}
+
+		return nil
+	}
+}
+
+func isAllowedAddr(addr netip.Addr, allowed []netip.Prefix) bool {
+	for _, prefix := range allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type tunnelConn interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+}
+
+type hijackedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *hijackedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+type streamConn struct {
+	body io.ReadCloser
+	w    io.Writer
+	rc   *http.ResponseController
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	return c.body.Read(p)
+}
+
+func (c *streamConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.rc.Flush()
+}
+
+func (c *streamConn) Close() error {
+	return c.body.Close()
+}
+
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	return c.rc.SetReadDeadline(t)
+}
+
+type tunnel struct {
+	idleTimeout time.Duration
+	maxDuration time.Duration
+
+	lastActivity atomic.Int64
+	recvBytes    atomic.Int64
+	sentBytes    atomic.Int64
+
+	closeOnce sync.Once
+	closeFn   func()
+}
+
+func (t *tunnel) run(clientConn tunnelConn, upstreamConn net.Conn) {
+	t.closeFn = func() {
+		clientConn.Close()
+		upstreamConn.Close()
+	}
+	t.lastActivity.Store(time.Now().UnixNano())
+
+	timer := time.AfterFunc(t.maxDuration, t.close)
+	defer timer.Stop()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		t.copy(upstreamConn, clientConn, &t.recvBytes)
+	}()
+	go func() {
+		defer wg.Done()
+		t.copy(clientConn, upstreamConn, &t.sentBytes)
+	}()
+	wg.Wait()
+}
+
+func (t *tunnel) close() {
+	t.closeOnce.Do(t.closeFn)
+}
+
+// copy copies from src to dst until either side is closed or the tunnel has
+// been idle, in both directions, for the idle timeout.
+func (t *tunnel) copy(dst io.Writer, src tunnelConn, counter *atomic.Int64) {
+	defer t.close()
+
+	buf := make([]byte, 32*1024)
+	for {
+		src.SetReadDeadline(time.Now().Add(t.idleTimeout))
+		n, err := src.Read(buf)
+		if n > 0 {
+			t.lastActivity.Store(time.Now().UnixNano())
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+			counter.Add(int64(n))
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() &&
+				time.Since(time.Unix(0, t.lastActivity.Load())) < t.idleTimeout {
+				continue
+			}
+			return
+		}
+	}
+}
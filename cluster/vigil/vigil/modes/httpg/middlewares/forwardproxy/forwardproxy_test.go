@@ -0,0 +1,265 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package forwardproxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAllowedDestination(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	allowed := []string{
+		"example.com",
+		"*.example.org",
+		"api.example.net:8443",
+		"internal.local:*",
+	}
+
+	valids := []string{
+		"example.com:443",
+		"a.example.org:443",
+		"a.b.example.org:443",
+		"api.example.net:8443",
+		"internal.local:22",
+		"internal.local:443",
+	}
+	for _, dest := range valids {
+		assert.True(t, isAllowedDestination(allowed, dest), "%s", dest)
+	}
+
+	invalids := []string{
+		"example.com:80",
+		"a.example.com:443",
+		"example.org:443",
+		"api.example.net:443",
+		"other.local:22",
+		"example.com",
+	}
+	for _, dest := range invalids {
+		assert.False(t, isAllowedDestination(allowed, dest), "%s", dest)
+	}
+
+	assert.False(t, isAllowedDestination(nil, "example.com:443"))
+}
+
+func TestIsAllowedAddr(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	allowed := []netip.Prefix{
+		netip.MustParsePrefix("10.1.0.0/16"),
+	}
+
+	valids := []string{
+		"93.184.216.34",
+		"2606:2800:220:1:248:1893:25c8:1946",
+		"10.1.2.3",
+	}
+	for _, addr := range valids {
+		assert.True(t, isAllowedAddr(netip.MustParseAddr(addr), allowed), "%s", addr)
+	}
+
+	invalids := []string{
+		"127.0.0.1",
+		"::1",
+		"169.254.169.254",
+		"fe80::1",
+		"10.2.0.1",
+		"172.16.0.1",
+		"192.168.1.1",
+		"fd00::1",
+		"100.64.0.1",
+		"0.0.0.0",
+		"::",
+		"224.0.0.1",
+	}
+	for _, addr := range invalids {
+		assert.False(t, isAllowedAddr(netip.MustParseAddr(addr), allowed), "%s", addr)
+	}
+
+	{
+		control := getDialControl([]string{"invalid", "192.168.0.0/16"})
+		assert.Nil(t, control("tcp4", "192.168.1.1:443", nil))
+		assert.Nil(t, control("tcp4", "93.184.216.34:443", nil))
+		assert.ErrorIs(t, control("tcp4", "127.0.0.1:443", nil), errDestinationNotAllowed)
+		assert.ErrorIs(t, control("tcp6", "[::ffff:127.0.0.1]:443", nil), errDestinationNotAllowed)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		upstream.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	_, upstreamPort, _ := net.SplitHostPort(upstream.Addr().String())
+
+	isNextCalled := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isNextCalled = true
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	var allowedCIDRs atomic.Pointer[[]string]
+	allowedCIDRs.Store(&[]string{"127.0.0.0/8"})
+
+	tunnelCh := make(chan *middlewares.TunnelInfo, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			ServiceConfig: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: &corev1.Service_Spec_Config_HTTP{
+						ForwardProxy: &corev1.Service_Spec_Config_HTTP_ForwardProxy{
+							IsEnabled: true,
+							AllowedHosts: []string{
+								fmt.Sprintf("127.0.0.1:%s", upstreamPort),
+								fmt.Sprintf("localhost:%s", upstreamPort),
+							},
+							AllowedCIDRs: *allowedCIDRs.Load(),
+						},
+					},
+				},
+			},
+		}
+
+		mdlwr.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middlewares.CtxRequestContext, reqCtx)))
+		if r.Method == http.MethodConnect {
+			tunnelCh <- reqCtx.Tunnel
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	doConnect := func(dest string) (net.Conn, *bufio.Reader, *http.Response) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		assert.Nil(t, err)
+
+		_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", dest, dest)
+		assert.Nil(t, err)
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+		assert.Nil(t, err)
+		return conn, br, resp
+	}
+
+	{
+		conn, br, resp := doConnect(fmt.Sprintf("127.0.0.1:%s", upstreamPort))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		_, err = conn.Write([]byte("hello"))
+		assert.Nil(t, err)
+
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(br, buf)
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(buf))
+		conn.Close()
+
+		select {
+		case info := <-tunnelCh:
+			assert.NotNil(t, info)
+			assert.Equal(t, fmt.Sprintf("127.0.0.1:%s", upstreamPort), info.Destination)
+			assert.Equal(t, uint64(5), info.ReceivedBytes)
+			assert.Equal(t, uint64(5), info.SentBytes)
+		case <-time.After(5 * time.Second):
+			t.Fatal("tunnel was not closed")
+		}
+	}
+
+	{
+		conn, _, resp := doConnect("example.com:443")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		conn.Close()
+		<-tunnelCh
+	}
+
+	{
+		// The allowed names resolving to non-public addresses are rejected
+		// unless their addresses are explicitly allowed.
+		allowedCIDRs.Store(&[]string{"10.0.0.0/8"})
+
+		for _, dest := range []string{
+			fmt.Sprintf("127.0.0.1:%s", upstreamPort),
+			fmt.Sprintf("localhost:%s", upstreamPort),
+		} {
+			conn, _, resp := doConnect(dest)
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s", dest)
+			conn.Close()
+			<-tunnelCh
+		}
+
+		allowedCIDRs.Store(&[]string{"127.0.0.1/32"})
+	}
+
+	{
+		resp, err := http.Get(srv.URL)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.True(t, isNextCalled)
+	}
+}
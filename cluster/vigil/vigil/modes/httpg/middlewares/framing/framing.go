@@ -0,0 +1,254 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package framing
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxLineSize is the maximum size of an inspected line. Longer lines stop
+	// the inspection of the connection and are left to the net/http server
+	// which enforces its own header size limits.
+	maxLineSize = 64 * 1024
+
+	reasonConflict            = "conflict"
+	reasonHTTP10Chunked       = "http10TransferEncoding"
+	reasonObsoleteLineFolding = "obsoleteLineFolding"
+)
+
+type state int
+
+const (
+	stateRequestLine state = iota
+	stateHeaders
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateChunkDataEnd
+	stateTrailers
+
+	// statePassthrough stops the inspection, e.g. if the stream cannot be
+	// parsed, in which case the net/http server rejects the request itself.
+	// The connections that switch to another protocol are no longer
+	// inspected once hijacked, see ConnState.
+	statePassthrough
+)
+
+// inspector incrementally parses the HTTP/1.x requests read from a
+// connection to detect the requests whose framing is ambiguous before they
+// are read by the net/http server. The net/http server itself accepts the
+// requests that contain both Content-Length and Transfer-Encoding by
+// silently dropping the Content-Length which, as per RFC 9112, might
+// indicate an attempt to perform request smuggling.
+type inspector struct {
+	allowAmbiguous func() bool
+
+	state     state
+	line      []byte
+	remaining uint64
+
+	isHTTP10         bool
+	isObsFold        bool
+	contentLengths   []string
+	transferEncoding []string
+}
+
+// inspect parses the next read bytes. If an ambiguous request is found, the
+// rejection reason is returned along with the offset in b at which that
+// request starts.
+func (i *inspector) inspect(b []byte) (int, string) {
+	reqStart := 0
+
+	for pos := 0; pos < len(b); {
+		switch i.state {
+		case statePassthrough:
+			return 0, ""
+		case stateBody, stateChunkData:
+			n := min(i.remaining, uint64(len(b)-pos))
+			pos += int(n)
+			i.remaining -= n
+			if i.remaining == 0 {
+				if i.state == stateBody {
+					i.nextRequest()
+				} else {
+					i.state = stateChunkDataEnd
+				}
+			}
+			continue
+		}
+
+		if i.state == stateRequestLine && len(i.line) == 0 {
+			reqStart = pos
+		}
+
+		idx := bytes.IndexByte(b[pos:], '\n')
+		if idx < 0 {
+			i.line = append(i.line, b[pos:]...)
+			if len(i.line) > maxLineSize {
+				i.passthrough()
+			}
+			return 0, ""
+		}
+
+		i.line = append(i.line, b[pos:pos+idx]...)
+		pos += idx + 1
+		if len(i.line) > maxLineSize {
+			i.passthrough()
+			return 0, ""
+		}
+
+		line := bytes.TrimSuffix(i.line, []byte("\r"))
+		reason := i.processLine(line)
+		i.line = i.line[:0]
+		if reason != "" {
+			i.passthrough()
+			return reqStart, reason
+		}
+	}
+
+	return 0, ""
+}
+
+func (i *inspector) processLine(line []byte) string {
+	switch i.state {
+	case stateRequestLine:
+		if len(line) == 0 {
+			return ""
+		}
+
+		_, rest, _ := strings.Cut(string(line), " ")
+		_, proto, _ := strings.Cut(rest, " ")
+		switch proto {
+		case "HTTP/1.1", "HTTP/1.0":
+		default:
+			// This includes the HTTP/2 connection preface.
+			i.passthrough()
+			return ""
+		}
+
+		i.isHTTP10 = proto == "HTTP/1.0"
+		i.isObsFold = false
+		i.contentLengths = nil
+		i.transferEncoding = nil
+		i.state = stateHeaders
+	case stateHeaders:
+		if len(line) == 0 {
+			return i.endHeaders()
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			i.isObsFold = true
+			return ""
+		}
+
+		name, value, _ := strings.Cut(string(line), ":")
+		value = strings.Trim(value, " \t")
+		switch {
+		case strings.EqualFold(name, "Content-Length"):
+			i.contentLengths = append(i.contentLengths, value)
+		case strings.EqualFold(name, "Transfer-Encoding"):
+			i.transferEncoding = append(i.transferEncoding, value)
+		}
+	case stateChunkSize:
+		size, _, _ := strings.Cut(string(line), ";")
+		n, err := strconv.ParseUint(strings.Trim(size, " \t"), 16, 63)
+		if err != nil {
+			i.passthrough()
+			return ""
+		}
+		if n == 0 {
+			i.state = stateTrailers
+			return ""
+		}
+		i.remaining = n
+		i.state = stateChunkData
+	case stateChunkDataEnd:
+		if len(line) != 0 {
+			i.passthrough()
+			return ""
+		}
+		i.state = stateChunkSize
+	case stateTrailers:
+		if len(line) == 0 {
+			i.nextRequest()
+		}
+	}
+
+	return ""
+}
+
+// endHeaders checks the framing of the request and sets the state according
+// to its body the same way the net/http server reads it.
+func (i *inspector) endHeaders() string {
+	if i.allowAmbiguous == nil || !i.allowAmbiguous() {
+		switch {
+		case i.isObsFold:
+			return reasonObsoleteLineFolding
+		case len(i.transferEncoding) > 0 && i.isHTTP10:
+			// HTTP/1.0 requests are read according to their Content-Length
+			// regardless of their Transfer-Encoding.
+			return reasonHTTP10Chunked
+		case len(i.transferEncoding) > 0 && len(i.contentLengths) > 0:
+			return reasonConflict
+		}
+	}
+
+	switch {
+	case len(i.transferEncoding) > 0 && !i.isHTTP10:
+		if len(i.transferEncoding) != 1 || !strings.EqualFold(i.transferEncoding[0], "chunked") {
+			// Rejected by the net/http server as an unsupported encoding.
+			i.passthrough()
+			return ""
+		}
+		i.state = stateChunkSize
+	case len(i.contentLengths) > 0:
+		for _, val := range i.contentLengths[1:] {
+			if val != i.contentLengths[0] {
+				i.passthrough()
+				return ""
+			}
+		}
+
+		n, err := strconv.ParseUint(i.contentLengths[0], 10, 63)
+		if err != nil {
+			i.passthrough()
+			return ""
+		}
+		if n == 0 {
+			i.nextRequest()
+			return ""
+		}
+		i.remaining = n
+		i.state = stateBody
+	default:
+		i.nextRequest()
+	}
+
+	return ""
+}
+
+func (i *inspector) nextRequest() {
+	i.state = stateRequestLine
+}
+
+func (i *inspector) passthrough() {
+	i.state = statePassthrough
+	i.line = nil
+}
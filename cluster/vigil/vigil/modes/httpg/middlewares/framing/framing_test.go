@@ -0,0 +1,406 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package framing
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	utils_cert "github.com/octelium/octelium/pkg/utils/cert"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspector(t *testing.T) {
+
+	type tstCase struct {
+		input  string
+		reason string
+	}
+
+	tstCases := []tstCase{
+		{
+			input: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		},
+		{
+			input: "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello" +
+				"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		},
+		{
+			input: "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"5;ext=1\r\nhello\r\n0\r\nX-Trailer: 1\r\n\r\n" +
+				"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		},
+		{
+			input: "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"0\r\n\r\n",
+			reason: reasonConflict,
+		},
+		{
+			input: "POST / HTTP/1.1\r\nHost: example.com\r\ntransfer-encoding: chunked\r\ncontent-length: 0\r\n\r\n" +
+				"0\r\n\r\n",
+			reason: reasonConflict,
+		},
+		{
+			input:  "POST / HTTP/1.0\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			reason: reasonHTTP10Chunked,
+		},
+		{
+			input:  "GET / HTTP/1.1\r\nHost: example.com\r\nX-Folded: a\r\n Transfer-Encoding: chunked\r\n\r\n",
+			reason: reasonObsoleteLineFolding,
+		},
+		{
+			// The smuggled request is in the body of the first one
+			input: "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 60\r\n\r\n" +
+				"POST / HTTP/1.1\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n",
+		},
+		{
+			// Asking for an upgrade does not stop the inspection by itself
+			input: "GET /ws HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n" +
+				"POST / HTTP/1.1\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n",
+			reason: reasonConflict,
+		},
+		{
+			input: "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n",
+		},
+	}
+
+	for i, tstCase := range tstCases {
+		// The parsing must not depend on how the stream is split by the reads
+		for _, chunkSize := range []int{1, 3, 7, len(tstCase.input)} {
+			insp := &inspector{}
+			reason := ""
+			for pos := 0; pos < len(tstCase.input) && reason == ""; pos += chunkSize {
+				_, reason = insp.inspect([]byte(tstCase.input[pos:min(pos+chunkSize, len(tstCase.input))]))
+			}
+			assert.Equal(t, tstCase.reason, reason, "case %d, chunkSize %d", i, chunkSize)
+		}
+	}
+
+	{
+		first := "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello"
+		insp := &inspector{}
+		offset, reason := insp.inspect([]byte(first +
+			"POST / HTTP/1.1\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"))
+		assert.Equal(t, reasonConflict, reason)
+		assert.Equal(t, len(first), offset)
+
+		// The stream is no longer inspected once rejected
+		_, reason = insp.inspect([]byte("POST / HTTP/1.1\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n"))
+		assert.Equal(t, "", reason)
+	}
+
+	{
+		insp := &inspector{
+			allowAmbiguous: func() bool {
+				return true
+			},
+		}
+		_, reason := insp.inspect([]byte(
+			"POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"))
+		assert.Equal(t, "", reason)
+		assert.Equal(t, stateRequestLine, insp.state)
+	}
+}
+
+func TestListener(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	rawLis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	var allowAmbiguous atomic.Bool
+	lis, err := NewListener(rawLis, allowAmbiguous.Load)
+	assert.Nil(t, err)
+
+	var served atomic.Int32
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served.Add(1)
+			if r.Header.Get("Upgrade") == "echo" {
+				c, brw, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+				brw.Flush()
+				io.Copy(c, brw)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		}),
+		ConnState: ConnState,
+	}
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	doReq := func(raw string, n int) []*http.Response {
+		c, err := net.Dial("tcp", rawLis.Addr().String())
+		assert.Nil(t, err)
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+
+		_, err = c.Write([]byte(raw))
+		assert.Nil(t, err)
+
+		var ret []*http.Response
+		br := bufio.NewReader(c)
+		for range n {
+			resp, err := http.ReadResponse(br, nil)
+			if !assert.Nil(t, err) {
+				return ret
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(strings.NewReader(string(body)))
+			ret = append(ret, resp)
+		}
+
+		_, err = br.ReadByte()
+		assert.NotNil(t, err)
+		return ret
+	}
+
+	readBody := func(resp *http.Response) string {
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	smuggling := "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 44\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"0\r\n\r\nGET /admin HTTP/1.1\r\nHost: example.com\r\n\r\n"
+
+	{
+		served.Store(0)
+		resps := doReq(smuggling, 1)
+		assert.Equal(t, http.StatusBadRequest, resps[0].StatusCode)
+		assert.Equal(t, int32(0), served.Load())
+	}
+
+	{
+		served.Store(0)
+		resps := doReq("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello"+smuggling, 2)
+		assert.Equal(t, http.StatusOK, resps[0].StatusCode)
+		assert.Equal(t, "hello", readBody(resps[0]))
+		assert.Equal(t, http.StatusBadRequest, resps[1].StatusCode)
+		assert.Equal(t, int32(1), served.Load())
+	}
+
+	{
+		served.Store(0)
+		resps := doReq("POST / HTTP/1.0\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n"+
+			"0\r\n\r\n", 1)
+		assert.Equal(t, http.StatusBadRequest, resps[0].StatusCode)
+		assert.Equal(t, int32(0), served.Load())
+	}
+
+	{
+		served.Store(0)
+		resps := doReq("POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n"+
+			"5\r\nhello\r\n0\r\n\r\n"+
+			"POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\nConnection: close\r\n\r\nworld", 2)
+		assert.Equal(t, http.StatusOK, resps[0].StatusCode)
+		assert.Equal(t, "hello", readBody(resps[0]))
+		assert.Equal(t, http.StatusOK, resps[1].StatusCode)
+		assert.Equal(t, "world", readBody(resps[1]))
+		assert.Equal(t, int32(2), served.Load())
+	}
+
+	{
+		// The upgrade is not accepted, the connection is still HTTP/1.1
+		served.Store(0)
+		resps := doReq("GET / HTTP/1.1\r\nHost: example.com\r\nUpgrade: x\r\nConnection: Upgrade\r\n\r\n"+
+			smuggling, 2)
+		assert.Equal(t, http.StatusOK, resps[0].StatusCode)
+		assert.Equal(t, http.StatusBadRequest, resps[1].StatusCode)
+		assert.Equal(t, int32(1), served.Load())
+	}
+
+	{
+		// The bytes following an actual protocol switch are not inspected
+		served.Store(0)
+		c, err := net.Dial("tcp", rawLis.Addr().String())
+		assert.Nil(t, err)
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+
+		_, err = c.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n"))
+		assert.Nil(t, err)
+
+		br := bufio.NewReader(c)
+		resp, err := http.ReadResponse(br, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+		_, err = c.Write([]byte(smuggling))
+		assert.Nil(t, err)
+
+		echoed := make([]byte, len(smuggling))
+		_, err = io.ReadFull(br, echoed)
+		assert.Nil(t, err)
+		assert.Equal(t, smuggling, string(echoed))
+		assert.Equal(t, int32(1), served.Load())
+	}
+
+	{
+		allowAmbiguous.Store(true)
+		served.Store(0)
+		resps := doReq(strings.Replace(smuggling, "GET /admin HTTP/1.1\r\n",
+			"GET /admin HTTP/1.1\r\nConnection: close\r\n", 1), 2)
+		assert.Equal(t, http.StatusOK, resps[0].StatusCode)
+		assert.Equal(t, http.StatusOK, resps[1].StatusCode)
+		assert.Equal(t, int32(2), served.Load())
+	}
+}
+
+func TestTLSListener(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	crt, err := utils_cert.GenerateSelfSignedCert("localhost", []string{"localhost"}, time.Hour)
+	assert.Nil(t, err)
+
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{
+			{
+				Certificate: [][]byte{crt.Certificate.Raw},
+				PrivateKey:  crt.PrivateKey,
+			},
+		},
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	rawLis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	lis, err := NewTLSListener(rawLis, tlsCfg, func() time.Duration {
+		return time.Second
+	}, func() bool {
+		return false
+	})
+	assert.Nil(t, err)
+
+	type connKey struct{}
+
+	var served atomic.Int32
+	var hasTLSState atomic.Bool
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served.Add(1)
+			hasTLSState.Store(GetConnectionState(r.Context().Value(connKey{}).(net.Conn)) != nil)
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		}),
+		TLSConfig: tlsCfg,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, c)
+		},
+	}
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	doReq := func(raw string) *http.Response {
+		c, err := tls.Dial("tcp", rawLis.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"http/1.1"},
+		})
+		assert.Nil(t, err)
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+
+		_, err = c.Write([]byte(raw))
+		assert.Nil(t, err)
+
+		resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	{
+		served.Store(0)
+		resp := doReq("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 44\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"0\r\n\r\nGET /admin HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, int32(0), served.Load())
+	}
+
+	{
+		served.Store(0)
+		hasTLSState.Store(false)
+		resp := doReq("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(1), served.Load())
+		assert.True(t, hasTLSState.Load())
+	}
+
+	{
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+				ForceAttemptHTTP2: true,
+			},
+			Timeout: 5 * time.Second,
+		}
+		defer client.CloseIdleConnections()
+
+		hasTLSState.Store(false)
+		resp, err := client.Get("https://" + rawLis.Addr().String())
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.True(t, hasTLSState.Load())
+	}
+
+	{
+		// Stalled handshakes do not block the other connections.
+		c, err := net.Dial("tcp", rawLis.Addr().String())
+		assert.Nil(t, err)
+		defer c.Close()
+
+		resp := doReq("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	assert.Nil(t, lis.Close())
+	_, err = lis.Accept()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package framing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// rejectedRequest is read by the net/http server instead of the bytes of an
+// ambiguous request, followed by errAmbiguousFraming. It is not a valid
+// request line, hence the server replies with 400 and closes the connection.
+// Returning errAmbiguousFraming alone does not work for the pipelined
+// requests since the server closes the idle connections whose next request
+// cannot be read without replying.
+const rejectedRequest = "AMBIGUOUS-FRAMING\r\n\r\n"
+
+var errAmbiguousFraming = errors.New("ambiguous HTTP request framing")
+
+type listener struct {
+	net.Listener
+	allowAmbiguous func() bool
+	rejected       metric.Int64Counter
+}
+
+// NewListener wraps the listener so that the HTTP/1.x requests with an
+// ambiguous framing are rejected before being read by the net/http server
+// unless allowAmbiguous returns true. The connections are inspected in
+// plaintext, hence the TLS listeners must use NewTLSListener instead.
+func NewListener(lis net.Listener, allowAmbiguous func() bool) (net.Listener, error) {
+	rejected, err := otelutils.GetMeter().Int64Counter(
+		metricutils.GetKey("http.request.framing.rejected"),
+		metric.WithDescription("Total number of requests rejected due to an ambiguous framing"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &listener{
+		Listener:       lis,
+		allowAmbiguous: allowAmbiguous,
+		rejected:       rejected,
+	}, nil
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.newConn(c), nil
+}
+
+func (l *listener) newConn(c net.Conn) *conn {
+	return &conn{
+		Conn: c,
+		inspector: &inspector{
+			allowAmbiguous: l.allowAmbiguous,
+		},
+		rejected: l.rejected,
+	}
+}
+
+type conn struct {
+	net.Conn
+	inspector *inspector
+	rejected  metric.Int64Counter
+	pending   []byte
+	err       error
+
+	// isHijacked is set once the conn has been hijacked from the net/http
+	// server, e.g. after a 101 response or an accepted CONNECT request.
+	isHijacked atomic.Bool
+}
+
+// NetConn returns the inspected conn.
+func (c *conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// ConnState is meant to be set as the http.Server ConnState hook. It stops
+// the inspection of the conns that are hijacked since their following bytes
+// belong to the protocol they switched to. A request merely asking for an
+// upgrade does not stop the inspection unless the upgrade actually happens.
+func ConnState(c net.Conn, state http.ConnState) {
+	if state != http.StateHijacked {
+		return
+	}
+
+	switch c := c.(type) {
+	case *conn:
+		c.isHijacked.Store(true)
+	case *inspectedTLSConn:
+		c.isHijacked.Store(true)
+	}
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	n, err := c.Conn.Read(b)
+	if n == 0 || c.isHijacked.Load() {
+		return n, err
+	}
+
+	if offset, reason := c.inspector.inspect(b[:n]); reason != "" {
+		zap.L().Debug("Rejecting request with an ambiguous framing",
+			zap.String("reason", reason), zap.String("client", c.RemoteAddr().String()))
+		c.rejected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+		c.err = errAmbiguousFraming
+		c.pending = []byte(rejectedRequest)
+		if offset == 0 {
+			return c.Read(b)
+		}
+		// The preceding requests read along with the ambiguous one are
+		// still served.
+		return offset, nil
+	}
+
+	return n, err
+}
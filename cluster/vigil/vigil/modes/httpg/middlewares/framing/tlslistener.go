@@ -0,0 +1,174 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package framing
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+type tlsListener struct {
+	*listener
+	cfg              *tls.Config
+	handshakeTimeout func() time.Duration
+
+	results   chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTLSListener returns a TLS listener whose HTTP/1.x connections are
+// inspected once decrypted the same way as NewListener. The handshakes are
+// completed concurrently before the connections are accepted so that the
+// connections that negotiated HTTP/2, whose framing is never ambiguous, are
+// still served as *tls.Conn by the net/http server. The inspected connections
+// expose their TLS state via ConnectionState instead.
+func NewTLSListener(lis net.Listener, cfg *tls.Config,
+	handshakeTimeout func() time.Duration, allowAmbiguous func() bool) (net.Listener, error) {
+	inner, err := NewListener(lis, allowAmbiguous)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &tlsListener{
+		listener:         inner.(*listener),
+		cfg:              cfg,
+		handshakeTimeout: handshakeTimeout,
+		results:          make(chan acceptResult),
+		done:             make(chan struct{}),
+	}
+
+	go ret.run()
+
+	return ret, nil
+}
+
+func (l *tlsListener) run() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if !l.send(acceptResult{err: err}) || !isTemporary(err) {
+				return
+			}
+			continue
+		}
+
+		go l.handshake(c)
+	}
+}
+
+func (l *tlsListener) handshake(c net.Conn) {
+	tlsConn := tls.Server(c, l.cfg)
+
+	// Using deadlines rather than a context, as the net/http server does,
+	// lets the stalled handshakes be accounted by the inner listeners.
+	if timeout := l.handshakeTimeout(); timeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		zap.L().Debug("Could not complete TLS handshake",
+			zap.String("client", c.RemoteAddr().String()), zap.Error(err))
+		tlsConn.Close()
+		return
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	var ret net.Conn = tlsConn
+	if tlsConn.ConnectionState().NegotiatedProtocol != "h2" {
+		ret = &inspectedTLSConn{
+			conn:    l.newConn(tlsConn),
+			tlsConn: tlsConn,
+		}
+	}
+
+	if !l.send(acceptResult{conn: ret}) {
+		ret.Close()
+	}
+}
+
+func (l *tlsListener) send(ret acceptResult) bool {
+	select {
+	case l.results <- ret:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *tlsListener) Accept() (net.Conn, error) {
+	select {
+	case ret := <-l.results:
+		return ret.conn, ret.err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *tlsListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+
+	return l.Listener.Close()
+}
+
+func isTemporary(err error) bool {
+	var netErr interface{ Temporary() bool }
+	return errors.As(err, &netErr) && netErr.Temporary()
+}
+
+type inspectedTLSConn struct {
+	*conn
+	tlsConn *tls.Conn
+}
+
+// ConnectionState returns the state of the TLS connection. The net/http
+// server only sets the TLS state of the requests read from a *tls.Conn.
+func (c *inspectedTLSConn) ConnectionState() tls.ConnectionState {
+	return c.tlsConn.ConnectionState()
+}
+
+// NetConn returns the underlying conn of the TLS connection.
+func (c *inspectedTLSConn) NetConn() net.Conn {
+	return c.tlsConn.NetConn()
+}
+
+// GetConnectionState returns the TLS state of the conn served by the
+// net/http server, if any.
+func GetConnectionState(c net.Conn) *tls.ConnectionState {
+	switch c := c.(type) {
+	case *tls.Conn:
+		ret := c.ConnectionState()
+		return &ret
+	case *inspectedTLSConn:
+		ret := c.ConnectionState()
+		return &ret
+	default:
+		return nil
+	}
+}
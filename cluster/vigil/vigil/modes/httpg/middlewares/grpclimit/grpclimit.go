@@ -0,0 +1,345 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package grpclimit
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/pkg/errors"
+)
+
+const (
+	statusResourceExhausted = 8
+	statusUnimplemented     = 12
+)
+
+type middleware struct {
+	next http.Handler
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	return &middleware{
+		next: next,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	svcCfg := reqCtx.ServiceConfig
+
+	if !ucorev1.ToService(reqCtx.Service).IsGRPC() {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	cfg := svcCfg.GetHttp().GetGrpc()
+
+	if err := getRequestMetadataLimit(cfg.GetMetadata()).check("request", req.Header, isAnyHeader); err != nil {
+		writeStatus(rw, statusResourceExhausted, err.Error())
+		return
+	}
+
+	if len(cfg.GetAllowedEncodings()) > 0 {
+		if enc := req.Header.Get("Grpc-Encoding"); !isAllowedEncoding(enc, cfg.AllowedEncodings) {
+			rw.Header().Set("Grpc-Accept-Encoding",
+				strings.Join(append([]string{"identity"}, cfg.AllowedEncodings...), ","))
+			writeStatus(rw, statusUnimplemented,
+				fmt.Sprintf("grpc: Decompressor is not installed for grpc-encoding %q", enc))
+			return
+		}
+
+		filterAcceptEncoding(req.Header, cfg.AllowedEncodings)
+	}
+
+	crw := &responseWriter{
+		ResponseWriter: rw,
+		metadataLimit:  getResponseMetadataLimit(cfg.GetMetadata()),
+	}
+
+	if cfg.GetMaxResponseMessageSize() > 0 {
+		crw.parser = &frameParser{
+			maxSize: cfg.MaxResponseMessageSize,
+		}
+	}
+
+	if cfg.GetMaxRequestMessageSize() > 0 && req.Body != nil && req.Body != http.NoBody {
+		crw.body = &bodyReader{
+			ReadCloser: req.Body,
+			parser: &frameParser{
+				maxSize: cfg.MaxRequestMessageSize,
+			},
+		}
+		req.Body = crw.body
+	}
+
+	m.next.ServeHTTP(crw, req)
+
+	crw.finish()
+}
+
+func isAllowedEncoding(enc string, allowed []string) bool {
+	return enc == "" || enc == "identity" || slices.Contains(allowed, enc)
+}
+
+// filterAcceptEncoding removes the encodings that are not allowed from the
+// grpc-accept-encoding header so that the upstream never compresses the
+// response messages with them.
+func filterAcceptEncoding(hdr http.Header, allowed []string) {
+	vals := hdr.Values("Grpc-Accept-Encoding")
+	if len(vals) == 0 {
+		return
+	}
+
+	var ret []string
+	for _, val := range vals {
+		for _, enc := range strings.Split(val, ",") {
+			enc = strings.TrimSpace(enc)
+			if enc != "" && isAllowedEncoding(enc, allowed) && !slices.Contains(ret, enc) {
+				ret = append(ret, enc)
+			}
+		}
+	}
+
+	hdr.Del("Grpc-Accept-Encoding")
+	if len(ret) > 0 {
+		hdr.Set("Grpc-Accept-Encoding", strings.Join(ret, ","))
+	}
+}
+
+// writeStatus writes a trailers-only gRPC response.
+func writeStatus(rw http.ResponseWriter, code int, msg string) {
+	hdr := rw.Header()
+	hdr.Del("Content-Length")
+	hdr.Set("Content-Type", "application/grpc")
+	hdr.Set("Grpc-Status", strconv.Itoa(code))
+	hdr.Set("Grpc-Message", msg)
+	rw.WriteHeader(http.StatusOK)
+}
+
+type errMessageTooLarge struct {
+	size    uint32
+	maxSize uint32
+}
+
+func (e *errMessageTooLarge) Error() string {
+	return fmt.Sprintf("grpc: message larger than max (%d vs. %d)", e.size, e.maxSize)
+}
+
+// frameParser tracks the gRPC length-prefixed message framing of a stream
+// without buffering the messages themselves.
+type frameParser struct {
+	maxSize   uint32
+	hdr       [5]byte
+	hdrLen    int
+	remaining uint32
+}
+
+// feed processes the next bytes of the stream. In case a message exceeds the
+// max size, it returns the offset of that message's prefix within p along
+// with the error.
+func (f *frameParser) feed(p []byte) (int, error) {
+	offset := 0
+	for offset < len(p) {
+		if f.remaining > 0 {
+			n := min(uint32(len(p)-offset), f.remaining)
+			f.remaining -= n
+			offset += int(n)
+			continue
+		}
+
+		hdrStart := offset - f.hdrLen
+		n := copy(f.hdr[f.hdrLen:], p[offset:])
+		f.hdrLen += n
+		offset += n
+		if f.hdrLen < len(f.hdr) {
+			continue
+		}
+
+		f.hdrLen = 0
+		size := binary.BigEndian.Uint32(f.hdr[1:])
+		if size > f.maxSize {
+			return max(hdrStart, 0), &errMessageTooLarge{
+				size:    size,
+				maxSize: f.maxSize,
+			}
+		}
+		f.remaining = size
+	}
+
+	return len(p), nil
+}
+
+type bodyReader struct {
+	io.ReadCloser
+	parser *frameParser
+	err    atomic.Pointer[errMessageTooLarge]
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	if err := r.err.Load(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if _, ferr := r.parser.feed(p[:n]); ferr != nil {
+			var tooLarge *errMessageTooLarge
+			if errors.As(ferr, &tooLarge) {
+				r.err.Store(tooLarge)
+			}
+			return 0, ferr
+		}
+	}
+
+	return n, err
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	parser        *frameParser
+	body          *bodyReader
+	metadataLimit *metadataLimit
+	wroteHeader   bool
+	isAborted     bool
+	discarded     http.Header
+}
+
+func (w *responseWriter) getRequestErr() error {
+	if w.body == nil {
+		return nil
+	}
+	if err := w.body.err.Load(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// abort terminates the response with the given status. Once aborted, the
+// rest of the upstream response, including its trailers, is discarded.
+func (w *responseWriter) abort(code int, msg string) {
+	w.isAborted = true
+	w.discarded = make(http.Header)
+
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		writeStatus(w.ResponseWriter, code, msg)
+		return
+	}
+
+	hdr := w.ResponseWriter.Header()
+	hdr.Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	hdr.Set(http.TrailerPrefix+"Grpc-Message", msg)
+}
+
+func (w *responseWriter) Header() http.Header {
+	if w.isAborted {
+		return w.discarded
+	}
+	return w.ResponseWriter.Header()
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+
+	if err := w.getRequestErr(); err != nil {
+		w.abort(statusResourceExhausted, err.Error())
+		return
+	}
+
+	hdr := w.ResponseWriter.Header()
+	if err := w.metadataLimit.check("response", hdr, isResponseHeader); err != nil {
+		clear(hdr)
+		w.abort(statusResourceExhausted, err.Error())
+		return
+	}
+
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.isAborted {
+		return len(p), nil
+	}
+
+	if w.parser == nil {
+		return w.ResponseWriter.Write(p)
+	}
+
+	n, err := w.parser.feed(p)
+	if err == nil {
+		return w.ResponseWriter.Write(p)
+	}
+
+	if n > 0 {
+		if _, err := w.ResponseWriter.Write(p[:n]); err != nil {
+			return 0, err
+		}
+	}
+
+	w.abort(statusResourceExhausted, err.Error())
+
+	return len(p), nil
+}
+
+func (w *responseWriter) finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.isAborted {
+		return
+	}
+
+	if err := w.getRequestErr(); err != nil {
+		w.abort(statusResourceExhausted, err.Error())
+		return
+	}
+
+	hdr := w.ResponseWriter.Header()
+	isTrailer := getTrailerFilter(hdr)
+	if err := w.metadataLimit.check("response", hdr, isTrailer); err != nil {
+		for k := range hdr {
+			if isTrailer(k) {
+				delete(hdr, k)
+			}
+		}
+		w.abort(statusResourceExhausted, err.Error())
+	}
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
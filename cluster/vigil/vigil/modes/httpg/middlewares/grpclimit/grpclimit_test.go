@@ -0,0 +1,308 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package grpclimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func getFrame(size int) []byte {
+	ret := make([]byte, 5+size)
+	binary.BigEndian.PutUint32(ret[1:5], uint32(size))
+	return ret
+}
+
+func TestFrameParser(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		p := &frameParser{maxSize: 10}
+		stream := append(append(getFrame(10), getFrame(0)...), getFrame(3)...)
+
+		for _, b := range stream {
+			n, err := p.feed([]byte{b})
+			assert.Nil(t, err)
+			assert.Equal(t, 1, n)
+		}
+	}
+
+	{
+		p := &frameParser{maxSize: 10}
+		stream := append(getFrame(4), getFrame(11)...)
+
+		n, err := p.feed(stream)
+		assert.NotNil(t, err)
+		assert.Equal(t, 9, n)
+	}
+
+	{
+		p := &frameParser{maxSize: 10}
+		frame := getFrame(11)
+
+		n, err := p.feed(frame[:2])
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+
+		n, err = p.feed(frame[2:])
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, n)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var respBody []byte
+	var reqErr error
+	var acceptEncoding string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Grpc-Accept-Encoding")
+		_, reqErr = io.ReadAll(r.Body)
+		if reqErr != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBody)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	})
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	newReq := func(body []byte, cfg *corev1.Service_Spec_Config_HTTP_GRPC) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/a.b/c", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/grpc")
+		return req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service: &corev1.Service{
+					Spec: &corev1.Service_Spec{
+						Mode: corev1.Service_Spec_GRPC,
+					},
+				},
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							Grpc: cfg,
+						},
+					},
+				},
+			}))
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_GRPC{
+		MaxRequestMessageSize:  100,
+		MaxResponseMessageSize: 100,
+		AllowedEncodings:       []string{"gzip"},
+	}
+
+	{
+		respBody = getFrame(100)
+		rw := httptest.NewRecorder()
+		req := newReq(getFrame(100), cfg)
+		req.Header.Set("Grpc-Accept-Encoding", "deflate, gzip,identity")
+		mdlwr.ServeHTTP(rw, req)
+
+		res := rw.Result()
+		assert.Nil(t, reqErr)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, len(respBody), rw.Body.Len())
+		assert.Equal(t, "0", res.Trailer.Get("Grpc-Status"))
+		assert.Equal(t, "gzip,identity", acceptEncoding)
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(append(getFrame(10), getFrame(101)...), cfg))
+
+		res := rw.Result()
+		assert.NotNil(t, reqErr)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "8", res.Header.Get("Grpc-Status"))
+		assert.Equal(t, "application/grpc", res.Header.Get("Content-Type"))
+	}
+
+	{
+		respBody = append(getFrame(10), getFrame(101)...)
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(getFrame(10), cfg))
+
+		res := rw.Result()
+		assert.Nil(t, reqErr)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, 15, rw.Body.Len())
+		assert.Equal(t, "8", res.Trailer.Get("Grpc-Status"))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		req := newReq(getFrame(10), cfg)
+		req.Header.Set("Grpc-Encoding", "deflate")
+		mdlwr.ServeHTTP(rw, req)
+
+		res := rw.Result()
+		assert.Equal(t, "12", res.Header.Get("Grpc-Status"))
+		assert.Equal(t, "identity,gzip", res.Header.Get("Grpc-Accept-Encoding"))
+	}
+}
+
+func TestMetadataLimit(t *testing.T) {
+
+	ctx := context.Background()
+
+	var respHdrs, respTrailers int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		for i := 0; i < respHdrs; i++ {
+			w.Header().Add("X-Hdr", "val")
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(getFrame(1))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		for i := 0; i < respTrailers; i++ {
+			w.Header().Add(http.TrailerPrefix+"X-Trl", "val")
+		}
+	})
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	newReq := func(cfg *corev1.Service_Spec_Config_HTTP_GRPC) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/a.b/c", bytes.NewReader(getFrame(1)))
+		req.Header.Set("Content-Type", "application/grpc")
+		return req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service: &corev1.Service{
+					Spec: &corev1.Service_Spec{
+						Mode: corev1.Service_Spec_GRPC,
+					},
+				},
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							Grpc: cfg,
+						},
+					},
+				},
+			}))
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_GRPC{
+		Metadata: &corev1.Service_Spec_Config_HTTP_GRPC_Metadata{
+			MaxRequestEntries:  5,
+			MaxRequestSize:     200,
+			MaxResponseEntries: 5,
+		},
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(cfg))
+
+		res := rw.Result()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "0", res.Trailer.Get("Grpc-Status"))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		req := newReq(nil)
+		req.Header.Set("X-Large", strings.Repeat("a", defaultMaxMetadataSize))
+		mdlwr.ServeHTTP(rw, req)
+
+		res := rw.Result()
+		assert.Equal(t, "8", res.Header.Get("Grpc-Status"))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		req := newReq(cfg)
+		req.Header.Set("X-Large", strings.Repeat("a", 200))
+		mdlwr.ServeHTTP(rw, req)
+
+		res := rw.Result()
+		assert.Equal(t, "8", res.Header.Get("Grpc-Status"))
+		assert.Contains(t, res.Header.Get("Grpc-Message"), "request metadata size")
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		req := newReq(cfg)
+		for i := 0; i < 5; i++ {
+			req.Header.Add("X-Hdr", "val")
+		}
+		mdlwr.ServeHTTP(rw, req)
+
+		res := rw.Result()
+		assert.Equal(t, "8", res.Header.Get("Grpc-Status"))
+		assert.Contains(t, res.Header.Get("Grpc-Message"), "request metadata entries")
+	}
+
+	{
+		respHdrs = 5
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(cfg))
+
+		res := rw.Result()
+		assert.Equal(t, "8", res.Header.Get("Grpc-Status"))
+		assert.Equal(t, "", res.Header.Get("X-Hdr"))
+		assert.Equal(t, 0, rw.Body.Len())
+		respHdrs = 0
+	}
+
+	{
+		respTrailers = 5
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(cfg))
+
+		res := rw.Result()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, 6, rw.Body.Len())
+		assert.Equal(t, "8", res.Trailer.Get("Grpc-Status"))
+		assert.Equal(t, "", res.Trailer.Get("X-Trl"))
+		respTrailers = 0
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package grpclimit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+)
+
+const (
+	defaultMaxMetadataEntries = 100
+	defaultMaxMetadataSize    = 16 * 1024
+)
+
+type metadataLimit struct {
+	maxEntries int
+	maxSize    int
+}
+
+func getMetadataLimit(entries, size uint32) *metadataLimit {
+	ret := &metadataLimit{
+		maxEntries: defaultMaxMetadataEntries,
+		maxSize:    defaultMaxMetadataSize,
+	}
+	if entries > 0 {
+		ret.maxEntries = int(entries)
+	}
+	if size > 0 {
+		ret.maxSize = int(size)
+	}
+
+	return ret
+}
+
+func getRequestMetadataLimit(cfg *corev1.Service_Spec_Config_HTTP_GRPC_Metadata) *metadataLimit {
+	return getMetadataLimit(cfg.GetMaxRequestEntries(), cfg.GetMaxRequestSize())
+}
+
+func getResponseMetadataLimit(cfg *corev1.Service_Spec_Config_HTTP_GRPC_Metadata) *metadataLimit {
+	return getMetadataLimit(cfg.GetMaxResponseEntries(), cfg.GetMaxResponseSize())
+}
+
+// check returns an error if the metadata entries selected by the filter
+// exceed the limit. Every value of a key is counted as a separate entry and
+// the size is the total length of the keys and values.
+func (l *metadataLimit) check(kind string, hdr http.Header, filter func(key string) bool) error {
+	entries, size := 0, 0
+	for k, vals := range hdr {
+		if !filter(k) {
+			continue
+		}
+		for _, val := range vals {
+			entries++
+			size += len(k) + len(val)
+		}
+	}
+
+	if entries > l.maxEntries {
+		return fmt.Errorf("grpc: %s metadata entries exceed the limit (%d vs. %d)", kind, entries, l.maxEntries)
+	}
+	if size > l.maxSize {
+		return fmt.Errorf("grpc: %s metadata size exceeds the limit (%d vs. %d)", kind, size, l.maxSize)
+	}
+
+	return nil
+}
+
+func isAnyHeader(key string) bool {
+	return true
+}
+
+func isResponseHeader(key string) bool {
+	return !strings.HasPrefix(key, http.TrailerPrefix)
+}
+
+// getTrailerFilter returns the filter of the response trailers which are
+// either set with the http.TrailerPrefix or declared by the Trailer header.
+func getTrailerFilter(hdr http.Header) func(key string) bool {
+	declared := make(map[string]bool)
+	for _, val := range hdr.Values("Trailer") {
+		for _, key := range strings.Split(val, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				declared[http.CanonicalHeaderKey(key)] = true
+			}
+		}
+	}
+
+	return func(key string) bool {
+		return strings.HasPrefix(key, http.TrailerPrefix) || declared[key]
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package handshakelimit
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	utils_cert "github.com/octelium/octelium/pkg/utils/cert"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucket(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	now := time.Now()
+	b := newBucket(func() time.Time {
+		return now
+	})
+
+	for range 3 {
+		assert.True(t, b.take(2, 3))
+	}
+	assert.False(t, b.take(2, 3))
+
+	now = now.Add(250 * time.Millisecond)
+	assert.False(t, b.take(2, 3))
+	now = now.Add(250 * time.Millisecond)
+	assert.True(t, b.take(2, 3))
+	assert.False(t, b.take(2, 3))
+
+	// Idle time does not accumulate more tokens than the burst.
+	now = now.Add(time.Hour)
+	for range 3 {
+		assert.True(t, b.take(2, 3))
+	}
+	assert.False(t, b.take(2, 3))
+
+	// A lower burst applies right away.
+	now = now.Add(time.Hour)
+	assert.True(t, b.take(2, 1))
+	assert.False(t, b.take(2, 1))
+}
+
+func TestListener(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	crt, err := utils_cert.GenerateSelfSignedCert("localhost", []string{"localhost"}, time.Hour)
+	assert.Nil(t, err)
+
+	rawLis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	var mu sync.Mutex
+	rate := uint32(5)
+	lis, err := NewListener(rawLis, func() (uint32, uint32) {
+		mu.Lock()
+		defer mu.Unlock()
+		return rate, 0
+	})
+	assert.Nil(t, err)
+
+	// Freeze the bucket so that the burst is not refilled during the test.
+	now := time.Now()
+	lis.(*listener).bucket = newBucket(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+
+	tlsLis := tls.NewListener(lis, &tls.Config{
+		Certificates: []tls.Certificate{
+			{
+				Certificate: [][]byte{crt.Certificate.Raw},
+				PrivateKey:  crt.PrivateKey,
+			},
+		},
+	})
+	defer tlsLis.Close()
+
+	go func() {
+		for {
+			c, err := tlsLis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				if err := c.(*tls.Conn).Handshake(); err != nil {
+					return
+				}
+				c.Read(make([]byte, 1))
+			}()
+		}
+	}()
+
+	handshake := func() (*tls.Conn, error) {
+		c, err := net.Dial("tcp", rawLis.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		tc := tls.Client(c, &tls.Config{
+			InsecureSkipVerify: true,
+		})
+		tc.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := tc.Handshake(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		tc.SetDeadline(time.Time{})
+		return tc, nil
+	}
+
+	var conns []*tls.Conn
+	var failed int
+	var wg sync.WaitGroup
+	var resMu sync.Mutex
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := handshake()
+			resMu.Lock()
+			defer resMu.Unlock()
+			if err != nil {
+				failed++
+				return
+			}
+			conns = append(conns, c)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, len(conns))
+	assert.Equal(t, 15, failed)
+
+	// The established connections are unaffected by the limit.
+	for _, c := range conns {
+		_, err := c.Write([]byte("a"))
+		assert.Nil(t, err)
+	}
+
+	_, err = handshake()
+	assert.NotNil(t, err)
+
+	mu.Lock()
+	now = now.Add(time.Second)
+	mu.Unlock()
+	c, err := handshake()
+	assert.Nil(t, err)
+	c.Close()
+
+	mu.Lock()
+	rate = 0
+	mu.Unlock()
+	for range 10 {
+		c, err := handshake()
+		assert.Nil(t, err)
+		c.Close()
+	}
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package handshakelimit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+type listener struct {
+	net.Listener
+	getLimit func() (uint32, uint32)
+	bucket   *bucket
+	counter  metric.Int64Counter
+}
+
+// NewListener wraps the raw listener of a TLS listener so that the
+// connections exceeding the rate of new handshakes returned by getLimit are
+// closed at accept time, before the TLS listener starts their handshakes.
+// getLimit returns the maximum rate per second and the burst. A zero rate
+// disables the limit.
+func NewListener(lis net.Listener, getLimit func() (uint32, uint32)) (net.Listener, error) {
+	counter, err := otelutils.GetMeter().Int64Counter(metricutils.GetKey("http.tls.handshakes"),
+		metric.WithDescription("Total number of new TLS connections accepted and rejected by the handshake limit"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &listener{
+		Listener: lis,
+		getLimit: getLimit,
+		bucket:   newBucket(time.Now),
+		counter:  counter,
+	}, nil
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		rate, burst := l.getLimit()
+		if rate == 0 {
+			return c, nil
+		}
+		if burst == 0 {
+			burst = rate
+		}
+
+		if !l.bucket.take(float64(rate), float64(burst)) {
+			zap.L().Debug("Closing conn since the TLS handshake rate is exceeded",
+				zap.String("addr", c.RemoteAddr().String()), zap.Uint32("maxRate", rate))
+			l.counter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("result", "rejected")))
+			// Closing right away without reading the ClientHello avoids any
+			// handshake work for the excess connections.
+			if tc, ok := c.(*net.TCPConn); ok {
+				tc.SetLinger(0)
+			}
+			c.Close()
+			continue
+		}
+
+		l.counter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("result", "accepted")))
+		return c, nil
+	}
+}
+
+// bucket is a token bucket whose rate and burst can change between calls.
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	isInit bool
+	now    func() time.Time
+}
+
+func newBucket(now func() time.Time) *bucket {
+	return &bucket{
+		now: now,
+	}
+}
+
+func (b *bucket) take(rate, burst float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if !b.isInit {
+		b.tokens = burst
+		b.isInit = true
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate
+	}
+	b.tokens = min(b.tokens, burst)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
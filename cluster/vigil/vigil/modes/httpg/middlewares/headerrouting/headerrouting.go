@@ -0,0 +1,172 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package headerrouting
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/celengine"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/cluster/vigil/vigil/vigilutils"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"go.uber.org/zap"
+)
+
+type middleware struct {
+	next      http.Handler
+	celEngine *celengine.CELEngine
+}
+
+func New(ctx context.Context, next http.Handler, celEngine *celengine.CELEngine) (http.Handler, error) {
+	return &middleware{
+		next:      next,
+		celEngine: celEngine,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	reqCtx := middlewares.GetCtxRequestContext(ctx)
+	svcCfg := reqCtx.ServiceConfig
+
+	if svcCfg == nil || svcCfg.GetHttp() == nil || svcCfg.GetHttp().HeaderRouting == nil {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	cfg := svcCfg.GetHttp().HeaderRouting
+
+	key := m.getKey(ctx, cfg, reqCtx, req)
+	cfgName, ok := getConfigName(cfg, key)
+	if !ok {
+		if cfg.RejectUnknown {
+			zap.L().Debug("Rejecting request with unknown routing key", zap.String("key", key))
+			rw.WriteHeader(getStatusCode(cfg))
+			return
+		}
+		cfgName = cfg.DefaultConfigName
+	}
+
+	if cfgName != "" && reqCtx.AuthResponse != nil {
+		authResp := pbutils.Clone(reqCtx.AuthResponse).(*coctovigilv1.AuthenticateAndAuthorizeResponse)
+		authResp.ServiceConfigName = cfgName
+		authResp.Config = nil
+
+		reqCtx.AuthResponse = authResp
+		reqCtx.ServiceConfig = vigilutils.GetServiceConfig(ctx, authResp)
+	}
+
+	m.next.ServeHTTP(rw, req)
+}
+
+func getStatusCode(cfg *corev1.Service_Spec_Config_HTTP_HeaderRouting) int {
+	if cfg.StatusCode >= 400 && cfg.StatusCode <= 599 {
+		return int(cfg.StatusCode)
+	}
+
+	return http.StatusForbidden
+}
+
+// getConfigName returns the config name of the route matching the key and
+// whether such a route exists.
+func getConfigName(cfg *corev1.Service_Spec_Config_HTTP_HeaderRouting, key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	for _, route := range cfg.Routes {
+		if slices.Contains(route.Values, key) {
+			return route.ConfigName, true
+		}
+	}
+
+	return "", false
+}
+
+func (m *middleware) getKey(ctx context.Context,
+	cfg *corev1.Service_Spec_Config_HTTP_HeaderRouting,
+	reqCtx *middlewares.RequestContext, req *http.Request) string {
+	if cfg.Key == nil {
+		return ""
+	}
+
+	switch cfg.Key.Type.(type) {
+	case *corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_Header:
+		reqCtx.AddVary(cfg.Key.GetHeader())
+		return strings.TrimSpace(req.Header.Get(cfg.Key.GetHeader()))
+	case *corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_JwtClaim:
+		if hdr := cfg.Key.GetJwtClaim().Header; hdr != "" {
+			reqCtx.AddVary(hdr)
+		} else {
+			reqCtx.AddVary("Authorization")
+		}
+		return getJWTClaim(req, cfg.Key.GetJwtClaim())
+	case *corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_Eval:
+		val, err := m.celEngine.EvalPolicyString(ctx, cfg.Key.GetEval(), reqCtx.ReqCtxMap)
+		if err != nil {
+			zap.L().Debug("Could not eval routing key", zap.Error(err))
+			return ""
+		}
+		return val
+	default:
+		return ""
+	}
+}
+
+// getJWTClaim returns the string value of the claim from the unverified
+// payload of the JWT.
+func getJWTClaim(req *http.Request, cfg *corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_JWTClaim) string {
+	if cfg.Claim == "" {
+		return ""
+	}
+
+	var token string
+	if cfg.Header == "" || strings.EqualFold(cfg.Header, "Authorization") {
+		val := req.Header.Get("Authorization")
+		if len(val) < 7 || !strings.EqualFold(val[:7], "bearer ") {
+			return ""
+		}
+		token = strings.TrimSpace(val[7:])
+	} else {
+		token = strings.TrimSpace(req.Header.Get(cfg.Header))
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	claims := make(map[string]any)
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+
+	ret, _ := claims[cfg.Claim].(string)
+	return ret
+}
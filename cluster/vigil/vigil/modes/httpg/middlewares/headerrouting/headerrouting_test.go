@@ -0,0 +1,232 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package headerrouting
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/celengine"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var cfgName string
+	isNextCalled := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isNextCalled = true
+		reqCtx := middlewares.GetCtxRequestContext(r.Context())
+		cfgName = reqCtx.AuthResponse.ServiceConfigName
+	})
+
+	celEngine, err := celengine.New(ctx, &celengine.Opts{})
+	assert.Nil(t, err)
+
+	mdlwr, err := New(ctx, next, celEngine)
+	assert.Nil(t, err)
+
+	routes := []*corev1.Service_Spec_Config_HTTP_HeaderRouting_Route{
+		{
+			Values:     []string{"tenant-a", "tenant-aa"},
+			ConfigName: "cfg-a",
+		},
+		{
+			Values:     []string{"tenant-b"},
+			ConfigName: "cfg-b",
+		},
+	}
+
+	newSvc := func(routing *corev1.Service_Spec_Config_HTTP_HeaderRouting) *corev1.Service {
+		return &corev1.Service{
+			Metadata: &metav1.Metadata{
+				Name: "svc1",
+			},
+			Spec: &corev1.Service_Spec{
+				Mode: corev1.Service_Spec_HTTP,
+				Config: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							HeaderRouting: routing,
+						},
+					},
+				},
+				DynamicConfig: &corev1.Service_Spec_DynamicConfig{
+					Configs: []*corev1.Service_Spec_Config{
+						{
+							Name: "cfg-a",
+						},
+						{
+							Name: "cfg-b",
+						},
+						{
+							Name: "cfg-default",
+						},
+					},
+				},
+			},
+		}
+	}
+
+	doRequest := func(svc *corev1.Service, hdr http.Header) *httptest.ResponseRecorder {
+		isNextCalled = false
+		cfgName = ""
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		for k, v := range hdr {
+			req.Header[k] = v
+		}
+
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt:     time.Now(),
+			Service:       svc,
+			ServiceConfig: svc.Spec.Config,
+			AuthResponse: &coctovigilv1.AuthenticateAndAuthorizeResponse{
+				RequestContext: &corev1.RequestContext{
+					Service: svc,
+				},
+			},
+		}
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx)))
+		return rw
+	}
+
+	{
+		svc := newSvc(&corev1.Service_Spec_Config_HTTP_HeaderRouting{
+			Key: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key{
+				Type: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_Header{
+					Header: "X-Tenant-ID",
+				},
+			},
+			Routes:            routes,
+			DefaultConfigName: "cfg-default",
+		})
+
+		doRequest(svc, http.Header{"X-Tenant-Id": []string{"tenant-a"}})
+		assert.True(t, isNextCalled)
+		assert.Equal(t, "cfg-a", cfgName)
+
+		doRequest(svc, http.Header{"X-Tenant-Id": []string{"tenant-aa"}})
+		assert.Equal(t, "cfg-a", cfgName)
+
+		doRequest(svc, http.Header{"X-Tenant-Id": []string{"tenant-b"}})
+		assert.Equal(t, "cfg-b", cfgName)
+
+		doRequest(svc, http.Header{"X-Tenant-Id": []string{"tenant-c"}})
+		assert.True(t, isNextCalled)
+		assert.Equal(t, "cfg-default", cfgName)
+
+		doRequest(svc, nil)
+		assert.True(t, isNextCalled)
+		assert.Equal(t, "cfg-default", cfgName)
+	}
+
+	{
+		svc := newSvc(&corev1.Service_Spec_Config_HTTP_HeaderRouting{
+			Key: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key{
+				Type: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_Header{
+					Header: "X-Tenant-ID",
+				},
+			},
+			Routes: routes,
+		})
+
+		doRequest(svc, http.Header{"X-Tenant-Id": []string{"tenant-c"}})
+		assert.True(t, isNextCalled)
+		assert.Equal(t, "", cfgName)
+	}
+
+	{
+		svc := newSvc(&corev1.Service_Spec_Config_HTTP_HeaderRouting{
+			Key: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key{
+				Type: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_Header{
+					Header: "X-Tenant-ID",
+				},
+			},
+			Routes:        routes,
+			RejectUnknown: true,
+			StatusCode:    404,
+		})
+
+		rw := doRequest(svc, http.Header{"X-Tenant-Id": []string{"tenant-c"}})
+		assert.False(t, isNextCalled)
+		assert.Equal(t, 404, rw.Code)
+
+		rw = doRequest(svc, nil)
+		assert.False(t, isNextCalled)
+		assert.Equal(t, 404, rw.Code)
+
+		doRequest(svc, http.Header{"X-Tenant-Id": []string{"tenant-b"}})
+		assert.True(t, isNextCalled)
+		assert.Equal(t, "cfg-b", cfgName)
+	}
+
+	{
+		svc := newSvc(&corev1.Service_Spec_Config_HTTP_HeaderRouting{
+			Key: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key{
+				Type: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_JwtClaim{
+					JwtClaim: &corev1.Service_Spec_Config_HTTP_HeaderRouting_Key_JWTClaim{
+						Claim: "tenant",
+					},
+				},
+			},
+			Routes:        routes,
+			RejectUnknown: true,
+		})
+
+		getToken := func(claims string) string {
+			return fmt.Sprintf("%s.%s.sig",
+				base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)),
+				base64.RawURLEncoding.EncodeToString([]byte(claims)))
+		}
+
+		doRequest(svc, http.Header{"Authorization": []string{
+			fmt.Sprintf("Bearer %s", getToken(`{"tenant":"tenant-b"}`))}})
+		assert.True(t, isNextCalled)
+		assert.Equal(t, "cfg-b", cfgName)
+
+		rw := doRequest(svc, http.Header{"Authorization": []string{
+			fmt.Sprintf("Bearer %s", getToken(`{"sub":"tenant-b"}`))}})
+		assert.False(t, isNextCalled)
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+
+		rw = doRequest(svc, http.Header{"Authorization": []string{"Bearer invalid"}})
+		assert.False(t, isNextCalled)
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	}
+}
@@ -115,6 +115,12 @@ func (m *middleware) setRequestHeaders(req *http.Request, reqCtx *middlewares.Re
 		if authS.GetBearer() != nil &&
 			authS.GetBearer().GetFromSecret() != "" {
 			secret, err := m.secretMan.GetByName(ctx, authS.GetBearer().GetFromSecret())
+			middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+				Type:       middlewares.AuthInjectionBearer,
+				SecretName: authS.GetBearer().GetFromSecret(),
+				Secret:     secret,
+				Err:        err,
+			})
 			if err == nil {
 				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ucorev1.ToSecret(secret).GetValueStr()))
 			} else {
@@ -124,6 +130,12 @@ func (m *middleware) setRequestHeaders(req *http.Request, reqCtx *middlewares.Re
 		} else if authS.GetBasic() != nil &&
 			authS.GetBasic().GetPassword() != nil && authS.GetBasic().GetPassword().GetFromSecret() != "" {
 			secret, err := m.secretMan.GetByName(ctx, authS.GetBasic().GetPassword().GetFromSecret())
+			middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+				Type:       middlewares.AuthInjectionBasic,
+				SecretName: authS.GetBasic().GetPassword().GetFromSecret(),
+				Secret:     secret,
+				Err:        err,
+			})
 			if err == nil {
 				authVal := base64.StdEncoding.EncodeToString(
 					[]byte(fmt.Sprintf("%s:%s",
@@ -136,6 +148,12 @@ func (m *middleware) setRequestHeaders(req *http.Request, reqCtx *middlewares.Re
 		} else if authS.GetCustom() != nil &&
 			authS.GetCustom().GetValue() != nil && authS.GetCustom().GetValue().GetFromSecret() != "" {
 			secret, err := m.secretMan.GetByName(ctx, authS.GetCustom().GetValue().GetFromSecret())
+			middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+				Type:       middlewares.AuthInjectionCustom,
+				SecretName: authS.GetCustom().GetValue().GetFromSecret(),
+				Secret:     secret,
+				Err:        err,
+			})
 			if err == nil {
 				req.Header.Set(authS.GetCustom().Header, ucorev1.ToSecret(secret).GetValueStr())
 			} else {
@@ -150,6 +168,11 @@ func (m *middleware) setRequestHeaders(req *http.Request, reqCtx *middlewares.Re
 				SecretName: authS.GetOauth2ClientCredentials().GetClientSecret().GetFromSecret(),
 				TokenURL:   authS.GetOauth2ClientCredentials().TokenURL,
 			})
+			middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+				Type:       middlewares.AuthInjectionOAuth2ClientCredentials,
+				SecretName: authS.GetOauth2ClientCredentials().GetClientSecret().GetFromSecret(),
+				Err:        err,
+			})
 			if err == nil {
 				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 			} else {
@@ -193,6 +216,12 @@ func (m *middleware) setRequestHeaders(req *http.Request, reqCtx *middlewares.Re
 		svcCfg.GetKubernetes().GetBearerToken().GetFromSecret() != "" {
 		tknSecret, err := m.secretMan.GetByName(ctx,
 			svcCfg.GetKubernetes().GetBearerToken().GetFromSecret())
+		middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+			Type:       middlewares.AuthInjectionKubernetes,
+			SecretName: svcCfg.GetKubernetes().GetBearerToken().GetFromSecret(),
+			Secret:     tknSecret,
+			Err:        err,
+		})
 		if err != nil {
 			zap.L().Debug("Could not get k8s token secret", zap.Error(err))
 		} else {
@@ -204,6 +233,12 @@ func (m *middleware) setRequestHeaders(req *http.Request, reqCtx *middlewares.Re
 		svcCfg.GetKubernetes().GetKubeconfig().GetFromSecret() != "" {
 		kubeConfigSecret, err := m.secretMan.GetByName(ctx,
 			svcCfg.GetKubernetes().GetKubeconfig().GetFromSecret())
+		middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+			Type:       middlewares.AuthInjectionKubernetes,
+			SecretName: svcCfg.GetKubernetes().GetKubeconfig().GetFromSecret(),
+			Secret:     kubeConfigSecret,
+			Err:        err,
+		})
 		if err != nil {
 			zap.L().Debug("Could not get kubeconfig secret", zap.Error(err))
 		} else {
@@ -311,7 +346,7 @@ func (m *middleware) postRequestModifyResponseHeaders(rw http.ResponseWriter, re
 
 	}
 
-	rwHdr.Set("Server", "octelium")
+	middlewares.SetServerHeader(rwHdr, svcCfg.GetHttp())
 }
 
 func (m *middleware) isOriginAllowed(origin string, allowOriginList []string) (bool, string) {
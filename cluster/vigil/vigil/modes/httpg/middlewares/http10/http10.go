@@ -0,0 +1,206 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package http10
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/pkg/errors"
+)
+
+type middleware struct {
+	next http.Handler
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	return &middleware{
+		next: next,
+	}, nil
+}
+
+const defaultMaxBufferSize = 4 * 1024 * 1024
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.ProtoMajor != 1 || req.ProtoMinor != 0 {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig.GetHttp().GetHttp10()
+	if cfg.GetIsDisabled() {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	// HTTP/1.0 has no protocol upgrades.
+	removeUpgrade(req.Header)
+
+	maxBufferSize := defaultMaxBufferSize
+	if cfg.GetMaxBufferSize() > 0 {
+		maxBufferSize = int(cfg.MaxBufferSize)
+	}
+
+	crw := &responseWriter{
+		ResponseWriter: w,
+		maxBufferSize:  maxBufferSize,
+		isBuffering:    req.Method != http.MethodHead,
+	}
+
+	m.next.ServeHTTP(crw, req)
+	crw.finish()
+}
+
+// responseWriter buffers the response until it completes so that it is sent
+// with a Content-Length since HTTP/1.0 clients do not understand chunked
+// encoding. Responses larger than maxBufferSize are streamed instead and
+// terminated by closing the connection.
+type responseWriter struct {
+	http.ResponseWriter
+	maxBufferSize int
+	isBuffering   bool
+	statusCode    int
+	wroteHeader   bool
+	isHijacked    bool
+	buf           []byte
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || w.statusCode != 0 {
+		return
+	}
+
+	// HTTP/1.0 clients do not understand informational responses.
+	if statusCode < 200 {
+		return
+	}
+
+	w.statusCode = statusCode
+	w.Header().Set("Connection", "close")
+
+	if !w.isBuffering || w.Header().Get("Content-Length") != "" ||
+		statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		w.writeHeader()
+	}
+}
+
+func (w *responseWriter) writeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.isBuffering = false
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+		w.Header().Set("Connection", "close")
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.isBuffering {
+		return w.ResponseWriter.Write(b)
+	}
+
+	if len(w.buf)+len(b) <= w.maxBufferSize {
+		w.buf = append(w.buf, b...)
+		return len(b), nil
+	}
+
+	if err := w.flushBuffer(); err != nil {
+		return 0, err
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) flushBuffer() error {
+	w.writeHeader()
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *responseWriter) finish() {
+	if w.wroteHeader || w.isHijacked {
+		return
+	}
+
+	if w.isBuffering {
+		w.Header().Set("Content-Length", strconv.Itoa(len(w.buf)))
+	}
+	w.flushBuffer()
+}
+
+// Flush is a no-op while the response is buffered.
+func (w *responseWriter) Flush() {
+	if w.isBuffering {
+		return
+	}
+
+	w.writeHeader()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.Errorf("ResponseWriter is not a Hijacker")
+	}
+
+	w.isHijacked = true
+	return hj.Hijack()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func removeUpgrade(hdr http.Header) {
+	hdr.Del("Upgrade")
+
+	var tokens []string
+	for _, val := range hdr.Values("Connection") {
+		for _, token := range strings.Split(val, ",") {
+			token = strings.TrimSpace(token)
+			if token != "" && !strings.EqualFold(token, "upgrade") {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	hdr.Del("Connection")
+	if len(tokens) > 0 {
+		hdr.Set("Connection", strings.Join(tokens, ", "))
+	}
+}
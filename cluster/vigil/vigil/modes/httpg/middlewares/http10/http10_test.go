@@ -0,0 +1,132 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package http10
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var cfg atomic.Pointer[corev1.Service_Spec_Config_HTTP_HTTP10]
+	var upgrade atomic.Value
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrade.Store(r.Header.Get("Upgrade"))
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	mdlwr, err := New(context.Background(), next)
+	assert.Nil(t, err)
+
+	srv := httptest.NewUnstartedServer(mdlwr)
+	srv.Config.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, middlewares.CtxRequestContext, &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Conn:      c,
+			ServiceConfig: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: &corev1.Service_Spec_Config_HTTP{
+						Http10: cfg.Load(),
+					},
+				},
+			},
+		})
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	doRequest := func(proto string, extraHeaders string) (*http.Response, string, bool) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		assert.Nil(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		_, err = fmt.Fprintf(conn, "GET / %s\r\nHost: localhost\r\n%s\r\n", proto, extraHeaders)
+		assert.Nil(t, err)
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		assert.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		resp.Body.Close()
+
+		_, err = br.ReadByte()
+		return resp, string(body), err == io.EOF
+	}
+
+	{
+		resp, body, isClosed := doRequest("HTTP/1.0",
+			"Connection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "chunkchunkchunkchunk", body)
+		assert.Equal(t, int64(20), resp.ContentLength)
+		assert.Equal(t, "close", resp.Header.Get("Connection"))
+		assert.True(t, isClosed)
+		assert.Equal(t, "", upgrade.Load())
+	}
+
+	{
+		resp, body, _ := doRequest("HTTP/1.1", "Connection: close\r\n")
+		assert.Equal(t, "chunkchunkchunkchunk", body)
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	}
+
+	{
+		cfg.Store(&corev1.Service_Spec_Config_HTTP_HTTP10{
+			MaxBufferSize: 12,
+		})
+		resp, body, isClosed := doRequest("HTTP/1.0", "")
+		assert.Equal(t, "chunkchunkchunkchunk", body)
+		assert.Equal(t, int64(-1), resp.ContentLength)
+		assert.True(t, isClosed)
+	}
+
+	{
+		cfg.Store(&corev1.Service_Spec_Config_HTTP_HTTP10{
+			IsDisabled: true,
+		})
+		resp, body, _ := doRequest("HTTP/1.0", "Upgrade: websocket\r\n")
+		assert.Equal(t, "chunkchunkchunkchunk", body)
+		assert.Equal(t, int64(-1), resp.ContentLength)
+		assert.Equal(t, "websocket", upgrade.Load())
+	}
+}
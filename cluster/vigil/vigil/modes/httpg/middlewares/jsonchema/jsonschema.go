@@ -98,7 +98,7 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			for k, v := range jsonSchemaC.Headers {
 				rw.Header().Set(k, v)
 			}
-			rw.Header().Set("Server", "octelium")
+			middlewares.SetServerHeader(rw.Header(), cfg.GetHttp())
 
 			if jsonSchemaC.StatusCode >= 200 && jsonSchemaC.StatusCode < 600 {
 				rw.WriteHeader(int(jsonSchemaC.StatusCode))
@@ -0,0 +1,118 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package keepalive
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"slices"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/pkg/errors"
+)
+
+type middleware struct {
+	next    http.Handler
+	tracker *Tracker
+}
+
+func New(ctx context.Context, next http.Handler, tracker *Tracker) (http.Handler, error) {
+	return &middleware{
+		next:    next,
+		tracker: tracker,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig.GetHttp().GetClientKeepAlive()
+	if cfg == nil || reqCtx.Conn == nil {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	crw := &responseWriter{
+		ResponseWriter: w,
+		cfg:            cfg,
+	}
+
+	if cfg.MaxRequests > 0 && m.tracker.addRequest(reqCtx.Conn) >= cfg.MaxRequests {
+		crw.closeConn = true
+	}
+
+	m.next.ServeHTTP(crw, req)
+}
+
+// responseWriter sets "Connection: close" on the response whenever the
+// connection must be closed. The HTTP/1.x server then closes the connection
+// once the response is written, while the HTTP/2 server sends a GOAWAY.
+type responseWriter struct {
+	http.ResponseWriter
+	cfg         *corev1.Service_Spec_Config_HTTP_ClientKeepAlive
+	closeConn   bool
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader && statusCode >= 200 {
+		w.wroteHeader = true
+		if w.closeConn || shouldCloseOnStatus(w.cfg, statusCode) {
+			w.Header().Set("Connection", "close")
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.Errorf("ResponseWriter is not a Hijacker")
+	}
+
+	return hj.Hijack()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func shouldCloseOnStatus(cfg *corev1.Service_Spec_Config_HTTP_ClientKeepAlive, statusCode int) bool {
+	if cfg.CloseOnServerErrors && statusCode >= 500 && statusCode < 600 {
+		return true
+	}
+
+	return slices.Contains(cfg.CloseOnStatusCodes, int32(statusCode))
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package keepalive
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+type tstServer struct {
+	srv    *httptest.Server
+	cfg    *corev1.Service_Spec_Config_HTTP_ClientKeepAlive
+	conns  atomic.Int32
+	closed atomic.Int32
+}
+
+func newTstServer(t *testing.T, cfg *corev1.Service_Spec_Config_HTTP_ClientKeepAlive) *tstServer {
+	ret := &tstServer{
+		cfg: cfg,
+	}
+
+	tracker := NewTracker(func() *corev1.Service_Spec_Config_HTTP_ClientKeepAlive {
+		return ret.cfg
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	mdlwr, err := New(context.Background(), next, tracker)
+	assert.Nil(t, err)
+
+	ret.srv = httptest.NewUnstartedServer(mdlwr)
+	ret.srv.Config.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, middlewares.CtxRequestContext, &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Conn:      c,
+			ServiceConfig: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: &corev1.Service_Spec_Config_HTTP{
+						ClientKeepAlive: ret.cfg,
+					},
+				},
+			},
+		})
+	}
+	ret.srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			ret.conns.Add(1)
+		case http.StateClosed:
+			ret.closed.Add(1)
+		}
+		tracker.ConnState(c, state)
+	}
+	ret.srv.Start()
+
+	t.Cleanup(func() {
+		ret.srv.Close()
+		tracker.Close()
+	})
+
+	return ret
+}
+
+func (s *tstServer) do(t *testing.T, client *http.Client, path string) *http.Response {
+	resp, err := client.Get(s.srv.URL + path)
+	assert.Nil(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestMiddleware(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		srv := newTstServer(t, &corev1.Service_Spec_Config_HTTP_ClientKeepAlive{
+			MaxRequests: 2,
+		})
+		client := srv.srv.Client()
+
+		assert.False(t, srv.do(t, client, "/").Close)
+		assert.True(t, srv.do(t, client, "/").Close)
+		assert.False(t, srv.do(t, client, "/").Close)
+		assert.True(t, srv.do(t, client, "/").Close)
+		srv.do(t, client, "/")
+
+		assert.Equal(t, int32(3), srv.conns.Load())
+	}
+
+	{
+		srv := newTstServer(t, &corev1.Service_Spec_Config_HTTP_ClientKeepAlive{
+			CloseOnServerErrors: true,
+			CloseOnStatusCodes:  []int32{http.StatusNotFound},
+		})
+		client := srv.srv.Client()
+
+		assert.False(t, srv.do(t, client, "/").Close)
+		assert.False(t, srv.do(t, client, "/").Close)
+		assert.Equal(t, int32(1), srv.conns.Load())
+
+		resp := srv.do(t, client, "/error")
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		assert.True(t, resp.Close)
+
+		assert.False(t, srv.do(t, client, "/").Close)
+		assert.Equal(t, int32(2), srv.conns.Load())
+	}
+
+	{
+		srv := newTstServer(t, &corev1.Service_Spec_Config_HTTP_ClientKeepAlive{
+			IdleTimeout: &metav1.Duration{
+				Type: &metav1.Duration_Milliseconds{
+					Milliseconds: 50,
+				},
+			},
+		})
+		client := srv.srv.Client()
+
+		srv.do(t, client, "/")
+		assert.Eventually(t, func() bool {
+			return srv.closed.Load() == 1
+		}, 2*time.Second, 10*time.Millisecond)
+
+		srv.do(t, client, "/")
+		assert.Equal(t, int32(2), srv.conns.Load())
+	}
+
+	{
+		srv := newTstServer(t, nil)
+		client := srv.srv.Client()
+
+		for range 5 {
+			assert.False(t, srv.do(t, client, "/error").Close)
+		}
+		assert.Equal(t, int32(1), srv.conns.Load())
+	}
+}
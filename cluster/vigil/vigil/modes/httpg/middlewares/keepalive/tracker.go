@@ -0,0 +1,139 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package keepalive
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+)
+
+type connInfo struct {
+	requests uint32
+	timer    *time.Timer
+	isActive bool
+}
+
+// Tracker tracks the state of the client connections in order to close the
+// idle ones and to count the requests served over each connection.
+type Tracker struct {
+	mu     sync.Mutex
+	conns  map[net.Conn]*connInfo
+	getCfg func() *corev1.Service_Spec_Config_HTTP_ClientKeepAlive
+}
+
+// NewTracker returns a Tracker that obtains the current keep-alive config
+// using getCfg.
+func NewTracker(getCfg func() *corev1.Service_Spec_Config_HTTP_ClientKeepAlive) *Tracker {
+	return &Tracker{
+		conns:  make(map[net.Conn]*connInfo),
+		getCfg: getCfg,
+	}
+}
+
+// ConnState is meant to be set as the http.Server ConnState hook.
+func (t *Tracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch state {
+	case http.StateNew:
+		t.conns[c] = &connInfo{}
+	case http.StateActive:
+		if info, ok := t.conns[c]; ok {
+			info.isActive = true
+			if info.timer != nil {
+				info.timer.Stop()
+				info.timer = nil
+			}
+		}
+	case http.StateIdle:
+		info, ok := t.conns[c]
+		if !ok {
+			return
+		}
+		info.isActive = false
+
+		idleTimeout := umetav1.ToDuration(t.getCfg().GetIdleTimeout()).ToGo()
+		if idleTimeout <= 0 {
+			return
+		}
+
+		if info.timer != nil {
+			info.timer.Stop()
+		}
+		info.timer = time.AfterFunc(idleTimeout, func() {
+			c.Close()
+		})
+	case http.StateHijacked, http.StateClosed:
+		if info, ok := t.conns[c]; ok {
+			if info.timer != nil {
+				info.timer.Stop()
+			}
+			delete(t.conns, c)
+		}
+	}
+}
+
+// addRequest counts a new request of the connection and returns the number
+// of the requests served so far including that one.
+func (t *Tracker) addRequest(c net.Conn) uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, ok := t.conns[c]
+	if !ok {
+		return 0
+	}
+
+	info.requests++
+	return info.requests
+}
+
+// Connections returns the number of the tracked connections and of those
+// that are active, i.e. serving a request.
+func (t *Tracker) Connections() (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	active := 0
+	for _, info := range t.conns {
+		if info.isActive {
+			active++
+		}
+	}
+
+	return len(t.conns), active
+}
+
+// Close stops the idle timers. The idle connections are closed by the
+// http.Server shutdown itself.
+func (t *Tracker) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for c, info := range t.conns {
+		if info.timer != nil {
+			info.timer.Stop()
+		}
+		delete(t.conns, c)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+)
+
+const HeaderLimited = "X-Octelium-Limited"
+
+const (
+	LimitedRateLimit   = "rateLimit"
+	LimitedClientLimit = "clientLimit"
+)
+
+// WriteLimitedResponse responds to a request rejected locally by the rate
+// limiting. The reason is exposed to the client in the HeaderLimited header.
+// The headers and the body, if set, are the ones of the rejecting limit and
+// take precedence over the Service's LimitResponse. Without a LimitResponse
+// config, the response has no body as before.
+func WriteLimitedResponse(w http.ResponseWriter, req *http.Request,
+	httpCfg *corev1.Service_Spec_Config_HTTP, reason string, statusCode int,
+	headers map[string]string, body []byte) {
+	cfg := httpCfg.GetLimitResponse().GetRateLimited()
+
+	hdr := w.Header()
+	SetServerHeader(hdr, httpCfg)
+	hdr.Set(HeaderLimited, reason)
+
+	if val := umetav1.ToDuration(cfg.GetRetryAfter()).ToGo(); val > 0 {
+		hdr.Set("Retry-After", strconv.Itoa(int(math.Ceil(val.Seconds()))))
+	}
+
+	for k, v := range cfg.GetHeaders() {
+		hdr.Set(k, v)
+	}
+	for k, v := range headers {
+		hdr.Set(k, v)
+	}
+
+	switch {
+	case len(body) > 0:
+		w.WriteHeader(statusCode)
+		w.Write(body)
+	case cfg.GetBody() != "":
+		if cfg.ContentType != "" {
+			hdr.Set("Content-Type", cfg.ContentType)
+		}
+		w.WriteHeader(statusCode)
+		w.Write([]byte(cfg.Body))
+	case cfg != nil:
+		WriteErrorResponse(w, req, cfg.Format, statusCode)
+	default:
+		w.WriteHeader(statusCode)
+	}
+}
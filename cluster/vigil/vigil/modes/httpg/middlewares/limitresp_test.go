@@ -0,0 +1,104 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLimitedResponse(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	doWrite := func(cfg *corev1.Service_Spec_Config_HTTP_LimitResponse_Response,
+		headers map[string]string, body []byte) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		WriteLimitedResponse(rw, httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil),
+			&corev1.Service_Spec_Config_HTTP{
+				LimitResponse: &corev1.Service_Spec_Config_HTTP_LimitResponse{
+					RateLimited: cfg,
+				},
+			}, LimitedRateLimit, http.StatusTooManyRequests, headers, body)
+		return rw
+	}
+
+	{
+		rw := doWrite(nil, nil, nil)
+		assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+		assert.Equal(t, LimitedRateLimit, rw.Header().Get(HeaderLimited))
+		assert.Equal(t, "octelium", rw.Header().Get("Server"))
+		assert.Equal(t, "", rw.Header().Get("Retry-After"))
+		assert.Equal(t, 0, rw.Body.Len())
+	}
+
+	{
+		rw := doWrite(&corev1.Service_Spec_Config_HTTP_LimitResponse_Response{
+			Format: corev1.Service_Spec_Config_HTTP_ErrorResponse_PROBLEM_JSON,
+			RetryAfter: &metav1.Duration{
+				Type: &metav1.Duration_Milliseconds{
+					Milliseconds: 1500,
+				},
+			},
+			Headers: map[string]string{
+				"X-Custom": "svc",
+			},
+		}, nil, nil)
+		assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+		assert.Equal(t, "2", rw.Header().Get("Retry-After"))
+		assert.Equal(t, "svc", rw.Header().Get("X-Custom"))
+		assert.Equal(t, "application/problem+json", rw.Header().Get("Content-Type"))
+
+		res := &ProblemDetails{}
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), res))
+		assert.Equal(t, http.StatusTooManyRequests, res.Status)
+		assert.Equal(t, "/v1", res.Instance)
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_LimitResponse_Response{
+		Body:        `{"error":"slow down"}`,
+		ContentType: "application/json",
+		Headers: map[string]string{
+			"X-Custom": "svc",
+		},
+	}
+
+	{
+		rw := doWrite(cfg, nil, nil)
+		assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+		assert.Equal(t, `{"error":"slow down"}`, rw.Body.String())
+	}
+
+	{
+		rw := doWrite(cfg, map[string]string{
+			"X-Custom": "plugin",
+		}, []byte("plugin body"))
+		assert.Equal(t, "plugin", rw.Header().Get("X-Custom"))
+		assert.Equal(t, "plugin body", rw.Body.String())
+	}
+}
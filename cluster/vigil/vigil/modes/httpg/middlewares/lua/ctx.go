@@ -17,6 +17,7 @@
 package lua
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -39,6 +40,7 @@ type luaCtx struct {
 	fnProto      *lua.FunctionProto
 	reqCtxLValue lua.LValue
 	isExit       bool
+	timeout      time.Duration
 }
 
 type newCtxOpts struct {
@@ -46,8 +48,26 @@ type newCtxOpts struct {
 	rw           *responseWriter
 	fnProto      *lua.FunctionProto
 	reqCtxLValue lua.LValue
+	timeout      time.Duration
 }
 
+const defaultTimeout = 500 * time.Millisecond
+
+// The sandbox limits of every Lua state. Exceeding any of them raises an
+// error that aborts the script execution.
+const (
+	callStackSize   = 256
+	registrySize    = 1024 * 16
+	registryMaxSize = 1024 * 128
+)
+
+// maxValueSize caps the size of the strings exchanged between a script and
+// Vigil, i.e. the request and response bodies as well as the JSON documents.
+// gopher-lua does not account for the memory allocated within the VM itself,
+// the string concatenations and the table growth of a script are therefore
+// only bounded by its execution timeout.
+const maxValueSize = 8 * 1024 * 1024
+
 var jsonCompiler = jsonschema.NewCompiler()
 
 func newCtx(o *newCtxOpts) (*luaCtx, error) {
@@ -57,11 +77,19 @@ func newCtx(o *newCtxOpts) (*luaCtx, error) {
 		rw:           o.rw,
 		fnProto:      o.fnProto,
 		reqCtxLValue: o.reqCtxLValue,
+		timeout:      o.timeout,
 	}
+	if ret.timeout <= 0 {
+		ret.timeout = defaultTimeout
+	}
+
 	ret.state = lua.NewState(lua.Options{
-		SkipOpenLibs: true,
+		SkipOpenLibs:        true,
+		CallStackSize:       callStackSize,
+		RegistrySize:        registrySize,
+		RegistryMaxSize:     registryMaxSize,
+		MinimizeStackMemory: true,
 	})
-	ret.state.SetContext(o.req.Context())
 
 	// lua.OpenString(ret.state)
 	lua.OpenMath(ret.state)
@@ -82,7 +110,20 @@ func (l *luaCtx) close() {
 	}
 }
 
+// withTimeout bounds the execution of the Lua VM by the script timeout so
+// that a misbehaving script cannot block the request path.
+func (c *luaCtx) withTimeout() context.CancelFunc {
+	ctx, cancel := context.WithTimeout(c.req.Context(), c.timeout)
+	c.state.SetContext(ctx)
+	return func() {
+		cancel()
+		c.state.RemoveContext()
+	}
+}
+
 func (c *luaCtx) loadFromProto() error {
+	defer c.withTimeout()()
+
 	lfunc := c.state.NewFunctionFromProto(c.fnProto)
 	c.state.Push(lfunc)
 	return c.state.PCall(0, lua.MultRet, nil)
@@ -95,6 +136,8 @@ func (c *luaCtx) callOnRequest() error {
 		return errors.Errorf("onRequest function is not defined")
 	}
 
+	defer c.withTimeout()()
+
 	startedAt := time.Now()
 	c.state.Push(f)
 	c.state.Push(c.reqCtxLValue)
@@ -115,6 +158,8 @@ func (c *luaCtx) callOnResponse() error {
 		return errors.Errorf("onResponse function is not defined")
 	}
 
+	defer c.withTimeout()()
+
 	startedAt := time.Now()
 	c.state.Push(f)
 	c.state.Push(c.reqCtxLValue)
@@ -128,6 +173,14 @@ func (c *luaCtx) callOnResponse() error {
 	return nil
 }
 
+// checkValueSize raises an error that aborts the script if a value exchanged
+// with the script exceeds maxValueSize.
+func checkValueSize(L *lua.LState, size int) {
+	if size > maxValueSize {
+		L.RaiseError("Value size %d exceeds the limit of %d bytes", size, maxValueSize)
+	}
+}
+
 func (c *luaCtx) jsonEncode(L *lua.LState) int {
 
 	val := L.Get(1)
@@ -139,6 +192,7 @@ func (c *luaCtx) jsonEncode(L *lua.LState) int {
 		return 2
 	}
 
+	checkValueSize(L, len(res))
 	L.Push(lua.LString(string(res)))
 
 	return 1
@@ -153,6 +207,8 @@ func (c *luaCtx) jsonDecode(L *lua.LState) int {
 		return 1
 	}
 
+	checkValueSize(L, len(jsonVal.String()))
+
 	var goVal any
 
 	if err := json.Unmarshal([]byte(jsonVal.String()), &goVal); err != nil {
@@ -169,10 +225,12 @@ func (c *luaCtx) jsonDecode(L *lua.LState) int {
 func (c *luaCtx) jsonIsSchemaValid(L *lua.LState) int {
 
 	jsonSchema := L.CheckString(1)
+	jsonDoc := L.CheckString(2)
+	checkValueSize(L, len(jsonSchema)+len(jsonDoc))
 
 	var goVal any
 
-	if err := json.Unmarshal([]byte(L.CheckString(2)), &goVal); err != nil {
+	if err := json.Unmarshal([]byte(jsonDoc), &goVal); err != nil {
 		L.Push(lua.LBool(false))
 		return 1
 	}
@@ -220,3 +220,166 @@ end
 		assert.Equal(t, "octelium", reqCtx2.User.Metadata.Name)
 	}
 }
+
+func TestLuaTimeout(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	mdlwr := &middleware{
+		cMap: make(map[string]*lua.FunctionProto),
+	}
+
+	getReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		return req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, &middlewares.RequestContext{
+				CreatedAt: time.Now()}))
+	}
+
+	reqCtxLVal := mdlwr.getRequestContextLValue(&corev1.RequestContext{})
+
+	{
+		fnProto, err := mdlwr.doGetAndSetLuaFnProto(`
+function onRequest(ctx)
+  while true do end
+end
+`)
+		assert.Nil(t, err)
+
+		luaCtx, err := newCtx(&newCtxOpts{
+			req:          getReq(),
+			fnProto:      fnProto,
+			reqCtxLValue: reqCtxLVal,
+			rw:           newResponseWriter(httptest.NewRecorder()),
+			timeout:      50 * time.Millisecond,
+		})
+		assert.Nil(t, err)
+		defer luaCtx.close()
+
+		startedAt := time.Now()
+		err = luaCtx.callOnRequest()
+		assert.NotNil(t, err)
+		assert.True(t, time.Since(startedAt) < 2*time.Second)
+	}
+
+	{
+		fnProto, err := mdlwr.doGetAndSetLuaFnProto(`
+while true do end
+`)
+		assert.Nil(t, err)
+
+		_, err = newCtx(&newCtxOpts{
+			req:          getReq(),
+			fnProto:      fnProto,
+			reqCtxLValue: reqCtxLVal,
+			rw:           newResponseWriter(httptest.NewRecorder()),
+			timeout:      50 * time.Millisecond,
+		})
+		assert.NotNil(t, err)
+	}
+}
+
+func TestLuaValueSize(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	mdlwr := &middleware{
+		cMap: make(map[string]*lua.FunctionProto),
+	}
+
+	reqCtxLVal := mdlwr.getRequestContextLValue(&corev1.RequestContext{})
+
+	doNewCtx := func(script string, body []byte) *luaCtx {
+		fnProto, err := mdlwr.doGetAndSetLuaFnProto(script)
+		assert.Nil(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/", bytes.NewReader(body))
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, &middlewares.RequestContext{
+				CreatedAt: time.Now()}))
+
+		luaCtx, err := newCtx(&newCtxOpts{
+			req:          req,
+			fnProto:      fnProto,
+			reqCtxLValue: reqCtxLVal,
+			rw:           newResponseWriter(httptest.NewRecorder()),
+			timeout:      5 * time.Second,
+		})
+		assert.Nil(t, err)
+		return luaCtx
+	}
+
+	{
+		body := bytes.Repeat([]byte("a"), maxValueSize+1)
+		luaCtx := doNewCtx(`
+function onRequest(ctx)
+  octelium.req.setRequestHeader("X-Body", "read")
+  octelium.req.getRequestBody()
+  octelium.req.setRequestHeader("X-Body", "done")
+end
+`, body)
+		defer luaCtx.close()
+
+		assert.NotNil(t, luaCtx.callOnRequest())
+		assert.Equal(t, "read", luaCtx.req.Header.Get("X-Body"))
+
+		reqBody, err := io.ReadAll(luaCtx.req.Body)
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(body, reqBody))
+	}
+
+	{
+		luaCtx := doNewCtx(`
+function onResponse(ctx)
+  local body = "a"
+  for i = 1, 24 do
+    body = body..body
+  end
+  octelium.req.setResponseBody(body)
+end
+`, nil)
+		defer luaCtx.close()
+
+		luaCtx.rw.body.Write([]byte("upstream"))
+		assert.NotNil(t, luaCtx.callOnResponse())
+		assert.False(t, luaCtx.rw.isSet)
+		assert.Equal(t, "upstream", luaCtx.rw.body.String())
+	}
+
+	{
+		luaCtx := doNewCtx(`
+function onRequest(ctx)
+  local body = "a"
+  for i = 1, 24 do
+    body = body..body
+  end
+  json.decode(body)
+end
+`, nil)
+		defer luaCtx.close()
+
+		assert.NotNil(t, luaCtx.callOnRequest())
+	}
+
+	{
+		luaCtx := doNewCtx(`
+function onRequest(ctx)
+  octelium.req.setRequestBody(json.encode({key = "value"}))
+end
+`, nil)
+		defer luaCtx.close()
+
+		assert.Nil(t, luaCtx.callOnRequest())
+		reqBody, err := io.ReadAll(luaCtx.req.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"key":"value"}`, string(reqBody))
+	}
+}
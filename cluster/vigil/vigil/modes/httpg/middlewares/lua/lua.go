@@ -33,8 +33,10 @@ import (
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/cluster/common/celengine"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/commonplugin"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
 	"github.com/octelium/octelium/pkg/common/pbutils"
 	lua "github.com/yuin/gopher-lua"
 )
@@ -71,6 +73,8 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	crw := newResponseWriter(rw)
 	reqCtxVal := m.getRequestContextLValue(reqCtx.DownstreamInfo)
 
+	var decoded *httputils.DecodedResponseBody
+
 	doAfterResponse := func() {
 
 		/*
@@ -86,10 +90,11 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		*/
 
 		{
-			crw.ResponseWriter.Header().Set("Content-Length", fmt.Sprintf("%d", len(crw.body.Bytes())))
+			body := decoded.Restore(crw.ResponseWriter.Header(), crw.body.Bytes(), crw.isSet)
+			httputils.SetContentLength(crw.ResponseWriter.Header(), len(body))
 			crw.ResponseWriter.WriteHeader(crw.statusCode)
 
-			if _, err := crw.ResponseWriter.Write(crw.body.Bytes()); err != nil {
+			if _, err := crw.ResponseWriter.Write(body); err != nil {
 				zap.L().Warn("Could not write to lua crw", zap.Error(err))
 			}
 		}
@@ -120,6 +125,7 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 				rw:           crw,
 				fnProto:      fnProto,
 				reqCtxLValue: reqCtxVal,
+				timeout:      umetav1.ToDuration(plugin.GetLua().Timeout).ToGo(),
 			})
 			if err != nil {
 				continue
@@ -146,6 +152,12 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	m.next.ServeHTTP(crw, req)
 
+	if body, d := httputils.DecodeResponseBody(crw.Header(),
+		crw.body.Bytes(), httputils.MaxDecodedBodySize); d != nil {
+		crw.body = bytes.NewBuffer(body)
+		decoded = d
+	}
+
 	for _, luaCtx := range luaContexts {
 		if err := luaCtx.callOnResponse(); err != nil {
 			zap.L().Debug("Could not callOnResponse", zap.Error(err))
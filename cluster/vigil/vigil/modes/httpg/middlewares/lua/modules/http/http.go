@@ -62,10 +62,15 @@ var fns = map[string]lua.LGFunction{
 	"client": doClientNew,
 }
 
+// maxResponseBodySize caps the size of the response bodies read into the
+// script.
+const maxResponseBodySize = 8 * 1024 * 1024
+
 func doClientNew(L *lua.LState) int {
 	c := resty.New().
 		SetHeader("User-Agent", "octelium").
 		SetTimeout(6 * time.Second).
+		SetResponseBodyLimit(maxResponseBodySize).
 		SetDebug(ldflags.IsTest())
 
 	ud := L.NewUserData()
@@ -22,6 +22,7 @@ import (
 	"io"
 	"strconv"
 
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
 	lua "github.com/yuin/gopher-lua"
 )
@@ -60,10 +61,10 @@ func (c *luaCtx) setRequestBody(L *lua.LState) int {
 		return 1
 	}
 
+	checkValueSize(L, len(bodyBytesStr))
 	bodyBytes := []byte(bodyBytesStr)
 
-	c.req.Body = io.NopCloser(bytes.NewBuffer([]byte(bodyBytes)))
-	c.req.ContentLength = int64(len(bodyBytes))
+	httputils.SetRequestBody(c.req, bodyBytes)
 
 	if reqCtx := middlewares.GetCtxRequestContext(c.req.Context()); reqCtx != nil {
 		reqCtx.Body = bodyBytes
@@ -122,6 +123,7 @@ func (c *luaCtx) setResponseBody(L *lua.LState) int {
 		return 1
 	}
 
+	checkValueSize(L, len(bodyBytesStr))
 	bodyBytes := []byte(bodyBytesStr)
 
 	c.rw.body.Reset()
@@ -131,22 +133,35 @@ func (c *luaCtx) setResponseBody(L *lua.LState) int {
 	return 0
 }
 func (c *luaCtx) getRequestBody(L *lua.LState) int {
-	bodyBytes, err := io.ReadAll(c.req.Body)
+	bodyBytes, err := io.ReadAll(io.LimitReader(c.req.Body, maxValueSize+1))
 	if err != nil {
 		L.Push(lua.LNil)
 		L.Push(lua.LString(err.Error()))
 		return 2
 	}
 
+	if len(bodyBytes) > maxValueSize {
+		// Keep the body intact for the upstream before aborting the script
+		c.req.Body = struct {
+			io.Reader
+			io.Closer
+		}{
+			Reader: io.MultiReader(bytes.NewReader(bodyBytes), c.req.Body),
+			Closer: c.req.Body,
+		}
+		checkValueSize(L, len(bodyBytes))
+	}
+
 	defer c.req.Body.Close()
 	body := string(bodyBytes)
-	c.req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	httputils.SetRequestBody(c.req, bodyBytes)
 	L.Push(lua.LString(body))
 
 	return 1
 }
 
 func (c *luaCtx) getResponseBody(L *lua.LState) int {
+	checkValueSize(L, c.rw.body.Len())
 	L.Push(lua.LString(c.rw.body.String()))
 	return 1
 }
@@ -0,0 +1,87 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package methodoverride
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+)
+
+type middleware struct {
+	next http.Handler
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	return &middleware{
+		next: next,
+	}, nil
+}
+
+const headerName = "X-HTTP-Method-Override"
+
+// allowedMethods are the only methods that a POST request can be overridden
+// to. Overriding to a safe method, e.g. GET, would let a POST request bypass
+// the policies, caching and CSRF protections that treat the safe methods
+// differently.
+var allowedMethods = []string{
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	overrideCfg := reqCtx.ServiceConfig.GetHttp().GetMethodOverride()
+
+	if overrideCfg == nil || !overrideCfg.IsEnabled {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	val := strings.ToUpper(strings.TrimSpace(req.Header.Get(headerName)))
+	req.Header.Del(headerName)
+
+	if val == "" || req.Method != http.MethodPost {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if !isAllowed(overrideCfg.AllowedMethods, val) {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	req.Method = val
+
+	m.next.ServeHTTP(rw, req)
+}
+
+// isAllowed reports whether the method is one of the configured methods, if
+// any, in addition to being one of allowedMethods.
+func isAllowed(configured []string, method string) bool {
+	if !slices.Contains(allowedMethods, method) {
+		return false
+	}
+
+	return len(configured) == 0 || slices.ContainsFunc(configured, func(cur string) bool {
+		return strings.EqualFold(cur, method)
+	})
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package methodoverride
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var method string
+	var overrideHdr string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		overrideHdr = r.Header.Get("X-HTTP-Method-Override")
+	})
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	newReq := func(method, override string, cfg *corev1.Service_Spec_Config_HTTP_MethodOverride) *http.Request {
+		req := httptest.NewRequest(method, "http://localhost/v1", nil)
+		if override != "" {
+			req.Header.Set("X-HTTP-Method-Override", override)
+		}
+		return req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service: &corev1.Service{
+					Spec: &corev1.Service_Spec{},
+				},
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							MethodOverride: cfg,
+						},
+					},
+				},
+			}))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(http.MethodPost, "DELETE", nil))
+		assert.Equal(t, http.MethodPost, method)
+		assert.Equal(t, "DELETE", overrideHdr)
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(http.MethodPost, "delete", &corev1.Service_Spec_Config_HTTP_MethodOverride{
+			IsEnabled: true,
+		}))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, http.MethodDelete, method)
+		assert.Equal(t, "", overrideHdr)
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(http.MethodGet, "DELETE", &corev1.Service_Spec_Config_HTTP_MethodOverride{
+			IsEnabled: true,
+		}))
+		assert.Equal(t, http.MethodGet, method)
+		assert.Equal(t, "", overrideHdr)
+	}
+
+	{
+		method = ""
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(http.MethodPost, "CONNECT", &corev1.Service_Spec_Config_HTTP_MethodOverride{
+			IsEnabled: true,
+		}))
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+		assert.Equal(t, "", method)
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(http.MethodPost, "PATCH", &corev1.Service_Spec_Config_HTTP_MethodOverride{
+			IsEnabled:      true,
+			AllowedMethods: []string{"PUT"},
+		}))
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	}
+
+	{
+		method = ""
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq(http.MethodPost, "GET", &corev1.Service_Spec_Config_HTTP_MethodOverride{
+			IsEnabled:      true,
+			AllowedMethods: []string{"GET", "PUT"},
+		}))
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+		assert.Equal(t, "", method)
+	}
+}
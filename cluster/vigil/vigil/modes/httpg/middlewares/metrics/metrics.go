@@ -55,6 +55,11 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	m.next.ServeHTTP(crw, req)
 
+	if reqCtx.IsClientDisconnected() {
+		crw.statusCode = 499
+		m.commonMetrics.AtClientDisconnect()
+	}
+
 	state := func() string {
 		switch {
 		case reqCtx.IsAuthorized || httputils.IsAnonymousMode(req):
@@ -141,3 +146,7 @@ func (p *responseWriter) Push(target string, opts *http.PushOptions) error {
 	}
 	return http.ErrNotSupported
 }
+
+func (r *responseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
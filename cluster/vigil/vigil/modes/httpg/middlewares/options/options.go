@@ -0,0 +1,135 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package options
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+)
+
+var defaultMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+type middleware struct {
+	next http.Handler
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	return &middleware{
+		next: next,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig.GetHttp().GetOptions()
+
+	if req.Method != http.MethodOptions || cfg == nil || !cfg.IsEnabled || isPreflight(req) {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	var methods []string
+	if IsAsterisk(req) {
+		methods = getAllMethods(cfg)
+	} else if cfg.Passthrough {
+		m.next.ServeHTTP(w, req)
+		return
+	} else {
+		methods = getMethods(cfg, req.URL.Path)
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// IsAsterisk reports whether the request is an "OPTIONS *" request which
+// applies to the server as a whole.
+func IsAsterisk(req *http.Request) bool {
+	return req.Method == http.MethodOptions && (req.RequestURI == "*" || req.URL.Path == "*")
+}
+
+func isPreflight(req *http.Request) bool {
+	return req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func getRoute(cfg *corev1.Service_Spec_Config_HTTP_Options, pth string) *corev1.Service_Spec_Config_HTTP_Options_Route {
+	var ret *corev1.Service_Spec_Config_HTTP_Options_Route
+	for _, route := range cfg.Routes {
+		if !strings.HasPrefix(pth, route.PathPrefix) {
+			continue
+		}
+		if ret == nil || len(route.PathPrefix) > len(ret.PathPrefix) {
+			ret = route
+		}
+	}
+
+	return ret
+}
+
+func getMethods(cfg *corev1.Service_Spec_Config_HTTP_Options, pth string) []string {
+	if route := getRoute(cfg, pth); route != nil && len(route.Methods) > 0 {
+		return normalizeMethods(route.Methods)
+	}
+
+	return getDefaultMethods(cfg)
+}
+
+func getDefaultMethods(cfg *corev1.Service_Spec_Config_HTTP_Options) []string {
+	if len(cfg.Methods) > 0 {
+		return normalizeMethods(cfg.Methods)
+	}
+
+	return defaultMethods
+}
+
+// getAllMethods returns the methods allowed by any route.
+func getAllMethods(cfg *corev1.Service_Spec_Config_HTTP_Options) []string {
+	ret := slices.Clone(getDefaultMethods(cfg))
+	for _, route := range cfg.Routes {
+		ret = append(ret, route.Methods...)
+	}
+
+	return normalizeMethods(ret)
+}
+
+// normalizeMethods returns the unique upper-cased methods. OPTIONS is always
+// allowed since it is answered by the proxy itself.
+func normalizeMethods(methods []string) []string {
+	var ret []string
+	for _, method := range methods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method != "" && method != http.MethodOptions && !slices.Contains(ret, method) {
+			ret = append(ret, method)
+		}
+	}
+
+	return append(ret, http.MethodOptions)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package options
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	doReq := func(cfg *corev1.Service_Spec_Config_HTTP_Options,
+		method, target string, hdrs map[string]string) *httptest.ResponseRecorder {
+		reached = false
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							Options: cfg,
+						},
+					},
+				},
+			}))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw
+	}
+
+	{
+		rw := doReq(nil, http.MethodOptions, "/", nil)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+	}
+
+	{
+		rw := doReq(&corev1.Service_Spec_Config_HTTP_Options{
+			IsEnabled: true,
+		}, http.MethodOptions, "/", nil)
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+		assert.False(t, reached)
+		assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS", rw.Header().Get("Allow"))
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_Options{
+		IsEnabled: true,
+		Methods:   []string{"get", "HEAD"},
+		Routes: []*corev1.Service_Spec_Config_HTTP_Options_Route{
+			{
+				PathPrefix: "/api",
+				Methods:    []string{"GET", "POST"},
+			},
+			{
+				PathPrefix: "/api/admin",
+				Methods:    []string{"DELETE"},
+			},
+		},
+	}
+
+	type tstCase struct {
+		target   string
+		expected string
+	}
+
+	for _, tc := range []tstCase{
+		{target: "/", expected: "GET, HEAD, OPTIONS"},
+		{target: "/api/users", expected: "GET, POST, OPTIONS"},
+		{target: "/api/admin/users", expected: "DELETE, OPTIONS"},
+		{target: "*", expected: "GET, HEAD, POST, DELETE, OPTIONS"},
+	} {
+		rw := doReq(cfg, http.MethodOptions, tc.target, nil)
+		assert.Equal(t, http.StatusNoContent, rw.Code, "%+v", tc)
+		assert.Equal(t, tc.expected, rw.Header().Get("Allow"), "%+v", tc)
+		assert.False(t, reached)
+	}
+
+	{
+		rw := doReq(cfg, http.MethodGet, "/api/users", nil)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+		assert.Equal(t, "", rw.Header().Get("Allow"))
+	}
+
+	{
+		rw := doReq(cfg, http.MethodOptions, "/api/users", map[string]string{
+			"Origin":                        "https://example.com",
+			"Access-Control-Request-Method": "POST",
+		})
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+	}
+
+	{
+		cfg.Passthrough = true
+		rw := doReq(cfg, http.MethodOptions, "/api/users", nil)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+
+		rw = doReq(cfg, http.MethodOptions, "*", nil)
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+		assert.False(t, reached)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pathnormalize
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type middleware struct {
+	next http.Handler
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	return &middleware{
+		next: next,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.Service.Spec.Config.GetHttp().GetPathNormalization()
+
+	if cfg == nil || !cfg.IsEnabled {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	escapedPath, err := normalize(req.URL.EscapedPath(), cfg.TrailingSlash)
+	if err != nil {
+		zap.L().Debug("Rejecting request path", zap.String("path", req.URL.EscapedPath()), zap.Error(err))
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	decodedPath, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req.URL.Path = decodedPath
+	req.URL.RawPath = escapedPath
+	req.RequestURI = req.URL.RequestURI()
+
+	m.next.ServeHTTP(rw, req)
+}
+
+var (
+	errPathEscape       = errors.New("Path escapes the root")
+	errHiddenDotSegment = errors.New("Path hides a dot segment behind an encoded separator")
+)
+
+// normalize collapses the duplicate slashes and resolves the dot segments of
+// the escaped path. The segments are kept escaped so that an encoded slash is
+// never turned into a separator. Since upstreams might still decode such
+// separators, the segments that would then become dot segments are rejected.
+func normalize(escapedPath string, trailingSlash corev1.Service_Spec_Config_HTTP_PathNormalization_TrailingSlash) (string, error) {
+	if escapedPath == "" || escapedPath[0] != '/' {
+		return escapedPath, nil
+	}
+
+	segments := strings.Split(escapedPath[1:], "/")
+	ret := make([]string, 0, len(segments))
+
+	for _, segment := range segments {
+		switch getDotSegment(segment) {
+		case ".":
+			continue
+		case "..":
+			if len(ret) == 0 {
+				return "", errPathEscape
+			}
+			ret = ret[:len(ret)-1]
+			continue
+		}
+
+		if segment == "" {
+			continue
+		}
+
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", err
+		}
+
+		for _, part := range strings.FieldsFunc(decoded, func(r rune) bool {
+			return r == '/' || r == '\\'
+		}) {
+			if part == "." || part == ".." {
+				return "", errHiddenDotSegment
+			}
+		}
+
+		ret = append(ret, segment)
+	}
+
+	if len(ret) == 0 {
+		return "/", nil
+	}
+
+	last := segments[len(segments)-1]
+	hasTrailingSlash := last == "" || getDotSegment(last) != ""
+
+	switch trailingSlash {
+	case corev1.Service_Spec_Config_HTTP_PathNormalization_STRIP:
+		hasTrailingSlash = false
+	case corev1.Service_Spec_Config_HTTP_PathNormalization_ADD:
+		hasTrailingSlash = true
+	}
+
+	if hasTrailingSlash {
+		return "/" + strings.Join(ret, "/") + "/", nil
+	}
+
+	return "/" + strings.Join(ret, "/"), nil
+}
+
+// getDotSegment returns the dot segment, if any, taking the percent-encoded
+// dots into account.
+func getDotSegment(segment string) string {
+	if len(segment) > 6 {
+		return ""
+	}
+
+	switch strings.ToLower(segment) {
+	case ".", "%2e":
+		return "."
+	case "..", ".%2e", "%2e.", "%2e%2e":
+		return ".."
+	default:
+		return ""
+	}
+}
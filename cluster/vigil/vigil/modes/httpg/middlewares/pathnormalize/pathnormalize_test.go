@@ -0,0 +1,165 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pathnormalize
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type tstCase struct {
+		path     string
+		expected string
+		trailing corev1.Service_Spec_Config_HTTP_PathNormalization_TrailingSlash
+		err      error
+	}
+
+	tstCases := []tstCase{
+		{path: "/", expected: "/"},
+		{path: "//", expected: "/"},
+		{path: "/a//b", expected: "/a/b"},
+		{path: "///a///b///", expected: "/a/b/"},
+		{path: "/a/./b", expected: "/a/b"},
+		{path: "/a/b/..", expected: "/a/"},
+		{path: "/a/b/../c", expected: "/a/c"},
+		{path: "/a/%2e/b", expected: "/a/b"},
+		{path: "/a/%2E%2e/b", expected: "/b"},
+		{path: "/a/.%2e/b", expected: "/b"},
+		{path: "/a/...", expected: "/a/..."},
+		{path: "/a/..b", expected: "/a/..b"},
+		{path: "/a%2Fb", expected: "/a%2Fb"},
+		{path: "/a/b%20c/", expected: "/a/b%20c/"},
+		{path: "/a/b/", expected: "/a/b", trailing: corev1.Service_Spec_Config_HTTP_PathNormalization_STRIP},
+		{path: "/a/b", expected: "/a/b/", trailing: corev1.Service_Spec_Config_HTTP_PathNormalization_ADD},
+		{path: "/", expected: "/", trailing: corev1.Service_Spec_Config_HTTP_PathNormalization_STRIP},
+		{path: "*", expected: "*"},
+
+		{path: "/..", err: errPathEscape},
+		{path: "/a/../..", err: errPathEscape},
+		{path: "/a/../../etc/passwd", err: errPathEscape},
+		{path: "/%2e%2e/etc/passwd", err: errPathEscape},
+		{path: "/a/..%2f..%2fetc", err: errHiddenDotSegment},
+		{path: "/a/..%2F", err: errHiddenDotSegment},
+		{path: "/a/%2e%2e%5cetc", err: errHiddenDotSegment},
+		{path: "/a/..\\etc", err: errHiddenDotSegment},
+		{path: "/a/b%2f.", err: errHiddenDotSegment},
+	}
+
+	for _, tc := range tstCases {
+		res, err := normalize(tc.path, tc.trailing)
+		if tc.err != nil {
+			assert.ErrorIs(t, err, tc.err, "%s", tc.path)
+			continue
+		}
+		assert.Nil(t, err, "%s", tc.path)
+		assert.Equal(t, tc.expected, res, "%s", tc.path)
+	}
+
+	{
+		_, err := normalize("/a/%zz", corev1.Service_Spec_Config_HTTP_PathNormalization_TRAILING_SLASH_UNSET)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var reqURI string
+	var reqPath string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqURI = r.URL.RequestURI()
+		reqPath = r.URL.Path
+	})
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	doReq := func(target string, cfg *corev1.Service_Spec_Config_HTTP_PathNormalization) *httptest.ResponseRecorder {
+		reqURI = ""
+		reqPath = ""
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service: &corev1.Service{
+					Spec: &corev1.Service_Spec{
+						Config: &corev1.Service_Spec_Config{
+							Type: &corev1.Service_Spec_Config_Http{
+								Http: &corev1.Service_Spec_Config_HTTP{
+									PathNormalization: cfg,
+								},
+							},
+						},
+					},
+				},
+			}))
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw
+	}
+
+	{
+		doReq("http://localhost//a/./b/../%2e%2e/c%2Fd?x=1", nil)
+		assert.Equal(t, "//a/./b/../%2e%2e/c%2Fd?x=1", reqURI)
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_PathNormalization{
+		IsEnabled: true,
+	}
+
+	{
+		rw := doReq("http://localhost//a/./b/../c%2Fd//?x=1", cfg)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "/a/c%2Fd/?x=1", reqURI)
+		assert.Equal(t, "/a/c/d/", reqPath)
+	}
+
+	{
+		rw := doReq("http://localhost/a/../../secret", cfg)
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+		assert.Equal(t, "", reqURI)
+	}
+
+	{
+		rw := doReq("http://localhost/a/..%2f..%2fsecret", cfg)
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+		assert.Equal(t, "", reqURI)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package preauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type bodyBuffer struct {
+	bufferSkipped metric.Int64Counter
+}
+
+func newBodyBuffer() (*bodyBuffer, error) {
+	bufferSkipped, err := otelutils.GetMeter().Int64Counter(
+		metricutils.GetKey("http.request.body.buffer.skipped"),
+		metric.WithDescription("Total number of requests whose bodies exceeded the max buffer size"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &bodyBuffer{
+		bufferSkipped: bufferSkipped,
+	}, nil
+}
+
+// bufferBody buffers the request body according to cfg. The body is
+// streamed instead if it exceeds the max buffer size and no feature of cfg
+// requires it to be buffered. It returns false if the request has been
+// rejected, in which case the response has already been written.
+func (b *bodyBuffer) bufferBody(w http.ResponseWriter, req *http.Request,
+	reqCtx *middlewares.RequestContext, cfg *corev1.Service_Spec_Config) ([]byte, map[string]any, bool) {
+	ctx := req.Context()
+
+	maxSize := int64(cfg.GetHttp().GetBody().GetMaxRequestSize())
+	if maxSize > 0 && req.ContentLength > maxSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return nil, nil, false
+	}
+
+	maxBufferSize := int64(cfg.GetHttp().GetBody().GetMaxBufferSize())
+	if maxSize > 0 && maxBufferSize >= maxSize {
+		maxBufferSize = 0
+	}
+
+	var body []byte
+	var isStreamed bool
+	var err error
+	if maxBufferSize > 0 {
+		body, isStreamed, err = readBodyBuffered(req, maxBufferSize)
+	} else {
+		body, err = readBody(req.Body, maxSize)
+	}
+	if err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return nil, nil, false
+	}
+
+	if isStreamed {
+		if requiresBufferedBody(cfg) {
+			b.bufferSkipped.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("action", "rejected")))
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return nil, nil, false
+		}
+
+		b.bufferSkipped.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("action", "streamed")))
+
+		setStreamedBody(w, req, body, maxSize)
+		reqCtx.IsBodyStreamed = true
+		return nil, nil, true
+	}
+
+	req.Body.Close()
+
+	reqCtx.Body = body
+	reqCtx.IsBodyBuffered = true
+
+	var bodyMap map[string]any
+	if cfg.GetHttp().GetBody().GetMode() == corev1.Service_Spec_Config_HTTP_Body_JSON && len(body) > 0 {
+		bodyMap = make(map[string]any)
+		if err := json.Unmarshal(body, &bodyMap); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil, nil, false
+		}
+		reqCtx.BodyJSONMap = bodyMap
+	}
+
+	httputils.SetRequestBody(req, body)
+
+	// Reading the body has already sent the "100 Continue" to the
+	// client, and the upstream does not need to wait for the body anymore.
+	req.Header.Del("Expect")
+
+	return body, bodyMap, true
+}
+
+type bodyCheck struct {
+	*bodyBuffer
+	next http.Handler
+}
+
+// NewBodyCheck returns the middleware that applies the body buffering of the
+// ServiceConfig selected for the request once authorized. The body is
+// buffered by the preAuth middleware according to the main config of the
+// Service, which might not require the buffering that the selected config
+// does, e.g. to sign the body.
+func NewBodyCheck(ctx context.Context, next http.Handler) (http.Handler, error) {
+	bodyBuffer, err := newBodyBuffer()
+	if err != nil {
+		return nil, err
+	}
+
+	return &bodyCheck{
+		bodyBuffer: bodyBuffer,
+		next:       next,
+	}, nil
+}
+
+func (m *bodyCheck) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig
+
+	switch {
+	case cfg == nil || reqCtx.IsBodyBuffered:
+	case reqCtx.IsBodyStreamed:
+		if requiresBufferedBody(cfg) {
+			m.bufferSkipped.Add(req.Context(), 1, metric.WithAttributes(
+				attribute.String("action", "rejected")))
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+	case isRequestBuffered(reqCtx.Service, cfg, req):
+		if _, _, ok := m.bufferBody(w, req, reqCtx, cfg); !ok {
+			return
+		}
+	}
+
+	m.next.ServeHTTP(w, req)
+}
@@ -19,9 +19,9 @@ package preauth
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 
 	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
@@ -32,11 +32,13 @@ import (
 	"github.com/octelium/octelium/cluster/vigil/vigil/vigilutils"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
 	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 )
 
 type middleware struct {
+	*bodyBuffer
 	octeliumC octeliumc.ClientInterface
 
 	next   http.Handler
@@ -46,11 +48,19 @@ type middleware struct {
 
 func New(ctx context.Context, next http.Handler, octeliumC octeliumc.ClientInterface, domain string) (http.Handler, error) {
 
-	return &middleware{
+	ret := &middleware{
 		next:      next,
 		octeliumC: octeliumC,
 		domain:    domain,
-	}, nil
+	}
+
+	var err error
+	ret.bodyBuffer, err = newBodyBuffer()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
 }
 
 func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -68,46 +78,12 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	additional := &additionalInfo{}
 
-	cfg := svc.Spec.Config
-
-	if (cfg != nil &&
-		cfg.GetHttp() != nil &&
-		cfg.GetHttp().EnableRequestBuffering) ||
-		(cfg != nil && cfg.GetHttp() != nil &&
-			cfg.GetHttp().Auth != nil &&
-			cfg.GetHttp().Auth.GetSigv4() != nil) {
-		additional.Body, err = io.ReadAll(req.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+	if isRequestBuffered(svc, svc.Spec.Config, req) {
+		var ok bool
+		additional.Body, additional.bodyMap, ok = m.bufferBody(w, req, reqCtx, svc.Spec.Config)
+		if !ok {
 			return
 		}
-		req.Body.Close()
-
-		reqCtx.Body = additional.Body
-
-		if cfg != nil && cfg.GetHttp() != nil && cfg.GetHttp().Body != nil {
-			buffer := cfg.GetHttp().Body
-
-			if buffer.MaxRequestSize > 0 && len(additional.Body) > int(buffer.MaxRequestSize) {
-				w.WriteHeader(http.StatusRequestEntityTooLarge)
-				return
-			}
-
-			switch buffer.Mode {
-			case corev1.Service_Spec_Config_HTTP_Body_JSON:
-				if len(additional.Body) > 0 {
-					additional.bodyMap = make(map[string]any)
-					if err := json.Unmarshal(additional.Body, &additional.bodyMap); err != nil {
-						w.WriteHeader(http.StatusBadRequest)
-						return
-					}
-					reqCtx.BodyJSONMap = additional.bodyMap
-				}
-			}
-		}
-
-		req.Body = io.NopCloser(bytes.NewReader(additional.Body))
-		req.ContentLength = int64(len(additional.Body))
 	}
 
 	reqCtx = middlewares.GetCtxRequestContext(ctx)
@@ -169,19 +145,29 @@ const maxReqCtxBodySize = 2 * 1024 * 1024
 func (m *middleware) getDownstreamReq(req *http.Request,
 	reqCtx *middlewares.RequestContext,
 	additional *additionalInfo) (*coctovigilv1.DownstreamRequest, error) {
+	return getDownstreamReq(req, reqCtx.Service, reqCtx.Conn, additional)
+}
 
-	c := reqCtx.Conn
-	svc := reqCtx.Service
+// GetDownstreamRequest returns the downstream request of a request without a
+// connection nor a body, such as a described request that is evaluated for
+// debugging.
+func GetDownstreamRequest(req *http.Request, svc *corev1.Service) (*coctovigilv1.DownstreamRequest, error) {
+	return getDownstreamReq(req, svc, nil, &additionalInfo{})
+}
+
+func getDownstreamReq(req *http.Request, svc *corev1.Service, c net.Conn,
+	additional *additionalInfo) (*coctovigilv1.DownstreamRequest, error) {
 
 	httpC := &corev1.RequestContext_Request_HTTP{
-		Headers: httputils.GetHeaders(req.Header),
-		Host:    req.Host,
-		Method:  req.Method,
-		Scheme:  req.URL.Scheme,
-		Size:    req.ContentLength,
-		Path:    req.URL.Path,
-		Uri:     req.URL.RequestURI(),
-		Body:    additional.Body,
+		Headers:     httputils.GetHeaders(req.Header),
+		Host:        req.Host,
+		Method:      req.Method,
+		Scheme:      req.URL.Scheme,
+		Size:        req.ContentLength,
+		Path:        req.URL.Path,
+		Uri:         req.URL.RequestURI(),
+		Body:        additional.Body,
+		ContentType: httputils.GetMediaType(req),
 	}
 
 	if len(httpC.Body) > maxReqCtxBodySize {
@@ -256,3 +242,123 @@ func (m *middleware) getDownstreamReq(req *http.Request,
 		}, nil
 	}
 }
+
+// isRequestBuffered reports whether the request body is entirely read before
+// being sent to the upstream with a known Content-Length. Otherwise, the body
+// is streamed as is. The body is always buffered whenever the upstream
+// authentication needs to sign it or to replay it. gRPC requests are never
+// buffered since client-streaming and bidirectional streams would otherwise
+// never reach the upstream.
+func isRequestBuffered(svc *corev1.Service, cfg *corev1.Service_Spec_Config, req *http.Request) bool {
+	if ucorev1.ToService(svc).IsGRPC() {
+		return false
+	}
+
+	if cfg.GetHttp().GetEnableRequestBuffering() ||
+		cfg.GetHttp().GetRequestCompression().GetIsEnabled() {
+		return true
+	}
+
+	if auth := cfg.GetHttp().GetAuth(); auth != nil &&
+		(auth.GetSigv4() != nil || auth.GetHmac() != nil || auth.GetNtlm() != nil) {
+		return true
+	}
+
+	return isLocalExpectContinue(cfg, req)
+}
+
+var errBodyTooLarge = errors.New("Request body is too large")
+
+// readBodyBuffered reads the entire body unless it exceeds maxBufferSize in
+// which case only the bytes read so far are returned and the body must be
+// streamed instead.
+func readBodyBuffered(req *http.Request, maxBufferSize int64) ([]byte, bool, error) {
+	if req.ContentLength > maxBufferSize {
+		return nil, true, nil
+	}
+
+	ret, err := io.ReadAll(io.LimitReader(req.Body, maxBufferSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return ret, int64(len(ret)) > maxBufferSize, nil
+}
+
+// requiresBufferedBody returns whether a feature of the config cannot be
+// safely skipped if the request body is not buffered. Namely, streaming the
+// body of a request buffered for the policies would have them evaluated
+// without the body, unless explicitly allowed.
+func requiresBufferedBody(cfg *corev1.Service_Spec_Config) bool {
+	httpCfg := cfg.GetHttp()
+
+	if auth := httpCfg.GetAuth(); auth != nil {
+		if auth.GetHmac() != nil {
+			return true
+		}
+		if auth.GetSigv4() != nil && !auth.GetSigv4().UnsignedPayloadFallback {
+			return true
+		}
+	}
+
+	if httpCfg.GetBody().GetMode() == corev1.Service_Spec_Config_HTTP_Body_JSON ||
+		httpCfg.GetBody().GetValidation() != nil {
+		return true
+	}
+
+	if httpCfg.GetBody().GetAllowStreaming() {
+		return false
+	}
+
+	return httpCfg.GetEnableRequestBuffering() ||
+		httpCfg.GetAuth().GetNtlm() != nil ||
+		httpCfg.GetRequestCompression().GetIsEnabled()
+}
+
+// setStreamedBody makes the request stream the rest of its body after the
+// already read bytes.
+func setStreamedBody(w http.ResponseWriter, req *http.Request, head []byte, maxSize int64) {
+	body := io.NopCloser(io.MultiReader(bytes.NewReader(head), req.Body))
+	if maxSize > 0 {
+		body = http.MaxBytesReader(w, body, maxSize)
+	}
+
+	req.Body = &streamedBody{
+		Reader: body,
+		Closer: req.Body,
+	}
+
+	if len(head) > 0 {
+		// The "100 Continue" has already been sent to the client.
+		req.Header.Del("Expect")
+	}
+}
+
+type streamedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// readBody reads the entire body. It fails once the body exceeds maxSize, if
+// set, without reading the remainder of the body.
+func readBody(body io.Reader, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		return io.ReadAll(body)
+	}
+
+	ret, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(ret)) > maxSize {
+		return nil, errBodyTooLarge
+	}
+
+	return ret, nil
+}
+
+func isLocalExpectContinue(cfg *corev1.Service_Spec_Config, req *http.Request) bool {
+	return cfg != nil && cfg.GetHttp() != nil && cfg.GetHttp().ExpectContinue != nil &&
+		cfg.GetHttp().ExpectContinue.Mode == corev1.Service_Spec_Config_HTTP_ExpectContinue_LOCAL &&
+		httputils.IsExpectContinue(req)
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -115,6 +116,42 @@ func TestMiddleware(t *testing.T) {
 		assert.True(t, pbutils.IsEqual(svc.Spec.Config, reqCtx.ServiceConfig))
 	}
 
+	{
+
+		reqPath := fmt.Sprintf("/prefix/%s", utilrand.GetRandomStringCanonical(12))
+		reqBody := utilrand.GetRandomBytesMust(32)
+		req := httptest.NewRequest(http.MethodPost, reqPath, bytes.NewBuffer(reqBody))
+		req.Header.Set("Expect", "100-continue")
+
+		svc := &corev1.Service{
+			Metadata: &metav1.Metadata{
+				Name: fmt.Sprintf("%s.default", utilrand.GetRandomStringCanonical(8)),
+			},
+			Spec: &corev1.Service_Spec{
+				Config: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							ExpectContinue: &corev1.Service_Spec_Config_HTTP_ExpectContinue{
+								Mode: corev1.Service_Spec_Config_HTTP_ExpectContinue_LOCAL,
+							},
+						},
+					},
+				},
+			},
+		}
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service:   svc,
+			}))
+		mdlwr.ServeHTTP(nil, req)
+
+		reqCtx := middlewares.GetCtxRequestContext(req.Context())
+		assert.Equal(t, reqBody, reqCtx.Body)
+		assert.Equal(t, "", req.Header.Get("Expect"))
+	}
+
 	{
 
 		reqPath := fmt.Sprintf("/prefix/%s", utilrand.GetRandomStringCanonical(12))
@@ -194,3 +231,505 @@ func TestMiddleware(t *testing.T) {
 	}
 
 }
+
+type infiniteReader struct{}
+
+func (infiniteReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	return len(p), nil
+}
+
+func TestRequestBuffering(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type upstreamReq struct {
+		contentLength    int64
+		transferEncoding []string
+		body             []byte
+	}
+
+	var got *upstreamReq
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		got = &upstreamReq{
+			contentLength:    r.ContentLength,
+			transferEncoding: r.TransferEncoding,
+			body:             body,
+		}
+	})
+	mdlwr, err := New(ctx, next, nil, "example.com")
+	assert.Nil(t, err)
+
+	doReq := func(httpCfg *corev1.Service_Spec_Config_HTTP, body io.Reader) (*httptest.ResponseRecorder, *middlewares.RequestContext) {
+		got = nil
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Service: &corev1.Service{
+				Metadata: &metav1.Metadata{
+					Name: fmt.Sprintf("%s.default", utilrand.GetRandomStringCanonical(8)),
+				},
+				Spec: &corev1.Service_Spec{
+					Config: &corev1.Service_Spec_Config{
+						Type: &corev1.Service_Spec_Config_Http{
+							Http: httpCfg,
+						},
+					},
+				},
+			},
+		}
+		req = req.WithContext(context.WithValue(context.Background(), middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw, reqCtx
+	}
+
+	reqBody := utilrand.GetRandomBytesMust(1024)
+
+	{
+		// streamed by default, even for bodies of unknown length
+		_, reqCtx := doReq(&corev1.Service_Spec_Config_HTTP{}, io.MultiReader(bytes.NewReader(reqBody)))
+		assert.NotNil(t, got)
+		assert.Equal(t, int64(-1), got.contentLength)
+		assert.Equal(t, reqBody, got.body)
+		assert.Nil(t, reqCtx.Body)
+	}
+
+	{
+		_, reqCtx := doReq(&corev1.Service_Spec_Config_HTTP{
+			EnableRequestBuffering: true,
+		}, io.MultiReader(bytes.NewReader(reqBody)))
+		assert.NotNil(t, got)
+		assert.Equal(t, int64(len(reqBody)), got.contentLength)
+		assert.Nil(t, got.transferEncoding)
+		assert.Equal(t, reqBody, got.body)
+		assert.Equal(t, reqBody, reqCtx.Body)
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			EnableRequestBuffering: true,
+			Body: &corev1.Service_Spec_Config_HTTP_Body{
+				MaxRequestSize: 1024,
+			},
+		}
+
+		rw, _ := doReq(httpCfg, bytes.NewReader(reqBody))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, reqBody, got.body)
+
+		rw, _ = doReq(httpCfg, bytes.NewReader(utilrand.GetRandomBytesMust(1025)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+
+		rw, _ = doReq(httpCfg, infiniteReader{})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+	}
+}
+
+func TestRequestBodyMaxBufferSize(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type upstreamReq struct {
+		contentLength int64
+		body          []byte
+	}
+
+	var got *upstreamReq
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		got = &upstreamReq{
+			contentLength: r.ContentLength,
+			body:          body,
+		}
+	})
+	mdlwr, err := New(ctx, next, nil, "example.com")
+	assert.Nil(t, err)
+
+	doReq := func(httpCfg *corev1.Service_Spec_Config_HTTP, body io.Reader) (*httptest.ResponseRecorder, *middlewares.RequestContext) {
+		got = nil
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Service: &corev1.Service{
+				Metadata: &metav1.Metadata{
+					Name: fmt.Sprintf("%s.default", utilrand.GetRandomStringCanonical(8)),
+				},
+				Spec: &corev1.Service_Spec{
+					Config: &corev1.Service_Spec_Config{
+						Type: &corev1.Service_Spec_Config_Http{
+							Http: httpCfg,
+						},
+					},
+				},
+			},
+		}
+		req = req.WithContext(context.WithValue(context.Background(), middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw, reqCtx
+	}
+
+	body := &corev1.Service_Spec_Config_HTTP_Body{
+		MaxBufferSize: 1024,
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			EnableRequestBuffering: true,
+			Body:                   body,
+		}
+
+		reqBody := utilrand.GetRandomBytesMust(1024)
+		rw, reqCtx := doReq(httpCfg, io.MultiReader(bytes.NewReader(reqBody)))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, int64(len(reqBody)), got.contentLength)
+		assert.Equal(t, reqBody, got.body)
+		assert.Equal(t, reqBody, reqCtx.Body)
+		assert.False(t, reqCtx.IsBodyStreamed)
+
+		reqBody = utilrand.GetRandomBytesMust(1025)
+		rw, _ = doReq(httpCfg, io.MultiReader(bytes.NewReader(reqBody)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+
+		rw, _ = doReq(httpCfg, bytes.NewReader(reqBody))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			EnableRequestBuffering: true,
+			Body: &corev1.Service_Spec_Config_HTTP_Body{
+				MaxBufferSize:  1024,
+				AllowStreaming: true,
+			},
+		}
+
+		reqBody := utilrand.GetRandomBytesMust(1025)
+		rw, reqCtx := doReq(httpCfg, io.MultiReader(bytes.NewReader(reqBody)))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, int64(-1), got.contentLength)
+		assert.Equal(t, reqBody, got.body)
+		assert.Nil(t, reqCtx.Body)
+		assert.True(t, reqCtx.IsBodyStreamed)
+
+		rw, reqCtx = doReq(httpCfg, bytes.NewReader(reqBody))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, int64(len(reqBody)), got.contentLength)
+		assert.Equal(t, reqBody, got.body)
+		assert.Nil(t, reqCtx.Body)
+		assert.True(t, reqCtx.IsBodyStreamed)
+	}
+
+	for _, httpCfg := range []*corev1.Service_Spec_Config_HTTP{
+		{
+			Body: body,
+			Auth: &corev1.Service_Spec_Config_HTTP_Auth{
+				Type: &corev1.Service_Spec_Config_HTTP_Auth_Ntlm{
+					Ntlm: &corev1.Service_Spec_Config_HTTP_Auth_NTLM{},
+				},
+			},
+		},
+		{
+			Body: body,
+			RequestCompression: &corev1.Service_Spec_Config_HTTP_RequestCompression{
+				IsEnabled: true,
+			},
+		},
+	} {
+		rw, _ := doReq(httpCfg, bytes.NewReader(utilrand.GetRandomBytesMust(1024)))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		rw, _ = doReq(httpCfg, bytes.NewReader(utilrand.GetRandomBytesMust(1025)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			Body: body,
+			Auth: &corev1.Service_Spec_Config_HTTP_Auth{
+				Type: &corev1.Service_Spec_Config_HTTP_Auth_Hmac{
+					Hmac: &corev1.Service_Spec_Config_HTTP_Auth_HMAC{},
+				},
+			},
+		}
+
+		rw, _ := doReq(httpCfg, bytes.NewReader(utilrand.GetRandomBytesMust(1024)))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		rw, _ = doReq(httpCfg, bytes.NewReader(utilrand.GetRandomBytesMust(1025)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+	}
+
+	{
+		sigv4 := &corev1.Service_Spec_Config_HTTP_Auth_Sigv4{}
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			Body: body,
+			Auth: &corev1.Service_Spec_Config_HTTP_Auth{
+				Type: &corev1.Service_Spec_Config_HTTP_Auth_Sigv4_{
+					Sigv4: sigv4,
+				},
+			},
+		}
+
+		reqBody := utilrand.GetRandomBytesMust(1025)
+		rw, _ := doReq(httpCfg, bytes.NewReader(reqBody))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+
+		sigv4.UnsignedPayloadFallback = true
+		rw, reqCtx := doReq(httpCfg, bytes.NewReader(reqBody))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, reqBody, got.body)
+		assert.True(t, reqCtx.IsBodyStreamed)
+	}
+}
+
+func TestRequestBodyMaxBufferSizePolicy(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	// next denies the requests whose bodies contain "deny" the same way a
+	// policy matching the body of the authorization request would.
+	var isForwarded bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCtx := middlewares.GetCtxRequestContext(r.Context())
+		if bytes.Contains(reqCtx.DownstreamRequest.Request.GetHttp().Body, []byte("deny")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		isForwarded = true
+		io.Copy(io.Discard, r.Body)
+	})
+	mdlwr, err := New(ctx, next, nil, "example.com")
+	assert.Nil(t, err)
+
+	httpCfg := &corev1.Service_Spec_Config_HTTP{
+		EnableRequestBuffering: true,
+		Body: &corev1.Service_Spec_Config_HTTP_Body{
+			MaxBufferSize: 1024,
+		},
+	}
+
+	doReq := func(size int) int {
+		isForwarded = false
+		reqBody := append([]byte("deny"), bytes.Repeat([]byte("a"), size-4)...)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(reqBody))
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Service: &corev1.Service{
+				Metadata: &metav1.Metadata{
+					Name: fmt.Sprintf("%s.default", utilrand.GetRandomStringCanonical(8)),
+				},
+				Spec: &corev1.Service_Spec{
+					Config: &corev1.Service_Spec_Config{
+						Type: &corev1.Service_Spec_Config_Http{
+							Http: httpCfg,
+						},
+					},
+				},
+			},
+		}
+		req = req.WithContext(context.WithValue(context.Background(), middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	{
+		assert.Equal(t, http.StatusForbidden, doReq(1024))
+		assert.False(t, isForwarded)
+	}
+
+	{
+		assert.Equal(t, http.StatusRequestEntityTooLarge, doReq(1025))
+		assert.False(t, isForwarded)
+	}
+
+	{
+		httpCfg.Body.AllowStreaming = true
+		assert.Equal(t, http.StatusForbidden, doReq(1024))
+		assert.Equal(t, http.StatusOK, doReq(1025))
+		assert.True(t, isForwarded)
+	}
+}
+
+func TestBodyCheck(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type upstreamReq struct {
+		contentLength int64
+		body          []byte
+	}
+
+	var got *upstreamReq
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		got = &upstreamReq{
+			contentLength: r.ContentLength,
+			body:          body,
+		}
+	})
+
+	bodyCheck, err := NewBodyCheck(ctx, next)
+	assert.Nil(t, err)
+
+	// The named config is selected after the authorization, i.e. after the
+	// body has been handled according to the main config.
+	var namedCfg *corev1.Service_Spec_Config
+	mdlwr, err := New(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middlewares.GetCtxRequestContext(r.Context()).ServiceConfig = namedCfg
+		bodyCheck.ServeHTTP(w, r)
+	}), nil, "example.com")
+	assert.Nil(t, err)
+
+	doReq := func(mainCfg *corev1.Service_Spec_Config_HTTP, body io.Reader) (*httptest.ResponseRecorder, *middlewares.RequestContext) {
+		got = nil
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Service: &corev1.Service{
+				Metadata: &metav1.Metadata{
+					Name: fmt.Sprintf("%s.default", utilrand.GetRandomStringCanonical(8)),
+				},
+				Spec: &corev1.Service_Spec{
+					Config: &corev1.Service_Spec_Config{
+						Type: &corev1.Service_Spec_Config_Http{
+							Http: mainCfg,
+						},
+					},
+				},
+			},
+		}
+		req = req.WithContext(context.WithValue(context.Background(), middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw, reqCtx
+	}
+
+	getNamedCfg := func(auth *corev1.Service_Spec_Config_HTTP_Auth) *corev1.Service_Spec_Config {
+		return &corev1.Service_Spec_Config{
+			Name: "named",
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					Body: &corev1.Service_Spec_Config_HTTP_Body{
+						MaxBufferSize: 1024,
+					},
+					Auth: auth,
+				},
+			},
+		}
+	}
+
+	hmacAuth := &corev1.Service_Spec_Config_HTTP_Auth{
+		Type: &corev1.Service_Spec_Config_HTTP_Auth_Hmac{
+			Hmac: &corev1.Service_Spec_Config_HTTP_Auth_HMAC{},
+		},
+	}
+	sigv4Auth := &corev1.Service_Spec_Config_HTTP_Auth{
+		Type: &corev1.Service_Spec_Config_HTTP_Auth_Sigv4_{
+			Sigv4: &corev1.Service_Spec_Config_HTTP_Auth_Sigv4{},
+		},
+	}
+
+	{
+		// The main config does not buffer the body, the named one signs it.
+		namedCfg = getNamedCfg(hmacAuth)
+
+		reqBody := utilrand.GetRandomBytesMust(1024)
+		rw, reqCtx := doReq(&corev1.Service_Spec_Config_HTTP{}, io.MultiReader(bytes.NewReader(reqBody)))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, int64(len(reqBody)), got.contentLength)
+		assert.Equal(t, reqBody, got.body)
+		assert.Equal(t, reqBody, reqCtx.Body)
+		assert.True(t, reqCtx.IsBodyBuffered)
+
+		rw, _ = doReq(&corev1.Service_Spec_Config_HTTP{},
+			bytes.NewReader(utilrand.GetRandomBytesMust(1025)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+
+		namedCfg = getNamedCfg(sigv4Auth)
+		rw, _ = doReq(&corev1.Service_Spec_Config_HTTP{},
+			io.MultiReader(bytes.NewReader(utilrand.GetRandomBytesMust(1025))))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+	}
+
+	{
+		// The main config streams the body, the named one signs it.
+		namedCfg = getNamedCfg(hmacAuth)
+		mainCfg := &corev1.Service_Spec_Config_HTTP{
+			EnableRequestBuffering: true,
+			Body: &corev1.Service_Spec_Config_HTTP_Body{
+				MaxBufferSize:  1024,
+				AllowStreaming: true,
+			},
+		}
+
+		rw, _ := doReq(mainCfg, bytes.NewReader(utilrand.GetRandomBytesMust(1025)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Nil(t, got)
+
+		namedCfg = getNamedCfg(nil)
+		reqBody := utilrand.GetRandomBytesMust(1025)
+		rw, reqCtx := doReq(mainCfg, bytes.NewReader(reqBody))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, reqBody, got.body)
+		assert.True(t, reqCtx.IsBodyStreamed)
+	}
+
+	{
+		// The body is not buffered twice
+		namedCfg = getNamedCfg(hmacAuth)
+		reqBody := utilrand.GetRandomBytesMust(512)
+		rw, reqCtx := doReq(&corev1.Service_Spec_Config_HTTP{
+			EnableRequestBuffering: true,
+		}, bytes.NewReader(reqBody))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, reqBody, got.body)
+		assert.Equal(t, reqBody, reqCtx.Body)
+	}
+}
@@ -0,0 +1,349 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package quota
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/bytequota"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWindow = time.Hour
+
+	// maxMetricKeys bounds the cardinality of the usage metric. The
+	// remaining identities are aggregated into a single "other" identity.
+	maxMetricKeys = 10
+
+	// defaultReportInterval is the number of bytes after which the usage of
+	// an in-flight request or upgraded connection is reported, and hence
+	// by how much a long-lived stream can exceed the quota.
+	defaultReportInterval = 1 << 20
+)
+
+// ErrExceeded is returned by the reads and writes of the streams once the
+// quota of their identity is exceeded, which aborts them.
+var ErrExceeded = errors.New("Byte quota exceeded")
+
+type middleware struct {
+	next           http.Handler
+	store          bytequota.Store
+	now            func() time.Time
+	reportInterval int64
+	bytes          metric.Int64Counter
+	rejected       metric.Int64Counter
+}
+
+func New(ctx context.Context, next http.Handler, store bytequota.Store) (http.Handler, error) {
+	ret := &middleware{
+		next:           next,
+		store:          store,
+		now:            time.Now,
+		reportInterval: defaultReportInterval,
+	}
+
+	meter := otelutils.GetMeter()
+
+	var err error
+	ret.bytes, err = meter.Int64Counter(metricutils.GetKey("http.quota.bytes"),
+		metric.WithDescription("Total number of bytes accounted by the byte quota"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret.rejected, err = meter.Int64Counter(metricutils.GetKey("http.quota.rejected"),
+		metric.WithDescription("Total number of requests rejected by the byte quota"))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := meter.Int64ObservableGauge(metricutils.GetKey("http.quota.usage"),
+		metric.WithDescription("Number of bytes used per identity within the current window"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			if store == nil {
+				return nil
+			}
+			usages, err := store.List(ctx)
+			if err != nil {
+				return nil
+			}
+			slices.SortFunc(usages, func(a, b *bytequota.Usage) int {
+				return cmp.Compare(b.Total(), a.Total())
+			})
+
+			var others int64
+			for i, usage := range usages {
+				if i >= maxMetricKeys {
+					others += usage.Total()
+					continue
+				}
+				o.Observe(usage.Total(), metric.WithAttributes(attribute.String("identity", usage.Key)))
+			}
+			if others > 0 {
+				o.Observe(others, metric.WithAttributes(attribute.String("identity", "other")))
+			}
+			return nil
+		})); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	reqCtx := middlewares.GetCtxRequestContext(ctx)
+	cfg := reqCtx.ServiceConfig.GetHttp().GetByteQuota()
+	if cfg == nil || !cfg.IsEnabled || m.store == nil {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	key := getKey(reqCtx, cfg.Key)
+	if key == "" {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	window := defaultWindow
+	if val := umetav1.ToDuration(cfg.Window).ToGo(); val > 0 {
+		window = val
+	}
+
+	now := m.now()
+	windowStart := now.Truncate(window)
+
+	if cfg.MaxBytes > 0 {
+		usage, err := m.store.Get(ctx, key, windowStart)
+		if err != nil {
+			zap.L().Warn("Could not get byte quota usage", zap.String("key", key), zap.Error(err))
+		} else if bytequota.IsExceeded(usage, cfg.MaxBytes) {
+			zap.L().Debug("Rejecting request since the byte quota is exceeded",
+				zap.String("key", key), zap.Int64("bytes", usage.Total()))
+			m.rejected.Add(context.Background(), 1)
+
+			retryAfter := int(math.Ceil(windowStart.Add(window).Sub(now).Seconds()))
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", max(retryAfter, 1)))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	counter := &byteCounter{
+		reportInterval: m.reportInterval,
+	}
+	counter.report = func() {
+		bytesIn, bytesOut := counter.in.Swap(0), counter.out.Swap(0)
+		if bytesIn == 0 && bytesOut == 0 {
+			return
+		}
+
+		// The bytes are accounted to the window in which the request
+		// started so that a long-lived request is accounted only once.
+		usage, err := m.store.Add(context.Background(), key, windowStart, bytesIn, bytesOut)
+		if err != nil {
+			zap.L().Warn("Could not add byte quota usage", zap.String("key", key), zap.Error(err))
+		} else if bytequota.IsExceeded(usage, cfg.MaxBytes) && !counter.isExceeded.Swap(true) {
+			zap.L().Debug("Aborting the stream since the byte quota is exceeded",
+				zap.String("key", key), zap.Int64("bytes", usage.Total()))
+			m.rejected.Add(context.Background(), 1)
+		}
+		m.bytes.Add(context.Background(), bytesIn, metric.WithAttributes(attribute.String("direction", "in")))
+		m.bytes.Add(context.Background(), bytesOut, metric.WithAttributes(attribute.String("direction", "out")))
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingBody{
+			ReadCloser: req.Body,
+			counter:    counter,
+		}
+	}
+
+	crw := &responseWriter{
+		ResponseWriter: w,
+		counter:        counter,
+	}
+
+	m.next.ServeHTTP(crw, req)
+
+	if !crw.isHijacked.Load() {
+		counter.report()
+	}
+}
+
+// byteCounter counts the bytes of a request, or of its upgraded connection,
+// and reports them to the store every reportInterval bytes rather than only
+// once the request is done so that the quota is also enforced on the
+// long-lived streams.
+type byteCounter struct {
+	in             atomic.Int64
+	out            atomic.Int64
+	reportInterval int64
+	report         func()
+	isExceeded     atomic.Bool
+}
+
+func (c *byteCounter) addIn(n int) {
+	c.in.Add(int64(n))
+	c.reportIfNeeded()
+}
+
+func (c *byteCounter) addOut(n int) {
+	c.out.Add(int64(n))
+	c.reportIfNeeded()
+}
+
+func (c *byteCounter) reportIfNeeded() {
+	if c.reportInterval > 0 && c.in.Load()+c.out.Load() >= c.reportInterval {
+		c.report()
+	}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	counter *byteCounter
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	if b.counter.isExceeded.Load() {
+		return 0, ErrExceeded
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.counter.addIn(n)
+	return n, err
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	counter    *byteCounter
+	isHijacked atomic.Bool
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.counter.isExceeded.Load() {
+		return 0, ErrExceeded
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.counter.addOut(n)
+	return n, err
+}
+
+// Hijack accounts the bytes of the upgraded connection, e.g. WebSocket, which
+// are reported every reportInterval bytes and once the connection is closed.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.Errorf("ResponseWriter is not a Hijacker")
+	}
+
+	c, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.isHijacked.Store(true)
+
+	return &conn{
+		Conn:    c,
+		counter: w.counter,
+	}, brw, nil
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type conn struct {
+	net.Conn
+	counter *byteCounter
+	once    sync.Once
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	if c.counter.isExceeded.Load() {
+		c.Close()
+		return 0, ErrExceeded
+	}
+
+	n, err := c.Conn.Read(p)
+	c.counter.addIn(n)
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	if c.counter.isExceeded.Load() {
+		c.Close()
+		return 0, ErrExceeded
+	}
+
+	n, err := c.Conn.Write(p)
+	c.counter.addOut(n)
+	return n, err
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.counter.report)
+	return err
+}
+
+func getKey(reqCtx *middlewares.RequestContext, key corev1.Service_Spec_Config_HTTP_ByteQuota_Key) string {
+	info := reqCtx.DownstreamInfo
+	if info == nil {
+		return ""
+	}
+
+	switch key {
+	case corev1.Service_Spec_Config_HTTP_ByteQuota_USER:
+		if info.User != nil && info.User.Metadata != nil {
+			return info.User.Metadata.Uid
+		}
+	default:
+		if info.Session != nil && info.Session.Metadata != nil {
+			return info.Session.Metadata.Uid
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,359 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package quota
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/bytequota"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(strings.Repeat("o", 40)))
+	})
+
+	store := bytequota.NewMemoryStore()
+	mdlwr, err := New(ctx, next, store)
+	assert.Nil(t, err)
+
+	var mu sync.Mutex
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	mdlwr.(*middleware).now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	cfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				ByteQuota: &corev1.Service_Spec_Config_HTTP_ByteQuota{
+					IsEnabled: true,
+					MaxBytes:  100,
+					Window: &metav1.Duration{
+						Type: &metav1.Duration_Minutes{
+							Minutes: 1,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	doReq := func(sessionUID, body string) *httptest.ResponseRecorder {
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt:     time.Now(),
+			ServiceConfig: cfg,
+			DownstreamInfo: &corev1.RequestContext{
+				Session: &corev1.Session{
+					Metadata: &metav1.Metadata{
+						Uid: sessionUID,
+					},
+				},
+			},
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw
+	}
+
+	windowStart := now.Truncate(time.Minute)
+
+	assert.Equal(t, http.StatusOK, doReq("s1", strings.Repeat("i", 20)).Code)
+	usage, err := store.Get(ctx, "s1", windowStart)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), usage.BytesIn)
+	assert.Equal(t, int64(40), usage.BytesOut)
+
+	// The request that exceeds the quota is still served since its size is
+	// unknown beforehand but the further requests are rejected.
+	assert.Equal(t, http.StatusOK, doReq("s1", strings.Repeat("i", 20)).Code)
+	usage, err = store.Get(ctx, "s1", windowStart)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(120), usage.Total())
+
+	mu.Lock()
+	now = now.Add(15 * time.Second)
+	mu.Unlock()
+
+	rw := doReq("s1", "")
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "45", rw.Header().Get("Retry-After"))
+
+	usage, err = store.Get(ctx, "s1", windowStart)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(120), usage.Total())
+
+	// Other identities are unaffected.
+	assert.Equal(t, http.StatusOK, doReq("s2", "").Code)
+
+	// The quota resets with the next window.
+	mu.Lock()
+	now = now.Add(45 * time.Second)
+	mu.Unlock()
+
+	assert.Equal(t, http.StatusOK, doReq("s1", "").Code)
+	usage, err = store.Get(ctx, "s1", windowStart.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), usage.BytesIn)
+	assert.Equal(t, int64(40), usage.BytesOut)
+
+	usages, err := store.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(usages))
+	assert.Equal(t, "s1", usages[0].Key)
+
+	{
+		// Accounting only.
+		cfg.GetHttp().ByteQuota.MaxBytes = 0
+		for range 5 {
+			assert.Equal(t, http.StatusOK, doReq("s1", strings.Repeat("i", 100)).Code)
+		}
+		usage, err = store.Get(ctx, "s1", windowStart.Add(time.Minute))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(500), usage.BytesIn)
+	}
+
+	{
+		cfg.GetHttp().ByteQuota.IsEnabled = false
+		assert.Equal(t, http.StatusOK, doReq("s3", "abc").Code)
+		usage, err = store.Get(ctx, "s3", windowStart.Add(time.Minute))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), usage.Total())
+	}
+}
+
+func TestStream(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var written int
+	var writeErr, readErr error
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+
+		written, writeErr = 0, nil
+		for range 100 {
+			n, err := w.Write([]byte(strings.Repeat("o", 10)))
+			written += n
+			if err != nil {
+				writeErr = err
+				return
+			}
+		}
+	})
+
+	store := bytequota.NewMemoryStore()
+	mdlwr, err := New(ctx, next, store)
+	assert.Nil(t, err)
+	mdlwr.(*middleware).reportInterval = 10
+
+	cfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				ByteQuota: &corev1.Service_Spec_Config_HTTP_ByteQuota{
+					IsEnabled: true,
+					MaxBytes:  100,
+				},
+			},
+		},
+	}
+
+	doReq := func(sessionUID string, body io.Reader) {
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt:     time.Now(),
+			ServiceConfig: cfg,
+			DownstreamInfo: &corev1.RequestContext{
+				Session: &corev1.Session{
+					Metadata: &metav1.Metadata{
+						Uid: sessionUID,
+					},
+				},
+			},
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/", body)
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		mdlwr.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	getUsage := func(key string) *bytequota.Usage {
+		usages, err := store.List(ctx)
+		assert.Nil(t, err)
+		for _, usage := range usages {
+			if usage.Key == key {
+				return usage
+			}
+		}
+		return &bytequota.Usage{}
+	}
+
+	// The response stream is aborted once the quota is exceeded.
+	doReq("s1", nil)
+	assert.True(t, errors.Is(writeErr, ErrExceeded))
+	assert.Nil(t, readErr)
+	assert.Equal(t, 100, written)
+	assert.Equal(t, int64(100), getUsage("s1").BytesOut)
+
+	// And so is the request stream.
+	doReq("s2", &tstReader{n: 1000})
+	assert.True(t, errors.Is(readErr, ErrExceeded))
+	assert.Equal(t, int64(100), getUsage("s2").BytesIn)
+
+	{
+		// Accounting only.
+		cfg.GetHttp().ByteQuota.MaxBytes = 0
+		doReq("s3", nil)
+		assert.Nil(t, writeErr)
+		assert.Equal(t, 1000, written)
+		assert.Equal(t, int64(1000), getUsage("s3").BytesOut)
+	}
+}
+
+// tstReader reads n bytes in chunks of 10 bytes.
+type tstReader struct {
+	n int
+}
+
+func (r *tstReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	n := min(r.n, len(p), 10)
+	r.n -= n
+	return n, nil
+}
+
+func TestHijack(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	cfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				ByteQuota: &corev1.Service_Spec_Config_HTTP_ByteQuota{
+					IsEnabled: true,
+				},
+			},
+		},
+	}
+
+	closed := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, brw, err := w.(http.Hijacker).Hijack()
+		assert.Nil(t, err)
+		brw.Flush()
+
+		c.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(c, buf)
+		assert.Nil(t, err)
+		c.Write([]byte("pong"))
+		c.Close()
+		close(closed)
+	})
+
+	store := bytequota.NewMemoryStore()
+	mdlwr, err := New(ctx, next, store)
+	assert.Nil(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt:     time.Now(),
+			ServiceConfig: cfg,
+			DownstreamInfo: &corev1.RequestContext{
+				Session: &corev1.Session{
+					Metadata: &metav1.Metadata{
+						Uid: "s1",
+					},
+				},
+			},
+		}
+		mdlwr.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(),
+			middlewares.CtxRequestContext, reqCtx)))
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := net.Dial("tcp", srv.Listener.Addr().String())
+	assert.Nil(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n"))
+	assert.Nil(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	_, err = c.Write([]byte("hello"))
+	assert.Nil(t, err)
+
+	<-closed
+
+	usages, err := store.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(usages))
+	assert.Equal(t, int64(5), usages[0].BytesIn)
+	assert.Equal(t, int64(len("HTTP/1.1 101 Switching Protocols\r\n\r\n")+4), usages[0].BytesOut)
+}
@@ -25,10 +25,14 @@ import (
 	"github.com/octelium/octelium/apis/rsc/rratelimitv1"
 	"github.com/octelium/octelium/cluster/common/celengine"
 	"github.com/octelium/octelium/cluster/common/octeliumc"
+	"github.com/octelium/octelium/cluster/common/otelutils"
 	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/commonplugin"
 	"github.com/octelium/octelium/pkg/grpcerr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 )
 
@@ -37,18 +41,28 @@ type middleware struct {
 	phase     corev1.Service_Spec_Config_HTTP_Plugin_Phase
 	celEngine *celengine.CELEngine
 	octeliumC octeliumc.ClientInterface
+	limited   metric.Int64Counter
 }
 
 func New(ctx context.Context,
 	next http.Handler, celEngine *celengine.CELEngine,
 	octeliumC octeliumc.ClientInterface,
 	phase corev1.Service_Spec_Config_HTTP_Plugin_Phase) (http.Handler, error) {
-	return &middleware{
+	ret := &middleware{
 		next:      next,
 		phase:     phase,
 		celEngine: celEngine,
 		octeliumC: octeliumC,
-	}, nil
+	}
+
+	var err error
+	ret.limited, err = otelutils.GetMeter().Int64Counter(metricutils.GetKey("http.requests.limited"),
+		metric.WithDescription("Total number of requests rejected by the rate limiting"))
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
 }
 
 func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -99,27 +113,25 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 				continue
 			}
 
-			for k, v := range rateLimit.Headers {
-				rw.Header().Set(k, v)
+			statusCode := http.StatusTooManyRequests
+			if rateLimit.StatusCode >= 200 && rateLimit.StatusCode < 600 {
+				statusCode = int(rateLimit.StatusCode)
 			}
-			rw.Header().Set("Server", "octelium")
 
-			if rateLimit.StatusCode >= 200 && rateLimit.StatusCode < 600 {
-				rw.WriteHeader(int(rateLimit.StatusCode))
-			} else {
-				rw.WriteHeader(http.StatusTooManyRequests)
+			var body []byte
+			switch rateLimit.Body.GetType().(type) {
+			case *corev1.Service_Spec_Config_HTTP_Plugin_RateLimit_Body_Inline:
+				body = []byte(rateLimit.Body.GetInline())
+			case *corev1.Service_Spec_Config_HTTP_Plugin_RateLimit_Body_InlineBytes:
+				body = rateLimit.Body.GetInlineBytes()
 			}
 
-			body := rateLimit.Body
+			m.limited.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("reason", middlewares.LimitedRateLimit),
+				attribute.String("plugin", plugin.Name)))
 
-			if body != nil {
-				switch body.Type.(type) {
-				case *corev1.Service_Spec_Config_HTTP_Plugin_RateLimit_Body_Inline:
-					rw.Write([]byte(body.GetInline()))
-				case *corev1.Service_Spec_Config_HTTP_Plugin_RateLimit_Body_InlineBytes:
-					rw.Write(body.GetInlineBytes())
-				}
-			}
+			middlewares.WriteLimitedResponse(rw, req, cfg.GetHttp(),
+				middlewares.LimitedRateLimit, statusCode, rateLimit.Headers, body)
 			return
 		default:
 			continue
@@ -0,0 +1,96 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// Registration describes a middleware of the HTTP chain.
+type Registration struct {
+	// Name is the unique name of the middleware.
+	Name string
+	// Priority orders the middleware within the chain. Middlewares with lower
+	// priorities wrap the ones with higher priorities and hence see the
+	// requests first. Middlewares with equal priorities keep their
+	// registration order.
+	Priority int
+	// New constructs the middleware wrapping the next handler.
+	New Constructor
+}
+
+// Registry holds the registered middlewares and builds the chain out of them
+// in a deterministic order.
+type Registry struct {
+	regs []*Registration
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(regs ...*Registration) error {
+	for _, reg := range regs {
+		if reg == nil || reg.Name == "" {
+			return errors.Errorf("Middleware name must be set")
+		}
+		if reg.New == nil {
+			return errors.Errorf("Middleware %s has no constructor", reg.Name)
+		}
+		if slices.ContainsFunc(r.regs, func(itm *Registration) bool {
+			return itm.Name == reg.Name
+		}) {
+			return errors.Errorf("Middleware %s is already registered", reg.Name)
+		}
+
+		r.regs = append(r.regs, reg)
+	}
+
+	return nil
+}
+
+func (r *Registry) sorted() []*Registration {
+	ret := slices.Clone(r.regs)
+	slices.SortStableFunc(ret, func(a, b *Registration) int {
+		return a.Priority - b.Priority
+	})
+	return ret
+}
+
+// Names returns the names of the registered middlewares in the chain order.
+func (r *Registry) Names() []string {
+	var ret []string
+	for _, reg := range r.sorted() {
+		ret = append(ret, reg.Name)
+	}
+	return ret
+}
+
+func (r *Registry) Chain() Chain {
+	var constructors []Constructor
+	for _, reg := range r.sorted() {
+		constructors = append(constructors, reg.New)
+	}
+	return New(constructors...)
+}
+
+func (r *Registry) Then(h http.Handler) (http.Handler, error) {
+	return r.Chain().Then(h)
+}
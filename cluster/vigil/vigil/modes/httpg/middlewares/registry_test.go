@@ -0,0 +1,82 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var order []string
+
+	getReg := func(name string, priority int) *Registration {
+		return &Registration{
+			Name:     name,
+			Priority: priority,
+			New: func(next http.Handler) (http.Handler, error) {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					order = append(order, name)
+					next.ServeHTTP(w, r)
+				}), nil
+			},
+		}
+	}
+
+	r := NewRegistry()
+	err = r.Register(
+		getReg("c", 300),
+		getReg("a", 100),
+		getReg("b1", 200),
+		getReg("b2", 200),
+	)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"a", "b1", "b2", "c"}, r.Names())
+
+	handler, err := r.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+	assert.Nil(t, err)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, []string{"a", "b1", "b2", "c", "handler"}, order)
+
+	err = r.Register(getReg("a", 400))
+	assert.NotNil(t, err)
+
+	err = r.Register(&Registration{Name: "d"})
+	assert.NotNil(t, err)
+
+	err = r.Register(&Registration{
+		New: func(next http.Handler) (http.Handler, error) {
+			return next, nil
+		},
+	})
+	assert.NotNil(t, err)
+}
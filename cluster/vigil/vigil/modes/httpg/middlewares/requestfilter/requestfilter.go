@@ -0,0 +1,283 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package requestfilter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+type rule = corev1.Service_Spec_Config_HTTP_RequestFilter_Rule
+
+// defaultRules is the shared ruleset that only covers the obviously
+// malicious requests in order to avoid false positives.
+var defaultRules = []*rule{
+	{
+		Name:    "default-path-traversal",
+		Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH,
+		Pattern: `(?i)(^|[/\\])(\.|%2e){2}([/\\]|$)`,
+	},
+	{
+		Name:    "default-null-byte",
+		Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH,
+		Pattern: `\x00|%00`,
+	},
+	{
+		Name:    "default-sensitive-files",
+		Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH,
+		Pattern: `(?i)/(\.git|\.svn|\.hg|\.env|\.aws|\.ssh|\.htpasswd|wp-config\.php)(/|$)`,
+	},
+	{
+		Name:    "default-jndi-injection",
+		Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_QUERY,
+		Pattern: `(?i)\$\{jndi:`,
+	},
+	{
+		Name:    "default-jndi-injection-header",
+		Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_HEADER,
+		Pattern: `(?i)\$\{jndi:`,
+	},
+	{
+		Name:    "default-scanner",
+		Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_HEADER,
+		Header:  "User-Agent",
+		Pattern: `(?i)(sqlmap|nikto|masscan|zgrab|nuclei|acunetix|wpscan|dirbuster|gobuster)`,
+	},
+}
+
+// defaultCompiledRules are the compiled default rules.
+var defaultCompiledRules = mustCompileRules(defaultRules)
+
+type compiledRule struct {
+	*rule
+	rgx *regexp.Regexp
+}
+
+// compiledFilter is the compiled ruleset of a Service config. err is set if
+// any of its patterns is invalid.
+type compiledFilter struct {
+	rules []*compiledRule
+	err   error
+}
+
+// compiledFilters holds the compiled rulesets of the Service configs of a
+// single Service resource version keyed by the config name.
+type compiledFilters struct {
+	resourceVersion string
+	filters         sync.Map
+}
+
+type middleware struct {
+	next    http.Handler
+	blocked metric.Int64Counter
+	filters atomic.Pointer[compiledFilters]
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	ret := &middleware{
+		next: next,
+	}
+
+	var err error
+	ret.blocked, err = otelutils.GetMeter().Int64Counter(metricutils.GetKey("http.requests.filtered"),
+		metric.WithDescription("Total number of requests blocked by the request filter rules"))
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig.GetHttp().GetRequestFilter()
+	if cfg == nil || !cfg.IsEnabled {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	filter := m.getFilter(reqCtx.Service, reqCtx.ServiceConfig.GetName(), cfg)
+	if filter.err != nil {
+		if ucorev1.ToService(reqCtx.Service).IsGRPC() {
+			hdr := w.Header()
+			hdr.Set("Content-Type", "application/grpc")
+			hdr.Set("Grpc-Status", "14")
+			hdr.Set("Grpc-Message", "invalid request filter")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	matched := getMatchedRule(filter, cfg, req)
+	if matched == nil || matched.Action == corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_ALLOW {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	m.blocked.Add(context.Background(), 1, metric.WithAttributes(attribute.String("rule", matched.Name)))
+	zap.L().Debug("Request blocked by request filter",
+		zap.String("rule", matched.Name), zap.String("path", req.URL.Path))
+
+	if ucorev1.ToService(reqCtx.Service).IsGRPC() {
+		hdr := w.Header()
+		hdr.Set("Content-Type", "application/grpc")
+		hdr.Set("Grpc-Status", "7")
+		hdr.Set("Grpc-Message", "request blocked")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+}
+
+// getFilter returns the compiled ruleset of the Service config. The rulesets
+// are compiled once per Service resource version and dropped as soon as the
+// Service is updated.
+func (m *middleware) getFilter(svc *corev1.Service,
+	cfgName string, cfg *corev1.Service_Spec_Config_HTTP_RequestFilter) *compiledFilter {
+	resourceVersion := svc.GetMetadata().GetResourceVersion()
+
+	cur := m.filters.Load()
+	if cur == nil || cur.resourceVersion != resourceVersion {
+		cur = &compiledFilters{
+			resourceVersion: resourceVersion,
+		}
+		m.filters.Store(cur)
+	}
+
+	if val, ok := cur.filters.Load(cfgName); ok {
+		return val.(*compiledFilter)
+	}
+
+	ret := compileRules(cfg.Rules)
+	if ret.err != nil {
+		zap.L().Warn("Invalid requestFilter rules. Refusing the requests of the config",
+			zap.String("config", cfgName), zap.String("resourceVersion", resourceVersion), zap.Error(ret.err))
+	}
+
+	val, _ := cur.filters.LoadOrStore(cfgName, ret)
+	return val.(*compiledFilter)
+}
+
+func compileRules(rules []*rule) *compiledFilter {
+	ret := &compiledFilter{}
+	for _, r := range rules {
+		rgx, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return &compiledFilter{
+				err: fmt.Errorf("rule %s: invalid pattern: %w", r.Name, err),
+			}
+		}
+
+		ret.rules = append(ret.rules, &compiledRule{
+			rule: r,
+			rgx:  rgx,
+		})
+	}
+
+	return ret
+}
+
+func mustCompileRules(rules []*rule) *compiledFilter {
+	ret := compileRules(rules)
+	if ret.err != nil {
+		panic(ret.err)
+	}
+
+	return ret
+}
+
+// getMatchedRule returns the first matching rule of the Service followed by
+// the default rules, if enabled.
+func getMatchedRule(filter *compiledFilter,
+	cfg *corev1.Service_Spec_Config_HTTP_RequestFilter, req *http.Request) *rule {
+	if ret := matchRules(filter.rules, req); ret != nil {
+		return ret
+	}
+
+	if cfg.DisableDefaultRules {
+		return nil
+	}
+
+	return matchRules(defaultCompiledRules.rules, req)
+}
+
+func matchRules(rules []*compiledRule, req *http.Request) *rule {
+	for _, r := range rules {
+		if isMatched(r.rule, r.rgx, req) {
+			return r.rule
+		}
+	}
+
+	return nil
+}
+
+func isMatched(r *rule, rgx *regexp.Regexp, req *http.Request) bool {
+	switch r.Target {
+	case corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH:
+		return matchEncoded(rgx, req.URL.EscapedPath(), req.URL.Path)
+	case corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_QUERY:
+		if req.URL.RawQuery == "" {
+			return false
+		}
+		decoded, err := url.QueryUnescape(req.URL.RawQuery)
+		if err != nil {
+			decoded = req.URL.RawQuery
+		}
+		return matchEncoded(rgx, req.URL.RawQuery, decoded)
+	case corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_HEADER:
+		if r.Header != "" {
+			for _, val := range req.Header.Values(r.Header) {
+				if rgx.MatchString(val) {
+					return true
+				}
+			}
+			return false
+		}
+
+		for _, vals := range req.Header {
+			for _, val := range vals {
+				if rgx.MatchString(val) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func matchEncoded(rgx *regexp.Regexp, raw, decoded string) bool {
+	return rgx.MatchString(raw) || (decoded != raw && rgx.MatchString(decoded))
+}
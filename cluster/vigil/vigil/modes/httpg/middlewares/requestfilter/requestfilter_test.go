@@ -0,0 +1,191 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package requestfilter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	resourceVersion := "1"
+
+	doReq := func(mode corev1.Service_Spec_Mode,
+		cfg *corev1.Service_Spec_Config_HTTP_RequestFilter, target string, hdrs map[string]string) *httptest.ResponseRecorder {
+		reached = false
+		req := httptest.NewRequest(http.MethodGet, "http://localhost"+target, nil)
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service: &corev1.Service{
+					Metadata: &metav1.Metadata{
+						ResourceVersion: resourceVersion,
+					},
+					Spec: &corev1.Service_Spec{
+						Mode: mode,
+					},
+				},
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							RequestFilter: cfg,
+						},
+					},
+				},
+			}))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw
+	}
+
+	{
+		rw := doReq(corev1.Service_Spec_HTTP, nil, "/a/../../etc/passwd", nil)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_RequestFilter{
+		IsEnabled: true,
+		Rules: []*corev1.Service_Spec_Config_HTTP_RequestFilter_Rule{
+			{
+				Name:    "allow-health",
+				Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH,
+				Pattern: `^/health/`,
+				Action:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_ALLOW,
+			},
+			{
+				Name:    "deny-admin",
+				Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH,
+				Pattern: `^/admin`,
+			},
+			{
+				Name:    "deny-debug",
+				Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_QUERY,
+				Pattern: `(^|&)debug=true`,
+			},
+			{
+				Name:    "deny-tenant",
+				Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_HEADER,
+				Header:  "X-Tenant",
+				Pattern: `^blocked$`,
+			},
+		},
+	}
+
+	type tstCase struct {
+		target   string
+		hdrs     map[string]string
+		expected int
+	}
+
+	for _, tc := range []tstCase{
+		{target: "/", expected: http.StatusOK},
+		{target: "/docs/a..b", expected: http.StatusOK},
+		{target: "/a/../../etc/passwd", expected: http.StatusForbidden},
+		{target: "/a/%2e%2e/etc/passwd", expected: http.StatusForbidden},
+		{target: "/a/%252e%252e/etc/passwd", expected: http.StatusForbidden},
+		{target: "/.git/config", expected: http.StatusForbidden},
+		{target: "/health/%2e%2e/x", expected: http.StatusOK},
+		{target: "/admin/users", expected: http.StatusForbidden},
+		{target: "/?debug=true", expected: http.StatusForbidden},
+		{target: "/?x=1&debug%3Dtrue", expected: http.StatusForbidden},
+		{target: "/?q=%24%7Bjndi%3Aldap%3A%2F%2Fx%7D", expected: http.StatusForbidden},
+		{target: "/", hdrs: map[string]string{"X-Tenant": "blocked"}, expected: http.StatusForbidden},
+		{target: "/", hdrs: map[string]string{"X-Tenant": "allowed"}, expected: http.StatusOK},
+		{target: "/", hdrs: map[string]string{"User-Agent": "sqlmap/1.7"}, expected: http.StatusForbidden},
+		{target: "/", hdrs: map[string]string{"X-Api-Version": "${jndi:ldap://x}"}, expected: http.StatusForbidden},
+	} {
+		rw := doReq(corev1.Service_Spec_HTTP, cfg, tc.target, tc.hdrs)
+		assert.Equal(t, tc.expected, rw.Code, "%+v", tc)
+		assert.Equal(t, tc.expected == http.StatusOK, reached, "%+v", tc)
+	}
+
+	{
+		rw := doReq(corev1.Service_Spec_GRPC, cfg, "/admin.Service/Get", nil)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "7", rw.Header().Get("Grpc-Status"))
+		assert.False(t, reached)
+	}
+
+	{
+		cfg.DisableDefaultRules = true
+		rw := doReq(corev1.Service_Spec_HTTP, cfg, "/a/../../etc/passwd", nil)
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		rw = doReq(corev1.Service_Spec_HTTP, cfg, "/admin", nil)
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	}
+
+	{
+		cfg.Rules = append(cfg.Rules, &corev1.Service_Spec_Config_HTTP_RequestFilter_Rule{
+			Name:    "invalid",
+			Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH,
+			Pattern: `(`,
+		})
+
+		rw := doReq(corev1.Service_Spec_HTTP, cfg, "/admin", nil)
+		assert.Equal(t, http.StatusForbidden, rw.Code, "rules cached for the same resource version")
+
+		resourceVersion = "2"
+		rw = doReq(corev1.Service_Spec_HTTP, cfg, "/", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+		assert.False(t, reached)
+
+		rw = doReq(corev1.Service_Spec_GRPC, cfg, "/x.Service/Get", nil)
+		assert.Equal(t, "14", rw.Header().Get("Grpc-Status"))
+		assert.False(t, reached)
+
+		cfg.Rules = cfg.Rules[:len(cfg.Rules)-1]
+		resourceVersion = "3"
+		rw = doReq(corev1.Service_Spec_HTTP, cfg, "/", nil)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+	}
+}
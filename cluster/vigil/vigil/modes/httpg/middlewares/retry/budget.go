@@ -0,0 +1,161 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package retry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultBudgetPercent    = 20
+	defaultBudgetWindow     = 10 * time.Second
+	defaultBudgetMinRetries = 3
+)
+
+// windowCounter approximates the number of events over a sliding window by
+// interpolating the count of the previous fixed window with the current one.
+type windowCounter struct {
+	startedAt time.Time
+	cur       float64
+	prev      float64
+}
+
+func (c *windowCounter) rotate(now time.Time, window time.Duration) {
+	elapsed := now.Sub(c.startedAt)
+	switch {
+	case elapsed < window:
+	case elapsed < 2*window:
+		c.prev = c.cur
+		c.cur = 0
+		c.startedAt = c.startedAt.Add(window)
+	default:
+		c.prev = 0
+		c.cur = 0
+		c.startedAt = now
+	}
+}
+
+func (c *windowCounter) get(now time.Time, window time.Duration) float64 {
+	weight := 1 - float64(now.Sub(c.startedAt))/float64(window)
+	return c.prev*max(weight, 0) + c.cur
+}
+
+// budget tracks the requests and retries of the Service in order to cap the
+// retries to a ratio of the requests.
+type budget struct {
+	mu       sync.Mutex
+	window   time.Duration
+	requests windowCounter
+	retries  windowCounter
+
+	percent    float64
+	minRetries float64
+
+	exhausted metric.Int64Counter
+}
+
+func newBudget() (*budget, error) {
+	ret := &budget{
+		window:     defaultBudgetWindow,
+		percent:    defaultBudgetPercent,
+		minRetries: defaultBudgetMinRetries,
+	}
+
+	meter := otelutils.GetMeter()
+
+	var err error
+	ret.exhausted, err = meter.Int64Counter(metricutils.GetKey("http.retry.budget.exhausted"),
+		metric.WithDescription("Total number of retries skipped since the retry budget is exhausted"))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := meter.Float64ObservableGauge(metricutils.GetKey("http.retry.budget.remaining"),
+		metric.WithDescription("Number of retries currently allowed by the retry budget"),
+		metric.WithFloat64Callback(func(ctx context.Context, o metric.Float64Observer) error {
+			o.Observe(ret.remaining(time.Now()))
+			return nil
+		})); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *budget) setConfigLocked(cfg *corev1.Service_Spec_Config_HTTP_Retry_Budget) {
+	window := defaultBudgetWindow
+	if val := umetav1.ToDuration(cfg.Window).ToGo(); val > 0 {
+		window = val
+	}
+	b.window = window
+
+	b.percent = defaultBudgetPercent
+	if cfg.Percent > 0 {
+		b.percent = float64(min(cfg.Percent, 100))
+	}
+
+	b.minRetries = defaultBudgetMinRetries
+	if cfg.MinRetries > 0 {
+		b.minRetries = float64(cfg.MinRetries)
+	}
+}
+
+func (b *budget) addRequest(now time.Time, cfg *corev1.Service_Spec_Config_HTTP_Retry_Budget) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.setConfigLocked(cfg)
+	b.requests.rotate(now, b.window)
+	b.requests.cur++
+}
+
+// tryRetry consumes a retry from the budget and returns false if the budget
+// is exhausted.
+func (b *budget) tryRetry(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.remainingLocked(now) < 1 {
+		b.exhausted.Add(context.Background(), 1)
+		return false
+	}
+
+	b.retries.cur++
+	return true
+}
+
+func (b *budget) remaining(now time.Time) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remainingLocked(now)
+}
+
+func (b *budget) remainingLocked(now time.Time) float64 {
+	b.requests.rotate(now, b.window)
+	b.retries.rotate(now, b.window)
+
+	allowed := max(b.requests.get(now, b.window)*b.percent/100, b.minRetries)
+	return max(allowed-b.retries.get(now, b.window), 0)
+}
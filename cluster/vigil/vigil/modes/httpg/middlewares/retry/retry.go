@@ -27,6 +27,7 @@ import (
 
 	"github.com/cenkalti/backoff/v5"
 	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
 	"github.com/octelium/octelium/pkg/apiutils/umetav1"
 	"github.com/pkg/errors"
@@ -34,12 +35,19 @@ import (
 )
 
 type middleware struct {
-	next http.Handler
+	next   http.Handler
+	budget *budget
 }
 
 func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	b, err := newBudget()
+	if err != nil {
+		return nil, err
+	}
+
 	return &middleware{
-		next: next,
+		next:   next,
+		budget: b,
 	}, nil
 }
 
@@ -53,6 +61,12 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// A streamed body cannot be replayed.
+	if reqCtx.IsBodyStreamed {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
 	retryCfg := svcCfg.GetHttp().Retry
 
 	backOff := backoff.NewExponentialBackOff()
@@ -84,6 +98,12 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	ctx := req.Context()
 
+	var retryBudget *budget
+	if retryCfg.Budget != nil {
+		retryBudget = m.budget
+		retryBudget.addRequest(time.Now(), retryCfg.Budget)
+	}
+
 	timer := &defaultTimer{}
 
 	defer timer.Stop()
@@ -102,6 +122,7 @@ func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			backOff:        backOff,
 			startedAt:      startedAt,
 			maxElapsedTime: maxElapsedTime,
+			budget:         retryBudget,
 		}
 
 		m.next.ServeHTTP(crw, req)
@@ -135,9 +156,19 @@ type responseWriter struct {
 	maxElapsedTime time.Duration
 	nextDuration   time.Duration
 	req            *http.Request
+	budget         *budget
 }
 
 func (w *responseWriter) WriteHeader(statusCode int) {
+	if httputils.IsInformationalStatus(statusCode) {
+		// Interim responses such as "100 Continue" are relayed as is and do
+		// not count as the final response of the attempt.
+		if !w.isWritten {
+			w.ResponseWriter.WriteHeader(statusCode)
+		}
+		return
+	}
+
 	w.statusCode = statusCode
 
 	if w.isWritten || w.isRetry {
@@ -198,48 +229,53 @@ func (p *responseWriter) Push(target string, opts *http.PushOptions) error {
 }
 
 func (w *responseWriter) setIsRetry() {
+	w.isRetry = w.shouldRetry()
+
+	// The budget is only consumed by the retries that would otherwise take
+	// place so that it reflects the actual upstream load.
+	if w.isRetry && w.budget != nil && !w.budget.tryRetry(time.Now()) {
+		zap.L().Debug("Retry budget is exhausted, not retrying request",
+			zap.Int("attempt", w.attempts))
+		w.isRetry = false
+	}
+}
+
+func (w *responseWriter) shouldRetry() bool {
 
 	cfg := w.cfg
 
 	if w.attempts >= w.maxRetries {
-		w.isRetry = false
-		return
+		return false
 	}
 
 	if err := context.Cause(w.req.Context()); err != nil {
-		w.isRetry = false
-		return
+		return false
 	}
 
 	w.nextDuration = w.backOff.NextBackOff()
 
 	if w.nextDuration == backoff.Stop {
-		w.isRetry = false
-		return
+		return false
 	}
 
 	if time.Since(w.startedAt)+w.nextDuration > w.maxElapsedTime {
-		w.isRetry = false
-		return
+		return false
 	}
 
 	if cfg.RetryOnServerErrors && w.statusCode >= 500 && w.statusCode < 600 {
-		w.isRetry = true
-		return
+		return true
 	}
 
 	if len(cfg.StatusCodes) > 0 && slices.Contains(cfg.StatusCodes, int32(w.statusCode)) {
-		w.isRetry = true
-		return
+		return true
 	}
 
 	switch w.statusCode {
 	case http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout:
-		w.isRetry = true
-		return
+		return true
 	}
 
-	w.isRetry = false
+	return false
 }
 
 type defaultTimer struct {
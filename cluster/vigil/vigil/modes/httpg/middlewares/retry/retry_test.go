@@ -149,3 +149,120 @@ func TestMiddleware(t *testing.T) {
 	}
 
 }
+
+func TestBudget(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	cfg := &corev1.Service_Spec_Config_HTTP_Retry_Budget{
+		Percent:    10,
+		MinRetries: 2,
+		Window: &metav1.Duration{
+			Type: &metav1.Duration_Seconds{
+				Seconds: 10,
+			},
+		},
+	}
+
+	{
+		b, err := newBudget()
+		assert.Nil(t, err)
+
+		now := time.Now()
+		for range 50 {
+			b.addRequest(now, cfg)
+		}
+
+		// 10% of 50 requests
+		for range 5 {
+			assert.True(t, b.tryRetry(now))
+		}
+		assert.False(t, b.tryRetry(now))
+		assert.Equal(t, float64(0), b.remaining(now))
+
+		for range 10 {
+			b.addRequest(now.Add(time.Second), cfg)
+		}
+		assert.True(t, b.tryRetry(now.Add(time.Second)))
+		assert.False(t, b.tryRetry(now.Add(time.Second)))
+
+		// Halfway through the next window, the previous counts are weighted
+		// by half.
+		later := now.Add(15 * time.Second)
+		assert.InDelta(t, float64(0), b.remaining(later), 0.01)
+
+		// The budget is fully restored once the counted events fall out of
+		// the window.
+		later = now.Add(30 * time.Second)
+		assert.Equal(t, float64(2), b.remaining(later))
+		assert.True(t, b.tryRetry(later))
+		assert.True(t, b.tryRetry(later))
+		assert.False(t, b.tryRetry(later))
+	}
+}
+
+func TestMiddlewareBudget(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var attempts int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	cfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				Retry: &corev1.Service_Spec_Config_HTTP_Retry{
+					MaxRetries: 3,
+					InitialInterval: &metav1.Duration{
+						Type: &metav1.Duration_Milliseconds{
+							Milliseconds: 1,
+						},
+					},
+					Budget: &corev1.Service_Spec_Config_HTTP_Retry_Budget{
+						MinRetries: 3,
+					},
+				},
+			},
+		},
+	}
+
+	doReq := func() int {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/prefix/v1", nil)
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt:     time.Now(),
+				ServiceConfig: cfg,
+			}))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, doReq())
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	assert.Equal(t, http.StatusServiceUnavailable, doReq())
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	assert.Equal(t, http.StatusServiceUnavailable, doReq())
+	assert.Equal(t, 1, attempts)
+}
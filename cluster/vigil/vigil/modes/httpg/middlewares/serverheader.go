@@ -0,0 +1,45 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+)
+
+const defaultServerHeader = "octelium"
+
+// SetServerHeader sets the Server header of a response, either proxied or
+// generated locally, according to the Service's config.
+func SetServerHeader(hdr http.Header, httpCfg *corev1.Service_Spec_Config_HTTP) {
+	cfg := httpCfg.GetHeader().GetServer()
+
+	switch cfg.GetMode() {
+	case corev1.Service_Spec_Config_HTTP_Header_Server_CUSTOM:
+		if cfg.Value != "" {
+			hdr.Set("Server", cfg.Value)
+		} else {
+			hdr.Set("Server", defaultServerHeader)
+		}
+	case corev1.Service_Spec_Config_HTTP_Header_Server_PRESERVE:
+	case corev1.Service_Spec_Config_HTTP_Header_Server_REMOVE:
+		hdr.Del("Server")
+	default:
+		hdr.Set("Server", defaultServerHeader)
+	}
+}
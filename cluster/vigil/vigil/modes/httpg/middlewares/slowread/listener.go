@@ -0,0 +1,137 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package slowread
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	phaseHeader = "header"
+	phaseBody   = "body"
+)
+
+func newCounter() (metric.Int64Counter, error) {
+	return otelutils.GetMeter().Int64Counter(metricutils.GetKey("http.conns.slow_read"),
+		metric.WithDescription("Total number of client connections dropped due to stalled reads"))
+}
+
+type listener struct {
+	net.Listener
+	dropped metric.Int64Counter
+}
+
+// NewListener wraps the listener so that the connections whose request
+// headers, or TLS handshake, are not read within the read deadline set by the
+// HTTP server are counted once the server drops them. It must be the
+// innermost listener of the TLS listener, if any.
+func NewListener(lis net.Listener) (net.Listener, error) {
+	dropped, err := newCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	return &listener{
+		Listener: lis,
+		dropped:  dropped,
+	}, nil
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{
+		Conn:    c,
+		dropped: l.dropped,
+	}, nil
+}
+
+type conn struct {
+	net.Conn
+	dropped metric.Int64Counter
+
+	hasDeadline atomic.Bool
+	// bodyReads is the number of the in-progress body reads whose timeouts
+	// are accounted by the middleware instead.
+	bodyReads atomic.Int32
+	// isDropped is set once the conn has been accounted as dropped.
+	isDropped atomic.Bool
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.setReadDeadline(t)
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.setReadDeadline(t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *conn) setReadDeadline(t time.Time) {
+	// The HTTP server also uses deadlines in the past to abort its pending
+	// background reads, which are not stalls.
+	c.hasDeadline.Store(!t.IsZero() && t.After(time.Now()))
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil && c.hasDeadline.Load() && c.bodyReads.Load() == 0 && isTimeout(err) {
+		if c.isDropped.CompareAndSwap(false, true) {
+			zap.L().Debug("Client conn stalled while sending request headers",
+				zap.String("addr", c.RemoteAddr().String()))
+			c.dropped.Add(context.Background(), 1, metric.WithAttributes(attribute.String("phase", phaseHeader)))
+		}
+	}
+
+	return n, err
+}
+
+// getConn returns the wrapped conn of the HTTP server conn, if any. The TLS
+// conns as well as the conns wrapped by the framing listener expose their
+// underlying conn via NetConn.
+func getConn(c net.Conn) *conn {
+	if netConn, ok := c.(interface{ NetConn() net.Conn }); ok {
+		c = netConn.NetConn()
+	}
+
+	ret, _ := c.(*conn)
+	return ret
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
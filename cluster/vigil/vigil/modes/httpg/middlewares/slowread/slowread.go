@@ -0,0 +1,167 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package slowread
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+type middleware struct {
+	next    http.Handler
+	dropped metric.Int64Counter
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	dropped, err := newCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	return &middleware{
+		next:    next,
+		dropped: dropped,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	timeout := umetav1.ToDuration(reqCtx.ServiceConfig.GetHttp().GetReadTimeout().GetBodyIdle()).ToGo()
+	if timeout <= 0 || req.Body == nil || req.Body == http.NoBody {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	crw := &responseWriter{
+		ResponseWriter: w,
+	}
+
+	c := getConn(reqCtx.Conn)
+	req.Body = &body{
+		ReadCloser: req.Body,
+		rc:         http.NewResponseController(w),
+		timeout:    timeout,
+		conn:       c,
+		onTimeout: func() {
+			zap.L().Debug("Client stalled while sending request body", zap.Duration("timeout", timeout))
+			m.dropped.Add(context.Background(), 1, metric.WithAttributes(attribute.String("phase", phaseBody)))
+			crw.closeConn.Store(true)
+			if c != nil {
+				// The server discards the rest of the body with the same
+				// deadline before closing the conn.
+				c.isDropped.Store(true)
+			}
+		},
+	}
+
+	m.next.ServeHTTP(crw, req)
+}
+
+// body extends the read deadline of the client connection before every read
+// so that only the inactivity is bounded regardless of the body size.
+type body struct {
+	io.ReadCloser
+	rc        *http.ResponseController
+	timeout   time.Duration
+	conn      *conn
+	onTimeout func()
+	once      sync.Once
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if err := b.rc.SetReadDeadline(time.Now().Add(b.timeout)); err != nil {
+		return b.ReadCloser.Read(p)
+	}
+
+	if b.conn != nil {
+		b.conn.bodyReads.Add(1)
+		defer b.conn.bodyReads.Add(-1)
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		// The HTTP/1.x server starts reading the conn in the background
+		// once the body is consumed and would otherwise time out.
+		b.rc.SetReadDeadline(time.Time{})
+	case isTimeout(err):
+		b.once.Do(b.onTimeout)
+	}
+
+	return n, err
+}
+
+// responseWriter closes the connection of the stalled requests once their
+// response is written.
+type responseWriter struct {
+	http.ResponseWriter
+	closeConn   atomic.Bool
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader && statusCode >= 200 {
+		w.wroteHeader = true
+		if w.closeConn.Load() {
+			w.Header().Set("Connection", "close")
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ResponseWriter is not a Hijacker")
+	}
+
+	return hj.Hijack()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
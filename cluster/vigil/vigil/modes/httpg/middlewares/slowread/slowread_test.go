@@ -0,0 +1,246 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package slowread
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+type captureListener struct {
+	net.Listener
+	conns chan *conn
+}
+
+func (l *captureListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.conns <- c.(*conn)
+	return c, nil
+}
+
+func newCaptureListener(t *testing.T) *captureListener {
+	raw, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+
+	lis, err := NewListener(raw)
+	assert.Nil(t, err)
+
+	return &captureListener{
+		Listener: lis,
+		conns:    make(chan *conn, 16),
+	}
+}
+
+func TestListener(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	lis := newCaptureListener(t)
+
+	reached := make(chan struct{}, 16)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached <- struct{}{}
+			w.WriteHeader(http.StatusOK)
+		}),
+		ReadHeaderTimeout: 300 * time.Millisecond,
+	}
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	{
+		// Sending the headers byte by byte.
+		c, err := net.Dial("tcp", lis.Addr().String())
+		assert.Nil(t, err)
+		defer c.Close()
+
+		sc := <-lis.conns
+
+		startedAt := time.Now()
+		var writeErr error
+		for _, b := range []byte("GET / HTTP/1.1\r\nHost: localhost\r\nX-Slow: 1\r\n") {
+			if _, writeErr = c.Write([]byte{b}); writeErr != nil {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+			if time.Since(startedAt) > 2*time.Second {
+				break
+			}
+		}
+
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err = io.ReadAll(c)
+		assert.Nil(t, err)
+		assert.True(t, time.Since(startedAt) < 2*time.Second)
+		assert.True(t, sc.isDropped.Load())
+		assert.Equal(t, 0, len(reached))
+	}
+
+	{
+		// Neither the regular requests nor the idle keep-alive connections are
+		// counted.
+		c, err := net.Dial("tcp", lis.Addr().String())
+		assert.Nil(t, err)
+		defer c.Close()
+
+		sc := <-lis.conns
+		br := bufio.NewReader(c)
+
+		for range 2 {
+			_, err = c.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			assert.Nil(t, err)
+
+			resp, err := http.ReadResponse(br, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp.Body.Close()
+			<-reached
+
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		assert.False(t, sc.isDropped.Load())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	cfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				ReadTimeout: &corev1.Service_Spec_Config_HTTP_ReadTimeout{
+					BodyIdle: &metav1.Duration{
+						Type: &metav1.Duration_Milliseconds{
+							Milliseconds: 300,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	lis := newCaptureListener(t)
+	srv := &http.Server{
+		Handler:           mdlwr,
+		ReadHeaderTimeout: 5 * time.Second,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, middlewares.CtxRequestContext, &middlewares.RequestContext{
+				CreatedAt:     time.Now(),
+				Conn:          c,
+				ServiceConfig: cfg,
+			})
+		},
+	}
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	sendBody := func(parts []string, interval time.Duration, size int) (*http.Response, *conn, net.Conn) {
+		c, err := net.Dial("tcp", lis.Addr().String())
+		assert.Nil(t, err)
+		sc := <-lis.conns
+
+		_, err = c.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: " +
+			strconv.Itoa(size) + "\r\n\r\n"))
+		assert.Nil(t, err)
+
+		for _, part := range parts {
+			time.Sleep(interval)
+			_, err = c.Write([]byte(part))
+			assert.Nil(t, err)
+		}
+
+		c.SetReadDeadline(time.Now().Add(3 * time.Second))
+		resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+		assert.Nil(t, err)
+		return resp, sc, c
+	}
+
+	{
+		// The body is slow but active, longer than the timeout in total.
+		resp, sc, c := sendBody([]string{"ab", "cd", "ef", "gh", "ij"}, 150*time.Millisecond, 10)
+		defer c.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "abcdefghij", string(body))
+		assert.False(t, resp.Close)
+		assert.False(t, sc.isDropped.Load())
+	}
+
+	{
+		resp, sc, c := sendBody([]string{"abc"}, 0, 10)
+		defer c.Close()
+		assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+		assert.True(t, resp.Close)
+		// Accounted as a body stall rather than a header one.
+		assert.True(t, sc.isDropped.Load())
+
+		_, err = io.ReadAll(c)
+		assert.Nil(t, err)
+	}
+
+	{
+		cfg.GetHttp().ReadTimeout = nil
+		resp, _, c := sendBody([]string{"ab", "cd", "ef", "gh", "ij"}, 400*time.Millisecond, 10)
+		defer c.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
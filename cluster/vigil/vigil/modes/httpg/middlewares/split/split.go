@@ -0,0 +1,230 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package split
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"time"
+
+	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/cluster/vigil/vigil/vigilutils"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/octelium/octelium/pkg/utils/utilrand"
+)
+
+type middleware struct {
+	next http.Handler
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	return &middleware{
+		next: next,
+	}, nil
+}
+
+const defaultCookieName = "octelium_split"
+const defaultCookieMaxAge = 30 * 24 * time.Hour
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	reqCtx := middlewares.GetCtxRequestContext(ctx)
+	svcCfg := reqCtx.ServiceConfig
+
+	if svcCfg == nil || svcCfg.GetHttp() == nil ||
+		svcCfg.GetHttp().Split == nil || len(svcCfg.GetHttp().Split.Variants) == 0 {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	cfg := svcCfg.GetHttp().Split
+
+	variants := getAllowedVariants(cfg, reqCtx.AuthResponse)
+
+	reqCtx.AddVary("Cookie")
+
+	variant, isNew := getVariant(req, cfg, variants, getBucketKey(reqCtx))
+	if variant == nil {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if isNew {
+		http.SetCookie(rw, getCookie(cfg, variant))
+	}
+
+	if cfg.Header != "" {
+		req.Header.Set(cfg.Header, variant.Name)
+	}
+
+	if variant.ConfigName != "" && reqCtx.AuthResponse != nil &&
+		variant.ConfigName != reqCtx.AuthResponse.ServiceConfigName {
+		authResp := pbutils.Clone(reqCtx.AuthResponse).(*coctovigilv1.AuthenticateAndAuthorizeResponse)
+		authResp.ServiceConfigName = variant.ConfigName
+		authResp.Config = nil
+
+		reqCtx.AuthResponse = authResp
+		reqCtx.ServiceConfig = vigilutils.GetServiceConfig(ctx, authResp)
+	}
+
+	m.next.ServeHTTP(rw, req)
+}
+
+// getAllowedVariants returns the variants to which the request can be
+// assigned. A variant config can only replace the default config. When the
+// authorization selects a specific config, only the variants that keep
+// that same config are used.
+func getAllowedVariants(cfg *corev1.Service_Spec_Config_HTTP_Split,
+	authResp *coctovigilv1.AuthenticateAndAuthorizeResponse) []*corev1.Service_Spec_Config_HTTP_Split_Variant {
+	if authResp == nil {
+		return nil
+	}
+
+	if authResp.Config == nil {
+		switch authResp.ServiceConfigName {
+		case "", "default":
+			return cfg.Variants
+		}
+	}
+
+	var ret []*corev1.Service_Spec_Config_HTTP_Split_Variant
+	for _, variant := range cfg.Variants {
+		if variant.ConfigName == "" ||
+			(authResp.Config == nil && variant.ConfigName == authResp.ServiceConfigName) {
+			ret = append(ret, variant)
+		}
+	}
+
+	return ret
+}
+
+// getVariant returns the variant of the request and whether it has been newly
+// assigned, in which case the sticky cookie needs to be set.
+func getVariant(req *http.Request, cfg *corev1.Service_Spec_Config_HTTP_Split,
+	variants []*corev1.Service_Spec_Config_HTTP_Split_Variant,
+	bucketKey string) (*corev1.Service_Spec_Config_HTTP_Split_Variant, bool) {
+
+	if cookie, err := req.Cookie(getCookieName(cfg)); err == nil {
+		if ret := findVariant(variants, cookie.Value); ret != nil && ret.Weight > 0 {
+			return ret, false
+		}
+	}
+
+	ret := assignVariant(variants, bucketKey)
+	return ret, ret != nil
+}
+
+func findVariant(variants []*corev1.Service_Spec_Config_HTTP_Split_Variant,
+	name string) *corev1.Service_Spec_Config_HTTP_Split_Variant {
+	if name == "" {
+		return nil
+	}
+
+	for _, variant := range variants {
+		if variant.Name == name {
+			return variant
+		}
+	}
+
+	return nil
+}
+
+// assignVariant picks a variant according to the weights. The assignment is
+// stable for non-empty bucket keys and random otherwise.
+func assignVariant(variants []*corev1.Service_Spec_Config_HTTP_Split_Variant,
+	bucketKey string) *corev1.Service_Spec_Config_HTTP_Split_Variant {
+	var total uint64
+	for _, variant := range variants {
+		total += uint64(variant.Weight)
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	var point uint64
+	if bucketKey != "" {
+		h := fnv.New64a()
+		h.Write([]byte(bucketKey))
+		point = h.Sum64() % total
+	} else {
+		point = uint64(utilrand.GetRandomRangeMath(0, int(total)-1))
+	}
+
+	var cur uint64
+	for _, variant := range variants {
+		cur += uint64(variant.Weight)
+		if point < cur {
+			return variant
+		}
+	}
+
+	return nil
+}
+
+func getBucketKey(reqCtx *middlewares.RequestContext) string {
+	if reqCtx.DownstreamInfo != nil && reqCtx.DownstreamInfo.Session != nil &&
+		reqCtx.DownstreamInfo.Session.Metadata != nil {
+		return reqCtx.DownstreamInfo.Session.Metadata.Uid
+	}
+
+	return ""
+}
+
+func getCookieName(cfg *corev1.Service_Spec_Config_HTTP_Split) string {
+	if cfg.Cookie != nil && cfg.Cookie.Name != "" {
+		return cfg.Cookie.Name
+	}
+
+	return defaultCookieName
+}
+
+func getCookie(cfg *corev1.Service_Spec_Config_HTTP_Split, variant *corev1.Service_Spec_Config_HTTP_Split_Variant) *http.Cookie {
+	ret := &http.Cookie{
+		Name:     getCookieName(cfg),
+		Value:    variant.Name,
+		Path:     "/",
+		MaxAge:   int(defaultCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if cookieCfg := cfg.Cookie; cookieCfg != nil {
+		ret.Domain = cookieCfg.Domain
+		if cookieCfg.Path != "" {
+			ret.Path = cookieCfg.Path
+		}
+
+		if maxAge := umetav1.ToDuration(cookieCfg.MaxAge).ToGo(); maxAge > 0 {
+			ret.MaxAge = int(maxAge.Seconds())
+		}
+
+		switch cookieCfg.SameSite {
+		case corev1.Service_Spec_Config_HTTP_Split_Cookie_STRICT:
+			ret.SameSite = http.SameSiteStrictMode
+		case corev1.Service_Spec_Config_HTTP_Split_Cookie_NONE:
+			ret.SameSite = http.SameSiteNoneMode
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package split
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var variantHdr string
+	var cfgName string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		variantHdr = r.Header.Get("X-Variant")
+		reqCtx := middlewares.GetCtxRequestContext(r.Context())
+		cfgName = reqCtx.AuthResponse.ServiceConfigName
+	})
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	svc := &corev1.Service{
+		Metadata: &metav1.Metadata{
+			Name: "svc1",
+		},
+		Spec: &corev1.Service_Spec{
+			Mode: corev1.Service_Spec_HTTP,
+			Config: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: &corev1.Service_Spec_Config_HTTP{
+						Split: &corev1.Service_Spec_Config_HTTP_Split{
+							Header: "X-Variant",
+							Variants: []*corev1.Service_Spec_Config_HTTP_Split_Variant{
+								{
+									Name:       "a",
+									Weight:     50,
+									ConfigName: "cfg-a",
+								},
+								{
+									Name:       "b",
+									Weight:     50,
+									ConfigName: "cfg-b",
+								},
+								{
+									Name:       "c",
+									ConfigName: "cfg-c",
+								},
+							},
+							Cookie: &corev1.Service_Spec_Config_HTTP_Split_Cookie{
+								Name:   "exp",
+								Domain: "example.com",
+								MaxAge: &metav1.Duration{
+									Type: &metav1.Duration_Hours{
+										Hours: 1,
+									},
+								},
+								SameSite: corev1.Service_Spec_Config_HTTP_Split_Cookie_STRICT,
+							},
+						},
+					},
+				},
+			},
+			DynamicConfig: &corev1.Service_Spec_DynamicConfig{
+				Configs: []*corev1.Service_Spec_Config{
+					{
+						Name: "cfg-a",
+					},
+					{
+						Name: "cfg-b",
+					},
+					{
+						Name: "cfg-c",
+					},
+				},
+			},
+		},
+	}
+
+	newReqWithConfig := func(uri string, sessUID string, cookie *http.Cookie, authCfgName string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, uri, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt:     time.Now(),
+			Service:       svc,
+			ServiceConfig: svc.Spec.Config,
+			AuthResponse: &coctovigilv1.AuthenticateAndAuthorizeResponse{
+				RequestContext: &corev1.RequestContext{
+					Service: svc,
+				},
+				ServiceConfigName: authCfgName,
+			},
+		}
+		if sessUID != "" {
+			reqCtx.DownstreamInfo = &corev1.RequestContext{
+				Session: &corev1.Session{
+					Metadata: &metav1.Metadata{
+						Uid: sessUID,
+					},
+				},
+			}
+		}
+
+		return req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+	}
+
+	newReq := func(uri string, sessUID string, cookie *http.Cookie) *http.Request {
+		return newReqWithConfig(uri, sessUID, cookie, "")
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq("http://localhost/", "", nil))
+
+		cookies := rw.Result().Cookies()
+		assert.Equal(t, 1, len(cookies))
+		cookie := cookies[0]
+		assert.Equal(t, "exp", cookie.Name)
+		assert.Equal(t, "example.com", cookie.Domain)
+		assert.Equal(t, 3600, cookie.MaxAge)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+		assert.True(t, cookie.Secure)
+		assert.Equal(t, cookie.Value, variantHdr)
+		assert.Equal(t, fmt.Sprintf("cfg-%s", cookie.Value), cfgName)
+
+		for i := 0; i < 20; i++ {
+			rw := httptest.NewRecorder()
+			mdlwr.ServeHTTP(rw, newReq("http://localhost/", "", cookie))
+			assert.Equal(t, 0, len(rw.Result().Cookies()))
+			assert.Equal(t, cookie.Value, variantHdr)
+			assert.Equal(t, fmt.Sprintf("cfg-%s", cookie.Value), cfgName)
+		}
+	}
+
+	{
+		sessUID := vutils.UUIDv4()
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq("http://localhost/", sessUID, nil))
+		first := variantHdr
+
+		for i := 0; i < 20; i++ {
+			rw := httptest.NewRecorder()
+			mdlwr.ServeHTTP(rw, newReq("http://localhost/", sessUID, nil))
+			assert.Equal(t, first, variantHdr)
+		}
+
+		assert.Equal(t, 1, len(rw.Result().Cookies()))
+	}
+
+	{
+		for _, val := range []string{"a", "b"} {
+			rw := httptest.NewRecorder()
+			mdlwr.ServeHTTP(rw, newReq("http://localhost/?variant=c", "", &http.Cookie{
+				Name:  "exp",
+				Value: val,
+			}))
+			assert.Equal(t, 0, len(rw.Result().Cookies()))
+			assert.Equal(t, val, variantHdr)
+			assert.Equal(t, fmt.Sprintf("cfg-%s", val), cfgName)
+		}
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		req := newReq("http://localhost/", "", &http.Cookie{
+			Name:  "exp",
+			Value: "c",
+		})
+		req.Header.Set("X-Forwarded-Proto", "http")
+		mdlwr.ServeHTTP(rw, req)
+		cookies := rw.Result().Cookies()
+		assert.Equal(t, 1, len(cookies))
+		assert.True(t, cookies[0].Value == "a" || cookies[0].Value == "b")
+		assert.True(t, cookies[0].Secure)
+		assert.NotEqual(t, "cfg-c", cfgName)
+	}
+
+	{
+		for _, val := range []string{"a", "b", "c"} {
+			rw := httptest.NewRecorder()
+			mdlwr.ServeHTTP(rw, newReqWithConfig("http://localhost/", "", &http.Cookie{
+				Name:  "exp",
+				Value: val,
+			}, "cfg-b"))
+			assert.Equal(t, "b", variantHdr)
+			assert.Equal(t, "cfg-b", cfgName)
+			if val == "b" {
+				assert.Equal(t, 0, len(rw.Result().Cookies()))
+			}
+		}
+	}
+
+	{
+		variantHdr = ""
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReqWithConfig("http://localhost/", "", &http.Cookie{
+			Name:  "exp",
+			Value: "a",
+		}, "cfg-other"))
+		assert.Equal(t, 0, len(rw.Result().Cookies()))
+		assert.Equal(t, "", variantHdr)
+		assert.Equal(t, "cfg-other", cfgName)
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, newReq("http://localhost/", "", &http.Cookie{
+			Name:  "exp",
+			Value: "unknown",
+		}))
+		cookies := rw.Result().Cookies()
+		assert.Equal(t, 1, len(cookies))
+		assert.True(t, cookies[0].Value == "a" || cookies[0].Value == "b")
+	}
+}
+
+func TestAssignVariant(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	variants := []*corev1.Service_Spec_Config_HTTP_Split_Variant{
+		{
+			Name:   "a",
+			Weight: 90,
+		},
+		{
+			Name:   "b",
+			Weight: 10,
+		},
+		{
+			Name: "c",
+		},
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		key := vutils.UUIDv4()
+		variant := assignVariant(variants, key)
+		assert.NotNil(t, variant)
+		assert.Equal(t, variant, assignVariant(variants, key))
+		counts[variant.Name]++
+	}
+
+	assert.Equal(t, 0, counts["c"])
+	assert.True(t, counts["a"] > 8500 && counts["a"] < 9500, "%+v", counts)
+
+	assert.Nil(t, assignVariant([]*corev1.Service_Spec_Config_HTTP_Split_Variant{
+		{
+			Name: "a",
+		},
+	}, ""))
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+)
+
+type middleware struct {
+	next http.Handler
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	return &middleware{
+		next: next,
+	}, nil
+}
+
+const defaultClientTimeoutHeader = "X-Request-Timeout"
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	svcCfg := reqCtx.ServiceConfig
+
+	if svcCfg == nil || svcCfg.GetHttp() == nil ||
+		svcCfg.GetHttp().Timeout == nil {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	cfg := svcCfg.GetHttp().Timeout
+	isGRPC := ucorev1.ToService(reqCtx.Service).IsGRPC()
+
+	timeout := umetav1.ToDuration(cfg.Max).ToGo()
+	if clientTimeout := getClientTimeout(req, cfg, isGRPC); clientTimeout > 0 {
+		if timeout == 0 || clientTimeout < timeout {
+			timeout = clientTimeout
+		}
+	}
+
+	if timeout <= 0 {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if isGRPC {
+		req.Header.Set("Grpc-Timeout", httputils.EncodeGRPCTimeout(timeout))
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	m.next.ServeHTTP(rw, req.WithContext(ctx))
+}
+
+func getClientTimeout(req *http.Request,
+	cfg *corev1.Service_Spec_Config_HTTP_Timeout, isGRPC bool) time.Duration {
+	if cfg.ClientTimeout == nil || !cfg.ClientTimeout.IsEnabled {
+		return 0
+	}
+
+	if isGRPC {
+		ret, err := httputils.ParseGRPCTimeout(req.Header.Get("Grpc-Timeout"))
+		if err != nil {
+			return 0
+		}
+		return ret
+	}
+
+	hdr := cfg.ClientTimeout.Header
+	if hdr == "" {
+		hdr = defaultClientTimeoutHeader
+	}
+
+	return parseTimeout(req.Header.Get(hdr))
+}
+
+func parseTimeout(arg string) time.Duration {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return 0
+	}
+
+	if secs, err := strconv.ParseFloat(arg, 64); err == nil {
+		if secs <= 0 || secs > float64(365*24*60*60) {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+
+	ret, err := time.ParseDuration(arg)
+	if err != nil || ret < 0 {
+		return 0
+	}
+
+	return ret
+}
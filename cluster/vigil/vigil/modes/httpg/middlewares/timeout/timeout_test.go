@@ -0,0 +1,166 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var deadline time.Time
+	var hasDeadline bool
+	var grpcTimeout string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, hasDeadline = r.Context().Deadline()
+		grpcTimeout = r.Header.Get("Grpc-Timeout")
+	})
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	newReq := func(svc *corev1.Service, cfg *corev1.Service_Spec_Config_HTTP_Timeout) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		return req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service:   svc,
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							Timeout: cfg,
+						},
+					},
+				},
+			}))
+	}
+
+	httpSvc := &corev1.Service{
+		Spec: &corev1.Service_Spec{
+			Mode: corev1.Service_Spec_HTTP,
+		},
+	}
+
+	grpcSvc := &corev1.Service{
+		Spec: &corev1.Service_Spec{
+			Mode: corev1.Service_Spec_GRPC,
+		},
+	}
+
+	{
+		req := newReq(httpSvc, nil)
+		req.Header.Set("X-Request-Timeout", "2s")
+		mdlwr.ServeHTTP(nil, req)
+		assert.False(t, hasDeadline)
+	}
+
+	{
+		req := newReq(httpSvc, &corev1.Service_Spec_Config_HTTP_Timeout{
+			Max: &metav1.Duration{
+				Type: &metav1.Duration_Seconds{
+					Seconds: 10,
+				},
+			},
+		})
+		req.Header.Set("X-Request-Timeout", "2s")
+		mdlwr.ServeHTTP(nil, req)
+		assert.True(t, hasDeadline)
+		assert.True(t, time.Until(deadline) > 5*time.Second)
+	}
+
+	{
+		req := newReq(httpSvc, &corev1.Service_Spec_Config_HTTP_Timeout{
+			Max: &metav1.Duration{
+				Type: &metav1.Duration_Seconds{
+					Seconds: 10,
+				},
+			},
+			ClientTimeout: &corev1.Service_Spec_Config_HTTP_Timeout_ClientTimeout{
+				IsEnabled: true,
+			},
+		})
+		req.Header.Set("X-Request-Timeout", "2s")
+		mdlwr.ServeHTTP(nil, req)
+		assert.True(t, hasDeadline)
+		assert.True(t, time.Until(deadline) <= 2*time.Second)
+	}
+
+	{
+		req := newReq(httpSvc, &corev1.Service_Spec_Config_HTTP_Timeout{
+			Max: &metav1.Duration{
+				Type: &metav1.Duration_Seconds{
+					Seconds: 1,
+				},
+			},
+			ClientTimeout: &corev1.Service_Spec_Config_HTTP_Timeout_ClientTimeout{
+				IsEnabled: true,
+				Header:    "X-Custom-Timeout",
+			},
+		})
+		req.Header.Set("X-Custom-Timeout", "30")
+		mdlwr.ServeHTTP(nil, req)
+		assert.True(t, hasDeadline)
+		assert.True(t, time.Until(deadline) <= 1*time.Second)
+	}
+
+	{
+		req := newReq(httpSvc, &corev1.Service_Spec_Config_HTTP_Timeout{
+			ClientTimeout: &corev1.Service_Spec_Config_HTTP_Timeout_ClientTimeout{
+				IsEnabled: true,
+			},
+		})
+		req.Header.Set("X-Request-Timeout", "invalid")
+		mdlwr.ServeHTTP(nil, req)
+		assert.False(t, hasDeadline)
+	}
+
+	{
+		req := newReq(grpcSvc, &corev1.Service_Spec_Config_HTTP_Timeout{
+			Max: &metav1.Duration{
+				Type: &metav1.Duration_Seconds{
+					Seconds: 3,
+				},
+			},
+			ClientTimeout: &corev1.Service_Spec_Config_HTTP_Timeout_ClientTimeout{
+				IsEnabled: true,
+			},
+		})
+		req.Header.Set("Grpc-Timeout", "60S")
+		mdlwr.ServeHTTP(nil, req)
+		assert.True(t, hasDeadline)
+		assert.True(t, time.Until(deadline) <= 3*time.Second)
+		assert.Equal(t, "3000000u", grpcTimeout)
+	}
+}
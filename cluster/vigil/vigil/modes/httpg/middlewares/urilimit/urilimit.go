@@ -0,0 +1,87 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package urilimit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/octelium/octelium/cluster/common/otelutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+type middleware struct {
+	next     http.Handler
+	rejected metric.Int64Counter
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	ret := &middleware{
+		next: next,
+	}
+
+	var err error
+	ret.rejected, err = otelutils.GetMeter().Int64Counter(metricutils.GetKey("http.requests.uri_too_long"),
+		metric.WithDescription("Total number of requests rejected due to the length of their URI"))
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	cfg := reqCtx.ServiceConfig.GetHttp().GetUri()
+	if cfg == nil || (cfg.MaxLength == 0 && cfg.MaxQueryLength == 0) {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+
+	if target := getLimitTarget(req, cfg.MaxLength, cfg.MaxQueryLength); target != "" {
+		m.rejected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("target", target)))
+		zap.L().Debug("Rejecting request due to its URI length",
+			zap.String("target", target), zap.Int("length", len(getRequestURI(req))))
+		w.WriteHeader(http.StatusRequestURITooLong)
+		return
+	}
+
+	m.next.ServeHTTP(w, req)
+}
+
+// getLimitTarget returns the part of the URI, if any, that exceeds its limit.
+func getLimitTarget(req *http.Request, maxLength, maxQueryLength uint32) string {
+	if maxLength > 0 && len(getRequestURI(req)) > int(maxLength) {
+		return "uri"
+	}
+
+	if maxQueryLength > 0 && len(req.URL.RawQuery) > int(maxQueryLength) {
+		return "query"
+	}
+
+	return ""
+}
+
+// getRequestURI returns the escaped path and query of the request. The scheme
+// and host of the absolute-form request targets are not taken into account.
+func getRequestURI(req *http.Request) string {
+	return req.URL.RequestURI()
+}
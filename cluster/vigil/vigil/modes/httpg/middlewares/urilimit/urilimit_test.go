@@ -0,0 +1,126 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package urilimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mdlwr, err := New(ctx, next)
+	assert.Nil(t, err)
+
+	doReq := func(cfg *corev1.Service_Spec_Config_HTTP_URI, target string) *httptest.ResponseRecorder {
+		reached = false
+		req := httptest.NewRequest(http.MethodGet, "http://localhost"+target, nil)
+
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							Uri: cfg,
+						},
+					},
+				},
+			}))
+
+		rw := httptest.NewRecorder()
+		mdlwr.ServeHTTP(rw, req)
+		return rw
+	}
+
+	longPath := "/" + strings.Repeat("a", 100)
+	longQuery := "/?q=" + strings.Repeat("b", 100)
+
+	{
+		rw := doReq(nil, longPath+longQuery[1:])
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+	}
+
+	{
+		cfg := &corev1.Service_Spec_Config_HTTP_URI{
+			MaxLength: 64,
+		}
+
+		rw := doReq(cfg, "/short?a=b")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+
+		rw = doReq(cfg, longPath)
+		assert.Equal(t, http.StatusRequestURITooLong, rw.Code)
+		assert.False(t, reached)
+
+		rw = doReq(cfg, longQuery)
+		assert.Equal(t, http.StatusRequestURITooLong, rw.Code)
+		assert.False(t, reached)
+
+		rw = doReq(cfg, "/"+strings.Repeat("a", 63))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+
+		rw = doReq(cfg, "/"+strings.Repeat("a", 64))
+		assert.Equal(t, http.StatusRequestURITooLong, rw.Code)
+		assert.False(t, reached)
+	}
+
+	{
+		cfg := &corev1.Service_Spec_Config_HTTP_URI{
+			MaxQueryLength: 32,
+		}
+
+		rw := doReq(cfg, longPath)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+
+		rw = doReq(cfg, "/?"+strings.Repeat("c", 32))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.True(t, reached)
+
+		rw = doReq(cfg, longQuery)
+		assert.Equal(t, http.StatusRequestURITooLong, rw.Code)
+		assert.False(t, reached)
+	}
+}
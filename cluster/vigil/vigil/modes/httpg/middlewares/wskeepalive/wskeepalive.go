@@ -0,0 +1,329 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package wskeepalive
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	defaultInterval = 30 * time.Second
+	defaultTimeout  = 10 * time.Second
+)
+
+type middleware struct {
+	next http.Handler
+}
+
+func New(ctx context.Context, next http.Handler) (http.Handler, error) {
+	return &middleware{
+		next: next,
+	}, nil
+}
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	reqCtx := middlewares.GetCtxRequestContext(req.Context())
+	svcCfg := reqCtx.ServiceConfig
+
+	if svcCfg == nil || svcCfg.GetHttp() == nil || svcCfg.GetHttp().WebSocket == nil ||
+		svcCfg.GetHttp().WebSocket.Keepalive == nil || !svcCfg.GetHttp().WebSocket.Keepalive.IsEnabled ||
+		!isWebSocketUpgrade(req) {
+		m.next.ServeHTTP(rw, req)
+		return
+	}
+
+	cfg := svcCfg.GetHttp().WebSocket.Keepalive
+
+	interval := defaultInterval
+	if val := umetav1.ToDuration(cfg.Interval).ToGo(); val > 0 {
+		interval = val
+	}
+
+	timeout := defaultTimeout
+	if val := umetav1.ToDuration(cfg.Timeout).ToGo(); val > 0 {
+		timeout = val
+	}
+
+	m.next.ServeHTTP(&responseWriter{
+		ResponseWriter: rw,
+		interval:       interval,
+		timeout:        timeout,
+	}, req)
+}
+
+func isWebSocketUpgrade(req *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(req.Header["Connection"], "Upgrade") &&
+		strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.Errorf("ResponseWriter is not a Hijacker")
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return newConn(conn, w.interval, w.timeout), brw, nil
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+const (
+	opcodePing = 0x9
+	opcodePong = 0xA
+)
+
+// pingFrame is an unmasked, empty-payload ping frame as sent by servers.
+var pingFrame = []byte{0x80 | opcodePing, 0x00}
+
+// conn wraps the hijacked client connection of a WebSocket. It tracks the
+// frame boundaries of both directions so that ping frames are only injected
+// between the frames written by the upstream and so that the pong frames
+// received from the client are detected. All the frames, including the
+// pongs answering the injected pings, are passed through untouched.
+type conn struct {
+	net.Conn
+	interval time.Duration
+	timeout  time.Duration
+
+	mu           sync.Mutex
+	writeParser  frameParser
+	lastActivity time.Time
+	pingSentAt   time.Time
+	isPingDue    bool
+
+	readParser frameParser
+
+	closeOnce sync.Once
+	doneCh    chan struct{}
+}
+
+func newConn(c net.Conn, interval, timeout time.Duration) *conn {
+	ret := &conn{
+		Conn:         c,
+		interval:     interval,
+		timeout:      timeout,
+		lastActivity: time.Now(),
+		doneCh:       make(chan struct{}),
+	}
+
+	ret.readParser.onFrame = ret.onReadFrame
+
+	go ret.run()
+
+	return ret
+}
+
+func (c *conn) run() {
+	tickInterval := min(c.interval, c.timeout) / 2
+	ticker := time.NewTicker(max(tickInterval, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.doneCh:
+			return
+		case now := <-ticker.C:
+			if !c.tick(now) {
+				zap.L().Debug("Closing WebSocket connection after pong timeout",
+					zap.String("remoteAddr", c.RemoteAddr().String()))
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *conn) tick(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.pingSentAt.IsZero() {
+		return now.Sub(c.pingSentAt) < c.timeout
+	}
+
+	if now.Sub(c.lastActivity) >= c.interval {
+		c.isPingDue = true
+		c.writePingIfDue()
+	}
+
+	return true
+}
+
+// writePingIfDue must be called with the lock held.
+func (c *conn) writePingIfDue() {
+	if !c.isPingDue || !c.writeParser.atBoundary() {
+		return
+	}
+
+	c.isPingDue = false
+	if _, err := c.Conn.Write(pingFrame); err != nil {
+		return
+	}
+	c.pingSentAt = time.Now()
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.Conn.Write(b)
+	c.writeParser.feed(b[:n])
+	c.lastActivity = time.Now()
+	if err != nil {
+		return n, err
+	}
+
+	c.writePingIfDue()
+
+	return n, nil
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.readParser.feed(b[:n])
+
+		c.mu.Lock()
+		c.lastActivity = time.Now()
+		c.mu.Unlock()
+	}
+
+	return n, err
+}
+
+func (c *conn) onReadFrame(opcode byte) {
+	if opcode != opcodePong {
+		return
+	}
+
+	c.mu.Lock()
+	c.pingSentAt = time.Time{}
+	c.mu.Unlock()
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.doneCh)
+	})
+	return c.Conn.Close()
+}
+
+func (c *conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// frameParser tracks the WebSocket framing of a stream as defined in
+// RFC 6455 section 5.2 without buffering the payloads.
+type frameParser struct {
+	hdr       [14]byte
+	hdrLen    int
+	remaining uint64
+	onFrame   func(opcode byte)
+}
+
+func (p *frameParser) atBoundary() bool {
+	return p.hdrLen == 0 && p.remaining == 0
+}
+
+func (p *frameParser) headerSize() int {
+	if p.hdrLen < 2 {
+		return 2
+	}
+
+	ret := 2
+	switch p.hdr[1] & 0x7f {
+	case 126:
+		ret += 2
+	case 127:
+		ret += 8
+	}
+	if p.hdr[1]&0x80 != 0 {
+		ret += 4
+	}
+
+	return ret
+}
+
+func (p *frameParser) payloadLen() uint64 {
+	switch l := p.hdr[1] & 0x7f; l {
+	case 126:
+		return uint64(p.hdr[2])<<8 | uint64(p.hdr[3])
+	case 127:
+		var ret uint64
+		for i := 2; i < 10; i++ {
+			ret = ret<<8 | uint64(p.hdr[i])
+		}
+		return ret
+	default:
+		return uint64(l)
+	}
+}
+
+func (p *frameParser) feed(b []byte) {
+	for len(b) > 0 {
+		if p.remaining > 0 {
+			n := min(uint64(len(b)), p.remaining)
+			p.remaining -= n
+			b = b[n:]
+			continue
+		}
+
+		p.hdr[p.hdrLen] = b[0]
+		p.hdrLen++
+		b = b[1:]
+
+		if p.hdrLen < p.headerSize() {
+			continue
+		}
+
+		p.remaining = p.payloadLen()
+		p.hdrLen = 0
+		if p.onFrame != nil {
+			p.onFrame(p.hdr[0] & 0x0f)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package wskeepalive
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameParser(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var opcodes []byte
+	p := &frameParser{
+		onFrame: func(opcode byte) {
+			opcodes = append(opcodes, opcode)
+		},
+	}
+
+	// Unmasked text frame with a 5 bytes payload
+	p.feed([]byte{0x81, 0x05, 'h', 'e'})
+	assert.False(t, p.atBoundary())
+	p.feed([]byte{'l', 'l', 'o'})
+	assert.True(t, p.atBoundary())
+
+	// Masked pong frame with an empty payload
+	p.feed([]byte{0x8a, 0x80, 1, 2})
+	assert.False(t, p.atBoundary())
+	p.feed([]byte{3, 4})
+	assert.True(t, p.atBoundary())
+
+	// Binary frame with a 16-bit extended payload length
+	frame := append([]byte{0x82, 126, 0x01, 0x00}, make([]byte, 256)...)
+	for _, b := range frame {
+		p.feed([]byte{b})
+	}
+	assert.True(t, p.atBoundary())
+
+	// Binary frame with a 64-bit extended payload length
+	p.feed(append([]byte{0x82, 127, 0, 0, 0, 0, 0, 0, 0x01, 0x00}, make([]byte, 100)...))
+	assert.False(t, p.atBoundary())
+	p.feed(make([]byte, 156))
+	assert.True(t, p.atBoundary())
+
+	assert.Equal(t, []byte{0x1, opcodePong, 0x2, 0x2}, opcodes)
+}
+
+func TestConn(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	readFrame := func(c net.Conn) []byte {
+		buf := make([]byte, 2)
+		_, err := io.ReadFull(c, buf)
+		assert.Nil(t, err)
+		return buf
+	}
+
+	{
+		srvConn, clientConn := net.Pipe()
+		c := newConn(srvConn, 50*time.Millisecond, 200*time.Millisecond)
+		defer c.Close()
+
+		go func() {
+			buf := make([]byte, 1024)
+			for {
+				if _, err := c.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, pingFrame, readFrame(clientConn))
+			_, err := clientConn.Write([]byte{0x8a, 0x80, 1, 2, 3, 4})
+			assert.Nil(t, err)
+		}
+
+		go func() {
+			c.Write([]byte{0x81, 0x02, 'h'})
+			time.Sleep(150 * time.Millisecond)
+			c.Write([]byte{'i'})
+		}()
+
+		// The ping is not injected in the middle of the upstream frame
+		buf := make([]byte, 5)
+		_, err := io.ReadFull(clientConn, buf)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{0x81, 0x02, 'h', 'i', pingFrame[0]}, buf)
+
+		clientConn.Close()
+	}
+
+	{
+		srvConn, clientConn := net.Pipe()
+		c := newConn(srvConn, 50*time.Millisecond, 100*time.Millisecond)
+		defer c.Close()
+
+		assert.Equal(t, pingFrame, readFrame(clientConn))
+
+		_, err := clientConn.Read(make([]byte, 1))
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/md4"
+)
+
+// This file implements the client side of the NTLMv2 handshake as described
+// in MS-NLMP. Only what is needed to authenticate the connection is
+// implemented, the session security (i.e. signing and sealing) is not.
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+const (
+	ntlmMessageNegotiate    = 1
+	ntlmMessageChallenge    = 2
+	ntlmMessageAuthenticate = 3
+)
+
+const (
+	ntlmFlagUnicode                 = 0x00000001
+	ntlmFlagOEM                     = 0x00000002
+	ntlmFlagRequestTarget           = 0x00000004
+	ntlmFlagNTLM                    = 0x00000200
+	ntlmFlagAlwaysSign              = 0x00008000
+	ntlmFlagExtendedSessionSecurity = 0x00080000
+	ntlmFlagTargetInfo              = 0x00800000
+	ntlmFlag128                     = 0x20000000
+	ntlmFlag56                      = 0x80000000
+
+	ntlmNegotiateFlags = ntlmFlagUnicode | ntlmFlagOEM | ntlmFlagRequestTarget |
+		ntlmFlagNTLM | ntlmFlagAlwaysSign | ntlmFlagExtendedSessionSecurity |
+		ntlmFlagTargetInfo | ntlmFlag128 | ntlmFlag56
+)
+
+const ntlmAvTimestamp = 7
+
+type ntlmCredentials struct {
+	username string
+	domain   string
+	password string
+}
+
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func newNTLMNegotiateMessage() []byte {
+	ret := make([]byte, 32)
+	copy(ret, ntlmSignature)
+	binary.LittleEndian.PutUint32(ret[8:], ntlmMessageNegotiate)
+	binary.LittleEndian.PutUint32(ret[12:], ntlmNegotiateFlags)
+	return ret
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 48 || !bytes.Equal(msg[:8], ntlmSignature) {
+		return nil, errors.Errorf("Invalid NTLM challenge message")
+	}
+
+	if binary.LittleEndian.Uint32(msg[8:]) != ntlmMessageChallenge {
+		return nil, errors.Errorf("Not an NTLM challenge message")
+	}
+
+	ret := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(msg[20:]),
+		serverChallenge: msg[24:32],
+	}
+
+	if ret.flags&ntlmFlagTargetInfo != 0 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, errors.Errorf("Invalid NTLM challenge target info")
+		}
+		ret.targetInfo = msg[offset : offset+length]
+	}
+
+	return ret, nil
+}
+
+// getTimestamp returns the MsvAvTimestamp of the target info if set.
+func (c *ntlmChallenge) getTimestamp() []byte {
+	info := c.targetInfo
+	for len(info) >= 4 {
+		id := binary.LittleEndian.Uint16(info)
+		length := int(binary.LittleEndian.Uint16(info[2:]))
+		if len(info) < 4+length {
+			return nil
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return info[4:12]
+		}
+		if id == 0 {
+			return nil
+		}
+		info = info[4+length:]
+	}
+
+	return nil
+}
+
+func ntlmEncodeString(s string, isUnicode bool) []byte {
+	if !isUnicode {
+		return []byte(s)
+	}
+
+	u := utf16.Encode([]rune(s))
+	ret := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(ret[2*i:], c)
+	}
+	return ret
+}
+
+func ntlmHMACMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func ntlmv2ResponseKey(creds *ntlmCredentials) []byte {
+	h := md4.New()
+	h.Write(ntlmEncodeString(creds.password, true))
+
+	return ntlmHMACMD5(h.Sum(nil),
+		ntlmEncodeString(strings.ToUpper(creds.username)+creds.domain, true))
+}
+
+// toFileTime returns the time as the number of 100-nanosecond intervals
+// since January 1, 1601.
+func toFileTime(t time.Time) []byte {
+	ret := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ret, uint64(t.UnixNano()/100+116444736000000000))
+	return ret
+}
+
+func getNTLMv2Responses(creds *ntlmCredentials, challenge *ntlmChallenge,
+	clientChallenge, timestamp []byte) ([]byte, []byte) {
+	key := ntlmv2ResponseKey(creds)
+
+	temp := &bytes.Buffer{}
+	temp.Write([]byte{0x01, 0x01, 0, 0, 0, 0, 0, 0})
+	temp.Write(timestamp)
+	temp.Write(clientChallenge)
+	temp.Write([]byte{0, 0, 0, 0})
+	temp.Write(challenge.targetInfo)
+	temp.Write([]byte{0, 0, 0, 0})
+
+	ntProof := ntlmHMACMD5(key, challenge.serverChallenge, temp.Bytes())
+	nt := append(ntProof, temp.Bytes()...)
+	lm := append(ntlmHMACMD5(key, challenge.serverChallenge, clientChallenge), clientChallenge...)
+
+	return lm, nt
+}
+
+func newNTLMAuthenticateMessage(creds *ntlmCredentials, challenge *ntlmChallenge,
+	clientChallenge []byte, now time.Time) []byte {
+	timestamp := challenge.getTimestamp()
+	hasTimestamp := timestamp != nil
+	if !hasTimestamp {
+		timestamp = toFileTime(now)
+	}
+
+	lm, nt := getNTLMv2Responses(creds, challenge, clientChallenge, timestamp)
+	if hasTimestamp {
+		// The LMv2 response must not be sent once the server provides its
+		// own timestamp.
+		lm = make([]byte, 24)
+	}
+
+	isUnicode := challenge.flags&ntlmFlagUnicode != 0
+	flags := challenge.flags
+	if isUnicode {
+		flags &^= ntlmFlagOEM
+	}
+
+	const headerLen = 64
+
+	payload := &bytes.Buffer{}
+	header := make([]byte, headerLen)
+	copy(header, ntlmSignature)
+	binary.LittleEndian.PutUint32(header[8:], ntlmMessageAuthenticate)
+
+	putField := func(offset int, value []byte) {
+		binary.LittleEndian.PutUint16(header[offset:], uint16(len(value)))
+		binary.LittleEndian.PutUint16(header[offset+2:], uint16(len(value)))
+		binary.LittleEndian.PutUint32(header[offset+4:], uint32(headerLen+payload.Len()))
+		payload.Write(value)
+	}
+
+	putField(12, lm)
+	putField(20, nt)
+	putField(28, ntlmEncodeString(creds.domain, isUnicode))
+	putField(36, ntlmEncodeString(creds.username, isUnicode))
+	putField(44, nil)
+	putField(52, nil)
+	binary.LittleEndian.PutUint32(header[60:], flags)
+
+	return append(header, payload.Bytes()...)
+}
@@ -0,0 +1,319 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/cluster/vigil/vigil/secretman"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/pkg/errors"
+)
+
+const defaultNTLMMaxIdleConns = 16
+
+// ntlmTransport authenticates the connections to the upstream using the NTLM
+// handshake. Since NTLM authenticates the connection rather than the request,
+// every connection has its own Transport that is limited to a single
+// connection and is exclusively used by a single request at a time.
+type ntlmTransport struct {
+	cfg          *corev1.Service_Spec_Config_HTTP_Auth_NTLM
+	getPassword  func(ctx context.Context) (string, error)
+	newTransport func() (*http.Transport, error)
+
+	mu   sync.Mutex
+	idle []*ntlmConn
+}
+
+type ntlmConn struct {
+	rt              *http.Transport
+	isAuthenticated bool
+}
+
+func newNTLMTransport(cfg *corev1.Service_Spec_Config_HTTP_Auth_NTLM,
+	getPassword func(ctx context.Context) (string, error),
+	newTransport func() (*http.Transport, error)) *ntlmTransport {
+	return &ntlmTransport{
+		cfg:         cfg,
+		getPassword: getPassword,
+		newTransport: func() (*http.Transport, error) {
+			rt, err := newTransport()
+			if err != nil {
+				return nil, err
+			}
+			rt.MaxConnsPerHost = 1
+			rt.MaxIdleConnsPerHost = 1
+			return rt, nil
+		},
+	}
+}
+
+func (t *ntlmTransport) scheme() string {
+	if t.cfg.Scheme == corev1.Service_Spec_Config_HTTP_Auth_NTLM_NEGOTIATE {
+		return "Negotiate"
+	}
+	return "NTLM"
+}
+
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := t.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.roundTrip(conn, req)
+	if err != nil {
+		conn.rt.CloseIdleConnections()
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// The connection is then owned by the upgraded stream.
+		return resp, nil
+	}
+
+	resp.Body = &ntlmBody{
+		ReadCloser: resp.Body,
+		release: func() {
+			t.release(conn)
+		},
+	}
+
+	return resp, nil
+}
+
+func (t *ntlmTransport) roundTrip(conn *ntlmConn, req *http.Request) (*http.Response, error) {
+	if conn.isAuthenticated {
+		resp, err := conn.rt.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.getChallenge(resp) == nil || !isNTLMRequestReplayable(req) {
+			return resp, nil
+		}
+
+		// The upstream has closed the authenticated connection, hence a new
+		// connection has been used that needs its own handshake.
+		drainResponse(resp)
+		conn.isAuthenticated = false
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+
+	return t.authenticate(conn, req)
+}
+
+func (t *ntlmTransport) authenticate(conn *ntlmConn, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// The negotiate leg is sent without the body, which is then only sent once
+	// along with the authenticate message.
+	negotiateReq := req.Clone(ctx)
+	negotiateReq.Body = http.NoBody
+	negotiateReq.ContentLength = 0
+	negotiateReq.GetBody = nil
+	negotiateReq.TransferEncoding = nil
+	negotiateReq.Header.Del("Content-Length")
+	negotiateReq.Header.Del("Expect")
+	negotiateReq.Header.Set("Authorization",
+		t.scheme()+" "+base64.StdEncoding.EncodeToString(newNTLMNegotiateMessage()))
+
+	resp, err := conn.rt.RoundTrip(negotiateReq)
+	if err != nil {
+		return nil, err
+	}
+
+	challengeMsg := t.getChallenge(resp)
+	if challengeMsg == nil {
+		if resp.StatusCode == http.StatusUnauthorized {
+			return resp, nil
+		}
+
+		// The upstream does not require authentication.
+		drainResponse(resp)
+		conn.isAuthenticated = true
+		return conn.rt.RoundTrip(req)
+	}
+	drainResponse(resp)
+
+	challenge, err := parseNTLMChallenge(challengeMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := t.getPassword(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := &ntlmCredentials{
+		username: t.cfg.Username,
+		domain:   t.cfg.Domain,
+		password: password,
+	}
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	authReq := req.Clone(ctx)
+	authReq.Header.Set("Authorization",
+		t.scheme()+" "+base64.StdEncoding.EncodeToString(
+			newNTLMAuthenticateMessage(creds, challenge, clientChallenge, time.Now())))
+
+	resp, err = conn.rt.RoundTrip(authReq)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.isAuthenticated = resp.StatusCode != http.StatusUnauthorized
+
+	return resp, nil
+}
+
+func getNTLMPasswordFn(secretMan *secretman.SecretManager,
+	cfg *corev1.Service_Spec_Config_HTTP_Auth_NTLM) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		secretName := cfg.GetPassword().GetFromSecret()
+		secret, err := secretMan.GetByName(ctx, secretName)
+		middlewares.LogAuthInjection(middlewares.GetCtxRequestContext(ctx), &middlewares.AuthInjectionEvent{
+			Type:       middlewares.AuthInjectionNTLM,
+			SecretName: secretName,
+			Secret:     secret,
+			Err:        err,
+		})
+		if err != nil {
+			return "", errors.Errorf("Could not get NTLM Secret: %+v", err)
+		}
+
+		return ucorev1.ToSecret(secret).GetValueStr(), nil
+	}
+}
+
+// getChallenge returns the NTLM message of an unauthorized response, which is
+// empty if the upstream only requests the handshake to start.
+func (t *ntlmTransport) getChallenge(resp *http.Response) []byte {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil
+	}
+
+	scheme := t.scheme()
+	for _, val := range resp.Header.Values("Www-Authenticate") {
+		val = strings.TrimSpace(val)
+		if strings.EqualFold(val, scheme) {
+			return []byte{}
+		}
+
+		if len(val) > len(scheme) && strings.EqualFold(val[:len(scheme)+1], scheme+" ") {
+			ret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(val[len(scheme)+1:]))
+			if err != nil {
+				return nil
+			}
+			return ret
+		}
+	}
+
+	return nil
+}
+
+func (t *ntlmTransport) acquire() (*ntlmConn, error) {
+	t.mu.Lock()
+	if n := len(t.idle); n > 0 {
+		conn := t.idle[n-1]
+		t.idle = t.idle[:n-1]
+		t.mu.Unlock()
+		return conn, nil
+	}
+	t.mu.Unlock()
+
+	rt, err := t.newTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ntlmConn{
+		rt: rt,
+	}, nil
+}
+
+func (t *ntlmTransport) release(conn *ntlmConn) {
+	maxIdle := defaultNTLMMaxIdleConns
+	if t.cfg.MaxIdleConnections > 0 {
+		maxIdle = int(t.cfg.MaxIdleConnections)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.idle) >= maxIdle {
+		conn.rt.CloseIdleConnections()
+		return
+	}
+
+	t.idle = append(t.idle, conn)
+}
+
+func (t *ntlmTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, conn := range t.idle {
+		conn.rt.CloseIdleConnections()
+	}
+	t.idle = nil
+}
+
+func isNTLMRequestReplayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func drainResponse(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+}
+
+// ntlmBody releases the connection back to the pool once the response body is
+// closed so that the connection is not used by another request in the meantime.
+type ntlmBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *ntlmBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultProtocolDetectionTTL     = 10 * time.Minute
+	protocolDetectionTimeout        = 5 * time.Second
+	protocolDetectionFailureBackoff = 30 * time.Second
+)
+
+type upstreamProtocol struct {
+	isTLS   bool
+	isHTTP2 bool
+}
+
+func (p *upstreamProtocol) scheme() string {
+	if p.isTLS {
+		return "https"
+	}
+	return "http"
+}
+
+type protocolDetector struct {
+	mu      sync.Mutex
+	entries map[string]*protocolEntry
+	group   singleflight.Group
+}
+
+type protocolEntry struct {
+	proto     *upstreamProtocol
+	expiresAt time.Time
+}
+
+func newProtocolDetector() *protocolDetector {
+	return &protocolDetector{
+		entries: make(map[string]*protocolEntry),
+	}
+}
+
+// isAmbiguousScheme reports whether the upstream URL scheme does not
+// explicitly set the protocol spoken by the upstream.
+func isAmbiguousScheme(scheme string) bool {
+	switch scheme {
+	case "https", "http", "ws", "wss", "grpc", "h2c":
+		return false
+	default:
+		return true
+	}
+}
+
+func getUpstreamAddr(upstream *loadbalancer.Upstream) string {
+	if upstream.IsUser {
+		return upstream.HostPort
+	}
+	return upstream.URL.Host
+}
+
+// get returns the detected protocol of the upstream. Detection only runs once
+// per upstream address until the cached result expires. The detection runs
+// without holding any lock, the concurrent requests to an upstream whose
+// protocol is not known yet wait for the ongoing detection up to their own
+// deadline while those of an upstream whose result has just expired keep
+// using it until the detection completes. A nil result means that the
+// protocol could not be detected and the default scheme mapping should be
+// used instead.
+func (d *protocolDetector) get(ctx context.Context,
+	upstream *loadbalancer.Upstream,
+	cfg *corev1.Service_Spec_Config_HTTP_ProtocolDetection,
+	getTLSCfg func() (*tls.Config, error)) *upstreamProtocol {
+
+	addr := getUpstreamAddr(upstream)
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	entry, ok := d.entries[addr]
+	d.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.proto
+	}
+
+	resCh := d.group.DoChan(addr, func() (any, error) {
+		return d.detect(ctx, addr, cfg, getTLSCfg), nil
+	})
+
+	if ok {
+		return entry.proto
+	}
+
+	select {
+	case res := <-resCh:
+		ret, _ := res.Val.(*upstreamProtocol)
+		return ret
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (d *protocolDetector) detect(ctx context.Context, addr string,
+	cfg *corev1.Service_Spec_Config_HTTP_ProtocolDetection,
+	getTLSCfg func() (*tls.Config, error)) *upstreamProtocol {
+	ret, err := detectProtocol(ctx, addr, getTLSCfg)
+	if err != nil {
+		zap.L().Debug("Could not detect upstream protocol",
+			zap.String("addr", addr), zap.Error(err))
+		d.set(addr, nil, protocolDetectionFailureBackoff)
+		return nil
+	}
+
+	ttl := defaultProtocolDetectionTTL
+	if cfgTTL := umetav1.ToDuration(cfg.Ttl).ToGo(); cfgTTL > 0 {
+		ttl = cfgTTL
+	}
+
+	zap.L().Debug("Detected upstream protocol",
+		zap.String("addr", addr), zap.Bool("tls", ret.isTLS), zap.Bool("http2", ret.isHTTP2))
+
+	d.set(addr, ret, ttl)
+
+	return ret
+}
+
+func (d *protocolDetector) set(addr string, proto *upstreamProtocol, ttl time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[addr] = &protocolEntry{
+		proto:     proto,
+		expiresAt: time.Now().Add(ttl),
+	}
+}
+
+func detectProtocol(ctx context.Context, addr string,
+	getTLSCfg func() (*tls.Config, error)) (*upstreamProtocol, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), protocolDetectionTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tlsCfg, err := getTLSCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	} else {
+		tlsCfg = tlsCfg.Clone()
+	}
+	tlsCfg.NextProtos = []string{"h2", "http/1.1"}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+
+	tlsConn := tls.Client(conn, tlsCfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		return getProtocolFromHandshakeError(err)
+	}
+
+	return &upstreamProtocol{
+		isTLS:   true,
+		isHTTP2: tlsConn.ConnectionState().NegotiatedProtocol == "h2",
+	}, nil
+}
+
+// getProtocolFromHandshakeError returns the protocol of an upstream that
+// failed the TLS handshake. The upstream is only considered to be plaintext
+// if it clearly answered the ClientHello as such, i.e. with an HTTP/1.x
+// response or an HTTP/2 SETTINGS frame. Other failures, e.g. a connection
+// reset, are ambiguous and returned as errors so that the default scheme
+// mapping is used instead.
+func getProtocolFromHandshakeError(err error) (*upstreamProtocol, error) {
+	var verifyErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	if errors.As(err, &verifyErr) || errors.As(err, &alertErr) {
+		return &upstreamProtocol{
+			isTLS: true,
+		}, nil
+	}
+
+	var recordErr tls.RecordHeaderError
+	if !errors.As(err, &recordErr) {
+		return nil, err
+	}
+
+	hdr := recordErr.RecordHeader[:]
+	switch {
+	case bytes.HasPrefix(hdr, []byte("HTTP/")):
+		return &upstreamProtocol{}, nil
+	case hdr[0] == 0 && hdr[3] == http2FrameSettings:
+		return &upstreamProtocol{
+			isHTTP2: true,
+		}, nil
+	default:
+		return nil, err
+	}
+}
+
+// http2FrameSettings is the type of the HTTP/2 SETTINGS frame with which an
+// h2c upstream starts the connection.
+const http2FrameSettings = 0x4
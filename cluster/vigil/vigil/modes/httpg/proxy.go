@@ -19,12 +19,14 @@ package httpg
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"strings"
 	"time"
 
@@ -32,20 +34,26 @@ import (
 	sigv4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/quota"
+	"github.com/octelium/octelium/cluster/vigil/vigil/mtls"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
 	"github.com/octelium/octelium/pkg/utils/utilrand"
 	"go.uber.org/zap"
 	"golang.org/x/net/http/httpguts"
+	"google.golang.org/grpc/codes"
 )
 
 type directResponseHandler struct {
-	direct *corev1.Service_Spec_Config_HTTP_Response_Direct
+	direct  *corev1.Service_Spec_Config_HTTP_Response_Direct
+	httpCfg *corev1.Service_Spec_Config_HTTP
 }
 
 func (h *directResponseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	w.Header().Set("Server", "octelium")
+	middlewares.SetServerHeader(w.Header(), h.httpCfg)
 	resp := h.direct
 	if resp == nil {
 		return
@@ -91,6 +99,33 @@ func (h *directResponseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 	}
 }
 
+const defaultFlushInterval = 100 * time.Millisecond
+
+// getFlushInterval returns the flush interval of the reverse proxy from the
+// Service's config, falling back to the Cluster's default. A negative
+// interval flushes after every write and a zero one disables the periodic
+// flushing.
+func getFlushInterval(cfgs ...*corev1.Service_Spec_Config_HTTP_Flush) time.Duration {
+	for _, cfg := range cfgs {
+		switch cfg.GetType().(type) {
+		case *corev1.Service_Spec_Config_HTTP_Flush_Interval:
+			if val := umetav1.ToDuration(cfg.GetInterval()).ToGo(); val > 0 {
+				return val
+			}
+		case *corev1.Service_Spec_Config_HTTP_Flush_Immediate:
+			if cfg.GetImmediate() {
+				return -1
+			}
+		case *corev1.Service_Spec_Config_HTTP_Flush_Disabled:
+			if cfg.GetDisabled() {
+				return 0
+			}
+		}
+	}
+
+	return defaultFlushInterval
+}
+
 func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 	reqCtx := middlewares.GetCtxRequestContext(ctx)
 
@@ -104,7 +139,8 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 
 	if httpCfg != nil && httpCfg.Response != nil && httpCfg.Response.GetDirect() != nil {
 		return &directResponseHandler{
-			direct: httpCfg.Response.GetDirect(),
+			direct:  httpCfg.Response.GetDirect(),
+			httpCfg: httpCfg,
 		}, nil
 	}
 
@@ -113,14 +149,42 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 		return nil, err
 	}
 
-	roundTripper, err := s.getRoundTripper(upstream)
+	var detected *upstreamProtocol
+	if httpCfg != nil && httpCfg.ProtocolDetection != nil && httpCfg.ProtocolDetection.IsEnabled &&
+		isAmbiguousScheme(upstream.URL.Scheme) {
+		detected = s.protoDetector.get(ctx, upstream, httpCfg.ProtocolDetection, func() (*tls.Config, error) {
+			return mtls.GetClientTLSCfg(ctx, reqCtx.Service, cfg, s.secretMan, upstream)
+		})
+	}
+
+	roundTripper, err := s.getRoundTripper(upstream, detected)
 	if err != nil {
 		return nil, err
 	}
 
+	var transport http.RoundTripper = roundTripper
+	if fanOutCfg := httpCfg.GetFanOut(); fanOutCfg != nil && fanOutCfg.IsEnabled && len(fanOutCfg.Regions) > 0 {
+		transport = s.getFanOutRoundTripper(roundTripper,
+			reqCtx.Service.GetStatus().GetRegionRef().GetName(), fanOutCfg)
+	}
+
+	if redirectCfg := httpCfg.GetFollowRedirects(); redirectCfg != nil && redirectCfg.IsEnabled {
+		transport = s.getRedirectRoundTripper(transport, redirectCfg,
+			httpCfg.GetAuth() != nil || ucorev1.ToService(reqCtx.Service).IsKubernetes())
+	}
+
+	flushInterval := getFlushInterval(httpCfg.GetFlush(), s.defaultFlush)
+	if ucorev1.ToService(reqCtx.Service).IsGRPC() {
+		// gRPC messages are forwarded as soon as they are received since
+		// streams are long-lived and messages are not necessarily followed
+		// by more data. The writes block on the downstream flow control
+		// window which in turn preserves the upstream backpressure.
+		flushInterval = -1
+	}
+
 	ret := &httputil.ReverseProxy{
-		BufferPool: newBufferPool(),
-		Transport:  roundTripper,
+		BufferPool: getBufferPool(httpCfg),
+		Transport:  transport,
 		ErrorLog:   s.reverseProxyErrLogger,
 		Director: func(outReq *http.Request) {
 			svc := reqCtx.Service
@@ -135,7 +199,9 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 			case "wss":
 				outReq.URL.Scheme = "https"
 			default:
-				if cfg != nil && (cfg.ClientCertificate != nil ||
+				if detected != nil {
+					outReq.URL.Scheme = detected.scheme()
+				} else if cfg != nil && (cfg.ClientCertificate != nil ||
 					(cfg.Tls != nil && cfg.Tls.ClientCertificate != nil)) {
 					outReq.URL.Scheme = "https"
 				} else {
@@ -149,6 +215,8 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 					outReq.Host = vutils.GetServicePublicFQDN(svc, s.domain)
 				} else if val := hostCfg.GetValue(); val != "" {
 					outReq.Host = val
+				} else if tmpl := hostCfg.GetTemplate(); tmpl != nil && tmpl.Value != "" {
+					outReq.Host = getTemplatedHost(tmpl, outReq, reqCtx, upstream.URL.Host)
 				} else if val := hostCfg.GetEval(); val != "" {
 					res, err := s.celEngine.EvalPolicyString(ctx, val, reqCtx.ReqCtxMap)
 					if err == nil && res != "" {
@@ -170,16 +238,14 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 				outReq.URL.Host = upstream.URL.Host
 			}
 
-			outReq.URL.RawQuery = strings.ReplaceAll(outReq.URL.RawQuery, ";", "&")
+			setUpstreamQuery(outReq, httpCfg.GetUri())
 			outReq.RequestURI = ""
 
-			if _, ok := outReq.Header["User-Agent"]; !ok {
-				outReq.Header.Set("User-Agent", "octelium")
-			}
+			applyUserAgent(outReq.Header, httpCfg.GetUserAgent())
 
 			fixWebSocketHeaders(outReq)
 
-			if isHTTP2RequestUpstream(outReq, svc) {
+			if isHTTP2RequestUpstream(outReq, svc, detected) {
 				outReq.Proto = "HTTP/2"
 				outReq.ProtoMajor = 2
 				outReq.ProtoMinor = 0
@@ -219,11 +285,19 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 				}
 			}
 
-			/*
-				if outReq.Header.Get("Origin") != "" {
-					outReq.Header.Set("Origin", upstream.URL.String())
-				}
-			*/
+			setUpstreamOrigin(outReq, upstream.URL, httpCfg.GetHeader().GetOrigin())
+
+			if !httpCfg.GetHeader().GetPreserveNameCase() {
+				normalizeHeaderNames(outReq.Header, outReq.ProtoMajor == 2)
+			}
+
+			applyDuplicateHeaders(outReq.Header, httpCfg.GetHeader().GetDuplicateRequestHeaders())
+			setUpstreamAcceptEncoding(outReq, httpCfg)
+
+			body := reqCtx.Body
+			if !reqCtx.IsBodyStreamed {
+				body = compressRequestBody(outReq, body, httpCfg.GetRequestCompression())
+			}
 
 			if httpCfg != nil && httpCfg.GetAuth() != nil &&
 				httpCfg.GetAuth().GetSigv4() != nil {
@@ -233,10 +307,13 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 				if err == nil {
 					signer := sigv4.NewSigner()
 
-					payloadHash := fmt.Sprintf("%x", sha256.Sum256([]byte(reqCtx.Body)))
+					payloadHash := fmt.Sprintf("%x", sha256.Sum256(body))
+					if reqCtx.IsBodyStreamed {
+						payloadHash = "UNSIGNED-PAYLOAD"
+					}
 					outReq.Header.Set("X-Amz-Content-Sha256", payloadHash)
 
-					if err := signer.SignHTTP(ctx,
+					err := signer.SignHTTP(ctx,
 						aws.Credentials{
 							AccessKeyID:     sigv4Opts.AccessKeyID,
 							SecretAccessKey: ucorev1.ToSecret(secret).GetValueStr(),
@@ -245,16 +322,44 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 						payloadHash,
 						sigv4Opts.Service, sigv4Opts.Region,
 						time.Now(),
-					); err != nil {
+					)
+					middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+						Type:       middlewares.AuthInjectionSigv4,
+						SecretName: sigv4Opts.GetSecretAccessKey().GetFromSecret(),
+						Secret:     secret,
+						Err:        err,
+					})
+					if err != nil {
 						zap.L().Warn("Could not signHTTP for sigv4", zap.Error(err))
 						return
 					}
 				} else {
+					middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+						Type:       middlewares.AuthInjectionSigv4,
+						SecretName: sigv4Opts.GetSecretAccessKey().GetFromSecret(),
+						Err:        err,
+					})
 					zap.L().Warn("Could not get sigv4 Secret", zap.Error(err))
 				}
 
 			}
 
+			if hmacOpts := httpCfg.GetAuth().GetHmac(); hmacOpts != nil {
+				secretName := hmacOpts.GetKey().GetFromSecret()
+				secret, err := s.secretMan.GetByName(ctx, secretName)
+				if err == nil {
+					signHMAC(outReq, hmacOpts, ucorev1.ToSecret(secret).GetValueBytes(), body, time.Now())
+				} else {
+					zap.L().Warn("Could not get HMAC Secret", zap.Error(err))
+				}
+				middlewares.LogAuthInjection(reqCtx, &middlewares.AuthInjectionEvent{
+					Type:       middlewares.AuthInjectionHMAC,
+					SecretName: secretName,
+					Secret:     secret,
+					Err:        err,
+				})
+			}
+
 			/*
 				if ldflags.IsDev() {
 					zap.L().Debug("Outgoing req",
@@ -264,37 +369,97 @@ func (s *Server) getProxy(ctx context.Context) (http.Handler, error) {
 			*/
 		},
 
-		FlushInterval: time.Duration(100 * time.Millisecond),
+		FlushInterval: flushInterval,
 		ModifyResponse: func(r *http.Response) error {
-			r.Header.Set("Server", "octelium")
+			middlewares.SetServerHeader(r.Header, httpCfg)
+			if err := checkResponseContentType(r, httpCfg.GetResponseContentType()); err != nil {
+				return err
+			}
+			rewriteSetCookies(r.Header, httpCfg.GetCookie())
+			applyDuplicateHeaders(r.Header, httpCfg.GetHeader().GetDuplicateResponseHeaders())
+			transformResponseStream(r, httpCfg.GetStreamTransform())
+			if err := bufferResponse(r, httpCfg.GetResponseBuffering()); err != nil {
+				return err
+			}
+			if err := formatJSONResponse(r, httpCfg.GetJsonFormat()); err != nil {
+				return err
+			}
+			if err := setResponseETag(r, httpCfg.GetEtag()); err != nil {
+				return err
+			}
+			setHeadResponseHeaders(r, httpCfg)
+			httputils.MergeVary(r.Header, reqCtx.VaryHeaders...)
 			return nil
 		},
 
-		ErrorHandler: func(w http.ResponseWriter, request *http.Request, err error) {
-			statusCode := http.StatusInternalServerError
-			switch {
-			case errors.Is(err, io.EOF):
+		ErrorHandler: s.handleProxyError,
+	}
+	return ret, nil
+}
+
+// handleProxyError responds to the requests that could not be proxied to the
+// upstream with a status code that reflects the failure.
+func (s *Server) handleProxyError(w http.ResponseWriter, request *http.Request, err error) {
+	reqCtx := middlewares.GetCtxRequestContext(request.Context())
+	httpCfg := reqCtx.ServiceConfig.GetHttp()
+
+	statusCode := http.StatusInternalServerError
+	switch {
+	case reqCtx.IsClientDisconnected():
+		statusCode = 499
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		statusCode = http.StatusBadGateway
+	case errors.Is(err, context.Canceled):
+		statusCode = http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(request.Context().Err(), context.DeadlineExceeded):
+		if ucorev1.ToService(reqCtx.Service).IsGRPC() {
+			writeGRPCStatus(w, codes.DeadlineExceeded, "Deadline exceeded")
+			return
+		}
+		statusCode = http.StatusGatewayTimeout
+	case errors.Is(err, errRedirectLoop):
+		statusCode = http.StatusLoopDetected
+	case errors.Is(err, errTooManyRedirects):
+		statusCode = http.StatusBadGateway
+	case errors.Is(err, quota.ErrExceeded):
+		statusCode = http.StatusTooManyRequests
+	case errors.Is(err, errContentTypeNotAllowed):
+		statusCode = getContentTypeBlockedStatusCode(httpCfg.GetResponseContentType())
+	case errors.Is(err, mtls.ErrFingerprintMismatch):
+		middlewares.LogPinnedFingerprintMismatch(reqCtx, request.URL.Host)
+		statusCode = http.StatusBadGateway
+	case isConnectError(err):
+		zap.L().Debug("Could not connect to upstream",
+			zap.String("reason", upstreamUnavailableConnectFailed), zap.Error(err))
+		s.metricsStore.AtUpstreamUnavailable(upstreamUnavailableConnectFailed)
+		statusCode = http.StatusServiceUnavailable
+	default:
+		zap.L().Warn("Could not proxy request to upstream", zap.Error(err))
+		var netErr net.Error
+		if errors.As(err, &netErr) {
+			if netErr.Timeout() {
+				statusCode = http.StatusGatewayTimeout
+			} else {
 				statusCode = http.StatusBadGateway
-			case errors.Is(err, context.Canceled):
-				statusCode = 499
-			default:
-				zap.L().Warn("Could not proxy request to upstream", zap.Error(err))
-				var netErr net.Error
-				if errors.As(err, &netErr) {
-					if netErr.Timeout() {
-						statusCode = http.StatusGatewayTimeout
-					} else {
-						statusCode = http.StatusBadGateway
-					}
-				}
 			}
+		}
+	}
 
-			w.Header().Set("Server", "octelium")
-			w.WriteHeader(statusCode)
-			w.Write([]byte(http.StatusText(statusCode)))
-		},
+	writeErrorResponse(w, request, httpCfg, statusCode)
+}
+
+// isConnectError reports whether the error occurred while establishing the
+// connection to the upstream, i.e. before the request has been sent, so that
+// it is reported as 503 and can be safely retried.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
 	}
-	return ret, nil
+
+	var timeoutErr tlsHandshakeTimeoutError
+	return errors.As(err, &timeoutErr)
 }
 
 func isWebSocketUpgrade(req *http.Request) bool {
@@ -315,6 +480,39 @@ func removeAllForwardedHeaders(outReq *http.Request) {
 	hdr.Del("X-Forwarded-Proto")
 }
 
+// setUpstreamQuery sets the query separators of the request sent to the
+// upstream according to the Service's semicolon handling.
+func setUpstreamQuery(outReq *http.Request, cfg *corev1.Service_Spec_Config_HTTP_URI) {
+	switch cfg.GetSemicolon() {
+	case corev1.Service_Spec_Config_HTTP_URI_PRESERVE:
+		// The ReverseProxy drops the query parameters that cannot be parsed,
+		// including the ones containing ";", if the form has been parsed by a
+		// middleware.
+		outReq.Form = nil
+	default:
+		outReq.URL.RawQuery = strings.ReplaceAll(outReq.URL.RawQuery, ";", "&")
+	}
+}
+
+// setUpstreamOrigin sets the Origin header of the request sent to the
+// upstream according to the Service's Origin mode.
+func setUpstreamOrigin(outReq *http.Request, upstreamURL *url.URL, cfg *corev1.Service_Spec_Config_HTTP_Header_Origin) {
+	switch cfg.GetMode() {
+	case corev1.Service_Spec_Config_HTTP_Header_Origin_REWRITE:
+		if outReq.Header.Get("Origin") != "" {
+			// The Director has already mapped the ws, wss and grpc upstream
+			// schemes to their HTTP counterparts.
+			outReq.Header.Set("Origin", fmt.Sprintf("%s://%s", outReq.URL.Scheme, upstreamURL.Host))
+		}
+	case corev1.Service_Spec_Config_HTTP_Header_Origin_FIXED:
+		if cfg.Value != "" {
+			outReq.Header.Set("Origin", cfg.Value)
+		}
+	case corev1.Service_Spec_Config_HTTP_Header_Origin_STRIP:
+		outReq.Header.Del("Origin")
+	}
+}
+
 func fixWebSocketHeaders(outReq *http.Request) {
 	if !isWebSocketUpgrade(outReq) {
 		return
@@ -0,0 +1,288 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxRedirects = 5
+	maxMaxRedirects     = 10
+
+	redirectResultFollowed = "followed"
+	redirectResultBlocked  = "blocked"
+	redirectResultLoop     = "loop"
+	redirectResultExceeded = "exceeded"
+)
+
+var (
+	errRedirectLoop     = errors.New("upstream redirect loop detected")
+	errTooManyRedirects = errors.New("too many upstream redirects")
+)
+
+// redirectRoundTripper follows the upstream redirect responses and returns
+// the final response. Redirects are only followed to the same upstream origin
+// or to the explicitly allowed hosts, any other redirect is returned as is.
+// When Vigil injects upstream credentials, redirects are only followed to the
+// same origin since the injected headers (e.g. custom header, sigv4 and HMAC
+// signatures) cannot all be known and stripped here.
+type redirectRoundTripper struct {
+	next            http.RoundTripper
+	maxRedirects    int
+	allowedHosts    []string
+	sameOriginOnly  bool
+	getRoundTripper func(u *url.URL) (http.RoundTripper, error)
+	results         metric.Int64Counter
+}
+
+func (s *Server) getRedirectRoundTripper(next http.RoundTripper,
+	cfg *corev1.Service_Spec_Config_HTTP_FollowRedirects, hasUpstreamAuth bool) http.RoundTripper {
+	maxRedirects := defaultMaxRedirects
+	if cfg.MaxRedirects > 0 {
+		maxRedirects = min(int(cfg.MaxRedirects), maxMaxRedirects)
+	}
+
+	return &redirectRoundTripper{
+		next:           next,
+		maxRedirects:   maxRedirects,
+		allowedHosts:   cfg.AllowedHosts,
+		sameOriginOnly: hasUpstreamAuth,
+		getRoundTripper: func(u *url.URL) (http.RoundTripper, error) {
+			upstream, err := loadbalancer.NewURLUpstream(u.Scheme + "://" + u.Host)
+			if err != nil {
+				return nil, err
+			}
+			return s.getRoundTripper(upstream, nil)
+		},
+		results: s.metricsStore.upstreamRedirects,
+	}
+}
+
+func (r *redirectRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := req.URL
+	visited := map[string]struct{}{
+		getRedirectKey(req.Method, req.URL): {},
+	}
+
+	for i := 0; ; i++ {
+		target := getRedirectTarget(resp, req.URL)
+		if target == nil {
+			return resp, nil
+		}
+
+		rt := r.getTargetRoundTripper(origin, target)
+		if rt == nil {
+			zap.L().Debug("Not following upstream redirect to a disallowed host",
+				zap.String("host", target.Host))
+			r.record(redirectResultBlocked)
+			return resp, nil
+		}
+
+		nextReq, err := getRedirectRequest(req, resp.StatusCode, target)
+		if err != nil {
+			drainResponse(resp)
+			return nil, err
+		}
+		if nextReq == nil {
+			return resp, nil
+		}
+
+		key := getRedirectKey(nextReq.Method, target)
+		if _, ok := visited[key]; ok {
+			drainResponse(resp)
+			r.record(redirectResultLoop)
+			return nil, errRedirectLoop
+		}
+
+		if i >= r.maxRedirects {
+			drainResponse(resp)
+			r.record(redirectResultExceeded)
+			return nil, errTooManyRedirects
+		}
+
+		visited[key] = struct{}{}
+		drainResponse(resp)
+		r.record(redirectResultFollowed)
+
+		resp, err = rt.RoundTrip(nextReq)
+		if err != nil {
+			return nil, err
+		}
+		req = nextReq
+	}
+}
+
+// getTargetRoundTripper returns the RoundTripper used to follow the redirect
+// or nil if the redirect target is not allowed.
+func (r *redirectRoundTripper) getTargetRoundTripper(origin, target *url.URL) http.RoundTripper {
+	if target.Scheme == origin.Scheme && target.Host == origin.Host {
+		return r.next
+	}
+
+	if r.sameOriginOnly {
+		return nil
+	}
+
+	if !isRedirectHostAllowed(target.Hostname(), r.allowedHosts) {
+		return nil
+	}
+
+	rt, err := r.getRoundTripper(target)
+	if err != nil {
+		zap.L().Debug("Could not get redirect target roundTripper", zap.Error(err))
+		return nil
+	}
+
+	return rt
+}
+
+func (r *redirectRoundTripper) record(result string) {
+	if r.results == nil {
+		return
+	}
+
+	r.results.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("result", result)))
+}
+
+func getRedirectKey(method string, u *url.URL) string {
+	return method + " " + u.String()
+}
+
+// getRedirectTarget returns the resolved Location of a redirect response or
+// nil if the response is not a redirect that can be followed.
+func getRedirectTarget(resp *http.Response, reqURL *url.URL) *url.URL {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil
+	}
+
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil
+	}
+
+	ret, err := reqURL.Parse(loc)
+	if err != nil {
+		return nil
+	}
+
+	switch ret.Scheme {
+	case "http", "https":
+	default:
+		return nil
+	}
+
+	if ret.Host == "" || ret.User != nil {
+		return nil
+	}
+
+	ret.Fragment = ""
+	ret.RawFragment = ""
+
+	return ret
+}
+
+func isRedirectHostAllowed(host string, allowedHosts []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || net.ParseIP(host) != nil {
+		// IP address targets are never followed unless explicitly listed.
+		for _, allowed := range allowedHosts {
+			if strings.EqualFold(allowed, host) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getRedirectRequest builds the request to the redirect target. The method
+// is changed to GET for 303 responses as well as for 301 and 302 responses
+// to POST requests. A nil request is returned if the body of a 307 and 308
+// request cannot be replayed.
+func getRedirectRequest(req *http.Request, statusCode int, target *url.URL) (*http.Request, error) {
+	ret := req.Clone(req.Context())
+	ret.URL = target
+
+	if target.Host != req.URL.Host {
+		ret.Host = target.Host
+		// Credentials are never forwarded to a different host.
+		ret.Header.Del("Authorization")
+		ret.Header.Del("Cookie")
+		ret.Header.Del("Proxy-Authorization")
+	}
+
+	switch {
+	case statusCode == http.StatusSeeOther && req.Method != http.MethodHead,
+		(statusCode == http.StatusMovedPermanently || statusCode == http.StatusFound) &&
+			req.Method == http.MethodPost:
+		ret.Method = http.MethodGet
+		ret.Body = nil
+		ret.GetBody = nil
+		ret.ContentLength = 0
+		ret.TransferEncoding = nil
+		for _, hdr := range []string{"Content-Type", "Content-Length", "Content-Encoding", "Transfer-Encoding"} {
+			ret.Header.Del(hdr)
+		}
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody == nil:
+		return nil, nil
+	default:
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		ret.Body = body
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+)
+
+const defaultRequestCompressionMinSize = 1024
+
+var defaultRequestCompressionContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/*+xml",
+	"application/javascript",
+	"application/x-www-form-urlencoded",
+	"application/graphql",
+}
+
+// compressRequestBody gzips the buffered body of the request sent to the
+// upstream if it is compressible and returns the body that the upstream
+// actually receives so that the signing features sign the compressed bytes.
+func compressRequestBody(outReq *http.Request, body []byte,
+	cfg *corev1.Service_Spec_Config_HTTP_RequestCompression) []byte {
+	if !isRequestBodyCompressible(outReq, body, cfg) {
+		return body
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return body
+	}
+	if err := zw.Close(); err != nil {
+		return body
+	}
+
+	if buf.Len() >= len(body) {
+		return body
+	}
+
+	ret := buf.Bytes()
+	httputils.SetRequestBody(outReq, ret)
+	outReq.Header.Set("Content-Encoding", "gzip")
+
+	return ret
+}
+
+func isRequestBodyCompressible(outReq *http.Request, body []byte,
+	cfg *corev1.Service_Spec_Config_HTTP_RequestCompression) bool {
+	if cfg == nil || !cfg.IsEnabled {
+		return false
+	}
+
+	minSize := defaultRequestCompressionMinSize
+	if cfg.MinSize > 0 {
+		minSize = int(cfg.MinSize)
+	}
+	if len(body) < minSize {
+		return false
+	}
+
+	if outReq.Header.Get("Content-Encoding") != "" || outReq.Header.Get("Upgrade") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(outReq.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	contentTypes := cfg.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultRequestCompressionContentTypes
+	}
+
+	for _, contentType := range contentTypes {
+		if matchMediaType(strings.ToLower(contentType), mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchMediaType matches a media type against a pattern that is either a
+// media type, a `type/*` wildcard or a `type/*+suffix` structured syntax
+// suffix wildcard.
+func matchMediaType(pattern, mediaType string) bool {
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok {
+		return false
+	}
+
+	patternType, patternSubtype, ok := strings.Cut(pattern, "/")
+	if !ok || patternType != typ {
+		return false
+	}
+
+	switch {
+	case patternSubtype == "*":
+		return true
+	case strings.HasPrefix(patternSubtype, "*+"):
+		return strings.HasSuffix(subtype, patternSubtype[1:])
+	default:
+		return patternSubtype == subtype
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/pkg/errors"
+)
+
+const defaultResolverCacheTTL = 30 * time.Second
+
+// upstreamResolver resolves the upstream hostnames according to the Service
+// Resolver config. Since a new transport, and hence a new resolver, is created
+// whenever the config changes, the cache is implicitly invalidated on changes.
+type upstreamResolver struct {
+	resolver      *net.Resolver
+	searchDomains []string
+	staticHosts   map[string][]string
+	ttl           time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*resolverEntry
+}
+
+type resolverEntry struct {
+	addrs     []string
+	expiresAt time.Time
+}
+
+func newUpstreamResolver(svcCfg *corev1.Service_Spec_Config) *upstreamResolver {
+	if svcCfg == nil || svcCfg.GetHttp() == nil || svcCfg.GetHttp().Resolver == nil {
+		return nil
+	}
+
+	cfg := svcCfg.GetHttp().Resolver
+
+	ret := &upstreamResolver{
+		resolver:    net.DefaultResolver,
+		staticHosts: make(map[string][]string),
+		ttl:         defaultResolverCacheTTL,
+		cache:       make(map[string]*resolverEntry),
+	}
+
+	if val := umetav1.ToDuration(cfg.CacheTTL).ToGo(); val > 0 {
+		ret.ttl = val
+	}
+
+	for _, domain := range cfg.SearchDomains {
+		if domain = strings.Trim(strings.TrimSpace(domain), "."); domain != "" {
+			ret.searchDomains = append(ret.searchDomains, domain)
+		}
+	}
+
+	for _, staticHost := range cfg.StaticHosts {
+		ret.staticHosts[normalizeHost(staticHost.Host)] = staticHost.Addresses
+	}
+
+	if len(cfg.Nameservers) > 0 {
+		nameservers := make([]string, 0, len(cfg.Nameservers))
+		for _, ns := range cfg.Nameservers {
+			if _, _, err := net.SplitHostPort(ns); err != nil {
+				ns = net.JoinHostPort(ns, "53")
+			}
+			nameservers = append(nameservers, ns)
+		}
+
+		ret.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				dialer := &net.Dialer{
+					Timeout: 5 * time.Second,
+				}
+
+				var err error
+				for _, ns := range nameservers {
+					var conn net.Conn
+					conn, err = dialer.DialContext(ctx, network, ns)
+					if err == nil {
+						return conn, nil
+					}
+				}
+				return nil, err
+			},
+		}
+	}
+
+	return ret
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func (r *upstreamResolver) lookup(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+
+	key := normalizeHost(host)
+
+	if addrs, ok := r.staticHosts[key]; ok {
+		return addrs, nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.addrs, nil
+	}
+
+	candidates := []string{key}
+	if !strings.HasSuffix(host, ".") {
+		for _, domain := range r.searchDomains {
+			candidates = append(candidates, key+"."+domain)
+		}
+	}
+
+	var err error
+	for _, candidate := range candidates {
+		var addrs []string
+		addrs, err = r.resolver.LookupHost(ctx, candidate+".")
+		if err == nil && len(addrs) > 0 {
+			r.mu.Lock()
+			r.cache[key] = &resolverEntry{
+				addrs:     addrs,
+				expiresAt: time.Now().Add(r.ttl),
+			}
+			r.mu.Unlock()
+			return addrs, nil
+		}
+	}
+
+	if err == nil {
+		err = errors.Errorf("No addresses found for host: %s", host)
+	}
+
+	return nil, err
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+)
+
+const defaultResponseBufferingMaxSize = 1 << 20
+
+// bufferResponse fully reads the response bodies that fit within the max size
+// so that they are relayed with a Content-Length even if the upstream closes
+// its connection right after writing them. The read errors are returned to be
+// handled by the ErrorHandler instead of relaying a truncated body. The larger
+// bodies are streamed as before, starting with the part already read.
+func bufferResponse(r *http.Response, cfg *corev1.Service_Spec_Config_HTTP_ResponseBuffering) error {
+	if cfg == nil || !cfg.IsEnabled || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	if r.Request != nil && r.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	switch {
+	case r.StatusCode < 200,
+		r.StatusCode == http.StatusNoContent,
+		r.StatusCode == http.StatusNotModified:
+		return nil
+	}
+
+	// The trailers cannot be sent along with a Content-Length.
+	if len(r.Trailer) > 0 || r.Header.Get("Trailer") != "" {
+		return nil
+	}
+
+	mediaType := httputils.GetMediaType(&http.Request{
+		Header:        r.Header,
+		ContentLength: r.ContentLength,
+	})
+	if mediaType == "text/event-stream" || strings.HasPrefix(mediaType, "application/grpc") {
+		return nil
+	}
+
+	maxSize := int64(defaultResponseBufferingMaxSize)
+	if cfg.MaxSize > 0 {
+		maxSize = int64(cfg.MaxSize)
+	}
+
+	if r.ContentLength > maxSize {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	if err != nil {
+		r.Body.Close()
+		return err
+	}
+
+	if int64(len(body)) > maxSize {
+		httputils.SetResponseBodyStream(r, &multiReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), r.Body),
+			Closer: r.Body,
+		})
+		return nil
+	}
+
+	r.Body.Close()
+	httputils.SetResponseBody(r, body)
+
+	return nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -17,10 +17,14 @@
 package httpg
 
 import (
+	"container/list"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"fmt"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/octelium/octelium/apis/main/corev1"
@@ -29,20 +33,33 @@ import (
 	"github.com/octelium/octelium/cluster/vigil/vigil/mtls"
 	"github.com/octelium/octelium/cluster/vigil/vigil/secretman"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/metric"
 	"golang.org/x/net/http/httpguts"
 	"golang.org/x/net/http2"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/protobuf/proto"
 )
 
 type roundTripper struct {
-	upstream  *loadbalancer.Upstream
-	secretMan *secretman.SecretManager
+	upstream           *loadbalancer.Upstream
+	secretMan          *secretman.SecretManager
+	transports         *transportCache
+	isolatedTransports *transportCache
+	detected           *upstreamProtocol
+	certExpiry         metric.Float64Gauge
 }
 
 func (s *Server) getRoundTripper(
-	upstream *loadbalancer.Upstream) (*roundTripper, error) {
+	upstream *loadbalancer.Upstream, detected *upstreamProtocol) (*roundTripper, error) {
 	return &roundTripper{
-		upstream:  upstream,
-		secretMan: s.secretMan,
+		upstream:           upstream,
+		secretMan:          s.secretMan,
+		transports:         s.transports,
+		isolatedTransports: s.isolatedTransports,
+		detected:           detected,
+		certExpiry:         s.metricsStore.upstreamCertExpiry,
 	}, nil
 }
 
@@ -53,7 +70,11 @@ func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
-	return rt.RoundTrip(req)
+	done := r.upstream.Track()
+	resp, err := rt.RoundTrip(req)
+	done(err)
+
+	return resp, err
 }
 
 func (r *roundTripper) getRoundTripper(req *http.Request) (http.RoundTripper, error) {
@@ -62,27 +83,420 @@ func (r *roundTripper) getRoundTripper(req *http.Request) (http.RoundTripper, er
 	svc := reqCtx.Service
 	svcCfg := reqCtx.ServiceConfig
 
-	tlsCfg, err := mtls.GetClientTLSCfg(ctx, svc, svcCfg, r.secretMan, r.upstream)
+	isHTTP2 := isHTTP2RequestUpstream(req, svc, r.detected)
+
+	// The per-identity transports are cached separately so that a large
+	// number of Users or Sessions cannot evict the shared transports.
+	transports := r.transports
+	key := r.getTransportKey(svc, svcCfg, isHTTP2)
+	if isolationKey := getConnectionIsolationKey(reqCtx, svc, svcCfg); isolationKey != "" {
+		key = fmt.Sprintf("%s|%s", key, isolationKey)
+		transports = r.isolatedTransports
+	}
+
+	return transports.get(key, func() (http.RoundTripper, error) {
+		tlsCfg, err := mtls.GetClientTLSCfg(ctx, svc, svcCfg, r.secretMan, r.upstream)
+		if err != nil {
+			return nil, err
+		}
+
+		if secretName := getRotatedClientCertificate(svc, svcCfg); secretName != "" {
+			rotator, rotatedCfg, err := newCertRotator(secretName, tlsCfg,
+				func(ctx context.Context) (*tls.Certificate, error) {
+					return mtls.GetClientCertificate(ctx, r.secretMan, secretName)
+				})
+			if err != nil {
+				return nil, err
+			}
+
+			rt, err := r.doGetRoundTripper(req, svc, svcCfg, rotatedCfg, isHTTP2)
+			if err != nil {
+				return nil, err
+			}
+
+			rotator.rt = rt
+			rotator.stopFn = r.secretMan.Subscribe(rotator.onSecretUpdate)
+
+			return &rotatingTransport{
+				RoundTripper: rt,
+				rotator:      rotator,
+			}, nil
+		}
+
+		return r.doGetRoundTripper(req, svc, svcCfg, tlsCfg, isHTTP2)
+	})
+}
+
+func (r *roundTripper) doGetRoundTripper(req *http.Request, svc *corev1.Service,
+	svcCfg *corev1.Service_Spec_Config, tlsCfg *tls.Config, isHTTP2 bool) (http.RoundTripper, error) {
+	if monitorCfg := getCertificateMonitoring(svc, svcCfg); monitorCfg != nil {
+		tlsCfg = withCertificateMonitoring(tlsCfg, r.upstream, monitorCfg, r.certExpiry)
+	}
+
+	if isHTTP2 {
+		return r.getRoundTripperHTTP2(req, svc, svcCfg, tlsCfg)
+	}
+
+	if ntlmCfg := getNTLM(svc, svcCfg); ntlmCfg != nil {
+		return newNTLMTransport(ntlmCfg, getNTLMPasswordFn(r.secretMan, ntlmCfg), func() (*http.Transport, error) {
+			return r.getRoundTripperHTTP1(req, svc, svcCfg, tlsCfg)
+		}), nil
+	}
+
+	return r.getRoundTripperHTTP1(req, svc, svcCfg, tlsCfg)
+}
+
+var transportKeyMarshalOpts = proto.MarshalOptions{
+	Deterministic: true,
+}
+
+// getTransportKey returns a key that only changes when a transport-relevant
+// field of the Service or of the Secrets it references changes so that
+// transports, and hence their pooled connections, are reused across config
+// reloads and the updates of the unrelated Secrets.
+func (r *roundTripper) getTransportKey(svc *corev1.Service,
+	svcCfg *corev1.Service_Spec_Config, isHTTP2 bool) string {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s|%s|%s|%t|%t|%s|",
+		r.upstream.URL.String(), r.upstream.HostPort, r.upstream.SNIHost, r.upstream.IsUser,
+		isHTTP2, svc.Spec.Mode.String())
+
+	if r.detected != nil {
+		fmt.Fprintf(h, "%t|%t|", r.detected.isTLS, r.detected.isHTTP2)
+	}
+
+	if svcCfg == nil {
+		svcCfg = svc.Spec.Config
+	}
+
+	for _, name := range getTransportSecretNames(svc, svcCfg) {
+		fmt.Fprintf(h, "%s=%d|", name, r.secretMan.SecretGeneration(name))
+	}
+
+	connectTimeout, tlsHandshakeTimeout := getConnectTimeouts(svcCfg)
+	fmt.Fprintf(h, "%d|%d|", connectTimeout, tlsHandshakeTimeout)
+
+	if svcCfg != nil {
+		for _, msg := range []proto.Message{
+			svcCfg.Tls,
+			svcCfg.ClientCertificate,
+			svcCfg.GetKubernetes(),
+			svcCfg.GetHttp().GetSocket(),
+			svcCfg.GetHttp().GetResolver(),
+			svcCfg.GetHttp().GetExpectContinue(),
+			svcCfg.GetHttp().GetCertificateMonitoring(),
+			svcCfg.GetHttp().GetAuth().GetNtlm(),
+		} {
+			if b, err := transportKeyMarshalOpts.Marshal(msg); err == nil {
+				h.Write(b)
+			}
+			h.Write([]byte("|"))
+		}
+	}
+
+	return string(h.Sum(nil))
+}
+
+// getTransportSecretNames returns the Secrets whose values are built into the
+// transport, i.e. its client certificate or kubeconfig. The rotated client
+// certificate is excluded since its transport swaps the certificate itself
+// and is kept across the Secret updates, and so is the NTLM password which is
+// looked up on every authentication.
+func getTransportSecretNames(svc *corev1.Service, svcCfg *corev1.Service_Spec_Config) []string {
+	var ret []string
+
+	if ucorev1.ToService(svc).IsKubernetes() {
+		k8sCfg := svcCfg.GetKubernetes()
+		if name := k8sCfg.GetClientCertificate().GetFromSecret(); name != "" {
+			ret = append(ret, name)
+		}
+		if name := k8sCfg.GetKubeconfig().GetFromSecret(); name != "" {
+			ret = append(ret, name)
+		}
+		return ret
+	}
+
+	if name := svcCfg.GetClientCertificate().GetFromSecret(); name != "" {
+		ret = append(ret, name)
+	}
+
+	if getRotatedClientCertificate(svc, svcCfg) == "" {
+		if name := svcCfg.GetTls().GetClientCertificate().GetFromSecret(); name != "" {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret
+}
+
+// getConnectionIsolationKey returns the identity to which the transport, and
+// hence its pooled connections, is dedicated. The requests without a User,
+// such as those of anonymous Services, share the same transport.
+func getConnectionIsolationKey(reqCtx *middlewares.RequestContext,
+	svc *corev1.Service, svcCfg *corev1.Service_Spec_Config) string {
+	if svcCfg == nil {
+		svcCfg = svc.Spec.Config
+	}
+
+	var uid string
+	switch svcCfg.GetHttp().GetConnectionIsolation().GetMode() {
+	case corev1.Service_Spec_Config_HTTP_ConnectionIsolation_USER:
+		uid = reqCtx.DownstreamInfo.GetUser().GetMetadata().GetUid()
+	case corev1.Service_Spec_Config_HTTP_ConnectionIsolation_SESSION:
+		uid = reqCtx.DownstreamInfo.GetSession().GetMetadata().GetUid()
+	default:
+		return ""
+	}
+
+	if uid == "" {
+		return "anonymous"
+	}
+
+	return uid
+}
+
+func getNTLM(svc *corev1.Service, svcCfg *corev1.Service_Spec_Config) *corev1.Service_Spec_Config_HTTP_Auth_NTLM {
+	if svcCfg == nil {
+		svcCfg = svc.Spec.Config
+	}
+
+	return svcCfg.GetHttp().GetAuth().GetNtlm()
+}
+
+const (
+	transportIdleTimeout   = 5 * time.Minute
+	transportPruneInterval = time.Minute
+	maxTransports          = 256
+	maxIsolatedTransports  = 1024
+)
+
+var errTransportCacheClosed = errors.New("transport cache is closed")
+
+// transportCache is a bounded LRU cache of the upstream transports. The
+// evicted transports are closed.
+type transportCache struct {
+	mu         sync.Mutex
+	size       int
+	ll         *list.List
+	transports map[string]*list.Element
+	isClosed   bool
+
+	group     singleflight.Group
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type transportEntry struct {
+	key      string
+	rt       http.RoundTripper
+	lastUsed time.Time
+}
+
+func newTransportCache(size int) *transportCache {
+	ret := &transportCache{
+		size:       size,
+		ll:         list.New(),
+		transports: make(map[string]*list.Element),
+		done:       make(chan struct{}),
+	}
+
+	go ret.runPrune()
+
+	return ret
+}
+
+// get returns the cached transport of the key or builds it otherwise. Since
+// building a transport can involve Secret lookups and upstream protocol
+// detection, it is done outside of the lock so that it does not block the
+// requests of the other keys, while the concurrent misses of the same key
+// share a single build.
+func (c *transportCache) get(key string, fn func() (http.RoundTripper, error)) (http.RoundTripper, error) {
+	if rt, ok := c.lookup(key); ok {
+		return rt, nil
+	}
+
+	ret, err, _ := c.group.Do(key, func() (any, error) {
+		if rt, ok := c.lookup(key); ok {
+			return rt, nil
+		}
+
+		rt, err := fn()
+		if err != nil {
+			return nil, err
+		}
+
+		if !c.set(key, rt) {
+			closeTransport(rt)
+			return nil, errTransportCacheClosed
+		}
+
+		return rt, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if isHTTP2RequestUpstream(req, svc) {
-		return r.getRoundTripperHTTP2(req, svc, tlsCfg)
+	return ret.(http.RoundTripper), nil
+}
+
+// set caches the transport and evicts the least recently used ones beyond
+// the size. It returns false if the cache is already closed, in which case
+// the transport is not cached.
+func (c *transportCache) set(key string, rt http.RoundTripper) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isClosed {
+		return false
+	}
+
+	c.transports[key] = c.ll.PushFront(&transportEntry{
+		key:      key,
+		rt:       rt,
+		lastUsed: time.Now(),
+	})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
 	}
 
-	return r.getRoundTripperHTTP1(req, svc, tlsCfg)
+	return true
 }
 
-func isHTTP2RequestUpstream(req *http.Request, svc *corev1.Service) bool {
+func (c *transportCache) lookup(key string) (http.RoundTripper, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.transports[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+
+	entry := elem.Value.(*transportEntry)
+	entry.lastUsed = time.Now()
+
+	return entry.rt, true
+}
+
+// remove must be called with the lock held. Only the idle connections of the
+// transport are closed so that in-flight requests are not interrupted.
+func (c *transportCache) remove(elem *list.Element) {
+	entry := elem.Value.(*transportEntry)
+	c.ll.Remove(elem)
+	delete(c.transports, entry.key)
+	closeTransport(entry.rt)
+}
+
+func (c *transportCache) runPrune() {
+	ticker := time.NewTicker(transportPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			c.prune(now)
+		}
+	}
+}
+
+// prune removes the transports that have not been used for a while, which is
+// typically the case after a transport-relevant config change.
+func (c *transportCache) prune(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.ll.Back(); elem != nil; elem = c.ll.Back() {
+		if now.Sub(elem.Value.(*transportEntry).lastUsed) < transportIdleTimeout {
+			return
+		}
+
+		c.remove(elem)
+	}
+}
+
+func (c *transportCache) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.isClosed = true
+	for elem := c.ll.Back(); elem != nil; elem = c.ll.Back() {
+		c.remove(elem)
+	}
+}
+
+func closeTransport(rt http.RoundTripper) {
+	if stopper, ok := rt.(interface{ stop() }); ok {
+		stopper.stop()
+	}
+	closeIdleConnections(rt)
+}
+
+func closeIdleConnections(rt http.RoundTripper) {
+	if closer, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func isHTTP2RequestUpstream(req *http.Request, svc *corev1.Service, detected *upstreamProtocol) bool {
 	if httpguts.HeaderValuesContainsToken(req.Header["Connection"], "Upgrade") {
 		return false
 	}
+	if detected != nil && detected.isHTTP2 {
+		return true
+	}
 	return ucorev1.ToService(svc).IsUpstreamHTTP2()
 }
 
-func (r *roundTripper) getRoundTripperHTTP2(req *http.Request, svc *corev1.Service, tlsCfg *tls.Config) (http.RoundTripper, error) {
-	ret, err := r.getRoundTripperHTTP1(req, svc, tlsCfg)
+const (
+	defaultConnectTimeout      = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// getConnectTimeouts returns the timeouts of establishing the connection to
+// the upstream, which are separate from the timeout of the request itself.
+func getConnectTimeouts(svcCfg *corev1.Service_Spec_Config) (time.Duration, time.Duration) {
+	connectTimeout := defaultConnectTimeout
+	tlsHandshakeTimeout := defaultTLSHandshakeTimeout
+
+	if svcCfg == nil || svcCfg.GetHttp() == nil || svcCfg.GetHttp().Timeout == nil {
+		return connectTimeout, tlsHandshakeTimeout
+	}
+
+	timeoutCfg := svcCfg.GetHttp().Timeout
+	if val := umetav1.ToDuration(timeoutCfg.Connect).ToGo(); val > 0 {
+		connectTimeout = val
+	}
+	if val := umetav1.ToDuration(timeoutCfg.TlsHandshake).ToGo(); val > 0 {
+		tlsHandshakeTimeout = val
+	}
+
+	return connectTimeout, tlsHandshakeTimeout
+}
+
+const defaultExpectContinueTimeout = 1 * time.Second
+
+func getExpectContinueTimeout(svcCfg *corev1.Service_Spec_Config) time.Duration {
+	if svcCfg == nil || svcCfg.GetHttp() == nil || svcCfg.GetHttp().ExpectContinue == nil {
+		return defaultExpectContinueTimeout
+	}
+
+	if val := umetav1.ToDuration(svcCfg.GetHttp().ExpectContinue.Timeout).ToGo(); val > 0 {
+		return val
+	}
+
+	return defaultExpectContinueTimeout
+}
+
+func (r *roundTripper) getRoundTripperHTTP2(req *http.Request, svc *corev1.Service,
+	svcCfg *corev1.Service_Spec_Config, tlsCfg *tls.Config) (http.RoundTripper, error) {
+	ret, err := r.getRoundTripperHTTP1(req, svc, svcCfg, tlsCfg)
 	if err != nil {
 		return nil, err
 	}
@@ -92,16 +506,12 @@ func (r *roundTripper) getRoundTripperHTTP2(req *http.Request, svc *corev1.Servi
 	}
 
 	if ucorev1.ToService(svc).BackendScheme() == "h2c" || ucorev1.ToService(svc).IsGRPC() {
+		dialer := newUpstreamDialer(svcCfg)
 
 		return &http2.Transport{
 			TLSClientConfig: tlsCfg,
-			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-				dialer := &net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}
-
-				return dialer.Dial(network, addr)
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
 			},
 			AllowHTTP: true,
 		}, nil
@@ -110,26 +520,71 @@ func (r *roundTripper) getRoundTripperHTTP2(req *http.Request, svc *corev1.Servi
 	return ret, nil
 }
 
-func (r *roundTripper) getRoundTripperHTTP1(req *http.Request, svc *corev1.Service, tlsCfg *tls.Config) (*http.Transport, error) {
+func (r *roundTripper) getRoundTripperHTTP1(req *http.Request, svc *corev1.Service,
+	svcCfg *corev1.Service_Spec_Config, tlsCfg *tls.Config) (*http.Transport, error) {
+	_, tlsHandshakeTimeout := getConnectTimeouts(svcCfg)
+	dialer := newUpstreamDialer(svcCfg)
 
 	ret := &http.Transport{
 		TLSClientConfig: tlsCfg,
 		Proxy:           http.ProxyFromEnvironment,
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			dialer := &net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}
-
-			return dialer.DialContext(ctx, network, addr)
-		},
+		DialContext:     dialer.DialContext,
 
 		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ExpectContinueTimeout: getExpectContinueTimeout(svcCfg),
 		ReadBufferSize:        64 * 1024,
 		WriteBufferSize:       64 * 1024,
 	}
 
+	// The TLS config is read on every dial so that the ALPN protocols set by
+	// http2.ConfigureTransports are used.
+	ret.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialUpstreamTLS(ctx, dialer, network, addr, ret.TLSClientConfig, tlsHandshakeTimeout)
+	}
+
 	return ret, nil
 }
+
+// tlsHandshakeTimeoutError is returned once the TLS handshake with the
+// upstream does not complete within the TLS handshake timeout.
+type tlsHandshakeTimeoutError struct{}
+
+func (tlsHandshakeTimeoutError) Error() string   { return "TLS handshake timeout" }
+func (tlsHandshakeTimeoutError) Timeout() bool   { return true }
+func (tlsHandshakeTimeoutError) Temporary() bool { return true }
+
+// dialUpstreamTLS dials the upstream and completes the TLS handshake within
+// the timeout. Unlike the built-in handshake of http.Transport, it returns a
+// typed error once the handshake times out so that it is reported as a
+// connect error.
+func dialUpstreamTLS(ctx context.Context, dialer *upstreamDialer, network, addr string,
+	tlsCfg *tls.Config, timeout time.Duration) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	} else {
+		tlsCfg = tlsCfg.Clone()
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+
+	handshakeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tlsConn := tls.Client(conn, tlsCfg)
+	if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		conn.Close()
+		if ctx.Err() == nil && errors.Is(handshakeCtx.Err(), context.DeadlineExceeded) {
+			return nil, tlsHandshakeTimeoutError{}
+		}
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
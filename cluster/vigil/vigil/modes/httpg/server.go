@@ -22,18 +22,24 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"sync"
+	"sync/atomic"
 
 	"context"
+	"errors"
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/apis/rsc/rmetav1"
 	"github.com/octelium/octelium/cluster/common/celengine"
 	"github.com/octelium/octelium/cluster/common/ocrypto"
 	"github.com/octelium/octelium/cluster/common/octeliumc"
+	"github.com/octelium/octelium/cluster/common/otelutils"
 	"github.com/octelium/octelium/cluster/common/vutils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/bytequota"
+	"github.com/octelium/octelium/cluster/vigil/vigil/capture"
 	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
 	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes"
@@ -41,25 +47,48 @@ import (
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/accesslog"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/auth"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/cache"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/clientlimit"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/compress"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/debugcapture"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/direct"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/extproc"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/fairqueue"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/faultinjection"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/forwardproxy"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/framing"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/grpclimit"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/handshakelimit"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/headerrouting"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/headers"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/http10"
 	jsonschema "github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/jsonchema"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/keepalive"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/lua"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/methodoverride"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/metrics"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/options"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/path"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/pathnormalize"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/paths"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/preauth"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/quota"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/ratelimit"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/requestfilter"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/retry"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/slowread"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/split"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/timeout"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/urilimit"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/validation"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/wskeepalive"
 	"github.com/octelium/octelium/cluster/vigil/vigil/octovigilc"
 	"github.com/octelium/octelium/cluster/vigil/vigil/secretman"
 	"github.com/octelium/octelium/cluster/vigil/vigil/vcache"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
 	"github.com/octelium/octelium/pkg/grpcerr"
 	"github.com/octelium/octelium/pkg/utils/utilrand"
+	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
@@ -84,23 +113,42 @@ type Server struct {
 	lbManager *loadbalancer.LBManager
 	secretMan *secretman.SecretManager
 
+	captureStore   *capture.Store
+	byteQuotaStore bytequota.Store
+	cacheDiskStore *cache.DiskStore
+
 	crtMan struct {
 		mu  sync.RWMutex
 		crt *corev1.Secret
 	}
+	ticketKeys struct {
+		mu sync.Mutex
+		m  *ticketKeyManager
+	}
 	metricsStore *metricsStore
 
 	celEngine *celengine.CELEngine
 
 	reverseProxyErrLogger *log.Logger
 	domain                string
+	defaultFlush          *corev1.Service_Spec_Config_HTTP_Flush
 	forwardedObfuscatedID string
 
 	svcUID string
+
+	transports          *transportCache
+	isolatedTransports  *transportCache
+	protoDetector       *protocolDetector
+	keepAlive           *keepalive.Tracker
+	lastResourceVersion atomic.Pointer[string]
+	configValidation    atomic.Pointer[configValidation]
 }
 
 type metricsStore struct {
 	*metricutils.CommonMetrics
+	fanOutResults      metric.Int64Counter
+	upstreamRedirects  metric.Int64Counter
+	upstreamCertExpiry metric.Float64Gauge
 }
 
 func (s *Server) svc() *corev1.Service {
@@ -117,18 +165,24 @@ func (s *Server) SetClusterCertificate(crt *corev1.Secret) error {
 
 func New(ctx context.Context, opts *modes.Opts) (*Server, error) {
 	server := &Server{
-		doneComplete: make(chan struct{}),
-		vCache:       opts.VCache,
-		octovigilC:   opts.OctovigilC,
-		octeliumC:    opts.OcteliumC,
-		lbManager:    opts.LBManager,
-		secretMan:    opts.SecretMan,
-		metricsStore: &metricsStore{},
+		doneComplete:   make(chan struct{}),
+		vCache:         opts.VCache,
+		octovigilC:     opts.OctovigilC,
+		octeliumC:      opts.OcteliumC,
+		lbManager:      opts.LBManager,
+		secretMan:      opts.SecretMan,
+		captureStore:   opts.CaptureStore,
+		byteQuotaStore: opts.ByteQuotaStore,
+		metricsStore:   &metricsStore{},
 		reverseProxyErrLogger: log.New(&zapWriter{
 			log: zap.L(),
 		}, "", 0),
 		forwardedObfuscatedID: fmt.Sprintf("_octelium-%s", utilrand.GetRandomStringLowercase(6)),
 		svcUID:                opts.VCache.GetService().Metadata.Uid,
+		transports:            newTransportCache(maxTransports),
+		isolatedTransports:    newTransportCache(maxIsolatedTransports),
+		protoDetector:         newProtocolDetector(),
+		cacheDiskStore:        cache.NewDiskStore(os.Getenv("OCTELIUM_CACHE_DISK_DIR")),
 	}
 
 	var err error
@@ -137,6 +191,28 @@ func New(ctx context.Context, opts *modes.Opts) (*Server, error) {
 		return nil, err
 	}
 
+	server.metricsStore.fanOutResults, err = otelutils.GetMeter().Int64Counter(
+		metricutils.GetKey("http.fanout.results"),
+		metric.WithDescription("Total number of fan-out requests per region and result"))
+	if err != nil {
+		return nil, err
+	}
+
+	server.metricsStore.upstreamRedirects, err = otelutils.GetMeter().Int64Counter(
+		metricutils.GetKey("http.upstream.redirects"),
+		metric.WithDescription("Total number of upstream redirects per result"))
+	if err != nil {
+		return nil, err
+	}
+
+	server.metricsStore.upstreamCertExpiry, err = otelutils.GetMeter().Float64Gauge(
+		metricutils.GetKey("http.upstream.tls.certificate.expiry"),
+		metric.WithDescription("Remaining validity in days of the upstream TLS certificate per host"),
+		metric.WithUnit("d"))
+	if err != nil {
+		return nil, err
+	}
+
 	server.celEngine, err = celengine.New(ctx, &celengine.Opts{})
 	if err != nil {
 		return nil, err
@@ -147,7 +223,12 @@ func New(ctx context.Context, opts *modes.Opts) (*Server, error) {
 		return nil, err
 	}
 
+	server.keepAlive = keepalive.NewTracker(func() *corev1.Service_Spec_Config_HTTP_ClientKeepAlive {
+		return server.svc().Spec.Config.GetHttp().GetClientKeepAlive()
+	})
+
 	server.domain = cc.Status.Domain
+	server.defaultFlush = cc.Spec.GetHttp().GetFlush()
 
 	return server, nil
 }
@@ -168,6 +249,10 @@ func (s *Server) Close() error {
 	defer cancel()
 
 	s.srv.Shutdown(ctx)
+	s.keepAlive.Close()
+	s.transports.close()
+	s.isolatedTransports.close()
+	s.cacheDiskStore.Close()
 
 	close(s.doneComplete)
 
@@ -176,10 +261,45 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// Drain shuts the HTTP server down without closing the Server. Hijacked
+// connections such as WebSocket connections are not waited for.
+func (s *Server) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.srv
+	isClosed := s.isClosed
+	s.mu.Unlock()
+
+	if isClosed || srv == nil {
+		return nil
+	}
+
+	zap.L().Info("Draining HTTP server connections")
+
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) Connections() (int, int) {
+	return s.keepAlive.Connections()
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	if s.serveDebugEcho(w, r) {
+		return
+	}
+
 	proxy, err := s.getProxy(ctx)
 	if err != nil {
+		if errors.Is(err, loadbalancer.ErrNoUpstream) {
+			s.writeNoUpstreamResponse(w, r)
+			return
+		}
+
 		zap.L().Warn("Could not getProxy", zap.Error(err))
 		w.WriteHeader(http.StatusBadGateway)
 		return
@@ -200,16 +320,10 @@ func (s *Server) getTLSConfig(ctx context.Context, svc *corev1.Service) (*tls.Co
 	s.crtMan.crt = crt
 	s.crtMan.mu.Unlock()
 
-	return &tls.Config{
+	ret := &tls.Config{
 		MinVersion: tls.VersionTLS12,
 		MaxVersion: tls.VersionTLS13,
-		NextProtos: func() []string {
-			if ucorev1.ToService(svc).IsListenerHTTP2() {
-				return []string{"h2", "http/1.1"}
-			} else {
-				return []string{"http/1.1"}
-			}
-		}(),
+		NextProtos: getListenerNextProtos(svc),
 
 		CipherSuites: []uint16{
 			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
@@ -226,7 +340,13 @@ func (s *Server) getTLSConfig(ctx context.Context, svc *corev1.Service) (*tls.Co
 
 			return ocrypto.GetTLSCertificate(s.crtMan.crt)
 		},
-	}, nil
+	}
+
+	if err := s.setSessionResumption(ctx, svc, ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
 }
 
 func (s *Server) Run(ctx context.Context) error {
@@ -236,26 +356,70 @@ func (s *Server) Run(ctx context.Context) error {
 
 	svc := s.svc()
 
+	// Validating the config right away reports its errors without waiting
+	// for the first request.
+	s.getConfigError(svc)
+
 	addr := fmt.Sprintf(":%d", ucorev1.ToService(s.svc()).RealPort())
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.lis = lis
 	if svc.Spec.IsTLS {
-		tlsCfg, err := s.getTLSConfig(ctx, svc)
+		// The excess connections are closed before they are counted by the
+		// per client limits and before their TLS handshakes.
+		s.lis, err = handshakelimit.NewListener(s.lis, s.getHandshakeLimit)
 		if err != nil {
+			lis.Close()
 			return err
 		}
-		s.lis, err = tls.Listen("tcp", addr, tlsCfg)
+	}
+
+	s.lis, err = clientlimit.NewListener(s.lis, s.getMaxConnectionsPerClient)
+	if err != nil {
+		lis.Close()
+		return err
+	}
+
+	allowAmbiguousFraming := func() bool {
+		return s.svc().Spec.Config.GetHttp().GetFraming().GetAllowAmbiguous()
+	}
+
+	ctx, cancelFn := context.WithCancel(ctx)
+	s.cancelFn = cancelFn
+
+	s.lis, err = slowread.NewListener(s.lis)
+	if err != nil {
+		lis.Close()
+		return err
+	}
+
+	// The framing conns are the ones served by the net/http server so that
+	// their inspection stops once hijacked.
+	if !svc.Spec.IsTLS {
+		s.lis, err = framing.NewListener(s.lis, allowAmbiguousFraming)
 		if err != nil {
+			lis.Close()
 			return err
 		}
 	} else {
-		s.lis, err = net.Listen("tcp", addr)
+		tlsCfg, err := s.getTLSConfig(ctx, svc)
+		if err != nil {
+			lis.Close()
+			return err
+		}
+		// The TLS connections are inspected once decrypted.
+		s.lis, err = framing.NewTLSListener(s.lis, tlsCfg, func() time.Duration {
+			return getReadHeaderTimeout(s.svc())
+		}, allowAmbiguousFraming)
 		if err != nil {
+			lis.Close()
 			return err
 		}
 	}
 
-	ctx, cancelFn := context.WithCancel(ctx)
-	s.cancelFn = cancelFn
-
 	if err := s.serve(ctx); err != nil {
 		return err
 	}
@@ -265,87 +429,374 @@ func (s *Server) Run(ctx context.Context) error {
 	return nil
 }
 
-func (s *Server) getHTTPHandler(ctx context.Context, svc *corev1.Service) (http.Handler, error) {
-	chain := middlewares.New()
-
-	appendPlugins := func(phase corev1.Service_Spec_Config_HTTP_Plugin_Phase) {
-
-		chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-			return path.New(ctx, next, s.celEngine, phase)
-		})
-
-		chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-			return ratelimit.New(ctx, next, s.celEngine, s.octeliumC, phase)
-		})
-
-		chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-			return jsonschema.New(ctx, next, s.celEngine, phase)
-		})
+// getMaxConnectionsPerClient returns the maximum number of simultaneous
+// connections per client IP address of the Service's main config. Public
+// Services are excluded since their connections originate from the Ingress.
+func (s *Server) getMaxConnectionsPerClient() uint32 {
+	svc := s.svc()
+	if svc.Spec.IsPublic {
+		return 0
+	}
 
-		chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-			return direct.New(ctx, next, s.celEngine, phase)
-		})
+	return svc.Spec.Config.GetHttp().GetClientLimit().GetMaxConnections()
+}
 
-		chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-			return cache.New(ctx, next, s.celEngine, s.octeliumC, s.svcUID, phase)
-		})
+// getHandshakeLimit returns the maximum rate of new TLS handshakes per
+// second and its burst of the Service's main config.
+func (s *Server) getHandshakeLimit() (uint32, uint32) {
+	limit := s.svc().Spec.Config.GetHttp().GetHandshakeLimit()
+	return limit.GetMaxRate(), limit.GetBurst()
+}
 
-		chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-			return lua.New(ctx, next, s.celEngine, phase)
-		})
+const defaultReadHeaderTimeout = 10 * time.Second
 
-		chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-			return extproc.New(ctx, next, s.celEngine, phase)
-		})
+// getReadHeaderTimeout returns the header read timeout of the Service's main
+// config which is set once on the HTTP server.
+func getReadHeaderTimeout(svc *corev1.Service) time.Duration {
+	if val := umetav1.ToDuration(svc.Spec.Config.GetHttp().GetReadTimeout().GetHeader()).ToGo(); val > 0 {
+		return val
 	}
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return metrics.New(ctx, next, s.metricsStore.CommonMetrics)
-	})
+	return defaultReadHeaderTimeout
+}
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return preauth.New(ctx, next, s.octeliumC, s.domain)
-	})
+const (
+	priorityMetrics         = 100
+	priorityKeepAlive       = 150
+	prioritySlowRead        = 160
+	priorityHTTP10          = 175
+	priorityMethodOverride  = 200
+	priorityClientLimit     = 250
+	priorityURILimit        = 255
+	priorityRequestFilter   = 260
+	priorityPathNormalize   = 275
+	priorityPreAuth         = 300
+	priorityCompress        = 400
+	priorityAccessLog       = 500
+	priorityDebugCapture    = 550
+	priorityPluginsPreAuth  = 600
+	priorityAuth            = 700
+	priorityQuota           = 725
+	priorityFairQueue       = 750
+	priorityValidation      = 800
+	priorityOptions         = 825
+	priorityForwardProxy    = 850
+	prioritySplit           = 900
+	priorityHeaderRouting   = 950
+	priorityBodyCheck       = 975
+	priorityPluginsPostAuth = 1000
+	priorityHeaders         = 1100
+	priorityPaths           = 1200
+	priorityFaultInjection  = 1250
+	priorityTimeout         = 1300
+	priorityRetry           = 1400
+	priorityGRPCLimit       = 1500
+	priorityWSKeepalive     = 1600
+)
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return compress.New(ctx, next)
-	})
+// getMiddlewareRegistry registers the middlewares of the HTTP chain. The chain
+// is ordered according to the middleware priorities regardless of the
+// registration order.
+func (s *Server) getMiddlewareRegistry(ctx context.Context) (*middlewares.Registry, error) {
+	ret := middlewares.NewRegistry()
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return accesslog.New(ctx, next)
-	})
+	getPlugins := func(phase corev1.Service_Spec_Config_HTTP_Plugin_Phase, priority int) []*middlewares.Registration {
+		phaseName := "preAuth"
+		if phase == corev1.Service_Spec_Config_HTTP_Plugin_POST_AUTH {
+			phaseName = "postAuth"
+		}
 
-	appendPlugins(corev1.Service_Spec_Config_HTTP_Plugin_PRE_AUTH)
+		plugins := []*middlewares.Registration{
+			{
+				Name: "path",
+				New: func(next http.Handler) (http.Handler, error) {
+					return path.New(ctx, next, s.celEngine, phase)
+				},
+			},
+			{
+				Name: "ratelimit",
+				New: func(next http.Handler) (http.Handler, error) {
+					return ratelimit.New(ctx, next, s.celEngine, s.octeliumC, phase)
+				},
+			},
+			{
+				Name: "jsonschema",
+				New: func(next http.Handler) (http.Handler, error) {
+					return jsonschema.New(ctx, next, s.celEngine, phase)
+				},
+			},
+			{
+				Name: "direct",
+				New: func(next http.Handler) (http.Handler, error) {
+					return direct.New(ctx, next, s.celEngine, phase)
+				},
+			},
+			{
+				Name: "cache",
+				New: func(next http.Handler) (http.Handler, error) {
+					return cache.New(ctx, next, s.celEngine, s.octeliumC, s.svcUID, s.cacheDiskStore, phase)
+				},
+			},
+			{
+				Name: "lua",
+				New: func(next http.Handler) (http.Handler, error) {
+					return lua.New(ctx, next, s.celEngine, phase)
+				},
+			},
+			{
+				Name: "extproc",
+				New: func(next http.Handler) (http.Handler, error) {
+					return extproc.New(ctx, next, s.celEngine, phase)
+				},
+			},
+		}
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return auth.New(ctx, next, s.octeliumC, s.octovigilC, s.domain)
-	})
+		for i, plugin := range plugins {
+			plugin.Name = fmt.Sprintf("plugin.%s.%s", phaseName, plugin.Name)
+			plugin.Priority = priority + i
+		}
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return validation.New(ctx, next)
-	})
+		return plugins
+	}
+
+	if err := ret.Register(
+		&middlewares.Registration{
+			Name:     "metrics",
+			Priority: priorityMetrics,
+			New: func(next http.Handler) (http.Handler, error) {
+				return metrics.New(ctx, next, s.metricsStore.CommonMetrics)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "keepAlive",
+			Priority: priorityKeepAlive,
+			New: func(next http.Handler) (http.Handler, error) {
+				return keepalive.New(ctx, next, s.keepAlive)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "slowRead",
+			Priority: prioritySlowRead,
+			New: func(next http.Handler) (http.Handler, error) {
+				return slowread.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "http10",
+			Priority: priorityHTTP10,
+			New: func(next http.Handler) (http.Handler, error) {
+				return http10.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "methodOverride",
+			Priority: priorityMethodOverride,
+			New: func(next http.Handler) (http.Handler, error) {
+				return methodoverride.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "clientLimit",
+			Priority: priorityClientLimit,
+			New: func(next http.Handler) (http.Handler, error) {
+				return clientlimit.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "uriLimit",
+			Priority: priorityURILimit,
+			New: func(next http.Handler) (http.Handler, error) {
+				return urilimit.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "requestFilter",
+			Priority: priorityRequestFilter,
+			New: func(next http.Handler) (http.Handler, error) {
+				return requestfilter.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "pathNormalization",
+			Priority: priorityPathNormalize,
+			New: func(next http.Handler) (http.Handler, error) {
+				return pathnormalize.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "preAuth",
+			Priority: priorityPreAuth,
+			New: func(next http.Handler) (http.Handler, error) {
+				return preauth.New(ctx, next, s.octeliumC, s.domain)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "compress",
+			Priority: priorityCompress,
+			New: func(next http.Handler) (http.Handler, error) {
+				return compress.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "accessLog",
+			Priority: priorityAccessLog,
+			New: func(next http.Handler) (http.Handler, error) {
+				return accesslog.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "debugCapture",
+			Priority: priorityDebugCapture,
+			New: func(next http.Handler) (http.Handler, error) {
+				return debugcapture.New(ctx, next, s.captureStore)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "auth",
+			Priority: priorityAuth,
+			New: func(next http.Handler) (http.Handler, error) {
+				return auth.New(ctx, next, s.octeliumC, s.octovigilC, s.domain)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "quota",
+			Priority: priorityQuota,
+			New: func(next http.Handler) (http.Handler, error) {
+				return quota.New(ctx, next, s.byteQuotaStore)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "fairQueue",
+			Priority: priorityFairQueue,
+			New: func(next http.Handler) (http.Handler, error) {
+				return fairqueue.New(ctx, next, s.celEngine)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "validation",
+			Priority: priorityValidation,
+			New: func(next http.Handler) (http.Handler, error) {
+				return validation.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "options",
+			Priority: priorityOptions,
+			New: func(next http.Handler) (http.Handler, error) {
+				return options.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "forwardProxy",
+			Priority: priorityForwardProxy,
+			New: func(next http.Handler) (http.Handler, error) {
+				return forwardproxy.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "split",
+			Priority: prioritySplit,
+			New: func(next http.Handler) (http.Handler, error) {
+				return split.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "headerRouting",
+			Priority: priorityHeaderRouting,
+			New: func(next http.Handler) (http.Handler, error) {
+				return headerrouting.New(ctx, next, s.celEngine)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "bodyCheck",
+			Priority: priorityBodyCheck,
+			New: func(next http.Handler) (http.Handler, error) {
+				return preauth.NewBodyCheck(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "headers",
+			Priority: priorityHeaders,
+			New: func(next http.Handler) (http.Handler, error) {
+				return headers.New(ctx, next, s.celEngine, s.secretMan)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "paths",
+			Priority: priorityPaths,
+			New: func(next http.Handler) (http.Handler, error) {
+				return paths.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "faultInjection",
+			Priority: priorityFaultInjection,
+			New: func(next http.Handler) (http.Handler, error) {
+				return faultinjection.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "timeout",
+			Priority: priorityTimeout,
+			New: func(next http.Handler) (http.Handler, error) {
+				return timeout.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "retry",
+			Priority: priorityRetry,
+			New: func(next http.Handler) (http.Handler, error) {
+				return retry.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "grpcLimit",
+			Priority: priorityGRPCLimit,
+			New: func(next http.Handler) (http.Handler, error) {
+				return grpclimit.New(ctx, next)
+			},
+		},
+		&middlewares.Registration{
+			Name:     "webSocketKeepalive",
+			Priority: priorityWSKeepalive,
+			New: func(next http.Handler) (http.Handler, error) {
+				return wskeepalive.New(ctx, next)
+			},
+		},
+	); err != nil {
+		return nil, err
+	}
 
-	appendPlugins(corev1.Service_Spec_Config_HTTP_Plugin_POST_AUTH)
+	if err := ret.Register(getPlugins(corev1.Service_Spec_Config_HTTP_Plugin_PRE_AUTH, priorityPluginsPreAuth)...); err != nil {
+		return nil, err
+	}
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return headers.New(ctx, next, s.celEngine, s.secretMan)
-	})
+	if err := ret.Register(getPlugins(corev1.Service_Spec_Config_HTTP_Plugin_POST_AUTH, priorityPluginsPostAuth)...); err != nil {
+		return nil, err
+	}
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return paths.New(ctx, next)
-	})
+	return ret, nil
+}
 
-	chain = chain.Append(func(next http.Handler) (http.Handler, error) {
-		return retry.New(ctx, next)
-	})
+func (s *Server) getHTTPHandler(ctx context.Context, svc *corev1.Service) (http.Handler, error) {
+	registry, err := s.getMiddlewareRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	handler, err := chain.Then(s)
+	handler, err := registry.Then(s)
 	if err != nil {
 		return nil, err
 	}
 
+	handler = s.withRequestContext(handler)
+
+	handler = s.withGeneralOptions(handler)
+
 	handler = http.AllowQuerySemicolons(handler)
 
+	handler = withListenerALPN(svc, handler)
+
 	if ucorev1.ToService(svc).IsListenerHTTP2() {
 		zap.L().Debug("Using HTTP2 on listener")
 		handler = h2c.NewHandler(handler, &http2.Server{})
@@ -354,6 +805,71 @@ func (s *Server) getHTTPHandler(ctx context.Context, svc *corev1.Service) (http.
 	return handler, nil
 }
 
+// withRequestContext sets a fresh RequestContext for every request with a
+// snapshot of the current Service. Service updates are hence picked up by the
+// following requests, even on existing connections, while in-flight requests
+// keep using the config they started with until they finish.
+func (s *Server) withRequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		svc := s.vCache.GetService()
+		s.checkConfigReload(svc)
+		s.getConfigError(svc)
+
+		conn := middlewares.GetCtxRequestContext(ctx).Conn
+		reqCtx := &middlewares.RequestContext{
+			ID:            vutils.GenerateLogID(),
+			CreatedAt:     time.Now(),
+			Service:       svc,
+			Conn:          conn,
+			ServiceConfig: svc.Spec.Config,
+			ClientCtx:     ctx,
+		}
+
+		req = req.WithContext(context.WithValue(ctx, middlewares.CtxRequestContext, reqCtx))
+		if req.TLS == nil {
+			// The conns inspected by the framing TLS listener are not
+			// *tls.Conn, hence their TLS state is set here instead.
+			req.TLS = framing.GetConnectionState(conn)
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// withGeneralOptions answers the "OPTIONS *" requests the same way the
+// net/http server does by default unless the Service's Options config
+// answers them itself.
+func (s *Server) withGeneralOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if options.IsAsterisk(req) &&
+			!s.vCache.GetService().Spec.Config.GetHttp().GetOptions().GetIsEnabled() {
+			w.Header().Set("Content-Length", "0")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (s *Server) checkConfigReload(svc *corev1.Service) {
+	resourceVersion := svc.Metadata.ResourceVersion
+	last := s.lastResourceVersion.Load()
+	if last != nil && *last == resourceVersion {
+		return
+	}
+
+	if !s.lastResourceVersion.CompareAndSwap(last, &resourceVersion) || last == nil {
+		return
+	}
+
+	zap.L().Info("Service config reloaded",
+		zap.String("oldResourceVersion", *last),
+		zap.String("newResourceVersion", resourceVersion))
+	s.metricsStore.AtConfigReload()
+}
+
 func (s *Server) serve(ctx context.Context) error {
 	zap.L().Debug("Starting serving connections")
 
@@ -367,7 +883,13 @@ func (s *Server) serve(ctx context.Context) error {
 	s.srv = &http.Server{
 		Addr:              fmt.Sprintf(":%d", ucorev1.ToService(svc).RealPort()),
 		Handler:           handler,
-		ReadHeaderTimeout: 10 * time.Second,
+		ReadHeaderTimeout: getReadHeaderTimeout(svc),
+		ConnState: func(c net.Conn, state http.ConnState) {
+			s.keepAlive.ConnState(c, state)
+			framing.ConnState(c, state)
+		},
+
+		DisableGeneralOptionsHandler: true,
 		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
 			svc := s.vCache.GetService()
 
@@ -17,32 +17,56 @@
 package httpg
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"context"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/gorilla/websocket"
+	"github.com/miekg/dns"
+	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/apis/main/metav1"
 	"github.com/octelium/octelium/apis/rsc/rmetav1"
 	"github.com/octelium/octelium/cluster/apiserver/apiserver/admin"
 	"github.com/octelium/octelium/cluster/apiserver/apiserver/user"
+	"github.com/octelium/octelium/cluster/common/celengine"
 	"github.com/octelium/octelium/cluster/common/tests"
 	"github.com/octelium/octelium/cluster/common/tests/tstuser"
 	"github.com/octelium/octelium/cluster/common/vutils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
+	"github.com/octelium/octelium/cluster/vigil/vigil/metricutils"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares"
 	"github.com/octelium/octelium/cluster/vigil/vigil/octovigilc"
 	"github.com/octelium/octelium/cluster/vigil/vigil/secretman"
 	"github.com/octelium/octelium/cluster/vigil/vigil/vcache"
@@ -55,12 +79,17 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/http2/hpack"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type tstSrvHTTP struct {
@@ -3291,3 +3320,5318 @@ func TestIsDisabled(t *testing.T) {
 		assert.Equal(t, http.StatusOK, resp.StatusCode())
 	}
 }
+
+func TestWriteErrorResponse(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		rw := httptest.NewRecorder()
+		writeErrorResponse(rw, httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil),
+			nil, http.StatusBadGateway)
+		assert.Equal(t, http.StatusBadGateway, rw.Code)
+		assert.Equal(t, http.StatusText(http.StatusBadGateway), rw.Body.String())
+		assert.Equal(t, "octelium", rw.Header().Get("Server"))
+	}
+
+	{
+		reqID := vutils.GenerateLogID()
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				ID: reqID,
+			}))
+
+		rw := httptest.NewRecorder()
+		writeErrorResponse(rw, req,
+			&corev1.Service_Spec_Config_HTTP{
+				ErrorResponse: &corev1.Service_Spec_Config_HTTP_ErrorResponse{
+					Format: corev1.Service_Spec_Config_HTTP_ErrorResponse_PROBLEM_JSON,
+				},
+			}, http.StatusGatewayTimeout)
+		assert.Equal(t, http.StatusGatewayTimeout, rw.Code)
+		assert.Equal(t, "application/problem+json", rw.Header().Get("Content-Type"))
+
+		res := &middlewares.ProblemDetails{}
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), res))
+		assert.Equal(t, http.StatusGatewayTimeout, res.Status)
+		assert.Equal(t, http.StatusText(http.StatusGatewayTimeout), res.Title)
+		assert.Equal(t, "/v1", res.Instance)
+		assert.Equal(t, reqID, res.RequestID)
+		assert.Equal(t, reqID, rw.Header().Get("X-Request-Id"))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		writeErrorResponse(rw, httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil),
+			&corev1.Service_Spec_Config_HTTP{
+				ErrorResponse: &corev1.Service_Spec_Config_HTTP_ErrorResponse{
+					Format: corev1.Service_Spec_Config_HTTP_ErrorResponse_PROBLEM_JSON,
+				},
+			}, http.StatusGatewayTimeout)
+
+		res := &middlewares.ProblemDetails{}
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), res))
+		assert.Equal(t, "", res.RequestID)
+		assert.Equal(t, "", rw.Header().Get("X-Request-Id"))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		writeErrorResponse(rw, httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil),
+			&corev1.Service_Spec_Config_HTTP{
+				ErrorResponse: &corev1.Service_Spec_Config_HTTP_ErrorResponse{
+					Format: corev1.Service_Spec_Config_HTTP_ErrorResponse_HTML,
+				},
+			}, http.StatusBadGateway)
+		assert.Equal(t, http.StatusBadGateway, rw.Code)
+		assert.True(t, strings.HasPrefix(rw.Header().Get("Content-Type"), "text/html"))
+		assert.True(t, strings.Contains(rw.Body.String(), "502 Bad Gateway"))
+	}
+}
+
+func TestWriteNoUpstreamResponse(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	svc := &corev1.Service{
+		Metadata: &metav1.Metadata{
+			Name: "svc1.default",
+		},
+		Spec: &corev1.Service_Spec{},
+		Status: &corev1.Service_Status{
+			NamespaceRef: &metav1.ObjectReference{
+				Name: "default",
+			},
+			RegionRef: &metav1.ObjectReference{
+				Name: "default",
+			},
+		},
+	}
+
+	srv := &Server{
+		metricsStore: &metricsStore{},
+	}
+	srv.metricsStore.CommonMetrics, err = metricutils.NewCommonMetrics(ctx, svc)
+	assert.Nil(t, err)
+
+	newReq := func(httpCfg *corev1.Service_Spec_Config_HTTP) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil)
+		return req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				CreatedAt: time.Now(),
+				Service:   svc,
+				ServiceConfig: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: httpCfg,
+					},
+				},
+			}))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		srv.writeNoUpstreamResponse(rw, newReq(nil))
+		assert.Equal(t, http.StatusBadGateway, rw.Code)
+		assert.Equal(t, "", rw.Header().Get("Retry-After"))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		srv.writeNoUpstreamResponse(rw, newReq(&corev1.Service_Spec_Config_HTTP{
+			UpstreamUnavailable: &corev1.Service_Spec_Config_HTTP_UpstreamUnavailable{},
+		}))
+		assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+		assert.Equal(t, "5", rw.Header().Get("Retry-After"))
+	}
+
+	{
+		rw := httptest.NewRecorder()
+		srv.writeNoUpstreamResponse(rw, newReq(&corev1.Service_Spec_Config_HTTP{
+			UpstreamUnavailable: &corev1.Service_Spec_Config_HTTP_UpstreamUnavailable{
+				StatusCode: http.StatusTooManyRequests,
+				RetryAfter: &metav1.Duration{
+					Type: &metav1.Duration_Milliseconds{
+						Milliseconds: 1500,
+					},
+				},
+			},
+			ErrorResponse: &corev1.Service_Spec_Config_HTTP_ErrorResponse{
+				Format: corev1.Service_Spec_Config_HTTP_ErrorResponse_PROBLEM_JSON,
+			},
+		}))
+		assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+		assert.Equal(t, "2", rw.Header().Get("Retry-After"))
+		assert.Equal(t, "application/problem+json", rw.Header().Get("Content-Type"))
+	}
+}
+
+func TestTransportCache(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	c := newTransportCache(2)
+
+	calls := 0
+	fn := func() (http.RoundTripper, error) {
+		calls++
+		return &http.Transport{}, nil
+	}
+
+	rt1, err := c.get("key1", fn)
+	assert.Nil(t, err)
+	rt2, err := c.get("key1", fn)
+	assert.Nil(t, err)
+	assert.True(t, rt1 == rt2)
+	assert.Equal(t, 1, calls)
+
+	rt3, err := c.get("key2", fn)
+	assert.Nil(t, err)
+	assert.False(t, rt1 == rt3)
+	assert.Equal(t, 2, calls)
+
+	c.transports["key1"].Value.(*transportEntry).lastUsed = time.Now().Add(-2 * transportIdleTimeout)
+	c.ll.MoveToBack(c.transports["key1"])
+	c.prune(time.Now())
+	assert.Equal(t, 1, len(c.transports))
+	_, ok := c.transports["key2"]
+	assert.True(t, ok)
+
+	_, err = c.get("key3", func() (http.RoundTripper, error) {
+		return nil, errors.Errorf("err")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(c.transports))
+
+	// The least recently used transport is evicted beyond the size.
+	_, err = c.get("key1", fn)
+	assert.Nil(t, err)
+	_, err = c.get("key2", fn)
+	assert.Nil(t, err)
+	_, err = c.get("key4", fn)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(c.transports))
+	assert.Equal(t, c.ll.Len(), len(c.transports))
+	_, ok = c.transports["key1"]
+	assert.False(t, ok)
+	_, ok = c.transports["key2"]
+	assert.True(t, ok)
+
+	c.close()
+	assert.Equal(t, 0, len(c.transports))
+	assert.Equal(t, 0, c.ll.Len())
+
+	// A transport built after the cache is closed is closed too.
+	stopped := false
+	_, err = c.get("key5", func() (http.RoundTripper, error) {
+		return &tstStoppableTransport{
+			stopFn: func() {
+				stopped = true
+			},
+		}, nil
+	})
+	assert.True(t, errors.Is(err, errTransportCacheClosed))
+	assert.True(t, stopped)
+	assert.Equal(t, 0, len(c.transports))
+}
+
+type tstStoppableTransport struct {
+	http.Transport
+	stopFn func()
+}
+
+func (t *tstStoppableTransport) stop() {
+	t.stopFn()
+}
+
+func TestGetTransportSecretNames(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getTLSCfg := func(isRotated bool) *corev1.Service_Spec_Config_TLS {
+		return &corev1.Service_Spec_Config_TLS{
+			ClientCertificate: &corev1.Service_Spec_Config_TLS_ClientCertificate{
+				Type: &corev1.Service_Spec_Config_TLS_ClientCertificate_FromSecret{
+					FromSecret: "crt",
+				},
+				Rotation: &corev1.Service_Spec_Config_TLS_ClientCertificate_Rotation{
+					IsEnabled: isRotated,
+				},
+			},
+		}
+	}
+
+	tstCases := []struct {
+		mode   corev1.Service_Spec_Mode
+		cfg    *corev1.Service_Spec_Config
+		output []string
+	}{
+		{
+			mode: corev1.Service_Spec_HTTP,
+		},
+		{
+			mode: corev1.Service_Spec_HTTP,
+			cfg: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: &corev1.Service_Spec_Config_HTTP{
+						Auth: &corev1.Service_Spec_Config_HTTP_Auth{
+							Type: &corev1.Service_Spec_Config_HTTP_Auth_Bearer_{
+								Bearer: &corev1.Service_Spec_Config_HTTP_Auth_Bearer{
+									Type: &corev1.Service_Spec_Config_HTTP_Auth_Bearer_FromSecret{
+										FromSecret: "bearer",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			mode: corev1.Service_Spec_HTTP,
+			cfg: &corev1.Service_Spec_Config{
+				Tls: getTLSCfg(false),
+			},
+			output: []string{"crt"},
+		},
+		{
+			mode: corev1.Service_Spec_HTTP,
+			cfg: &corev1.Service_Spec_Config{
+				Tls: getTLSCfg(true),
+			},
+		},
+		{
+			mode: corev1.Service_Spec_KUBERNETES,
+			cfg: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Kubernetes_{
+					Kubernetes: &corev1.Service_Spec_Config_Kubernetes{
+						Type: &corev1.Service_Spec_Config_Kubernetes_Kubeconfig_{
+							Kubeconfig: &corev1.Service_Spec_Config_Kubernetes_Kubeconfig{
+								Type: &corev1.Service_Spec_Config_Kubernetes_Kubeconfig_FromSecret{
+									FromSecret: "kubeconfig",
+								},
+							},
+						},
+					},
+				},
+			},
+			output: []string{"kubeconfig"},
+		},
+	}
+
+	for _, tstCase := range tstCases {
+		svc := &corev1.Service{
+			Spec: &corev1.Service_Spec{
+				Mode: tstCase.mode,
+			},
+		}
+		assert.Equal(t, tstCase.output, getTransportSecretNames(svc, tstCase.cfg))
+	}
+}
+
+func TestTransportCacheConcurrent(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	c := newTransportCache(maxTransports)
+	t.Cleanup(c.close)
+
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowFn := func() (http.RoundTripper, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return &http.Transport{}, nil
+	}
+
+	var wg sync.WaitGroup
+	rts := make([]http.RoundTripper, 10)
+	for i := range rts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rt, err := c.get("slow", slowFn)
+			assert.Nil(t, err)
+			rts[i] = rt
+		}(i)
+	}
+
+	<-started
+
+	// A slow build does not block the other keys.
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		_, err := c.get("fast", func() (http.RoundTripper, error) {
+			return &http.Transport{}, nil
+		})
+		assert.Nil(t, err)
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The transport build of another key blocked the cache")
+	}
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, rt := range rts {
+		assert.True(t, rt == rts[0])
+	}
+	assert.Equal(t, 2, len(c.transports))
+}
+
+func TestDetectProtocol(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	ctx := context.Background()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	insecureTLSCfg := func() (*tls.Config, error) {
+		return &tls.Config{
+			InsecureSkipVerify: true,
+		}, nil
+	}
+
+	{
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+
+		res, err := detectProtocol(ctx, srv.Listener.Addr().String(), insecureTLSCfg)
+		assert.Nil(t, err)
+		assert.False(t, res.isTLS)
+		assert.False(t, res.isHTTP2)
+		assert.Equal(t, "http", res.scheme())
+	}
+
+	{
+		srv := httptest.NewUnstartedServer(handler)
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		defer srv.Close()
+
+		res, err := detectProtocol(ctx, srv.Listener.Addr().String(), insecureTLSCfg)
+		assert.Nil(t, err)
+		assert.True(t, res.isTLS)
+		assert.True(t, res.isHTTP2)
+		assert.Equal(t, "https", res.scheme())
+
+		res, err = detectProtocol(ctx, srv.Listener.Addr().String(), func() (*tls.Config, error) {
+			return nil, nil
+		})
+		assert.Nil(t, err)
+		assert.True(t, res.isTLS)
+		assert.False(t, res.isHTTP2)
+	}
+
+	{
+		srv := httptest.NewTLSServer(handler)
+		defer srv.Close()
+
+		res, err := detectProtocol(ctx, srv.Listener.Addr().String(), insecureTLSCfg)
+		assert.Nil(t, err)
+		assert.True(t, res.isTLS)
+		assert.False(t, res.isHTTP2)
+	}
+
+	{
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		addr := lis.Addr().String()
+		lis.Close()
+
+		_, err = detectProtocol(ctx, addr, insecureTLSCfg)
+		assert.NotNil(t, err)
+	}
+
+	// serveRaw answers every connection with the bytes and closes it.
+	serveRaw := func(resp []byte) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		t.Cleanup(func() {
+			lis.Close()
+		})
+
+		go func() {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					conn.Read(make([]byte, 1024))
+					conn.Write(resp)
+				}()
+			}
+		}()
+
+		return lis.Addr().String()
+	}
+
+	{
+		// An h2c upstream answering with its SETTINGS frame.
+		res, err := detectProtocol(ctx, serveRaw([]byte{0, 0, 0, 0x4, 0, 0, 0, 0, 0}), insecureTLSCfg)
+		assert.Nil(t, err)
+		assert.False(t, res.isTLS)
+		assert.True(t, res.isHTTP2)
+	}
+
+	{
+		// Closing the connection or answering with garbage is not a clear
+		// plaintext signal.
+		_, err := detectProtocol(ctx, serveRaw(nil), insecureTLSCfg)
+		assert.NotNil(t, err)
+
+		_, err = detectProtocol(ctx, serveRaw([]byte("garbage-response")), insecureTLSCfg)
+		assert.NotNil(t, err)
+	}
+
+	assert.True(t, isAmbiguousScheme("tcp"))
+	assert.True(t, isAmbiguousScheme(""))
+	assert.False(t, isAmbiguousScheme("https"))
+	assert.False(t, isAmbiguousScheme("h2c"))
+}
+
+func TestProtocolDetector(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	srvURL, _ := url.Parse(srv.URL)
+
+	d := newProtocolDetector()
+	cfg := &corev1.Service_Spec_Config_HTTP_ProtocolDetection{}
+	upstream := &loadbalancer.Upstream{
+		URL: srvURL,
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	slowTLSCfg := func() (*tls.Config, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return nil, nil
+	}
+
+	resCh := make(chan *upstreamProtocol)
+	go func() {
+		resCh <- d.get(context.Background(), upstream, cfg, slowTLSCfg)
+	}()
+	<-started
+
+	// A request waits for the ongoing detection up to its own deadline and
+	// the detection does not block the other upstreams.
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		assert.Nil(t, d.get(ctx, upstream, cfg, slowTLSCfg))
+		cancel()
+
+		otherURL, _ := url.Parse("tcp://127.0.0.1:1")
+		doneCh := make(chan struct{})
+		go func() {
+			defer close(doneCh)
+			d.get(context.Background(), &loadbalancer.Upstream{
+				URL: otherURL,
+			}, cfg, slowTLSCfg)
+		}()
+
+		select {
+		case <-doneCh:
+		case <-time.After(5 * time.Second):
+			t.Fatal("The detection of another upstream blocked the detector")
+		}
+	}
+
+	close(release)
+	res := <-resCh
+	assert.NotNil(t, res)
+	assert.False(t, res.isTLS)
+
+	// The waiting requests shared the single detection and the result is
+	// cached.
+	assert.Equal(t, res, d.get(context.Background(), upstream, cfg, slowTLSCfg))
+	assert.Equal(t, int32(1), calls.Load())
+
+	// An expired result is still used while it is being detected again.
+	d.mu.Lock()
+	d.entries[srvURL.Host].expiresAt = time.Now().Add(-time.Second)
+	d.mu.Unlock()
+	assert.Equal(t, res, d.get(context.Background(), upstream, cfg, slowTLSCfg))
+}
+
+func TestMiddlewareRegistry(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	srv := &Server{}
+	registry, err := srv.getMiddlewareRegistry(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"metrics",
+		"keepAlive",
+		"slowRead",
+		"http10",
+		"methodOverride",
+		"clientLimit",
+		"uriLimit",
+		"requestFilter",
+		"pathNormalization",
+		"preAuth",
+		"compress",
+		"accessLog",
+		"debugCapture",
+		"plugin.preAuth.path",
+		"plugin.preAuth.ratelimit",
+		"plugin.preAuth.jsonschema",
+		"plugin.preAuth.direct",
+		"plugin.preAuth.cache",
+		"plugin.preAuth.lua",
+		"plugin.preAuth.extproc",
+		"auth",
+		"quota",
+		"fairQueue",
+		"validation",
+		"options",
+		"forwardProxy",
+		"split",
+		"headerRouting",
+		"bodyCheck",
+		"plugin.postAuth.path",
+		"plugin.postAuth.ratelimit",
+		"plugin.postAuth.jsonschema",
+		"plugin.postAuth.direct",
+		"plugin.postAuth.cache",
+		"plugin.postAuth.lua",
+		"plugin.postAuth.extproc",
+		"headers",
+		"paths",
+		"faultInjection",
+		"timeout",
+		"retry",
+		"grpcLimit",
+		"webSocketKeepalive",
+	}, registry.Names())
+}
+
+func TestConnectTimeout(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	{
+		connectTimeout, tlsHandshakeTimeout := getConnectTimeouts(nil)
+		assert.Equal(t, defaultConnectTimeout, connectTimeout)
+		assert.Equal(t, defaultTLSHandshakeTimeout, tlsHandshakeTimeout)
+	}
+
+	svcCfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				Timeout: &corev1.Service_Spec_Config_HTTP_Timeout{
+					Connect: &metav1.Duration{
+						Type: &metav1.Duration_Milliseconds{
+							Milliseconds: 200,
+						},
+					},
+					TlsHandshake: &metav1.Duration{
+						Type: &metav1.Duration_Seconds{
+							Seconds: 1,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	{
+		connectTimeout, tlsHandshakeTimeout := getConnectTimeouts(svcCfg)
+		assert.Equal(t, 200*time.Millisecond, connectTimeout)
+		assert.Equal(t, time.Second, tlsHandshakeTimeout)
+	}
+
+	r := &roundTripper{}
+	rt, err := r.getRoundTripperHTTP1(nil, &corev1.Service{}, svcCfg, nil)
+	assert.Nil(t, err)
+	defer rt.CloseIdleConnections()
+
+	{
+		// A blackholed upstream that accepts TCP connections but never
+		// answers the TLS handshake
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer lis.Close()
+
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					<-done
+					conn.Close()
+				}()
+			}
+		}()
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s", lis.Addr().String()), nil)
+		assert.Nil(t, err)
+
+		startedAt := time.Now()
+		_, err = rt.RoundTrip(req)
+		assert.NotNil(t, err)
+		assert.True(t, errors.As(err, &tlsHandshakeTimeoutError{}), "%+v", err)
+		assert.True(t, isConnectError(err), "%+v", err)
+		assert.True(t, time.Since(startedAt) < 5*time.Second)
+
+		// A request canceled during the handshake is not a handshake timeout.
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = rt.RoundTrip(req.WithContext(ctx))
+		assert.NotNil(t, err)
+		assert.False(t, isConnectError(err), "%+v", err)
+	}
+
+	{
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		addr := lis.Addr().String()
+		lis.Close()
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s", addr), nil)
+		assert.Nil(t, err)
+
+		_, err = rt.RoundTrip(req)
+		assert.NotNil(t, err)
+		assert.True(t, isConnectError(err))
+	}
+
+	assert.False(t, isConnectError(io.EOF))
+	assert.False(t, isConnectError(context.Canceled))
+	assert.False(t, isConnectError(errors.New("TLS handshake timeout")))
+}
+
+func TestUpstreamDialer(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	ctx := context.Background()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		lis.Close()
+	})
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	getSockOpt := func(conn net.Conn, level, opt int) int {
+		rawConn, err := conn.(*net.TCPConn).SyscallConn()
+		assert.Nil(t, err)
+		var ret int
+		var sockErr error
+		err = rawConn.Control(func(fd uintptr) {
+			ret, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, sockErr)
+		return ret
+	}
+
+	{
+		dialer := newUpstreamDialer(nil)
+		assert.Equal(t, defaultKeepAliveIdle, dialer.dialer.KeepAlive)
+		assert.Nil(t, dialer.dialer.Control)
+
+		conn, err := dialer.DialContext(ctx, "tcp", lis.Addr().String())
+		assert.Nil(t, err)
+		assert.NotEqual(t, 0, getSockOpt(conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+		assert.Equal(t, 0, getSockOpt(conn, syscall.SOL_SOCKET, syscall.SO_REUSEADDR))
+		conn.Close()
+	}
+
+	{
+		dialer := newUpstreamDialer(&corev1.Service_Spec_Config{
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					Socket: &corev1.Service_Spec_Config_HTTP_Socket{
+						DisableNoDelay:    true,
+						ReuseAddr:         true,
+						SendBufferSize:    32 * 1024,
+						ReceiveBufferSize: 32 * 1024,
+						Keepalive: &corev1.Service_Spec_Config_HTTP_Socket_Keepalive{
+							Idle: &metav1.Duration{
+								Type: &metav1.Duration_Seconds{
+									Seconds: 5,
+								},
+							},
+							Count: 3,
+						},
+					},
+				},
+			},
+		})
+
+		conn, err := dialer.DialContext(ctx, "tcp", lis.Addr().String())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, getSockOpt(conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+		assert.NotEqual(t, 0, getSockOpt(conn, syscall.SOL_SOCKET, syscall.SO_REUSEADDR))
+		assert.NotEqual(t, 0, getSockOpt(conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE))
+		assert.Equal(t, 5, getSockOpt(conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE))
+		assert.Equal(t, 3, getSockOpt(conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT))
+		assert.True(t, getSockOpt(conn, syscall.SOL_SOCKET, syscall.SO_SNDBUF) >= 32*1024)
+		assert.True(t, getSockOpt(conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF) >= 32*1024)
+		conn.Close()
+	}
+
+	{
+		dialer := newUpstreamDialer(&corev1.Service_Spec_Config{
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					Socket: &corev1.Service_Spec_Config_HTTP_Socket{
+						Keepalive: &corev1.Service_Spec_Config_HTTP_Socket_Keepalive{
+							IsDisabled: true,
+						},
+					},
+				},
+			},
+		})
+
+		conn, err := dialer.DialContext(ctx, "tcp", lis.Addr().String())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, getSockOpt(conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE))
+		conn.Close()
+	}
+}
+
+func TestUpstreamResolver(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	ctx := context.Background()
+
+	assert.Nil(t, newUpstreamResolver(nil))
+
+	var queries atomic.Int32
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	dnsSrv := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			queries.Add(1)
+			m := &dns.Msg{}
+			m.SetReply(r)
+			for _, q := range r.Question {
+				if q.Name == "upstream.svc.local." && q.Qtype == dns.TypeA {
+					rr, _ := dns.NewRR("upstream.svc.local. 60 IN A 127.0.0.1")
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+			if len(m.Answer) == 0 {
+				m.Rcode = dns.RcodeNameError
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go dnsSrv.ActivateAndServe()
+	t.Cleanup(func() {
+		dnsSrv.Shutdown()
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		lis.Close()
+	})
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+
+	svcCfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				Resolver: &corev1.Service_Spec_Config_HTTP_Resolver{
+					Nameservers:   []string{pc.LocalAddr().String()},
+					SearchDomains: []string{"svc.local"},
+					StaticHosts: []*corev1.Service_Spec_Config_HTTP_Resolver_StaticHost{
+						{
+							Host:      "Pinned.Example.com",
+							Addresses: []string{"127.0.0.1"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	dialer := newUpstreamDialer(svcCfg)
+
+	{
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("pinned.example.com", port))
+		assert.Nil(t, err)
+		conn.Close()
+		assert.Equal(t, int32(0), queries.Load())
+	}
+
+	{
+		addrs, err := dialer.resolver.lookup(ctx, "upstream")
+		assert.Nil(t, err, "%+v", err)
+		assert.Equal(t, []string{"127.0.0.1"}, addrs)
+
+		n := queries.Load()
+		assert.True(t, n > 0)
+
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("upstream", port))
+		assert.Nil(t, err)
+		conn.Close()
+		assert.Equal(t, n, queries.Load())
+	}
+
+	{
+		_, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("unknown.example.org", port))
+		assert.NotNil(t, err)
+	}
+
+	{
+		assert.Nil(t, dialer.resolver.cache["pinned.example.com"])
+		newDialer := newUpstreamDialer(svcCfg)
+		assert.Equal(t, 0, len(newDialer.resolver.cache))
+	}
+}
+
+func TestExpectContinue(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	assert.Equal(t, defaultExpectContinueTimeout, getExpectContinueTimeout(nil))
+
+	var upstreamExpect string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamExpect = r.Header.Get("Expect")
+		if r.URL.Path == "/reject" {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	newProxy := func(svcCfg *corev1.Service_Spec_Config) *httptest.Server {
+		r := &roundTripper{}
+		rt, err := r.getRoundTripperHTTP1(nil, &corev1.Service{}, svcCfg, nil)
+		assert.Nil(t, err)
+
+		upstreamURL, _ := url.Parse(upstream.URL)
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(upstreamURL)
+			},
+			Transport: rt,
+		}
+
+		ret := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if svcCfg.GetHttp().GetExpectContinue().GetMode() ==
+				corev1.Service_Spec_Config_HTTP_ExpectContinue_LOCAL && httputils.IsExpectContinue(req) {
+				body, _ := io.ReadAll(req.Body)
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				req.Header.Del("Expect")
+			}
+			proxy.ServeHTTP(w, req)
+		}))
+		t.Cleanup(ret.Close)
+		return ret
+	}
+
+	doRequest := func(srv *httptest.Server, path string) (*http.Response, bool) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		assert.Nil(t, err)
+		t.Cleanup(func() {
+			conn.Close()
+		})
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		fmt.Fprintf(conn, "POST %s HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n", path)
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		assert.Nil(t, err)
+		if resp.StatusCode != http.StatusContinue {
+			return resp, false
+		}
+
+		conn.Write([]byte("hello"))
+		resp, err = http.ReadResponse(br, nil)
+		assert.Nil(t, err)
+		return resp, true
+	}
+
+	svcCfg := &corev1.Service_Spec_Config{
+		Type: &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				ExpectContinue: &corev1.Service_Spec_Config_HTTP_ExpectContinue{
+					Timeout: &metav1.Duration{
+						Type: &metav1.Duration_Seconds{
+							Seconds: 4,
+						},
+					},
+				},
+			},
+		},
+	}
+	assert.Equal(t, 4*time.Second, getExpectContinueTimeout(svcCfg))
+
+	{
+		srv := newProxy(svcCfg)
+
+		resp, gotContinue := doRequest(srv, "/")
+		assert.True(t, gotContinue)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "hello", string(body))
+		assert.Equal(t, "100-continue", upstreamExpect)
+
+		resp, gotContinue = doRequest(srv, "/reject")
+		assert.False(t, gotContinue)
+		assert.Equal(t, http.StatusExpectationFailed, resp.StatusCode)
+	}
+
+	{
+		svcCfg.GetHttp().ExpectContinue.Mode = corev1.Service_Spec_Config_HTTP_ExpectContinue_LOCAL
+		srv := newProxy(svcCfg)
+
+		resp, gotContinue := doRequest(srv, "/")
+		assert.True(t, gotContinue)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "hello", string(body))
+		assert.Equal(t, "", upstreamExpect)
+
+		resp, gotContinue = doRequest(srv, "/reject")
+		assert.True(t, gotContinue)
+		assert.Equal(t, http.StatusExpectationFailed, resp.StatusCode)
+	}
+}
+
+func TestRewriteSetCookies(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	newHeader := func() http.Header {
+		hdr := http.Header{}
+		hdr.Add("Set-Cookie", "session=abc; Domain=internal.local; Path=/app; SameSite=None")
+		hdr.Add("Set-Cookie", "theme=dark; Path=/; HttpOnly; Secure")
+		hdr.Add("Set-Cookie", "invalid")
+		return hdr
+	}
+
+	{
+		hdr := newHeader()
+		rewriteSetCookies(hdr, nil)
+		assert.Equal(t, newHeader(), hdr)
+	}
+
+	{
+		hdr := newHeader()
+		rewriteSetCookies(hdr, &corev1.Service_Spec_Config_HTTP_Cookie{
+			Rewrites: []*corev1.Service_Spec_Config_HTTP_Cookie_Rewrite{
+				{
+					Name:     "session",
+					Rename:   "app_session",
+					Domain:   "example.com",
+					Path:     "/",
+					Secure:   corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_SET,
+					HttpOnly: corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_SET,
+					SameSite: corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_LAX,
+				},
+			},
+		})
+
+		vals := hdr.Values("Set-Cookie")
+		assert.Equal(t, 3, len(vals))
+		assert.Equal(t, "app_session=abc; Path=/; Domain=example.com; HttpOnly; Secure; SameSite=Lax", vals[0])
+		assert.Equal(t, "theme=dark; Path=/; HttpOnly; Secure", vals[1])
+		assert.Equal(t, "invalid", vals[2])
+	}
+
+	{
+		hdr := newHeader()
+		rewriteSetCookies(hdr, &corev1.Service_Spec_Config_HTTP_Cookie{
+			Rewrites: []*corev1.Service_Spec_Config_HTTP_Cookie_Rewrite{
+				{
+					Name:         "theme",
+					Secure:       corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_CLEAR,
+					HttpOnly:     corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_CLEAR,
+					RemoveDomain: true,
+				},
+				{
+					RemoveDomain: true,
+					SameSite:     corev1.Service_Spec_Config_HTTP_Cookie_Rewrite_REMOVE,
+				},
+			},
+		})
+
+		vals := hdr.Values("Set-Cookie")
+		assert.Equal(t, 3, len(vals))
+		assert.Equal(t, "session=abc; Path=/app", vals[0])
+		assert.Equal(t, "theme=dark; Path=/", vals[1])
+	}
+}
+
+func TestStreamTransform(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	cfg := &corev1.Service_Spec_Config_HTTP_StreamTransform{
+		Rules: []*corev1.Service_Spec_Config_HTTP_StreamTransform_Rule{
+			{
+				ContentTypes: []string{"text/plain"},
+				Type: &corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_LineFilter_{
+					LineFilter: &corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_LineFilter{
+						Include: []string{"^(INFO|ERROR)"},
+						Exclude: []string{"secret"},
+					},
+				},
+			},
+			{
+				ContentTypes: []string{"application/x-ndjson"},
+				Type: &corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_NdjsonRedact{
+					NdjsonRedact: &corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_NDJSONRedact{
+						Fields: []string{"password"},
+					},
+				},
+			},
+		},
+	}
+
+	doTransform := func(contentType string, body string) (*http.Response, string) {
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(iotest.OneByteReader(strings.NewReader(body))),
+			ContentLength: int64(len(body)),
+		}
+		resp.Header.Set("Content-Type", contentType)
+		resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+
+		transformResponseStream(resp, cfg)
+		ret, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp, string(ret)
+	}
+
+	{
+		resp, body := doTransform("text/plain; charset=utf-8",
+			"INFO started\nDEBUG noisy\r\nERROR failed\r\nINFO secret token\nINFO last")
+		assert.Equal(t, "INFO started\nERROR failed\r\nINFO last", body)
+		assert.Equal(t, int64(-1), resp.ContentLength)
+		assert.Equal(t, "", resp.Header.Get("Content-Length"))
+	}
+
+	{
+		_, body := doTransform("application/x-ndjson",
+			"{\"user\":\"alice\",\"password\":\"pass\"}\n\nnot-json\n{\"user\":\"bob\"}\n")
+		assert.Equal(t, "{\"password\":\"[REDACTED]\",\"user\":\"alice\"}\n\n{\"user\":\"bob\"}\n", body)
+	}
+
+	{
+		resp, body := doTransform("application/json", "DEBUG kept\n")
+		assert.Equal(t, "DEBUG kept\n", body)
+		assert.Equal(t, int64(len(body)), resp.ContentLength)
+	}
+
+	{
+		rdr := newStreamTransformReader(io.NopCloser(strings.NewReader(
+			"DEBUG this line is too long\nDEBUG short\nINFO ok\n")),
+			getStreamTransformers(cfg, "text/plain"), 16)
+		ret, err := io.ReadAll(iotest.OneByteReader(rdr))
+		assert.Nil(t, err)
+		assert.Equal(t, "DEBUG this line is too long\nINFO ok\n", string(ret))
+	}
+
+	{
+		pr, pw := io.Pipe()
+		rdr := newStreamTransformReader(pr, getStreamTransformers(cfg, "text/plain"), 1024)
+
+		go func() {
+			pw.Write([]byte("INFO fir"))
+			pw.Write([]byte("st\nINFO sec"))
+		}()
+
+		buf := make([]byte, 64)
+		n, err := rdr.Read(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, "INFO first\n", string(buf[:n]))
+
+		go func() {
+			pw.Write([]byte("ond\n"))
+			pw.Close()
+		}()
+
+		ret, err := io.ReadAll(rdr)
+		assert.Nil(t, err)
+		assert.Equal(t, "INFO second\n", string(ret))
+	}
+}
+
+type fanOutTestRoundTripper func(req *http.Request) (*http.Response, error)
+
+func (f fanOutTestRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestFanOutRoundTripper(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	primary, err := loadbalancer.NewURLUpstream("http://api.local:8080")
+	assert.Nil(t, err)
+	region, err := loadbalancer.NewURLUpstream("https://api.eu.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 443, region.Port)
+
+	newResp := func(req *http.Request, code int, body string) *http.Response {
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}
+	}
+
+	newRoundTripper := func(primaryRT, regionRT fanOutTestRoundTripper) *fanOutRoundTripper {
+		return &fanOutRoundTripper{
+			primary: primary,
+			targets: []*fanOutTarget{
+				{region: "default", upstream: primary, rt: primaryRT},
+				{region: "eu", upstream: region, rt: regionRT},
+			},
+		}
+	}
+
+	newReq := func(method string) *http.Request {
+		req := httptest.NewRequest(method, "http://api.local:8080/v1/items", nil)
+		req.Host = "api.local:8080"
+		return req
+	}
+
+	{
+		canceledCh := make(chan struct{})
+		rt := newRoundTripper(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			close(canceledCh)
+			return nil, req.Context().Err()
+		}, func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "https", req.URL.Scheme)
+			assert.Equal(t, "api.eu.example.com", req.URL.Host)
+			assert.Equal(t, "api.eu.example.com", req.Host)
+			return newResp(req, http.StatusOK, "eu"), nil
+		})
+
+		resp, err := rt.RoundTrip(newReq(http.MethodGet))
+		assert.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "eu", string(body))
+
+		select {
+		case <-canceledCh:
+		case <-time.After(5 * time.Second):
+			t.Fatal("The losing request was not canceled")
+		}
+	}
+
+	{
+		rt := newRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return newResp(req, http.StatusServiceUnavailable, "primary"), nil
+		}, func(req *http.Request) (*http.Response, error) {
+			time.Sleep(50 * time.Millisecond)
+			return newResp(req, http.StatusOK, "eu"), nil
+		})
+
+		resp, err := rt.RoundTrip(newReq(http.MethodGet))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	{
+		rt := newRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return newResp(req, http.StatusBadGateway, "primary"), nil
+		}, func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("dial error")
+		})
+
+		resp, err := rt.RoundTrip(newReq(http.MethodGet))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	{
+		rt := newRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("dial error")
+		}, func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("dial error")
+		})
+
+		_, err := rt.RoundTrip(newReq(http.MethodGet))
+		assert.NotNil(t, err)
+	}
+
+	{
+		var regionCalls atomic.Int32
+		rt := newRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return newResp(req, http.StatusCreated, "primary"), nil
+		}, func(req *http.Request) (*http.Response, error) {
+			regionCalls.Add(1)
+			return newResp(req, http.StatusCreated, "eu"), nil
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "http://api.local:8080/v1/items", strings.NewReader("{}"))
+		resp, err := rt.RoundTrip(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, int32(0), regionCalls.Load())
+	}
+}
+
+func TestGetFlushInterval(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	interval := func(d uint32) *corev1.Service_Spec_Config_HTTP_Flush {
+		return &corev1.Service_Spec_Config_HTTP_Flush{
+			Type: &corev1.Service_Spec_Config_HTTP_Flush_Interval{
+				Interval: &metav1.Duration{
+					Type: &metav1.Duration_Milliseconds{
+						Milliseconds: d,
+					},
+				},
+			},
+		}
+	}
+	immediate := &corev1.Service_Spec_Config_HTTP_Flush{
+		Type: &corev1.Service_Spec_Config_HTTP_Flush_Immediate{
+			Immediate: true,
+		},
+	}
+	disabled := &corev1.Service_Spec_Config_HTTP_Flush{
+		Type: &corev1.Service_Spec_Config_HTTP_Flush_Disabled{
+			Disabled: true,
+		},
+	}
+
+	assert.Equal(t, 100*time.Millisecond, getFlushInterval())
+	assert.Equal(t, 100*time.Millisecond, getFlushInterval(nil, nil))
+	assert.Equal(t, 100*time.Millisecond, getFlushInterval(&corev1.Service_Spec_Config_HTTP_Flush{}, nil))
+
+	assert.Equal(t, 20*time.Millisecond, getFlushInterval(interval(20), nil))
+	assert.Equal(t, time.Duration(-1), getFlushInterval(immediate, nil))
+	assert.Equal(t, time.Duration(0), getFlushInterval(disabled, nil))
+
+	assert.Equal(t, time.Duration(-1), getFlushInterval(nil, immediate))
+	assert.Equal(t, 20*time.Millisecond, getFlushInterval(interval(20), immediate))
+	assert.Equal(t, time.Duration(0), getFlushInterval(interval(0), disabled))
+	assert.Equal(t, time.Duration(0), getFlushInterval(&corev1.Service_Spec_Config_HTTP_Flush{
+		Type: &corev1.Service_Spec_Config_HTTP_Flush_Immediate{},
+	}, disabled))
+}
+
+func TestCertificateMonitoring(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	upstream, err := loadbalancer.NewURLUpstream(srv.URL)
+	assert.Nil(t, err)
+
+	core, logs := observer.New(zap.InfoLevel)
+	undo := zap.ReplaceGlobals(zap.New(core))
+	t.Cleanup(undo)
+
+	doRequests := func(cfg *corev1.Service_Spec_Config_HTTP_CertificateMonitoring) int {
+		pool := x509.NewCertPool()
+		pool.AddCert(srv.Certificate())
+
+		verified := 0
+		tlsCfg := withCertificateMonitoring(&tls.Config{
+			RootCAs: pool,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				verified++
+				return nil
+			},
+		}, upstream, cfg, nil)
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsCfg,
+			},
+		}
+		defer client.CloseIdleConnections()
+
+		for range 3 {
+			resp, err := client.Get(srv.URL)
+			assert.Nil(t, err)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		return verified
+	}
+
+	{
+		assert.Equal(t, 1, doRequests(&corev1.Service_Spec_Config_HTTP_CertificateMonitoring{
+			IsEnabled: true,
+		}))
+
+		entries := logs.TakeAll()
+		assert.Equal(t, 1, len(entries))
+		assert.Equal(t, zap.InfoLevel, entries[0].Level)
+		assert.Equal(t, srv.Certificate().Issuer.String(), entries[0].ContextMap()["issuer"])
+		assert.Equal(t, srv.Certificate().NotAfter.UTC(), entries[0].ContextMap()["notAfter"].(time.Time).UTC())
+	}
+
+	{
+		assert.Equal(t, 1, doRequests(&corev1.Service_Spec_Config_HTTP_CertificateMonitoring{
+			IsEnabled: true,
+			ExpiryWarning: &metav1.Duration{
+				Type: &metav1.Duration_Days{
+					Days: 365 * 100,
+				},
+			},
+		}))
+
+		entries := logs.TakeAll()
+		assert.Equal(t, 1, len(entries))
+		assert.Equal(t, zap.WarnLevel, entries[0].Level)
+	}
+
+	{
+		svc := &corev1.Service{
+			Spec: &corev1.Service_Spec{
+				Config: &corev1.Service_Spec_Config{
+					Upstream: &corev1.Service_Spec_Config_Upstream{
+						Type: &corev1.Service_Spec_Config_Upstream_Url{
+							Url: srv.URL,
+						},
+					},
+				},
+			},
+		}
+		assert.Nil(t, getCertificateMonitoring(svc, nil))
+
+		monitorCfg := &corev1.Service_Spec_Config_HTTP_CertificateMonitoring{}
+		svc.Spec.Config.Type = &corev1.Service_Spec_Config_Http{
+			Http: &corev1.Service_Spec_Config_HTTP{
+				CertificateMonitoring: monitorCfg,
+			},
+		}
+		assert.Nil(t, getCertificateMonitoring(svc, nil))
+
+		monitorCfg.IsEnabled = true
+		assert.NotNil(t, getCertificateMonitoring(svc, nil))
+	}
+}
+
+func TestSignHMAC(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	key := []byte(utilrand.GetRandomString(32))
+	body := []byte(`{"event":"created"}`)
+	now := time.Unix(1700000000, 0)
+
+	sign := func(newHash func() hash.Hash, payload string) []byte {
+		mac := hmac.New(newHash, key)
+		mac.Write([]byte(payload))
+		return mac.Sum(nil)
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/hooks?id=1", nil)
+		signHMAC(req, &corev1.Service_Spec_Config_HTTP_Auth_HMAC{}, key, body, now)
+
+		assert.Equal(t, hex.EncodeToString(sign(sha256.New, string(body))), req.Header.Get("X-Signature"))
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/hooks?id=1", nil)
+		signHMAC(req, &corev1.Service_Spec_Config_HTTP_Auth_HMAC{
+			Header:          "X-Hub-Signature-256",
+			Prefix:          "sha256=",
+			TimestampHeader: "X-Timestamp",
+		}, key, body, now)
+
+		assert.Equal(t, "1700000000", req.Header.Get("X-Timestamp"))
+		assert.Equal(t, "sha256="+hex.EncodeToString(sign(sha256.New, "1700000000."+string(body))),
+			req.Header.Get("X-Hub-Signature-256"))
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/hooks?id=1", nil)
+		signHMAC(req, &corev1.Service_Spec_Config_HTTP_Auth_HMAC{
+			Algorithm:        corev1.Service_Spec_Config_HTTP_Auth_HMAC_SHA512,
+			Encoding:         corev1.Service_Spec_Config_HTTP_Auth_HMAC_BASE64,
+			TimestampHeader:  "X-Timestamp",
+			Canonicalization: corev1.Service_Spec_Config_HTTP_Auth_HMAC_TIMESTAMP_METHOD_PATH_BODY,
+			Separator:        "\n",
+		}, key, body, now)
+
+		assert.Equal(t, base64.StdEncoding.EncodeToString(
+			sign(sha512.New, "1700000000\nPOST\n/hooks?id=1\n"+string(body))),
+			req.Header.Get("X-Signature"))
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/hooks", nil)
+		signHMAC(req, &corev1.Service_Spec_Config_HTTP_Auth_HMAC{
+			Canonicalization: corev1.Service_Spec_Config_HTTP_Auth_HMAC_TIMESTAMP_BODY,
+		}, key, nil, now)
+
+		assert.Equal(t, hex.EncodeToString(sign(sha256.New, "")), req.Header.Get("X-Signature"))
+		assert.Equal(t, 1, len(req.Header))
+	}
+}
+
+func TestApplyDuplicateHeaders(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	policy := func(name string, p corev1.Service_Spec_Config_HTTP_Header_Duplicate_Policy) *corev1.Service_Spec_Config_HTTP_Header_Duplicate {
+		return &corev1.Service_Spec_Config_HTTP_Header_Duplicate{
+			Name:   name,
+			Policy: p,
+		}
+	}
+
+	getHdr := func() http.Header {
+		return http.Header{
+			"Authorization": []string{"Bearer a", "Bearer b"},
+			"Cookie":        []string{"a=1", "b=2", "c=3"},
+			"X-Custom":      []string{"x", "y"},
+			"X-Single":      []string{"z"},
+		}
+	}
+
+	{
+		hdr := getHdr()
+		applyDuplicateHeaders(hdr, nil)
+		assert.Equal(t, getHdr(), hdr)
+	}
+
+	{
+		hdr := getHdr()
+		applyDuplicateHeaders(hdr, []*corev1.Service_Spec_Config_HTTP_Header_Duplicate{
+			policy("x-custom", corev1.Service_Spec_Config_HTTP_Header_Duplicate_PASS),
+			policy("authorization", corev1.Service_Spec_Config_HTTP_Header_Duplicate_POLICY_UNSET),
+		})
+		assert.Equal(t, getHdr(), hdr)
+	}
+
+	{
+		hdr := getHdr()
+		applyDuplicateHeaders(hdr, []*corev1.Service_Spec_Config_HTTP_Header_Duplicate{
+			policy("x-custom", corev1.Service_Spec_Config_HTTP_Header_Duplicate_MERGE),
+			policy("Cookie", corev1.Service_Spec_Config_HTTP_Header_Duplicate_MERGE),
+			policy("X-Single", corev1.Service_Spec_Config_HTTP_Header_Duplicate_MERGE),
+		})
+		assert.Equal(t, []string{"x, y"}, hdr.Values("X-Custom"))
+		assert.Equal(t, []string{"a=1; b=2; c=3"}, hdr.Values("Cookie"))
+		assert.Equal(t, []string{"z"}, hdr.Values("X-Single"))
+		assert.Equal(t, []string{"Bearer a", "Bearer b"}, hdr.Values("Authorization"))
+	}
+
+	{
+		hdr := getHdr()
+		applyDuplicateHeaders(hdr, []*corev1.Service_Spec_Config_HTTP_Header_Duplicate{
+			policy("Authorization", corev1.Service_Spec_Config_HTTP_Header_Duplicate_FIRST),
+			policy("cookie", corev1.Service_Spec_Config_HTTP_Header_Duplicate_LAST),
+			policy("X-Missing", corev1.Service_Spec_Config_HTTP_Header_Duplicate_FIRST),
+		})
+		assert.Equal(t, []string{"Bearer a"}, hdr.Values("Authorization"))
+		assert.Equal(t, []string{"c=3"}, hdr.Values("Cookie"))
+		assert.Equal(t, []string{"x", "y"}, hdr.Values("X-Custom"))
+		assert.Equal(t, 0, len(hdr.Values("X-Missing")))
+	}
+}
+
+func TestDebugEcho(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	celEngine, err := celengine.New(ctx, &celengine.Opts{})
+	assert.Nil(t, err)
+
+	srv := &Server{
+		celEngine: celEngine,
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_DebugEcho{
+		IsEnabled:  true,
+		QueryParam: "debug",
+		Headers:    []string{"x-tenant", "X-Missing"},
+		Condition: &corev1.Condition{
+			Type: &corev1.Condition_Match{
+				Match: `ctx.user.metadata.name == "alice"`,
+			},
+		},
+	}
+
+	doReq := func(target string, userName string, hdrs map[string]string) (*httptest.ResponseRecorder, bool) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Service: &corev1.Service{
+				Metadata: &metav1.Metadata{
+					Name: "svc1.default",
+				},
+			},
+			ServiceConfig: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: &corev1.Service_Spec_Config_HTTP{
+						DebugEcho: cfg,
+					},
+				},
+			},
+			DownstreamInfo: &corev1.RequestContext{
+				User: &corev1.User{
+					Metadata: &metav1.Metadata{
+						Name: userName,
+					},
+				},
+			},
+			DownstreamRequest: &coctovigilv1.DownstreamRequest{
+				Request: &corev1.RequestContext_Request{
+					Type: &corev1.RequestContext_Request_Http{
+						Http: &corev1.RequestContext_Request_HTTP{
+							Headers: httputils.GetHeaders(req.Header),
+						},
+					},
+				},
+			},
+		}
+
+		// Simulate a header injected by the Service config after preAuth
+		req.Header.Set("X-Tenant", "injected")
+
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		return rw, srv.serveDebugEcho(rw, req)
+	}
+
+	{
+		_, ok := doReq("http://localhost/v1", "alice", nil)
+		assert.False(t, ok)
+	}
+
+	{
+		_, ok := doReq("http://localhost/v1?debug", "bob", nil)
+		assert.False(t, ok)
+	}
+
+	{
+		rw, ok := doReq("http://localhost/v1?debug", "alice", map[string]string{
+			"X-Tenant": "t1",
+		})
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+		resp := &debugEchoResponse{}
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		assert.Equal(t, "svc1.default", resp.Service)
+		assert.Equal(t, "default", resp.Config)
+		assert.Equal(t, "/v1", resp.Path)
+		assert.Equal(t, map[string]string{"X-Tenant": "t1"}, resp.Headers)
+		assert.Equal(t, loadbalancer.ErrNoUpstream.Error(), resp.Error)
+	}
+
+	{
+		cfg.Format = corev1.Service_Spec_Config_HTTP_DebugEcho_HEADERS
+		rw, ok := doReq("http://localhost/v1", "alice", map[string]string{
+			"X-Octelium-Debug-Echo": "1",
+			"X-Tenant":              "t1",
+		})
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+		assert.Equal(t, "svc1.default", rw.Header().Get("X-Octelium-Debug-Service"))
+		assert.Equal(t, "t1", rw.Header().Get("X-Octelium-Debug-Header-X-Tenant"))
+		assert.Equal(t, 0, rw.Body.Len())
+	}
+
+	{
+		cfg.IsEnabled = false
+		_, ok := doReq("http://localhost/v1?debug", "alice", nil)
+		assert.False(t, ok)
+	}
+}
+
+func TestValidateServiceConfigs(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getSvc := func(cfg *corev1.Service_Spec_Config, dynCfgs ...*corev1.Service_Spec_Config) *corev1.Service {
+		return &corev1.Service{
+			Metadata: &metav1.Metadata{
+				Name:            "svc1.default",
+				ResourceVersion: utilrand.GetRandomStringCanonical(8),
+			},
+			Spec: &corev1.Service_Spec{
+				Mode:   corev1.Service_Spec_HTTP,
+				Config: cfg,
+				DynamicConfig: &corev1.Service_Spec_DynamicConfig{
+					Configs: dynCfgs,
+				},
+			},
+		}
+	}
+
+	getPaths := func(err error) []string {
+		errs, ok := err.(configErrors)
+		if !ok {
+			return nil
+		}
+		var ret []string
+		for _, e := range errs {
+			ret = append(ret, e.Path)
+		}
+		return ret
+	}
+
+	{
+		assert.Nil(t, validateServiceConfigs(getSvc(nil)))
+		assert.Nil(t, validateServiceConfigs(getSvc(&corev1.Service_Spec_Config{
+			Upstream: &corev1.Service_Spec_Config_Upstream{
+				Type: &corev1.Service_Spec_Config_Upstream_Url{
+					Url: "https://example.com",
+				},
+			},
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					IsUpstreamHTTP2: true,
+				},
+			},
+		})))
+	}
+
+	{
+		err := validateServiceConfigs(getSvc(&corev1.Service_Spec_Config{
+			Upstream: &corev1.Service_Spec_Config_Upstream{
+				Type: &corev1.Service_Spec_Config_Upstream_Url{
+					Url: "wss://example.com",
+				},
+			},
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					IsUpstreamHTTP2: true,
+					Auth: &corev1.Service_Spec_Config_HTTP_Auth{
+						Type: &corev1.Service_Spec_Config_HTTP_Auth_Sigv4_{
+							Sigv4: &corev1.Service_Spec_Config_HTTP_Auth_Sigv4{
+								AccessKeyID: "AKID",
+								Region:      "us-east-1",
+							},
+						},
+					},
+				},
+			},
+		}))
+		assert.NotNil(t, err)
+		assert.Equal(t, []string{
+			"spec.config.http.auth.sigv4.secretAccessKey.fromSecret",
+			"spec.config.http.auth.sigv4",
+			"spec.config.http.isUpstreamHTTP2",
+		}, getPaths(err))
+	}
+
+	{
+		err := validateServiceConfigs(getSvc(nil, &corev1.Service_Spec_Config{
+			Name: "cfg1",
+			Upstream: &corev1.Service_Spec_Config_Upstream{
+				Type: &corev1.Service_Spec_Config_Upstream_Url{
+					Url: "https://example.com",
+				},
+			},
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					Response: &corev1.Service_Spec_Config_HTTP_Response{
+						Type: &corev1.Service_Spec_Config_HTTP_Response_Direct_{
+							Direct: &corev1.Service_Spec_Config_HTTP_Response_Direct{},
+						},
+					},
+					FanOut: &corev1.Service_Spec_Config_HTTP_FanOut{
+						IsEnabled: true,
+					},
+				},
+			},
+		}))
+		assert.NotNil(t, err)
+		assert.Equal(t, []string{
+			"spec.dynamicConfig.configs[cfg1].http.response.direct",
+			"spec.dynamicConfig.configs[cfg1].http.fanOut",
+			"spec.dynamicConfig.configs[cfg1].http.fanOut.regions",
+		}, getPaths(err))
+		assert.True(t, strings.HasPrefix(err.Error(),
+			"spec.dynamicConfig.configs[cfg1].http.response.direct: "))
+	}
+
+	{
+		err := validateServiceConfigs(getSvc(&corev1.Service_Spec_Config{
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					RequestFilter: &corev1.Service_Spec_Config_HTTP_RequestFilter{
+						IsEnabled: true,
+						Rules: []*corev1.Service_Spec_Config_HTTP_RequestFilter_Rule{
+							{
+								Name:    "valid",
+								Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH,
+								Pattern: `^/admin`,
+							},
+							{
+								Name:    "invalid",
+								Target:  corev1.Service_Spec_Config_HTTP_RequestFilter_Rule_PATH,
+								Pattern: `(`,
+							},
+						},
+					},
+				},
+			},
+		}))
+		assert.NotNil(t, err)
+		assert.Equal(t, []string{
+			"spec.config.http.requestFilter.rules[1].pattern",
+		}, getPaths(err))
+	}
+
+	{
+		srv := &Server{}
+		svc := getSvc(&corev1.Service_Spec_Config{
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					DebugEcho: &corev1.Service_Spec_Config_HTTP_DebugEcho{
+						IsEnabled: true,
+					},
+				},
+			},
+		})
+		assert.NotNil(t, srv.getConfigError(svc))
+		assert.Equal(t, svc.Metadata.ResourceVersion, srv.configValidation.Load().resourceVersion)
+
+		svc.Spec.Config.GetHttp().DebugEcho = nil
+		assert.NotNil(t, srv.getConfigError(svc))
+
+		svc.Metadata.ResourceVersion = utilrand.GetRandomStringCanonical(8)
+		assert.Nil(t, srv.getConfigError(svc))
+	}
+
+	{
+		// An inconsistent config is reported but still served.
+		vCache, err := vcache.NewCache(context.Background())
+		assert.Nil(t, err)
+
+		svc := getSvc(&corev1.Service_Spec_Config{
+			Type: &corev1.Service_Spec_Config_Http{
+				Http: &corev1.Service_Spec_Config_HTTP{
+					DebugEcho: &corev1.Service_Spec_Config_HTTP_DebugEcho{
+						IsEnabled: true,
+					},
+				},
+			},
+		})
+		vCache.SetService(svc)
+
+		srv := &Server{
+			vCache: vCache,
+		}
+
+		handler := srv.withRequestContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost/", nil).WithContext(
+			context.WithValue(context.Background(), middlewares.CtxRequestContext, &middlewares.RequestContext{})))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.NotNil(t, srv.configValidation.Load().err)
+	}
+}
+
+func TestNTLMResponses(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	// The test vectors of the MS-NLMP specification
+	creds := &ntlmCredentials{
+		username: "User",
+		domain:   "Domain",
+		password: "Password",
+	}
+
+	targetInfo, _ := hex.DecodeString(
+		"02000c0044006f006d00610069006e0001000c00530065007200760065007200000000")
+	challenge := &ntlmChallenge{
+		flags:           ntlmFlagUnicode | ntlmFlagTargetInfo,
+		serverChallenge: []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+		targetInfo:      targetInfo,
+	}
+	clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(ntlmv2ResponseKey(creds)))
+
+	lm, nt := getNTLMv2Responses(creds, challenge, clientChallenge, make([]byte, 8))
+	assert.Equal(t, "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa", hex.EncodeToString(lm))
+	assert.Equal(t, "0101000000000000"+"0000000000000000"+"aaaaaaaaaaaaaaaa"+"00000000"+
+		hex.EncodeToString(targetInfo)+"00000000", hex.EncodeToString(nt[16:]))
+	assert.Equal(t, ntlmHMACMD5(ntlmv2ResponseKey(creds), challenge.serverChallenge, nt[16:]), nt[:16])
+
+	assert.Nil(t, challenge.getTimestamp())
+
+	{
+		_, err := parseNTLMChallenge([]byte("NTLMSSP\x00"))
+		assert.NotNil(t, err)
+		_, err = parseNTLMChallenge(newNTLMNegotiateMessage())
+		assert.NotNil(t, err)
+	}
+}
+
+type ntlmTestServer struct {
+	t        *testing.T
+	scheme   string
+	creds    *ntlmCredentials
+	mu       sync.Mutex
+	conns    map[string][]byte
+	authed   map[string]bool
+	attempts atomic.Int32
+}
+
+func (s *ntlmTestServer) getChallengeMessage(serverChallenge []byte) []byte {
+	targetInfo := []byte{0x02, 0x00, 0x04, 0x00, 'D', 0, 'M', 0, 0, 0, 0, 0}
+
+	ret := make([]byte, 48)
+	copy(ret, ntlmSignature)
+	binary.LittleEndian.PutUint32(ret[8:], ntlmMessageChallenge)
+	binary.LittleEndian.PutUint32(ret[20:], ntlmFlagUnicode|ntlmFlagNTLM|ntlmFlagTargetInfo)
+	copy(ret[24:], serverChallenge)
+	binary.LittleEndian.PutUint16(ret[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(ret[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(ret[44:], 48)
+
+	return append(ret, targetInfo...)
+}
+
+func (s *ntlmTestServer) getField(msg []byte, offset int) []byte {
+	length := int(binary.LittleEndian.Uint16(msg[offset:]))
+	start := int(binary.LittleEndian.Uint32(msg[offset+4:]))
+	return msg[start : start+length]
+}
+
+func (s *ntlmTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := r.RemoteAddr
+	if s.authed[key] {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+		return
+	}
+
+	unauthorized := func(msg []byte) {
+		if msg == nil {
+			w.Header().Set("WWW-Authenticate", s.scheme)
+		} else {
+			w.Header().Set("WWW-Authenticate", s.scheme+" "+base64.StdEncoding.EncodeToString(msg))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	authz := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authz, s.scheme+" ") {
+		unauthorized(nil)
+		return
+	}
+
+	msg, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authz, s.scheme+" "))
+	assert.Nil(s.t, err)
+
+	switch binary.LittleEndian.Uint32(msg[8:]) {
+	case ntlmMessageNegotiate:
+		assert.Equal(s.t, int64(0), r.ContentLength)
+		s.attempts.Add(1)
+		serverChallenge := []byte(utilrand.GetRandomStringCanonical(8))
+		s.conns[key] = serverChallenge
+		unauthorized(s.getChallengeMessage(serverChallenge))
+	case ntlmMessageAuthenticate:
+		serverChallenge, ok := s.conns[key]
+		if !ok {
+			unauthorized(nil)
+			return
+		}
+		delete(s.conns, key)
+
+		nt := s.getField(msg, 20)
+		assert.Equal(s.t, ntlmEncodeString(s.creds.username, true), s.getField(msg, 36))
+		assert.Equal(s.t, ntlmEncodeString(s.creds.domain, true), s.getField(msg, 28))
+
+		if !hmac.Equal(nt[:16], ntlmHMACMD5(ntlmv2ResponseKey(s.creds), serverChallenge, nt[16:])) {
+			unauthorized(nil)
+			return
+		}
+
+		s.authed[key] = true
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	default:
+		unauthorized(nil)
+	}
+}
+
+func TestNTLMTransport(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	creds := &ntlmCredentials{
+		username: "alice",
+		domain:   "DM",
+		password: utilrand.GetRandomString(12),
+	}
+
+	for _, scheme := range []corev1.Service_Spec_Config_HTTP_Auth_NTLM_Scheme{
+		corev1.Service_Spec_Config_HTTP_Auth_NTLM_SCHEME_UNSET,
+		corev1.Service_Spec_Config_HTTP_Auth_NTLM_NEGOTIATE,
+	} {
+		upstream := &ntlmTestServer{
+			t:      t,
+			scheme: "NTLM",
+			creds:  creds,
+			conns:  make(map[string][]byte),
+			authed: make(map[string]bool),
+		}
+		if scheme == corev1.Service_Spec_Config_HTTP_Auth_NTLM_NEGOTIATE {
+			upstream.scheme = "Negotiate"
+		}
+
+		upstreamSrv := httptest.NewServer(upstream)
+
+		password := creds.password
+		rt := newNTLMTransport(&corev1.Service_Spec_Config_HTTP_Auth_NTLM{
+			Username: creds.username,
+			Domain:   creds.domain,
+			Scheme:   scheme,
+		}, func(ctx context.Context) (string, error) {
+			return password, nil
+		}, func() (*http.Transport, error) {
+			return &http.Transport{}, nil
+		})
+
+		doReq := func(body string) *http.Response {
+			req, err := http.NewRequest(http.MethodPost, upstreamSrv.URL, strings.NewReader(body))
+			assert.Nil(t, err)
+			resp, err := rt.RoundTrip(req)
+			assert.Nil(t, err)
+			return resp
+		}
+
+		assertBody := func(resp *http.Response, body string) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			b, err := io.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Nil(t, resp.Body.Close())
+			assert.Equal(t, body, string(b))
+		}
+
+		assertBody(doReq("a"), "a")
+		assert.Equal(t, int32(1), upstream.attempts.Load())
+
+		assertBody(doReq("b"), "b")
+		assert.Equal(t, int32(1), upstream.attempts.Load())
+
+		{
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					assertBody(doReq(fmt.Sprintf("req-%d", i)), fmt.Sprintf("req-%d", i))
+				}(i)
+			}
+			wg.Wait()
+			assert.True(t, upstream.attempts.Load() > 1)
+		}
+
+		{
+			rt.CloseIdleConnections()
+			upstream.attempts.Store(0)
+			upstreamSrv.CloseClientConnections()
+
+			assertBody(doReq("c"), "c")
+			assert.Equal(t, int32(1), upstream.attempts.Load())
+		}
+
+		{
+			// The authenticated connection is closed by the upstream while idle
+			upstream.attempts.Store(0)
+			upstreamSrv.CloseClientConnections()
+			time.Sleep(100 * time.Millisecond)
+
+			assertBody(doReq("d"), "d")
+			assert.Equal(t, int32(1), upstream.attempts.Load())
+		}
+
+		{
+			rt.CloseIdleConnections()
+			password = "invalid"
+			resp := doReq("e")
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			resp.Body.Close()
+		}
+
+		upstreamSrv.Close()
+	}
+}
+
+func TestDebugEchoTrace(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	celEngine, err := celengine.New(ctx, &celengine.Opts{})
+	assert.Nil(t, err)
+
+	srv := &Server{
+		celEngine: celEngine,
+	}
+
+	httpCfg := &corev1.Service_Spec_Config_HTTP{
+		DebugEcho: &corev1.Service_Spec_Config_HTTP_DebugEcho{
+			IsEnabled:    true,
+			IncludeTrace: true,
+			Condition: &corev1.Condition{
+				Type: &corev1.Condition_MatchAny{
+					MatchAny: true,
+				},
+			},
+		},
+		Auth: &corev1.Service_Spec_Config_HTTP_Auth{
+			Type: &corev1.Service_Spec_Config_HTTP_Auth_Sigv4_{
+				Sigv4: &corev1.Service_Spec_Config_HTTP_Auth_Sigv4{},
+			},
+		},
+	}
+
+	doReq := func() *debugEchoResponse {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/api/v1", nil)
+		req.Header.Set("X-Octelium-Debug-Echo", "1")
+		req.Header.Set("Authorization", "Bearer abc")
+		req.Header.Set("X-Tenant", "t1")
+
+		reqCtx := &middlewares.RequestContext{
+			CreatedAt: time.Now(),
+			Service: &corev1.Service{
+				Metadata: &metav1.Metadata{
+					Name: "svc1.default",
+				},
+			},
+			ServiceConfig: &corev1.Service_Spec_Config{
+				Upstream: &corev1.Service_Spec_Config_Upstream{
+					Type: &corev1.Service_Spec_Config_Upstream_Url{
+						Url: "https://example.com",
+					},
+				},
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: httpCfg,
+				},
+			},
+			DownstreamInfo: &corev1.RequestContext{},
+			DownstreamRequest: &coctovigilv1.DownstreamRequest{
+				Request: &corev1.RequestContext_Request{
+					Type: &corev1.RequestContext_Request_Http{
+						Http: &corev1.RequestContext_Request_HTTP{
+							Path:    req.URL.Path,
+							Headers: httputils.GetHeaders(req.Header),
+						},
+					},
+				},
+			},
+		}
+
+		// Simulate the mutations of the Service config
+		req.URL.Path = "/v1"
+		req.Header.Del("Authorization")
+		req.Header.Set("X-Tenant", "t2")
+		req.Header.Set("X-Added", "1")
+
+		req = req.WithContext(context.WithValue(context.Background(),
+			middlewares.CtxRequestContext, reqCtx))
+
+		rw := httptest.NewRecorder()
+		assert.True(t, srv.serveDebugEcho(rw, req))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		resp := &debugEchoResponse{}
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		return resp
+	}
+
+	{
+		resp := doReq()
+		assert.Equal(t, "/v1", resp.Path)
+		assert.Equal(t, &debugEchoTrace{
+			DownstreamPath:    "/api/v1",
+			SetHeaders:        []string{"X-Added", "X-Tenant"},
+			RemovedHeaders:    []string{"Authorization"},
+			AuthInjection:     "sigv4",
+			UpstreamSelection: "url",
+		}, resp.Trace)
+		assert.Equal(t, loadbalancer.ErrNoUpstream.Error(), resp.Error)
+	}
+
+	{
+		httpCfg.Response = &corev1.Service_Spec_Config_HTTP_Response{
+			Type: &corev1.Service_Spec_Config_HTTP_Response_Direct_{
+				Direct: &corev1.Service_Spec_Config_HTTP_Response_Direct{},
+			},
+		}
+		resp := doReq()
+		assert.Equal(t, "directResponse", resp.Trace.ShortCircuit)
+		assert.Equal(t, "", resp.Trace.UpstreamSelection)
+		assert.Equal(t, "", resp.Error)
+		assert.Equal(t, "", resp.Upstream)
+	}
+
+	{
+		httpCfg.DebugEcho.IncludeTrace = false
+		resp := doReq()
+		assert.Nil(t, resp.Trace)
+	}
+}
+
+func TestDebugEvaluate(t *testing.T) {
+
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	vCache, err := vcache.NewCache(ctx)
+	assert.Nil(t, err)
+
+	httpCfg := &corev1.Service_Spec_Config_HTTP{}
+	svc := &corev1.Service{
+		Metadata: &metav1.Metadata{
+			Name: "svc1.default",
+		},
+		Spec: &corev1.Service_Spec{
+			Mode:        corev1.Service_Spec_HTTP,
+			IsPublic:    true,
+			IsAnonymous: true,
+			Config: &corev1.Service_Spec_Config{
+				Upstream: &corev1.Service_Spec_Config_Upstream{
+					Type: &corev1.Service_Spec_Config_Upstream_Url{
+						Url: "https://example.com",
+					},
+				},
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: httpCfg,
+				},
+			},
+		},
+		Status: &corev1.Service_Status{},
+	}
+	vCache.SetService(svc)
+
+	srv := &Server{
+		vCache:    vCache,
+		lbManager: loadbalancer.NewLbManager(nil, vCache),
+	}
+
+	doReq := func(method string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://localhost/debug/evaluate", strings.NewReader(body))
+		rw := httptest.NewRecorder()
+		srv.ServeEvaluate(rw, req)
+		return rw
+	}
+
+	{
+		rw := doReq(http.MethodGet, "")
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+		assert.Equal(t, "POST", rw.Header().Get("Allow"))
+	}
+
+	{
+		assert.Equal(t, http.StatusBadRequest, doReq(http.MethodPost, "{").Code)
+		assert.Equal(t, http.StatusBadRequest, doReq(http.MethodPost, `{"path":"v1"}`).Code)
+		assert.Equal(t, http.StatusBadRequest,
+			doReq(http.MethodPost, `{"path":"/v1","sourceAddress":"invalid"}`).Code)
+	}
+
+	{
+		rw := doReq(http.MethodPost, `{"method":"post","path":"/v1?a=b","host":"svc1.example.com",`+
+			`"headers":{"X-Tenant":"t1"},"sourceAddress":"10.0.0.1"}`)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+		resp := &debugEvaluateResponse{}
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		assert.Equal(t, "svc1.default", resp.Service)
+		assert.True(t, resp.IsAuthorized)
+		assert.Equal(t, "default", resp.Config)
+		assert.Equal(t, "https://example.com", resp.Upstream)
+		assert.Equal(t, "", resp.Error)
+		assert.Equal(t, &debugEchoTrace{
+			UpstreamSelection: "url",
+		}, resp.Trace)
+	}
+
+	{
+		httpCfg.Response = &corev1.Service_Spec_Config_HTTP_Response{
+			Type: &corev1.Service_Spec_Config_HTTP_Response_Direct_{
+				Direct: &corev1.Service_Spec_Config_HTTP_Response_Direct{},
+			},
+		}
+		vCache.SetService(svc)
+
+		rw := doReq(http.MethodPost, `{"path":"/v1"}`)
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		resp := &debugEvaluateResponse{}
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), resp))
+		assert.Equal(t, "directResponse", resp.Trace.ShortCircuit)
+		assert.Equal(t, "", resp.Upstream)
+	}
+}
+
+func TestApplyUserAgent(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getHdr := func(ua string) http.Header {
+		ret := http.Header{}
+		if ua != "" {
+			ret.Set("User-Agent", ua)
+		}
+		return ret
+	}
+
+	{
+		hdr := getHdr("")
+		applyUserAgent(hdr, nil)
+		assert.Equal(t, "octelium", hdr.Get("User-Agent"))
+
+		hdr = getHdr("curl/8.0")
+		applyUserAgent(hdr, nil)
+		assert.Equal(t, "curl/8.0", hdr.Get("User-Agent"))
+	}
+
+	{
+		cfg := &corev1.Service_Spec_Config_HTTP_UserAgent{
+			Mode:  corev1.Service_Spec_Config_HTTP_UserAgent_SET,
+			Value: "my-agent/1.0",
+		}
+		hdr := getHdr("curl/8.0")
+		applyUserAgent(hdr, cfg)
+		assert.Equal(t, "my-agent/1.0", hdr.Get("User-Agent"))
+	}
+
+	{
+		cfg := &corev1.Service_Spec_Config_HTTP_UserAgent{
+			Mode:  corev1.Service_Spec_Config_HTTP_UserAgent_APPEND,
+			Value: "octelium/1.0",
+		}
+		hdr := getHdr("curl/8.0")
+		applyUserAgent(hdr, cfg)
+		assert.Equal(t, "curl/8.0 octelium/1.0", hdr.Get("User-Agent"))
+
+		hdr = getHdr("")
+		applyUserAgent(hdr, cfg)
+		assert.Equal(t, "octelium/1.0", hdr.Get("User-Agent"))
+	}
+
+	{
+		cfg := &corev1.Service_Spec_Config_HTTP_UserAgent{
+			Mode: corev1.Service_Spec_Config_HTTP_UserAgent_REMOVE,
+		}
+		hdr := getHdr("curl/8.0")
+		applyUserAgent(hdr, cfg)
+		assert.Equal(t, []string{""}, hdr["User-Agent"])
+
+		upstreamSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := r.Header["User-Agent"]
+			assert.False(t, ok)
+		}))
+		defer upstreamSrv.Close()
+
+		req, err := http.NewRequest(http.MethodGet, upstreamSrv.URL, nil)
+		assert.Nil(t, err)
+		applyUserAgent(req.Header, cfg)
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+}
+
+func TestListenerALPN(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getSvc := func(mode corev1.Service_Spec_Config_HTTP_ALPN_Mode) *corev1.Service {
+		return &corev1.Service{
+			Spec: &corev1.Service_Spec{
+				Mode:  corev1.Service_Spec_HTTP,
+				IsTLS: true,
+				Config: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							Alpn: &corev1.Service_Spec_Config_HTTP_ALPN{
+								Mode: mode,
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	runServer := func(svc *corev1.Service) *httptest.Server {
+		srv := httptest.NewUnstartedServer(withListenerALPN(svc,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			})))
+		srv.TLS = &tls.Config{
+			NextProtos: getListenerNextProtos(svc),
+		}
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return srv
+	}
+
+	getNegotiated := func(srv *httptest.Server, offered []string) (string, error) {
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         offered,
+		})
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.ConnectionState().NegotiatedProtocol, nil
+	}
+
+	both := []string{"h2", "http/1.1"}
+	bothHTTP1First := []string{"http/1.1", "h2"}
+
+	{
+		srv := runServer(getSvc(corev1.Service_Spec_Config_HTTP_ALPN_MODE_UNSET))
+		proto, err := getNegotiated(srv, bothHTTP1First)
+		assert.Nil(t, err)
+		assert.Equal(t, "h2", proto)
+
+		proto, err = getNegotiated(srv, []string{"http/1.1"})
+		assert.Nil(t, err)
+		assert.Equal(t, "http/1.1", proto)
+	}
+
+	{
+		svc := getSvc(corev1.Service_Spec_Config_HTTP_ALPN_HTTP1_ONLY)
+		assert.False(t, ucorev1.ToService(svc).IsListenerHTTP2())
+
+		srv := runServer(svc)
+		proto, err := getNegotiated(srv, both)
+		assert.Nil(t, err)
+		assert.Equal(t, "http/1.1", proto)
+
+		_, err = getNegotiated(srv, []string{"h2"})
+		assert.NotNil(t, err)
+	}
+
+	{
+		srv := runServer(getSvc(corev1.Service_Spec_Config_HTTP_ALPN_PREFER_HTTP1))
+		proto, err := getNegotiated(srv, both)
+		assert.Nil(t, err)
+		assert.Equal(t, "http/1.1", proto)
+
+		proto, err = getNegotiated(srv, []string{"h2"})
+		assert.Nil(t, err)
+		assert.Equal(t, "h2", proto)
+	}
+
+	{
+		svc := getSvc(corev1.Service_Spec_Config_HTTP_ALPN_H2_ONLY)
+		svc.Spec.IsTLS = false
+		assert.True(t, ucorev1.ToService(svc).IsListenerHTTP2())
+		svc.Spec.IsTLS = true
+
+		srv := runServer(svc)
+		proto, err := getNegotiated(srv, both)
+		assert.Nil(t, err)
+		assert.Equal(t, "h2", proto)
+
+		// Clients that only offer HTTP/1.1 or do not use ALPN at all
+		// complete the handshake without a negotiated protocol and then fall
+		// back to HTTP/1.1 which is rejected.
+		proto, err = getNegotiated(srv, []string{"http/1.1"})
+		assert.Nil(t, err)
+		assert.Equal(t, "", proto)
+
+		_, err = getNegotiated(srv, []string{"spdy/3"})
+		assert.NotNil(t, err)
+
+		c := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+			},
+		}
+		resp, err := c.Get(srv.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusHTTPVersionNotSupported, resp.StatusCode)
+		resp.Body.Close()
+
+		c = srv.Client()
+		resp, err = c.Get(srv.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "HTTP/2.0", string(body))
+	}
+}
+
+func TestCertRotator(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getCrt := func(cn string) *tls.Certificate {
+		ca, err := utils_cert.GenerateCARoot()
+		assert.Nil(t, err)
+		crt, err := utils_cert.GenerateCertificateTmp(cn, ca, false)
+		assert.Nil(t, err)
+		ret, err := tls.X509KeyPair(crt.MustGetCertPEM(), crt.MustGetPrivateKeyPEM())
+		assert.Nil(t, err)
+		return &ret
+	}
+
+	{
+		svc := &corev1.Service{
+			Spec: &corev1.Service_Spec{
+				Config: &corev1.Service_Spec_Config{
+					Tls: &corev1.Service_Spec_Config_TLS{
+						ClientCertificate: &corev1.Service_Spec_Config_TLS_ClientCertificate{
+							Type: &corev1.Service_Spec_Config_TLS_ClientCertificate_FromSecret{
+								FromSecret: "crt",
+							},
+						},
+					},
+				},
+			},
+		}
+		assert.Equal(t, "", getRotatedClientCertificate(svc, nil))
+
+		svc.Spec.Config.Tls.ClientCertificate.Rotation = &corev1.Service_Spec_Config_TLS_ClientCertificate_Rotation{
+			IsEnabled: true,
+		}
+		assert.Equal(t, "crt", getRotatedClientCertificate(svc, nil))
+	}
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(entered)
+			<-release
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	var cur atomic.Pointer[tls.Certificate]
+	cur.Store(getCrt("client-1"))
+	loads := 0
+
+	rotator, tlsCfg, err := newCertRotator("crt", &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{*cur.Load()},
+	}, func(ctx context.Context) (*tls.Certificate, error) {
+		loads++
+		return cur.Load(), nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, tlsCfg.Certificates)
+
+	rt := &http.Transport{
+		TLSClientConfig: tlsCfg,
+	}
+	rotator.rt = rt
+	client := &http.Client{
+		Transport: &rotatingTransport{
+			RoundTripper: rt,
+			rotator:      rotator,
+		},
+	}
+
+	doGet := func(path string) string {
+		resp, err := client.Get(srv.URL + path)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		bb, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(bb)
+	}
+
+	slowRes := make(chan string, 1)
+	go func() {
+		slowRes <- doGet("/slow")
+	}()
+	<-entered
+
+	assert.Equal(t, "client-1", doGet("/"))
+
+	rotator.onSecretUpdate("other")
+	assert.Equal(t, 0, loads)
+
+	rotator.onSecretUpdate("crt")
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, "client-1", doGet("/"))
+
+	cur.Store(getCrt("client-2"))
+	rotator.onSecretUpdate("crt")
+	assert.Equal(t, "client-2", doGet("/"))
+	assert.Equal(t, "client-2", doGet("/"))
+
+	close(release)
+	assert.Equal(t, "client-1", <-slowRes)
+
+	stopped := false
+	rotator.stopFn = func() {
+		stopped = true
+	}
+	closeTransport(client.Transport)
+	assert.True(t, stopped)
+}
+
+// tstSrvGRPCStream is a generic gRPC echo upstream that serves the unary,
+// server-streaming, client-streaming and bidirectional streaming kinds
+// according to the called method.
+type tstSrvGRPCStream struct {
+	port    int
+	grpcSrv *grpc.Server
+	acked   chan struct{}
+}
+
+func (s *tstSrvGRPCStream) run(t *testing.T) {
+	lis, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", s.port))
+	assert.Nil(t, err)
+
+	s.acked = make(chan struct{})
+	s.grpcSrv = grpc.NewServer(grpc.UnknownServiceHandler(s.handle))
+	go func() {
+		s.grpcSrv.Serve(lis)
+	}()
+	time.Sleep(1 * time.Second)
+}
+
+func (s *tstSrvGRPCStream) handle(srv any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	if err := stream.SetHeader(metadata.Pairs("x-echo-method", method)); err != nil {
+		return err
+	}
+
+	switch method {
+	case "/test.Echo/ServerStream":
+		req := &wrapperspb.StringValue{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+
+		if err := stream.SendMsg(wrapperspb.String(req.Value + "-0")); err != nil {
+			return err
+		}
+
+		// The second message is only sent once the client has received the
+		// first one which fails unless the proxy flushes every message.
+		select {
+		case <-s.acked:
+		case <-time.After(5 * time.Second):
+			return status.Errorf(codes.DeadlineExceeded, "not acked")
+		}
+
+		if err := stream.SendMsg(wrapperspb.String(req.Value + "-1")); err != nil {
+			return err
+		}
+		stream.SetTrailer(metadata.Pairs("x-echo-count", "2"))
+		return nil
+	case "/test.Echo/ClientStream":
+		var ret []string
+		for {
+			req := &wrapperspb.StringValue{}
+			if err := stream.RecvMsg(req); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return err
+			}
+			ret = append(ret, req.Value)
+		}
+
+		stream.SetTrailer(metadata.Pairs("x-echo-count", fmt.Sprintf("%d", len(ret))))
+		return stream.SendMsg(wrapperspb.String(strings.Join(ret, ",")))
+	case "/test.Echo/Bidi":
+		count := 0
+		for {
+			req := &wrapperspb.StringValue{}
+			if err := stream.RecvMsg(req); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return err
+			}
+			count++
+			if err := stream.SendMsg(wrapperspb.String(req.Value)); err != nil {
+				return err
+			}
+		}
+
+		stream.SetTrailer(metadata.Pairs("x-echo-count", fmt.Sprintf("%d", count)))
+		return status.Errorf(codes.Aborted, "done after %d", count)
+	default:
+		return status.Errorf(codes.Unimplemented, "unknown method")
+	}
+}
+
+func (s *tstSrvGRPCStream) close() {
+	s.grpcSrv.Stop()
+	time.Sleep(1 * time.Second)
+}
+
+func TestGRPCStreaming(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+	fakeC := tst.C
+
+	upstreamSrv := &tstSrvGRPCStream{
+		port: tests.GetPort(),
+	}
+	upstreamSrv.run(t)
+	defer upstreamSrv.close()
+
+	{
+		cc, err := fakeC.OcteliumC.CoreV1Utils().GetClusterConfig(ctx)
+		assert.Nil(t, err)
+
+		cc.Status.Network.ClusterNetwork = &metav1.DualStackNetwork{
+			V4: "127.0.0.0/8",
+			V6: "::1/128",
+		}
+		_, err = fakeC.OcteliumC.CoreC().UpdateClusterConfig(ctx, cc)
+		assert.Nil(t, err)
+	}
+
+	adminSrv := admin.NewServer(&admin.Opts{
+		OcteliumC:  fakeC.OcteliumC,
+		IsEmbedded: true,
+	})
+	usrSrv := user.NewServer(fakeC.OcteliumC)
+
+	svc, err := adminSrv.CreateService(ctx, &corev1.Service{
+		Metadata: &metav1.Metadata{
+			Name: utilrand.GetRandomStringCanonical(6),
+		},
+		Spec: &corev1.Service_Spec{
+			IsPublic: true,
+			Port:     uint32(tests.GetPort()),
+			Mode:     corev1.Service_Spec_GRPC,
+			Config: &corev1.Service_Spec_Config{
+				Upstream: &corev1.Service_Spec_Config_Upstream{
+					Type: &corev1.Service_Spec_Config_Upstream_Url{
+						Url: fmt.Sprintf("http://localhost:%d", upstreamSrv.port),
+					},
+				},
+				Type: &corev1.Service_Spec_Config_Http{
+					Http: &corev1.Service_Spec_Config_HTTP{
+						EnableRequestBuffering: true,
+						Flush: &corev1.Service_Spec_Config_HTTP_Flush{
+							Type: &corev1.Service_Spec_Config_HTTP_Flush_Disabled{
+								Disabled: true,
+							},
+						},
+					},
+				},
+			},
+			Authorization: &corev1.Service_Spec_Authorization{
+				InlinePolicies: []*corev1.InlinePolicy{
+					{
+						Spec: &corev1.Policy_Spec{
+							Rules: []*corev1.Policy_Spec_Rule{
+								{
+									Effect: corev1.Policy_Spec_Rule_ALLOW,
+									Condition: &corev1.Condition{
+										Type: &corev1.Condition_MatchAny{
+											MatchAny: true,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.Nil(t, err, "%+v", err)
+
+	svcV, err := fakeC.OcteliumC.CoreC().GetService(ctx, &rmetav1.GetOptions{Uid: svc.Metadata.Uid})
+	assert.Nil(t, err)
+
+	vCache, err := vcache.NewCache(ctx)
+	assert.Nil(t, err)
+	vCache.SetService(svcV)
+
+	octovigilC, err := octovigilc.NewClient(ctx, &octovigilc.Opts{
+		VCache:    vCache,
+		OcteliumC: fakeC.OcteliumC,
+	})
+	assert.Nil(t, err)
+
+	secretMan, err := secretman.New(ctx, fakeC.OcteliumC, vCache)
+	assert.Nil(t, err)
+
+	srv, err := New(ctx, &modes.Opts{
+		OcteliumC:  fakeC.OcteliumC,
+		VCache:     vCache,
+		OctovigilC: octovigilC,
+		SecretMan:  secretMan,
+		LBManager:  loadbalancer.NewLbManager(fakeC.OcteliumC, vCache),
+	})
+	assert.Nil(t, err)
+	err = srv.lbManager.Run(ctx)
+	assert.Nil(t, err)
+	err = srv.Run(ctx)
+	assert.Nil(t, err, "%+v", err)
+	defer srv.Close()
+
+	usr, err := tstuser.NewUser(fakeC.OcteliumC, adminSrv, usrSrv, nil)
+	assert.Nil(t, err)
+	err = usr.Connect()
+	assert.Nil(t, err, "%+v", err)
+
+	usr.Session.Status.Connection = &corev1.Session_Status_Connection{
+		Addresses: []*metav1.DualStackNetwork{
+			{
+				V4: "127.0.0.1/32",
+				V6: "::1/128",
+			},
+		},
+		Type:   corev1.Session_Status_Connection_WIREGUARD,
+		L3Mode: corev1.Session_Status_Connection_V4,
+	}
+
+	usr.Session, err = fakeC.OcteliumC.CoreC().UpdateSession(ctx, usr.Session)
+	assert.Nil(t, err)
+	usr.Resync()
+
+	srv.octovigilC.GetCache().SetSession(usr.Session)
+	usr.Resync()
+
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.NewClient(fmt.Sprintf("localhost:%d", ucorev1.ToService(svcV).RealPort()),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	newStream := func(method string, isClient, isServer bool) grpc.ClientStream {
+		stream, err := conn.NewStream(ctx, &grpc.StreamDesc{
+			ClientStreams: isClient,
+			ServerStreams: isServer,
+		}, method)
+		assert.Nil(t, err)
+		return stream
+	}
+
+	{
+		stream := newStream("/test.Echo/ServerStream", false, true)
+		assert.Nil(t, stream.SendMsg(wrapperspb.String("msg")))
+		assert.Nil(t, stream.CloseSend())
+
+		res := &wrapperspb.StringValue{}
+		assert.Nil(t, stream.RecvMsg(res))
+		assert.Equal(t, "msg-0", res.Value)
+
+		hdr, err := stream.Header()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"/test.Echo/ServerStream"}, hdr.Get("x-echo-method"))
+
+		close(upstreamSrv.acked)
+
+		assert.Nil(t, stream.RecvMsg(res))
+		assert.Equal(t, "msg-1", res.Value)
+
+		assert.True(t, errors.Is(stream.RecvMsg(res), io.EOF))
+		assert.Equal(t, []string{"2"}, stream.Trailer().Get("x-echo-count"))
+	}
+
+	{
+		stream := newStream("/test.Echo/ClientStream", true, false)
+		for _, val := range []string{"a", "b", "c"} {
+			assert.Nil(t, stream.SendMsg(wrapperspb.String(val)))
+		}
+		assert.Nil(t, stream.CloseSend())
+
+		res := &wrapperspb.StringValue{}
+		assert.Nil(t, stream.RecvMsg(res))
+		assert.Equal(t, "a,b,c", res.Value)
+		assert.True(t, errors.Is(stream.RecvMsg(res), io.EOF))
+		assert.Equal(t, []string{"3"}, stream.Trailer().Get("x-echo-count"))
+	}
+
+	{
+		stream := newStream("/test.Echo/Bidi", true, true)
+		for i := 0; i < 10; i++ {
+			val := fmt.Sprintf("ping-%d", i)
+			assert.Nil(t, stream.SendMsg(wrapperspb.String(val)))
+
+			res := &wrapperspb.StringValue{}
+			assert.Nil(t, stream.RecvMsg(res))
+			assert.Equal(t, val, res.Value)
+		}
+		assert.Nil(t, stream.CloseSend())
+
+		err := stream.RecvMsg(&wrapperspb.StringValue{})
+		assert.Equal(t, codes.Aborted, status.Code(err))
+		assert.Equal(t, "done after 10", status.Convert(err).Message())
+		assert.Equal(t, []string{"10"}, stream.Trailer().Get("x-echo-count"))
+	}
+}
+
+type tstBlockingRoundTripper struct{}
+
+func (tstBlockingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestGRPCDeadline(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	s := &Server{}
+
+	newSrv := func(mode corev1.Service_Spec_Mode) *httptest.Server {
+		proxy := &httputil.ReverseProxy{
+			Transport: tstBlockingRoundTripper{},
+			Director: func(outReq *http.Request) {
+				outReq.URL.Scheme = "http"
+				outReq.URL.Host = "upstream.local"
+			},
+			ErrorHandler: s.handleProxyError,
+		}
+
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), middlewares.CtxRequestContext, &middlewares.RequestContext{
+				Service: &corev1.Service{
+					Spec: &corev1.Service_Spec{
+						Mode: mode,
+					},
+				},
+				ServiceConfig: &corev1.Service_Spec_Config{},
+			})
+			ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+
+			proxy.ServeHTTP(w, r.WithContext(ctx))
+		}))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		return srv
+	}
+
+	{
+		srv := newSrv(corev1.Service_Spec_GRPC)
+		defer srv.Close()
+
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(srv.Certificate())
+
+		conn, err := grpc.NewClient(srv.Listener.Addr().String(),
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+				RootCAs: rootCAs,
+			})))
+		assert.Nil(t, err)
+		defer conn.Close()
+
+		// The client sets no deadline of its own, the status is the one
+		// written by the proxy once the Service's deadline expires.
+		err = conn.Invoke(context.Background(), "/test.Echo/Unary",
+			wrapperspb.String("msg"), &wrapperspb.StringValue{})
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "%+v", err)
+	}
+
+	{
+		srv := newSrv(corev1.Service_Spec_HTTP)
+		defer srv.Close()
+
+		resp, err := srv.Client().Get(srv.URL)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+		assert.Equal(t, "", resp.Header.Get("Grpc-Status"))
+	}
+}
+
+type tstStatusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *tstStatusRecorder) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func TestClientDisconnect(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	s := &Server{}
+
+	{
+		statusCh := make(chan int, 1)
+
+		proxy := &httputil.ReverseProxy{
+			Transport: tstBlockingRoundTripper{},
+			Director: func(outReq *http.Request) {
+				outReq.URL.Scheme = "http"
+				outReq.URL.Host = "upstream.local"
+			},
+			ErrorHandler: s.handleProxyError,
+		}
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), middlewares.CtxRequestContext, &middlewares.RequestContext{
+				Service: &corev1.Service{
+					Spec: &corev1.Service_Spec{},
+				},
+				ServiceConfig: &corev1.Service_Spec_Config{},
+				ClientCtx:     r.Context(),
+			})
+
+			rw := &tstStatusRecorder{
+				ResponseWriter: w,
+			}
+			proxy.ServeHTTP(rw, r.WithContext(ctx))
+			statusCh <- rw.statusCode
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		assert.Nil(t, err)
+
+		_, err = srv.Client().Do(req)
+		assert.NotNil(t, err)
+
+		select {
+		case statusCode := <-statusCh:
+			assert.Equal(t, 499, statusCode)
+		case <-time.After(5 * time.Second):
+			t.Fatal("The request was not canceled")
+		}
+	}
+
+	doHandle := func(clientCtx context.Context, err error) int {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.CtxRequestContext,
+			&middlewares.RequestContext{
+				Service: &corev1.Service{
+					Spec: &corev1.Service_Spec{},
+				},
+				ServiceConfig: &corev1.Service_Spec_Config{},
+				ClientCtx:     clientCtx,
+			}))
+		rw := httptest.NewRecorder()
+		s.handleProxyError(rw, req, err)
+		return rw.Code
+	}
+
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, 499, doHandle(ctx, context.Canceled))
+		assert.Equal(t, 499, doHandle(ctx, io.ErrUnexpectedEOF))
+	}
+
+	{
+		// The upstream request is canceled while the client is still there,
+		// e.g. by the upstream itself resetting the stream.
+		assert.Equal(t, http.StatusBadGateway, doHandle(context.Background(), context.Canceled))
+		assert.Equal(t, http.StatusBadGateway, doHandle(nil, context.Canceled))
+		assert.Equal(t, http.StatusBadGateway,
+			doHandle(context.Background(), errors.Wrap(context.Canceled, "upstream")))
+	}
+}
+
+func TestSessionResumption(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	ca, err := utils_cert.GenerateCARoot()
+	assert.Nil(t, err)
+	crt, err := utils_cert.GenerateCertificateTmp("localhost", ca, false)
+	assert.Nil(t, err)
+	srvCrt, err := tls.X509KeyPair(crt.MustGetCertPEM(), crt.MustGetPrivateKeyPEM())
+	assert.Nil(t, err)
+
+	getSrvCfg := func() *tls.Config {
+		return &tls.Config{
+			Certificates: []tls.Certificate{srvCrt},
+		}
+	}
+
+	listen := func(cfg *tls.Config) string {
+		lis, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+		assert.Nil(t, err)
+		t.Cleanup(func() {
+			lis.Close()
+		})
+
+		go func() {
+			for {
+				c, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer c.Close()
+					c.Write([]byte("ok"))
+				}()
+			}
+		}()
+
+		return lis.Addr().String()
+	}
+
+	newClientCfg := func() *tls.Config {
+		return &tls.Config{
+			ServerName:         "localhost",
+			InsecureSkipVerify: true,
+			ClientSessionCache: tls.NewLRUClientSessionCache(8),
+		}
+	}
+
+	didResume := func(addr string, cfg *tls.Config) bool {
+		c, err := tls.Dial("tcp", addr, cfg)
+		assert.Nil(t, err)
+		defer c.Close()
+		// Reading makes the client process the post-handshake session tickets
+		_, err = io.ReadAll(c)
+		assert.Nil(t, err)
+		return c.ConnectionState().DidResume
+	}
+
+	master := utilrand.GetRandomBytesMust(32)
+	load := func(ctx context.Context) ([]byte, error) {
+		return master, nil
+	}
+
+	{
+		m := newTicketKeyManager("key", time.Hour, func(ctx context.Context) ([]byte, error) {
+			return []byte("short"), nil
+		})
+		assert.NotNil(t, m.reload(context.Background()))
+	}
+
+	{
+		m := newTicketKeyManager("key", time.Hour, load)
+		assert.Nil(t, m.reload(context.Background()))
+		srvCfg := getSrvCfg()
+		m.add(srvCfg)
+		addr := listen(srvCfg)
+
+		nextEpoch := func(n int64) time.Time {
+			return time.Unix(0, (m.epoch+n)*int64(m.interval))
+		}
+
+		clientCfg := newClientCfg()
+		assert.False(t, didResume(addr, clientCfg))
+		assert.True(t, didResume(addr, clientCfg))
+
+		// Another instance sharing the same master secret resumes the session
+		m2 := newTicketKeyManager("key", time.Hour, load)
+		assert.Nil(t, m2.reload(context.Background()))
+		srvCfg2 := getSrvCfg()
+		m2.add(srvCfg2)
+		addr2 := listen(srvCfg2)
+		assert.True(t, didResume(addr2, clientCfg))
+
+		// The tickets issued before the rotation are still valid
+		oldClientCfg := newClientCfg()
+		assert.False(t, didResume(addr, oldClientCfg))
+		m.rotate(nextEpoch(1))
+		assert.True(t, didResume(addr, oldClientCfg))
+
+		// But not two rotations later
+		oldClientCfg = newClientCfg()
+		assert.False(t, didResume(addr, oldClientCfg))
+		m.rotate(nextEpoch(2))
+		assert.False(t, didResume(addr, oldClientCfg))
+		assert.True(t, didResume(addr, oldClientCfg))
+
+		// Rotating to the same epoch is a no-op
+		m.rotate(nextEpoch(0))
+		assert.True(t, didResume(addr, oldClientCfg))
+
+		// Updating the master secret invalidates the previous tickets
+		master = utilrand.GetRandomBytesMust(32)
+		m.onSecretUpdate("other")
+		assert.True(t, didResume(addr, oldClientCfg))
+		m.onSecretUpdate("key")
+		assert.False(t, didResume(addr, oldClientCfg))
+		assert.True(t, didResume(addr, oldClientCfg))
+	}
+
+	{
+		srvCfg := getSrvCfg()
+		newSessionCache(1).apply(srvCfg)
+		addr := listen(srvCfg)
+
+		clientCfg1 := newClientCfg()
+		assert.False(t, didResume(addr, clientCfg1))
+		assert.True(t, didResume(addr, clientCfg1))
+
+		// The session of the first client is evicted
+		clientCfg2 := newClientCfg()
+		assert.False(t, didResume(addr, clientCfg2))
+		assert.False(t, didResume(addr, clientCfg1))
+		assert.False(t, didResume(addr, clientCfg2))
+	}
+
+	{
+		s := &Server{}
+		svc := &corev1.Service{
+			Spec: &corev1.Service_Spec{
+				Config: &corev1.Service_Spec_Config{
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							ListenerTLS: &corev1.Service_Spec_Config_HTTP_ListenerTLS{
+								SessionResumption: &corev1.Service_Spec_Config_HTTP_ListenerTLS_SessionResumption{
+									DisableTickets: true,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		srvCfg := getSrvCfg()
+		assert.Nil(t, s.setSessionResumption(context.Background(), svc, srvCfg))
+		assert.True(t, srvCfg.SessionTicketsDisabled)
+		addr := listen(srvCfg)
+
+		clientCfg := newClientCfg()
+		assert.False(t, didResume(addr, clientCfg))
+		assert.False(t, didResume(addr, clientCfg))
+	}
+}
+
+func TestConnectionIsolation(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+	t.Cleanup(upstream.Close)
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	secretMan, err := secretman.New(ctx, nil, nil)
+	assert.Nil(t, err)
+
+	getDownstream := func(userUID, sessUID string) *corev1.RequestContext {
+		return &corev1.RequestContext{
+			User: &corev1.User{
+				Metadata: &metav1.Metadata{
+					Uid: userUID,
+				},
+			},
+			Session: &corev1.Session{
+				Metadata: &metav1.Metadata{
+					Uid: sessUID,
+				},
+			},
+		}
+	}
+
+	newRoundTripper := func(mode corev1.Service_Spec_Config_HTTP_ConnectionIsolation_Mode) func(*corev1.RequestContext) string {
+		svc := &corev1.Service{
+			Spec: &corev1.Service_Spec{
+				Mode: corev1.Service_Spec_HTTP,
+				Config: &corev1.Service_Spec_Config{
+					Upstream: &corev1.Service_Spec_Config_Upstream{
+						Type: &corev1.Service_Spec_Config_Upstream_Url{
+							Url: upstream.URL,
+						},
+					},
+					Type: &corev1.Service_Spec_Config_Http{
+						Http: &corev1.Service_Spec_Config_HTTP{
+							ConnectionIsolation: &corev1.Service_Spec_Config_HTTP_ConnectionIsolation{
+								Mode: mode,
+							},
+						},
+					},
+				},
+			},
+			Status: &corev1.Service_Status{},
+		}
+
+		transports := newTransportCache(maxTransports)
+		t.Cleanup(transports.close)
+		isolatedTransports := newTransportCache(3)
+		t.Cleanup(isolatedTransports.close)
+
+		r := &roundTripper{
+			upstream: &loadbalancer.Upstream{
+				URL:      upstreamURL,
+				HostPort: upstreamURL.Host,
+			},
+			secretMan:          secretMan,
+			transports:         transports,
+			isolatedTransports: isolatedTransports,
+		}
+
+		// doRequest returns the upstream connection address of the request
+		return func(downstream *corev1.RequestContext) string {
+			req := httptest.NewRequest(http.MethodGet, upstream.URL, nil)
+			req.RequestURI = ""
+			req = req.WithContext(context.WithValue(req.Context(), middlewares.CtxRequestContext,
+				&middlewares.RequestContext{
+					Service:        svc,
+					DownstreamInfo: downstream,
+				}))
+
+			resp, err := r.RoundTrip(req)
+			assert.Nil(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			return string(body)
+		}
+	}
+
+	{
+		doRequest := newRoundTripper(corev1.Service_Spec_Config_HTTP_ConnectionIsolation_MODE_UNSET)
+		conn := doRequest(getDownstream("usr-1", "sess-1"))
+		assert.Equal(t, conn, doRequest(getDownstream("usr-2", "sess-2")))
+		assert.Equal(t, conn, doRequest(nil))
+	}
+
+	{
+		doRequest := newRoundTripper(corev1.Service_Spec_Config_HTTP_ConnectionIsolation_USER)
+		conn1 := doRequest(getDownstream("usr-1", "sess-1"))
+		conn2 := doRequest(getDownstream("usr-2", "sess-2"))
+		connAnonymous := doRequest(nil)
+		assert.NotEqual(t, conn1, conn2)
+		assert.NotEqual(t, conn1, connAnonymous)
+		assert.NotEqual(t, conn2, connAnonymous)
+
+		assert.Equal(t, conn1, doRequest(getDownstream("usr-1", "sess-3")))
+		assert.Equal(t, conn2, doRequest(getDownstream("usr-2", "sess-2")))
+		assert.Equal(t, connAnonymous, doRequest(nil))
+	}
+
+	{
+		doRequest := newRoundTripper(corev1.Service_Spec_Config_HTTP_ConnectionIsolation_SESSION)
+		conn1 := doRequest(getDownstream("usr-1", "sess-1"))
+		conn2 := doRequest(getDownstream("usr-1", "sess-2"))
+		assert.NotEqual(t, conn1, conn2)
+
+		assert.Equal(t, conn1, doRequest(getDownstream("usr-1", "sess-1")))
+		assert.Equal(t, conn2, doRequest(getDownstream("usr-1", "sess-2")))
+
+		// The least recently used identity is evicted beyond the bound of
+		// the isolated transports.
+		doRequest(getDownstream("usr-1", "sess-3"))
+		doRequest(getDownstream("usr-1", "sess-4"))
+		assert.Equal(t, conn2, doRequest(getDownstream("usr-1", "sess-2")))
+		assert.NotEqual(t, conn1, doRequest(getDownstream("usr-1", "sess-1")))
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Accept-Encoding")))
+	}))
+	t.Cleanup(upstream.Close)
+
+	doRequest := func(httpCfg *corev1.Service_Spec_Config_HTTP, acceptEncoding string) string {
+		outReq, err := http.NewRequest(http.MethodGet, upstream.URL, nil)
+		assert.Nil(t, err)
+		if acceptEncoding != "" {
+			outReq.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+
+		setUpstreamAcceptEncoding(outReq, httpCfg)
+
+		resp, err := (&http.Transport{}).RoundTrip(outReq)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+
+	{
+		assert.Equal(t, "gzip, br", doRequest(nil, "gzip, br"))
+		assert.Equal(t, "gzip, br", doRequest(&corev1.Service_Spec_Config_HTTP{}, "gzip, br"))
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			AcceptEncoding: &corev1.Service_Spec_Config_HTTP_AcceptEncoding{
+				Mode: corev1.Service_Spec_Config_HTTP_AcceptEncoding_IDENTITY,
+			},
+		}
+		assert.Equal(t, "identity", doRequest(httpCfg, "gzip, br"))
+		assert.Equal(t, "identity", doRequest(httpCfg, ""))
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			StreamTransform: &corev1.Service_Spec_Config_HTTP_StreamTransform{
+				Rules: []*corev1.Service_Spec_Config_HTTP_StreamTransform_Rule{
+					{},
+				},
+			},
+		}
+		assert.Equal(t, "identity", doRequest(httpCfg, "gzip"))
+
+		httpCfg.AcceptEncoding = &corev1.Service_Spec_Config_HTTP_AcceptEncoding{
+			Mode: corev1.Service_Spec_Config_HTTP_AcceptEncoding_PRESERVE,
+		}
+		assert.Equal(t, "gzip", doRequest(httpCfg, "gzip"))
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			Visibility: &corev1.Service_Spec_Config_HTTP_Visibility{
+				EnableResponseBodyMap: true,
+			},
+		}
+		assert.Equal(t, "identity", doRequest(httpCfg, "gzip"))
+	}
+
+	{
+		getPlugin := func(isDisabled bool) *corev1.Service_Spec_Config_HTTP_Plugin {
+			return &corev1.Service_Spec_Config_HTTP_Plugin{
+				Name:       "ext-proc",
+				IsDisabled: isDisabled,
+				Type: &corev1.Service_Spec_Config_HTTP_Plugin_ExtProc_{
+					ExtProc: &corev1.Service_Spec_Config_HTTP_Plugin_ExtProc{
+						ProcessingMode: &corev1.Service_Spec_Config_HTTP_Plugin_ExtProc_ProcessingMode{
+							ResponseBodyMode: corev1.Service_Spec_Config_HTTP_Plugin_ExtProc_ProcessingMode_BUFFERED,
+						},
+					},
+				},
+			}
+		}
+
+		assert.Equal(t, "identity", doRequest(&corev1.Service_Spec_Config_HTTP{
+			Plugins: []*corev1.Service_Spec_Config_HTTP_Plugin{getPlugin(false)},
+		}, "gzip"))
+		assert.Equal(t, "gzip", doRequest(&corev1.Service_Spec_Config_HTTP{
+			Plugins: []*corev1.Service_Spec_Config_HTTP_Plugin{getPlugin(true)},
+		}, "gzip"))
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getCfg := func(size corev1.Service_Spec_Config_HTTP_BufferPool_Size) *corev1.Service_Spec_Config_HTTP {
+		return &corev1.Service_Spec_Config_HTTP{
+			BufferPool: &corev1.Service_Spec_Config_HTTP_BufferPool{
+				Size: size,
+			},
+		}
+	}
+
+	assert.Equal(t, bufferPoolSize, len(getBufferPool(nil).Get()))
+	assert.Equal(t, bufferPoolSize, len(getBufferPool(&corev1.Service_Spec_Config_HTTP{}).Get()))
+	assert.Equal(t, bufferPoolSizeSmall,
+		len(getBufferPool(getCfg(corev1.Service_Spec_Config_HTTP_BufferPool_SMALL)).Get()))
+	assert.Equal(t, bufferPoolSizeLarge,
+		len(getBufferPool(getCfg(corev1.Service_Spec_Config_HTTP_BufferPool_LARGE)).Get()))
+	assert.Equal(t, bufferPoolSize, len(getBufferPool(getCfg(100)).Get()))
+
+	assert.True(t, getBufferPool(getCfg(corev1.Service_Spec_Config_HTTP_BufferPool_SMALL)) ==
+		getBufferPool(getCfg(corev1.Service_Spec_Config_HTTP_BufferPool_SMALL)))
+}
+
+func BenchmarkBufferPool(b *testing.B) {
+	body := bytes.Repeat([]byte(`{"key":"value"}`), 32)
+
+	doCopy := func(b *testing.B, getPool func() *bufferPool) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			pool := getPool()
+			buf := pool.Get()
+			io.CopyBuffer(io.Discard, bytes.NewReader(body), buf)
+			pool.Put(buf)
+		}
+	}
+
+	b.Run("perRequest", func(b *testing.B) {
+		doCopy(b, func() *bufferPool {
+			return newBufferPool(bufferPoolSize)
+		})
+	})
+
+	b.Run("default", func(b *testing.B) {
+		doCopy(b, func() *bufferPool {
+			return getBufferPool(nil)
+		})
+	})
+
+	b.Run("small", func(b *testing.B) {
+		cfg := &corev1.Service_Spec_Config_HTTP{
+			BufferPool: &corev1.Service_Spec_Config_HTTP_BufferPool{
+				Size: corev1.Service_Spec_Config_HTTP_BufferPool_SMALL,
+			},
+		}
+		doCopy(b, func() *bufferPool {
+			return getBufferPool(cfg)
+		})
+	})
+}
+
+func TestNormalizeHeaderNames(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getHdr := func() http.Header {
+		return http.Header{
+			"X-Custom":              []string{"a"},
+			"x-custom":              []string{"b"},
+			"user-agent":            []string{"ua"},
+			"Sec-WebSocket-Key":     []string{"key"},
+			"sec-websocket-version": []string{"13"},
+		}
+	}
+
+	{
+		hdr := getHdr()
+		normalizeHeaderNames(hdr, false)
+		assert.Equal(t, http.Header{
+			"X-Custom":              []string{"a", "b"},
+			"User-Agent":            []string{"ua"},
+			"Sec-WebSocket-Key":     []string{"key"},
+			"Sec-WebSocket-Version": []string{"13"},
+		}, hdr)
+	}
+
+	{
+		hdr := getHdr()
+		normalizeHeaderNames(hdr, true)
+		assert.Equal(t, http.Header{
+			"X-Custom":              []string{"a", "b"},
+			"User-Agent":            []string{"ua"},
+			"Sec-Websocket-Key":     []string{"key"},
+			"Sec-Websocket-Version": []string{"13"},
+		}, hdr)
+	}
+
+	{
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		t.Cleanup(func() {
+			lis.Close()
+		})
+
+		fieldsCh := make(chan []hpack.HeaderField, 1)
+		go func() {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			if _, err := io.ReadFull(conn, make([]byte, len(http2.ClientPreface))); err != nil {
+				return
+			}
+
+			framer := http2.NewFramer(conn, conn)
+			framer.WriteSettings()
+
+			for {
+				frame, err := framer.ReadFrame()
+				if err != nil {
+					return
+				}
+
+				switch f := frame.(type) {
+				case *http2.SettingsFrame:
+					if !f.IsAck() {
+						framer.WriteSettingsAck()
+					}
+				case *http2.HeadersFrame:
+					fields, _ := hpack.NewDecoder(4096, nil).DecodeFull(f.HeaderBlockFragment())
+					fieldsCh <- fields
+
+					var buf bytes.Buffer
+					hpack.NewEncoder(&buf).WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+					framer.WriteHeaders(http2.HeadersFrameParam{
+						StreamID:      f.StreamID,
+						BlockFragment: buf.Bytes(),
+						EndStream:     true,
+						EndHeaders:    true,
+					})
+				}
+			}
+		}()
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/", lis.Addr().String()), nil)
+		assert.Nil(t, err)
+		req.Header = getHdr()
+		normalizeHeaderNames(req.Header, true)
+
+		transport := &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}
+		t.Cleanup(transport.CloseIdleConnections)
+
+		resp, err := transport.RoundTrip(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+
+		fields := <-fieldsCh
+
+		var custom []string
+		for _, field := range fields {
+			assert.Equal(t, strings.ToLower(field.Name), field.Name)
+			if field.Name == "x-custom" {
+				custom = append(custom, field.Value)
+			}
+		}
+		assert.Equal(t, []string{"a", "b"}, custom)
+		assert.True(t, slices.ContainsFunc(fields, func(field hpack.HeaderField) bool {
+			return field.Name == "sec-websocket-version" && field.Value == "13"
+		}))
+	}
+}
+
+func TestFollowRedirects(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	newResp := func(req *http.Request, code int, location string) *http.Response {
+		ret := &http.Response{
+			StatusCode: code,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(req.URL.Path)),
+			Request:    req,
+		}
+		if location != "" {
+			ret.Header.Set("Location", location)
+		}
+		return ret
+	}
+
+	newReq := func(method string, body io.Reader) *http.Request {
+		req, err := http.NewRequest(method, "http://api.local:8080/v1", body)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		return req
+	}
+
+	readBody := func(resp *http.Response) string {
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return string(body)
+	}
+
+	{
+		var paths []string
+		rt := &redirectRoundTripper{
+			maxRedirects: defaultMaxRedirects,
+			next: fanOutTestRoundTripper(func(req *http.Request) (*http.Response, error) {
+				paths = append(paths, req.URL.Path)
+				assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+				switch req.URL.Path {
+				case "/v1":
+					return newResp(req, http.StatusFound, "/v2#frag"), nil
+				case "/v2":
+					return newResp(req, http.StatusMovedPermanently, "http://api.local:8080/v3"), nil
+				default:
+					return newResp(req, http.StatusOK, ""), nil
+				}
+			}),
+		}
+
+		resp, err := rt.RoundTrip(newReq(http.MethodGet, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "/v3", readBody(resp))
+		assert.Equal(t, []string{"/v1", "/v2", "/v3"}, paths)
+	}
+
+	{
+		rt := &redirectRoundTripper{
+			maxRedirects: defaultMaxRedirects,
+			next: fanOutTestRoundTripper(func(req *http.Request) (*http.Response, error) {
+				switch req.URL.Path {
+				case "/v1":
+					return newResp(req, http.StatusFound, "/v2"), nil
+				default:
+					return newResp(req, http.StatusFound, "/v1"), nil
+				}
+			}),
+		}
+
+		_, err := rt.RoundTrip(newReq(http.MethodGet, nil))
+		assert.True(t, errors.Is(err, errRedirectLoop))
+	}
+
+	{
+		count := 0
+		rt := &redirectRoundTripper{
+			maxRedirects: 3,
+			next: fanOutTestRoundTripper(func(req *http.Request) (*http.Response, error) {
+				count++
+				return newResp(req, http.StatusFound, fmt.Sprintf("/v%d", count+1)), nil
+			}),
+		}
+
+		_, err := rt.RoundTrip(newReq(http.MethodGet, nil))
+		assert.True(t, errors.Is(err, errTooManyRedirects))
+		assert.Equal(t, 4, count)
+	}
+
+	{
+		var targets []string
+		rt := &redirectRoundTripper{
+			maxRedirects: defaultMaxRedirects,
+			allowedHosts: []string{"*.example.com", "files.local"},
+			next: fanOutTestRoundTripper(func(req *http.Request) (*http.Response, error) {
+				switch req.URL.Path {
+				case "/v1":
+					return newResp(req, http.StatusFound, "https://cdn.example.com/v2"), nil
+				case "/blocked":
+					return newResp(req, http.StatusFound, "http://169.254.169.254/latest/meta-data"), nil
+				case "/internal":
+					return newResp(req, http.StatusFound, "http://admin.local/"), nil
+				case "/suffix":
+					return newResp(req, http.StatusFound, "http://evilexample.com/"), nil
+				default:
+					return newResp(req, http.StatusFound, "file:///etc/passwd"), nil
+				}
+			}),
+			getRoundTripper: func(u *url.URL) (http.RoundTripper, error) {
+				targets = append(targets, u.Host)
+				return fanOutTestRoundTripper(func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "cdn.example.com", req.Host)
+					assert.Equal(t, "", req.Header.Get("Authorization"))
+					return newResp(req, http.StatusOK, ""), nil
+				}), nil
+			},
+		}
+
+		resp, err := rt.RoundTrip(newReq(http.MethodGet, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "/v2", readBody(resp))
+		assert.Equal(t, []string{"cdn.example.com"}, targets)
+
+		for _, pth := range []string{"/blocked", "/internal", "/suffix", "/scheme"} {
+			req := newReq(http.MethodGet, nil)
+			req.URL.Path = pth
+			resp, err := rt.RoundTrip(req)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusFound, resp.StatusCode)
+			assert.Equal(t, pth, readBody(resp))
+		}
+		assert.Equal(t, []string{"cdn.example.com"}, targets)
+	}
+
+	{
+		var targets []string
+		rt := &redirectRoundTripper{
+			maxRedirects:   defaultMaxRedirects,
+			allowedHosts:   []string{"*.example.com"},
+			sameOriginOnly: true,
+			next: fanOutTestRoundTripper(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "upstream-secret", req.Header.Get("X-Api-Key"))
+				switch req.URL.Path {
+				case "/v1":
+					return newResp(req, http.StatusFound, "/v2"), nil
+				case "/v2":
+					return newResp(req, http.StatusFound, "https://cdn.example.com/v3"), nil
+				default:
+					return newResp(req, http.StatusOK, ""), nil
+				}
+			}),
+			getRoundTripper: func(u *url.URL) (http.RoundTripper, error) {
+				targets = append(targets, u.Host)
+				return fanOutTestRoundTripper(func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "", req.Header.Get("X-Api-Key"))
+					return newResp(req, http.StatusOK, ""), nil
+				}), nil
+			},
+		}
+
+		req := newReq(http.MethodGet, nil)
+		req.Header.Set("X-Api-Key", "upstream-secret")
+		resp, err := rt.RoundTrip(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, "https://cdn.example.com/v3", resp.Header.Get("Location"))
+		assert.Equal(t, "/v2", readBody(resp))
+		assert.Len(t, targets, 0)
+	}
+
+	{
+		var methods []string
+		var bodies []string
+		rt := &redirectRoundTripper{
+			maxRedirects: defaultMaxRedirects,
+			next: fanOutTestRoundTripper(func(req *http.Request) (*http.Response, error) {
+				methods = append(methods, req.Method)
+				if req.Body != nil {
+					body, _ := io.ReadAll(req.Body)
+					bodies = append(bodies, string(body))
+				} else {
+					bodies = append(bodies, "")
+				}
+				switch req.URL.Path {
+				case "/v1":
+					return newResp(req, http.StatusTemporaryRedirect, "/v2"), nil
+				case "/v2":
+					return newResp(req, http.StatusSeeOther, "/v3"), nil
+				default:
+					return newResp(req, http.StatusOK, ""), nil
+				}
+			}),
+		}
+
+		resp, err := rt.RoundTrip(newReq(http.MethodPost, strings.NewReader("payload")))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []string{http.MethodPost, http.MethodPost, http.MethodGet}, methods)
+		assert.Equal(t, []string{"payload", "payload", ""}, bodies)
+
+		req := newReq(http.MethodPost, strings.NewReader("payload"))
+		req.GetBody = nil
+		resp, err = rt.RoundTrip(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	}
+
+	assert.True(t, isRedirectHostAllowed("API.example.com.", []string{"*.example.com"}))
+	assert.False(t, isRedirectHostAllowed("example.com", []string{"*.example.com"}))
+	assert.False(t, isRedirectHostAllowed("10.0.0.1", []string{"*.example.com"}))
+	assert.True(t, isRedirectHostAllowed("10.0.0.1", []string{"10.0.0.1"}))
+}
+
+func TestHostTemplate(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	newReqCtx := func(downstreamPath string) *middlewares.RequestContext {
+		ret := &middlewares.RequestContext{
+			Service: &corev1.Service{
+				Metadata: &metav1.Metadata{
+					Name: "api.tenants",
+				},
+				Spec: &corev1.Service_Spec{},
+				Status: &corev1.Service_Status{
+					NamespaceRef: &metav1.ObjectReference{
+						Name: "tenants",
+					},
+				},
+			},
+		}
+		if downstreamPath != "" {
+			ret.DownstreamRequest = &coctovigilv1.DownstreamRequest{
+				Request: &corev1.RequestContext_Request{
+					Type: &corev1.RequestContext_Request_Http{
+						Http: &corev1.RequestContext_Request_HTTP{
+							Path: downstreamPath,
+						},
+					},
+				},
+			}
+		}
+		return ret
+	}
+
+	newReq := func(target string, hdrs map[string]string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		assert.Nil(t, err)
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+
+	type tstCase struct {
+		tmpl           string
+		fallback       string
+		target         string
+		downstreamPath string
+		hdrs           map[string]string
+		expected       string
+	}
+
+	tstCases := []tstCase{
+		{
+			tmpl:     "{header.X-Tenant}.tenants.internal",
+			target:   "http://upstream.local:8080/v1",
+			hdrs:     map[string]string{"X-Tenant": "acme"},
+			expected: "acme.tenants.internal",
+		},
+		{
+			tmpl:     "{path.0}.tenants.internal:8443",
+			target:   "http://upstream.local:8080/acme/v1/items",
+			expected: "acme.tenants.internal:8443",
+		},
+		{
+			// The downstream path is used before being rewritten
+			tmpl:           "{path.1}.tenants.internal",
+			target:         "http://upstream.local:8080/items",
+			downstreamPath: "/t/acme/items",
+			expected:       "acme.tenants.internal",
+		},
+		{
+			tmpl:     "{query.tenant}-{service}.{namespace}.svc",
+			target:   "http://upstream.local:8080/?tenant=acme",
+			expected: "acme-api.tenants.svc",
+		},
+		{
+			tmpl:     "{header.X-Tenant}.tenants.internal",
+			target:   "http://upstream.local:8080/v1",
+			expected: "upstream.local:8080",
+		},
+		{
+			tmpl:     "{header.X-Tenant}.tenants.internal",
+			fallback: "default.tenants.internal",
+			target:   "http://upstream.local:8080/v1",
+			expected: "default.tenants.internal",
+		},
+		{
+			tmpl:     "{path.5}.tenants.internal",
+			target:   "http://upstream.local:8080/acme",
+			expected: "upstream.local:8080",
+		},
+		{
+			tmpl:     "{header.X-Tenant}.tenants.internal",
+			target:   "http://upstream.local:8080/v1",
+			hdrs:     map[string]string{"X-Tenant": "evil.com/"},
+			expected: "upstream.local:8080",
+		},
+		{
+			tmpl:     "{header.X-Tenant}.tenants.internal",
+			target:   "http://upstream.local:8080/v1",
+			hdrs:     map[string]string{"X-Tenant": "evil.com@attacker"},
+			expected: "upstream.local:8080",
+		},
+		{
+			tmpl:     "{header.X-Tenant}.tenants.internal",
+			target:   "http://upstream.local:8080/v1",
+			hdrs:     map[string]string{"X-Tenant": ".."},
+			expected: "upstream.local:8080",
+		},
+		{
+			tmpl:     "{header.X-Tenant.tenants.internal",
+			target:   "http://upstream.local:8080/v1",
+			hdrs:     map[string]string{"X-Tenant": "acme"},
+			expected: "upstream.local:8080",
+		},
+		{
+			tmpl:     "{unknown}.tenants.internal",
+			target:   "http://upstream.local:8080/v1",
+			expected: "upstream.local:8080",
+		},
+	}
+
+	for i, tstCase := range tstCases {
+		outReq := newReq(tstCase.target, tstCase.hdrs)
+		host := getTemplatedHost(&corev1.Service_Spec_Config_HTTP_Header_Host_Template{
+			Value:    tstCase.tmpl,
+			Fallback: tstCase.fallback,
+		}, outReq, newReqCtx(tstCase.downstreamPath), "upstream.local:8080")
+		assert.Equal(t, tstCase.expected, host, "case %d", i)
+		// The dial target does not depend on the Host
+		assert.Equal(t, "upstream.local:8080", outReq.URL.Host, "case %d", i)
+	}
+}
+
+func TestRequestCompression(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	type received struct {
+		header        http.Header
+		contentLength int64
+		body          []byte
+	}
+
+	recvCh := make(chan *received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		recvCh <- &received{
+			header:        r.Header.Clone(),
+			contentLength: r.ContentLength,
+			body:          body,
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	send := func(contentType string, body []byte,
+		cfg *corev1.Service_Spec_Config_HTTP_RequestCompression) ([]byte, *received) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+		assert.Nil(t, err)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		sent := compressRequestBody(req, body, cfg)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+
+		return sent, <-recvCh
+	}
+
+	body := []byte(strings.Repeat(`{"key":"value"},`, 256))
+	cfg := &corev1.Service_Spec_Config_HTTP_RequestCompression{
+		IsEnabled: true,
+	}
+
+	{
+		sent, recv := send("application/json; charset=utf-8", body, cfg)
+		assert.Equal(t, "gzip", recv.header.Get("Content-Encoding"))
+		assert.Equal(t, int64(len(recv.body)), recv.contentLength)
+		assert.Empty(t, recv.header.Get("Transfer-Encoding"))
+		assert.Less(t, len(recv.body), len(body))
+
+		// The signed payload hash must be the hash of the bytes received by
+		// the upstream.
+		assert.Equal(t, sha256.Sum256(recv.body), sha256.Sum256(sent))
+
+		zr, err := gzip.NewReader(bytes.NewReader(recv.body))
+		assert.Nil(t, err)
+		decompressed, err := io.ReadAll(zr)
+		assert.Nil(t, err)
+		assert.Equal(t, body, decompressed)
+	}
+
+	{
+		sent, recv := send("application/vnd.api+json", body, cfg)
+		assert.Equal(t, "gzip", recv.header.Get("Content-Encoding"))
+		assert.Equal(t, recv.body, sent)
+	}
+
+	for _, tstCase := range []struct {
+		contentType string
+		body        []byte
+		cfg         *corev1.Service_Spec_Config_HTTP_RequestCompression
+	}{
+		{
+			contentType: "application/json",
+			body:        body,
+		},
+		{
+			contentType: "application/json",
+			body:        body,
+			cfg:         &corev1.Service_Spec_Config_HTTP_RequestCompression{},
+		},
+		{
+			contentType: "application/json",
+			body:        body[:512],
+			cfg:         cfg,
+		},
+		{
+			contentType: "image/png",
+			body:        body,
+			cfg:         cfg,
+		},
+		{
+			body: body,
+			cfg:  cfg,
+		},
+		{
+			contentType: "application/json",
+			body:        body,
+			cfg: &corev1.Service_Spec_Config_HTTP_RequestCompression{
+				IsEnabled:    true,
+				ContentTypes: []string{"text/*"},
+			},
+		},
+		{
+			contentType: "application/octet-stream",
+			body:        utilrand.GetRandomBytesMust(2048),
+			cfg: &corev1.Service_Spec_Config_HTTP_RequestCompression{
+				IsEnabled:    true,
+				ContentTypes: []string{"application/octet-stream"},
+				MinSize:      16,
+			},
+		},
+	} {
+		sent, recv := send(tstCase.contentType, tstCase.body, tstCase.cfg)
+		assert.Empty(t, recv.header.Get("Content-Encoding"))
+		assert.Equal(t, tstCase.body, recv.body)
+		assert.Equal(t, tstCase.body, sent)
+		assert.Equal(t, int64(len(tstCase.body)), recv.contentLength)
+	}
+
+	{
+		req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+		assert.Nil(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "br")
+		assert.Equal(t, body, compressRequestBody(req, body, cfg))
+		assert.Equal(t, "br", req.Header.Get("Content-Encoding"))
+	}
+
+	{
+		for _, tstCase := range []struct {
+			pattern  string
+			typ      string
+			expected bool
+		}{
+			{"text/*", "text/plain", true},
+			{"text/*", "application/text", false},
+			{"application/*+json", "application/problem+json", true},
+			{"application/*+json", "application/json", false},
+			{"application/json", "application/json", true},
+			{"application/json", "application/jsonx", false},
+		} {
+			assert.Equal(t, tstCase.expected, matchMediaType(tstCase.pattern, tstCase.typ), "%+v", tstCase)
+		}
+	}
+}
+
+func TestUpstreamOrigin(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	for i, tstCase := range []struct {
+		cfg         *corev1.Service_Spec_Config_HTTP_Header_Origin
+		upstreamURL string
+		scheme      string
+		origin      string
+		expected    []string
+	}{
+		{
+			upstreamURL: "https://upstream.local",
+			scheme:      "https",
+			origin:      "https://app.example.com",
+			expected:    []string{"https://app.example.com"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Origin{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Origin_PRESERVE,
+			},
+			upstreamURL: "https://upstream.local",
+			scheme:      "https",
+			origin:      "https://app.example.com",
+			expected:    []string{"https://app.example.com"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Origin{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Origin_REWRITE,
+			},
+			upstreamURL: "https://upstream.local:8443",
+			scheme:      "https",
+			origin:      "https://app.example.com",
+			expected:    []string{"https://upstream.local:8443"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Origin{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Origin_REWRITE,
+			},
+			upstreamURL: "wss://ws.upstream.local",
+			scheme:      "https",
+			origin:      "https://app.example.com",
+			expected:    []string{"https://ws.upstream.local"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Origin{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Origin_REWRITE,
+			},
+			upstreamURL: "https://upstream.local",
+			scheme:      "https",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Origin{
+				Mode:  corev1.Service_Spec_Config_HTTP_Header_Origin_FIXED,
+				Value: "https://trusted.example.com",
+			},
+			upstreamURL: "ws://ws.upstream.local",
+			scheme:      "http",
+			origin:      "https://app.example.com",
+			expected:    []string{"https://trusted.example.com"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Origin{
+				Mode:  corev1.Service_Spec_Config_HTTP_Header_Origin_FIXED,
+				Value: "https://trusted.example.com",
+			},
+			upstreamURL: "ws://ws.upstream.local",
+			scheme:      "http",
+			expected:    []string{"https://trusted.example.com"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Origin{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Origin_STRIP,
+			},
+			upstreamURL: "https://upstream.local",
+			scheme:      "https",
+			origin:      "https://app.example.com",
+		},
+	} {
+		upstreamURL, err := url.Parse(tstCase.upstreamURL)
+		assert.Nil(t, err)
+
+		outReq := httptest.NewRequest(http.MethodGet, "http://svc.example.com/ws", nil)
+		outReq.URL.Scheme = tstCase.scheme
+		if tstCase.origin != "" {
+			outReq.Header.Set("Origin", tstCase.origin)
+		}
+
+		setUpstreamOrigin(outReq, upstreamURL, tstCase.cfg)
+		assert.Equal(t, tstCase.expected, outReq.Header.Values("Origin"), "case %d", i)
+	}
+}
+
+func TestUpstreamQuery(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	var rawQuery string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+	}))
+	t.Cleanup(upstream.Close)
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	assert.Nil(t, err)
+
+	for i, tstCase := range []struct {
+		cfg       *corev1.Service_Spec_Config_HTTP_URI
+		query     string
+		parseForm bool
+		expected  string
+	}{
+		{
+			query:    "a=1;b=2&c=3",
+			expected: "a=1&b=2&c=3",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_URI{
+				Semicolon: corev1.Service_Spec_Config_HTTP_URI_REPLACE,
+			},
+			query:     "a=1;b=2",
+			parseForm: true,
+			expected:  "a=1&b=2",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_URI{
+				Semicolon: corev1.Service_Spec_Config_HTTP_URI_PRESERVE,
+			},
+			query:    "a=1;b=2&c=3",
+			expected: "a=1;b=2&c=3",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_URI{
+				Semicolon: corev1.Service_Spec_Config_HTTP_URI_PRESERVE,
+			},
+			query:     "matrix=x;y=z&c=3",
+			parseForm: true,
+			expected:  "matrix=x;y=z&c=3",
+		},
+	} {
+		proxy := &httputil.ReverseProxy{
+			Director: func(outReq *http.Request) {
+				outReq.URL.Scheme = upstreamURL.Scheme
+				outReq.URL.Host = upstreamURL.Host
+				setUpstreamQuery(outReq, tstCase.cfg)
+			},
+		}
+
+		rawQuery = ""
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/?"+tstCase.query, nil)
+		if tstCase.parseForm {
+			req.ParseForm()
+		}
+
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code, "case %d", i)
+		assert.Equal(t, tstCase.expected, rawQuery, "case %d", i)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	body := "{\n  \"a\": [1, 2],\n  \"b\": {\"c\": \"d e\"}\n}"
+	minified := `{"a":[1,2],"b":{"c":"d e"}}`
+	pretty := "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {\n    \"c\": \"d e\"\n  }\n}"
+
+	newResp := func(contentType, body string, reqHeader http.Header) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		if reqHeader != nil {
+			req.Header = reqHeader
+		}
+		ret := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}
+		ret.Header.Set("Content-Type", contentType)
+		ret.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		return ret
+	}
+
+	readBody := func(resp *http.Response) string {
+		ret, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(ret)
+	}
+
+	{
+		resp := newResp("application/json; charset=utf-8", body, nil)
+		resp.Header.Set("ETag", `"abc"`)
+		err := formatJSONResponse(resp, &corev1.Service_Spec_Config_HTTP_JSONFormat{
+			Mode: corev1.Service_Spec_Config_HTTP_JSONFormat_MINIFY,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, minified, readBody(resp))
+		assert.Equal(t, int64(len(minified)), resp.ContentLength)
+		assert.Equal(t, fmt.Sprintf("%d", len(minified)), resp.Header.Get("Content-Length"))
+		assert.Equal(t, `W/"abc"`, resp.Header.Get("ETag"))
+	}
+
+	{
+		resp := newResp("application/problem+json", minified, nil)
+		err := formatJSONResponse(resp, &corev1.Service_Spec_Config_HTTP_JSONFormat{
+			Mode: corev1.Service_Spec_Config_HTTP_JSONFormat_PRETTY,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, pretty, readBody(resp))
+		assert.Equal(t, int64(len(pretty)), resp.ContentLength)
+	}
+
+	{
+		cfg := &corev1.Service_Spec_Config_HTTP_JSONFormat{
+			Header: "X-JSON-Format",
+		}
+
+		resp := newResp("application/json", minified, http.Header{
+			"X-Json-Format": []string{"pretty"},
+		})
+		assert.Nil(t, formatJSONResponse(resp, cfg))
+		assert.Equal(t, pretty, readBody(resp))
+
+		resp = newResp("application/json", body, http.Header{
+			"X-Json-Format": []string{"Minify"},
+		})
+		assert.Nil(t, formatJSONResponse(resp, cfg))
+		assert.Equal(t, minified, readBody(resp))
+
+		// Without the header, the mode is unset.
+		resp = newResp("application/json", body, nil)
+		assert.Nil(t, formatJSONResponse(resp, cfg))
+		assert.Equal(t, body, readBody(resp))
+
+		// The header overrides the configured mode.
+		resp = newResp("application/json", body, http.Header{
+			"X-Json-Format": []string{"pretty"},
+		})
+		assert.Nil(t, formatJSONResponse(resp, &corev1.Service_Spec_Config_HTTP_JSONFormat{
+			Mode:   corev1.Service_Spec_Config_HTTP_JSONFormat_MINIFY,
+			Header: "X-JSON-Format",
+		}))
+		assert.Equal(t, pretty, readBody(resp))
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_JSONFormat{
+		Mode:    corev1.Service_Spec_Config_HTTP_JSONFormat_MINIFY,
+		MaxSize: 64,
+	}
+
+	{
+		// Bodies larger than the max size are forwarded as is.
+		large := fmt.Sprintf(`{"a": "%s"}`, strings.Repeat("x", 64))
+		resp := newResp("application/json", large, nil)
+		assert.Nil(t, formatJSONResponse(resp, cfg))
+		assert.Equal(t, large, readBody(resp))
+		assert.Equal(t, int64(len(large)), resp.ContentLength)
+	}
+
+	{
+		// Bodies of unknown length might be streamed.
+		resp := newResp("application/json", body, nil)
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+		assert.Nil(t, formatJSONResponse(resp, cfg))
+		assert.Equal(t, body, readBody(resp))
+	}
+
+	for _, contentType := range []string{"application/x-ndjson", "text/event-stream", "text/plain"} {
+		resp := newResp(contentType, body, nil)
+		assert.Nil(t, formatJSONResponse(resp, cfg))
+		assert.Equal(t, body, readBody(resp))
+	}
+
+	{
+		resp := newResp("application/json", body, nil)
+		resp.Header.Set("Content-Encoding", "gzip")
+		assert.Nil(t, formatJSONResponse(resp, cfg))
+		assert.Equal(t, body, readBody(resp))
+	}
+
+	{
+		invalid := `{"a": 1,`
+		resp := newResp("application/json", invalid, nil)
+		assert.Nil(t, formatJSONResponse(resp, cfg))
+		assert.Equal(t, invalid, readBody(resp))
+		assert.Equal(t, int64(len(invalid)), resp.ContentLength)
+	}
+
+	{
+		outReq := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		outReq.Header.Set("Accept-Encoding", "gzip")
+		outReq.Header.Set("X-JSON-Format", "pretty")
+		setUpstreamAcceptEncoding(outReq, &corev1.Service_Spec_Config_HTTP{
+			JsonFormat: &corev1.Service_Spec_Config_HTTP_JSONFormat{
+				Header: "X-JSON-Format",
+			},
+		})
+		assert.Equal(t, "identity", outReq.Header.Get("Accept-Encoding"))
+	}
+}
+
+func TestResponseETag(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	body := "static content"
+
+	newResp := func(method string, reqHeader http.Header) *http.Response {
+		req := httptest.NewRequest(method, "http://localhost/", nil)
+		if reqHeader != nil {
+			req.Header = reqHeader
+		}
+		ret := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}
+		ret.Header.Set("Content-Type", "text/plain")
+		ret.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		return ret
+	}
+
+	readBody := func(resp *http.Response) string {
+		ret, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(ret)
+	}
+
+	cfg := &corev1.Service_Spec_Config_HTTP_ETag{
+		IsEnabled: true,
+	}
+
+	var etag string
+	{
+		resp := newResp(http.MethodGet, nil)
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		etag = resp.Header.Get("ETag")
+		assert.True(t, strings.HasPrefix(etag, `"`))
+		assert.True(t, strings.HasSuffix(etag, `"`))
+		assert.Equal(t, 34, len(etag))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, body, readBody(resp))
+		assert.Equal(t, int64(len(body)), resp.ContentLength)
+	}
+
+	{
+		// The ETag is deterministic.
+		resp := newResp(http.MethodGet, nil)
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, etag, resp.Header.Get("ETag"))
+	}
+
+	{
+		resp := newResp(http.MethodGet, nil)
+		err := setResponseETag(resp, &corev1.Service_Spec_Config_HTTP_ETag{
+			IsEnabled: true,
+			IsWeak:    true,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "W/"+etag, resp.Header.Get("ETag"))
+	}
+
+	for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		resp := newResp(http.MethodGet, http.Header{
+			"If-None-Match": []string{inm},
+		})
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode, "%s", inm)
+		assert.Equal(t, etag, resp.Header.Get("ETag"))
+		assert.Equal(t, "", resp.Header.Get("Content-Length"))
+		assert.Equal(t, int64(0), resp.ContentLength)
+		assert.Equal(t, "", readBody(resp))
+	}
+
+	{
+		resp := newResp(http.MethodGet, http.Header{
+			"If-None-Match": []string{`"other"`},
+		})
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, etag, resp.Header.Get("ETag"))
+		assert.Equal(t, body, readBody(resp))
+	}
+
+	{
+		// The upstream ETag is kept.
+		resp := newResp(http.MethodGet, http.Header{
+			"If-None-Match": []string{`"upstream"`},
+		})
+		resp.Header.Set("ETag", `"upstream"`)
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `"upstream"`, resp.Header.Get("ETag"))
+		assert.Equal(t, body, readBody(resp))
+	}
+
+	{
+		resp := newResp(http.MethodGet, nil)
+		resp.Header.Set("Cache-Control", "private, no-store")
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, "", resp.Header.Get("ETag"))
+	}
+
+	{
+		resp := newResp(http.MethodPost, nil)
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, "", resp.Header.Get("ETag"))
+	}
+
+	{
+		resp := newResp(http.MethodGet, nil)
+		resp.StatusCode = http.StatusNotFound
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, "", resp.Header.Get("ETag"))
+	}
+
+	{
+		// Streamed responses are not buffered.
+		resp := newResp(http.MethodGet, nil)
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+		err := setResponseETag(resp, cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, "", resp.Header.Get("ETag"))
+		assert.Equal(t, body, readBody(resp))
+	}
+
+	{
+		resp := newResp(http.MethodGet, nil)
+		err := setResponseETag(resp, &corev1.Service_Spec_Config_HTTP_ETag{
+			IsEnabled: true,
+			MaxSize:   4,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "", resp.Header.Get("ETag"))
+		assert.Equal(t, body, readBody(resp))
+	}
+
+	{
+		resp := newResp(http.MethodGet, nil)
+		err := setResponseETag(resp, &corev1.Service_Spec_Config_HTTP_ETag{})
+		assert.Nil(t, err)
+		assert.Equal(t, "", resp.Header.Get("ETag"))
+	}
+}
+
+func TestResponseContentType(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	newResp := func(statusCode int, contentType string, contentLength int64) *http.Response {
+		ret := &http.Response{
+			StatusCode:    statusCode,
+			Header:        http.Header{},
+			Body:          http.NoBody,
+			ContentLength: contentLength,
+			Request:       httptest.NewRequest(http.MethodGet, "http://localhost/", nil),
+		}
+		if contentType != "" {
+			ret.Header.Set("Content-Type", contentType)
+		}
+		return ret
+	}
+
+	allowed := []string{"application/json", "image/*"}
+
+	for i, tstCase := range []struct {
+		cfg           *corev1.Service_Spec_Config_HTTP_ResponseContentType
+		statusCode    int
+		contentType   string
+		contentLength int64
+		isBlocked     bool
+		expected      string
+	}{
+		{
+			statusCode:  http.StatusOK,
+			contentType: "text/html",
+			expected:    "text/html",
+		},
+		{
+			cfg:         &corev1.Service_Spec_Config_HTTP_ResponseContentType{},
+			statusCode:  http.StatusOK,
+			contentType: "text/html",
+			expected:    "text/html",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: allowed,
+			},
+			statusCode:  http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			expected:    "application/json; charset=utf-8",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: allowed,
+			},
+			statusCode:  http.StatusOK,
+			contentType: "Image/PNG",
+			expected:    "Image/PNG",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: allowed,
+			},
+			statusCode:  http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			isBlocked:   true,
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: allowed,
+				Action:  corev1.Service_Spec_Config_HTTP_ResponseContentType_BLOCK,
+			},
+			statusCode:  http.StatusNotFound,
+			contentType: "text/html",
+			isBlocked:   true,
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: allowed,
+			},
+			statusCode:    http.StatusOK,
+			contentLength: -1,
+			isBlocked:     true,
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: []string{"application/octet-stream"},
+			},
+			statusCode:    http.StatusOK,
+			contentLength: 10,
+			expected:      "application/octet-stream",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: allowed,
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: allowed,
+			},
+			statusCode:  http.StatusNotModified,
+			contentType: "text/html",
+			expected:    "text/html",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed: allowed,
+				Action:  corev1.Service_Spec_Config_HTTP_ResponseContentType_OVERRIDE,
+			},
+			statusCode:  http.StatusOK,
+			contentType: "text/html",
+			expected:    "application/octet-stream",
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_ResponseContentType{
+				Allowed:  allowed,
+				Action:   corev1.Service_Spec_Config_HTTP_ResponseContentType_OVERRIDE,
+				Override: "text/plain; charset=utf-8",
+			},
+			statusCode:  http.StatusOK,
+			contentType: "text/html",
+			expected:    "text/plain; charset=utf-8",
+		},
+	} {
+		resp := newResp(tstCase.statusCode, tstCase.contentType, tstCase.contentLength)
+		err := checkResponseContentType(resp, tstCase.cfg)
+		if tstCase.isBlocked {
+			assert.True(t, errors.Is(err, errContentTypeNotAllowed), "case %d", i)
+			continue
+		}
+
+		assert.Nil(t, err, "case %d", i)
+		assert.Equal(t, tstCase.expected, resp.Header.Get("Content-Type"), "case %d", i)
+		if tstCase.cfg.GetAction() == corev1.Service_Spec_Config_HTTP_ResponseContentType_OVERRIDE {
+			assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"), "case %d", i)
+		}
+	}
+
+	assert.Equal(t, http.StatusBadGateway, getContentTypeBlockedStatusCode(nil))
+	assert.Equal(t, http.StatusBadGateway, getContentTypeBlockedStatusCode(
+		&corev1.Service_Spec_Config_HTTP_ResponseContentType{
+			StatusCode: 200,
+		}))
+	assert.Equal(t, http.StatusUnsupportedMediaType, getContentTypeBlockedStatusCode(
+		&corev1.Service_Spec_Config_HTTP_ResponseContentType{
+			StatusCode: http.StatusUnsupportedMediaType,
+		}))
+}
+
+func TestResponseBuffering(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	// The upstream writes the whole response and closes its connection right
+	// away without a Content-Length unless set by the response itself.
+	upstreamLis, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		upstreamLis.Close()
+	})
+
+	var upstreamResp atomic.Value
+	go func() {
+		for {
+			c, err := upstreamLis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				http.ReadRequest(bufio.NewReader(c))
+				c.Write([]byte(upstreamResp.Load().(string)))
+			}()
+		}
+	}()
+
+	var cfg *corev1.Service_Spec_Config_HTTP_ResponseBuffering
+	proxy := &httputil.ReverseProxy{
+		Director: func(outReq *http.Request) {
+			outReq.URL.Scheme = "http"
+			outReq.URL.Host = upstreamLis.Addr().String()
+		},
+		ModifyResponse: func(r *http.Response) error {
+			return bufferResponse(r, cfg)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+
+	doReq := func(resp string) (*http.Response, string) {
+		upstreamResp.Store(resp)
+		res, err := http.Get(srv.URL)
+		assert.Nil(t, err)
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res, string(body)
+	}
+
+	body := strings.Repeat("a", 64)
+	closeDelimited := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nConnection: close\r\n\r\n" + body
+
+	{
+		res, resBody := doReq(closeDelimited)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int64(-1), res.ContentLength)
+		assert.Equal(t, body, resBody)
+	}
+
+	cfg = &corev1.Service_Spec_Config_HTTP_ResponseBuffering{
+		IsEnabled: true,
+	}
+
+	{
+		res, resBody := doReq(closeDelimited)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int64(len(body)), res.ContentLength)
+		assert.Equal(t, body, resBody)
+	}
+
+	{
+		res, resBody := doReq("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int64(11), res.ContentLength)
+		assert.Equal(t, "hello world", resBody)
+	}
+
+	{
+		// The truncated body is not relayed as a successful response.
+		res, _ := doReq("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 100\r\n\r\n" + body)
+		assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+	}
+
+	{
+		res, resBody := doReq("HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\nConnection: close\r\n\r\n" + body)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int64(-1), res.ContentLength)
+		assert.Equal(t, body, resBody)
+	}
+
+	cfg = &corev1.Service_Spec_Config_HTTP_ResponseBuffering{
+		IsEnabled: true,
+		MaxSize:   16,
+	}
+
+	{
+		// Larger bodies are streamed as is.
+		res, resBody := doReq(closeDelimited)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int64(-1), res.ContentLength)
+		assert.Equal(t, body, resBody)
+	}
+
+	{
+		res, resBody := doReq("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nConnection: close\r\n\r\nsmall")
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int64(5), res.ContentLength)
+		assert.Equal(t, "small", resBody)
+	}
+}
+
+func TestServerHeader(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	for i, tstCase := range []struct {
+		cfg              *corev1.Service_Spec_Config_HTTP_Header_Server
+		upstream         string
+		expectedUpstream []string
+		expectedLocal    []string
+	}{
+		{
+			upstream:         "nginx",
+			expectedUpstream: []string{"octelium"},
+			expectedLocal:    []string{"octelium"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Server{
+				Mode:  corev1.Service_Spec_Config_HTTP_Header_Server_CUSTOM,
+				Value: "my-gateway",
+			},
+			upstream:         "nginx",
+			expectedUpstream: []string{"my-gateway"},
+			expectedLocal:    []string{"my-gateway"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Server{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Server_CUSTOM,
+			},
+			expectedUpstream: []string{"octelium"},
+			expectedLocal:    []string{"octelium"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Server{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Server_PRESERVE,
+			},
+			upstream:         "nginx",
+			expectedUpstream: []string{"nginx"},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Server{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Server_PRESERVE,
+			},
+		},
+		{
+			cfg: &corev1.Service_Spec_Config_HTTP_Header_Server{
+				Mode: corev1.Service_Spec_Config_HTTP_Header_Server_REMOVE,
+			},
+			upstream: "nginx",
+		},
+	} {
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			Header: &corev1.Service_Spec_Config_HTTP_Header{
+				Server: tstCase.cfg,
+			},
+		}
+
+		{
+			hdr := http.Header{}
+			if tstCase.upstream != "" {
+				hdr.Set("Server", tstCase.upstream)
+			}
+			middlewares.SetServerHeader(hdr, httpCfg)
+			assert.Equal(t, tstCase.expectedUpstream, hdr.Values("Server"), "case %d", i)
+		}
+
+		{
+			handler := &directResponseHandler{
+				direct: &corev1.Service_Spec_Config_HTTP_Response_Direct{
+					Type: &corev1.Service_Spec_Config_HTTP_Response_Direct_Inline{
+						Inline: "hello",
+					},
+				},
+				httpCfg: httpCfg,
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://localhost/", nil))
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, "hello", rw.Body.String())
+			assert.Equal(t, tstCase.expectedLocal, rw.Header().Values("Server"), "case %d", i)
+		}
+
+		{
+			rw := httptest.NewRecorder()
+			writeErrorResponse(rw, httptest.NewRequest(http.MethodGet, "http://localhost/", nil),
+				httpCfg, http.StatusBadGateway)
+			assert.Equal(t, http.StatusBadGateway, rw.Code)
+			assert.Equal(t, tstCase.expectedLocal, rw.Header().Values("Server"), "case %d", i)
+		}
+
+		{
+			rw := httptest.NewRecorder()
+			middlewares.WriteLimitedResponse(rw, httptest.NewRequest(http.MethodGet, "http://localhost/", nil),
+				httpCfg, middlewares.LimitedRateLimit, http.StatusTooManyRequests, nil, nil)
+			assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+			assert.Equal(t, tstCase.expectedLocal, rw.Header().Values("Server"), "case %d", i)
+		}
+	}
+}
+
+func TestHeadResponseHeaders(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	body := `{"a": 1, "b": [1, 2, 3]}`
+
+	newResp := func(method string, contentType string) *http.Response {
+		ret := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       httptest.NewRequest(method, "http://localhost/", nil),
+		}
+		if method == http.MethodHead {
+			ret.Body = http.NoBody
+		}
+		ret.Header.Set("Content-Type", contentType)
+		ret.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		return ret
+	}
+
+	// doResponse returns the response headers after the same processing as
+	// the ModifyResponse of the proxy.
+	doResponse := func(method string, contentType string, httpCfg *corev1.Service_Spec_Config_HTTP) http.Header {
+		resp := newResp(method, contentType)
+		transformResponseStream(resp, httpCfg.GetStreamTransform())
+		err := formatJSONResponse(resp, httpCfg.GetJsonFormat())
+		assert.Nil(t, err)
+		setHeadResponseHeaders(resp, httpCfg)
+		return resp.Header
+	}
+
+	streamTransform := &corev1.Service_Spec_Config_HTTP_StreamTransform{
+		Rules: []*corev1.Service_Spec_Config_HTTP_StreamTransform_Rule{
+			{
+				ContentTypes: []string{"application/x-ndjson"},
+				Type: &corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_NdjsonRedact{
+					NdjsonRedact: &corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_NDJSONRedact{
+						Fields: []string{"a"},
+					},
+				},
+			},
+		},
+	}
+
+	jsonFormat := &corev1.Service_Spec_Config_HTTP_JSONFormat{
+		Mode: corev1.Service_Spec_Config_HTTP_JSONFormat_MINIFY,
+	}
+
+	{
+		// The GET response is left intact and so is the HEAD Content-Length.
+		httpCfg := &corev1.Service_Spec_Config_HTTP{}
+		get := doResponse(http.MethodGet, "application/json", httpCfg)
+		head := doResponse(http.MethodHead, "application/json", httpCfg)
+		assert.Equal(t, fmt.Sprintf("%d", len(body)), get.Get("Content-Length"))
+		assert.Equal(t, get.Get("Content-Length"), head.Get("Content-Length"))
+	}
+
+	{
+		// The GET response is streamed without a Content-Length.
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			StreamTransform: streamTransform,
+		}
+		get := doResponse(http.MethodGet, "application/x-ndjson", httpCfg)
+		head := doResponse(http.MethodHead, "application/x-ndjson", httpCfg)
+		assert.Equal(t, "", get.Get("Content-Length"))
+		assert.Equal(t, "", head.Get("Content-Length"))
+
+		// The rule does not match the content type.
+		get = doResponse(http.MethodGet, "application/json", httpCfg)
+		head = doResponse(http.MethodHead, "application/json", httpCfg)
+		assert.Equal(t, fmt.Sprintf("%d", len(body)), get.Get("Content-Length"))
+		assert.Equal(t, get.Get("Content-Length"), head.Get("Content-Length"))
+	}
+
+	{
+		// The minified GET body length cannot be known from the HEAD response.
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			JsonFormat: jsonFormat,
+		}
+		get := doResponse(http.MethodGet, "application/json", httpCfg)
+		head := doResponse(http.MethodHead, "application/json", httpCfg)
+		assert.NotEqual(t, fmt.Sprintf("%d", len(body)), get.Get("Content-Length"))
+		assert.Equal(t, "", head.Get("Content-Length"))
+
+		get = doResponse(http.MethodGet, "text/plain", httpCfg)
+		head = doResponse(http.MethodHead, "text/plain", httpCfg)
+		assert.Equal(t, fmt.Sprintf("%d", len(body)), get.Get("Content-Length"))
+		assert.Equal(t, get.Get("Content-Length"), head.Get("Content-Length"))
+	}
+
+	{
+		// The bodies larger than the max size are left intact.
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			JsonFormat: &corev1.Service_Spec_Config_HTTP_JSONFormat{
+				Mode:    corev1.Service_Spec_Config_HTTP_JSONFormat_MINIFY,
+				MaxSize: 4,
+			},
+		}
+		get := doResponse(http.MethodGet, "application/json", httpCfg)
+		head := doResponse(http.MethodHead, "application/json", httpCfg)
+		assert.Equal(t, fmt.Sprintf("%d", len(body)), get.Get("Content-Length"))
+		assert.Equal(t, get.Get("Content-Length"), head.Get("Content-Length"))
+	}
+
+	{
+		// Encoded bodies are not transformed.
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			JsonFormat: jsonFormat,
+		}
+		resp := newResp(http.MethodHead, "application/json")
+		resp.Header.Set("Content-Encoding", "gzip")
+		setHeadResponseHeaders(resp, httpCfg)
+		assert.Equal(t, fmt.Sprintf("%d", len(body)), resp.Header.Get("Content-Length"))
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			JsonFormat: jsonFormat,
+			HeadResponse: &corev1.Service_Spec_Config_HTTP_HeadResponse{
+				Mode: corev1.Service_Spec_Config_HTTP_HeadResponse_PRESERVE,
+			},
+		}
+		head := doResponse(http.MethodHead, "application/json", httpCfg)
+		assert.Equal(t, fmt.Sprintf("%d", len(body)), head.Get("Content-Length"))
+	}
+
+	{
+		httpCfg := &corev1.Service_Spec_Config_HTTP{
+			HeadResponse: &corev1.Service_Spec_Config_HTTP_HeadResponse{
+				Mode: corev1.Service_Spec_Config_HTTP_HeadResponse_OMIT,
+			},
+		}
+		head := doResponse(http.MethodHead, "text/plain", httpCfg)
+		assert.Equal(t, "", head.Get("Content-Length"))
+
+		// Only the HEAD responses are affected.
+		get := doResponse(http.MethodGet, "text/plain", httpCfg)
+		assert.Equal(t, fmt.Sprintf("%d", len(body)), get.Get("Content-Length"))
+	}
+}
@@ -0,0 +1,296 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const defaultTicketKeyRotationInterval = time.Hour
+
+// minTicketMasterSecretLen is the minimum length of the master secret from
+// which the session ticket keys are derived.
+const minTicketMasterSecretLen = 32
+
+// setSessionResumption applies the session resumption config of the Service
+// to the listener's TLS config.
+func (s *Server) setSessionResumption(ctx context.Context, svc *corev1.Service, tlsCfg *tls.Config) error {
+	cfg := svc.Spec.Config.GetHttp().GetListenerTLS().GetSessionResumption()
+	switch {
+	case cfg == nil:
+		return nil
+	case cfg.DisableTickets:
+		tlsCfg.SessionTicketsDisabled = true
+		return nil
+	case cfg.CacheSize > 0:
+		newSessionCache(int(cfg.CacheSize)).apply(tlsCfg)
+		return nil
+	case cfg.GetTicketKey().GetFromSecret() != "":
+	default:
+		return nil
+	}
+
+	s.ticketKeys.mu.Lock()
+	defer s.ticketKeys.mu.Unlock()
+
+	if s.ticketKeys.m == nil {
+		secretName := cfg.GetTicketKey().GetFromSecret()
+		m := newTicketKeyManager(secretName,
+			getTicketKeyRotationInterval(cfg.GetTicketKey()),
+			func(ctx context.Context) ([]byte, error) {
+				secret, err := s.secretMan.GetByName(ctx, secretName)
+				if err != nil {
+					return nil, err
+				}
+				return ucorev1.ToSecret(secret).GetValueBytes(), nil
+			})
+		if err := m.reload(ctx); err != nil {
+			return errors.Errorf("Could not load the session ticket key Secret %s: %+v", secretName, err)
+		}
+
+		m.stopFn = s.secretMan.Subscribe(m.onSecretUpdate)
+		go m.run(ctx)
+		s.ticketKeys.m = m
+	}
+
+	s.ticketKeys.m.add(tlsCfg)
+
+	return nil
+}
+
+func getTicketKeyRotationInterval(cfg *corev1.Service_Spec_Config_HTTP_ListenerTLS_SessionResumption_TicketKey) time.Duration {
+	if ret := umetav1.ToDuration(cfg.GetRotationInterval()).ToGo(); ret > 0 {
+		return ret
+	}
+	return defaultTicketKeyRotationInterval
+}
+
+// ticketKeyManager sets the session ticket keys of the listener's TLS configs.
+// The keys are derived from a master secret shared by all the Service's
+// instances and from the current rotation epoch, which makes all the
+// instances rotate to the same key at the same time without coordination.
+type ticketKeyManager struct {
+	secretName string
+	interval   time.Duration
+	load       func(ctx context.Context) ([]byte, error)
+	stopFn     func()
+
+	mu     sync.Mutex
+	cfgs   []*tls.Config
+	master []byte
+	epoch  int64
+}
+
+func newTicketKeyManager(secretName string, interval time.Duration,
+	load func(ctx context.Context) ([]byte, error)) *ticketKeyManager {
+	return &ticketKeyManager{
+		secretName: secretName,
+		interval:   interval,
+		load:       load,
+	}
+}
+
+func (m *ticketKeyManager) add(tlsCfg *tls.Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cfgs = append(m.cfgs, tlsCfg)
+	tlsCfg.SetSessionTicketKeys(getTicketKeys(m.master, m.epoch))
+}
+
+// reload loads the master secret and sets the keys of the current epoch.
+func (m *ticketKeyManager) reload(ctx context.Context) error {
+	master, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	if len(master) < minTicketMasterSecretLen {
+		return errors.Errorf("The master secret must be at least %d bytes long", minTicketMasterSecretLen)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.master = master
+	m.setKeys(m.getEpoch(time.Now()))
+
+	return nil
+}
+
+// rotate sets the keys of the epoch of now if it has changed.
+func (m *ticketKeyManager) rotate(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if epoch := m.getEpoch(now); epoch != m.epoch {
+		m.setKeys(epoch)
+	}
+}
+
+func (m *ticketKeyManager) getEpoch(now time.Time) int64 {
+	return now.UnixNano() / int64(m.interval)
+}
+
+func (m *ticketKeyManager) setKeys(epoch int64) {
+	m.epoch = epoch
+	keys := getTicketKeys(m.master, epoch)
+	for _, cfg := range m.cfgs {
+		cfg.SetSessionTicketKeys(keys)
+	}
+}
+
+func (m *ticketKeyManager) onSecretUpdate(name string) {
+	if name != m.secretName {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := m.reload(ctx); err != nil {
+		zap.L().Warn("Could not reload the session ticket key Secret. Keeping the current keys",
+			zap.String("secret", m.secretName), zap.Error(err))
+	}
+}
+
+func (m *ticketKeyManager) run(ctx context.Context) {
+	defer m.stopFn()
+
+	for {
+		now := time.Now()
+		next := time.Unix(0, (m.getEpoch(now)+1)*int64(m.interval))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+			m.rotate(time.Now())
+		}
+	}
+}
+
+// getTicketKeys returns the keys of the epoch. The first key encrypts the new
+// tickets while the previous epoch's key keeps the tickets issued right
+// before the rotation valid. The next epoch's key covers the instances whose
+// clocks are slightly ahead and have already rotated.
+func getTicketKeys(master []byte, epoch int64) [][32]byte {
+	return [][32]byte{
+		deriveTicketKey(master, epoch),
+		deriveTicketKey(master, epoch-1),
+		deriveTicketKey(master, epoch+1),
+	}
+}
+
+func deriveTicketKey(master []byte, epoch int64) [32]byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("octelium-session-ticket"))
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(epoch)))
+
+	var ret [32]byte
+	copy(ret[:], mac.Sum(nil))
+	return ret
+}
+
+// sessionCache is a bounded LRU cache of the TLS session states. The tickets
+// sent to the clients are only random identifiers of the cached states.
+type sessionCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type sessionCacheEntry struct {
+	id    string
+	state []byte
+}
+
+func newSessionCache(size int) *sessionCache {
+	return &sessionCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *sessionCache) apply(tlsCfg *tls.Config) {
+	tlsCfg.WrapSession = c.wrap
+	tlsCfg.UnwrapSession = c.unwrap
+}
+
+func (c *sessionCache) wrap(_ tls.ConnectionState, ss *tls.SessionState) ([]byte, error) {
+	state, err := ss.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[string(id)] = c.ll.PushFront(&sessionCacheEntry{
+		id:    string(id),
+		state: state,
+	})
+	for c.ll.Len() > c.size {
+		elem := c.ll.Back()
+		c.ll.Remove(elem)
+		delete(c.entries, elem.Value.(*sessionCacheEntry).id)
+	}
+
+	return id, nil
+}
+
+// unwrap returns the cached state of the identity. A nil state makes the
+// client do a full handshake.
+func (c *sessionCache) unwrap(identity []byte, _ tls.ConnectionState) (*tls.SessionState, error) {
+	c.mu.Lock()
+	elem, ok := c.entries[string(identity)]
+	if ok {
+		c.ll.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	ss, err := tls.ParseSessionState(elem.Value.(*sessionCacheEntry).state)
+	if err != nil {
+		return nil, nil
+	}
+
+	return ss, nil
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const defaultKeepAliveIdle = 30 * time.Second
+
+type upstreamDialer struct {
+	dialer         *net.Dialer
+	resolver       *upstreamResolver
+	disableNoDelay bool
+}
+
+// newUpstreamDialer returns the dialer of the upstream connections with the
+// socket options set by the Service config applied. Unset options keep the
+// Go and operating system defaults.
+func newUpstreamDialer(svcCfg *corev1.Service_Spec_Config) *upstreamDialer {
+	connectTimeout, _ := getConnectTimeouts(svcCfg)
+
+	ret := &upstreamDialer{
+		dialer: &net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: defaultKeepAliveIdle,
+		},
+		resolver: newUpstreamResolver(svcCfg),
+	}
+
+	if svcCfg == nil || svcCfg.GetHttp() == nil || svcCfg.GetHttp().Socket == nil {
+		return ret
+	}
+
+	socketCfg := svcCfg.GetHttp().Socket
+	ret.disableNoDelay = socketCfg.DisableNoDelay
+
+	if ka := socketCfg.Keepalive; ka != nil {
+		if ka.IsDisabled {
+			ret.dialer.KeepAlive = -1
+		} else {
+			ret.dialer.KeepAliveConfig = net.KeepAliveConfig{
+				Enable:   true,
+				Idle:     defaultKeepAliveIdle,
+				Interval: umetav1.ToDuration(ka.Interval).ToGo(),
+				Count:    int(ka.Count),
+			}
+			if val := umetav1.ToDuration(ka.Idle).ToGo(); val > 0 {
+				ret.dialer.KeepAliveConfig.Idle = val
+			}
+		}
+	}
+
+	if socketCfg.ReuseAddr || socketCfg.SendBufferSize > 0 || socketCfg.ReceiveBufferSize > 0 {
+		ret.dialer.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = setSocketOptions(int(fd), socketCfg)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+
+	return ret
+}
+
+func setSocketOptions(fd int, socketCfg *corev1.Service_Spec_Config_HTTP_Socket) error {
+	if socketCfg.ReuseAddr {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+			return err
+		}
+	}
+
+	if socketCfg.SendBufferSize > 0 {
+		if err := syscall.SetsockoptInt(fd,
+			syscall.SOL_SOCKET, syscall.SO_SNDBUF, int(socketCfg.SendBufferSize)); err != nil {
+			return err
+		}
+	}
+
+	if socketCfg.ReceiveBufferSize > 0 {
+		if err := syscall.SetsockoptInt(fd,
+			syscall.SOL_SOCKET, syscall.SO_RCVBUF, int(socketCfg.ReceiveBufferSize)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *upstreamDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.disableNoDelay {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			if err := tcpConn.SetNoDelay(false); err != nil {
+				zap.L().Debug("Could not disable TCP_NODELAY", zap.Error(err))
+			}
+		}
+	}
+
+	return conn, nil
+}
+
+func (d *upstreamDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.resolver == nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := d.resolver.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.Errorf("No addresses found for host: %s", host)
+	}
+
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = d.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
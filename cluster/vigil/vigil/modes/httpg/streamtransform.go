@@ -0,0 +1,279 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/httputils"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes/httpg/middlewares/accesslog"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStreamTransformMaxLineSize = 1 << 20
+	streamTransformReadSize           = 32 * 1024
+)
+
+// streamTransformer transforms a response body one line at a time. The line
+// is passed without its terminator. It returns false if the line is removed.
+type streamTransformer interface {
+	transform(line []byte) ([]byte, bool)
+}
+
+type lineFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func (f *lineFilter) transform(line []byte) ([]byte, bool) {
+	for _, rgx := range f.exclude {
+		if rgx.Match(line) {
+			return nil, false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return line, true
+	}
+
+	for _, rgx := range f.include {
+		if rgx.Match(line) {
+			return line, true
+		}
+	}
+
+	return nil, false
+}
+
+type ndjsonRedact struct {
+	fields []string
+}
+
+func (r *ndjsonRedact) transform(line []byte) ([]byte, bool) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return line, true
+	}
+
+	ret := accesslog.RedactBody(line, r.fields)
+	if ret == nil {
+		return nil, false
+	}
+
+	return ret, true
+}
+
+var streamTransformRegexps sync.Map
+
+func getStreamTransformRegexps(patterns []string) []*regexp.Regexp {
+	var ret []*regexp.Regexp
+	for _, pattern := range patterns {
+		if val, ok := streamTransformRegexps.Load(pattern); ok {
+			ret = append(ret, val.(*regexp.Regexp))
+			continue
+		}
+
+		rgx, err := regexp.Compile(pattern)
+		if err != nil {
+			zap.L().Debug("Could not compile streamTransform regexp", zap.String("pattern", pattern), zap.Error(err))
+			continue
+		}
+		streamTransformRegexps.Store(pattern, rgx)
+		ret = append(ret, rgx)
+	}
+
+	return ret
+}
+
+func getStreamTransformers(cfg *corev1.Service_Spec_Config_HTTP_StreamTransform, mediaType string) []streamTransformer {
+	var ret []streamTransformer
+	for _, rule := range cfg.Rules {
+		if len(rule.ContentTypes) > 0 && !slices.Contains(rule.ContentTypes, mediaType) {
+			continue
+		}
+
+		switch rule.Type.(type) {
+		case *corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_LineFilter_:
+			ret = append(ret, &lineFilter{
+				include: getStreamTransformRegexps(rule.GetLineFilter().Include),
+				exclude: getStreamTransformRegexps(rule.GetLineFilter().Exclude),
+			})
+		case *corev1.Service_Spec_Config_HTTP_StreamTransform_Rule_NdjsonRedact:
+			if len(rule.GetNdjsonRedact().Fields) > 0 {
+				ret = append(ret, &ndjsonRedact{
+					fields: rule.GetNdjsonRedact().Fields,
+				})
+			}
+		}
+	}
+
+	return ret
+}
+
+// transformResponseStream replaces the upstream response body with a reader
+// that applies the matching transformations as the body is streamed. Since
+// the body length is no longer known, the response is sent chunked and the
+// reverse proxy flushes every write right away.
+func transformResponseStream(r *http.Response, cfg *corev1.Service_Spec_Config_HTTP_StreamTransform) {
+	if cfg == nil || len(cfg.Rules) == 0 || r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+
+	if r.Request != nil && r.Request.Method == http.MethodHead {
+		return
+	}
+
+	switch r.StatusCode {
+	case http.StatusNoContent, http.StatusNotModified:
+		return
+	}
+
+	if enc := r.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return
+	}
+
+	transformers := getStreamTransformers(cfg, httputils.GetMediaType(&http.Request{
+		Header:        r.Header,
+		ContentLength: r.ContentLength,
+	}))
+	if len(transformers) == 0 {
+		return
+	}
+
+	maxLineSize := defaultStreamTransformMaxLineSize
+	if cfg.MaxLineSize > 0 {
+		maxLineSize = int(cfg.MaxLineSize)
+	}
+
+	httputils.SetResponseBodyStream(r, newStreamTransformReader(r.Body, transformers, maxLineSize))
+}
+
+// streamTransformReader applies the transformers to every complete line read
+// from the underlying body. Partial lines are kept across reads until their
+// terminator is received, while lines longer than maxLineSize are passed
+// through as they are.
+type streamTransformReader struct {
+	rc           io.ReadCloser
+	transformers []streamTransformer
+	maxLineSize  int
+
+	chunk         []byte
+	line          []byte
+	out           bytes.Buffer
+	isPassthrough bool
+	err           error
+}
+
+func newStreamTransformReader(rc io.ReadCloser,
+	transformers []streamTransformer, maxLineSize int) *streamTransformReader {
+	return &streamTransformReader{
+		rc:           rc,
+		transformers: transformers,
+		maxLineSize:  maxLineSize,
+		chunk:        make([]byte, streamTransformReadSize),
+	}
+}
+
+func (r *streamTransformReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.rc.Read(r.chunk)
+		if n > 0 {
+			r.process(r.chunk[:n])
+		}
+
+		if err != nil {
+			if err == io.EOF && len(r.line) > 0 {
+				r.writeLine(r.line, nil)
+				r.line = nil
+			}
+			r.err = err
+		}
+	}
+
+	return r.out.Read(p)
+}
+
+func (r *streamTransformReader) Close() error {
+	return r.rc.Close()
+}
+
+func (r *streamTransformReader) process(b []byte) {
+	for len(b) > 0 {
+		idx := bytes.IndexByte(b, '\n')
+
+		if r.isPassthrough {
+			if idx < 0 {
+				r.out.Write(b)
+				return
+			}
+			r.out.Write(b[:idx+1])
+			b = b[idx+1:]
+			r.isPassthrough = false
+			continue
+		}
+
+		if idx < 0 {
+			r.line = append(r.line, b...)
+			if len(r.line) > r.maxLineSize {
+				r.out.Write(r.line)
+				r.line = r.line[:0]
+				r.isPassthrough = true
+			}
+			return
+		}
+
+		r.line = append(r.line, b[:idx]...)
+		b = b[idx+1:]
+
+		if len(r.line) > r.maxLineSize {
+			r.out.Write(r.line)
+			r.out.WriteByte('\n')
+		} else {
+			line := r.line
+			terminator := []byte("\n")
+			if n := len(line); n > 0 && line[n-1] == '\r' {
+				line = line[:n-1]
+				terminator = []byte("\r\n")
+			}
+			r.writeLine(line, terminator)
+		}
+		r.line = r.line[:0]
+	}
+}
+
+func (r *streamTransformReader) writeLine(line, terminator []byte) {
+	for _, t := range r.transformers {
+		var ok bool
+		line, ok = t.transform(line)
+		if !ok {
+			return
+		}
+	}
+
+	r.out.Write(line)
+	r.out.Write(terminator)
+}
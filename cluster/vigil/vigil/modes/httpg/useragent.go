@@ -0,0 +1,46 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpg
+
+import (
+	"net/http"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+)
+
+const defaultUserAgent = "octelium"
+
+func applyUserAgent(hdr http.Header, cfg *corev1.Service_Spec_Config_HTTP_UserAgent) {
+	switch cfg.GetMode() {
+	case corev1.Service_Spec_Config_HTTP_UserAgent_SET:
+		hdr.Set("User-Agent", cfg.Value)
+	case corev1.Service_Spec_Config_HTTP_UserAgent_APPEND:
+		if clientUA := hdr.Get("User-Agent"); clientUA != "" {
+			hdr.Set("User-Agent", clientUA+" "+cfg.Value)
+		} else {
+			hdr.Set("User-Agent", cfg.Value)
+		}
+	case corev1.Service_Spec_Config_HTTP_UserAgent_REMOVE:
+		// An empty value prevents the Transport from setting its own default
+		// User-Agent.
+		hdr["User-Agent"] = []string{""}
+	default:
+		if _, ok := hdr["User-Agent"]; !ok {
+			hdr.Set("User-Agent", defaultUserAgent)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package tcp
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	closeReasonIdle        = "idle"
+	closeReasonMaxDuration = "maxDuration"
+)
+
+// acquireConn reserves a slot for a new connection unless the Service has
+// already reached its max concurrent connections. A successful call must be
+// followed by releaseConn once the connection is done.
+func (s *Server) acquireConn(svc *corev1.Service) bool {
+	n := s.activeConns.Add(1)
+	if maxConns := svc.Spec.Config.GetTcp().GetMaxConnections(); maxConns > 0 && n > int64(maxConns) {
+		s.activeConns.Add(-1)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) releaseConn() {
+	s.activeConns.Add(-1)
+}
+
+func (m *metricsStore) atConnRejected() {
+	m.rejectedConns.Add(context.Background(), 1,
+		metric.WithAttributeSet(m.CommonAttributeSet))
+}
+
+func (m *metricsStore) atConnClosed(reason string) {
+	m.closedConns.Add(context.Background(), 1,
+		metric.WithAttributeSet(m.CommonAttributeSet),
+		metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+func (m *metricsStore) atConnEnd(recvBytes, sentBytes int64) {
+	ctx := context.Background()
+	m.receivedBytes.Add(ctx, recvBytes, metric.WithAttributeSet(m.CommonAttributeSet))
+	m.sentBytes.Add(ctx, sentBytes, metric.WithAttributeSet(m.CommonAttributeSet))
+}
+
+// activityReader records the time of the last read that returned data.
+type activityReader struct {
+	io.Reader
+	lastActive *atomic.Int64
+}
+
+func (r *activityReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if n > 0 {
+		r.lastActive.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// watch closes both connections once the connection has been idle in both
+// directions for the idle timeout or once it exceeds the max duration. The
+// returned function stops watching and returns the close reason, if any.
+func (p *proxy) watch(cfg *corev1.Service_Spec_Config_TCP, conns ...connCloser) func() string {
+	idleTimeout := umetav1.ToDuration(cfg.GetIdleTimeout()).ToGo()
+	maxDuration := umetav1.ToDuration(cfg.GetMaxDuration()).ToGo()
+	if idleTimeout <= 0 && maxDuration <= 0 {
+		return func() string { return "" }
+	}
+
+	p.lastActive.Store(time.Now().UnixNano())
+
+	var reason string
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		var idleTimer *time.Timer
+		var idleC, maxC <-chan time.Time
+		if idleTimeout > 0 {
+			idleTimer = time.NewTimer(idleTimeout)
+			defer idleTimer.Stop()
+			idleC = idleTimer.C
+		}
+		if maxDuration > 0 {
+			maxTimer := time.NewTimer(maxDuration - time.Since(p.dctx.createdAt))
+			defer maxTimer.Stop()
+			maxC = maxTimer.C
+		}
+
+	loop:
+		for {
+			select {
+			case <-done:
+				return
+			case <-maxC:
+				reason = closeReasonMaxDuration
+				break loop
+			case <-idleC:
+				if since := time.Since(time.Unix(0, p.lastActive.Load())); since < idleTimeout {
+					idleTimer.Reset(idleTimeout - since)
+					continue
+				}
+				reason = closeReasonIdle
+				break loop
+			}
+		}
+
+		zap.L().Debug("Closing TCP conn", zap.String("id", p.dctx.id), zap.String("reason", reason))
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	return func() string {
+		close(done)
+		<-stopped
+		return reason
+	}
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package tcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/pkg/utils/utilrand"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireConn(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	srv := &Server{}
+	svc := &corev1.Service{
+		Spec: &corev1.Service_Spec{
+			Config: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Tcp{
+					Tcp: &corev1.Service_Spec_Config_TCP{
+						MaxConnections: 2,
+					},
+				},
+			},
+		},
+	}
+
+	assert.True(t, srv.acquireConn(svc))
+	assert.True(t, srv.acquireConn(svc))
+	assert.False(t, srv.acquireConn(svc))
+	assert.Equal(t, int64(2), srv.activeConns.Load())
+
+	srv.releaseConn()
+	assert.True(t, srv.acquireConn(svc))
+	assert.False(t, srv.acquireConn(svc))
+
+	svc.Spec.Config = nil
+	assert.True(t, srv.acquireConn(svc))
+	assert.Equal(t, int64(3), srv.activeConns.Load())
+}
+
+func TestProxyTimeouts(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err, "%+v", err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	getConnPair := func() (*net.TCPConn, *net.TCPConn) {
+		lis, err := net.Listen("tcp", "localhost:0")
+		assert.Nil(t, err)
+		defer lis.Close()
+
+		client, err := net.Dial("tcp", lis.Addr().String())
+		assert.Nil(t, err)
+		srv, err := lis.Accept()
+		assert.Nil(t, err)
+
+		return client.(*net.TCPConn), srv.(*net.TCPConn)
+	}
+
+	millis := func(d uint32) *metav1.Duration {
+		return &metav1.Duration{
+			Type: &metav1.Duration_Milliseconds{
+				Milliseconds: d,
+			},
+		}
+	}
+
+	doServe := func(cfg *corev1.Service_Spec_Config_TCP) (net.Conn, chan *proxy) {
+		client, downstream := getConnPair()
+		upstream, upstreamSrv := getConnPair()
+
+		go func() {
+			buf := make([]byte, 4096)
+			for {
+				n, err := upstreamSrv.Read(buf)
+				if err != nil {
+					upstreamSrv.Close()
+					return
+				}
+				upstreamSrv.Write(buf[:n])
+			}
+		}()
+
+		p := newProxy(&dctx{
+			id:        utilrand.GetRandomStringCanonical(8),
+			createdAt: time.Now(),
+			svcConfig: &corev1.Service_Spec_Config{
+				Type: &corev1.Service_Spec_Config_Tcp{
+					Tcp: cfg,
+				},
+			},
+		}, nil)
+
+		ret := make(chan *proxy, 1)
+		go func() {
+			p.doServe(downstream, upstream)
+			downstream.Close()
+			ret <- p
+		}()
+
+		return client, ret
+	}
+
+	echo := func(c net.Conn) {
+		msg := utilrand.GetRandomBytesMust(32)
+		_, err := c.Write(msg)
+		assert.Nil(t, err)
+
+		buf := make([]byte, 4096)
+		n, err := c.Read(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, msg, buf[:n])
+	}
+
+	{
+		c, done := doServe(&corev1.Service_Spec_Config_TCP{
+			IdleTimeout: millis(400),
+		})
+		defer c.Close()
+
+		for i := 0; i < 4; i++ {
+			echo(c)
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		select {
+		case p := <-done:
+			assert.Fail(t, "conn closed while active", p.closeReason)
+		default:
+		}
+
+		select {
+		case p := <-done:
+			assert.Equal(t, closeReasonIdle, p.closeReason)
+			assert.Equal(t, int64(4*32), p.recvBytes)
+			assert.Equal(t, int64(4*32), p.sentBytes)
+		case <-time.After(2 * time.Second):
+			assert.Fail(t, "idle conn not closed")
+		}
+
+		_, err := c.Read(make([]byte, 1))
+		assert.NotNil(t, err)
+	}
+
+	{
+		c, done := doServe(&corev1.Service_Spec_Config_TCP{
+			IdleTimeout: millis(400),
+			MaxDuration: millis(600),
+		})
+		defer c.Close()
+
+		startedAt := time.Now()
+		go func() {
+			for i := 0; i < 20; i++ {
+				if _, err := c.Write([]byte("ping")); err != nil {
+					return
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+		}()
+
+		select {
+		case p := <-done:
+			assert.Equal(t, closeReasonMaxDuration, p.closeReason)
+			assert.True(t, time.Since(startedAt) >= 600*time.Millisecond)
+		case <-time.After(2 * time.Second):
+			assert.Fail(t, "conn not closed after max duration")
+		}
+	}
+
+	{
+		c, done := doServe(nil)
+
+		echo(c)
+		c.Close()
+
+		select {
+		case p := <-done:
+			assert.Equal(t, "", p.closeReason)
+		case <-time.After(2 * time.Second):
+			assert.Fail(t, "conn not closed")
+		}
+	}
+}
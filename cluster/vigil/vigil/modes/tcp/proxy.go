@@ -22,12 +22,14 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
 	"github.com/octelium/octelium/cluster/vigil/vigil/mtls"
 	"github.com/octelium/octelium/cluster/vigil/vigil/secretman"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
 	"go.uber.org/zap"
 )
 
@@ -37,6 +39,9 @@ type proxy struct {
 	recvBytes int64
 	sentBytes int64
 	wg        sync.WaitGroup
+
+	lastActive  atomic.Int64
+	closeReason string
 }
 
 func newProxy(dctx *dctx, lbManager *loadbalancer.LBManager) *proxy {
@@ -63,7 +68,8 @@ func (p *proxy) serve(ctx context.Context, svc *corev1.Service, secretMan *secre
 
 	p.doServe(conn, upstreamConn)
 	zap.L().Debug("Done serving",
-		zap.String("id", p.dctx.id), zap.Int64("received", p.recvBytes), zap.Int64("sent", p.sentBytes))
+		zap.String("id", p.dctx.id), zap.Int64("received", p.recvBytes), zap.Int64("sent", p.sentBytes),
+		zap.String("closeReason", p.closeReason))
 }
 
 func (p *proxy) getUpstreamConn(ctx context.Context, svc *corev1.Service, secretMan *secretman.SecretManager) (connCloser, error) {
@@ -93,13 +99,24 @@ func (p *proxy) getUpstreamConn(ctx context.Context, svc *corev1.Service, secret
 func (p *proxy) doServe(conn, connBackend connCloser) {
 	defer connBackend.Close()
 
+	cfg := p.dctx.svcConfig.GetTcp()
+	stopWatch := p.watch(cfg, conn, connBackend)
+
+	var src, srcBackend io.Reader = conn, connBackend
+	if umetav1.ToDuration(cfg.GetIdleTimeout()).ToGo() > 0 {
+		src = &activityReader{Reader: conn, lastActive: &p.lastActive}
+		srcBackend = &activityReader{Reader: connBackend, lastActive: &p.lastActive}
+	}
+
 	p.wg.Add(2)
-	go p.connCopy(conn, connBackend, true)
-	go p.connCopy(connBackend, conn, false)
+	go p.connCopy(conn, srcBackend, true)
+	go p.connCopy(connBackend, src, false)
 	p.wg.Wait()
+
+	p.closeReason = stopWatch()
 }
 
-func (p *proxy) connCopy(dst, src connCloser, isRecv bool) {
+func (p *proxy) connCopy(dst connCloser, src io.Reader, isRecv bool) {
 	defer p.wg.Done()
 
 	n, _ := io.Copy(dst, src)
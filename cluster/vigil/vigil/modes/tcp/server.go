@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"sync"
+	"sync/atomic"
 
 	"context"
 
@@ -44,6 +45,7 @@ import (
 	"github.com/octelium/octelium/cluster/vigil/vigil/vigilutils"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
 	"github.com/octelium/octelium/pkg/grpcerr"
+	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 )
 
@@ -83,10 +85,16 @@ type Server struct {
 		mu     sync.RWMutex
 	}
 	metricsStore *metricsStore
+
+	activeConns atomic.Int64
 }
 
 type metricsStore struct {
 	*metricutils.CommonMetrics
+	rejectedConns metric.Int64Counter
+	closedConns   metric.Int64Counter
+	receivedBytes metric.Int64Counter
+	sentBytes     metric.Int64Counter
 }
 
 func (s *Server) svc() *corev1.Service {
@@ -122,6 +130,38 @@ func New(ctx context.Context, opts *modes.Opts) (*Server, error) {
 		return nil, err
 	}
 
+	meter := otelutils.GetMeter()
+
+	server.metricsStore.rejectedConns, err = meter.Int64Counter(
+		metricutils.GetKey("tcp.conn.rejected"),
+		metric.WithDescription("Total number of connections rejected since the max connections is reached"))
+	if err != nil {
+		return nil, err
+	}
+
+	server.metricsStore.closedConns, err = meter.Int64Counter(
+		metricutils.GetKey("tcp.conn.closed"),
+		metric.WithDescription("Total number of connections closed by the idle timeout or the max duration"))
+	if err != nil {
+		return nil, err
+	}
+
+	server.metricsStore.receivedBytes, err = meter.Int64Counter(
+		metricutils.GetKey("tcp.bytes.received"),
+		metric.WithUnit("By"),
+		metric.WithDescription("Total number of bytes received from downstream connections"))
+	if err != nil {
+		return nil, err
+	}
+
+	server.metricsStore.sentBytes, err = meter.Int64Counter(
+		metricutils.GetKey("tcp.bytes.sent"),
+		metric.WithUnit("By"),
+		metric.WithDescription("Total number of bytes sent to downstream connections"))
+	if err != nil {
+		return nil, err
+	}
+
 	return server, nil
 }
 
@@ -169,6 +209,15 @@ func (s *Server) handleConn(ctx context.Context, c net.Conn) {
 		return
 	}
 
+	if !s.acquireConn(svc) {
+		zap.L().Debug("Closing conn since the Service reached its max connections",
+			zap.String("addr", c.RemoteAddr().String()))
+		s.metricsStore.atConnRejected()
+		c.Close()
+		return
+	}
+	defer s.releaseConn()
+
 	if err := setKeepAlive(c); err != nil {
 		zap.S().Debugf("Could not set keepAlive: %+v", err)
 		c.Close()
@@ -249,6 +298,10 @@ func (s *Server) handleConn(ctx context.Context, c net.Conn) {
 	s.metricsStore.AtRequestStart()
 	dctx.serve(ctx, s.lbManager, svc, s.secretMan)
 	s.metricsStore.AtRequestEnd(dctx.createdAt, nil)
+	s.metricsStore.atConnEnd(dctx.proxy.recvBytes, dctx.proxy.sentBytes)
+	if reason := dctx.proxy.closeReason; reason != "" {
+		s.metricsStore.atConnClosed(reason)
+	}
 
 	defer dctx.close()
 
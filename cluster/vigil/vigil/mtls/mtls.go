@@ -84,16 +84,7 @@ func GetClientTLSCfg(ctx context.Context,
 	}
 
 	if svcCfg.Tls.ClientCertificate != nil && svcCfg.Tls.ClientCertificate.GetFromSecret() != "" {
-		secret, err := secretMan.GetByName(ctx, svcCfg.Tls.ClientCertificate.GetFromSecret())
-		if err != nil {
-			return nil, err
-		}
-
-		if !vutils.IsCertReady(secret) {
-			return nil, errors.Errorf("Secret %s is not a Certificate Secret", secret.Metadata.Name)
-		}
-
-		crt, err := ocrypto.GetTLSCertificate(secret)
+		crt, err := GetClientCertificate(ctx, secretMan, svcCfg.Tls.ClientCertificate.GetFromSecret())
 		if err != nil {
 			return nil, err
 		}
@@ -101,9 +92,27 @@ func GetClientTLSCfg(ctx context.Context,
 		ret.Certificates = append(ret.Certificates, *crt)
 	}
 
+	setPinnedFingerprints(ret, svcCfg.Tls.PinnedFingerprints)
+
 	return ret, nil
 }
 
+// GetClientCertificate returns the client certificate stored in the
+// Certificate Secret.
+func GetClientCertificate(ctx context.Context,
+	secretMan *secretman.SecretManager, secretName string) (*tls.Certificate, error) {
+	secret, err := secretMan.GetByName(ctx, secretName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !vutils.IsCertReady(secret) {
+		return nil, errors.Errorf("Secret %s is not a Certificate Secret", secret.Metadata.Name)
+	}
+
+	return ocrypto.GetTLSCertificate(secret)
+}
+
 func getClientTLSCfgWithDeprecatedClientCert(ctx context.Context, svc *corev1.Service, svcCfg *corev1.Service_Spec_Config, secretMan *secretman.SecretManager, upstream *loadbalancer.Upstream) (*tls.Config, error) {
 
 	if svcCfg == nil {
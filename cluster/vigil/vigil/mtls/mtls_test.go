@@ -18,8 +18,16 @@ package mtls
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/octelium/octelium/apis/cluster/coctovigilv1"
 	"github.com/octelium/octelium/apis/main/corev1"
@@ -286,3 +294,153 @@ func TestGetClientTLSCfgNew(t *testing.T) {
 		assert.False(t, tlscfg.InsecureSkipVerify)
 	}
 }
+
+func TestPinnedFingerprints(t *testing.T) {
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	otherSum := sha256.Sum256([]byte("other"))
+	otherFingerprint := hex.EncodeToString(otherSum[:])
+
+	doRequest := func(fingerprints []string) error {
+		pool := x509.NewCertPool()
+		pool.AddCert(srv.Certificate())
+		tlsCfg := &tls.Config{
+			RootCAs: pool,
+		}
+		setPinnedFingerprints(tlsCfg, fingerprints)
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		assert.Nil(t, err)
+
+		resp, err := (&http.Transport{TLSClientConfig: tlsCfg}).RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	{
+		assert.Nil(t, doRequest(nil))
+		assert.Nil(t, doRequest([]string{fingerprint}))
+		assert.Nil(t, doRequest([]string{otherFingerprint, fingerprint}))
+	}
+
+	{
+		var colonFingerprint []string
+		for i := 0; i < len(fingerprint); i += 2 {
+			colonFingerprint = append(colonFingerprint, strings.ToUpper(fingerprint[i:i+2]))
+		}
+		assert.Nil(t, doRequest([]string{strings.Join(colonFingerprint, ":")}))
+	}
+
+	{
+		err := doRequest([]string{otherFingerprint})
+		assert.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrFingerprintMismatch)
+	}
+}
+
+func TestPinnedFingerprintsChain(t *testing.T) {
+
+	rootCA, err := utils_cert.GenerateCARoot()
+	assert.Nil(t, err)
+	intermediateCA, err := utils_cert.GenerateIntermediateCATmp("intermediate", rootCA)
+	assert.Nil(t, err)
+
+	serialNumber, err := utils_cert.GenerateSerialNumber()
+	assert.Nil(t, err)
+	leaf, err := utils_cert.GenerateCertificate(&x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName: "example.com",
+		},
+		DNSNames:    []string{"example.com"},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, intermediateCA.Certificate, intermediateCA.PrivateKey, false)
+	assert.Nil(t, err)
+
+	attacker, err := utils_cert.GenerateSelfSignedCert("example.com", []string{"example.com"}, time.Hour)
+	assert.Nil(t, err)
+
+	getFingerprint := func(crt *x509.Certificate) string {
+		sum := sha256.Sum256(crt.Raw)
+		return hex.EncodeToString(sum[:])
+	}
+
+	doRequest := func(crt tls.Certificate, verify bool, fingerprints []string) error {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = &tls.Config{
+			Certificates: []tls.Certificate{crt},
+		}
+		srv.StartTLS()
+		defer srv.Close()
+
+		tlsCfg := &tls.Config{
+			ServerName:         "example.com",
+			InsecureSkipVerify: !verify,
+		}
+		if verify {
+			tlsCfg.RootCAs = x509.NewCertPool()
+			tlsCfg.RootCAs.AddCert(rootCA.Certificate)
+		}
+		setPinnedFingerprints(tlsCfg, fingerprints)
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		assert.Nil(t, err)
+
+		resp, err := (&http.Transport{TLSClientConfig: tlsCfg}).RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	legitimate := tls.Certificate{
+		Certificate: [][]byte{leaf.Certificate.Raw, intermediateCA.Certificate.Raw},
+		PrivateKey:  leaf.PrivateKey,
+	}
+
+	{
+		assert.Nil(t, doRequest(legitimate, false, []string{getFingerprint(leaf.Certificate)}))
+		assert.Nil(t, doRequest(legitimate, true, []string{getFingerprint(leaf.Certificate)}))
+		assert.Nil(t, doRequest(legitimate, true, []string{getFingerprint(intermediateCA.Certificate)}))
+	}
+
+	{
+		err := doRequest(legitimate, false, []string{getFingerprint(intermediateCA.Certificate)})
+		assert.ErrorIs(t, err, ErrFingerprintMismatch)
+	}
+
+	{
+		// The pinned certificates are public and can be sent by anyone
+		// behind a leaf certificate of their own.
+		impersonating := tls.Certificate{
+			Certificate: [][]byte{
+				attacker.Certificate.Raw, leaf.Certificate.Raw, intermediateCA.Certificate.Raw,
+			},
+			PrivateKey: attacker.PrivateKey,
+		}
+
+		err := doRequest(impersonating, false, []string{getFingerprint(leaf.Certificate)})
+		assert.ErrorIs(t, err, ErrFingerprintMismatch)
+
+		err = doRequest(impersonating, false, []string{getFingerprint(intermediateCA.Certificate)})
+		assert.ErrorIs(t, err, ErrFingerprintMismatch)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mtls
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrFingerprintMismatch is returned by the TLS handshake when neither the
+// upstream's leaf certificate nor its verified intermediate certificates
+// match the pinned fingerprints.
+var ErrFingerprintMismatch = errors.New("upstream certificate does not match the pinned fingerprints")
+
+// NormalizeFingerprint returns the lowercase hex form of the fingerprint
+// without the colon separators, e.g. "AB:CD:..." becomes "abcd...".
+func NormalizeFingerprint(arg string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(arg), ":", ""))
+}
+
+// setPinnedFingerprints makes the TLS config reject the upstreams whose leaf
+// certificate does not match any of the fingerprints, unless one of the
+// intermediate certificates of a verified chain does. The other certificates
+// presented by the upstream are never matched since the upstream can send any
+// certificate, including a pinned one, alongside a leaf it holds the key of.
+// Unlike VerifyPeerCertificate, VerifyConnection is also called for resumed
+// sessions.
+func setPinnedFingerprints(tlsCfg *tls.Config, fingerprints []string) {
+	if len(fingerprints) == 0 {
+		return
+	}
+
+	pins := make(map[string]struct{}, len(fingerprints))
+	for _, fp := range fingerprints {
+		pins[NormalizeFingerprint(fp)] = struct{}{}
+	}
+
+	isPinned := func(crt *x509.Certificate) bool {
+		sum := sha256.Sum256(crt.Raw)
+		_, ok := pins[hex.EncodeToString(sum[:])]
+		return ok
+	}
+
+	tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return ErrFingerprintMismatch
+		}
+
+		if isPinned(cs.PeerCertificates[0]) {
+			return nil
+		}
+
+		for _, chain := range cs.VerifiedChains {
+			if len(chain) < 2 {
+				continue
+			}
+			for _, crt := range chain[1:] {
+				if isPinned(crt) {
+					return nil
+				}
+			}
+		}
+
+		return ErrFingerprintMismatch
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package secretman
+
+import (
+	"context"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/pkg/apiutils/umetav1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Provider resolves the values of the external Secrets, i.e. the Secrets
+// whose values are stored in an external secret store such as Vault rather
+// than in the Cluster.
+type Provider interface {
+	// Name is the name used by the external Secrets to select the provider.
+	Name() string
+
+	// GetValue returns the current value of the external Secret.
+	GetValue(ctx context.Context, ext *corev1.Secret_Spec_External) ([]byte, error)
+}
+
+const (
+	defaultExternalRefreshInterval = 5 * time.Minute
+	minExternalRefreshInterval     = 10 * time.Second
+	externalRefreshTick            = 10 * time.Second
+)
+
+// RegisterProvider adds a provider of the external Secrets or replaces the
+// one with the same name. The first registered provider is used by the
+// external Secrets that do not set one.
+func (s *SecretManager) RegisterProvider(p Provider) {
+	s.providers.Lock()
+	defer s.providers.Unlock()
+
+	if s.providers.defaultName == "" {
+		s.providers.defaultName = p.Name()
+	}
+	s.providers.providers[p.Name()] = p
+}
+
+func (s *SecretManager) unregisterProvider(name string) {
+	s.providers.Lock()
+	defer s.providers.Unlock()
+
+	delete(s.providers.providers, name)
+	if s.providers.defaultName == name {
+		s.providers.defaultName = ""
+	}
+}
+
+// ApplyClusterConfig sets the providers to the ones of the ClusterConfig. It
+// is called again whenever the ClusterConfig is updated. The providers that
+// are removed from the ClusterConfig are unregistered and the external
+// Secrets are then resolved again. The current providers are kept if the new
+// ones cannot be created.
+func (s *SecretManager) ApplyClusterConfig(ctx context.Context, cc *corev1.ClusterConfig) error {
+	vaultProvider, err := s.newVaultProviderFromClusterConfig(ctx, cc)
+	if err != nil {
+		return err
+	}
+	if vaultProvider != nil {
+		s.RegisterProvider(vaultProvider)
+	} else {
+		s.unregisterProvider(vaultProviderName)
+	}
+
+	s.resetExternal(ctx)
+
+	return nil
+}
+
+func (s *SecretManager) getProvider(name string) (Provider, error) {
+	s.providers.Lock()
+	defer s.providers.Unlock()
+
+	if name == "" {
+		name = s.providers.defaultName
+	}
+
+	ret, ok := s.providers.providers[name]
+	if !ok {
+		return nil, errors.Errorf("The secret provider %q is not available", name)
+	}
+
+	return ret, nil
+}
+
+func getRefreshInterval(ext *corev1.Secret_Spec_External) time.Duration {
+	if ext.RefreshInterval == nil {
+		return defaultExternalRefreshInterval
+	}
+
+	return max(umetav1.ToDuration(ext.RefreshInterval).ToGo(), minExternalRefreshInterval)
+}
+
+// resolve returns the Secret with its data set to its value from the
+// external secret store. The Secrets that are stored in the Cluster are
+// returned as is.
+func (s *SecretManager) resolve(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	ext := secret.GetSpec().GetExternal()
+	if ext == nil {
+		return secret, nil
+	}
+
+	p, err := s.getProvider(ext.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := p.GetValue(ctx, ext)
+	if err != nil {
+		return nil, errors.Errorf("Could not get the value of the external Secret %s: %s",
+			secret.Metadata.Name, err)
+	}
+
+	ret := pbutils.Clone(secret).(*corev1.Secret)
+	ret.Data = &corev1.Secret_Data{
+		Type: &corev1.Secret_Data_ValueBytes{
+			ValueBytes: val,
+		},
+	}
+
+	return ret, nil
+}
+
+// setCache caches the Secret. An external Secret is cached until its refresh
+// interval elapses. The generation is incremented only once the value of a
+// previously cached Secret actually changes, e.g. an external Secret is
+// rotated, so that the users of the value pick up the new one.
+func (s *SecretManager) setCache(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	ret, err := s.resolve(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ret.Metadata.Name
+	if ext := ret.GetSpec().GetExternal(); ext != nil {
+		s.c.Set(name, ret, getRefreshInterval(ext))
+		s.externals.Store(name, &externalSecret{
+			secret: ret,
+		})
+	} else {
+		s.c.Set(name, ret, 0)
+	}
+
+	if prev, ok := s.values.Swap(name, ret.Data); ok &&
+		!pbutils.IsEqual(prev.(*corev1.Secret_Data), ret.Data) {
+		zap.L().Info("Secret value updated", zap.String("name", name))
+		s.updated(name)
+	}
+
+	return ret, nil
+}
+
+type externalSecret struct {
+	secret *corev1.Secret
+}
+
+// getLastExternal returns the last resolved value of an external Secret so
+// that a temporarily unavailable secret store does not break the Service.
+func (s *SecretManager) getLastExternal(name string) (*corev1.Secret, bool) {
+	ret, ok := s.externals.Load(name)
+	if !ok {
+		return nil, false
+	}
+
+	return ret.(*externalSecret).secret, true
+}
+
+// runRefresh resolves the external Secrets of the Service again once their
+// refresh interval elapses. A Secret that cannot be resolved keeps being
+// retried on every tick until it can.
+func (s *SecretManager) runRefresh(ctx context.Context) {
+	ticker := time.NewTicker(externalRefreshTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshExternal(ctx)
+		}
+	}
+}
+
+// resetExternal drops the cached external Secrets and resolves them again,
+// e.g. once their provider changes.
+func (s *SecretManager) resetExternal(ctx context.Context) {
+	s.externals.Range(func(key, _ any) bool {
+		s.c.Delete(key.(string))
+		return true
+	})
+
+	s.refreshExternal(ctx)
+}
+
+func (s *SecretManager) refreshExternal(ctx context.Context) {
+	s.mu.Lock()
+	names := append([]string{}, s.secretNames...)
+	s.mu.Unlock()
+
+	for _, name := range names {
+		if _, ok := s.externals.Load(name); !ok {
+			continue
+		}
+		if _, ok := s.c.Get(name); ok {
+			continue
+		}
+
+		if _, err := s.GetByName(ctx, name); err != nil {
+			zap.L().Warn("Could not refresh external Secret", zap.String("name", name), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,343 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package secretman
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/utils/utilrand"
+	"github.com/stretchr/testify/assert"
+)
+
+type tstProvider struct {
+	val []byte
+}
+
+func (p *tstProvider) Name() string {
+	return "tst"
+}
+
+func (p *tstProvider) GetValue(ctx context.Context, ext *corev1.Secret_Spec_External) ([]byte, error) {
+	return p.val, nil
+}
+
+func TestExternalSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := New(ctx, nil, nil)
+	assert.Nil(t, err)
+
+	secret := &corev1.Secret{
+		Metadata: &metav1.Metadata{
+			Name: "ext",
+		},
+		Spec: &corev1.Secret_Spec{
+			External: &corev1.Secret_Spec_External{
+				Path: "a/b",
+			},
+		},
+	}
+
+	_, err = s.setCache(ctx, secret)
+	assert.NotNil(t, err)
+
+	p := &tstProvider{val: []byte("v1")}
+	s.RegisterProvider(p)
+
+	res, err := s.setCache(ctx, secret)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", ucorev1.ToSecret(res).GetValueStr())
+	assert.Nil(t, secret.Data)
+
+	gen := s.Generation()
+	_, err = s.setCache(ctx, secret)
+	assert.Nil(t, err)
+	assert.Equal(t, gen, s.Generation())
+
+	p.val = []byte("v2")
+	res, err = s.setCache(ctx, secret)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", ucorev1.ToSecret(res).GetValueStr())
+	assert.Equal(t, gen+1, s.Generation())
+
+	last, ok := s.getLastExternal("ext")
+	assert.True(t, ok)
+	assert.Equal(t, "v2", ucorev1.ToSecret(last).GetValueStr())
+
+	secret.Spec.External.Provider = "unknown"
+	_, err = s.setCache(ctx, secret)
+	assert.NotNil(t, err)
+}
+
+func TestVaultProvider(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "tkn" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/my-app/db":
+			w.Write([]byte(`{"data":{"data":{"username":"usr","password":"pwd"}}}`))
+		case "/v1/secret/data/my-app/single":
+			w.Write([]byte(`{"data":{"data":{"token":"abc"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	_, err := NewVaultProvider(&VaultProviderOpts{Addr: srv.URL})
+	assert.NotNil(t, err)
+
+	p, err := NewVaultProvider(&VaultProviderOpts{Addr: srv.URL, Token: "tkn"})
+	assert.Nil(t, err)
+
+	val, err := p.GetValue(ctx, &corev1.Secret_Spec_External{Path: "secret/my-app/db", Key: "password"})
+	assert.Nil(t, err)
+	assert.Equal(t, "pwd", string(val))
+
+	_, err = p.GetValue(ctx, &corev1.Secret_Spec_External{Path: "secret/my-app/db"})
+	assert.NotNil(t, err)
+
+	val, err = p.GetValue(ctx, &corev1.Secret_Spec_External{Path: "/secret/my-app/single"})
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(val))
+
+	_, err = p.GetValue(ctx, &corev1.Secret_Spec_External{Path: "secret/my-app/none"})
+	assert.NotNil(t, err)
+
+	_, err = p.GetValue(ctx, &corev1.Secret_Spec_External{Path: "secret"})
+	assert.NotNil(t, err)
+
+	for _, pth := range []string{
+		"secret/my-app/../db",
+		"secret/../sys/policy",
+		"../secret/my-app/db",
+		"secret/./my-app/db",
+		"secret//my-app/db",
+	} {
+		_, err = p.GetValue(ctx, &corev1.Secret_Spec_External{Path: pth})
+		assert.NotNil(t, err, pth)
+	}
+
+	s, err := New(ctx, nil, nil)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.ApplyClusterConfig(ctx, &corev1.ClusterConfig{Spec: &corev1.ClusterConfig_Spec{}}))
+	_, err = s.getProvider("")
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, s.ApplyClusterConfig(ctx, &corev1.ClusterConfig{
+		Spec: &corev1.ClusterConfig_Spec{
+			SecretProviders: &corev1.ClusterConfig_Spec_SecretProviders{
+				Vault: &corev1.ClusterConfig_Spec_SecretProviders_Vault{
+					Address: srv.URL,
+				},
+			},
+		},
+	}))
+}
+
+func TestSetGeneration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := New(ctx, nil, nil)
+	assert.Nil(t, err)
+
+	p := &tstProvider{val: []byte("v1")}
+	s.RegisterProvider(p)
+
+	ext := &corev1.Secret{
+		Metadata: &metav1.Metadata{
+			Name: "ext",
+		},
+		Spec: &corev1.Secret_Spec{
+			External: &corev1.Secret_Spec_External{
+				Path: "a/b",
+			},
+		},
+	}
+
+	internal := &corev1.Secret{
+		Metadata: &metav1.Metadata{
+			Name: "internal",
+		},
+		Spec: &corev1.Secret_Spec{},
+		Data: &corev1.Secret_Data{
+			Type: &corev1.Secret_Data_Value{
+				Value: "v1",
+			},
+		},
+	}
+
+	s.secretNames = []string{"ext", "internal"}
+
+	var notified []string
+	unsubscribe := s.Subscribe(func(name string) {
+		notified = append(notified, name)
+	})
+	defer unsubscribe()
+
+	s.Set(ext)
+	s.Set(internal)
+	gen := s.Generation()
+	assert.Equal(t, uint64(0), gen)
+
+	// The values did not change.
+	s.Set(ext)
+	s.Set(internal)
+	assert.Equal(t, gen, s.Generation())
+	assert.Equal(t, 0, len(notified))
+
+	p.val = []byte("v2")
+	s.Set(ext)
+	assert.Equal(t, gen+1, s.Generation())
+	assert.Equal(t, []string{"ext"}, notified)
+	assert.Equal(t, uint64(1), s.SecretGeneration("ext"))
+	assert.Equal(t, uint64(0), s.SecretGeneration("internal"))
+
+	internal.Data = &corev1.Secret_Data{
+		Type: &corev1.Secret_Data_Value{
+			Value: "v2",
+		},
+	}
+	s.Set(internal)
+	assert.Equal(t, gen+2, s.Generation())
+	assert.Equal(t, []string{"ext", "internal"}, notified)
+
+	s.Delete(internal)
+	assert.Equal(t, gen+3, s.Generation())
+	assert.Equal(t, uint64(1), s.SecretGeneration("ext"))
+	assert.Equal(t, uint64(2), s.SecretGeneration("internal"))
+}
+
+func TestApplyClusterConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+	fakeC := tst.C
+
+	newVaultSrv := func(val string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != "tkn" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			w.Write([]byte(fmt.Sprintf(`{"data":{"data":{"password":"%s"}}}`, val)))
+		}))
+	}
+
+	srv1 := newVaultSrv("v1")
+	defer srv1.Close()
+	srv2 := newVaultSrv("v2")
+	defer srv2.Close()
+
+	tokenSecret, err := fakeC.OcteliumC.CoreC().CreateSecret(ctx, &corev1.Secret{
+		Metadata: &metav1.Metadata{
+			Name: utilrand.GetRandomStringCanonical(6),
+		},
+		Spec: &corev1.Secret_Spec{},
+		Data: &corev1.Secret_Data{
+			Type: &corev1.Secret_Data_Value{
+				Value: "tkn",
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	ext, err := fakeC.OcteliumC.CoreC().CreateSecret(ctx, &corev1.Secret{
+		Metadata: &metav1.Metadata{
+			Name: utilrand.GetRandomStringCanonical(6),
+		},
+		Spec: &corev1.Secret_Spec{
+			External: &corev1.Secret_Spec_External{
+				Path: "secret/my-app/db",
+				Key:  "password",
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	getCC := func(addr string) *corev1.ClusterConfig {
+		return &corev1.ClusterConfig{
+			Spec: &corev1.ClusterConfig_Spec{
+				SecretProviders: &corev1.ClusterConfig_Spec_SecretProviders{
+					Vault: &corev1.ClusterConfig_Spec_SecretProviders_Vault{
+						Address: addr,
+						Token: &corev1.ClusterConfig_Spec_SecretProviders_Vault_Token{
+							Type: &corev1.ClusterConfig_Spec_SecretProviders_Vault_Token_FromSecret{
+								FromSecret: tokenSecret.Metadata.Name,
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	s, err := New(ctx, fakeC.OcteliumC, nil)
+	assert.Nil(t, err)
+	s.secretNames = []string{ext.Metadata.Name}
+
+	assert.Nil(t, s.ApplyClusterConfig(ctx, getCC(srv1.URL)))
+
+	res, err := s.GetByName(ctx, ext.Metadata.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", ucorev1.ToSecret(res).GetValueStr())
+	gen := s.Generation()
+
+	// The provider config changes at runtime
+	assert.Nil(t, s.ApplyClusterConfig(ctx, getCC(srv2.URL)))
+	assert.Equal(t, gen+1, s.Generation())
+
+	res, err = s.GetByName(ctx, ext.Metadata.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", ucorev1.ToSecret(res).GetValueStr())
+
+	// An invalid config keeps the current provider
+	assert.NotNil(t, s.ApplyClusterConfig(ctx, getCC("invalid")))
+	_, err = s.getProvider("")
+	assert.Nil(t, err)
+
+	// The provider is removed from the ClusterConfig
+	assert.Nil(t, s.ApplyClusterConfig(ctx, &corev1.ClusterConfig{Spec: &corev1.ClusterConfig_Spec{}}))
+	_, err = s.getProvider("")
+	assert.NotNil(t, err)
+
+	res, err = s.GetByName(ctx, ext.Metadata.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", ucorev1.ToSecret(res).GetValueStr())
+}
@@ -22,6 +22,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/octelium/octelium/apis/main/corev1"
@@ -36,16 +37,37 @@ import (
 	"golang.org/x/oauth2/clientcredentials"
 )
 
+// defaultLookupTimeout bounds the Secret lookups that miss the cache, which
+// typically run on the request path, so that a slow Cluster or external
+// secret store fails them fast instead of hanging the requests.
+const defaultLookupTimeout = 5 * time.Second
+
 type SecretManager struct {
 	mu          sync.Mutex
 	octeliumC   octeliumc.ClientInterface
 	c           *cache.Cache
 	vCache      *vcache.Cache
 	secretNames []string
+	generation  atomic.Uint64
+	generations sync.Map
 	oauth2ccMap struct {
 		sync.Mutex
 		oauth2ccMap map[string]*oauth2ClientCredentialsInfo
 	}
+	providers struct {
+		sync.Mutex
+		providers   map[string]Provider
+		defaultName string
+	}
+	externals   sync.Map
+	values      sync.Map
+	subscribers struct {
+		sync.Mutex
+		fns    map[uint64]func(name string)
+		nextID uint64
+	}
+
+	lookupTimeout time.Duration
 }
 
 type oauth2ClientCredentialsInfo struct {
@@ -55,29 +77,47 @@ type oauth2ClientCredentialsInfo struct {
 func New(ctx context.Context, octeliumC octeliumc.ClientInterface, vCache *vcache.Cache) (*SecretManager, error) {
 
 	ret := &SecretManager{
-		octeliumC: octeliumC,
-		c:         cache.New(cache.NoExpiration, 10*time.Minute),
-		vCache:    vCache,
+		octeliumC:     octeliumC,
+		lookupTimeout: defaultLookupTimeout,
+		c:             cache.New(cache.NoExpiration, 10*time.Minute),
+		vCache:        vCache,
 	}
 
 	ret.oauth2ccMap.oauth2ccMap = make(map[string]*oauth2ClientCredentialsInfo)
+	ret.providers.providers = make(map[string]Provider)
+	ret.subscribers.fns = make(map[uint64]func(name string))
+
+	go ret.runRefresh(ctx)
 
 	return ret, nil
 }
 
+// GetByName returns the Secret from the cache or looks it up otherwise. The
+// lookup honors the deadline of ctx, typically the request's, and is bounded
+// by the lookup timeout.
 func (s *SecretManager) GetByName(ctx context.Context, name string) (*corev1.Secret, error) {
 	if sI, ok := s.c.Get(name); ok {
 		return sI.(*corev1.Secret), nil
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, s.lookupTimeout)
+	defer cancel()
+
 	ret, err := s.octeliumC.CoreC().GetSecret(ctx, &rmetav1.GetOptions{Name: name})
 	if err != nil {
 		return nil, err
 	}
 
-	s.c.Set(ret.Metadata.Name, ret, 0)
+	resolved, err := s.setCache(ctx, ret)
+	if err != nil {
+		if last, ok := s.getLastExternal(name); ok {
+			zap.L().Warn("Using the last value of the external Secret", zap.String("name", name), zap.Error(err))
+			return last, nil
+		}
+		return nil, err
+	}
 
-	return ret, nil
+	return resolved, nil
 }
 
 func (s *SecretManager) Set(secret *corev1.Secret) {
@@ -85,7 +125,13 @@ func (s *SecretManager) Set(secret *corev1.Secret) {
 		return
 	}
 
-	s.c.Set(secret.Metadata.Name, secret, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.setCache(ctx, secret); err != nil {
+		zap.L().Warn("Could not set Secret", zap.String("name", secret.Metadata.Name), zap.Error(err))
+		return
+	}
 
 	/*
 		if s.oauth2CCSecret != nil && s.oauth2CCSecret.name == secret.Metadata.Name {
@@ -105,8 +151,6 @@ func (s *SecretManager) Delete(secret *corev1.Secret) {
 		return
 	}
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	for i := len(s.secretNames) - 1; i >= 0; i-- {
 		if s.secretNames[i] == secret.Metadata.Name {
 			s.secretNames = append(s.secretNames[0:i], s.secretNames[i+1:]...)
@@ -114,6 +158,62 @@ func (s *SecretManager) Delete(secret *corev1.Secret) {
 	}
 
 	s.c.Delete(secret.Metadata.Name)
+	s.externals.Delete(secret.Metadata.Name)
+	s.values.Delete(secret.Metadata.Name)
+	s.mu.Unlock()
+
+	s.updated(secret.Metadata.Name)
+}
+
+// Generation returns a counter that is incremented whenever a cached Secret
+// is updated or deleted.
+func (s *SecretManager) Generation() uint64 {
+	return s.generation.Load()
+}
+
+// SecretGeneration returns a counter that is incremented whenever the cached
+// Secret of the name is updated or deleted. Unlike Generation, it is not
+// affected by the updates of the other Secrets.
+func (s *SecretManager) SecretGeneration(name string) uint64 {
+	if gen, ok := s.generations.Load(name); ok {
+		return gen.(*atomic.Uint64).Load()
+	}
+	return 0
+}
+
+// Subscribe registers a function that is called with the name of every
+// cached Secret once it is updated or deleted. It returns the function
+// that removes the subscription.
+func (s *SecretManager) Subscribe(fn func(name string)) func() {
+	s.subscribers.Lock()
+	defer s.subscribers.Unlock()
+
+	id := s.subscribers.nextID
+	s.subscribers.nextID++
+	s.subscribers.fns[id] = fn
+
+	return func() {
+		s.subscribers.Lock()
+		defer s.subscribers.Unlock()
+		delete(s.subscribers.fns, id)
+	}
+}
+
+func (s *SecretManager) updated(name string) {
+	s.generation.Add(1)
+	gen, _ := s.generations.LoadOrStore(name, &atomic.Uint64{})
+	gen.(*atomic.Uint64).Add(1)
+
+	s.subscribers.Lock()
+	fns := make([]func(name string), 0, len(s.subscribers.fns))
+	for _, fn := range s.subscribers.fns {
+		fns = append(fns, fn)
+	}
+	s.subscribers.Unlock()
+
+	for _, fn := range fns {
+		fn(name)
+	}
 }
 
 func (s *SecretManager) isInSecretNames(name string) bool {
@@ -191,6 +291,16 @@ func (s *SecretManager) ApplyService(ctx context.Context) error {
 				doAppend(authS.GetSigv4().GetSecretAccessKey().GetFromSecret())
 			}
 
+			if authS.GetHmac() != nil && authS.GetHmac().GetKey() != nil &&
+				authS.GetHmac().GetKey().GetFromSecret() != "" {
+				doAppend(authS.GetHmac().GetKey().GetFromSecret())
+			}
+
+			if authS.GetNtlm() != nil && authS.GetNtlm().GetPassword() != nil &&
+				authS.GetNtlm().GetPassword().GetFromSecret() != "" {
+				doAppend(authS.GetNtlm().GetPassword().GetFromSecret())
+			}
+
 			if authS.GetOauth2ClientCredentials() != nil &&
 				authS.GetOauth2ClientCredentials().GetClientSecret() != nil &&
 				authS.GetOauth2ClientCredentials().GetClientSecret().GetFromSecret() != "" {
@@ -206,6 +316,14 @@ func (s *SecretManager) ApplyService(ctx context.Context) error {
 
 		}
 
+		if cfg.GetClientCertificate().GetFromSecret() != "" {
+			doAppend(cfg.GetClientCertificate().GetFromSecret())
+		}
+
+		if cfg.GetTls().GetClientCertificate().GetFromSecret() != "" {
+			doAppend(cfg.GetTls().GetClientCertificate().GetFromSecret())
+		}
+
 		if cfg.GetKubernetes() != nil {
 			k8sC := svc.Spec.GetConfig().GetKubernetes()
 
@@ -241,7 +359,9 @@ func (s *SecretManager) setSecretNames(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		s.c.Set(secret.Metadata.Name, secret, 0)
+		if _, err := s.setCache(ctx, secret); err != nil {
+			return err
+		}
 	}
 
 	return nil
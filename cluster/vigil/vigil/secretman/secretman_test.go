@@ -27,13 +27,17 @@ import (
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/apis/main/metav1"
+	"github.com/octelium/octelium/apis/rsc/rcorev1"
 	"github.com/octelium/octelium/apis/rsc/rmetav1"
 	"github.com/octelium/octelium/cluster/apiserver/apiserver/admin"
+	"github.com/octelium/octelium/cluster/common/octeliumc"
 	"github.com/octelium/octelium/cluster/common/tests"
 	"github.com/octelium/octelium/cluster/vigil/vigil/vcache"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
 	"github.com/octelium/octelium/pkg/common/pbutils"
 	"github.com/octelium/octelium/pkg/utils/utilrand"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
 )
 
 type tstOAuthSrv struct {
@@ -272,3 +276,135 @@ func TestSecretManager(t *testing.T) {
 		assert.True(t, pbutils.IsEqual(sec2, sec2V))
 	}
 }
+
+type tstSlowCoreC struct {
+	rcorev1.ResourceServiceClient
+	delay  time.Duration
+	secret *corev1.Secret
+}
+
+func (c *tstSlowCoreC) GetSecret(ctx context.Context, in *rmetav1.GetOptions, opts ...grpc.CallOption) (*corev1.Secret, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(c.delay):
+		return c.secret, nil
+	}
+}
+
+type tstSlowOcteliumC struct {
+	octeliumc.ClientInterface
+	coreC *tstSlowCoreC
+}
+
+func (c *tstSlowOcteliumC) CoreC() rcorev1.ResourceServiceClient {
+	return c.coreC
+}
+
+type tstSlowProvider struct {
+	delay time.Duration
+}
+
+func (p *tstSlowProvider) Name() string {
+	return "slow"
+}
+
+func (p *tstSlowProvider) GetValue(ctx context.Context, ext *corev1.Secret_Spec_External) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(p.delay):
+		return []byte("slow"), nil
+	}
+}
+
+func TestLookupTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	coreC := &tstSlowCoreC{
+		delay: time.Hour,
+		secret: &corev1.Secret{
+			Metadata: &metav1.Metadata{
+				Name: "sec",
+			},
+			Spec: &corev1.Secret_Spec{},
+			Data: &corev1.Secret_Data{
+				Type: &corev1.Secret_Data_Value{
+					Value: "val",
+				},
+			},
+		},
+	}
+
+	s, err := New(ctx, &tstSlowOcteliumC{coreC: coreC}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultLookupTimeout, s.lookupTimeout)
+	s.lookupTimeout = 100 * time.Millisecond
+
+	{
+		startedAt := time.Now()
+		_, err := s.GetByName(ctx, "sec")
+		assert.NotNil(t, err)
+		assert.True(t, time.Since(startedAt) < 2*time.Second)
+	}
+
+	{
+		// The request deadline is honored when it is shorter than the timeout
+		s.lookupTimeout = time.Hour
+		reqCtx, reqCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer reqCancel()
+
+		startedAt := time.Now()
+		_, err := s.GetByName(reqCtx, "sec")
+		assert.NotNil(t, err)
+		assert.True(t, time.Since(startedAt) < 2*time.Second)
+	}
+
+	{
+		s.lookupTimeout = time.Second
+		coreC.delay = 0
+		res, err := s.GetByName(ctx, "sec")
+		assert.Nil(t, err)
+		assert.Equal(t, "val", ucorev1.ToSecret(res).GetValueStr())
+
+		// Cached Secrets are returned without any lookup
+		coreC.delay = time.Hour
+		res, err = s.GetByName(ctx, "sec")
+		assert.Nil(t, err)
+		assert.Equal(t, "val", ucorev1.ToSecret(res).GetValueStr())
+	}
+
+	{
+		// A slow external secret store falls back to the last resolved value
+		p := &tstSlowProvider{}
+		s.RegisterProvider(p)
+
+		coreC.delay = 0
+		coreC.secret = &corev1.Secret{
+			Metadata: &metav1.Metadata{
+				Name: "ext",
+			},
+			Spec: &corev1.Secret_Spec{
+				External: &corev1.Secret_Spec_External{
+					Provider: "slow",
+					Path:     "a/b",
+				},
+			},
+		}
+
+		res, err := s.GetByName(ctx, "ext")
+		assert.Nil(t, err)
+		assert.Equal(t, "slow", ucorev1.ToSecret(res).GetValueStr())
+
+		s.c.Delete("ext")
+		p.delay = time.Hour
+		s.lookupTimeout = 100 * time.Millisecond
+
+		startedAt := time.Now()
+		res, err = s.GetByName(ctx, "ext")
+		assert.Nil(t, err)
+		assert.Equal(t, "slow", ucorev1.ToSecret(res).GetValueStr())
+		assert.True(t, time.Since(startedAt) < 2*time.Second)
+	}
+}
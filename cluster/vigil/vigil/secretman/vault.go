@@ -0,0 +1,178 @@
+/*
+ * Copyright Octelium Labs, LLC. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License version 3,
+ * as published by the Free Software Foundation of the License.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package secretman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/octelium/octelium/apis/main/corev1"
+	"github.com/octelium/octelium/apis/rsc/rmetav1"
+	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/pkg/errors"
+)
+
+const vaultProviderName = "vault"
+
+// VaultProvider resolves the external Secrets from the KV version 2 secrets
+// engine of a Vault server. The path of a Secret is the engine's mount path
+// followed by the secret's path (e.g. "secret/my-app/db").
+type VaultProvider struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+type VaultProviderOpts struct {
+	Addr      string
+	Token     string
+	Namespace string
+}
+
+func NewVaultProvider(opts *VaultProviderOpts) (*VaultProvider, error) {
+	if _, err := url.ParseRequestURI(opts.Addr); err != nil {
+		return nil, errors.Errorf("Invalid Vault address: %s", opts.Addr)
+	}
+	if opts.Token == "" {
+		return nil, errors.Errorf("The Vault token must be set")
+	}
+
+	return &VaultProvider{
+		addr:      strings.TrimSuffix(opts.Addr, "/"),
+		token:     opts.Token,
+		namespace: opts.Namespace,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// newVaultProviderFromClusterConfig creates a VaultProvider from the Vault
+// provider set by the ClusterConfig whose token is read from its Secret. It
+// returns nil if the ClusterConfig does not set one.
+func (s *SecretManager) newVaultProviderFromClusterConfig(ctx context.Context,
+	cc *corev1.ClusterConfig) (*VaultProvider, error) {
+	vaultC := cc.GetSpec().GetSecretProviders().GetVault()
+	if vaultC == nil {
+		return nil, nil
+	}
+
+	if vaultC.Token.GetFromSecret() == "" {
+		return nil, errors.Errorf("The Vault token Secret must be set")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.lookupTimeout)
+	defer cancel()
+
+	tokenSecret, err := s.octeliumC.CoreC().GetSecret(ctx, &rmetav1.GetOptions{
+		Name: vaultC.Token.GetFromSecret(),
+	})
+	if err != nil {
+		return nil, errors.Errorf("Could not get the Vault token Secret: %+v", err)
+	}
+
+	return NewVaultProvider(&VaultProviderOpts{
+		Addr:      vaultC.Address,
+		Token:     ucorev1.ToSecret(tokenSecret).GetValueStr(),
+		Namespace: vaultC.Namespace,
+	})
+}
+
+func (p *VaultProvider) Name() string {
+	return vaultProviderName
+}
+
+func (p *VaultProvider) GetValue(ctx context.Context, ext *corev1.Secret_Spec_External) ([]byte, error) {
+	segments := strings.Split(strings.Trim(ext.Path, "/"), "/")
+	if len(segments) < 2 {
+		return nil, errors.Errorf("Invalid Vault secret path: %s", ext.Path)
+	}
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, errors.Errorf("Invalid Vault secret path: %s", ext.Path)
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/v1/%s/data/%s", p.addr, segments[0], strings.Join(segments[1:], "/")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Vault returned status %d", resp.StatusCode)
+	}
+
+	var res struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, errors.Errorf("Could not parse the Vault response: %s", err)
+	}
+
+	return getFieldValue(res.Data.Data, ext.Key)
+}
+
+// getFieldValue returns the value of the field selected by the key. The key
+// can be omitted if the secret has a single field.
+func getFieldValue(fields map[string]any, key string) ([]byte, error) {
+	if key == "" {
+		if len(fields) != 1 {
+			return nil, errors.Errorf("The key must be set for secrets with %d fields", len(fields))
+		}
+		for k := range fields {
+			key = k
+		}
+	}
+
+	val, ok := fields[key]
+	if !ok {
+		return nil, errors.Errorf("The secret has no field %q", key)
+	}
+
+	switch val := val.(type) {
+	case string:
+		return []byte(val), nil
+	default:
+		return json.Marshal(val)
+	}
+}
@@ -18,6 +18,7 @@ package vigil
 
 import (
 	"context"
+	"net/http"
 	"os"
 
 	"github.com/octelium/octelium/apis/main/corev1"
@@ -25,16 +26,21 @@ import (
 	"github.com/octelium/octelium/cluster/common/commoninit"
 	"github.com/octelium/octelium/cluster/common/healthcheck"
 	"github.com/octelium/octelium/cluster/common/octeliumc"
+	"github.com/octelium/octelium/cluster/common/otelutils"
 	"github.com/octelium/octelium/cluster/common/pprofsrv"
 	"github.com/octelium/octelium/cluster/common/vutils"
 	"github.com/octelium/octelium/cluster/common/watchers"
+	"github.com/octelium/octelium/cluster/vigil/vigil/bytequota"
+	"github.com/octelium/octelium/cluster/vigil/vigil/capture"
 	"github.com/octelium/octelium/cluster/vigil/vigil/controllers"
 	"github.com/octelium/octelium/cluster/vigil/vigil/loadbalancer"
+	"github.com/octelium/octelium/cluster/vigil/vigil/logctl"
 	"github.com/octelium/octelium/cluster/vigil/vigil/modes"
 	"github.com/octelium/octelium/cluster/vigil/vigil/octovigilc"
 	"github.com/octelium/octelium/cluster/vigil/vigil/secretman"
 	"github.com/octelium/octelium/cluster/vigil/vigil/vcache"
 	"github.com/octelium/octelium/pkg/apiutils/ucorev1"
+	"github.com/octelium/octelium/pkg/common/pbutils"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
@@ -64,6 +70,13 @@ type Server struct {
 	// metricsStore *metricsstore.MetricsStore
 
 	vCache *vcache.Cache
+
+	captureStore   *capture.Store
+	byteQuotaStore *bytequota.MemoryStore
+
+	logCtl *logctl.Controller
+
+	drainer *drainer
 }
 
 type Opts struct {
@@ -83,8 +96,16 @@ func NewServer(ctx context.Context, opts *Opts) (*Server, error) {
 		octeliumC: octeliumC,
 		svcUID:    opts.Service.Metadata.Uid,
 		svcCtl:    &controllers.ServiceController{},
+
+		captureStore:   capture.NewStore(),
+		byteQuotaStore: bytequota.NewMemoryStore(),
+		logCtl:         logctl.New(nil),
 	}
 
+	ret.drainer = newDrainer(func() modes.Server {
+		return ret.server
+	})
+
 	ret.vCache, err = vcache.NewCache(ctx)
 	if err != nil {
 		return nil, err
@@ -92,6 +113,7 @@ func NewServer(ctx context.Context, opts *Opts) (*Server, error) {
 
 	svc := opts.Service
 
+	ret.logCtl.Apply(svc)
 	ret.vCache.SetService(svc)
 
 	ret.octovigilC, err = octovigilc.NewClient(ctx, &octovigilc.Opts{
@@ -109,6 +131,19 @@ func NewServer(ctx context.Context, opts *Opts) (*Server, error) {
 		return nil, err
 	}
 
+	cc, err := octeliumC.CoreV1Utils().GetClusterConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ret.secretMan.ApplyClusterConfig(ctx, cc); err != nil {
+		zap.L().Warn("Could not apply the secret providers of the ClusterConfig", zap.Error(err))
+	}
+
+	if err := otelutils.RunAccessLogSinks(ctx, cc.Spec.AccessLog); err != nil {
+		zap.L().Warn("Could not run the access log sinks of the ClusterConfig", zap.Error(err))
+	}
+
 	ret.lbManager = loadbalancer.NewLbManager(octeliumC, ret.vCache)
 
 	ret.svcCtl.FnOnUpdate = func(ctx context.Context, new, old *corev1.Service) error {
@@ -120,6 +155,7 @@ func NewServer(ctx context.Context, opts *Opts) (*Server, error) {
 		zap.L().Debug("Starting onServiceUpdate",
 			zap.Any("svc", new))
 
+		ret.logCtl.Apply(new)
 		ret.vCache.SetService(new)
 
 		if err := ret.secretMan.ApplyService(ctx); err != nil {
@@ -128,6 +164,10 @@ func NewServer(ctx context.Context, opts *Opts) (*Server, error) {
 
 		if (new.Spec.Mode != old.Spec.Mode) ||
 			(ucorev1.ToService(new).RealPort() != ucorev1.ToService(old).RealPort()) {
+			if ret.drainer.isStarted() {
+				zap.L().Info("Mode or Port changed while draining. Not reloading Service")
+				return nil
+			}
 			zap.L().Info("Mode or Port changed. Reloading Service...")
 			ret.server.Close()
 			zap.L().Debug("Server is now closed")
@@ -163,6 +203,9 @@ func (s *Server) createServer(ctx context.Context) error {
 		SecretMan:  s.secretMan,
 		VCache:     s.vCache,
 		OctovigilC: s.octovigilC,
+
+		CaptureStore:   s.captureStore,
+		ByteQuotaStore: s.byteQuotaStore,
 		// MetricsStore:  s.metricsStore,
 		GetUpstream:   s.opts.GetUpstream,
 		PostAuthorize: s.opts.PostAuthorize,
@@ -236,13 +279,42 @@ func (s *Server) Run(ctx context.Context) error {
 	if err := watcher.Secret(ctx, nil, secretCtl.OnAdd, secretCtl.OnUpdate, secretCtl.OnDelete); err != nil {
 		return err
 	}
+	if err := watcher.ClusterConfig(ctx, nil, s.onClusterConfigUpdate); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+func (s *Server) onClusterConfigUpdate(ctx context.Context, new, old *corev1.ClusterConfig) error {
+	if pbutils.IsEqual(new.Spec.SecretProviders, old.Spec.SecretProviders) {
+		return nil
+	}
+
+	zap.L().Info("Secret providers of the ClusterConfig updated. Applying them...")
+	if err := s.secretMan.ApplyClusterConfig(ctx, new); err != nil {
+		zap.L().Warn("Could not apply the secret providers of the ClusterConfig", zap.Error(err))
+	}
+
+	return nil
+}
+
+// serveEvaluate evaluates a described request against the Service. It is only
+// supported by the HTTP-based Services.
+func (s *Server) serveEvaluate(w http.ResponseWriter, req *http.Request) {
+	srv, ok := s.server.(modes.RequestEvaluator)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	srv.ServeEvaluate(w, req)
+}
+
 func Run(ctx context.Context) error {
 
-	pprofsrv.New().Run(ctx)
+	pprofSrv := pprofsrv.New()
+	pprofSrv.Run(ctx)
 
 	octeliumC, err := octeliumc.NewClient(ctx)
 	if err != nil {
@@ -270,10 +342,22 @@ func Run(ctx context.Context) error {
 		return err
 	}
 
+	pprofSrv.Handle("/debug/captures", s.captureStore)
+	pprofSrv.Handle("/debug/logging", s.logCtl)
+	pprofSrv.Handle("/debug/drain", s.drainer)
+	pprofSrv.Handle("/debug/upstreams", s.lbManager)
+	pprofSrv.Handle("/debug/evaluate", http.HandlerFunc(s.serveEvaluate))
+	pprofSrv.Handle("/debug/quotas", bytequota.NewHandler(s.byteQuotaStore, func() uint64 {
+		return s.vCache.GetService().Spec.Config.GetHttp().GetByteQuota().GetMaxBytes()
+	}))
+
 	healthcheck.Run(vutils.HealthCheckPortVigil)
 	zap.L().Info("Vigil is running", zap.String("svc", svc.Metadata.Name))
 
 	<-ctx.Done()
 
+	zap.L().Info("Shutting down Vigil", zap.String("svc", svc.Metadata.Name))
+	s.server.Close()
+
 	return nil
 }
@@ -18,16 +18,22 @@ package vigil
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/octelium/octelium/apis/main/corev1"
 	"github.com/octelium/octelium/apis/main/metav1"
 	"github.com/octelium/octelium/cluster/apiserver/apiserver/admin"
+	"github.com/octelium/octelium/cluster/common/healthcheck"
 	"github.com/octelium/octelium/cluster/common/tests"
+	"github.com/octelium/octelium/cluster/vigil/vigil/modes"
 	"github.com/octelium/octelium/pkg/common/pbutils"
 	"github.com/octelium/octelium/pkg/utils/utilrand"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestServer(t *testing.T) {
@@ -129,3 +135,132 @@ func TestServer(t *testing.T) {
 	err = srv.server.Close()
 	assert.Nil(t, err)
 }
+
+type tstDrainServer struct {
+	drainCh chan struct{}
+	err     error
+}
+
+func (s *tstDrainServer) Run(ctx context.Context) error {
+	return nil
+}
+
+func (s *tstDrainServer) Close() error {
+	return nil
+}
+
+func (s *tstDrainServer) SetClusterCertificate(crt *corev1.Secret) error {
+	return nil
+}
+
+func (s *tstDrainServer) Drain(ctx context.Context) error {
+	select {
+	case <-s.drainCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *tstDrainServer) Connections() (int, int) {
+	return 3, 1
+}
+
+func TestDrainer(t *testing.T) {
+	ctx := context.Background()
+
+	tst, err := tests.Initialize(nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		tst.Destroy()
+	})
+	t.Cleanup(func() {
+		healthcheck.SetReady(true)
+	})
+
+	healthSrv := healthcheck.NewServer()
+	isReady := func() bool {
+		resp, err := healthSrv.Check(ctx, &grpc_health_v1.HealthCheckRequest{
+			Service: healthcheck.ServiceReadiness,
+		})
+		assert.Nil(t, err)
+		return resp.Status == grpc_health_v1.HealthCheckResponse_SERVING
+	}
+
+	isLive := func() bool {
+		resp, err := healthSrv.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		assert.Nil(t, err)
+		return resp.Status == grpc_health_v1.HealthCheckResponse_SERVING
+	}
+
+	doReq := func(d *drainer, method, target string) (int, *drainStatus) {
+		rw := httptest.NewRecorder()
+		d.ServeHTTP(rw, httptest.NewRequest(method, target, nil))
+		if rw.Body.Len() == 0 {
+			return rw.Code, nil
+		}
+		ret := &drainStatus{}
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), ret))
+		return rw.Code, ret
+	}
+
+	{
+		srv := &tstDrainServer{
+			drainCh: make(chan struct{}),
+		}
+		d := newDrainer(func() modes.Server {
+			return srv
+		})
+
+		code, status := doReq(d, http.MethodGet, "/debug/drain")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "serving", status.State)
+		assert.True(t, status.IsSupported)
+		assert.True(t, isReady())
+
+		code, _ = doReq(d, http.MethodPost, "/debug/drain?timeout=invalid")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = doReq(d, http.MethodPost, "/debug/drain?timeout=24h")
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.True(t, isReady())
+
+		code, status = doReq(d, http.MethodPost, "/debug/drain?timeout=1m")
+		assert.Equal(t, http.StatusAccepted, code)
+		assert.Equal(t, "draining", status.State)
+		assert.Equal(t, "1m0s", status.Timeout)
+		assert.Equal(t, 3, status.Connections)
+		assert.Equal(t, 1, status.ActiveConnections)
+		assert.False(t, isReady())
+		assert.True(t, isLive())
+
+		code, _ = doReq(d, http.MethodPost, "/debug/drain")
+		assert.Equal(t, http.StatusConflict, code)
+
+		close(srv.drainCh)
+		assert.Eventually(t, func() bool {
+			_, status := doReq(d, http.MethodGet, "/debug/drain")
+			return status.State == "drained" && status.Error == ""
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.False(t, isReady())
+	}
+
+	{
+		healthcheck.SetReady(true)
+		srv := &tstDrainServer{
+			drainCh: make(chan struct{}),
+		}
+		d := newDrainer(func() modes.Server {
+			return srv
+		})
+
+		code, _ := doReq(d, http.MethodPost, "/debug/drain?timeout=50ms")
+		assert.Equal(t, http.StatusAccepted, code)
+		assert.Eventually(t, func() bool {
+			_, status := doReq(d, http.MethodGet, "/debug/drain")
+			return status.State == "drained" && status.Error != ""
+		}, 5*time.Second, 10*time.Millisecond)
+
+		code, _ = doReq(d, http.MethodDelete, "/debug/drain")
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+	}
+}
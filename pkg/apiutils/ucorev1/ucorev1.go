@@ -737,6 +737,13 @@ func (s *Service) IsListenerHTTP2() bool {
 		return false
 	}
 
+	switch s.Spec.Config.GetHttp().GetAlpn().GetMode() {
+	case corev1.Service_Spec_Config_HTTP_ALPN_HTTP1_ONLY:
+		return false
+	case corev1.Service_Spec_Config_HTTP_ALPN_H2_ONLY:
+		return true
+	}
+
 	if s.Spec.Config != nil && s.Spec.Config.GetHttp() != nil && s.Spec.Config.GetHttp().ListenHTTP2 {
 		return true
 	}
@@ -74,3 +74,7 @@ func IsResourceExhausted(err error) bool {
 func IsUnimplemented(err error) bool {
 	return status.Code(err) == codes.Unimplemented
 }
+
+func IsConflict(err error) bool {
+	return status.Code(err) == codes.Aborted
+}